@@ -0,0 +1,133 @@
+package gosip
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+// OptionsResponder toggles the built-in OPTIONS responder on the listener,
+// overrides ServerConfig.AnswerOptions. It is ignored by the transport layer.
+type OptionsResponder bool
+
+func (o OptionsResponder) ApplyListen(opts *transport.ListenOptions) {}
+
+// Listener with toggled OPTIONS responder.
+type optionsListener struct {
+	network string
+	host    string
+	port    string
+	enabled bool
+}
+
+// Checks that the request is received on the listener,
+// listener on unspecified address matches any local host.
+func (l optionsListener) matches(req sip.Request) bool {
+	host, port, err := net.SplitHostPort(req.Destination())
+	if err != nil || port != l.port || !sip.TokenEqual(req.Transport(), l.network) {
+		return false
+	}
+	if ip := net.ParseIP(l.host); l.host == "" || ip != nil && ip.IsUnspecified() {
+		return true
+	}
+	return host == l.host
+}
+
+func (srv *server) setOptionsResponder(network, listenAddr string, enabled bool) {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		srv.Log().Warnf("toggle OPTIONS responder on %s %s failed: %s", network, listenAddr, err)
+		return
+	}
+
+	srv.hmu.Lock()
+	srv.optionsListeners = append(srv.optionsListeners, optionsListener{
+		network: network,
+		host:    strings.Trim(host, "[]"),
+		port:    port,
+		enabled: enabled,
+	})
+	srv.hmu.Unlock()
+}
+
+// Checks that the built-in OPTIONS responder is enabled on the listener that received the request.
+func (srv *server) answersOptions(req sip.Request) bool {
+	srv.hmu.RLock()
+	defer srv.hmu.RUnlock()
+
+	for _, l := range srv.optionsListeners {
+		if l.matches(req) {
+			return l.enabled
+		}
+	}
+	return srv.answerOptions
+}
+
+// Answers OPTIONS request with '200 OK' describing capabilities of the server
+// or the tenant that serves the request - RFC 3261 11.2.
+// 'Accept' and 'Accept-Encoding' are taken from options of the INVITE handler.
+func (srv *server) respondOptions(req sip.Request, logger log.Logger) {
+	res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+
+	var (
+		methods []sip.RequestMethod
+		options *HandlerOptions
+	)
+	if t, ok := sip.MessageMetadata(req).Value(tenantKey{}).(*tenant); ok {
+		methods = t.allowedMethods()
+		_, options, _ = t.handler(sip.INVITE)
+	} else {
+		methods = srv.getAllowedMethods()
+		srv.hmu.RLock()
+		options = srv.handlerOptions[sip.INVITE]
+		srv.hmu.RUnlock()
+	}
+
+	allow := sip.AllowHeader{sip.OPTIONS}
+	for _, method := range methods {
+		if method != sip.OPTIONS {
+			allow = append(allow, method)
+		}
+	}
+	sort.Slice(allow, func(i, j int) bool {
+		return allow[i] < allow[j]
+	})
+	res.AppendHeader(allow)
+
+	if len(srv.extensions) > 0 {
+		res.AppendHeader(&sip.SupportedHeader{
+			Options: srv.extensions,
+		})
+	}
+
+	codings := []string{"identity"}
+	if options != nil {
+		if len(options.AcceptTypes) > 0 {
+			accept := sip.Accept(strings.Join(options.AcceptTypes, ", "))
+			res.AppendHeader(&accept)
+		}
+		codings = append(codings, options.AcceptEncodings...)
+	}
+	res.AppendHeader(&sip.GenericHeader{
+		HeaderName: "Accept-Encoding",
+		Contents:   strings.Join(codings, ", "),
+	})
+
+	if len(srv.acceptLanguages) > 0 {
+		res.AppendHeader(&sip.GenericHeader{
+			HeaderName: "Accept-Language",
+			Contents:   strings.Join(srv.acceptLanguages, ", "),
+		})
+	}
+	if srv.events.Len() > 0 {
+		res.AppendHeader(srv.events.AllowEvents())
+	}
+
+	if _, err := srv.Respond(res); err != nil {
+		logger.Errorf("respond '200 OK' on OPTIONS failed: %s", err)
+	}
+}
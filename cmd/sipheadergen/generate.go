@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"text/template"
+)
+
+var funcs = template.FuncMap{
+	"lower": strings.ToLower,
+	"quote": func(s string) string { return fmt.Sprintf("%q", s) },
+}
+
+// Generate renders Go source of the header implementations.
+func Generate(schema *Schema) ([]byte, error) {
+	return render(headersTemplate, schema)
+}
+
+// GenerateTest renders Go source of the tests of the generated headers.
+func GenerateTest(schema *Schema) ([]byte, error) {
+	return render(testTemplate, schema)
+}
+
+func render(tpl *template.Template, schema *Schema) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, schema); err != nil {
+		return nil, fmt.Errorf("render %s: %w", tpl.Name(), err)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format %s: %w", tpl.Name(), err)
+	}
+	return src, nil
+}
+
+var headersTemplate = template.Must(template.New("headers").Funcs(funcs).Parse(`// Code generated by sipheadergen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+// RegisterHeaderParsers registers parsers of the generated headers in parser.Parser or parser.PacketParser.
+func RegisterHeaderParsers(p interface {
+	SetHeaderParser(headerName string, headerParser parser.HeaderParser)
+}) {
+{{- range .Headers }}
+	p.SetHeaderParser({{ quote (lower .Name) }}, Parse{{ .Type }})
+{{- if .Compact }}
+	p.SetHeaderParser({{ quote (lower .Compact) }}, Parse{{ .Type }})
+{{- end }}
+{{- end }}
+}
+
+// Quotes parameter value that is not a token - RFC 3261 25.1.
+func generatedParamValue(value string) string {
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-.!%*_+` + "`" + `'~", c)) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+func generatedParamsEqual(a, b sip.Params) bool {
+	if a == nil {
+		a = sip.NewParams()
+	}
+	if b == nil {
+		b = sip.NewParams()
+	}
+	return a.Equals(b)
+}
+{{ range .Headers }}
+// {{ .Type }} is '{{ .Name }}' header.
+type {{ .Type }} struct {
+{{- if .Value }}
+	{{ .Value.Field }} {{ .Value.GoType }}
+{{- end }}
+{{- range .Params }}
+	// {{ .Field }} is '{{ .Name }}' parameter.
+	{{ .Field }} {{ .GoType }}
+{{- end }}
+	// Params holds parameters not declared in the schema.
+	Params sip.Params
+}
+
+func (hdr *{{ .Type }}) Name() string { return {{ quote .Name }} }
+
+func (hdr *{{ .Type }}) Value() string {
+	var parts []string
+{{- if .Value }}
+{{- if eq .Value.Kind "uint" }}
+	parts = append(parts, strconv.FormatUint(hdr.{{ .Value.Field }}, 10))
+{{- else }}
+	parts = append(parts, hdr.{{ .Value.Field }})
+{{- end }}
+{{- end }}
+{{- range .Params }}
+{{- if eq .Kind "bool" }}
+	if hdr.{{ .Field }} {
+		parts = append(parts, {{ quote .Name }})
+	}
+{{- else if eq .Kind "uint" }}
+	if hdr.{{ .Field }} != 0 {
+		parts = append(parts, {{ quote .Name }}+"="+strconv.FormatUint(hdr.{{ .Field }}, 10))
+	}
+{{- else }}
+	if hdr.{{ .Field }} != "" {
+		parts = append(parts, {{ quote .Name }}+"="+generatedParamValue(hdr.{{ .Field }}))
+	}
+{{- end }}
+{{- end }}
+	if hdr.Params != nil && hdr.Params.Length() > 0 {
+		parts = append(parts, hdr.Params.ToString(';'))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+func (hdr *{{ .Type }}) String() string {
+	return fmt.Sprintf("%s: %s", hdr.Name(), hdr.Value())
+}
+
+func (hdr *{{ .Type }}) Clone() sip.Header {
+	if hdr == nil {
+		var newHdr *{{ .Type }}
+		return newHdr
+	}
+
+	newHdr := *hdr
+	if hdr.Params != nil {
+		newHdr.Params = hdr.Params.Clone()
+	}
+	return &newHdr
+}
+
+func (hdr *{{ .Type }}) Equals(other interface{}) bool {
+	h, ok := other.(*{{ .Type }})
+	if !ok {
+		return false
+	}
+	if hdr == h {
+		return true
+	}
+	if hdr == nil || h == nil {
+		return false
+	}
+
+{{- if .Value }}
+	if hdr.{{ .Value.Field }} != h.{{ .Value.Field }} {
+		return false
+	}
+{{- end }}
+{{- range .Params }}
+	if hdr.{{ .Field }} != h.{{ .Field }} {
+		return false
+	}
+{{- end }}
+
+	return generatedParamsEqual(hdr.Params, h.Params)
+}
+
+// Parse{{ .Type }} is parser.HeaderParser of '{{ .Name }}' header.
+func Parse{{ .Type }}(headerName string, headerText string) ([]sip.Header, error) {
+	headerText = strings.TrimSpace(headerText)
+{{- if .Value }}
+	value, rawParams := headerText, ""
+	if i := strings.IndexByte(headerText, ';'); i >= 0 {
+		value, rawParams = strings.TrimSpace(headerText[:i]), headerText[i:]
+	}
+{{- else }}
+	value, rawParams := "", ""
+	if headerText != "" {
+		rawParams = ";" + headerText
+	}
+{{- end }}
+
+	params, _, err := parser.ParseParams(rawParams, ';', ';', 0, true, true)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s params: %w", headerName, err)
+	}
+
+	hdr := &{{ .Type }}{}
+{{- if .Value }}
+{{- if eq .Value.Kind "uint" }}
+	if hdr.{{ .Value.Field }}, err = strconv.ParseUint(value, 10, 64); err != nil {
+		return nil, fmt.Errorf("parse %s value: %w", headerName, err)
+	}
+{{- else }}
+	hdr.{{ .Value.Field }} = value
+{{- end }}
+{{- else }}
+	_ = value
+{{- end }}
+{{- range .Params }}
+	if val, ok := params.Get({{ quote .Name }}); ok {
+{{- if eq .Kind "bool" }}
+		hdr.{{ .Field }} = true
+		_ = val
+{{- else if eq .Kind "uint" }}
+		if val == nil {
+			return nil, fmt.Errorf("missing value of %s param '{{ .Name }}'", headerName)
+		}
+		if hdr.{{ .Field }}, err = strconv.ParseUint(val.String(), 10, 64); err != nil {
+			return nil, fmt.Errorf("parse %s param '{{ .Name }}': %w", headerName, err)
+		}
+{{- else }}
+		if val != nil {
+			hdr.{{ .Field }} = val.String()
+		}
+{{- end }}
+		params.Remove({{ quote .Name }})
+	}
+{{- end }}
+	hdr.Params = params
+
+	return []sip.Header{hdr}, nil
+}
+{{ end }}`))
+
+var testTemplate = template.Must(template.New("test").Funcs(funcs).Parse(`// Code generated by sipheadergen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import "testing"
+{{ range .Headers }}{{ if .Example }}
+func Test{{ .Type }}(t *testing.T) {
+	hdrs, err := Parse{{ .Type }}({{ quote .Name }}, {{ quote .Example }})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(hdrs) != 1 {
+		t.Fatalf("expected 1 header, got %d", len(hdrs))
+	}
+	hdr, ok := hdrs[0].(*{{ .Type }})
+	if !ok {
+		t.Fatalf("unexpected header type %T", hdrs[0])
+	}
+	if hdr.Value() != {{ quote .Example }} {
+		t.Errorf("expected value '%s', got '%s'", {{ quote .Example }}, hdr.Value())
+	}
+	if hdr.String() != {{ quote (printf "%s: %s" .Name .Example) }} {
+		t.Errorf("unexpected header '%s'", hdr)
+	}
+
+	clone := hdr.Clone()
+	if !hdr.Equals(clone) {
+		t.Errorf("clone %s is not equal to %s", clone, hdr)
+	}
+	clone.(*{{ .Type }}).Params.Add("x-generated", nil)
+	if hdr.Equals(clone) {
+		t.Errorf("modified clone %s is equal to %s", clone, hdr)
+	}
+}
+{{ end }}{{ end }}`))
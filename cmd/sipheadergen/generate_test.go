@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Generated example must be in sync with the generator.
+func TestGenerateExample(t *testing.T) {
+	dir := filepath.Join("..", "..", "examples", "headers")
+	data, err := ioutil.ReadFile(filepath.Join(dir, "headers.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	schema, err := ParseSchema(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	schema.Package = "headers"
+
+	for file, generate := range map[string]func(*Schema) ([]byte, error){
+		"headers_gen.go":      Generate,
+		"headers_gen_test.go": GenerateTest,
+	} {
+		src, err := generate(schema)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", file, err)
+		}
+		expected, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !bytes.Equal(src, expected) {
+			t.Errorf("%s is out of date, run go generate", file)
+		}
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	cases := map[string]string{
+		"empty":       `{"headers": []}`,
+		"duplicate":   `{"headers": [{"name": "X-A", "type": "A"}, {"name": "x-a", "type": "B"}]}`,
+		"bad type":    `{"headers": [{"name": "X-A", "type": "a-b"}]}`,
+		"bool value":  `{"headers": [{"name": "X-A", "type": "A", "value": {"field": "V", "kind": "bool"}}]}`,
+		"bad kind":    `{"headers": [{"name": "X-A", "type": "A", "params": [{"name": "p", "field": "P", "kind": "float"}]}]}`,
+		"dup field":   `{"headers": [{"name": "X-A", "type": "A", "params": [{"name": "p", "field": "Params", "kind": "string"}]}]}`,
+		"unexported":  `{"headers": [{"name": "X-A", "type": "A", "params": [{"name": "p", "field": "p", "kind": "string"}]}]}`,
+		"not a json":  `headers`,
+		"param name":  `{"headers": [{"name": "X-A", "type": "A", "params": [{"field": "P", "kind": "string"}]}]}`,
+		"header name": `{"headers": [{"type": "A"}]}`,
+	}
+	for name, schema := range cases {
+		if _, err := ParseSchema([]byte(schema)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Command sipheadergen generates typed extension header implementations from a JSON schema.
+//
+// Usage with go:generate:
+//
+//	//go:generate go run github.com/ghettovoice/gosip/cmd/sipheadergen -schema headers.json -out headers_gen.go -test headers_gen_test.go
+//
+// Schema example:
+//
+//	{
+//	  "headers": [
+//	    {
+//	      "name": "Session-Expires",
+//	      "compact": "x",
+//	      "type": "SessionExpiresHeader",
+//	      "value": {"field": "Delta", "kind": "uint"},
+//	      "params": [{"name": "refresher", "field": "Refresher", "kind": "string"}],
+//	      "example": "1800;refresher=uac"
+//	    }
+//	  ]
+//	}
+//
+// Value kinds are "string" and "uint", parameter kinds are "string", "uint" and "bool" (flag parameter).
+// Zero string and uint parameters are not rendered. Parameters not declared in the schema are kept
+// in the Params field. For every header the generator emits the struct with sip.Header implementation,
+// the header parser and RegisterHeaderParsers function that registers all parsers in a parser.
+// The test file checks parse/render round trip, Clone and Equals on the schema examples.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "", "path to the JSON schema")
+	out := flag.String("out", "", "path to the generated file")
+	testOut := flag.String("test", "", "path to the generated test file, optional")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name of the generated files")
+	flag.Parse()
+
+	if err := run(*schemaPath, *out, *testOut, *pkg); err != nil {
+		fmt.Fprintf(os.Stderr, "sipheadergen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(schemaPath, out, testOut, pkg string) error {
+	if schemaPath == "" || out == "" {
+		return fmt.Errorf("-schema and -out are required")
+	}
+
+	data, err := ioutil.ReadFile(schemaPath)
+	if err != nil {
+		return err
+	}
+	schema, err := ParseSchema(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", schemaPath, err)
+	}
+	if schema.Package == "" {
+		schema.Package = pkg
+	}
+	if schema.Package == "" {
+		return fmt.Errorf("package name is not set")
+	}
+
+	src, err := Generate(schema)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(out, src, 0644); err != nil {
+		return err
+	}
+
+	if testOut != "" {
+		src, err := GenerateTest(schema)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(testOut, src, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+type Schema struct {
+	Package string         `json:"package"`
+	Headers []HeaderSchema `json:"headers"`
+}
+
+type HeaderSchema struct {
+	// Name is the canonical header name, e.g. 'Session-Expires'.
+	Name string `json:"name"`
+	// Compact is the optional compact form of the name.
+	Compact string `json:"compact"`
+	// Type is the name of the generated struct.
+	Type   string        `json:"type"`
+	Value  *FieldSchema  `json:"value"`
+	Params []FieldSchema `json:"params"`
+	// Example is the header value used in the generated tests.
+	Example string `json:"example"`
+}
+
+type FieldSchema struct {
+	// Name is the parameter name, not used for the header value.
+	Name  string `json:"name"`
+	Field string `json:"field"`
+	Kind  string `json:"kind"`
+}
+
+// GoType returns Go type of the field.
+func (field FieldSchema) GoType() string {
+	switch field.Kind {
+	case "uint":
+		return "uint64"
+	case "bool":
+		return "bool"
+	default:
+		return "string"
+	}
+}
+
+func ParseSchema(data []byte) (*Schema, error) {
+	schema := new(Schema)
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func (schema *Schema) Validate() error {
+	if len(schema.Headers) == 0 {
+		return fmt.Errorf("no headers declared")
+	}
+
+	names := make(map[string]bool)
+	for _, hdr := range schema.Headers {
+		if hdr.Name == "" {
+			return fmt.Errorf("header without name")
+		}
+		if names[strings.ToLower(hdr.Name)] {
+			return fmt.Errorf("header %s declared twice", hdr.Name)
+		}
+		names[strings.ToLower(hdr.Name)] = true
+
+		if !token.IsIdentifier(hdr.Type) {
+			return fmt.Errorf("header %s: invalid type name '%s'", hdr.Name, hdr.Type)
+		}
+		if hdr.Value != nil {
+			if err := hdr.Value.validate(false); err != nil {
+				return fmt.Errorf("header %s value: %w", hdr.Name, err)
+			}
+		}
+
+		fields := map[string]bool{"Params": true}
+		if hdr.Value != nil {
+			fields[hdr.Value.Field] = true
+		}
+		for _, param := range hdr.Params {
+			if param.Name == "" {
+				return fmt.Errorf("header %s: parameter without name", hdr.Name)
+			}
+			if err := param.validate(true); err != nil {
+				return fmt.Errorf("header %s param %s: %w", hdr.Name, param.Name, err)
+			}
+			if fields[param.Field] {
+				return fmt.Errorf("header %s: field %s declared twice", hdr.Name, param.Field)
+			}
+			fields[param.Field] = true
+		}
+	}
+
+	return nil
+}
+
+func (field FieldSchema) validate(param bool) error {
+	if !token.IsIdentifier(field.Field) || !token.IsExported(field.Field) {
+		return fmt.Errorf("invalid field name '%s'", field.Field)
+	}
+
+	switch field.Kind {
+	case "string", "uint":
+		return nil
+	case "bool":
+		if param {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported kind '%s'", field.Kind)
+}
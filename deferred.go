@@ -0,0 +1,110 @@
+package gosip
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+// DefaultDeferTimeout is a guard timeout of deferred requests, it equals to the proxy Timer C - RFC 3261 16.6.
+const DefaultDeferTimeout = 3 * time.Minute
+
+// deferredTx is a server transaction which request is answered asynchronously.
+// It sends '408 Request Timeout' if the application never responds.
+type deferredTx struct {
+	sip.ServerTransaction
+	srv *server
+
+	mu       sync.Mutex
+	answered bool
+	timer    timing.Timer
+}
+
+func (tx *deferredTx) Respond(res sip.Response) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.answered {
+		return fmt.Errorf("deferred request of %s already answered", tx.ServerTransaction)
+	}
+	if err := tx.ServerTransaction.Respond(res); err != nil {
+		return err
+	}
+	if !res.IsProvisional() {
+		tx.complete()
+	}
+
+	return nil
+}
+
+// Should be called under lock.
+func (tx *deferredTx) complete() {
+	tx.answered = true
+	tx.timer.Stop()
+	tx.srv.deferred.Delete(tx.Key())
+}
+
+func (tx *deferredTx) expire() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.answered {
+		return
+	}
+	tx.complete()
+
+	logger := tx.srv.Log().WithFields(tx.Origin().Fields())
+	logger.Warn("deferred request is not answered in time")
+
+	res := sip.NewResponseFromRequest("", tx.Origin(), 408, "Request Timeout", "")
+	if err := tx.ServerTransaction.Respond(tx.srv.prepareResponse(res)); err != nil {
+		logger.Errorf("respond '408 Request Timeout' failed: %s", err)
+	}
+}
+
+func (srv *server) Defer(tx sip.ServerTransaction, timeout time.Duration) (sip.ServerTransaction, error) {
+	if tx == nil {
+		return nil, fmt.Errorf("can not defer request without server transaction")
+	}
+	if timeout <= 0 {
+		timeout = DefaultDeferTimeout
+	}
+
+	dtx := &deferredTx{
+		ServerTransaction: tx,
+		srv:               srv,
+	}
+	if _, loaded := srv.deferred.LoadOrStore(tx.Key(), dtx); loaded {
+		return nil, fmt.Errorf("request of %s already deferred", tx)
+	}
+
+	dtx.mu.Lock()
+	dtx.timer = timing.AfterFunc(timeout, srv.timerPanics().Protect(fmt.Sprintf("%s deferred", tx), dtx.expire))
+	dtx.mu.Unlock()
+
+	// drop forgotten transaction, e.g. terminated by transport error
+	go func() {
+		<-tx.Done()
+
+		dtx.mu.Lock()
+		if !dtx.answered {
+			dtx.answered = true
+			dtx.timer.Stop()
+			srv.deferred.Delete(tx.Key())
+		}
+		dtx.mu.Unlock()
+	}()
+
+	return dtx, nil
+}
+
+func (srv *server) ServerTransaction(key sip.TransactionKey) (sip.ServerTransaction, bool) {
+	if dtx, ok := srv.deferred.Load(key); ok {
+		return dtx.(*deferredTx), true
+	}
+
+	return srv.tx.ServerTransaction(key)
+}
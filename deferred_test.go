@@ -0,0 +1,79 @@
+package gosip_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("GoSIP Server deferred responses", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9006"
+	localTarget := transport.NewTarget("127.0.0.1", 5066)
+	logger := testutils.NewLogrusLogger()
+
+	messageReq := func() sip.Request {
+		return testutils.Request([]string{
+			"MESSAGE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: deferred-test",
+			"CSeq: 1 MESSAGE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	}
+
+	BeforeEach(func() {
+		srv = gosip.NewServer(gosip.ServerConfig{}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+	})
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	It("should respond on deferred request found by key", func(done Done) {
+		defer close(done)
+
+		Expect(srv.OnRequest(sip.MESSAGE, func(req sip.Request, tx sip.ServerTransaction) {
+			_, err := srv.Defer(tx, time.Second)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			go func(key sip.TransactionKey) {
+				defer GinkgoRecover()
+
+				time.Sleep(50 * time.Millisecond)
+				dtx, ok := srv.ServerTransaction(key)
+				Expect(ok).To(BeTrue())
+				Expect(dtx.Respond(sip.NewResponseFromRequest("", dtx.Origin(), 200, "OK", ""))).To(Succeed())
+				Expect(dtx.Respond(sip.NewResponseFromRequest("", dtx.Origin(), 500, "Server Internal Error", ""))).
+					ShouldNot(Succeed())
+			}(tx.Key())
+		})).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(200))
+	}, 3)
+
+	It("should respond with 408 if deferred request is not answered in time", func(done Done) {
+		defer close(done)
+
+		Expect(srv.OnRequest(sip.MESSAGE, func(req sip.Request, tx sip.ServerTransaction) {
+			_, err := srv.Defer(tx, 100*time.Millisecond)
+			Expect(err).ShouldNot(HaveOccurred())
+		})).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(408))
+	}, 3)
+})
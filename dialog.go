@@ -0,0 +1,92 @@
+package gosip
+
+import (
+	"fmt"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// DialogFailure describes in-dialog request rejected with '481 Call/Transaction Does Not Exist',
+// usually because the remote side has restarted and lost the dialog state - RFC 5057 5.1.
+// It carries enough information to tear the call down cleanly or to recover it
+// with a new INVITE with 'Replaces' header - RFC 3891.
+type DialogFailure struct {
+	DialogID  string
+	CallID    string
+	LocalTag  string
+	RemoteTag string
+	// LocalUri and RemoteUri are addresses of the 'From' and 'To' headers of the request.
+	LocalUri  sip.Uri
+	RemoteUri sip.Uri
+	// RemoteTarget is the Request-URI of the rejected request.
+	RemoteTarget sip.Uri
+	// RouteSet holds 'Route' headers of the rejected request.
+	RouteSet []sip.Header
+	Request  sip.Request
+	Response sip.Response
+}
+
+// NewDialogFailure creates DialogFailure for the in-dialog request and the response on it.
+func NewDialogFailure(req sip.Request, res sip.Response) (*DialogFailure, error) {
+	if !sip.IsInDialog(req) {
+		return nil, fmt.Errorf("request %s is not in-dialog", req.Short())
+	}
+
+	dialogID, err := sip.MakeDialogIDFromMessage(req)
+	if err != nil {
+		return nil, fmt.Errorf("make dialog ID of %s: %w", req.Short(), err)
+	}
+
+	callID, _ := req.CallID()
+	from, _ := req.From()
+	to, _ := req.To()
+	localTag, _ := from.Params.Get("tag")
+	remoteTag, _ := to.Params.Get("tag")
+
+	return &DialogFailure{
+		DialogID:     dialogID,
+		CallID:       string(*callID),
+		LocalTag:     localTag.String(),
+		RemoteTag:    remoteTag.String(),
+		LocalUri:     from.Address,
+		RemoteUri:    to.Address,
+		RemoteTarget: req.Recipient(),
+		RouteSet:     req.GetHeaders("Route"),
+		Request:      req,
+		Response:     res,
+	}, nil
+}
+
+// Replaces returns 'Replaces' header that identifies the failed dialog
+// for a new INVITE that takes over the call - RFC 3891.
+func (failure *DialogFailure) Replaces() sip.Header {
+	return &sip.GenericHeader{
+		HeaderName: "Replaces",
+		Contents:   fmt.Sprintf("%s;to-tag=%s;from-tag=%s", failure.CallID, failure.RemoteTag, failure.LocalTag),
+	}
+}
+
+func (failure *DialogFailure) String() string {
+	if failure == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("gosip.DialogFailure<%s>: %s rejected with %s", failure.DialogID, failure.Request.Short(), failure.Response.Short())
+}
+
+// Emits dialog failure if the final response on in-dialog request reports that the dialog doesn't exist.
+func (srv *server) checkDialogFailure(req sip.Request, res sip.Response) {
+	if srv.onDialogFailed == nil || res.StatusCode() != 481 || !sip.IsInDialog(req) {
+		return
+	}
+
+	failure, err := NewDialogFailure(req, res)
+	if err != nil {
+		srv.Log().WithFields(req.Fields()).Warnf("dialog failure not emitted: %s", err)
+		return
+	}
+
+	defer srv.recoverCallback("OnDialogFailed", srv.Log().WithFields(req.Fields()), nil)
+
+	srv.onDialogFailed(failure)
+}
@@ -0,0 +1,90 @@
+package gosip_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("GoSIP Server dialog failures", func() {
+	peerAddr := "127.0.0.1:9008"
+	logger := testutils.NewLogrusLogger()
+
+	byeReq := func() sip.Request {
+		return testutils.Request([]string{
+			"BYE sip:bob@" + peerAddr + " SIP/2.0",
+			"Route: <sip:" + peerAddr + ";lr>",
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>;tag=a6c85cf",
+			"Call-ID: dialog-failure-test",
+			"CSeq: 2 BYE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	}
+
+	It("should describe failed dialog", func() {
+		req := byeReq()
+		failure, err := gosip.NewDialogFailure(req, sip.NewResponseFromRequest("", req, 481, "Call/Transaction Does Not Exist", ""))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(failure.CallID).To(Equal("dialog-failure-test"))
+		Expect(failure.LocalTag).To(Equal("1928301774"))
+		Expect(failure.RemoteTag).To(Equal("a6c85cf"))
+		Expect(failure.RemoteTarget.String()).To(Equal("sip:bob@" + peerAddr))
+		Expect(failure.RouteSet).To(HaveLen(1))
+		Expect(failure.Replaces().Value()).To(Equal("dialog-failure-test;to-tag=a6c85cf;from-tag=1928301774"))
+
+		out := testutils.Request([]string{
+			"INVITE sip:bob@far-far-away.com SIP/2.0",
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"CSeq: 1 INVITE",
+			"",
+			"",
+		})
+		_, err = gosip.NewDialogFailure(out, sip.NewResponseFromRequest("", out, 481, "Call/Transaction Does Not Exist", ""))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should emit dialog failure on 481 to in-dialog request", func(done Done) {
+		defer close(done)
+
+		tpl := testutils.NewMockTransportLayer()
+		failures := make(chan *gosip.DialogFailure, 1)
+		srv := gosip.NewServer(
+			gosip.ServerConfig{
+				OnDialogFailed: func(failure *gosip.DialogFailure) {
+					failures <- failure
+				},
+			},
+			nil,
+			func(_ sip.Transport, logger log.Logger) transaction.Layer {
+				return transaction.NewLayer(tpl, logger)
+			},
+			logger,
+		)
+		defer srv.Shutdown()
+
+		peer := testutils.NewScriptedEndpoint(tpl.Peer()).
+			ExpectRequest(sip.BYE).
+			Respond(481, "Call/Transaction Does Not Exist").
+			Start()
+
+		_, err := srv.RequestWithContext(context.Background(), byeReq())
+		Expect(err).To(HaveOccurred())
+
+		Expect(<-peer).To(Succeed())
+
+		failure := <-failures
+		Expect(failure.CallID).To(Equal("dialog-failure-test"))
+		Expect(int(failure.Response.StatusCode())).To(Equal(481))
+	}, 5)
+})
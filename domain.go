@@ -0,0 +1,123 @@
+package gosip
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Domain describes local SIP domain.
+type Domain struct {
+	Name string
+	// Aliases are alternative names of the domain,
+	// wildcard aliases like '*.example.com' match any subdomain.
+	Aliases []string
+	// Realm overrides authentication realm for the domain.
+	Realm string
+	// Stamp overrides auto headers profile for the domain.
+	Stamp *StampProfile
+	// Values holds application specific per-domain settings.
+	Values map[string]string
+}
+
+// DomainRegistry keeps local domains and decides whether a request is addressed to us
+// or needs forwarding. Domains can be added and removed at runtime.
+type DomainRegistry struct {
+	mu      sync.RWMutex
+	domains []*Domain
+}
+
+func NewDomainRegistry(domains ...*Domain) *DomainRegistry {
+	registry := new(DomainRegistry)
+	for _, domain := range domains {
+		_ = registry.Add(domain)
+	}
+	return registry
+}
+
+// Add registers new domain, returns error if the domain with the same name exists.
+func (registry *DomainRegistry) Add(domain *Domain) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for _, other := range registry.domains {
+		if sip.HostEqual(other.Name, domain.Name) {
+			return fmt.Errorf("domain '%s' already exists", domain.Name)
+		}
+	}
+	registry.domains = append(registry.domains, domain)
+	return nil
+}
+
+// Remove unregisters domain by name.
+func (registry *DomainRegistry) Remove(name string) bool {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for i, domain := range registry.domains {
+		if sip.HostEqual(domain.Name, name) {
+			registry.domains = append(registry.domains[:i], registry.domains[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Domains returns all registered domains.
+func (registry *DomainRegistry) Domains() []*Domain {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	domains := make([]*Domain, len(registry.domains))
+	copy(domains, registry.domains)
+	return domains
+}
+
+// Match returns domain served for the host.
+// Exact names and aliases take precedence over wildcard aliases.
+func (registry *DomainRegistry) Match(host string) (*Domain, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	for _, domain := range registry.domains {
+		if sip.HostEqual(domain.Name, host) {
+			return domain, true
+		}
+		for _, alias := range domain.Aliases {
+			if !strings.HasPrefix(alias, "*.") && sip.HostEqual(alias, host) {
+				return domain, true
+			}
+		}
+	}
+	for _, domain := range registry.domains {
+		for _, alias := range domain.Aliases {
+			if strings.HasPrefix(alias, "*.") && matchDomain(alias, host) {
+				return domain, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// IsLocal checks that the URI is addressed to one of the local domains.
+func (registry *DomainRegistry) IsLocal(uri sip.Uri) bool {
+	if uri == nil {
+		return false
+	}
+
+	_, ok := registry.Match(uri.Host())
+	return ok
+}
+
+// Checks host against domain pattern, pattern '*.example.com' matches any subdomain of example.com.
+func matchDomain(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		suffix := pattern[1:]
+		return len(host) > len(suffix) && sip.TokenEqual(host[len(host)-len(suffix):], suffix)
+	}
+
+	return sip.HostEqual(pattern, host)
+}
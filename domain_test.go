@@ -0,0 +1,47 @@
+package gosip_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+var _ = Describe("DomainRegistry", func() {
+	var registry *gosip.DomainRegistry
+
+	BeforeEach(func() {
+		registry = gosip.NewDomainRegistry(
+			&gosip.Domain{Name: "example.com", Aliases: []string{"sip.example.com", "*.example.com"}},
+			&gosip.Domain{Name: "other.com", Realm: "other"},
+		)
+	})
+
+	It("should match domain by name and aliases", func() {
+		domain, ok := registry.Match("EXAMPLE.com")
+		Expect(ok).To(BeTrue())
+		Expect(domain.Name).To(Equal("example.com"))
+
+		domain, ok = registry.Match("pbx.eu.example.com")
+		Expect(ok).To(BeTrue())
+		Expect(domain.Name).To(Equal("example.com"))
+
+		_, ok = registry.Match("badexample.com")
+		Expect(ok).To(BeFalse())
+
+		Expect(registry.IsLocal(&sip.SipUri{FHost: "other.com"})).To(BeTrue())
+		Expect(registry.IsLocal(&sip.SipUri{FHost: "far-far-away.com"})).To(BeFalse())
+	})
+
+	It("should add and remove domains at runtime", func() {
+		Expect(registry.Add(&gosip.Domain{Name: "other.com"})).ShouldNot(Succeed())
+		Expect(registry.Add(&gosip.Domain{Name: "new.com"})).To(Succeed())
+		Expect(registry.Domains()).To(HaveLen(3))
+
+		Expect(registry.Remove("other.com")).To(BeTrue())
+		Expect(registry.Remove("other.com")).To(BeFalse())
+		_, ok := registry.Match("other.com")
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,4 @@
+// Package headers is an example of typed extension headers generated with sipheadergen.
+package headers
+
+//go:generate go run github.com/ghettovoice/gosip/cmd/sipheadergen -schema headers.json -out headers_gen.go -test headers_gen_test.go
@@ -0,0 +1,38 @@
+package headers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func TestRegisterHeaderParsers(t *testing.T) {
+	p := parser.NewPacketParser(log.NewDefaultLogrusLogger())
+	RegisterHeaderParsers(p)
+
+	msg, err := p.ParseMessage([]byte(strings.Join([]string{
+		"UPDATE sip:bob@example.com SIP/2.0",
+		"From: <sip:alice@example.com>;tag=1928301774",
+		"To: <sip:bob@example.com>;tag=a6c85cf",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 2 UPDATE",
+		"x: 1800;refresher=uas",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	hdrs := msg.GetHeaders("Session-Expires")
+	if len(hdrs) != 1 {
+		t.Fatalf("expected Session-Expires header, got %v", msg.Headers())
+	}
+	se, ok := hdrs[0].(*SessionExpiresHeader)
+	if !ok || se.Delta != 1800 || se.Refresher != "uas" {
+		t.Errorf("unexpected header %#v", hdrs[0])
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+// HEPv3 chunk types of the generic vendor.
+const (
+	hepFamily    = 0x0001
+	hepProto     = 0x0002
+	hepSrcIP4    = 0x0003
+	hepDstIP4    = 0x0004
+	hepSrcIP6    = 0x0005
+	hepDstIP6    = 0x0006
+	hepSrcPort   = 0x0007
+	hepDstPort   = 0x0008
+	hepTimeSec   = 0x0009
+	hepTimeUsec  = 0x000a
+	hepProtoType = 0x000b
+	hepCaptureID = 0x000c
+	hepPayload   = 0x000f
+
+	hepProtoSIP = 0x01
+)
+
+// hepPacket is a captured message with addresses of the transmission.
+type hepPacket struct {
+	Network string
+	Src     *net.UDPAddr
+	Dst     *net.UDPAddr
+	Time    time.Time
+	Payload []byte
+}
+
+// Encodes the packet in HEPv3 format.
+func encodeHEP(pkt hepPacket, captureID uint32) []byte {
+	var body bytes.Buffer
+	chunk := func(typ uint16, value []byte) {
+		_ = binary.Write(&body, binary.BigEndian, [3]uint16{0, typ, uint16(6 + len(value))})
+		body.Write(value)
+	}
+	u8 := func(v uint8) []byte { return []byte{v} }
+	u16 := func(v uint16) []byte {
+		b := make([]byte, 2)
+		binary.BigEndian.PutUint16(b, v)
+		return b
+	}
+	u32 := func(v uint32) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return b
+	}
+
+	src4, dst4 := pkt.Src.IP.To4(), pkt.Dst.IP.To4()
+	if src4 != nil && dst4 != nil {
+		chunk(hepFamily, u8(2))
+	} else {
+		chunk(hepFamily, u8(10))
+	}
+	if sip.TokenEqual(pkt.Network, "udp") {
+		chunk(hepProto, u8(17))
+	} else {
+		chunk(hepProto, u8(6))
+	}
+	if src4 != nil && dst4 != nil {
+		chunk(hepSrcIP4, src4)
+		chunk(hepDstIP4, dst4)
+	} else {
+		chunk(hepSrcIP6, pkt.Src.IP.To16())
+		chunk(hepDstIP6, pkt.Dst.IP.To16())
+	}
+	chunk(hepSrcPort, u16(uint16(pkt.Src.Port)))
+	chunk(hepDstPort, u16(uint16(pkt.Dst.Port)))
+	chunk(hepTimeSec, u32(uint32(pkt.Time.Unix())))
+	chunk(hepTimeUsec, u32(uint32(pkt.Time.Nanosecond()/1000)))
+	chunk(hepProtoType, u8(hepProtoSIP))
+	chunk(hepCaptureID, u32(captureID))
+	chunk(hepPayload, pkt.Payload)
+
+	out := make([]byte, 0, 6+body.Len())
+	out = append(out, "HEP3"...)
+	out = append(out, u16(uint16(6+body.Len()))...)
+	return append(out, body.Bytes()...)
+}
+
+// hepClient sends captured messages to the HEP collector over UDP.
+type hepClient struct {
+	conn *net.UDPConn
+	id   uint32
+}
+
+func newHEPClient(addr string, id uint32) (*hepClient, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &hepClient{conn: conn, id: id}, nil
+}
+
+// Capture is best-effort, failed packets are dropped.
+func (c *hepClient) Send(pkt hepPacket) {
+	if pkt.Src == nil || pkt.Dst == nil {
+		return
+	}
+	_, _ = c.conn.Write(encodeHEP(pkt, c.id))
+}
+
+func (c *hepClient) Close() error {
+	return c.conn.Close()
+}
+
+// Resolves host:port address, hosts are expected to be IPs as set by the transport layer.
+func hepAddr(addr string) *net.UDPAddr {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	p, _ := strconv.Atoi(port)
+	return &net.UDPAddr{IP: ip, Port: p}
+}
+
+func (sbc *SBC) captureMessage(msg sip.Message) {
+	if sbc.hep == nil {
+		return
+	}
+	sbc.hep.Send(hepPacket{
+		Network: msg.Transport(),
+		Src:     hepAddr(msg.Source()),
+		Dst:     hepAddr(sbc.cfg.Listen),
+		Time:    time.Now(),
+		Payload: []byte(msg.String()),
+	})
+}
+
+// Middleware capturing received requests, including requests rejected by the next middlewares.
+func (sbc *SBC) captureRequest(next gosip.RequestHandler) gosip.RequestHandler {
+	return func(req sip.Request, tx sip.ServerTransaction) {
+		sbc.captureMessage(req)
+		next(req, tx)
+	}
+}
+
+// Captures the response received on the forwarded request.
+func (sbc *SBC) captureReceived(res sip.Response) {
+	sbc.captureMessage(res)
+}
+
+// Post-send hook capturing exact bytes of every sent message.
+func (sbc *SBC) captureSent(data []byte, network string, target *transport.Target) {
+	if sbc.hep == nil {
+		return
+	}
+	sbc.hep.Send(hepPacket{
+		Network: network,
+		Src:     hepAddr(sbc.cfg.Listen),
+		Dst:     hepAddr(target.Addr()),
+		Time:    time.Now(),
+		Payload: data,
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Idle buckets are dropped after the interval.
+const bucketTTL = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter is a token bucket per source IP.
+type limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Takes the token of the source, returns the time to wait for the next token if the bucket is empty.
+func (l *limiter) allow(source string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.swept) > bucketTTL {
+		for key, b := range l.buckets {
+			if now.Sub(b.last) > bucketTTL {
+				delete(l.buckets, key)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[source]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[source] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Middleware answering '503 Service Unavailable' with 'Retry-After' to sources exceeding the rate - RFC 3261 21.5.4.
+// In-dialog requests are not limited, so established calls are never torn down by the limit.
+func (sbc *SBC) limit(next gosip.RequestHandler) gosip.RequestHandler {
+	if sbc.limiter == nil {
+		return next
+	}
+
+	return func(req sip.Request, tx sip.ServerTransaction) {
+		if _, inDialog := toTag(req); inDialog || req.IsCancel() || sbc.sideOf(req.Source()) == core {
+			next(req, tx)
+			return
+		}
+
+		host, _, err := net.SplitHostPort(req.Source())
+		if err != nil {
+			host = req.Source()
+		}
+		ok, wait := sbc.limiter.allow(host)
+		if ok {
+			next(req, tx)
+			return
+		}
+
+		sbc.log.WithFields(req.Fields()).Warnf("rate limit of %s exceeded", host)
+		if tx == nil || req.IsAck() {
+			return
+		}
+		res := sip.NewResponseFromRequest("", req, 503, "Service Unavailable", "")
+		res.AppendHeader(&sip.GenericHeader{
+			HeaderName: "Retry-After",
+			Contents:   strconv.Itoa(int(math.Ceil(wait.Seconds()))),
+		})
+		if err := tx.Respond(res); err != nil {
+			sbc.log.WithFields(req.Fields()).Errorf("respond '503 Service Unavailable' failed: %s", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Command sbc is an example of a minimal session border controller built from gosip building blocks.
+//
+// The SBC stands in front of a core SIP server (registrar, PBX or proxy), all out-of-dialog requests
+// from the access side are forwarded to the core, requests from the core are routed by Request-URI.
+// The SBC record-routes dialogs, so in-dialog requests of both sides pass through it.
+//
+// The composition:
+//   - proxy core - stateful forwarding with server and client transactions of gosip.Server, see proxy.go;
+//   - header manipulation - rules applied to every message sent to the side, see rules.go;
+//   - topology hiding - Via headers of one side are never sent to another side,
+//     identifying headers are removed from messages sent to the access side;
+//   - rate limiting - token bucket per source IP answering '503 Service Unavailable', see limit.go;
+//   - HEP capture - every received and sent message is mirrored to the HEPv3 collector, see hep.go.
+//
+// Requests pass the middleware chain capture -> rate limit -> proxy,
+// outgoing messages pass the transport send hooks applying header rules, topology hiding and capture.
+//
+// Example:
+//
+//	sbc -listen 192.0.2.1:5060 -upstream 10.0.0.10:5060 -rate 20 -hep 10.0.0.20:9060 \
+//		-rule 'access:remove:X-Billing-Id' -rule 'core:set:X-Access-Net:public'
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ghettovoice/gosip/log"
+)
+
+type ruleFlags []headerRule
+
+func (rules *ruleFlags) String() string {
+	values := make([]string, len(*rules))
+	for i, rule := range *rules {
+		values[i] = rule.String()
+	}
+	return strings.Join(values, ", ")
+}
+
+func (rules *ruleFlags) Set(value string) error {
+	rule, err := parseHeaderRule(value)
+	if err != nil {
+		return err
+	}
+	*rules = append(*rules, rule)
+	return nil
+}
+
+func main() {
+	var (
+		cfg   Config
+		rules ruleFlags
+	)
+	flag.StringVar(&cfg.Listen, "listen", "127.0.0.1:5060", "UDP and TCP listen address, the host is used in Via and Record-Route")
+	flag.StringVar(&cfg.Upstream, "upstream", "127.0.0.1:5080", "address of the core SIP server")
+	flag.Float64Var(&cfg.Rate, "rate", 20, "allowed requests per second of a source IP, 0 disables the limit")
+	flag.IntVar(&cfg.Burst, "burst", 40, "allowed burst of requests of a source IP")
+	flag.StringVar(&cfg.HEP, "hep", "", "UDP address of the HEP collector, empty disables capture")
+	flag.UintVar(&cfg.HEPID, "hep-id", 2001, "HEP capture agent ID")
+	flag.Var(&rules, "rule", "header rule 'side:action:name[:value]', side is access or core, action is remove or set")
+	flag.Parse()
+	cfg.Rules = rules
+
+	logger := log.NewDefaultLogrusLogger().WithPrefix("SBC")
+
+	sbc, err := NewSBC(cfg, logger)
+	if err != nil {
+		logger.Fatalf("start SBC: %s", err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	<-stop
+
+	sbc.Shutdown()
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Config of the SBC.
+type Config struct {
+	// Listen is UDP and TCP listen address.
+	Listen string
+	// Upstream is the core SIP server address.
+	Upstream string
+	// Rate is allowed requests per second of a source IP, zero disables the limit.
+	Rate  float64
+	Burst int
+	// HEP is UDP address of the HEP collector, empty disables capture.
+	HEP   string
+	HEPID uint
+	Rules []headerRule
+}
+
+// side of the SBC the message is received from or sent to.
+type side int
+
+const (
+	access side = iota
+	core
+)
+
+func (s side) String() string {
+	if s == core {
+		return "core"
+	}
+	return "access"
+}
+
+// SBC is a record-routing stateful proxy between the access network and the core.
+type SBC struct {
+	cfg      Config
+	srv      gosip.Server
+	host     string
+	port     sip.Port
+	upstream string
+	limiter  *limiter
+	hep      *hepClient
+	log      log.Logger
+}
+
+// NewSBC starts SBC listening on the configured address.
+func NewSBC(cfg Config, logger log.Logger) (*SBC, error) {
+	host, portStr, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen port: %w", err)
+	}
+	upstream, err := net.ResolveUDPAddr("udp", cfg.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream address: %w", err)
+	}
+
+	sbc := &SBC{
+		cfg:      cfg,
+		host:     host,
+		port:     sip.Port(port),
+		upstream: upstream.String(),
+		log:      logger,
+	}
+	if cfg.Rate > 0 {
+		sbc.limiter = newLimiter(cfg.Rate, cfg.Burst)
+	}
+	if cfg.HEP != "" {
+		if sbc.hep, err = newHEPClient(cfg.HEP, uint32(cfg.HEPID)); err != nil {
+			return nil, fmt.Errorf("connect HEP collector: %w", err)
+		}
+	}
+
+	handler := chain(sbc.forward, sbc.captureRequest, sbc.limit)
+	sbc.srv = gosip.NewServer(
+		gosip.ServerConfig{
+			Host:           host,
+			DefaultHandler: handler,
+			// proxied messages are not stamped
+			Stamp: &gosip.StampProfile{
+				Anonymous:     true,
+				NoAllow:       true,
+				NoSupported:   true,
+				NoAllowEvents: true,
+			},
+			OnPreSend:  sbc.prepareOutgoing,
+			OnPostSend: sbc.captureSent,
+		},
+		nil,
+		nil,
+		logger,
+	)
+	for _, network := range []string{"udp", "tcp"} {
+		if err := sbc.srv.Listen(network, cfg.Listen); err != nil {
+			sbc.Shutdown()
+			return nil, fmt.Errorf("listen %s: %w", network, err)
+		}
+	}
+
+	return sbc, nil
+}
+
+func (sbc *SBC) Shutdown() {
+	sbc.srv.Shutdown()
+	if sbc.hep != nil {
+		sbc.hep.Close()
+	}
+}
+
+// Returns side of the address.
+func (sbc *SBC) sideOf(addr string) side {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if upHost, upPort, _ := net.SplitHostPort(sbc.upstream); sip.HostEqual(host, upHost) && port == upPort {
+			return core
+		}
+	}
+	return access
+}
+
+// Returns true if URI points to the SBC, e.g. Route entry from own Record-Route.
+func (sbc *SBC) isSelf(uri sip.Uri) bool {
+	port := sip.DefaultPort("udp")
+	if uri.Port() != nil {
+		port = *uri.Port()
+	}
+	return sip.HostEqual(uri.Host(), sbc.host) && port == sbc.port
+}
+
+func (sbc *SBC) recordRoute() sip.Uri {
+	port := sbc.port
+	return &sip.SipUri{
+		FHost:      sbc.host,
+		FPort:      &port,
+		FUriParams: sip.NewParams().Add("lr", nil),
+		FHeaders:   sip.NewParams(),
+	}
+}
+
+// Forwards the request - RFC 3261 16.6.
+// ACK on 2xx is forwarded statelessly, other requests in the client transaction, the responses are relayed
+// to the server transaction with Via of the original request.
+func (sbc *SBC) forward(req sip.Request, tx sip.ServerTransaction) {
+	logger := sbc.log.WithFields(req.Fields())
+
+	fwd := sip.CopyRequest(req)
+	if !sip.DecrementMaxForwards(fwd, sip.DefaultMaxForwards) {
+		sbc.respond(req, tx, 483, "Too Many Hops")
+		return
+	}
+
+	// loose routing - RFC 3261 16.4
+	routes := sip.Routes(fwd)
+	if len(routes) > 0 && sbc.isSelf(routes[0]) {
+		routes = routes[1:]
+		if len(routes) == 0 {
+			fwd.RemoveHeader("Route")
+		} else {
+			fwd.ReplaceHeaders("Route", []sip.Header{&sip.RouteHeader{Addresses: routes}})
+		}
+	}
+
+	_, inDialog := toTag(req)
+	fwd.SetSource("")
+	fwd.SetDestination("")
+	// the rest is routed by Route or Request-URI
+	if len(routes) == 0 && !inDialog && sbc.sideOf(req.Source()) == access {
+		fwd.SetDestination(sbc.upstream)
+	}
+	if !inDialog && (req.IsInvite() || req.Method() == sip.SUBSCRIBE || req.Method() == sip.REFER) {
+		fwd.PrependHeader(&sip.RecordRouteHeader{Addresses: []sip.Uri{sbc.recordRoute()}})
+	}
+
+	// topology hiding: only the own Via is sent to the next hop
+	port := sbc.port
+	fwd.RemoveHeader("Via")
+	fwd.PrependHeader(sip.ViaHeader{&sip.ViaHop{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       "UDP",
+		Host:            sbc.host,
+		Port:            &port,
+		Params:          sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}})
+
+	if req.IsAck() {
+		if err := sbc.srv.Send(fwd); err != nil {
+			logger.Errorf("forward ACK failed: %s", err)
+		}
+		return
+	}
+
+	clientTx, err := sbc.srv.Request(fwd)
+	if err != nil {
+		logger.Errorf("forward request failed: %s", err)
+		sbc.respond(req, tx, 503, "Service Unavailable")
+		return
+	}
+
+	for {
+		select {
+		case cancel, ok := <-tx.Cancels():
+			if !ok {
+				return
+			}
+			sbc.respond(cancel, tx, 200, "OK")
+			if err := clientTx.Cancel(); err != nil {
+				logger.Errorf("cancel forwarded request failed: %s", err)
+			}
+		case res, ok := <-clientTx.Responses():
+			if !ok {
+				return
+			}
+			sbc.captureReceived(res)
+			if res.StatusCode() == 100 {
+				continue
+			}
+			sbc.relay(req, tx, res)
+			if !res.IsProvisional() {
+				return
+			}
+		case err, ok := <-clientTx.Errors():
+			if !ok {
+				return
+			}
+			logger.Warnf("forwarded request failed: %s", err)
+			sbc.respond(req, tx, 408, "Request Timeout")
+			return
+		}
+	}
+}
+
+// Relays response to the server transaction restoring Via of the original request.
+func (sbc *SBC) relay(req sip.Request, tx sip.ServerTransaction, res sip.Response) {
+	out := sip.CopyResponse(res)
+	out.RemoveHeader("Via")
+	sip.CopyHeaders("Via", req, out)
+	out.SetSource(req.Destination())
+	out.SetDestination(req.Source())
+	out.SetTransport(req.Transport())
+	if err := tx.Respond(out); err != nil {
+		sbc.log.WithFields(out.Fields()).Errorf("relay response failed: %s", err)
+	}
+}
+
+func (sbc *SBC) respond(req sip.Request, tx sip.ServerTransaction, code sip.StatusCode, reason string) {
+	if tx == nil || req.IsAck() {
+		return
+	}
+	if err := tx.Respond(sip.NewResponseFromRequest("", req, code, reason, "")); err != nil {
+		sbc.log.WithFields(req.Fields()).Errorf("respond '%d %s' failed: %s", code, reason, err)
+	}
+}
+
+func toTag(msg sip.Message) (string, bool) {
+	if to, ok := msg.To(); ok && to.Params != nil {
+		if tag, ok := to.Params.Get("tag"); ok && tag != nil && tag.String() != "" {
+			return tag.String(), true
+		}
+	}
+	return "", false
+}
+
+// Builds handler wrapped by middlewares, the first middleware is called first.
+func chain(handler gosip.RequestHandler, middlewares ...gosip.Middleware) gosip.RequestHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
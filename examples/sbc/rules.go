@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+type ruleAction string
+
+const (
+	removeHeader ruleAction = "remove"
+	setHeader    ruleAction = "set"
+)
+
+// headerRule manipulates the header of messages sent to the side.
+type headerRule struct {
+	Side   side
+	Action ruleAction
+	Name   string
+	Value  string
+}
+
+// Parses rule in form 'side:action:name[:value]'.
+func parseHeaderRule(s string) (headerRule, error) {
+	parts := strings.SplitN(s, ":", 4)
+	if len(parts) < 3 {
+		return headerRule{}, fmt.Errorf("invalid header rule '%s'", s)
+	}
+
+	var rule headerRule
+	switch sip.TokenLower(parts[0]) {
+	case "access":
+		rule.Side = access
+	case "core":
+		rule.Side = core
+	default:
+		return headerRule{}, fmt.Errorf("invalid side of header rule '%s'", s)
+	}
+	rule.Name = strings.TrimSpace(parts[2])
+	if rule.Name == "" {
+		return headerRule{}, fmt.Errorf("empty header name of header rule '%s'", s)
+	}
+	switch ruleAction(sip.TokenLower(parts[1])) {
+	case removeHeader:
+		rule.Action = removeHeader
+	case setHeader:
+		if len(parts) < 4 {
+			return headerRule{}, fmt.Errorf("empty header value of header rule '%s'", s)
+		}
+		rule.Action = setHeader
+		rule.Value = strings.TrimSpace(parts[3])
+	default:
+		return headerRule{}, fmt.Errorf("invalid action of header rule '%s'", s)
+	}
+
+	return rule, nil
+}
+
+func (rule headerRule) Apply(msg sip.Message) {
+	msg.RemoveHeader(rule.Name)
+	if rule.Action == setHeader {
+		msg.AppendHeader(&sip.GenericHeader{
+			HeaderName: rule.Name,
+			Contents:   rule.Value,
+		})
+	}
+}
+
+func (rule headerRule) String() string {
+	s := fmt.Sprintf("%s:%s:%s", rule.Side, rule.Action, rule.Name)
+	if rule.Action == setHeader {
+		s += ":" + rule.Value
+	}
+	return s
+}
+
+// Headers disclosing the core network that are never sent to the access side.
+var hiddenHeaders = []string{"User-Agent", "Server", "Organization", "Warning"}
+
+// Pre-send hook applying header rules and topology hiding to every outgoing message,
+// including responses generated by the SBC itself.
+func (sbc *SBC) prepareOutgoing(msg sip.Message, network string, target *transport.Target) error {
+	to := sbc.sideOf(target.Addr())
+	if to == access {
+		for _, name := range hiddenHeaders {
+			msg.RemoveHeader(name)
+		}
+	}
+	for _, rule := range sbc.cfg.Rules {
+		if rule.Side == to {
+			rule.Apply(msg)
+		}
+	}
+	return nil
+}
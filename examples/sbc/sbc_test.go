@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func freeAddr(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().String()
+}
+
+func readMessage(t *testing.T, conn net.PacketConn) sip.Message {
+	buf := make([]byte, 65535)
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read message failed: %s", err)
+	}
+	msg, err := parser.ParseMessage(buf[:n], log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("parse message failed: %s", err)
+	}
+	return msg
+}
+
+func sendMessage(t *testing.T, conn net.PacketConn, to string, seq int) {
+	addr, _ := net.ResolveUDPAddr("udp", to)
+	data := strings.Join([]string{
+		"MESSAGE sip:bob@interop.test SIP/2.0",
+		fmt.Sprintf("Via: SIP/2.0/UDP %s;branch=z9hG4bK-sbc-%d", conn.LocalAddr(), seq),
+		"Max-Forwards: 70",
+		"From: <sip:alice@interop.test>;tag=a1",
+		"To: <sip:bob@interop.test>",
+		"Call-ID: sbc-test",
+		fmt.Sprintf("CSeq: %d MESSAGE", seq),
+		"User-Agent: alice-phone",
+		"X-Billing-Id: 42",
+		"Content-Type: text/plain",
+		"Content-Length: 5",
+		"",
+		"hello",
+	}, "\r\n")
+	if _, err := conn.WriteTo([]byte(data), addr); err != nil {
+		t.Fatalf("send message failed: %s", err)
+	}
+}
+
+func TestSBC(t *testing.T) {
+	logger := log.NewDefaultLogrusLogger()
+	logger.SetLevel(uint32(log.ErrorLevel))
+
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer collector.Close()
+
+	// core UA answering MESSAGE with identifying headers
+	coreAddr := freeAddr(t)
+	received := make(chan sip.Request, 10)
+	coreSrv := gosip.NewServer(gosip.ServerConfig{Host: "127.0.0.1"}, nil, nil, logger)
+	defer coreSrv.Shutdown()
+	_ = coreSrv.OnRequest(sip.MESSAGE, func(req sip.Request, tx sip.ServerTransaction) {
+		received <- req
+		res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+		res.AppendHeader(&sip.GenericHeader{HeaderName: "X-Core-Node", Contents: "pbx-3"})
+		res.AppendHeader(&sip.GenericHeader{HeaderName: "Server", Contents: "core-pbx/1.0"})
+		_ = tx.Respond(res)
+	})
+	if err := coreSrv.Listen("udp", coreAddr); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var rules []headerRule
+	for _, s := range []string{"access:remove:X-Core-Node", "core:remove:X-Billing-Id", "core:set:X-Access-Net:public"} {
+		rule, err := parseHeaderRule(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		rules = append(rules, rule)
+	}
+	sbcAddr := freeAddr(t)
+	sbc, err := NewSBC(Config{
+		Listen:   sbcAddr,
+		Upstream: coreAddr,
+		Rate:     0.01,
+		Burst:    2,
+		HEP:      collector.LocalAddr().String(),
+		HEPID:    2001,
+		Rules:    rules,
+	}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer sbc.Shutdown()
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer client.Close()
+
+	sendMessage(t, client, sbcAddr, 1)
+
+	var req sip.Request
+	select {
+	case req = <-received:
+	case <-time.After(3 * time.Second):
+		t.Fatal("request is not forwarded to the core")
+	}
+	if vias := req.GetHeaders("Via"); len(vias) != 1 || strings.Contains(vias[0].Value(), client.LocalAddr().String()) {
+		t.Errorf("forwarded request has Via of the access side: %v", vias)
+	}
+	if mf, _ := sip.GetMaxForwards(req); mf != 69 {
+		t.Errorf("unexpected Max-Forwards %d, want 69", mf)
+	}
+	if hdrs := req.GetHeaders("X-Billing-Id"); len(hdrs) != 0 {
+		t.Errorf("removed header is forwarded: %v", hdrs)
+	}
+	if hdrs := req.GetHeaders("X-Access-Net"); len(hdrs) != 1 || hdrs[0].Value() != "public" {
+		t.Errorf("unexpected X-Access-Net headers %v", hdrs)
+	}
+	if req.Body() != "hello" {
+		t.Errorf("unexpected body %q", req.Body())
+	}
+
+	res, ok := readMessage(t, client).(sip.Response)
+	if !ok || res.StatusCode() != 200 {
+		t.Fatalf("unexpected response %v", res)
+	}
+	if via, ok := res.ViaHop(); !ok || via.Params == nil || !strings.Contains(res.GetHeaders("Via")[0].Value(), "z9hG4bK-sbc-1") {
+		t.Errorf("response has unexpected Via %v", via)
+	}
+	for _, name := range []string{"X-Core-Node", "Server"} {
+		if hdrs := res.GetHeaders(name); len(hdrs) != 0 {
+			t.Errorf("response has hidden header %v", hdrs)
+		}
+	}
+
+	// the second request exhausts the burst
+	sendMessage(t, client, sbcAddr, 2)
+	<-received
+	if res, ok := readMessage(t, client).(sip.Response); !ok || res.StatusCode() != 200 {
+		t.Fatalf("unexpected response %v", res)
+	}
+	sendMessage(t, client, sbcAddr, 3)
+	res, ok = readMessage(t, client).(sip.Response)
+	if !ok || res.StatusCode() != 503 {
+		t.Fatalf("unexpected response %v, want 503", res)
+	}
+	if hdrs := res.GetHeaders("Retry-After"); len(hdrs) != 1 {
+		t.Errorf("503 response without Retry-After: %v", hdrs)
+	}
+	select {
+	case req := <-received:
+		t.Errorf("rate limited request is forwarded: %s", req.Short())
+	default:
+	}
+
+	// received request, forwarded request, received response and relayed response of the first transaction
+	buf := make([]byte, 65535)
+	var payloads []string
+	for len(payloads) < 4 {
+		_ = collector.SetReadDeadline(time.Now().Add(3 * time.Second))
+		n, _, err := collector.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read HEP packet failed: %s", err)
+		}
+		if !bytes.HasPrefix(buf[:n], []byte("HEP3")) {
+			t.Fatalf("unexpected HEP packet %q", buf[:n])
+		}
+		if int(buf[4])<<8|int(buf[5]) != n {
+			t.Fatalf("unexpected HEP packet length %d, want %d", int(buf[4])<<8|int(buf[5]), n)
+		}
+		payloads = append(payloads, string(buf[:n]))
+	}
+	for i, want := range []string{"MESSAGE sip:", "MESSAGE sip:", "SIP/2.0 200 OK", "SIP/2.0 200 OK"} {
+		if !strings.Contains(payloads[i], want) {
+			t.Errorf("HEP packet %d does not contain %q", i, want)
+		}
+	}
+}
+
+func TestEncodeHEP(t *testing.T) {
+	pkt := encodeHEP(hepPacket{
+		Network: "udp",
+		Src:     &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5060},
+		Dst:     &net.UDPAddr{IP: net.ParseIP("192.0.2.2"), Port: 5080},
+		Time:    time.Unix(1700000000, 123456000),
+		Payload: []byte("OPTIONS sip:a SIP/2.0\r\n\r\n"),
+	}, 7)
+
+	chunks := make(map[uint16][]byte)
+	for data := pkt[6:]; len(data) > 0; {
+		typ := uint16(data[2])<<8 | uint16(data[3])
+		length := int(data[4])<<8 | int(data[5])
+		chunks[typ] = data[6:length]
+		data = data[length:]
+	}
+	for typ, want := range map[uint16][]byte{
+		hepFamily:    {2},
+		hepProto:     {17},
+		hepSrcIP4:    {192, 0, 2, 1},
+		hepDstIP4:    {192, 0, 2, 2},
+		hepSrcPort:   {0x13, 0xc4},
+		hepDstPort:   {0x13, 0xd8},
+		hepTimeUsec:  {0, 1, 0xe2, 0x40},
+		hepProtoType: {1},
+		hepCaptureID: {0, 0, 0, 7},
+		hepPayload:   []byte("OPTIONS sip:a SIP/2.0\r\n\r\n"),
+	} {
+		if !bytes.Equal(chunks[typ], want) {
+			t.Errorf("unexpected chunk %#x %v, want %v", typ, chunks[typ], want)
+		}
+	}
+}
+
+func TestParseHeaderRule(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "access:remove:X-Foo", want: "access:remove:X-Foo"},
+		{in: "CORE:set:X-Net:a:b", want: "core:set:X-Net:a:b"},
+		{in: "core:set:X-Net", err: true},
+		{in: "edge:remove:X-Foo", err: true},
+		{in: "core:rename:X-Foo", err: true},
+		{in: "core:remove", err: true},
+	} {
+		rule, err := parseHeaderRule(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("parseHeaderRule(%q) expected error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHeaderRule(%q) unexpected error: %s", tc.in, err)
+			continue
+		}
+		if rule.String() != tc.want {
+			t.Errorf("parseHeaderRule(%q) = %q, want %q", tc.in, rule, tc.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/util"
+)
+
+// Timeout of requests sent by the gateway within established calls.
+const requestTimeout = 32 * time.Second
+
+// leg is one side of the bridged call.
+type leg struct {
+	call    *Call
+	browser bool
+	dialog  *sip.Dialog
+	// network and address requests of the leg are sent to,
+	// browser legs are reached only over the WebSocket connection the call came from
+	transport string
+	dest      string
+	// peer leg accepts INFO of 'trickle-ice' package - RFC 8840 4.
+	trickle bool
+}
+
+func (l *leg) other() *leg {
+	if l.browser {
+		return l.call.peer
+	}
+	return l.call.browser
+}
+
+// Sets the transport, the destination and the top Via of the request sent on the leg.
+func (l *leg) prepareRequest(req sip.Request, gw *Gateway) {
+	hop := &sip.ViaHop{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       sip.TokenUpper(l.transport),
+		Host:            gw.cfg.Host,
+		Params:          sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}
+	if !l.browser {
+		port := gw.sipPort
+		hop.Port = &port
+	}
+	req.RemoveHeader("Via")
+	req.PrependHeader(sip.ViaHeader{hop})
+	req.SetTransport(sip.TokenUpper(l.transport))
+	req.SetDestination(l.dest)
+}
+
+// Call is the call bridged by the gateway.
+type Call struct {
+	mu      sync.Mutex
+	browser *leg
+	peer    *leg
+	ended   bool
+}
+
+func (call *Call) String() string {
+	if dlg := call.browser.dialog; dlg != nil {
+		return dlg.CallID()
+	}
+	return "<setup>"
+}
+
+func (call *Call) legOf(dialogID string) *leg {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+
+	if call.peer.dialog != nil && call.peer.dialog.ID() == dialogID {
+		return call.peer
+	}
+	return call.browser
+}
+
+// Bridges INVITE of the browser to the peer - RFC 7092 3.1, the browser leg is answered with
+// the responses of the peer leg, both legs have own dialogs and session descriptions.
+func (gw *Gateway) bridge(req sip.Request, tx sip.ServerTransaction) {
+	logger := gw.log.WithFields(req.Fields())
+	call := &Call{}
+	call.browser = &leg{call: call, browser: true, transport: req.Transport(), dest: req.Source()}
+	call.peer = &leg{call: call, transport: "UDP", dest: gw.cfg.Peer}
+	browserTag := util.RandString(8)
+
+	offer, err := gw.rewriteSDP(req.Body(), true)
+	if err != nil {
+		logger.Warnf("rewrite offer failed: %s", err)
+		gw.respond(req, tx, 488, "Not Acceptable Here")
+		return
+	}
+
+	invite, err := gw.newPeerInvite(req, offer)
+	if err != nil {
+		logger.Errorf("build INVITE to the peer failed: %s", err)
+		gw.respond(req, tx, 500, "Server Internal Error")
+		return
+	}
+	call.peer.prepareRequest(invite, gw)
+
+	clientTx, err := gw.srv.Request(invite)
+	if err != nil {
+		logger.Errorf("send INVITE to the peer failed: %s", err)
+		gw.respond(req, tx, 503, "Service Unavailable")
+		return
+	}
+
+	for {
+		select {
+		case cancel, ok := <-tx.Cancels():
+			if !ok {
+				return
+			}
+			gw.respond(cancel, tx, 200, "OK")
+			if err := clientTx.Cancel(); err != nil {
+				logger.Errorf("cancel INVITE to the peer failed: %s", err)
+			}
+		case res, ok := <-clientTx.Responses():
+			if !ok {
+				return
+			}
+			if res.StatusCode() == 100 {
+				continue
+			}
+			if done := gw.relayInviteResponse(call, req, tx, invite, res, browserTag); done {
+				return
+			}
+		case err, ok := <-clientTx.Errors():
+			if !ok {
+				return
+			}
+			logger.Warnf("INVITE to the peer failed: %s", err)
+			gw.respond(req, tx, 408, "Request Timeout")
+			return
+		}
+	}
+}
+
+// Builds INVITE of the peer leg on behalf of the browser with own Call-ID and tags.
+func (gw *Gateway) newPeerInvite(req sip.Request, offer string) (sip.Request, error) {
+	from, ok := req.From()
+	if !ok {
+		return nil, fmt.Errorf("missing From header")
+	}
+	to, ok := req.To()
+	if !ok {
+		return nil, fmt.Errorf("missing To header")
+	}
+
+	builder := sip.NewRequestBuilder().
+		SetMethod(sip.INVITE).
+		SetRecipient(req.Recipient().Clone()).
+		SetFrom(&sip.Address{
+			DisplayName: from.DisplayName,
+			Uri:         from.Address.Clone(),
+			Params:      sip.NewParams().Add("tag", sip.String{Str: util.RandString(8)}),
+		}).
+		SetTo(&sip.Address{
+			DisplayName: to.DisplayName,
+			Uri:         to.Address.Clone(),
+		}).
+		SetContact(&sip.Address{Uri: gw.contact(false)}).
+		SetBody(offer)
+	if offer != "" {
+		contentType := sip.ContentType("application/sdp")
+		builder.SetContentType(&contentType)
+	}
+	return builder.Build()
+}
+
+// Contact of the gateway on the leg.
+func (gw *Gateway) contact(browser bool) sip.Uri {
+	uri := &sip.SipUri{
+		FUser:      sip.String{Str: "gw"},
+		FHost:      gw.cfg.Host,
+		FUriParams: sip.NewParams(),
+		FHeaders:   sip.NewParams(),
+	}
+	if browser {
+		uri.FUriParams.Add("transport", sip.String{Str: "ws"})
+	} else {
+		port := gw.sipPort
+		uri.FPort = &port
+	}
+	return uri
+}
+
+// Relays the response of the peer on INVITE to the browser, returns true on the final response.
+func (gw *Gateway) relayInviteResponse(
+	call *Call,
+	req sip.Request,
+	tx sip.ServerTransaction,
+	invite sip.Request,
+	res sip.Response,
+	browserTag string,
+) bool {
+	logger := gw.log.WithFields(res.Fields())
+
+	if res.StatusCode() >= 300 {
+		// terminates early dialogs of the peer leg
+		_, _ = gw.uac.Establish(invite, res)
+		out := sip.NewResponseFromRequest("", req, res.StatusCode(), res.Reason(), "")
+		gw.tagResponse(out, browserTag)
+		if err := tx.Respond(out); err != nil {
+			logger.Errorf("relay %s failed: %s", res.Short(), err)
+		}
+		return true
+	}
+
+	answer, err := gw.rewriteSDP(res.Body(), false)
+	if err != nil {
+		logger.Warnf("rewrite answer failed: %s", err)
+		if res.IsSuccess() {
+			gw.terminatePeer(call, invite, res)
+			gw.respond(req, tx, 488, "Not Acceptable Here")
+			return true
+		}
+		answer = ""
+	}
+
+	if hasTag(res) {
+		dlg, err := gw.uac.Establish(invite, res)
+		if err != nil {
+			logger.Warnf("establish peer dialog failed: %s", err)
+		} else {
+			call.mu.Lock()
+			call.peer.dialog = dlg
+			call.peer.trickle = supportsTrickle(res)
+			call.mu.Unlock()
+			gw.bind(dlg, call)
+		}
+	}
+
+	out := sip.NewResponseFromRequest("", req, res.StatusCode(), res.Reason(), answer)
+	gw.tagResponse(out, browserTag)
+	out.AppendHeader(&sip.ContactHeader{Address: gw.contact(true)})
+	// the gateway accepts trickled candidates of the browser regardless of the peer - RFC 8840 4.
+	out.AppendHeader(&sip.GenericHeader{HeaderName: "Recv-Info", Contents: trickleInfoPackage})
+	if answer != "" {
+		contentType := sip.ContentType("application/sdp")
+		out.AppendHeader(&contentType)
+	}
+
+	if dlg, err := gw.uas.Establish(req, out); err == nil {
+		call.mu.Lock()
+		call.browser.dialog = dlg
+		call.mu.Unlock()
+		gw.bind(dlg, call)
+	} else {
+		logger.Warnf("establish browser dialog failed: %s", err)
+	}
+
+	if res.IsSuccess() {
+		if err := gw.ackPeer(call); err != nil {
+			logger.Errorf("send ACK to the peer failed: %s", err)
+		}
+	}
+	if err := tx.Respond(out); err != nil {
+		logger.Errorf("relay %s failed: %s", res.Short(), err)
+	}
+	return res.IsSuccess()
+}
+
+func hasTag(res sip.Response) bool {
+	to, ok := res.To()
+	return ok && to.Params != nil && to.Params.Has("tag")
+}
+
+// Adds 'To' tag of the browser leg to the response other than 100 - RFC 3261 8.2.6.2.
+func (gw *Gateway) tagResponse(res sip.Response, tag string) {
+	if to, ok := res.To(); ok {
+		if to.Params == nil {
+			to.Params = sip.NewParams()
+		}
+		if !to.Params.Has("tag") {
+			to.Params.Add("tag", sip.String{Str: tag})
+		}
+	}
+}
+
+func (gw *Gateway) ackPeer(call *Call) error {
+	if call.peer.dialog == nil {
+		return fmt.Errorf("no dialog of the peer leg")
+	}
+	ack, err := call.peer.dialog.NewRequest(sip.ACK, "")
+	if err != nil {
+		return err
+	}
+	call.peer.prepareRequest(ack, gw)
+	return gw.srv.Send(ack)
+}
+
+// Acknowledges and terminates the peer leg established with the answer unusable for the browser.
+func (gw *Gateway) terminatePeer(call *Call, invite sip.Request, res sip.Response) {
+	dlg, err := gw.uac.Establish(invite, res)
+	if err != nil {
+		return
+	}
+	call.peer.dialog = dlg
+	gw.bind(dlg, call)
+	if err := gw.ackPeer(call); err != nil {
+		gw.log.WithFields(res.Fields()).Errorf("send ACK to the peer failed: %s", err)
+	}
+	gw.hangup(call, call.peer)
+}
+
+// Sends BYE on the leg and forgets the call.
+func (gw *Gateway) hangup(call *Call, l *leg) {
+	call.mu.Lock()
+	if call.ended {
+		call.mu.Unlock()
+		return
+	}
+	call.ended = true
+	call.mu.Unlock()
+	defer gw.unbind(call)
+
+	if l.dialog == nil || l.dialog.State() == sip.DialogTerminated {
+		return
+	}
+	bye, err := l.dialog.NewRequest(sip.BYE, "")
+	if err != nil {
+		gw.log.Errorf("build BYE of call %s failed: %s", call, err)
+		return
+	}
+	if _, err := gw.request(l, bye); err != nil {
+		gw.log.Warnf("BYE of call %s failed: %s", call, err)
+	}
+}
+
+// Sends the in-dialog request on the leg and returns the final response,
+// non-2xx response is returned with sip.RequestError.
+func (gw *Gateway) request(l *leg, req sip.Request) (sip.Response, error) {
+	l.prepareRequest(req, gw)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	res, err := gw.srv.RequestWithContext(ctx, req)
+	var reqErr *sip.RequestError
+	if errors.As(err, &reqErr) && reqErr.Response != nil {
+		// failure response may terminate the dialog
+		res = reqErr.Response
+	}
+	if res != nil {
+		_ = l.dialog.ReceiveResponse(res)
+	}
+	return res, err
+}
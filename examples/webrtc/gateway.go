@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+// Config of the gateway.
+type Config struct {
+	// Host is IP address of the gateway used in Via and Contact.
+	Host string
+	// WS and WSS are listen addresses facing browsers, empty address disables the transport.
+	WS        string
+	WSS       string
+	Cert, Key string
+	// SIP is UDP and TCP listen address facing the SIP peer.
+	SIP string
+	// Peer is the SIP peer address receiving calls of browsers.
+	Peer string
+	// Rewriters are applied to session descriptions passed between the legs after StripTrickle.
+	Rewriters []SDPRewriter
+	// OnCandidates is called with ICE candidates trickled by the browser when the peer does not support
+	// trickle ICE, e.g. to pass them to the media relay.
+	OnCandidates CandidatesFunc
+}
+
+// Gateway bridges calls of WebRTC browsers to the SIP peer.
+type Gateway struct {
+	cfg     Config
+	srv     gosip.Server
+	sipPort sip.Port
+	// browser legs are UAS dialogs, peer legs are UAC dialogs
+	uas   *sip.DialogServer
+	uac   *sip.DialogClient
+	mu    sync.Mutex
+	calls map[string]*Call
+	log   log.Logger
+}
+
+// NewGateway starts the gateway listening on the configured addresses.
+func NewGateway(cfg Config, logger log.Logger) (*Gateway, error) {
+	_, portStr, err := net.SplitHostPort(cfg.SIP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIP listen address: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIP listen port: %w", err)
+	}
+	if _, err := net.ResolveUDPAddr("udp", cfg.Peer); err != nil {
+		return nil, fmt.Errorf("invalid peer address: %w", err)
+	}
+
+	gw := &Gateway{
+		cfg:     cfg,
+		sipPort: sip.Port(port),
+		uas:     sip.NewDialogServer(),
+		uac:     sip.NewDialogClient(),
+		calls:   make(map[string]*Call),
+		log:     logger,
+	}
+	gw.srv = gosip.NewServer(
+		gosip.ServerConfig{
+			Host: cfg.Host,
+			// requests of both legs are validated against dialogs of the gateway
+			DialogLookup: func(req sip.Request) bool {
+				_, ok := gw.match(req)
+				return ok
+			},
+		},
+		nil,
+		nil,
+		logger,
+	)
+
+	for method, handler := range map[sip.RequestMethod]gosip.RequestHandler{
+		sip.INVITE: gw.onInvite,
+		sip.ACK:    gw.onAck,
+		sip.BYE:    gw.onBye,
+		sip.INFO:   gw.onInfo,
+	} {
+		if err := gw.srv.OnRequest(method, handler); err != nil {
+			return nil, err
+		}
+	}
+
+	listen := []struct {
+		network, addr string
+		options       []transport.ListenOption
+	}{
+		{"udp", cfg.SIP, nil},
+		{"tcp", cfg.SIP, nil},
+		{"ws", cfg.WS, nil},
+		{"wss", cfg.WSS, []transport.ListenOption{&transport.TLSConfig{Cert: cfg.Cert, Key: cfg.Key}}},
+	}
+	for _, l := range listen {
+		if l.addr == "" {
+			continue
+		}
+		if err := gw.srv.Listen(l.network, l.addr, l.options...); err != nil {
+			gw.Shutdown()
+			return nil, fmt.Errorf("listen %s %s: %w", l.network, l.addr, err)
+		}
+	}
+
+	return gw, nil
+}
+
+func (gw *Gateway) Shutdown() {
+	gw.srv.Shutdown()
+}
+
+// Calls returns calls in progress.
+func (gw *Gateway) Calls() []*Call {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+
+	calls := make([]*Call, 0, len(gw.calls))
+	seen := make(map[*Call]bool)
+	for _, call := range gw.calls {
+		if !seen[call] {
+			seen[call] = true
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Registers the call by dialog ID of the leg.
+func (gw *Gateway) bind(dlg *sip.Dialog, call *Call) {
+	gw.mu.Lock()
+	gw.calls[dlg.ID()] = call
+	gw.mu.Unlock()
+}
+
+func (gw *Gateway) unbind(call *Call) {
+	gw.mu.Lock()
+	for id, c := range gw.calls {
+		if c == call {
+			delete(gw.calls, id)
+			gw.uas.Remove(id)
+			gw.uac.Remove(id)
+		}
+	}
+	gw.mu.Unlock()
+}
+
+// Returns the call and the leg the in-dialog request is received on,
+// the request is validated against the dialog by the handlers.
+func (gw *Gateway) match(req sip.Request) (*leg, bool) {
+	callID, ok := req.CallID()
+	if !ok {
+		return nil, false
+	}
+	var localTag, remoteTag string
+	if to, ok := req.To(); ok && to.Params != nil {
+		if tag, ok := to.Params.Get("tag"); ok && tag != nil {
+			localTag = tag.String()
+		}
+	}
+	if from, ok := req.From(); ok && from.Params != nil {
+		if tag, ok := from.Params.Get("tag"); ok && tag != nil {
+			remoteTag = tag.String()
+		}
+	}
+	id := sip.MakeDialogID(string(*callID), localTag, remoteTag)
+
+	gw.mu.Lock()
+	call, ok := gw.calls[id]
+	gw.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return call.legOf(id), true
+}
+
+// Returns true if the request is received from the browser.
+func isBrowser(msg sip.Message) bool {
+	switch sip.TokenLower(msg.Transport()) {
+	case "ws", "wss":
+		return true
+	default:
+		return false
+	}
+}
+
+func (gw *Gateway) respond(req sip.Request, tx sip.ServerTransaction, code sip.StatusCode, reason string) {
+	if tx == nil || req.IsAck() {
+		return
+	}
+	if err := tx.Respond(sip.NewResponseFromRequest("", req, code, reason, "")); err != nil {
+		gw.log.WithFields(req.Fields()).Errorf("respond '%d %s' failed: %s", code, reason, err)
+	}
+}
+
+func (gw *Gateway) onInvite(req sip.Request, tx sip.ServerTransaction) {
+	if sip.IsInDialog(req) {
+		gw.onReinvite(req, tx)
+		return
+	}
+	if !isBrowser(req) {
+		// calls to browsers require the registrar of WebSocket clients
+		gw.respond(req, tx, 403, "Forbidden")
+		return
+	}
+
+	gw.bridge(req, tx)
+}
+
+// Session refreshes are answered by the gateway, the media renegotiation is not bridged.
+func (gw *Gateway) onReinvite(req sip.Request, tx sip.ServerTransaction) {
+	l, ok := gw.match(req)
+	if !ok {
+		gw.respond(req, tx, 481, "Call/Transaction Does Not Exist")
+		return
+	}
+	res, ok, err := l.dialog.AcceptSessionRefresh(req)
+	if err != nil {
+		code := sip.StatusCode(500)
+		if dlgErr, ok := err.(*sip.DialogError); ok {
+			code = dlgErr.StatusCode
+		}
+		gw.respond(req, tx, code, sip.ReasonPhrase(code))
+		return
+	}
+	if !ok {
+		gw.respond(req, tx, 488, "Not Acceptable Here")
+		return
+	}
+	if err := tx.Respond(res); err != nil {
+		gw.log.WithFields(req.Fields()).Errorf("respond on session refresh failed: %s", err)
+	}
+}
+
+// ACK on 2xx of the browser leg completes the call setup, ACK of the peer leg is sent by the gateway.
+func (gw *Gateway) onAck(req sip.Request, tx sip.ServerTransaction) {
+	l, ok := gw.match(req)
+	if !ok {
+		return
+	}
+	if err := l.dialog.ReceiveRequest(req); err != nil {
+		gw.log.WithFields(req.Fields()).Warnf("invalid ACK: %s", err)
+	}
+}
+
+// BYE of any leg terminates the call.
+func (gw *Gateway) onBye(req sip.Request, tx sip.ServerTransaction) {
+	l, ok := gw.match(req)
+	if !ok {
+		gw.respond(req, tx, 481, "Call/Transaction Does Not Exist")
+		return
+	}
+	_ = l.dialog.ReceiveRequest(req)
+	gw.respond(req, tx, 200, "OK")
+
+	gw.hangup(l.call, l.other())
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+const (
+	browserSDP = "v=0\r\n" +
+		"o=- 4611731400430051336 2 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"a=ice-options:trickle\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=ice-ufrag:EsAw\r\n" +
+		"a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\n" +
+		"a=rtpmap:111 opus/48000/2\r\n"
+	peerSDP = "v=0\r\n" +
+		"o=peer 1 1 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"c=IN IP4 127.0.0.1\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 40000 RTP/AVP 0\r\n" +
+		"a=rtpmap:0 PCMU/8000\r\n"
+	testTimeout = 3 * time.Second
+)
+
+func freeAddr(t *testing.T, network string) string {
+	var addr string
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		addr = conn.LocalAddr().String()
+		conn.Close()
+	} else {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		addr = ln.Addr().String()
+		ln.Close()
+	}
+	return addr
+}
+
+// peer is SIP UA answering calls of the gateway.
+type peer struct {
+	t        *testing.T
+	srv      gosip.Server
+	addr     string
+	trickle  bool
+	uas      *sip.DialogServer
+	mu       sync.Mutex
+	dialog   *sip.Dialog
+	requests chan sip.Request
+}
+
+func newPeer(t *testing.T, logger log.Logger, trickle bool) *peer {
+	p := &peer{
+		t:        t,
+		addr:     freeAddr(t, "udp"),
+		trickle:  trickle,
+		uas:      sip.NewDialogServer(),
+		requests: make(chan sip.Request, 10),
+	}
+	p.srv = gosip.NewServer(gosip.ServerConfig{Host: "127.0.0.1"}, nil, nil, logger)
+	_ = p.srv.OnRequest(sip.INVITE, p.onInvite)
+	for _, method := range []sip.RequestMethod{sip.ACK, sip.BYE, sip.INFO} {
+		_ = p.srv.OnRequest(method, p.onInDialog)
+	}
+	if err := p.srv.Listen("udp", p.addr); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return p
+}
+
+func (p *peer) onInvite(req sip.Request, tx sip.ServerTransaction) {
+	p.requests <- req
+
+	ringing := sip.NewResponseFromRequest("", req, 180, "Ringing", "")
+	to, _ := ringing.To()
+	to.Params.Add("tag", sip.String{Str: "peer-tag"})
+	host, port, _ := net.SplitHostPort(p.addr)
+	contact := &sip.ContactHeader{Address: &sip.SipUri{
+		FUser:      sip.String{Str: "peer"},
+		FHost:      host,
+		FPort:      parsePort(port),
+		FUriParams: sip.NewParams(),
+		FHeaders:   sip.NewParams(),
+	}}
+	ringing.AppendHeader(contact)
+	_ = tx.Respond(ringing)
+
+	ok := sip.NewResponseFromRequest("", req, 200, "OK", peerSDP)
+	to, _ = ok.To()
+	to.Params.Add("tag", sip.String{Str: "peer-tag"})
+	ok.AppendHeader(contact.Clone())
+	contentType := sip.ContentType("application/sdp")
+	ok.AppendHeader(&contentType)
+	if p.trickle {
+		ok.AppendHeader(&sip.GenericHeader{HeaderName: "Recv-Info", Contents: "trickle-ice"})
+	}
+	dlg, err := p.uas.Establish(req, ok)
+	if err != nil {
+		p.t.Errorf("peer: establish dialog: %s", err)
+	}
+	p.mu.Lock()
+	p.dialog = dlg
+	p.mu.Unlock()
+	_ = tx.Respond(ok)
+}
+
+func (p *peer) onInDialog(req sip.Request, tx sip.ServerTransaction) {
+	p.requests <- req
+	if req.IsAck() {
+		return
+	}
+	_ = tx.Respond(sip.NewResponseFromRequest("", req, 200, "OK", ""))
+}
+
+func (p *peer) expect(t *testing.T, method sip.RequestMethod) sip.Request {
+	t.Helper()
+	select {
+	case req := <-p.requests:
+		if req.Method() != method {
+			t.Fatalf("peer: unexpected request %s, want %s", req.Short(), method)
+		}
+		return req
+	case <-time.After(testTimeout):
+		t.Fatalf("peer: %s is not received", method)
+		return nil
+	}
+}
+
+// Hangs up the call sending BYE to the gateway.
+func (p *peer) bye(gwAddr string) (sip.Response, error) {
+	p.mu.Lock()
+	dlg := p.dialog
+	p.mu.Unlock()
+
+	bye, err := dlg.NewRequest(sip.BYE, "")
+	if err != nil {
+		return nil, err
+	}
+	_, port, _ := net.SplitHostPort(p.addr)
+	bye.PrependHeader(sip.ViaHeader{&sip.ViaHop{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       "UDP",
+		Host:            "127.0.0.1",
+		Port:            parsePort(port),
+		Params:          sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}})
+	bye.SetDestination(gwAddr)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	return p.srv.RequestWithContext(ctx, bye)
+}
+
+func parsePort(s string) *sip.Port {
+	var port sip.Port
+	_, _ = fmt.Sscanf(s, "%d", &port)
+	return &port
+}
+
+// browser is SIP over WebSocket client.
+type browser struct {
+	t      *testing.T
+	conn   net.Conn
+	callID string
+	toTag  string
+	target string
+}
+
+func newBrowser(t *testing.T, addr string) *browser {
+	dialer := ws.Dialer{Protocols: []string{"sip"}}
+	conn, _, _, err := dialer.Dial(context.Background(), "ws://"+addr)
+	if err != nil {
+		t.Fatalf("dial gateway: %s", err)
+	}
+	return &browser{t: t, conn: conn, callID: "browser-call"}
+}
+
+func (b *browser) send(lines []string, body string) {
+	b.t.Helper()
+	lines = append(lines, fmt.Sprintf("Content-Length: %d", len(body)), "", body)
+	if err := wsutil.WriteClientText(b.conn, []byte(strings.Join(lines, "\r\n"))); err != nil {
+		b.t.Fatalf("browser: send: %s", err)
+	}
+}
+
+func (b *browser) request(method sip.RequestMethod, seq int, extra []string, body string) {
+	b.t.Helper()
+	recipient := "sip:bob@example.com"
+	to := "<sip:bob@example.com>"
+	if b.toTag != "" {
+		recipient = b.target
+		to += ";tag=" + b.toTag
+	}
+	lines := append([]string{
+		fmt.Sprintf("%s %s SIP/2.0", method, recipient),
+		"Via: SIP/2.0/WS df7jal23ls0d.invalid;branch=" + sip.GenerateBranch(),
+		"Max-Forwards: 70",
+		"From: <sip:alice@example.com>;tag=browser-tag",
+		"To: " + to,
+		"Call-ID: " + b.callID,
+		fmt.Sprintf("CSeq: %d %s", seq, method),
+		"Contact: <sip:alice@df7jal23ls0d.invalid;transport=ws>",
+	}, extra...)
+	b.send(lines, body)
+}
+
+func (b *browser) read() sip.Message {
+	b.t.Helper()
+	_ = b.conn.SetReadDeadline(time.Now().Add(testTimeout))
+	data, err := wsutil.ReadServerText(b.conn)
+	if err != nil {
+		b.t.Fatalf("browser: read: %s", err)
+	}
+	msg, err := parser.ParseMessage(data, log.NewDefaultLogrusLogger())
+	if err != nil {
+		b.t.Fatalf("browser: parse: %s", err)
+	}
+	return msg
+}
+
+// Reads responses until the final one.
+func (b *browser) final() (provisional []sip.Response, final sip.Response) {
+	b.t.Helper()
+	for {
+		res, ok := b.read().(sip.Response)
+		if !ok {
+			b.t.Fatal("browser: unexpected request")
+		}
+		if res.IsProvisional() {
+			provisional = append(provisional, res)
+			continue
+		}
+		return provisional, res
+	}
+}
+
+func (b *browser) call() sip.Response {
+	b.t.Helper()
+	b.request(sip.INVITE, 1, []string{"Content-Type: application/sdp"}, browserSDP)
+	provisional, res := b.final()
+	if res.StatusCode() != 200 {
+		b.t.Fatalf("browser: unexpected response %s", res.Short())
+	}
+	var ringing bool
+	for _, res := range provisional {
+		ringing = ringing || res.StatusCode() == 180
+	}
+	if !ringing {
+		b.t.Error("browser: 180 Ringing is not relayed")
+	}
+
+	to, _ := res.To()
+	tag, _ := to.Params.Get("tag")
+	b.toTag = tag.String()
+	contact, _ := res.Contact()
+	b.target = contact.Address.String()
+	b.request(sip.ACK, 1, nil, "")
+	return res
+}
+
+func startGateway(t *testing.T, p *peer, logger log.Logger, onCandidates CandidatesFunc) (*Gateway, string, string) {
+	wsAddr := freeAddr(t, "tcp")
+	sipAddr := freeAddr(t, "udp")
+	gw, err := NewGateway(Config{
+		Host:         "127.0.0.1",
+		WS:           wsAddr,
+		SIP:          sipAddr,
+		Peer:         p.addr,
+		OnCandidates: onCandidates,
+	}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return gw, wsAddr, sipAddr
+}
+
+func expectNoCalls(t *testing.T, gw *Gateway) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for len(gw.Calls()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if calls := gw.Calls(); len(calls) != 0 {
+		t.Errorf("call is not removed: %v", calls)
+	}
+}
+
+func testLogger() log.Logger {
+	logger := log.NewDefaultLogrusLogger()
+	logger.SetLevel(uint32(log.ErrorLevel))
+	return logger
+}
+
+func TestGateway_BrowserCall(t *testing.T) {
+	logger := testLogger()
+	p := newPeer(t, logger, false)
+	defer p.srv.Shutdown()
+
+	type trickled struct {
+		candidates []string
+		end        bool
+	}
+	candidates := make(chan trickled, 1)
+	gw, wsAddr, _ := startGateway(t, p, logger, func(call *Call, c []string, end bool) {
+		candidates <- trickled{c, end}
+	})
+	defer gw.Shutdown()
+
+	b := newBrowser(t, wsAddr)
+	defer b.conn.Close()
+	res := b.call()
+
+	invite := p.expect(t, sip.INVITE)
+	if callID, _ := invite.CallID(); string(*callID) == b.callID {
+		t.Error("peer leg has Call-ID of the browser leg")
+	}
+	if strings.Contains(invite.Body(), "a=ice-options:trickle") || !strings.Contains(invite.Body(), "a=ice-ufrag:EsAw") {
+		t.Errorf("unexpected offer sent to the peer:\n%s", invite.Body())
+	}
+	if res.Body() != peerSDP {
+		t.Errorf("unexpected answer sent to the browser:\n%s", res.Body())
+	}
+	if hdrs := res.GetHeaders("Recv-Info"); len(hdrs) != 1 || hdrs[0].Value() != "trickle-ice" {
+		t.Errorf("unexpected Recv-Info %v", hdrs)
+	}
+	p.expect(t, sip.ACK)
+
+	b.request(sip.INFO, 2, []string{
+		"Info-Package: trickle-ice",
+		"Content-Type: application/trickle-ice-sdpfrag",
+		"Content-Disposition: Info-Package",
+	}, "a=ice-ufrag:EsAw\r\na=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\nm=audio 9 UDP/TLS/RTP/SAVPF 111\r\n"+
+		"a=mid:0\r\na=candidate:1 1 UDP 2130706431 192.0.2.5 54400 typ host\r\na=end-of-candidates\r\n")
+	if _, res := b.final(); res.StatusCode() != 200 {
+		t.Fatalf("unexpected response on trickle INFO %s", res.Short())
+	}
+	select {
+	case c := <-candidates:
+		if len(c.candidates) != 1 || !c.end || !strings.HasPrefix(c.candidates[0], "a=candidate:1 1 UDP") {
+			t.Errorf("unexpected trickled candidates %v, end %v", c.candidates, c.end)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("trickled candidates are not passed to the hook")
+	}
+
+	b.request(sip.BYE, 3, nil, "")
+	if _, res := b.final(); res.StatusCode() != 200 {
+		t.Fatalf("unexpected response on BYE %s", res.Short())
+	}
+	p.expect(t, sip.BYE)
+	expectNoCalls(t, gw)
+}
+
+func TestGateway_PeerHangup(t *testing.T) {
+	logger := testLogger()
+	p := newPeer(t, logger, true)
+	defer p.srv.Shutdown()
+
+	gw, wsAddr, sipAddr := startGateway(t, p, logger, func(call *Call, c []string, end bool) {
+		t.Error("candidates must be relayed to the peer supporting trickle ICE")
+	})
+	defer gw.Shutdown()
+
+	b := newBrowser(t, wsAddr)
+	defer b.conn.Close()
+	b.call()
+	p.expect(t, sip.INVITE)
+	p.expect(t, sip.ACK)
+
+	b.request(sip.INFO, 2, []string{
+		"Info-Package: trickle-ice",
+		"Content-Type: application/trickle-ice-sdpfrag",
+	}, "a=candidate:1 1 UDP 2130706431 192.0.2.5 54400 typ host\r\n")
+	info := p.expect(t, sip.INFO)
+	if hdrs := info.GetHeaders("Info-Package"); len(hdrs) != 1 || !strings.Contains(info.Body(), "a=candidate:1") {
+		t.Errorf("unexpected relayed INFO %s", info)
+	}
+	if _, res := b.final(); res.StatusCode() != 200 {
+		t.Fatalf("unexpected response on trickle INFO %s", res.Short())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.bye(sipAddr)
+		done <- err
+	}()
+	bye, ok := b.read().(sip.Request)
+	if !ok || bye.Method() != sip.BYE {
+		t.Fatalf("browser: unexpected message %v, want BYE", bye)
+	}
+	if callID, _ := bye.CallID(); string(*callID) != b.callID {
+		t.Errorf("BYE of unexpected call %s", callID)
+	}
+	res := sip.NewResponseFromRequest("", bye, 200, "OK", "")
+	if err := wsutil.WriteClientText(b.conn, []byte(res.String())); err != nil {
+		t.Fatalf("browser: send: %s", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("BYE of the peer failed: %s", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("BYE of the peer is not answered")
+	}
+
+	expectNoCalls(t, gw)
+}
+
+func TestStripTrickle(t *testing.T) {
+	sdp, err := StripTrickle(browserSDP+"a=end-of-candidates\r\n", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(sdp, "trickle") || strings.Contains(sdp, "end-of-candidates") {
+		t.Errorf("trickle attributes are not removed:\n%s", sdp)
+	}
+	if sdp, _ := StripTrickle(browserSDP, false); sdp != browserSDP {
+		t.Errorf("description sent to the browser is changed:\n%s", sdp)
+	}
+}
@@ -0,0 +1,57 @@
+// Command webrtc is an example of WebRTC-to-SIP gateway signaling plane built from gosip building blocks.
+//
+// Browsers connect over SIP over WebSocket (RFC 7118) and place calls that the gateway bridges
+// to the SIP peer (PBX, proxy or trunk) over UDP or TCP.
+// The media plane is out of scope, the SDP rewriting hooks are the place to plug a media relay
+// that terminates ICE and DTLS-SRTP of the browser side.
+//
+// The composition:
+//   - WS and WSS transports of gosip.Server facing browsers, UDP and TCP facing the SIP peer;
+//   - back-to-back user agent - every call has the browser leg and the peer leg with own dialogs,
+//     transactions and session descriptions, see b2bua.go;
+//   - SDP rewriting - ordered hooks applied to every session description passed between the legs, see sdp.go;
+//   - trickle ICE - INFO requests of 'trickle-ice' info package (RFC 8840) from the browser are relayed
+//     to the peer supporting it or handed to the candidates hook otherwise, see trickle.go.
+//
+// Example:
+//
+//	webrtc -host 192.0.2.1 -ws 0.0.0.0:8080 -wss 0.0.0.0:8443 -cert certs/cert.pem -key certs/key.pem \
+//		-sip 0.0.0.0:5060 -peer 10.0.0.10:5060
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ghettovoice/gosip/log"
+)
+
+func main() {
+	var cfg Config
+	flag.StringVar(&cfg.Host, "host", "127.0.0.1", "IP address of the gateway used in Via and Contact")
+	flag.StringVar(&cfg.WS, "ws", "0.0.0.0:8080", "WS listen address, empty disables WS")
+	flag.StringVar(&cfg.WSS, "wss", "", "WSS listen address, empty disables WSS")
+	flag.StringVar(&cfg.Cert, "cert", "certs/cert.pem", "WSS certificate file")
+	flag.StringVar(&cfg.Key, "key", "certs/key.pem", "WSS key file")
+	flag.StringVar(&cfg.SIP, "sip", "0.0.0.0:5060", "UDP and TCP listen address facing the SIP peer")
+	flag.StringVar(&cfg.Peer, "peer", "127.0.0.1:5080", "address of the SIP peer receiving calls of browsers")
+	flag.Parse()
+
+	logger := log.NewDefaultLogrusLogger().WithPrefix("WebRTCGateway")
+	cfg.OnCandidates = func(call *Call, candidates []string, end bool) {
+		logger.Infof("call %s: %d trickled candidates, end of candidates %v", call, len(candidates), end)
+	}
+
+	gw, err := NewGateway(cfg, logger)
+	if err != nil {
+		logger.Fatalf("start gateway: %s", err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	<-stop
+
+	gw.Shutdown()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+)
+
+// SDPRewriter rewrites the session description passed from one leg to another,
+// toPeer is true for descriptions of the browser sent to the peer.
+// Returned error rejects the offer with '488 Not Acceptable Here'.
+type SDPRewriter func(sdp string, toPeer bool) (string, error)
+
+// StripTrickle removes trickle ICE attributes from descriptions sent to the peer,
+// the peer not supporting trickle ICE must not wait for candidates - RFC 8840 5.
+func StripTrickle(sdp string, toPeer bool) (string, error) {
+	if !toPeer {
+		return sdp, nil
+	}
+	return filterSDPLines(sdp, func(line string) bool {
+		return line != "a=ice-options:trickle" && line != "a=end-of-candidates"
+	}), nil
+}
+
+// Keeps lines of the description accepted by the function, line endings are normalized to CRLF.
+func filterSDPLines(sdp string, keep func(line string) bool) string {
+	lines := strings.Split(strings.Replace(sdp, "\r\n", "\n", -1), "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line == "" || !keep(line) {
+			continue
+		}
+		out = append(out, line)
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\r\n") + "\r\n"
+}
+
+// Applies StripTrickle and configured rewriters, empty description is passed as is.
+func (gw *Gateway) rewriteSDP(sdp string, toPeer bool) (string, error) {
+	if strings.TrimSpace(sdp) == "" {
+		return "", nil
+	}
+
+	rewriters := append([]SDPRewriter{StripTrickle}, gw.cfg.Rewriters...)
+	for _, rewrite := range rewriters {
+		var err error
+		if sdp, err = rewrite(sdp, toPeer); err != nil {
+			return "", err
+		}
+	}
+	return sdp, nil
+}
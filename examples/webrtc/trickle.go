@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+const (
+	trickleInfoPackage = "trickle-ice"
+	trickleContentType = "application/trickle-ice-sdpfrag"
+)
+
+// CandidatesFunc receives 'a=candidate' lines trickled by the browser,
+// end is true when the browser signals the end of candidates.
+type CandidatesFunc func(call *Call, candidates []string, end bool)
+
+// Returns true if the peer listed 'trickle-ice' in 'Recv-Info' - RFC 6086 5.2.2.
+func supportsTrickle(msg sip.Message) bool {
+	for _, hdr := range msg.GetHeaders("Recv-Info") {
+		for _, pkg := range strings.Split(hdr.Value(), ",") {
+			if sip.TokenEqual(strings.TrimSpace(pkg), trickleInfoPackage) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func infoPackage(req sip.Request) string {
+	if hdrs := req.GetHeaders("Info-Package"); len(hdrs) > 0 {
+		return strings.TrimSpace(strings.Split(hdrs[0].Value(), ";")[0])
+	}
+	return ""
+}
+
+// Returns candidates and the end of candidates flag of 'application/trickle-ice-sdpfrag' body - RFC 8840 9.
+func parseSDPFrag(body string) (candidates []string, end bool) {
+	candidates = make([]string, 0)
+	for _, line := range strings.Split(strings.Replace(body, "\r\n", "\n", -1), "\n") {
+		switch {
+		case strings.HasPrefix(line, "a=candidate:"):
+			candidates = append(candidates, line)
+		case line == "a=end-of-candidates":
+			end = true
+		}
+	}
+	return candidates, end
+}
+
+// INFO of 'trickle-ice' package from the browser is relayed to the peer supporting it,
+// otherwise candidates are passed to Config.OnCandidates and the INFO is answered by the gateway.
+// Other INFO requests are relayed to the other leg as is - RFC 6086.
+func (gw *Gateway) onInfo(req sip.Request, tx sip.ServerTransaction) {
+	l, ok := gw.match(req)
+	if !ok {
+		gw.respond(req, tx, 481, "Call/Transaction Does Not Exist")
+		return
+	}
+	if err := l.dialog.ReceiveRequest(req); err != nil {
+		code := sip.StatusCode(500)
+		if dlgErr, ok := err.(*sip.DialogError); ok {
+			code = dlgErr.StatusCode
+		}
+		gw.respond(req, tx, code, sip.ReasonPhrase(code))
+		return
+	}
+
+	pkg := infoPackage(req)
+	trickle := sip.TokenEqual(pkg, trickleInfoPackage)
+	if trickle && !l.browser {
+		// the browser leg never negotiates trickle ICE with the peer
+		gw.respond(req, tx, 469, "Bad Info Package")
+		return
+	}
+
+	other := l.other()
+	if trickle && (!other.trickle || other.dialog == nil) {
+		if ct, ok := req.ContentType(); !ok || !sip.TokenEqual(strings.Split(ct.Value(), ";")[0], trickleContentType) {
+			gw.respond(req, tx, 415, "Unsupported Media Type")
+			return
+		}
+		candidates, end := parseSDPFrag(req.Body())
+		if gw.cfg.OnCandidates != nil {
+			gw.cfg.OnCandidates(l.call, candidates, end)
+		}
+		gw.respond(req, tx, 200, "OK")
+		return
+	}
+	if other.dialog == nil {
+		gw.respond(req, tx, 481, "Call/Transaction Does Not Exist")
+		return
+	}
+
+	info, err := other.dialog.NewRequest(sip.INFO, req.Body())
+	if err != nil {
+		gw.respond(req, tx, 500, "Server Internal Error")
+		return
+	}
+	for _, name := range []string{"Info-Package", "Content-Type", "Content-Disposition"} {
+		sip.CopyHeaders(name, req, info)
+	}
+	res, err := gw.request(other, info)
+	if res == nil {
+		gw.log.WithFields(req.Fields()).Warnf("relay INFO failed: %s", err)
+		gw.respond(req, tx, 408, "Request Timeout")
+		return
+	}
+	gw.respond(req, tx, res.StatusCode(), res.Reason())
+}
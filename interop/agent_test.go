@@ -0,0 +1,418 @@
+//go:build interop
+// +build interop
+
+package interop_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/util"
+)
+
+// Time limit of a single transaction of the flow.
+const flowTimeout = 10 * time.Second
+
+// stack describes the reference stack under test.
+type stack struct {
+	// addr is the outbound proxy address, all requests of the agents are sent there.
+	addr   string
+	domain string
+}
+
+// Returns the stack from the environment variable, the test is skipped if the variable is empty.
+func stackFromEnv(t *testing.T, name, domain string) stack {
+	t.Helper()
+	addr := os.Getenv(name)
+	if addr == "" {
+		t.Skipf("%s is not set", name)
+	}
+	if domain == "" {
+		domain, _, _ = net.SplitHostPort(addr)
+	}
+	return stack{addr, domain}
+}
+
+// agent is a minimal user agent scripted by the tests: it registers, places and answers one call at a time.
+// Received in-dialog requests are answered with 200 OK and passed to the requests channel.
+type agent struct {
+	t        *testing.T
+	srv      gosip.Server
+	stack    stack
+	user     string
+	password string
+	host     string
+	port     int
+	requests chan sip.Request
+
+	mu      sync.Mutex
+	uac     *sip.DialogClient
+	uas     *sip.DialogServer
+	dialog  *sip.Dialog
+	session string
+}
+
+func newAgent(t *testing.T, stack stack, user, password string) *agent {
+	host := os.Getenv("INTEROP_HOST")
+	if host == "" {
+		ip, err := util.ResolveSelfIP()
+		if err != nil {
+			t.Fatalf("resolve self IP: %s", err)
+		}
+		host = ip.String()
+	}
+
+	// reserve free port
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Fatalf("reserve port: %s", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	ua := &agent{
+		t:        t,
+		stack:    stack,
+		user:     user,
+		password: password,
+		host:     host,
+		port:     port,
+		requests: make(chan sip.Request, 16),
+		uac:      sip.NewDialogClient(),
+		uas:      sip.NewDialogServer(),
+	}
+	ua.srv = gosip.NewServer(gosip.ServerConfig{Host: host, UserAgent: "GoSIP interop"}, nil, nil,
+		testutils.NewLogrusLogger().WithPrefix(user))
+	for method, handler := range map[sip.RequestMethod]gosip.RequestHandler{
+		sip.INVITE: ua.onInvite,
+		sip.ACK:    ua.onInDialog,
+		sip.BYE:    ua.onInDialog,
+		sip.NOTIFY: ua.onInDialog,
+		sip.REFER:  ua.onRefer,
+	} {
+		if err := ua.srv.OnRequest(method, handler); err != nil {
+			t.Fatalf("register %s handler: %s", method, err)
+		}
+	}
+	if err := ua.srv.Listen("udp", net.JoinHostPort(host, strconv.Itoa(port))); err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	return ua
+}
+
+func (ua *agent) shutdown() {
+	ua.srv.Shutdown()
+}
+
+// Returns URI of the user in the stack domain, URI of the domain itself if user is empty.
+func (ua *agent) uri(user string) sip.Uri {
+	uri := &sip.SipUri{
+		FHost:      ua.stack.domain,
+		FUriParams: sip.NewParams(),
+		FHeaders:   sip.NewParams(),
+	}
+	if user != "" {
+		uri.FUser = sip.String{Str: user}
+	}
+	return uri
+}
+
+func (ua *agent) contact() sip.Uri {
+	port := sip.Port(ua.port)
+	return &sip.SipUri{
+		FUser:      sip.String{Str: ua.user},
+		FHost:      ua.host,
+		FPort:      &port,
+		FUriParams: sip.NewParams(),
+		FHeaders:   sip.NewParams(),
+	}
+}
+
+// Builds out-of-dialog request from the agent address-of-record.
+func (ua *agent) newRequest(method sip.RequestMethod, recipient sip.Uri, body string) sip.Request {
+	builder := sip.NewRequestBuilder().
+		SetMethod(method).
+		SetRecipient(recipient).
+		SetFrom(&sip.Address{
+			Uri:    ua.uri(ua.user),
+			Params: sip.NewParams().Add("tag", sip.String{Str: util.RandString(8)}),
+		}).
+		SetContact(&sip.Address{Uri: ua.contact()}).
+		SetBody(body)
+	if method == sip.REGISTER {
+		builder.SetTo(&sip.Address{Uri: ua.uri(ua.user)})
+	} else {
+		builder.SetTo(&sip.Address{Uri: recipient})
+	}
+	if body != "" {
+		contentType := sip.ContentType("application/sdp")
+		builder.SetContentType(&contentType)
+	}
+	// all mandatory fields are set
+	req, _ := builder.Build()
+	return req
+}
+
+// Sends the request through the stack answering authentication challenges, returns the final response.
+func (ua *agent) request(req sip.Request, password string) (sip.Response, error) {
+	ua.prepare(req)
+	ctx, cancel := context.WithTimeout(context.Background(), flowTimeout)
+	defer cancel()
+	return ua.srv.RequestWithContext(ctx, req, gosip.WithAuthorizer(&sip.DefaultAuthorizer{
+		User:     sip.String{Str: ua.user},
+		Password: sip.String{Str: password},
+	}))
+}
+
+// Sets the outbound proxy and the top Via of the request.
+func (ua *agent) prepare(req sip.Request) {
+	port := sip.Port(ua.port)
+	req.RemoveHeader("Via")
+	req.PrependHeader(sip.ViaHeader{&sip.ViaHop{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       "UDP",
+		Host:            ua.host,
+		Port:            &port,
+		Params:          sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}})
+	req.SetDestination(ua.stack.addr)
+}
+
+func (ua *agent) register(expires uint32, password string) (sip.Response, error) {
+	req := ua.newRequest(sip.REGISTER, ua.uri(""), "")
+	exp := sip.Expires(expires)
+	req.AppendHeader(&exp)
+	return ua.request(req, password)
+}
+
+// Places the call and acknowledges 2xx, the established dialog becomes the agent current dialog.
+func (ua *agent) call(recipient sip.Uri, offer string) (sip.Response, error) {
+	req := ua.newRequest(sip.INVITE, recipient, offer)
+	res, err := ua.request(req, ua.password)
+	if err != nil {
+		return nil, err
+	}
+
+	dlg, err := ua.uac.Establish(req, res)
+	if err != nil {
+		return nil, err
+	}
+	ua.mu.Lock()
+	ua.dialog = dlg
+	ua.mu.Unlock()
+	return res, ua.ack(dlg)
+}
+
+func (ua *agent) ack(dlg *sip.Dialog) error {
+	ack, err := dlg.NewRequest(sip.ACK, "")
+	if err != nil {
+		return err
+	}
+	ua.prepare(ack)
+	return ua.srv.Send(ack)
+}
+
+// Sends request in the current dialog, e.g. re-INVITE, REFER or BYE.
+func (ua *agent) inDialog(method sip.RequestMethod, body string, hdrs ...sip.Header) (sip.Response, error) {
+	dlg := ua.currentDialog()
+	if dlg == nil {
+		return nil, fmt.Errorf("no dialog to send %s", method)
+	}
+
+	req, err := dlg.NewRequest(method, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != "" {
+		contentType := sip.ContentType("application/sdp")
+		req.AppendHeader(&contentType)
+	}
+	for _, hdr := range hdrs {
+		req.AppendHeader(hdr)
+	}
+	res, err := ua.request(req, ua.password)
+	if err != nil {
+		return nil, err
+	}
+	if err := dlg.ReceiveResponse(res); err != nil {
+		return nil, err
+	}
+	if method == sip.INVITE {
+		return res, ua.ack(dlg)
+	}
+	return res, nil
+}
+
+func (ua *agent) currentDialog() *sip.Dialog {
+	ua.mu.Lock()
+	defer ua.mu.Unlock()
+	return ua.dialog
+}
+
+// Waits for the in-dialog request of the method.
+func (ua *agent) expect(t *testing.T, method sip.RequestMethod) sip.Request {
+	t.Helper()
+	timeout := time.After(flowTimeout)
+	for {
+		select {
+		case req := <-ua.requests:
+			if req.Method() == method {
+				return req
+			}
+		case <-timeout:
+			t.Fatalf("%s: %s is not received", ua.user, method)
+			return nil
+		}
+	}
+}
+
+func (ua *agent) respond(req sip.Request, tx sip.ServerTransaction, code sip.StatusCode, reason, body string) sip.Response {
+	res := sip.NewResponseFromRequest("", req, code, reason, body)
+	if code > 100 {
+		if to, ok := res.To(); ok && (to.Params == nil || !to.Params.Has("tag")) {
+			ua.mu.Lock()
+			if ua.session == "" {
+				ua.session = util.RandString(8)
+			}
+			if to.Params == nil {
+				to.Params = sip.NewParams()
+			}
+			to.Params.Add("tag", sip.String{Str: ua.session})
+			ua.mu.Unlock()
+		}
+	}
+	if req.Method() == sip.INVITE && code < 300 {
+		res.AppendHeader(&sip.ContactHeader{Address: ua.contact()})
+	}
+	if body != "" {
+		contentType := sip.ContentType("application/sdp")
+		res.AppendHeader(&contentType)
+	}
+	if err := tx.Respond(res); err != nil {
+		ua.t.Errorf("%s: respond on %s: %s", ua.user, req.Short(), err)
+	}
+	return res
+}
+
+// Answers initial INVITE with ringing and the answer mirroring the offer,
+// re-INVITE is answered with the hold answer on the hold offer.
+func (ua *agent) onInvite(req sip.Request, tx sip.ServerTransaction) {
+	if to, ok := req.To(); ok && to.Params != nil && to.Params.Has("tag") {
+		ua.onInDialog(req, tx)
+		return
+	}
+
+	ua.mu.Lock()
+	ua.session = ""
+	ua.mu.Unlock()
+	ua.respond(req, tx, 180, "Ringing", "")
+	res := ua.respond(req, tx, 200, "OK", answerSDP(req.Body(), ua.host))
+	dlg, err := ua.uas.Establish(req, res)
+	if err != nil {
+		ua.t.Errorf("%s: establish dialog: %s", ua.user, err)
+		return
+	}
+	ua.mu.Lock()
+	ua.dialog = dlg
+	ua.mu.Unlock()
+	ua.requests <- req
+}
+
+func (ua *agent) onRefer(req sip.Request, tx sip.ServerTransaction) {
+	dlg, err := ua.uas.Match(req)
+	if err != nil {
+		ua.t.Errorf("%s: match REFER: %s", ua.user, err)
+		return
+	}
+	res := ua.respond(req, tx, 202, "Accepted", "")
+	if err := dlg.SendResponse(res); err != nil {
+		ua.t.Errorf("%s: send 202 in dialog: %s", ua.user, err)
+	}
+	ua.requests <- req
+
+	// the transfer target is not called, the subscription is terminated with the final status at once
+	go func() {
+		event := sip.GenericHeader{HeaderName: "Event", Contents: "refer"}
+		state := sip.GenericHeader{HeaderName: "Subscription-State", Contents: "terminated;reason=noresource"}
+		notify, err := dlg.NewRequest(sip.NOTIFY, "")
+		if err != nil {
+			ua.t.Errorf("%s: build NOTIFY: %s", ua.user, err)
+			return
+		}
+		notify.AppendHeader(&event)
+		notify.AppendHeader(&state)
+		contentType := sip.ContentType("message/sipfrag;version=2.0")
+		notify.AppendHeader(&contentType)
+		notify.SetBody("SIP/2.0 200 OK", true)
+		if _, err := ua.request(notify, ua.password); err != nil {
+			ua.t.Errorf("%s: NOTIFY failed: %s", ua.user, err)
+		}
+	}()
+}
+
+func (ua *agent) onInDialog(req sip.Request, tx sip.ServerTransaction) {
+	dlg, err := ua.uas.Match(req)
+	if err != nil {
+		dlg, err = ua.uac.Match(req)
+	}
+	if err != nil {
+		if req.IsAck() {
+			return
+		}
+		ua.respond(req, tx, 481, "Call/Transaction Does Not Exist", "")
+		return
+	}
+
+	if !req.IsAck() {
+		var body string
+		if req.Method() == sip.INVITE {
+			body = answerSDP(req.Body(), ua.host)
+		}
+		res := ua.respond(req, tx, 200, "OK", body)
+		if err := dlg.SendResponse(res); err != nil {
+			ua.t.Errorf("%s: send %s in dialog: %s", ua.user, res.Short(), err)
+		}
+	}
+	ua.requests <- req
+}
+
+// Session description of the agent, the media is not really sent.
+func offerSDP(host, direction string) string {
+	return strings.Join([]string{
+		"v=0",
+		"o=gosip 1 1 IN IP4 " + host,
+		"s=interop",
+		"c=IN IP4 " + host,
+		"t=0 0",
+		"m=audio 40000 RTP/AVP 0 101",
+		"a=rtpmap:0 PCMU/8000",
+		"a=rtpmap:101 telephone-event/8000",
+		"a=" + direction,
+		"",
+	}, "\r\n")
+}
+
+// Answers the offer with the reverse media direction.
+func answerSDP(offer, host string) string {
+	direction := "sendrecv"
+	switch {
+	case strings.Contains(offer, "a=sendonly"):
+		direction = "recvonly"
+	case strings.Contains(offer, "a=recvonly"):
+		direction = "sendonly"
+	case strings.Contains(offer, "a=inactive"):
+		direction = "inactive"
+	}
+	return offerSDP(host, direction)
+}
@@ -0,0 +1,16 @@
+// Package interop holds the interoperability suite that runs scripted call flows of gosip user agents
+// against reference SIP stacks: Kamailio as the authenticating registrar and proxy, FreeSWITCH as the B2BUA.
+//
+// Tests are built with the 'interop' tag, a stack is skipped unless its address is set in the environment:
+//
+//	INTEROP_KAMAILIO    - address of Kamailio, e.g. 192.0.2.1:5070
+//	INTEROP_FREESWITCH  - address of FreeSWITCH internal profile, e.g. 192.0.2.1:5060
+//	INTEROP_HOST        - local IP the user agents listen on, must be reachable from the stacks,
+//	                      the auto resolved IP is used if empty
+//
+// docker-compose.yml in the package directory starts both stacks on the host network, so
+//
+//	make test-interop
+//
+// starts the containers, runs the suite and stops them.
+package interop
@@ -0,0 +1,35 @@
+//go:build interop
+// +build interop
+
+package interop_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Runs the step of the flow, the flow is stopped on the first failed step.
+func step(t *testing.T, name string, fn func(t *testing.T)) {
+	if !t.Run(name, fn) {
+		t.FailNow()
+	}
+}
+
+func expectDirection(t *testing.T, sdp, direction string) {
+	t.Helper()
+	if !strings.Contains(sdp, "a="+direction) {
+		t.Errorf("expected %s media in:\n%s", direction, sdp)
+	}
+}
+
+func expectStatus(t *testing.T, res sip.Response, err error, code sip.StatusCode) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if res.StatusCode() != code {
+		t.Fatalf("expected %d response, got %s", code, res.Short())
+	}
+}
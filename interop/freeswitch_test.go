@@ -0,0 +1,90 @@
+//go:build interop
+// +build interop
+
+package interop_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// gosip agent registers as a user of the default FreeSWITCH directory and calls the demo extensions.
+func TestFreeSWITCH(t *testing.T) {
+	stack := stackFromEnv(t, "INTEROP_FREESWITCH", os.Getenv("INTEROP_FREESWITCH_DOMAIN"))
+	password := os.Getenv("INTEROP_FREESWITCH_PASSWORD")
+	if password == "" {
+		// default_password of the vanilla configuration
+		password = "1234"
+	}
+	ua := newAgent(t, stack, "1000", password)
+	defer ua.shutdown()
+
+	step(t, "auth", func(t *testing.T) {
+		_, err := ua.register(60, "wrong")
+		var reqErr *sip.RequestError
+		if !errors.As(err, &reqErr) || (reqErr.Code != 401 && reqErr.Code != 403) {
+			t.Fatalf("expected rejected registration, got %v", err)
+		}
+	})
+
+	step(t, "register", func(t *testing.T) {
+		res, err := ua.register(60, password)
+		expectStatus(t, res, err, 200)
+	})
+
+	step(t, "call", func(t *testing.T) {
+		// echo test
+		res, err := ua.call(ua.uri("9196"), offerSDP(ua.host, "sendrecv"))
+		expectStatus(t, res, err, 200)
+		expectDirection(t, res.Body(), "sendrecv")
+	})
+
+	step(t, "hold", func(t *testing.T) {
+		res, err := ua.inDialog(sip.INVITE, offerSDP(ua.host, "sendonly"))
+		expectStatus(t, res, err, 200)
+		expectDirection(t, res.Body(), "recvonly")
+	})
+
+	step(t, "resume", func(t *testing.T) {
+		res, err := ua.inDialog(sip.INVITE, offerSDP(ua.host, "sendrecv"))
+		expectStatus(t, res, err, 200)
+		expectDirection(t, res.Body(), "sendrecv")
+	})
+
+	step(t, "transfer", func(t *testing.T) {
+		// music on hold
+		referTo := sip.GenericHeader{HeaderName: "Refer-To", Contents: "<" + ua.uri("9664").String() + ">"}
+		res, err := ua.inDialog(sip.REFER, "", &referTo)
+		expectStatus(t, res, err, 202)
+		for {
+			notify := ua.expect(t, sip.NOTIFY)
+			if strings.HasPrefix(notify.Body(), "SIP/2.0 1") {
+				continue
+			}
+			if !strings.HasPrefix(notify.Body(), "SIP/2.0 200") {
+				t.Errorf("unexpected transfer status %q", notify.Body())
+			}
+			break
+		}
+	})
+
+	step(t, "hangup", func(t *testing.T) {
+		res, err := ua.inDialog(sip.BYE, "")
+		// the transferred call may be already released by FreeSWITCH
+		var reqErr *sip.RequestError
+		var dlgErr *sip.DialogError
+		if errors.As(err, &reqErr) && reqErr.Code == 481 || errors.As(err, &dlgErr) && dlgErr.StatusCode == 481 {
+			return
+		}
+		expectStatus(t, res, err, 200)
+	})
+
+	step(t, "unregister", func(t *testing.T) {
+		res, err := ua.register(0, password)
+		expectStatus(t, res, err, 200)
+	})
+}
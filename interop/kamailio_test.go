@@ -0,0 +1,85 @@
+//go:build interop
+// +build interop
+
+package interop_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Password of any user in kamailio/kamailio.cfg.
+const kamailioPassword = "secret"
+
+// Two gosip agents call each other through Kamailio, that challenges REGISTER and initial requests
+// and record-routes the dialog.
+func TestKamailio(t *testing.T) {
+	stack := stackFromEnv(t, "INTEROP_KAMAILIO", "interop.test")
+	alice := newAgent(t, stack, "alice", kamailioPassword)
+	defer alice.shutdown()
+	bob := newAgent(t, stack, "bob", kamailioPassword)
+	defer bob.shutdown()
+
+	step(t, "auth", func(t *testing.T) {
+		_, err := alice.register(60, "wrong")
+		var reqErr *sip.RequestError
+		if !errors.As(err, &reqErr) || (reqErr.Code != 401 && reqErr.Code != 403) {
+			t.Fatalf("expected rejected registration, got %v", err)
+		}
+	})
+
+	step(t, "register", func(t *testing.T) {
+		for _, ua := range []*agent{alice, bob} {
+			res, err := ua.register(60, kamailioPassword)
+			expectStatus(t, res, err, 200)
+			if len(res.GetHeaders("Contact")) == 0 {
+				t.Errorf("%s: no bindings in %s", ua.user, res.Short())
+			}
+		}
+	})
+
+	step(t, "call", func(t *testing.T) {
+		res, err := alice.call(alice.uri("bob"), offerSDP(alice.host, "sendrecv"))
+		expectStatus(t, res, err, 200)
+		expectDirection(t, res.Body(), "sendrecv")
+		if len(res.GetHeaders("Record-Route")) == 0 {
+			t.Errorf("dialog is not record-routed by the proxy")
+		}
+		bob.expect(t, sip.INVITE)
+		bob.expect(t, sip.ACK)
+	})
+
+	step(t, "hold", func(t *testing.T) {
+		res, err := alice.inDialog(sip.INVITE, offerSDP(alice.host, "sendonly"))
+		expectStatus(t, res, err, 200)
+		expectDirection(t, res.Body(), "recvonly")
+		expectDirection(t, bob.expect(t, sip.INVITE).Body(), "sendonly")
+		bob.expect(t, sip.ACK)
+	})
+
+	step(t, "transfer", func(t *testing.T) {
+		referTo := sip.GenericHeader{HeaderName: "Refer-To", Contents: "<" + alice.uri("carol").String() + ">"}
+		res, err := alice.inDialog(sip.REFER, "", &referTo)
+		expectStatus(t, res, err, 202)
+		bob.expect(t, sip.REFER)
+		notify := alice.expect(t, sip.NOTIFY)
+		if notify.Body() != "SIP/2.0 200 OK" {
+			t.Errorf("unexpected transfer status %q", notify.Body())
+		}
+	})
+
+	step(t, "hangup", func(t *testing.T) {
+		res, err := alice.inDialog(sip.BYE, "")
+		expectStatus(t, res, err, 200)
+		bob.expect(t, sip.BYE)
+	})
+
+	step(t, "unregister", func(t *testing.T) {
+		for _, ua := range []*agent{alice, bob} {
+			res, err := ua.register(0, kamailioPassword)
+			expectStatus(t, res, err, 200)
+		}
+	})
+}
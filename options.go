@@ -52,3 +52,74 @@ func (o withClientTxCallbacks) ApplyRequestWithContext(options *RequestWithConte
 	options.OnAck = o.onAckFn
 	options.OnCancel = o.onCancFn
 }
+
+// HandlerOption configures request handler registered with OnRequest.
+type HandlerOption interface {
+	ApplyHandler(options *HandlerOptions)
+}
+
+// HandlerOptions describes request bodies supported by the handler.
+// Requests with other bodies are answered with '415 Unsupported Media Type'
+// listing supported ones in the 'Accept' and 'Accept-Encoding' headers - RFC 3261 8.2.3.
+type HandlerOptions struct {
+	// AcceptTypes are media types of supported bodies, wildcards 'type/*' and '*/*' are allowed.
+	// Empty list means any media type.
+	AcceptTypes []string
+	// AcceptEncodings are supported content codings besides 'identity'.
+	AcceptEncodings []string
+	// Forwarding marks handlers that forward requests as a proxy.
+	Forwarding bool
+}
+
+type withAcceptTypes struct {
+	types []string
+}
+
+func (o withAcceptTypes) ApplyHandler(options *HandlerOptions) {
+	options.AcceptTypes = append(options.AcceptTypes, o.types...)
+}
+
+// WithAcceptTypes enables '415 Unsupported Media Type' responses on requests with bodies of other media types.
+func WithAcceptTypes(types ...string) HandlerOption {
+	return withAcceptTypes{types}
+}
+
+type withAcceptEncodings struct {
+	codings []string
+}
+
+func (o withAcceptEncodings) ApplyHandler(options *HandlerOptions) {
+	options.AcceptEncodings = append(options.AcceptEncodings, o.codings...)
+}
+
+// WithAcceptEncodings enables '415 Unsupported Media Type' responses on requests with bodies
+// encoded with codings other than 'identity' and the given ones.
+func WithAcceptEncodings(codings ...string) HandlerOption {
+	return withAcceptEncodings{codings}
+}
+
+type withForwarding struct{}
+
+func (o withForwarding) ApplyHandler(options *HandlerOptions) {
+	options.Forwarding = true
+}
+
+// WithForwarding marks the handler as a proxy forwarding requests: requests with 'Max-Forwards: 0'
+// are answered with '483 Too Many Hops' and don't reach it - RFC 3261 16.3 step 2.
+// The handler decrements 'Max-Forwards' of forwarded copies with sip.DecrementMaxForwards.
+func WithForwarding() HandlerOption {
+	return withForwarding{}
+}
+
+// Returns nil if there are no options, so handlers registered without options accept any body.
+func applyHandlerOptions(options ...HandlerOption) *HandlerOptions {
+	if len(options) == 0 {
+		return nil
+	}
+
+	optsHash := &HandlerOptions{}
+	for _, opt := range options {
+		opt.ApplyHandler(optsHash)
+	}
+	return optsHash
+}
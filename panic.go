@@ -0,0 +1,127 @@
+package gosip
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+// ErrCallbackPanic is matched by errors of panics recovered from user callbacks.
+var ErrCallbackPanic = errors.New("callback panicked")
+
+// PanicError describes panic recovered from the request handler or another user callback.
+type PanicError struct {
+	// Callback is the name of the panicked callback, e.g. "INVITE handler" or "OnPreSend".
+	Callback string
+	// Recovered is a value returned by recover().
+	Recovered interface{}
+	Stack     []byte
+}
+
+func (err *PanicError) Is(target error) bool { return target == ErrCallbackPanic }
+func (err *PanicError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("gosip.PanicError<%s>: %v", err.Callback, err.Recovered)
+}
+
+// Reports panic recovered from the user callback and re-raises it if the server is configured so.
+// Must be called directly from the deferred function, onPanic turns the panic into the failure
+// of the request or transaction the callback was called for.
+func (srv *server) recoverCallback(callback string, logger log.Logger, onPanic func(err *PanicError)) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	err := &PanicError{
+		Callback:  callback,
+		Recovered: recovered,
+		Stack:     debug.Stack(),
+	}
+	logger.WithFields(log.Fields{
+		"callback": callback,
+		"panic":    fmt.Sprintf("%v", recovered),
+	}).Errorf("callback panicked:\n%s", err.Stack)
+
+	if onPanic != nil {
+		onPanic(err)
+	}
+	if srv.onPanic != nil {
+		srv.onPanic(err)
+	}
+	if srv.rePanic {
+		panic(recovered)
+	}
+}
+
+// Panic policy of the server timers, panics are reported as PanicError like ones of other callbacks.
+func (srv *server) timerPanics() timing.PanicPolicy {
+	return timing.PanicPolicy{
+		Logger: srv.Log(),
+		Handler: func(timer string, recovered interface{}, stack []byte) {
+			if srv.onPanic != nil {
+				srv.onPanic(&PanicError{Callback: timer, Recovered: recovered, Stack: stack})
+			}
+		},
+		RePanic: srv.rePanic,
+	}
+}
+
+// Calls the request handler answering '500 Server Internal Error' if it panics - RFC 3261 21.5.1.
+// The response is ignored by the transaction if the handler has already sent the final one.
+func (srv *server) callHandler(handler RequestHandler, req sip.Request, tx sip.ServerTransaction, logger log.Logger) {
+	defer srv.recoverCallback(fmt.Sprintf("%s handler", req.Method()), logger, func(err *PanicError) {
+		if req.IsAck() {
+			return
+		}
+
+		res := sip.NewResponseFromRequest("", req, 500, "Server Internal Error", "")
+		if _, err := srv.Respond(res); err != nil {
+			logger.Errorf("respond '500 Server Internal Error' failed: %s", err)
+		}
+	})
+
+	handler(req, tx)
+}
+
+// Protects the pre-send hook, the panic aborts sending of the message with PanicError.
+func (srv *server) protectPreSend(hook transport.PreSendHook) transport.PreSendHook {
+	return func(msg sip.Message, network string, target *transport.Target) (err error) {
+		defer srv.recoverCallback("OnPreSend", srv.Log().WithFields(msg.Fields()), func(panicErr *PanicError) {
+			err = panicErr
+		})
+
+		return hook(msg, network, target)
+	}
+}
+
+// Protects the post-send hook, the message is already sent so the panic is only reported.
+func (srv *server) protectPostSend(hook transport.PostSendHook) transport.PostSendHook {
+	return func(data []byte, network string, target *transport.Target) {
+		defer srv.recoverCallback("OnPostSend", srv.Log(), nil)
+
+		hook(data, network, target)
+	}
+}
+
+// Calls the response handler of RequestWithContext, the panic is returned as PanicError.
+func (srv *server) callResponseHandler(
+	handler func(res sip.Response, request sip.Request),
+	res sip.Response,
+	req sip.Request,
+) (err error) {
+	defer srv.recoverCallback("response handler", srv.Log().WithFields(res.Fields()), func(panicErr *PanicError) {
+		err = panicErr
+	})
+
+	handler(res, req)
+	return nil
+}
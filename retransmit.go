@@ -0,0 +1,290 @@
+package gosip
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+// AckTimeoutError is passed to the timeout callback of Retransmission
+// when ACK on 2xx response to INVITE is not received within 64*T1.
+// The TU should terminate the dialog by sending BYE - RFC 3261 13.3.1.4.
+type AckTimeoutError struct {
+	Response sip.Response
+}
+
+func (err *AckTimeoutError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("gosip.AckTimeoutError<%s>: ACK not received in %s", err.Response.Short(), 64*transaction.T1)
+}
+
+// RetransmissionSnapshot is a serializable state of a Retransmission,
+// time values are stored as durations left at the moment of capture like in timing.RecurringSnapshot.
+type RetransmissionSnapshot struct {
+	// Response is the raw 2xx response.
+	Response string
+	// Interval is the current retransmission interval.
+	Interval time.Duration
+	TakenAt  time.Time
+	// Left is a duration left to the next retransmission.
+	Left time.Duration
+	// Expires is a duration left to give up waiting for ACK.
+	Expires time.Duration
+}
+
+// Elapsed returns time passed since the snapshot capture.
+func (snapshot RetransmissionSnapshot) Elapsed() time.Duration {
+	if elapsed := timing.Now().Sub(snapshot.TakenAt); elapsed > 0 {
+		return elapsed
+	}
+	return 0
+}
+
+// Retransmission retransmits 2xx response on INVITE starting with T1 interval doubled up to T2
+// until ACK arrives or 64*T1 expires - RFC 3261 13.3.1.4.
+// Since RFC 6026 the INVITE server transaction doesn't retransmit 2xx, so this is the TU responsibility.
+type Retransmission struct {
+	res       sip.Response
+	send      func(msg sip.Message) error
+	onTimeout func(err error)
+	panics    timing.PanicPolicy
+
+	mu       sync.Mutex
+	interval time.Duration
+	nextFire time.Time
+	deadline time.Time
+	timer    timing.Timer
+	done     chan struct{}
+}
+
+// NewRetransmission starts retransmission of the response already sent once with the send function.
+// onTimeout is called with *AckTimeoutError if ACK is not received in time.
+func NewRetransmission(res sip.Response, send func(msg sip.Message) error, onTimeout func(err error)) *Retransmission {
+	return newRetransmission(res, send, onTimeout, timing.PanicPolicy{})
+}
+
+func newRetransmission(
+	res sip.Response,
+	send func(msg sip.Message) error,
+	onTimeout func(err error),
+	panics timing.PanicPolicy,
+) *Retransmission {
+	now := timing.Now()
+	r := &Retransmission{
+		res:       res,
+		send:      send,
+		onTimeout: onTimeout,
+		panics:    panics,
+		interval:  transaction.T1,
+		deadline:  now.Add(64 * transaction.T1),
+		done:      make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.schedule(r.interval)
+	r.mu.Unlock()
+
+	return r
+}
+
+// RestoreRetransmission creates a Retransmission from the snapshot.
+// Time elapsed since the capture is taken into account, missed retransmission is sent immediately.
+func RestoreRetransmission(
+	snapshot RetransmissionSnapshot,
+	send func(msg sip.Message) error,
+	onTimeout func(err error),
+	logger log.Logger,
+) (*Retransmission, error) {
+	msg, err := parser.ParseMessage([]byte(snapshot.Response), logger)
+	if err != nil {
+		return nil, fmt.Errorf("restore 2xx retransmission: %w", err)
+	}
+	res, ok := msg.(sip.Response)
+	if !ok {
+		return nil, fmt.Errorf("restore 2xx retransmission: %s is not a response", msg.Short())
+	}
+
+	elapsed := snapshot.Elapsed()
+	r := &Retransmission{
+		res:       res,
+		send:      send,
+		onTimeout: onTimeout,
+		panics:    timing.PanicPolicy{Logger: logger},
+		interval:  snapshot.Interval,
+		deadline:  timing.Now().Add(snapshot.Expires - elapsed),
+		done:      make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.schedule(snapshot.Left - elapsed)
+	r.mu.Unlock()
+
+	return r, nil
+}
+
+// Response returns the retransmitted response.
+func (r *Retransmission) Response() sip.Response {
+	return r.res
+}
+
+// Matches checks that ACK request acknowledges the retransmitted response.
+func (r *Retransmission) Matches(ack sip.Request) bool {
+	return ack.IsAck() && retransmissionKey(ack) == retransmissionKey(r.res)
+}
+
+// Ack stops retransmission, returns false if it had been already stopped.
+func (r *Retransmission) Ack() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.stop()
+}
+
+// Done returns channel that is closed when retransmission stops.
+func (r *Retransmission) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *Retransmission) Snapshot() RetransmissionSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := timing.Now()
+	snapshot := RetransmissionSnapshot{
+		Response: r.res.String(),
+		Interval: r.interval,
+		TakenAt:  now,
+	}
+	if left := r.nextFire.Sub(now); left > 0 {
+		snapshot.Left = left
+	}
+	if expires := r.deadline.Sub(now); expires > 0 {
+		snapshot.Expires = expires
+	}
+
+	return snapshot
+}
+
+// Should be called under lock.
+func (r *Retransmission) schedule(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	r.nextFire = timing.Now().Add(d)
+	r.timer = timing.AfterFunc(d, r.panics.Protect("2xx retransmission", r.fire))
+}
+
+// Should be called under lock.
+func (r *Retransmission) stop() bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+	}
+
+	close(r.done)
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+
+	return true
+}
+
+func (r *Retransmission) fire() {
+	r.mu.Lock()
+	select {
+	case <-r.done:
+		r.mu.Unlock()
+		return
+	default:
+	}
+
+	if !timing.Now().Before(r.deadline) {
+		r.stop()
+		r.mu.Unlock()
+
+		if r.onTimeout != nil {
+			r.onTimeout(&AckTimeoutError{r.res})
+		}
+		return
+	}
+
+	r.interval *= 2
+	if r.interval > transaction.T2 {
+		r.interval = transaction.T2
+	}
+	next := r.interval
+	if left := r.deadline.Sub(timing.Now()); left < next {
+		next = left
+	}
+	r.schedule(next)
+	r.mu.Unlock()
+
+	if err := r.send(r.res); err != nil {
+		r.mu.Lock()
+		r.stop()
+		r.mu.Unlock()
+
+		if r.onTimeout != nil {
+			r.onTimeout(fmt.Errorf("retransmit %s: %w", r.res.Short(), err))
+		}
+	}
+}
+
+func retransmissionKey(msg sip.Message) string {
+	var callID, seq string
+	if hdr, ok := msg.CallID(); ok {
+		callID = string(*hdr)
+	}
+	if cseq, ok := msg.CSeq(); ok {
+		seq = fmt.Sprint(cseq.SeqNo)
+	}
+
+	return callID + "/" + seq
+}
+
+func (srv *server) Retransmit2xx(res sip.Response, onTimeout func(err error)) (*Retransmission, error) {
+	if !res.IsSuccess() {
+		return nil, fmt.Errorf("can not retransmit non-2xx response %s", res.Short())
+	}
+	if cseq, ok := res.CSeq(); !ok || cseq.MethodName != sip.INVITE {
+		return nil, fmt.Errorf("can not retransmit response %s on non-INVITE request", res.Short())
+	}
+
+	key := retransmissionKey(res)
+	r := newRetransmission(res, srv.Send, func(err error) {
+		srv.retransmissions.Delete(key)
+		if onTimeout != nil {
+			onTimeout(err)
+		}
+	}, srv.timerPanics())
+	srv.retransmissions.Store(key, r)
+
+	return r, nil
+}
+
+// Stops 2xx retransmission acknowledged by the ACK request, returns true if the ACK matches one.
+func (srv *server) ackRetransmission(ack sip.Request) bool {
+	key := retransmissionKey(ack)
+	v, ok := srv.retransmissions.Load(key)
+	if !ok {
+		return false
+	}
+	r := v.(*Retransmission)
+	if !r.Matches(ack) {
+		return false
+	}
+	r.Ack()
+	srv.retransmissions.Delete(key)
+
+	return true
+}
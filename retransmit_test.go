@@ -0,0 +1,142 @@
+package gosip_test
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("2xx retransmission", func() {
+	clientAddr := "127.0.0.1:9007"
+	localTarget := transport.NewTarget("127.0.0.1", 5067)
+	logger := testutils.NewLogrusLogger()
+
+	inviteReq := func(via string) sip.Request {
+		return testutils.Request([]string{
+			"INVITE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + via + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: retransmit-test",
+			"CSeq: 1 INVITE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	}
+
+	It("should give up after deadline of restored retransmission", func(done Done) {
+		defer close(done)
+
+		res := sip.NewResponseFromRequest("", inviteReq(clientAddr), 200, "OK", "")
+		var mu sync.Mutex
+		sent := 0
+		send := func(msg sip.Message) error {
+			mu.Lock()
+			sent++
+			mu.Unlock()
+			return nil
+		}
+		errs := make(chan error, 1)
+
+		r := gosip.NewRetransmission(res, send, func(err error) { errs <- err })
+		snapshot := r.Snapshot()
+		Expect(r.Ack()).To(BeTrue())
+		Expect(r.Ack()).To(BeFalse())
+		Expect(snapshot.Interval).To(Equal(transaction.T1))
+		Expect(snapshot.Expires).To(BeNumerically("~", 64*transaction.T1, time.Second))
+
+		snapshot.Left = 50 * time.Millisecond
+		snapshot.Expires = 100 * time.Millisecond
+		restored, err := gosip.RestoreRetransmission(snapshot, send, func(err error) { errs <- err }, logger)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restored.Response().StatusCode()).To(Equal(sip.StatusCode(200)))
+
+		err = <-errs
+		_, ok := err.(*gosip.AckTimeoutError)
+		Expect(ok).To(BeTrue())
+		Eventually(restored.Done()).Should(BeClosed())
+		mu.Lock()
+		Expect(sent).To(Equal(1))
+		mu.Unlock()
+	}, 3)
+
+	Context("with server", func() {
+		var srv gosip.Server
+
+		BeforeEach(func() {
+			srv = gosip.NewServer(gosip.ServerConfig{}, nil, nil, logger)
+			Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		})
+
+		AfterEach(func() {
+			srv.Shutdown()
+		}, 3)
+
+		It("should retransmit 2xx until ACK arrives", func(done Done) {
+			defer close(done)
+
+			retransmissions := make(chan *gosip.Retransmission, 1)
+			Expect(srv.OnRequest(sip.INVITE, func(req sip.Request, tx sip.ServerTransaction) {
+				defer GinkgoRecover()
+
+				res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+				Expect(tx.Respond(res)).To(Succeed())
+				r, err := srv.Retransmit2xx(res, nil)
+				Expect(err).ToNot(HaveOccurred())
+				retransmissions <- r
+			})).To(Succeed())
+
+			conn, err := net.ListenPacket("udp", clientAddr)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			raddr, err := net.ResolveUDPAddr("udp", localTarget.Addr())
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = conn.WriteTo([]byte(inviteReq(clientAddr).String()), raddr)
+			Expect(err).ToNot(HaveOccurred())
+
+			buf := make([]byte, transport.MTU)
+			var res sip.Response
+			for i := 0; i < 2; i++ {
+				n, _, err := conn.ReadFrom(buf)
+				Expect(err).ToNot(HaveOccurred())
+				msg, err := parser.ParseMessage(buf[:n], logger)
+				Expect(err).ToNot(HaveOccurred())
+				res = msg.(sip.Response)
+				Expect(res.StatusCode()).To(Equal(sip.StatusCode(200)))
+			}
+
+			ack := testutils.Request([]string{
+				"ACK sip:bob@example.com SIP/2.0",
+				"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+				"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+				"To: \"Bob\" <sip:bob@far-far-away.com>",
+				"Call-ID: retransmit-test",
+				"CSeq: 1 ACK",
+				"Content-Length: 0",
+				"",
+				"",
+			})
+			_, err = conn.WriteTo([]byte(ack.String()), raddr)
+			Expect(err).ToNot(HaveOccurred())
+
+			r := <-retransmissions
+			Eventually(r.Done()).Should(BeClosed())
+			// the ACK is absorbed by the retransmission and is not an orphan
+			Consistently(func() uint64 {
+				return srv.Stats().OrphanAcks
+			}, 200*time.Millisecond).Should(BeZero())
+		}, 5)
+	})
+})
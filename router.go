@@ -0,0 +1,214 @@
+package gosip
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Middleware wraps request handler, e.g. to authenticate or log requests.
+type Middleware func(next RequestHandler) RequestHandler
+
+// TraceMiddleware records header changes made by the middleware before it passes request to the next handler
+// into the request transformation log, see sip.EnableHeaderTrace.
+// If the middleware doesn't call the next handler, changes are recorded when it returns.
+func TraceMiddleware(component string, middleware Middleware) Middleware {
+	return func(next RequestHandler) RequestHandler {
+		return func(req sip.Request, tx sip.ServerTransaction) {
+			done := sip.TraceHeaders(req, component)
+			middleware(func(req sip.Request, tx sip.ServerTransaction) {
+				done()
+				next(req, tx)
+			})(req, tx)
+			done()
+		}
+	}
+}
+
+// RequestPredicate is an additional condition of the route.
+type RequestPredicate func(req sip.Request) bool
+
+// HeaderPredicate matches requests that have header with the value accepted by match,
+// nil match accepts any value.
+func HeaderPredicate(name string, match func(value string) bool) RequestPredicate {
+	return func(req sip.Request) bool {
+		for _, hdr := range req.GetHeaders(name) {
+			if match == nil || match(hdr.Value()) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type routeCapturesKey struct{}
+
+// RouteCaptures returns strings matched by '*' of the route pattern the request was dispatched by.
+func RouteCaptures(req sip.Request) []string {
+	captures, _ := sip.MessageMetadata(req).Value(routeCapturesKey{}).([]string)
+	return captures
+}
+
+// Route dispatches requests of the method matched by the Request-URI pattern and predicates.
+type Route struct {
+	method      sip.RequestMethod
+	pattern     *sip.UriPattern
+	predicates  []RequestPredicate
+	middlewares []Middleware
+	handler     RequestHandler
+}
+
+// Where adds predicates to the route.
+func (route *Route) Where(predicates ...RequestPredicate) *Route {
+	route.predicates = append(route.predicates, predicates...)
+	return route
+}
+
+// Use attaches middlewares to the route, they are called in order of attachment.
+func (route *Route) Use(middlewares ...Middleware) *Route {
+	route.middlewares = append(route.middlewares, middlewares...)
+	return route
+}
+
+func (route *Route) String() string {
+	if route == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("gosip.Route<%s %s>", route.method, route.pattern)
+}
+
+func (route *Route) match(req sip.Request) ([]string, bool) {
+	if req.Method() != route.method {
+		return nil, false
+	}
+
+	captures, ok := route.pattern.Match(req.Recipient())
+	if !ok {
+		return nil, false
+	}
+
+	for _, predicate := range route.predicates {
+		if !predicate(req) {
+			return nil, false
+		}
+	}
+
+	return captures, true
+}
+
+func (route *Route) serve(req sip.Request, tx sip.ServerTransaction, middlewares []Middleware) {
+	handler := route.handler
+	for i := len(route.middlewares) - 1; i >= 0; i-- {
+		handler = route.middlewares[i](handler)
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	handler(req, tx)
+}
+
+// Router dispatches requests to handlers by method and Request-URI pattern like http.ServeMux.
+// Routes are matched in order of registration.
+type Router struct {
+	mu          sync.RWMutex
+	routes      []*Route
+	middlewares []Middleware
+	fallback    RequestHandler
+}
+
+func NewRouter() *Router {
+	return new(Router)
+}
+
+// Handle registers handler of requests with the method and Request-URI matched by the pattern,
+// see sip.UriPattern for the pattern syntax. Strings matched by '*' are available to the handler with RouteCaptures.
+func (router *Router) Handle(method sip.RequestMethod, pattern string, handler RequestHandler) (*Route, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("nil handler of route %s %s", method, pattern)
+	}
+
+	uriPattern, err := sip.CompileUriPattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route pattern: %w", err)
+	}
+
+	route := &Route{
+		method:  method,
+		pattern: uriPattern,
+		handler: handler,
+	}
+
+	router.mu.Lock()
+	router.routes = append(router.routes, route)
+	router.mu.Unlock()
+
+	return route, nil
+}
+
+// Use attaches middlewares to all routes, they are called before route middlewares.
+func (router *Router) Use(middlewares ...Middleware) {
+	router.mu.Lock()
+	router.middlewares = append(router.middlewares, middlewares...)
+	router.mu.Unlock()
+}
+
+// Fallback sets handler of requests that match no route.
+// Without fallback such requests are answered with '404 Not Found'.
+func (router *Router) Fallback(handler RequestHandler) {
+	router.mu.Lock()
+	router.fallback = handler
+	router.mu.Unlock()
+}
+
+// Methods returns methods of registered routes.
+func (router *Router) Methods() []sip.RequestMethod {
+	router.mu.RLock()
+	defer router.mu.RUnlock()
+
+	added := make(map[sip.RequestMethod]bool)
+	methods := make([]sip.RequestMethod, 0)
+	for _, route := range router.routes {
+		if !added[route.method] {
+			added[route.method] = true
+			methods = append(methods, route.method)
+		}
+	}
+	return methods
+}
+
+// ServeSIP dispatches the request to the first matched route, it can be used as RequestHandler.
+func (router *Router) ServeSIP(req sip.Request, tx sip.ServerTransaction) {
+	router.mu.RLock()
+	var (
+		matched  *Route
+		captures []string
+	)
+	for _, route := range router.routes {
+		if c, ok := route.match(req); ok {
+			matched, captures = route, c
+			break
+		}
+	}
+	middlewares := router.middlewares
+	fallback := router.fallback
+	router.mu.RUnlock()
+
+	if matched != nil {
+		sip.MessageMetadata(req).SetValue(routeCapturesKey{}, captures)
+		matched.serve(req, tx, middlewares)
+		return
+	}
+
+	if fallback != nil {
+		fallback(req, tx)
+		return
+	}
+
+	// ACK request doesn't have any transaction and doesn't require any response
+	if tx != nil && !req.IsAck() {
+		_ = tx.Respond(sip.NewResponseFromRequest("", req, 404, "Not Found", ""))
+	}
+}
@@ -0,0 +1,163 @@
+package gosip_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+)
+
+var _ = Describe("Router", func() {
+	var (
+		router  *gosip.Router
+		handled []string
+	)
+
+	request := func(method sip.RequestMethod, uri string, headers ...string) sip.Request {
+		lines := []string{
+			string(method) + " " + uri + " SIP/2.0",
+			"Via: SIP/2.0/UDP 127.0.0.1:5070;branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <" + uri + ">",
+			"CSeq: 1 " + string(method),
+		}
+		lines = append(lines, headers...)
+		lines = append(lines, "Content-Length: 0", "", "")
+		return testutils.Request(lines)
+	}
+
+	handler := func(name string) gosip.RequestHandler {
+		return func(req sip.Request, tx sip.ServerTransaction) {
+			handled = append(handled, name)
+		}
+	}
+
+	BeforeEach(func() {
+		router = gosip.NewRouter()
+		handled = nil
+	})
+
+	It("should reject invalid pattern", func() {
+		_, err := router.Handle(sip.INVITE, "sip:@", handler("invalid"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should route by method, domain and user prefix", func() {
+		_, err := router.Handle(sip.INVITE, "sip:support-*@*.example.com", handler("support"))
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = router.Handle(sip.INVITE, "sip:*@example.com", handler("domain"))
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = router.Handle(sip.MESSAGE, "*", handler("message"))
+		Expect(err).ShouldNot(HaveOccurred())
+		router.Fallback(handler("fallback"))
+
+		router.ServeSIP(request(sip.INVITE, "sip:support-1@eu.example.com"), nil)
+		router.ServeSIP(request(sip.INVITE, "sip:bob@example.com"), nil)
+		router.ServeSIP(request(sip.INVITE, "sip:bob@eu.example.com"), nil)
+		router.ServeSIP(request(sip.MESSAGE, "sip:bob@other.com"), nil)
+
+		Expect(handled).To(Equal([]string{"support", "domain", "fallback", "message"}))
+		Expect(router.Methods()).To(ConsistOf(sip.INVITE, sip.MESSAGE))
+	})
+
+	It("should pass pattern captures to the handler", func() {
+		var captures []string
+		_, err := router.Handle(sip.INVITE, "sip:+1555*@*.example.com", func(req sip.Request, tx sip.ServerTransaction) {
+			captures = gosip.RouteCaptures(req)
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		router.ServeSIP(request(sip.INVITE, "sip:+15551234@eu.example.com"), nil)
+
+		Expect(captures).To(Equal([]string{"1234", "eu"}))
+	})
+
+	It("should match header predicates and call middlewares in order", func() {
+		route, err := router.Handle(sip.INVITE, "example.com", handler("priority"))
+		Expect(err).ShouldNot(HaveOccurred())
+		route.Where(gosip.HeaderPredicate("Priority", func(value string) bool {
+			return value == "emergency"
+		})).Use(func(next gosip.RequestHandler) gosip.RequestHandler {
+			return func(req sip.Request, tx sip.ServerTransaction) {
+				handled = append(handled, "route middleware")
+				next(req, tx)
+			}
+		})
+		router.Use(func(next gosip.RequestHandler) gosip.RequestHandler {
+			return func(req sip.Request, tx sip.ServerTransaction) {
+				handled = append(handled, "router middleware")
+				next(req, tx)
+			}
+		})
+		router.Fallback(handler("fallback"))
+
+		router.ServeSIP(request(sip.INVITE, "sip:bob@example.com", "Priority: emergency"), nil)
+		router.ServeSIP(request(sip.INVITE, "sip:bob@example.com"), nil)
+
+		Expect(handled).To(Equal([]string{"router middleware", "route middleware", "priority", "fallback"}))
+	})
+
+	It("should record header changes of traced middlewares", func() {
+		_, err := router.Handle(sip.INVITE, "*", func(req sip.Request, tx sip.ServerTransaction) {
+			req.AppendHeader(&sip.GenericHeader{HeaderName: "X-Handler", Contents: "1"})
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		router.Use(gosip.TraceMiddleware("identity", func(next gosip.RequestHandler) gosip.RequestHandler {
+			return func(req sip.Request, tx sip.ServerTransaction) {
+				req.RemoveHeader("Priority")
+				req.AppendHeader(&sip.GenericHeader{HeaderName: "P-Asserted-Identity", Contents: "<sip:alice@example.com>"})
+				next(req, tx)
+			}
+		}))
+
+		req := request(sip.INVITE, "sip:bob@example.com", "Priority: emergency")
+		trace := sip.EnableHeaderTrace(req)
+		router.ServeSIP(req, nil)
+
+		changes := trace.Changes()
+		Expect(changes).To(HaveLen(2))
+		Expect(changes[0].Kind).To(Equal(sip.HeaderRemoved))
+		Expect(changes[0].Header).To(Equal("Priority"))
+		Expect(changes[1].Kind).To(Equal(sip.HeaderAdded))
+		Expect(changes[1].Header).To(Equal("P-Asserted-Identity"))
+		Expect(changes[1].Component).To(Equal("identity"))
+	})
+})
+
+var _ = Describe("Server routes", func() {
+	var srv gosip.Server
+
+	noop := func(req sip.Request, tx sip.ServerTransaction) {}
+
+	BeforeEach(func() {
+		srv = gosip.NewServer(gosip.ServerConfig{}, nil, nil, testutils.NewLogrusLogger())
+	})
+
+	It("should not replace handler registered with OnRequest", func() {
+		Expect(srv.OnRequest(sip.MESSAGE, noop)).To(Succeed())
+		_, err := srv.Handle(sip.MESSAGE, "*", noop)
+		Expect(err).To(HaveOccurred())
+		Expect(srv.Router().Methods()).To(BeEmpty())
+	})
+
+	It("should not replace router with handler registered with OnRequest", func() {
+		_, err := srv.Handle(sip.INVITE, "sip:*@example.com", noop)
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = srv.Handle(sip.INVITE, "*", noop)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(srv.OnRequest(sip.INVITE, noop)).ToNot(Succeed())
+	})
+	It("should not register unknown method", func() {
+		method := sip.RequestMethod("X-ROUTED")
+		Expect(srv.OnRequest(method, noop)).ToNot(Succeed())
+		_, err := srv.Handle(method, "*", noop)
+		Expect(err).To(HaveOccurred())
+		Expect(sip.IsKnownMethod(method)).To(BeFalse())
+
+		Expect(sip.RegisterMethod(method)).To(Succeed())
+		_, err = srv.Handle(method, "*", noop)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+})
@@ -6,7 +6,12 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
@@ -26,6 +31,9 @@ type Server interface {
 	Shutdown()
 
 	Listen(network, addr string, options ...transport.ListenOption) error
+	// Files returns duplicates of the listening sockets to hand them over to the upgraded process,
+	// see package upgrade.
+	Files() ([]*os.File, error)
 	Send(msg sip.Message) error
 
 	Request(req sip.Request) (sip.ClientTransaction, error)
@@ -34,9 +42,40 @@ type Server interface {
 		request sip.Request,
 		options ...RequestWithContextOption,
 	) (sip.Response, error)
-	OnRequest(method sip.RequestMethod, handler RequestHandler) error
+	// OnRequest registers handler of requests of the method,
+	// options describe supported request bodies, see HandlerOptions.
+	// Error is returned if the method is unknown, see sip.RegisterMethod, or is dispatched to the router.
+	OnRequest(method sip.RequestMethod, handler RequestHandler, options ...HandlerOption) error
+	// Handle registers route in the server router, see Router.Handle.
+	// Server dispatches requests of the route method to the router,
+	// error is returned if the method is handled by the handler registered with OnRequest.
+	Handle(method sip.RequestMethod, pattern string, handler RequestHandler) (*Route, error)
+	// Router returns server router, e.g. to set fallback handler or middlewares.
+	Router() *Router
+
+	// AddTenant registers new logical SIP service with its own set of request handlers.
+	AddTenant(config TenantConfig) (Tenant, error)
+	RemoveTenant(name string) bool
+	Tenant(name string) (Tenant, bool)
+
+	Stats() ServerStats
+	// EventPackages returns registry of supported event packages. Registered packages are listed
+	// in the 'Allow-Events' header, SUBSCRIBE, NOTIFY and PUBLISH requests of other packages
+	// are answered with '489 Bad Event' - RFC 6665 8.2.2.
+	EventPackages() *sip.EventRegistry
 
 	Respond(res sip.Response) (sip.ServerTransaction, error)
+	// Defer marks request of the server transaction to be answered later, possibly from another goroutine.
+	// The returned transaction should be used to respond, also it can be found later by key with ServerTransaction.
+	// '408 Request Timeout' is sent if final response is not sent within the timeout,
+	// zero timeout means DefaultDeferTimeout.
+	Defer(tx sip.ServerTransaction, timeout time.Duration) (sip.ServerTransaction, error)
+	// Retransmit2xx retransmits already sent 2xx response on INVITE until ACK arrives - RFC 3261 13.3.1.4.
+	// onTimeout is called with *AckTimeoutError if ACK is not received within 64*T1.
+	// The ACK stopping the retransmission is absorbed by the server and is not passed to request handlers.
+	Retransmit2xx(res sip.Response, onTimeout func(err error)) (*Retransmission, error)
+	// ServerTransaction returns active server transaction by key.
+	ServerTransaction(key sip.TransactionKey) (sip.ServerTransaction, bool)
 	RespondOnRequest(
 		request sip.Request,
 		status sip.StatusCode,
@@ -61,12 +100,121 @@ type ServerConfig struct {
 	// Dns is an address of the public DNS server to use in SRV lookup.
 	Dns        string
 	Extensions []string
-	MsgMapper  sip.MessageMapper
-	UserAgent  string
+	// Features are supported SIP extensions, their option tags are listed in the 'Supported' header
+	// along with Extensions. Requests requiring other extensions in the 'Require' header are answered
+	// with '420 Bad Extension' - RFC 3261 8.2.2.3. Nil disables the check.
+	Features  *sip.Features
+	MsgMapper sip.MessageMapper
+	UserAgent string
+	// Stamp is the default auto headers profile,
+	// if nil then profile built from UserAgent is used.
+	Stamp *StampProfile
+	// StampSelector returns auto headers profile for the outgoing message,
+	// nil result means the default profile.
+	StampSelector func(msg sip.Message) *StampProfile
+	// MaxForwards is a value of 'Max-Forwards' header inserted into outgoing requests without it,
+	// if zero then sip.DefaultMaxForwards is used.
+	MaxForwards sip.MaxForwards
+	// AnswerMaxForwardsProbe enables automatic '200 OK' response on OPTIONS request
+	// with 'Max-Forwards: 0' as a hop probe - RFC 3261 11. The probe is answered after
+	// tenant selection and dialog validation, instead of calling the OPTIONS handler.
+	AnswerMaxForwardsProbe bool
+	// AnswerOptions enables built-in responder of OPTIONS requests without registered handler,
+	// it answers '200 OK' describing server capabilities - RFC 3261 11.2.
+	// OptionsResponder listen option toggles it per listener.
+	AnswerOptions bool
+	// AcceptLanguages are listed in the 'Accept-Language' header of the built-in OPTIONS responses.
+	AcceptLanguages []string
+	// AllowEvents are initial event packages of the server registry, see Server.EventPackages.
+	AllowEvents []string
+	// UnhandledMethod defines response on requests without registered handler.
+	UnhandledMethod UnhandledMethodPolicy
+	// DefaultHandler is called on requests without registered handler instead of the UnhandledMethod policy.
+	DefaultHandler RequestHandler
+	// OnOrphanAck is called on ACK requests that match neither a transaction, a request handler
+	// nor a dialog known to DialogLookup.
+	OnOrphanAck func(ack sip.Request)
+	// DialogLookup enables strict dialog validation: in-dialog requests for which it returns false
+	// are rejected with '481 Call/Transaction Does Not Exist' - RFC 3261 12.2.2.
+	DialogLookup func(req sip.Request) bool
+	// OnUnknownDialog is called before rejecting in-dialog request of unknown dialog,
+	// it can return true to continue handling (e.g. after fetching the dialog from a peer).
+	OnUnknownDialog func(req sip.Request) bool
+	// OnDialogFailed is called when in-dialog request sent with RequestWithContext is rejected
+	// with '481 Call/Transaction Does Not Exist', e.g. after restart of the remote side.
+	// The application should re-INVITE with 'Replaces' or tear the call down.
+	OnDialogFailed func(failure *DialogFailure)
+	// OnPreSend is called with every outgoing message fully prepared by the transport layer,
+	// the hook may mutate the message before it is rendered, see transport.PreSendHook.
+	OnPreSend transport.PreSendHook
+	// OnPostSend is called with the exact bytes of every sent message and its destination,
+	// see transport.PostSendHook.
+	OnPostSend transport.PostSendHook
+	// BodyEncoding enables compression of outgoing and decoding of received message bodies,
+	// see transport.BodyEncoding.
+	BodyEncoding *transport.BodyEncoding
+	// ForceRport sends responses to the source address of requests received from behind NAT
+	// as if the client had asked for 'rport', see transport.Layer.SetForceRport.
+	ForceRport bool
+	// PriorityScheduling prioritizes processing of responses and ACK/BYE/CANCEL over new INVITE/REGISTER
+	// under load, see transport.Layer.SetPriorityScheduling.
+	PriorityScheduling bool
+	// OnPanic is called with panics recovered from request handlers and other callbacks of the server,
+	// they are logged anyway. Request of the panicked handler is answered with '500 Server Internal Error',
+	// RequestWithContext fails with PanicError if the response handler panics,
+	// panic of OnPreSend hook aborts sending of the message.
+	OnPanic func(err *PanicError)
+	// RePanic re-raises recovered panics after reporting, e.g. to fail fast in development.
+	RePanic bool
+}
+
+// ServerStats holds server counters.
+type ServerStats struct {
+	// OrphanAcks is a number of ACK requests that match neither a transaction, a request handler nor a known dialog,
+	// usually they are caused by broken 2xx retransmission handling on the remote side.
+	OrphanAcks uint64
+}
+
+// UnhandledMethodPolicy defines how the server answers requests of methods without registered handler.
+type UnhandledMethodPolicy int
+
+const (
+	// RespondMethodNotAllowed answers with '405 Method Not Allowed' listing registered methods in the 'Allow' header.
+	RespondMethodNotAllowed UnhandledMethodPolicy = iota
+	// RespondNotImplemented answers with '501 Not Implemented'.
+	RespondNotImplemented
+)
+
+// StampProfile describes headers automatically stamped on outgoing messages.
+type StampProfile struct {
+	// UserAgent is a value of the 'User-Agent' header of requests.
+	UserAgent string
+	// Server is a value of the 'Server' header of responses, UserAgent is used if empty.
+	Server string
+	// Anonymous disables 'User-Agent' and 'Server' headers for privacy.
+	Anonymous bool
+	// NoAllow disables 'Allow' header built from registered request handlers.
+	NoAllow bool
+	// NoSupported disables 'Supported' header built from server extensions.
+	NoSupported bool
+	// Features overrides server extensions in the 'Supported' header,
+	// required ones are listed in the 'Require' header of requests.
+	Features *sip.Features
+	// NoAllowEvents disables 'Allow-Events' header built from registered event packages.
+	NoAllowEvents bool
+}
+
+func (p *StampProfile) serverName() string {
+	if p.Server != "" {
+		return p.Server
+	}
+	return p.UserAgent
 }
 
 // Server is a SIP server
 type server struct {
+	// accessed atomically, keep first for 64-bit alignment
+	orphanAcks      uint64
 	running         abool.AtomicBool
 	tp              transport.Layer
 	tx              transaction.Layer
@@ -75,8 +223,33 @@ type server struct {
 	hwg             *sync.WaitGroup
 	hmu             *sync.RWMutex
 	requestHandlers map[sip.RequestMethod]RequestHandler
+	handlerOptions  map[sip.RequestMethod]*HandlerOptions
+	// methods dispatched to the router, guarded by hmu
+	routedMethods   map[sip.RequestMethod]bool
 	extensions      []string
-	userAgent       string
+	features        *sip.Features
+	stamp           *StampProfile
+	stampSelector   func(msg sip.Message) *StampProfile
+	tenants         *tenantStore
+	maxForwards     sip.MaxForwards
+	answerProbes    bool
+	answerOptions   bool
+	acceptLanguages []string
+	events          *sip.EventRegistry
+	unhandled       UnhandledMethodPolicy
+	defaultHandler  RequestHandler
+	onOrphanAck     func(ack sip.Request)
+	dialogLookup    func(req sip.Request) bool
+	onUnknownDialog func(req sip.Request) bool
+	onDialogFailed  func(failure *DialogFailure)
+	onPanic         func(err *PanicError)
+	rePanic         bool
+	deferred        sync.Map
+	retransmissions sync.Map
+	router          *Router
+
+	// listeners with toggled OPTIONS responder, guarded by hmu
+	optionsListeners []optionsListener
 
 	log log.Logger
 }
@@ -132,11 +305,32 @@ func NewServer(
 	if config.Extensions != nil {
 		extensions = config.Extensions
 	}
+	var features *sip.Features
+	if config.Features != nil {
+		features = new(sip.Features)
+		*features = *config.Features
+		features.Extra = append(append([]string{}, features.Extra...), extensions...)
+		extensions = features.Tags()
+	}
 
 	userAgent := config.UserAgent
 	if userAgent == "" {
 		userAgent = "GoSIP"
 	}
+	stamp := &StampProfile{
+		UserAgent: userAgent,
+	}
+	if config.Stamp != nil {
+		*stamp = *config.Stamp
+		if stamp.UserAgent == "" {
+			stamp.UserAgent = userAgent
+		}
+	}
+
+	maxForwards := config.MaxForwards
+	if maxForwards == 0 {
+		maxForwards = sip.DefaultMaxForwards
+	}
 
 	srv := &server{
 		host:            host,
@@ -144,13 +338,49 @@ func NewServer(
 		hwg:             new(sync.WaitGroup),
 		hmu:             new(sync.RWMutex),
 		requestHandlers: make(map[sip.RequestMethod]RequestHandler),
+		handlerOptions:  make(map[sip.RequestMethod]*HandlerOptions),
+		routedMethods:   make(map[sip.RequestMethod]bool),
 		extensions:      extensions,
-		userAgent:       userAgent,
+		features:        features,
+		stamp:           stamp,
+		stampSelector:   config.StampSelector,
+		tenants:         new(tenantStore),
+		router:          NewRouter(),
+		maxForwards:     maxForwards,
+		answerProbes:    config.AnswerMaxForwardsProbe,
+		answerOptions:   config.AnswerOptions,
+		acceptLanguages: config.AcceptLanguages,
+		events:          sip.NewEventRegistry(config.AllowEvents...),
+		unhandled:       config.UnhandledMethod,
+		defaultHandler:  config.DefaultHandler,
+		onOrphanAck:     config.OnOrphanAck,
+		dialogLookup:    config.DialogLookup,
+		onUnknownDialog: config.OnUnknownDialog,
+		onDialogFailed:  config.OnDialogFailed,
+		onPanic:         config.OnPanic,
+		rePanic:         config.RePanic,
 	}
 	srv.log = logger.WithFields(log.Fields{
 		"sip_server_ptr": fmt.Sprintf("%p", srv),
 	})
 	srv.tp = tpFactory(ip, dnsResolver, config.MsgMapper, srv.Log())
+	if config.OnPreSend != nil {
+		srv.tp.OnPreSend(srv.protectPreSend(config.OnPreSend))
+	}
+	if config.OnPostSend != nil {
+		srv.tp.OnPostSend(srv.protectPostSend(config.OnPostSend))
+	}
+	if config.BodyEncoding != nil {
+		if err := srv.tp.SetBodyEncoding(config.BodyEncoding); err != nil {
+			logger.Panicf("set body encoding failed: %s", err)
+		}
+	}
+	if config.ForceRport {
+		srv.tp.SetForceRport(true)
+	}
+	if config.PriorityScheduling {
+		srv.tp.SetPriorityScheduling(true)
+	}
 	sipTp := &sipTransport{
 		tpl: srv.tp,
 		srv: srv,
@@ -169,7 +399,25 @@ func (srv *server) Log() log.Logger {
 
 // ListenAndServe starts serving listeners on the provided address
 func (srv *server) Listen(network string, listenAddr string, options ...transport.ListenOption) error {
-	return srv.tp.Listen(network, listenAddr, options...)
+	if err := srv.tp.Listen(network, listenAddr, options...); err != nil {
+		return err
+	}
+
+	for _, opt := range options {
+		if o, ok := opt.(OptionsResponder); ok {
+			srv.setOptionsResponder(network, listenAddr, bool(o))
+		}
+	}
+
+	return nil
+}
+
+func (srv *server) Files() ([]*os.File, error) {
+	tpl, ok := srv.tp.(transport.FileLayer)
+	if !ok {
+		return nil, fmt.Errorf("transport layer %s doesn't support socket export", srv.tp)
+	}
+	return tpl.Files()
 }
 
 func (srv *server) serve() {
@@ -187,6 +435,10 @@ func (srv *server) serve() {
 			if !ok {
 				return
 			}
+			// ACK on retransmitted 2xx is absorbed, it is neither routed to handlers nor counted as orphan
+			if srv.ackRetransmission(ack) {
+				continue
+			}
 			srv.hwg.Add(1)
 			go srv.handleRequest(ack, nil)
 		case response, ok := <-srv.tx.Responses():
@@ -228,9 +480,91 @@ func (srv *server) handleRequest(req sip.Request, tx sip.ServerTransaction) {
 	logger := srv.Log().WithFields(req.Fields())
 	logger.Debug("routing incoming SIP request...")
 
-	srv.hmu.RLock()
-	handler, ok := srv.requestHandlers[req.Method()]
-	srv.hmu.RUnlock()
+	var (
+		handler RequestHandler
+		options *HandlerOptions
+		ok      bool
+	)
+	if tenant, matched := srv.tenants.match(req); matched {
+		logger = logger.WithFields(log.Fields{
+			"tenant": tenant.Name(),
+		})
+		sip.MessageMetadata(req).SetValue(tenantKey{}, Tenant(tenant))
+
+		if !tenant.acquire() {
+			logger.Warn("tenant requests limit exceeded")
+
+			if !req.IsAck() {
+				res := sip.NewResponseFromRequest("", req, 503, "Service Unavailable", "")
+				if _, err := srv.Respond(res); err != nil {
+					logger.Errorf("respond '503 Service Unavailable' failed: %s", err)
+				}
+			}
+
+			return
+		}
+		defer tenant.release()
+
+		handler, options, ok = tenant.handler(req.Method())
+	} else {
+		srv.hmu.RLock()
+		handler, ok = srv.requestHandlers[req.Method()]
+		options = srv.handlerOptions[req.Method()]
+		srv.hmu.RUnlock()
+	}
+
+	if !srv.validateDialog(req) {
+		logger.Warn("in-dialog SIP request of unknown dialog")
+
+		if req.IsAck() {
+			srv.handleOrphanAck(req, logger)
+		} else {
+			res := sip.NewResponseFromRequest("", req, 481, "Call/Transaction Does Not Exist", "")
+			if _, err := srv.Respond(res); err != nil {
+				logger.Errorf("respond '481 Call/Transaction Does Not Exist' failed: %s", err)
+			}
+		}
+
+		return
+	}
+
+	if srv.answerProbes && sip.IsMaxForwardsProbe(req) {
+		logger.Debug("answer OPTIONS hop probe")
+
+		res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+		if _, err := srv.Respond(res); err != nil {
+			logger.Errorf("respond '200 OK' failed: %s", err)
+		}
+
+		return
+	}
+
+	if ok && options != nil && options.Forwarding && !req.IsAck() && sip.IsTooManyHops(req) {
+		logger.Warn("SIP request can't be forwarded further")
+
+		res := sip.NewResponseFromRequest("", req, 483, "Too Many Hops", "")
+		if _, err := srv.Respond(res); err != nil {
+			logger.Errorf("respond '483 Too Many Hops' failed: %s", err)
+		}
+
+		return
+	}
+
+	if ok && !srv.validateEvent(req, logger) {
+		return
+	}
+
+	if !ok && req.Method() == sip.OPTIONS && srv.answersOptions(req) {
+		logger.Debug("answer OPTIONS with server capabilities")
+
+		srv.respondOptions(req, logger)
+
+		return
+	}
+
+	if !ok && srv.defaultHandler != nil {
+		handler, ok = srv.defaultHandler, true
+	}
 
 	if !ok {
 		logger.Warn("SIP request handler not found")
@@ -254,26 +588,174 @@ func (srv *server) handleRequest(req sip.Request, tx sip.ServerTransaction) {
 		}
 
 		// ACK request doesn't require any response, so just skip this step
-		if !req.IsAck() {
-			res := sip.NewResponseFromRequest("", req, 405, "Method Not Allowed", "")
-			if _, err := srv.Respond(res); err != nil {
-				logger.Errorf("respond '405 Method Not Allowed' failed: %s", err)
-			}
+		if req.IsAck() {
+			srv.handleOrphanAck(req, logger)
+		} else {
+			srv.respondUnhandled(req, logger)
 		}
 
 		return
 	}
 
-	handler(req, tx)
+	if !srv.validateExtensions(req, logger) {
+		return
+	}
+
+	if options != nil && !req.IsAck() && !supportedBody(req, options) {
+		logger.Warn("SIP request body is not supported")
+
+		srv.respondUnsupportedBody(req, options, logger)
+
+		return
+	}
+
+	srv.callHandler(handler, req, tx, logger)
+}
+
+// Checks that in-dialog request belongs to known dialog if strict dialog validation is enabled.
+func (srv *server) validateDialog(req sip.Request) bool {
+	if srv.dialogLookup == nil || !sip.IsInDialog(req) || srv.dialogLookup(req) {
+		return true
+	}
+
+	return srv.onUnknownDialog != nil && srv.onUnknownDialog(req)
+}
+
+// Checks event package of SUBSCRIBE, NOTIFY and PUBLISH requests against the registry
+// and answers '489 Bad Event' if it is not supported - RFC 6665 8.2.1, RFC 3903 4.
+// Requests are not checked until any event package is registered.
+func (srv *server) validateEvent(req sip.Request, logger log.Logger) bool {
+	switch req.Method() {
+	case sip.SUBSCRIBE, sip.NOTIFY, sip.PUBLISH:
+	default:
+		return true
+	}
+	if srv.events.Len() == 0 {
+		return true
+	}
+
+	pkg, _, ok := sip.GetEvent(req)
+	if ok && srv.events.Supports(pkg) {
+		return true
+	}
+
+	logger.Warnf("SIP request of unsupported event package '%s'", pkg)
+
+	res := sip.NewResponseFromRequest("", req, 489, "Bad Event", "")
+	// 489 response must contain 'Allow-Events' header regardless of the stamp profile
+	res.AppendHeader(srv.events.AllowEvents())
+	if _, err := srv.Respond(res); err != nil {
+		logger.Errorf("respond '489 Bad Event' failed: %s", err)
+	}
+
+	return false
+}
+
+// Checks option tags of the 'Require' header against server features and answers
+// '420 Bad Extension' listing unsupported ones - RFC 3261 8.2.2.3. ACK and CANCEL are not checked.
+func (srv *server) validateExtensions(req sip.Request, logger log.Logger) bool {
+	if srv.features == nil || req.IsAck() || req.IsCancel() {
+		return true
+	}
+
+	unsupported := srv.features.Unsupported(req)
+	if len(unsupported) == 0 {
+		return true
+	}
+
+	logger.Warnf("SIP request requires unsupported extensions %v", unsupported)
+
+	res := sip.NewBadExtensionResponse(req, unsupported)
+	if _, err := srv.Respond(res); err != nil {
+		logger.Errorf("respond '420 Bad Extension' failed: %s", err)
+	}
+
+	return false
+}
+
+func (srv *server) handleOrphanAck(ack sip.Request, logger log.Logger) {
+	// ACK within a dialog known to the dialog layer is not an orphan even if there is no handler for it
+	if srv.dialogLookup != nil && sip.IsInDialog(ack) && srv.dialogLookup(ack) {
+		logger.Debug("ACK request of known dialog absorbed")
+
+		return
+	}
+
+	count := atomic.AddUint64(&srv.orphanAcks, 1)
+	logger.WithFields(log.Fields{
+		"orphan_acks": count,
+	}).Warn("orphan ACK request absorbed")
+
+	if srv.onOrphanAck != nil {
+		defer srv.recoverCallback("OnOrphanAck", logger, nil)
+
+		srv.onOrphanAck(ack)
+	}
+}
+
+func (srv *server) EventPackages() *sip.EventRegistry {
+	return srv.events
+}
+
+func (srv *server) Stats() ServerStats {
+	return ServerStats{
+		OrphanAcks: atomic.LoadUint64(&srv.orphanAcks),
+	}
+}
+
+// Answers request without registered handler according to the server policy - RFC 3261 8.2.1.
+func (srv *server) respondUnhandled(req sip.Request, logger log.Logger) {
+	var res sip.Response
+	switch srv.unhandled {
+	case RespondNotImplemented:
+		res = sip.NewResponseFromRequest("", req, 501, "Not Implemented", "")
+	default:
+		res = sip.NewResponseFromRequest("", req, 405, "Method Not Allowed", "")
+		// 405 response must contain 'Allow' header regardless of the stamp profile
+		allow := make(sip.AllowHeader, 0)
+		methods := srv.getAllowedMethods()
+		if t, ok := sip.MessageMetadata(req).Value(tenantKey{}).(*tenant); ok {
+			methods = t.allowedMethods()
+		}
+		for _, method := range methods {
+			allow = append(allow, method)
+		}
+		res.AppendHeader(allow)
+	}
+
+	if _, err := srv.Respond(res); err != nil {
+		logger.Errorf("respond '%d %s' failed: %s", res.StatusCode(), res.Reason(), err)
+	}
+}
+
+// Answers request with unsupported body listing supported media types and codings - RFC 3261 8.2.3.
+func (srv *server) respondUnsupportedBody(req sip.Request, options *HandlerOptions, logger log.Logger) {
+	res := sip.NewResponseFromRequest("", req, 415, "Unsupported Media Type", "")
+	if len(options.AcceptTypes) > 0 {
+		accept := sip.Accept(strings.Join(options.AcceptTypes, ", "))
+		res.AppendHeader(&accept)
+	}
+	res.AppendHeader(&sip.GenericHeader{
+		HeaderName: "Accept-Encoding",
+		Contents:   strings.Join(append([]string{"identity"}, options.AcceptEncodings...), ", "),
+	})
+
+	if _, err := srv.Respond(res); err != nil {
+		logger.Errorf("respond '415 Unsupported Media Type' failed: %s", err)
+	}
 }
 
 // Send SIP message
 func (srv *server) Request(req sip.Request) (sip.ClientTransaction, error) {
+	return srv.request(context.Background(), req)
+}
+
+func (srv *server) request(ctx context.Context, req sip.Request) (sip.ClientTransaction, error) {
 	if !srv.running.IsSet() {
 		return nil, fmt.Errorf("can not send through stopped server")
 	}
 
-	return srv.tx.Request(srv.prepareRequest(req))
+	return srv.tx.RequestContext(ctx, srv.prepareRequest(req))
 }
 
 func (srv *server) RequestWithContext(
@@ -295,7 +777,12 @@ func (srv *server) requestWithContext(
 		opt.ApplyRequestWithContext(optionsHash)
 	}
 
-	tx, err := srv.Request(request)
+	cachingAuthorizer, _ := optionsHash.Authorizer.(sip.CachingAuthorizer)
+	if cachingAuthorizer != nil && attempt == 1 {
+		cachingAuthorizer.PreAuthorizeRequest(request)
+	}
+
+	tx, err := srv.request(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -357,7 +844,9 @@ func (srv *server) requestWithContext(
 					if lastResponse != nil {
 						lastResponse.SetPrevious(previousMessages)
 					}
-					errs <- sip.NewRequestError(487, "Request Terminated", request, lastResponse)
+					reqErr := sip.NewRequestError(487, "Request Terminated", request, lastResponse)
+					reqErr.Err = transaction.ErrTransactionTerminated
+					errs <- reqErr
 					return
 				}
 
@@ -365,7 +854,13 @@ func (srv *server) requestWithContext(
 				lastResponse = response
 
 				if optionsHash.ResponseHandler != nil {
-					optionsHash.ResponseHandler(response, request)
+					if err := srv.callResponseHandler(optionsHash.ResponseHandler, response, request); err != nil {
+						if !response.IsSuccess() {
+							_ = tx.Cancel()
+						}
+						errs <- err
+						return
+					}
 				}
 
 				if response.IsProvisional() {
@@ -379,13 +874,16 @@ func (srv *server) requestWithContext(
 
 				// success
 				if response.IsSuccess() {
+					if cachingAuthorizer != nil {
+						cachingAuthorizer.CacheResponse(request, response)
+					}
 					response.SetPrevious(previousMessages)
 					responses <- response
 
 					go func() {
 						for response := range tx.Responses() {
 							if optionsHash.ResponseHandler != nil {
-								optionsHash.ResponseHandler(response, request)
+								_ = srv.callResponseHandler(optionsHash.ResponseHandler, response, request)
 							}
 						}
 					}()
@@ -412,6 +910,10 @@ func (srv *server) requestWithContext(
 				}
 
 				// failed request
+				if cachingAuthorizer != nil {
+					cachingAuthorizer.CacheResponse(request, response)
+				}
+				srv.checkDialogFailure(request, response)
 				response.SetPrevious(previousMessages)
 				errs <- sip.NewRequestError(uint(response.StatusCode()), response.Reason(), request, response)
 
@@ -432,7 +934,9 @@ func (srv *server) requestWithContext(
 }
 
 func (srv *server) prepareRequest(req sip.Request) sip.Request {
+	done := sip.TraceHeaders(req, "gosip.Server")
 	srv.appendAutoHeaders(req)
+	done()
 
 	return req
 }
@@ -442,7 +946,18 @@ func (srv *server) Respond(res sip.Response) (sip.ServerTransaction, error) {
 		return nil, fmt.Errorf("can not send through stopped server")
 	}
 
-	return srv.tx.Respond(srv.prepareResponse(res))
+	res = srv.prepareResponse(res)
+	if key, err := transaction.MakeServerTxKey(res); err == nil {
+		if dtx, ok := srv.deferred.Load(key); ok {
+			tx := dtx.(*deferredTx)
+			if err := tx.Respond(res); err != nil {
+				return nil, err
+			}
+			return tx, nil
+		}
+	}
+
+	return srv.tx.Respond(res)
 }
 
 func (srv *server) RespondOnRequest(
@@ -469,6 +984,21 @@ func (srv *server) Send(msg sip.Message) error {
 		return fmt.Errorf("can not send through stopped server")
 	}
 
+	if req, ok := msg.(sip.Request); ok {
+		// request is sent without transaction but with the same Via and auto headers handling
+		return srv.tx.Send(srv.prepareRequest(req))
+	}
+
+	return srv.send(msg)
+}
+
+// Sends message directly through the transport layer,
+// the transaction layer sends messages with it, so requests must not be passed back to the transaction layer.
+func (srv *server) send(msg sip.Message) error {
+	if !srv.running.IsSet() {
+		return fmt.Errorf("can not send through stopped server")
+	}
+
 	switch m := msg.(type) {
 	case sip.Request:
 		msg = srv.prepareRequest(m)
@@ -480,7 +1010,9 @@ func (srv *server) Send(msg sip.Message) error {
 }
 
 func (srv *server) prepareResponse(res sip.Response) sip.Response {
+	done := sip.TraceHeaders(res, "gosip.Server")
 	srv.appendAutoHeaders(res)
+	done()
 
 	return res
 }
@@ -501,15 +1033,97 @@ func (srv *server) Shutdown() {
 	srv.hwg.Wait()
 }
 
+func (srv *server) Handle(method sip.RequestMethod, pattern string, handler RequestHandler) (*Route, error) {
+	if err := checkMethod(method); err != nil {
+		return nil, err
+	}
+
+	srv.hmu.Lock()
+	defer srv.hmu.Unlock()
+
+	if _, ok := srv.requestHandlers[method]; ok && !srv.routedMethods[method] {
+		return nil, fmt.Errorf("%s requests are handled by the handler registered with OnRequest", method)
+	}
+	route, err := srv.router.Handle(method, pattern, handler)
+	if err != nil {
+		return nil, err
+	}
+	if !srv.routedMethods[method] {
+		srv.requestHandlers[method] = srv.router.ServeSIP
+		srv.handlerOptions[method] = applyHandlerOptions()
+		srv.routedMethods[method] = true
+	}
+
+	return route, nil
+}
+
+func (srv *server) Router() *Router {
+	return srv.router
+}
+
 // OnRequest registers new request callback
-func (srv *server) OnRequest(method sip.RequestMethod, handler RequestHandler) error {
+func (srv *server) OnRequest(method sip.RequestMethod, handler RequestHandler, options ...HandlerOption) error {
+	if err := checkMethod(method); err != nil {
+		return err
+	}
+
 	srv.hmu.Lock()
+	defer srv.hmu.Unlock()
+
+	if srv.routedMethods[method] {
+		return fmt.Errorf("%s requests are dispatched to the router, register the handler with Handle", method)
+	}
 	srv.requestHandlers[method] = handler
-	srv.hmu.Unlock()
+	srv.handlerOptions[method] = applyHandlerOptions(options...)
 
 	return nil
 }
 
+// Extension methods are registered by the application with sip.RegisterMethod,
+// so that the process-wide method registry is not changed behind its back.
+func checkMethod(method sip.RequestMethod) error {
+	if !sip.IsKnownMethod(method) {
+		return fmt.Errorf("unknown method %s, extension methods must be registered with sip.RegisterMethod", method)
+	}
+
+	return nil
+}
+
+func (srv *server) AddTenant(config TenantConfig) (Tenant, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("empty tenant name")
+	}
+
+	t := newTenant(config)
+	if err := srv.tenants.add(t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (srv *server) RemoveTenant(name string) bool {
+	return srv.tenants.remove(name)
+}
+
+func (srv *server) Tenant(name string) (Tenant, bool) {
+	if t, ok := srv.tenants.get(name); ok {
+		return t, true
+	}
+
+	return nil, false
+}
+
+func (srv *server) stampProfile(msg sip.Message) *StampProfile {
+	if srv.stampSelector != nil {
+		if profile := srv.stampSelector(msg); profile != nil {
+			return profile
+		}
+	}
+
+	return srv.stamp
+}
+
 func (srv *server) appendAutoHeaders(msg sip.Message) {
 	autoAppendMethods := map[sip.RequestMethod]bool{
 		sip.INVITE:   true,
@@ -519,13 +1133,19 @@ func (srv *server) appendAutoHeaders(msg sip.Message) {
 		sip.NOTIFY:   true,
 	}
 
+	profile := srv.stampProfile(msg)
+
 	var msgMethod sip.RequestMethod
 	switch m := msg.(type) {
 	case sip.Request:
 		msgMethod = m.Method()
 
-		if hdrs := msg.GetHeaders("User-Agent"); len(hdrs) == 0 {
-			hdr := sip.UserAgentHeader(srv.userAgent)
+		if _, ok := sip.GetMaxForwards(m); !ok {
+			sip.SetMaxForwards(m, srv.maxForwards)
+		}
+
+		if hdrs := msg.GetHeaders("User-Agent"); len(hdrs) == 0 && !profile.Anonymous && profile.UserAgent != "" {
+			hdr := sip.UserAgentHeader(profile.UserAgent)
 			msg.AppendHeader(&hdr)
 		}
 	case sip.Response:
@@ -533,17 +1153,21 @@ func (srv *server) appendAutoHeaders(msg sip.Message) {
 			msgMethod = cseq.MethodName
 		}
 
-		if hdrs := msg.GetHeaders("Server"); len(hdrs) == 0 {
-			hdr := sip.ServerHeader(srv.userAgent)
+		if hdrs := msg.GetHeaders("Server"); len(hdrs) == 0 && !profile.Anonymous && profile.serverName() != "" {
+			hdr := sip.ServerHeader(profile.serverName())
 			msg.AppendHeader(&hdr)
 		}
 	}
 	if len(msgMethod) > 0 {
 		if _, ok := autoAppendMethods[msgMethod]; ok {
 			hdrs := msg.GetHeaders("Allow")
-			if len(hdrs) == 0 {
+			if len(hdrs) == 0 && !profile.NoAllow {
 				allow := make(sip.AllowHeader, 0)
-				for _, method := range srv.getAllowedMethods() {
+				methods := srv.getAllowedMethods()
+				if t, ok := sip.MessageMetadata(msg).Value(tenantKey{}).(*tenant); ok {
+					methods = t.allowedMethods()
+				}
+				for _, method := range methods {
 					allow = append(allow, method)
 				}
 
@@ -552,12 +1176,27 @@ func (srv *server) appendAutoHeaders(msg sip.Message) {
 				}
 			}
 
+			extensions, features := srv.extensions, srv.features
+			if profile.Features != nil {
+				extensions, features = profile.Features.Tags(), profile.Features
+			}
 			hdrs = msg.GetHeaders("Supported")
-			if len(hdrs) == 0 && len(srv.extensions) > 0 {
+			if len(hdrs) == 0 && len(extensions) > 0 && !profile.NoSupported {
 				msg.AppendHeader(&sip.SupportedHeader{
-					Options: srv.extensions,
+					Options: extensions,
 				})
 			}
+
+			if _, ok := msg.(sip.Request); ok && len(msg.GetHeaders("Require")) == 0 {
+				if require := features.RequireHeader(); require != nil {
+					msg.AppendHeader(require)
+				}
+			}
+
+			hdrs = msg.GetHeaders("Allow-Events")
+			if len(hdrs) == 0 && srv.events.Len() > 0 && !profile.NoAllowEvents {
+				msg.AppendHeader(srv.events.AllowEvents())
+			}
 		}
 	}
 
@@ -567,26 +1206,61 @@ func (srv *server) appendAutoHeaders(msg sip.Message) {
 }
 
 func (srv *server) getAllowedMethods() []sip.RequestMethod {
-	methods := []sip.RequestMethod{
-		sip.INVITE,
-		sip.ACK,
-		sip.CANCEL,
+	srv.hmu.RLock()
+	defer srv.hmu.RUnlock()
+
+	return allowedMethods(srv.requestHandlers)
+}
+
+// Returns methods of registered handlers sorted by name. INVITE, ACK and CANCEL are always allowed:
+// INVITE is answered by the server even without handler, ACK and CANCEL are part of the INVITE transaction.
+func allowedMethods(handlers map[sip.RequestMethod]RequestHandler) []sip.RequestMethod {
+	methods := make([]sip.RequestMethod, 0, len(handlers)+3)
+	methods = append(methods, sip.INVITE, sip.ACK, sip.CANCEL)
+	for method := range handlers {
+		if method != sip.INVITE && method != sip.ACK && method != sip.CANCEL {
+			methods = append(methods, method)
+		}
 	}
-	added := map[sip.RequestMethod]bool{
-		sip.INVITE: true,
-		sip.ACK:    true,
-		sip.CANCEL: true,
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i] < methods[j]
+	})
+	return methods
+}
+
+// Checks the request body against media types and codings supported by the handler.
+func supportedBody(req sip.Request, options *HandlerOptions) bool {
+	if len(req.Body()) == 0 {
+		return true
 	}
 
-	srv.hmu.RLock()
-	for method := range srv.requestHandlers {
-		if _, ok := added[method]; !ok {
-			methods = append(methods, method)
+	for _, name := range []string{"Content-Encoding", "e"} {
+		for _, hdr := range req.GetHeaders(name) {
+			for _, coding := range strings.Split(hdr.Value(), ",") {
+				coding = strings.TrimSpace(coding)
+				if coding != "" && !sip.TokenEqual(coding, "identity") && !sip.HasToken(options.AcceptEncodings, coding) {
+					return false
+				}
+			}
 		}
 	}
-	srv.hmu.RUnlock()
 
-	return methods
+	if len(options.AcceptTypes) == 0 {
+		return true
+	}
+	ct, ok := req.ContentType()
+	if !ok {
+		return false
+	}
+	typ := sip.TokenLower(strings.TrimSpace(strings.Split(ct.Value(), ";")[0]))
+	for _, accept := range options.AcceptTypes {
+		accept = sip.TokenLower(accept)
+		if accept == "*/*" || accept == typ ||
+			strings.HasSuffix(accept, "/*") && strings.HasPrefix(typ, accept[:len(accept)-1]) {
+			return true
+		}
+	}
+	return false
 }
 
 type sipTransport struct {
@@ -599,7 +1273,7 @@ func (tp *sipTransport) Messages() <-chan sip.Message {
 }
 
 func (tp *sipTransport) Send(msg sip.Message) error {
-	return tp.srv.Send(msg)
+	return tp.srv.send(msg)
 }
 
 func (tp *sipTransport) IsReliable(network string) bool {
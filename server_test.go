@@ -2,6 +2,7 @@ package gosip_test
 
 import (
 	"context"
+	"errors"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -13,6 +14,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
 	"github.com/ghettovoice/gosip/sip/parser"
 	"github.com/ghettovoice/gosip/testutils"
@@ -133,7 +135,7 @@ var _ = Describe("GoSIP Server", func() {
 		defer close(done)
 
 		var err error
-		client1, _, _, err = ws.Dial(context.Background(), "ws://"+wsLocalTarget.Addr())
+		client1, _, _, err = ws.Dialer{Protocols: []string{"sip"}}.Dial(context.Background(), "ws://"+wsLocalTarget.Addr())
 		Expect(err).ShouldNot(HaveOccurred())
 		defer func() {
 			Expect(client1.Close()).To(BeNil())
@@ -349,3 +351,831 @@ var _ = Describe("GoSIP Server", func() {
 		wg.Wait()
 	}, 3)
 })
+
+var _ = Describe("GoSIP Server unhandled methods", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9003"
+	localTarget := transport.NewTarget("127.0.0.1", 5063)
+	logger := testutils.NewLogrusLogger()
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	messageReq := func() sip.Request {
+		return testutils.Request([]string{
+			"MESSAGE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: unhandled-test",
+			"CSeq: 1 MESSAGE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	}
+
+	It("should answer 405 with registered methods in Allow", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.OnRequest(sip.OPTIONS, func(req sip.Request, tx sip.ServerTransaction) {})).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(405))
+		hdrs := res.GetHeaders("Allow")
+		Expect(hdrs).To(HaveLen(1))
+		Expect(hdrs[0].Value()).To(Equal("ACK, CANCEL, INVITE, OPTIONS"))
+	}, 3)
+
+	It("should answer 501 by policy", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{
+			UnhandledMethod: gosip.RespondNotImplemented,
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(501))
+	}, 3)
+
+	It("should call default handler", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{
+			DefaultHandler: func(req sip.Request, tx sip.ServerTransaction) {
+				Expect(req.Method()).To(Equal(sip.MESSAGE))
+				res := sip.NewResponseFromRequest("", req, 202, "Accepted", "")
+				Expect(tx.Respond(res)).To(Succeed())
+			},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(202))
+	}, 3)
+})
+
+var _ = Describe("GoSIP Server orphan ACKs", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9004"
+	localTarget := transport.NewTarget("127.0.0.1", 5064)
+	logger := testutils.NewLogrusLogger()
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	It("should count orphan ACK and pass it to the callback", func(done Done) {
+		defer close(done)
+
+		acks := make(chan sip.Request, 1)
+		srv = gosip.NewServer(gosip.ServerConfig{
+			OnOrphanAck: func(ack sip.Request) {
+				acks <- ack
+			},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		client := testutils.CreateClient("udp", localTarget.Addr(), clientAddr)
+		defer func() {
+			Expect(client.Close()).To(BeNil())
+		}()
+		ackReq := testutils.Request([]string{
+			"ACK sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>;tag=a6c85cf",
+			"Call-ID: orphan-ack-test",
+			"CSeq: 1 ACK",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+		testutils.WriteToConn(client, []byte(ackReq.String()))
+
+		ack := <-acks
+		Expect(ack.Method()).To(Equal(sip.ACK))
+		callID, ok := ack.CallID()
+		Expect(ok).To(BeTrue())
+		Expect(callID.Value()).To(Equal("orphan-ack-test"))
+		Expect(srv.Stats().OrphanAcks).To(Equal(uint64(1)))
+	}, 3)
+
+	It("should not count ACK of known dialog as orphan", func(done Done) {
+		defer close(done)
+
+		lookups := make(chan sip.Request, 1)
+		srv = gosip.NewServer(gosip.ServerConfig{
+			DialogLookup: func(req sip.Request) bool {
+				lookups <- req
+				return true
+			},
+			OnOrphanAck: func(ack sip.Request) {
+				Fail("ACK of known dialog passed to orphan ACK callback")
+			},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		client := testutils.CreateClient("udp", localTarget.Addr(), clientAddr)
+		defer func() {
+			Expect(client.Close()).To(BeNil())
+		}()
+		ackReq := testutils.Request([]string{
+			"ACK sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>;tag=a6c85cf",
+			"Call-ID: dialog-ack-test",
+			"CSeq: 1 ACK",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+		testutils.WriteToConn(client, []byte(ackReq.String()))
+
+		<-lookups
+		Consistently(func() uint64 {
+			return srv.Stats().OrphanAcks
+		}, 200*time.Millisecond).Should(BeZero())
+	}, 3)
+})
+
+var _ = Describe("GoSIP Server strict dialog validation", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9005"
+	localTarget := transport.NewTarget("127.0.0.1", 5065)
+	logger := testutils.NewLogrusLogger()
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	byeReq := func() sip.Request {
+		return testutils.Request([]string{
+			"BYE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>;tag=a6c85cf",
+			"Call-ID: strict-dialog-test",
+			"CSeq: 2 BYE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	}
+
+	It("should reject request of unknown dialog with 481", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{
+			DialogLookup: func(req sip.Request) bool {
+				return false
+			},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.OnRequest(sip.BYE, func(req sip.Request, tx sip.ServerTransaction) {
+			Fail("handler called for request of unknown dialog")
+		})).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, byeReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(481))
+	}, 3)
+
+	It("should continue handling when unknown dialog hook allows it", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{
+			DialogLookup: func(req sip.Request) bool {
+				return false
+			},
+			OnUnknownDialog: func(req sip.Request) bool {
+				return true
+			},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.OnRequest(sip.BYE, func(req sip.Request, tx sip.ServerTransaction) {
+			Expect(tx.Respond(sip.NewResponseFromRequest("", req, 200, "OK", ""))).To(Succeed())
+		})).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, byeReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(200))
+	}, 3)
+})
+
+// Sends request over UDP from the client address and waits for response.
+func sendAndReceive(srvAddr, clientAddr string, req sip.Request, logger log.Logger) sip.Response {
+	conn, err := net.ListenPacket("udp", clientAddr)
+	Expect(err).ShouldNot(HaveOccurred())
+	defer conn.Close()
+
+	raddr, err := net.ResolveUDPAddr("udp", srvAddr)
+	Expect(err).ShouldNot(HaveOccurred())
+	_, err = conn.WriteTo([]byte(req.String()), raddr)
+	Expect(err).ShouldNot(HaveOccurred())
+
+	buf := make([]byte, transport.MTU)
+	n, _, err := conn.ReadFrom(buf)
+	Expect(err).ShouldNot(HaveOccurred())
+	msg, err := parser.ParseMessage(buf[:n], logger)
+	Expect(err).ShouldNot(HaveOccurred())
+	res, ok := msg.(sip.Response)
+	Expect(ok).Should(BeTrue())
+	return res
+}
+
+var _ = Describe("GoSIP Server unsupported bodies", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9008"
+	localTarget := transport.NewTarget("127.0.0.1", 5068)
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		srv = gosip.NewServer(gosip.ServerConfig{}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.OnRequest(sip.MESSAGE, func(req sip.Request, tx sip.ServerTransaction) {
+			res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+			Expect(tx.Respond(res)).To(Succeed())
+		}, gosip.WithAcceptTypes("text/plain", "application/im-iscomposing+xml"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	messageReq := func(headers ...string) sip.Request {
+		lines := []string{
+			"MESSAGE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: unsupported-body-test",
+			"CSeq: 1 MESSAGE",
+		}
+		lines = append(lines, headers...)
+		return testutils.Request(append(lines, "Content-Length: 5", "", "Hello"))
+	}
+
+	It("should pass request with supported body to the handler", func(done Done) {
+		defer close(done)
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq("Content-Type: Text/Plain;charset=utf-8"), logger)
+		Expect(int(res.StatusCode())).To(Equal(200))
+	}, 3)
+
+	It("should answer 415 with Accept on unsupported media type", func(done Done) {
+		defer close(done)
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq("Content-Type: text/html"), logger)
+		Expect(int(res.StatusCode())).To(Equal(415))
+		hdrs := res.GetHeaders("Accept")
+		Expect(hdrs).To(HaveLen(1))
+		Expect(hdrs[0].Value()).To(Equal("text/plain, application/im-iscomposing+xml"))
+		hdrs = res.GetHeaders("Accept-Encoding")
+		Expect(hdrs).To(HaveLen(1))
+		Expect(hdrs[0].Value()).To(Equal("identity"))
+	}, 3)
+
+	It("should answer 415 with Accept-Encoding on unsupported coding", func(done Done) {
+		defer close(done)
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq("Content-Type: text/plain", "Content-Encoding: gzip"), logger)
+		Expect(int(res.StatusCode())).To(Equal(415))
+		hdrs := res.GetHeaders("Accept-Encoding")
+		Expect(hdrs).To(HaveLen(1))
+		Expect(hdrs[0].Value()).To(Equal("identity"))
+	}, 3)
+})
+
+var _ = Describe("GoSIP Server OPTIONS responder", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9009"
+	localTarget := transport.NewTarget("127.0.0.1", 5069)
+	quietTarget := transport.NewTarget("127.0.0.1", 5071)
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		srv = gosip.NewServer(gosip.ServerConfig{
+			Extensions:      []string{"100rel", "timer"},
+			AnswerOptions:   true,
+			AcceptLanguages: []string{"en", "de"},
+			AllowEvents:     []string{"presence", "dialog"},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.Listen("udp", quietTarget.Addr(), gosip.OptionsResponder(false))).To(Succeed())
+		Expect(srv.OnRequest(sip.INVITE, func(req sip.Request, tx sip.ServerTransaction) {},
+			gosip.WithAcceptTypes("application/sdp"), gosip.WithAcceptEncodings("gzip"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	optionsReq := func() sip.Request {
+		return testutils.Request([]string{
+			"OPTIONS sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: options-responder-test",
+			"CSeq: 1 OPTIONS",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	}
+
+	It("should answer OPTIONS with server capabilities", func(done Done) {
+		defer close(done)
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, optionsReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(200))
+		for name, value := range map[string]string{
+			"Allow":           "ACK, CANCEL, INVITE, OPTIONS",
+			"Supported":       "100rel, timer",
+			"Accept":          "application/sdp",
+			"Accept-Encoding": "identity, gzip",
+			"Accept-Language": "en, de",
+			"Allow-Events":    "presence, dialog",
+		} {
+			hdrs := res.GetHeaders(name)
+			Expect(hdrs).To(HaveLen(1), name)
+			Expect(hdrs[0].Value()).To(Equal(value), name)
+		}
+	}, 3)
+
+	It("should not answer OPTIONS on the listener with disabled responder", func(done Done) {
+		defer close(done)
+
+		res := sendAndReceive(quietTarget.Addr(), clientAddr, optionsReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(405))
+	}, 3)
+
+	It("should pass OPTIONS to the registered handler", func(done Done) {
+		defer close(done)
+
+		Expect(srv.OnRequest(sip.OPTIONS, func(req sip.Request, tx sip.ServerTransaction) {
+			res := sip.NewResponseFromRequest("", req, 202, "Accepted", "")
+			Expect(tx.Respond(res)).To(Succeed())
+		})).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, optionsReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(202))
+	}, 3)
+})
+
+var _ = Describe("GoSIP Server event packages", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9010"
+	localTarget := transport.NewTarget("127.0.0.1", 5072)
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		srv = gosip.NewServer(gosip.ServerConfig{
+			AllowEvents: []string{"presence"},
+		}, nil, nil, logger)
+		srv.EventPackages().Register("dialog")
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.OnRequest(sip.SUBSCRIBE, func(req sip.Request, tx sip.ServerTransaction) {
+			res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+			Expect(tx.Respond(res)).To(Succeed())
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	subscribeReq := func(event string) sip.Request {
+		return testutils.Request([]string{
+			"SUBSCRIBE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: event-packages-test",
+			"CSeq: 1 SUBSCRIBE",
+			"Event: " + event,
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	}
+
+	It("should pass request of registered event package to the handler", func(done Done) {
+		defer close(done)
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, subscribeReq("dialog;id=1"), logger)
+		Expect(int(res.StatusCode())).To(Equal(200))
+	}, 3)
+
+	It("should answer 489 with Allow-Events on unknown event package", func(done Done) {
+		defer close(done)
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, subscribeReq("message-summary"), logger)
+		Expect(int(res.StatusCode())).To(Equal(489))
+		hdrs := res.GetHeaders("Allow-Events")
+		Expect(hdrs).To(HaveLen(1))
+		Expect(hdrs[0].Value()).To(Equal("presence, dialog"))
+	}, 3)
+})
+
+var _ = Describe("GoSIP Server Max-Forwards", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9012"
+	localTarget := transport.NewTarget("127.0.0.1", 5074)
+	logger := testutils.NewLogrusLogger()
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	optionsReq := func(toTag string) sip.Request {
+		return testutils.Request([]string{
+			"OPTIONS sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>" + toTag,
+			"Call-ID: max-forwards-test",
+			"CSeq: 1 OPTIONS",
+			"Max-Forwards: 0",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	}
+
+	It("should answer hop probe", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{AnswerMaxForwardsProbe: true}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, optionsReq(""), logger)
+		Expect(int(res.StatusCode())).To(Equal(200))
+	}, 3)
+
+	It("should validate dialog of hop probe before answering it", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{
+			AnswerMaxForwardsProbe: true,
+			DialogLookup: func(req sip.Request) bool {
+				return false
+			},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, optionsReq(";tag=a6c85cf"), logger)
+		Expect(int(res.StatusCode())).To(Equal(481))
+	}, 3)
+
+	It("should answer 483 instead of calling forwarding handler", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.OnRequest(sip.OPTIONS, func(req sip.Request, tx sip.ServerTransaction) {
+			Fail("forwarding handler called for request with Max-Forwards 0")
+		}, gosip.WithForwarding())).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, optionsReq(""), logger)
+		Expect(int(res.StatusCode())).To(Equal(483))
+	}, 3)
+
+	It("should insert Max-Forwards into outgoing requests", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{MaxForwards: 10}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		conn, err := net.ListenPacket("udp", clientAddr)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		req := testutils.Request([]string{
+			"MESSAGE sip:alice@" + clientAddr + " SIP/2.0",
+			"From: \"Bob\" <sip:bob@far-far-away.com>;tag=a6c85cf",
+			"To: \"Alice\" <sip:alice@wonderland.com>",
+			"Call-ID: max-forwards-test",
+			"CSeq: 1 MESSAGE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+		Expect(srv.Send(req)).To(Succeed())
+
+		buf := make([]byte, transport.MTU)
+		n, _, err := conn.ReadFrom(buf)
+		Expect(err).ShouldNot(HaveOccurred())
+		msg, err := parser.ParseMessage(buf[:n], logger)
+		Expect(err).ShouldNot(HaveOccurred())
+		maxForwards, ok := sip.GetMaxForwards(msg)
+		Expect(ok).To(BeTrue())
+		Expect(maxForwards).To(Equal(sip.MaxForwards(10)))
+	}, 3)
+})
+
+var _ = Describe("GoSIP Server stamp profiles", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9013"
+	localTarget := transport.NewTarget("127.0.0.1", 5075)
+	logger := testutils.NewLogrusLogger()
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	messageReq := func(extra ...string) sip.Request {
+		lines := []string{
+			"MESSAGE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: stamp-test",
+			"CSeq: 1 MESSAGE",
+		}
+		lines = append(lines, extra...)
+		return testutils.Request(append(lines, "Content-Length: 0", "", ""))
+	}
+	outgoingReq := func(extra ...string) sip.Request {
+		lines := []string{
+			"OPTIONS sip:alice@" + clientAddr + " SIP/2.0",
+			"From: \"Bob\" <sip:bob@far-far-away.com>;tag=a6c85cf",
+			"To: \"Alice\" <sip:alice@wonderland.com>",
+			"Call-ID: stamp-test",
+			"CSeq: 1 OPTIONS",
+		}
+		lines = append(lines, extra...)
+		return testutils.Request(append(lines, "Content-Length: 0", "", ""))
+	}
+	// Sends the request from the server and returns it as received by the client.
+	sendFromServer := func(req sip.Request) sip.Message {
+		conn, err := net.ListenPacket("udp", clientAddr)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		Expect(srv.Send(req)).To(Succeed())
+
+		buf := make([]byte, transport.MTU)
+		n, _, err := conn.ReadFrom(buf)
+		Expect(err).ShouldNot(HaveOccurred())
+		msg, err := parser.ParseMessage(buf[:n], logger)
+		Expect(err).ShouldNot(HaveOccurred())
+		return msg
+	}
+	headerValues := func(msg sip.Message, name string) []string {
+		var values []string
+		for _, hdr := range msg.GetHeaders(name) {
+			values = append(values, hdr.Value())
+		}
+		return values
+	}
+
+	It("should stamp messages with the default profile", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(headerValues(res, "Server")).To(Equal([]string{"GoSIP"}))
+
+		req := sendFromServer(outgoingReq())
+		Expect(headerValues(req, "User-Agent")).To(Equal([]string{"GoSIP"}))
+	}, 3)
+
+	It("should stamp messages with the configured profile", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{
+			Stamp: &gosip.StampProfile{UserAgent: "Phone/1.0", Server: "PBX/1.0"},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(headerValues(res, "Server")).To(Equal([]string{"PBX/1.0"}))
+
+		req := sendFromServer(outgoingReq())
+		Expect(headerValues(req, "User-Agent")).To(Equal([]string{"Phone/1.0"}))
+	}, 3)
+
+	It("should stamp messages with the profile selected per message", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{
+			StampSelector: func(msg sip.Message) *gosip.StampProfile {
+				if _, ok := msg.(sip.Response); ok {
+					return &gosip.StampProfile{Anonymous: true}
+				}
+				if callID, ok := msg.CallID(); ok && callID.Value() == "trunk" {
+					return &gosip.StampProfile{UserAgent: "Trunk/2.0"}
+				}
+				return nil
+			},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(res.GetHeaders("Server")).To(BeEmpty())
+
+		req := outgoingReq()
+		req.RemoveHeader("Call-ID")
+		callID := sip.CallID("trunk")
+		req.AppendHeader(&callID)
+		Expect(headerValues(sendFromServer(req), "User-Agent")).To(Equal([]string{"Trunk/2.0"}))
+
+		Expect(headerValues(sendFromServer(outgoingReq()), "User-Agent")).To(Equal([]string{"GoSIP"}))
+	}, 3)
+
+	It("should keep existing User-Agent and Server headers", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{UserAgent: "Phone/1.0"}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.OnRequest(sip.MESSAGE, func(req sip.Request, tx sip.ServerTransaction) {
+			res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+			hdr := sip.ServerHeader("Custom/3.0")
+			res.AppendHeader(&hdr)
+			Expect(tx.Respond(res)).To(Succeed())
+		})).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(headerValues(res, "Server")).To(Equal([]string{"Custom/3.0"}))
+
+		req := sendFromServer(outgoingReq("User-Agent: Custom/3.0"))
+		Expect(headerValues(req, "User-Agent")).To(Equal([]string{"Custom/3.0"}))
+	}, 3)
+})
+
+var _ = Describe("GoSIP Server panics", func() {
+	var (
+		srv    gosip.Server
+		panics chan *gosip.PanicError
+	)
+
+	clientAddr := "127.0.0.1:9014"
+	localTarget := transport.NewTarget("127.0.0.1", 5076)
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		panics = make(chan *gosip.PanicError, 1)
+	})
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	messageReq := func() sip.Request {
+		return testutils.Request([]string{
+			"MESSAGE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: panics-test",
+			"CSeq: 1 MESSAGE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	}
+
+	It("should answer 500 on request of panicked handler", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{
+			OnPanic: func(err *gosip.PanicError) {
+				panics <- err
+			},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.OnRequest(sip.MESSAGE, func(req sip.Request, tx sip.ServerTransaction) {
+			panic("broken handler")
+		})).To(Succeed())
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq(), logger)
+		Expect(int(res.StatusCode())).To(Equal(500))
+
+		var err *gosip.PanicError
+		Eventually(panics).Should(Receive(&err))
+		Expect(err.Callback).To(Equal("MESSAGE handler"))
+		Expect(err.Recovered).To(Equal("broken handler"))
+		Expect(errors.Is(err, gosip.ErrCallbackPanic)).To(BeTrue())
+	}, 3)
+
+	It("should abort sending if pre-send hook panicked", func(done Done) {
+		defer close(done)
+
+		srv = gosip.NewServer(gosip.ServerConfig{
+			OnPreSend: func(msg sip.Message, network string, target *transport.Target) error {
+				panic("broken hook")
+			},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+
+		req := testutils.Request([]string{
+			"MESSAGE sip:alice@" + clientAddr + " SIP/2.0",
+			"From: \"Bob\" <sip:bob@far-far-away.com>;tag=a6c85cf",
+			"To: \"Alice\" <sip:alice@wonderland.com>",
+			"Call-ID: panics-test",
+			"CSeq: 1 MESSAGE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+		err := srv.Send(req)
+		Expect(errors.Is(err, gosip.ErrCallbackPanic)).To(BeTrue())
+	}, 3)
+})
+
+var _ = Describe("GoSIP Server extensions", func() {
+	var srv gosip.Server
+
+	clientAddr := "127.0.0.1:9015"
+	localTarget := transport.NewTarget("127.0.0.1", 5077)
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		srv = gosip.NewServer(gosip.ServerConfig{
+			Extensions: []string{sip.OptionPath},
+			Features:   &sip.Features{Reliable100: true, Timer: true, Required: []string{sip.OptionTimer}},
+		}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+		Expect(srv.OnRequest(sip.MESSAGE, func(req sip.Request, tx sip.ServerTransaction) {
+			res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+			Expect(tx.Respond(res)).To(Succeed())
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	messageReq := func(headers ...string) sip.Request {
+		lines := []string{
+			"MESSAGE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: extensions-test",
+			"CSeq: 1 MESSAGE",
+		}
+		lines = append(lines, headers...)
+		return testutils.Request(append(lines, "Content-Length: 0", "", ""))
+	}
+
+	It("should pass request requiring supported extensions to the handler", func(done Done) {
+		defer close(done)
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq("Require: 100rel, Path"), logger)
+		Expect(int(res.StatusCode())).To(Equal(200))
+	}, 3)
+
+	It("should answer 420 with Unsupported on request requiring unknown extensions", func(done Done) {
+		defer close(done)
+
+		res := sendAndReceive(localTarget.Addr(), clientAddr, messageReq("Require: 100rel, foo", "Require: bar"), logger)
+		Expect(int(res.StatusCode())).To(Equal(420))
+		hdrs := res.GetHeaders("Unsupported")
+		Expect(hdrs).To(HaveLen(1))
+		Expect(hdrs[0].Value()).To(Equal("foo, bar"))
+	}, 3)
+
+	It("should stamp outgoing requests with Supported and Require of the features", func(done Done) {
+		defer close(done)
+
+		conn, err := net.ListenPacket("udp", clientAddr)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		Expect(srv.Send(testutils.Request([]string{
+			"OPTIONS sip:alice@" + clientAddr + " SIP/2.0",
+			"From: \"Bob\" <sip:bob@far-far-away.com>;tag=a6c85cf",
+			"To: \"Alice\" <sip:alice@wonderland.com>",
+			"Call-ID: extensions-test",
+			"CSeq: 1 OPTIONS",
+			"Content-Length: 0",
+			"",
+			"",
+		}))).To(Succeed())
+
+		buf := make([]byte, transport.MTU)
+		n, _, err := conn.ReadFrom(buf)
+		Expect(err).ShouldNot(HaveOccurred())
+		req, err := parser.ParseMessage(buf[:n], logger)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(req.GetHeaders("Supported")).To(HaveLen(1))
+		Expect(req.GetHeaders("Supported")[0].Value()).To(Equal("100rel, timer, path"))
+		Expect(req.GetHeaders("Require")).To(HaveLen(1))
+		Expect(req.GetHeaders("Require")[0].Value()).To(Equal("timer"))
+	}, 3)
+})
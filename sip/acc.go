@@ -0,0 +1,196 @@
+package sip
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// AccTimeLayout is the layout of the record time, the same as the 'time' column of the acc module.
+const AccTimeLayout = "2006-01-02 15:04:05"
+
+// AccColumns are the record fields in order of the CSV export. Names match the columns of Kamailio
+// and OpenSIPS acc module with CDR extra fields, so existing pipelines can consume the export as is.
+var AccColumns = []string{
+	"method",
+	"from_tag",
+	"to_tag",
+	"callid",
+	"sip_code",
+	"sip_reason",
+	"time",
+	"src_ip",
+	"dst_ip",
+	"from_uri",
+	"to_uri",
+	"setuptime",
+	"duration",
+}
+
+// AccRecord is an accounting record of the transaction completed with the final response.
+type AccRecord struct {
+	Method    RequestMethod
+	FromTag   string
+	ToTag     string
+	CallID    string
+	SipCode   StatusCode
+	SipReason string
+	// Time is the time of the final response.
+	Time time.Time
+	// SrcIP and DstIP are the request source and destination IP, empty if unknown.
+	SrcIP   string
+	DstIP   string
+	FromUri string
+	ToUri   string
+	// SetupTime is the time from the request to the final response.
+	SetupTime time.Duration
+	// Duration is the call time from 2xx on INVITE to BYE, zero for other transactions and calls without BYE.
+	Duration time.Duration
+}
+
+// Values returns record fields formatted in order of AccColumns, durations are in whole seconds.
+func (rec AccRecord) Values() []string {
+	return []string{
+		string(rec.Method),
+		rec.FromTag,
+		rec.ToTag,
+		rec.CallID,
+		strconv.Itoa(int(rec.SipCode)),
+		rec.SipReason,
+		rec.Time.Format(AccTimeLayout),
+		rec.SrcIP,
+		rec.DstIP,
+		rec.FromUri,
+		rec.ToUri,
+		strconv.FormatInt(int64(rec.SetupTime/time.Second), 10),
+		strconv.FormatInt(int64(rec.Duration/time.Second), 10),
+	}
+}
+
+// MarshalJSON renders the record as an object with AccColumns keys,
+// code and durations are numbers.
+func (rec AccRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Method    string `json:"method"`
+		FromTag   string `json:"from_tag"`
+		ToTag     string `json:"to_tag"`
+		CallID    string `json:"callid"`
+		SipCode   int    `json:"sip_code"`
+		SipReason string `json:"sip_reason"`
+		Time      string `json:"time"`
+		SrcIP     string `json:"src_ip"`
+		DstIP     string `json:"dst_ip"`
+		FromUri   string `json:"from_uri"`
+		ToUri     string `json:"to_uri"`
+		SetupTime int64  `json:"setuptime"`
+		Duration  int64  `json:"duration"`
+	}{
+		string(rec.Method),
+		rec.FromTag,
+		rec.ToTag,
+		rec.CallID,
+		int(rec.SipCode),
+		rec.SipReason,
+		rec.Time.Format(AccTimeLayout),
+		rec.SrcIP,
+		rec.DstIP,
+		rec.FromUri,
+		rec.ToUri,
+		int64(rec.SetupTime / time.Second),
+		int64(rec.Duration / time.Second),
+	})
+}
+
+// AccRecords builds accounting records of the transactions recorded in the history.
+// A record is made for each request answered with a final response, the same as the acc module
+// does on the final reply. ACK has no response and CANCEL is accounted as any other request.
+func (history *DialogHistory) AccRecords() []AccRecord {
+	type txKey struct {
+		seq    uint32
+		method RequestMethod
+	}
+
+	entries := history.Entries()
+	requests := make(map[txKey]DialogHistoryEntry)
+	records := make([]AccRecord, 0)
+	// record of 2xx on INVITE waiting for BYE
+	call := -1
+	for _, entry := range entries {
+		summary := entry.summary
+		key := txKey{summary.seq, summary.method}
+		if summary.request {
+			if summary.method == BYE && call >= 0 {
+				records[call].Duration = entry.Time.Sub(records[call].Time)
+				call = -1
+			}
+			if _, ok := requests[key]; !ok {
+				requests[key] = entry
+			}
+			continue
+		}
+
+		req, ok := requests[key]
+		if !ok || summary.statusCode < 200 {
+			continue
+		}
+		delete(requests, key)
+
+		records = append(records, AccRecord{
+			Method:    summary.method,
+			FromTag:   summary.fromTag,
+			ToTag:     summary.toTag,
+			CallID:    summary.callID,
+			SipCode:   summary.statusCode,
+			SipReason: summary.reason,
+			Time:      entry.Time,
+			SrcIP:     addrIP(req.Source),
+			DstIP:     addrIP(req.Destination),
+			FromUri:   summary.fromUri,
+			ToUri:     summary.toUri,
+			SetupTime: entry.Time.Sub(req.Time),
+		})
+		if summary.method == INVITE && summary.statusCode < 300 {
+			call = len(records) - 1
+		}
+	}
+	return records
+}
+
+// Returns host of the transport address.
+func addrIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// WriteAccCSV writes records as CSV lines, the first line is AccColumns if header is true.
+func WriteAccCSV(w io.Writer, records []AccRecord, header bool) error {
+	writer := csv.NewWriter(w)
+	if header {
+		if err := writer.Write(AccColumns); err != nil {
+			return err
+		}
+	}
+	for _, rec := range records {
+		if err := writer.Write(rec.Values()); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteAccJSON writes records as JSON objects separated by newlines.
+func WriteAccJSON(w io.Writer, records []AccRecord) error {
+	encoder := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := encoder.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package sip_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestDialogHistoryAccRecords(t *testing.T) {
+	history := sip.NewDialogHistory(10, 0)
+
+	invite := dialogInvite(t)
+	invite.SetSource("192.0.2.1:5060")
+	invite.SetDestination("192.0.2.4:5060")
+	history.Add(invite, true)
+	history.Add(dialogResponse(t, "180 Ringing"), false)
+	history.Add(dialogResponse(t, "200 OK"), false)
+	history.Add(parseDialogMessage(t,
+		"ACK sip:bob@192.0.2.4 SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bKnashds9",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>;tag=a6c85cf",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 314159 ACK",
+	), true)
+	bye := parseDialogMessage(t,
+		"BYE sip:bob@192.0.2.4 SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bKnashds10",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>;tag=a6c85cf",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 314160 BYE",
+	).(sip.Request)
+	history.Add(bye, true)
+	history.Add(sip.NewResponseFromRequest("", bye, 200, "OK", ""), false)
+
+	records := history.AccRecords()
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d: %v", len(records), records)
+	}
+	rec := records[0]
+	if rec.Method != sip.INVITE || rec.SipCode != 200 || rec.SipReason != "OK" ||
+		rec.FromTag != "1928301774" || rec.ToTag != "a6c85cf" || rec.CallID != "a84b4c76e66710" ||
+		rec.FromUri != "sip:alice@atlanta.com" || rec.ToUri != "sip:bob@biloxi.com" ||
+		rec.SrcIP != "192.0.2.1" || rec.DstIP != "192.0.2.4" {
+		t.Errorf("unexpected INVITE record %+v", rec)
+	}
+	entries := history.Entries()
+	if rec.SetupTime != entries[2].Time.Sub(entries[0].Time) || rec.Duration != entries[4].Time.Sub(entries[2].Time) {
+		t.Errorf("unexpected INVITE record times %+v", rec)
+	}
+	if rec := records[1]; rec.Method != sip.BYE || rec.SipCode != 200 || rec.Duration != 0 {
+		t.Errorf("unexpected BYE record %+v", rec)
+	}
+
+	var buf bytes.Buffer
+	if err := sip.WriteAccCSV(&buf, records, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || lines[0] != strings.Join(sip.AccColumns, ",") {
+		t.Fatalf("unexpected CSV output:\n%s", buf.String())
+	}
+	expected := "INVITE,1928301774,a6c85cf,a84b4c76e66710,200,OK," + rec.Time.Format(sip.AccTimeLayout) +
+		",192.0.2.1,192.0.2.4,sip:alice@atlanta.com,sip:bob@biloxi.com,0,0"
+	if lines[1] != expected {
+		t.Errorf("expected CSV record %q, got %q", expected, lines[1])
+	}
+
+	buf.Reset()
+	if err := sip.WriteAccJSON(&buf, records); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected JSON output:\n%s", buf.String())
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &obj); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(obj) != len(sip.AccColumns) || obj["method"] != "INVITE" || obj["sip_code"] != float64(200) ||
+		obj["callid"] != "a84b4c76e66710" || obj["duration"] != float64(0) {
+		t.Errorf("unexpected JSON record %v", obj)
+	}
+}
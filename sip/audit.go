@@ -0,0 +1,197 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EscapeIssueKind is a kind of escaping problem found by the audit.
+type EscapeIssueKind int
+
+const (
+	// EscapeMissing reports character that must be escaped but appears raw.
+	EscapeMissing EscapeIssueKind = iota
+	// EscapeUnnecessary reports escaped character that is allowed raw in the component - RFC 3261 19.1.2.
+	EscapeUnnecessary
+	// EscapeMalformed reports '%' not followed by two hex digits.
+	EscapeMalformed
+)
+
+func (kind EscapeIssueKind) String() string {
+	switch kind {
+	case EscapeMissing:
+		return "missing escape"
+	case EscapeUnnecessary:
+		return "unnecessary escape"
+	case EscapeMalformed:
+		return "malformed escape"
+	default:
+		return "unknown"
+	}
+}
+
+// EscapeIssue describes character of URI component that violates escaping rules of RFC 3261 25.1.
+type EscapeIssue struct {
+	Kind EscapeIssueKind
+	// Location is where the URI was found, e.g. "Request-URI" or header name, empty for AuditUri.
+	Location string
+	// Component is a URI part: "user", "password", "host", "param" or "header".
+	Component string
+	// Value is the raw component value and Offset is the issue position in it.
+	Value  string
+	Offset int
+}
+
+func (issue EscapeIssue) String() string {
+	location := issue.Location
+	if location != "" {
+		location += " "
+	}
+	return fmt.Sprintf("sip.EscapeIssue<%s%s '%s' at %d: %s>", location, issue.Component, issue.Value, issue.Offset, issue.Kind)
+}
+
+const (
+	uriMarkChars       = "-_.!~*'()"
+	userUnreservedSet  = "&=+$,;?/"
+	passUnreservedSet  = "&=+$,"
+	paramUnreservedSet = "[]/:&+$"
+	hnvUnreservedSet   = "[]/?:+$"
+)
+
+// AuditUri scans raw SIP URI and reports characters that must be escaped but appear raw,
+// unnecessary and malformed escapes. It is intended for tests and diagnostics of interoperability issues.
+func AuditUri(raw string) []EscapeIssue {
+	issues := make([]EscapeIssue, 0)
+	if raw == "*" {
+		return issues
+	}
+
+	rest := raw
+	for _, scheme := range []string{"sips:", "sip:"} {
+		if len(rest) >= len(scheme) && TokenEqual(rest[:len(scheme)], scheme) {
+			rest = rest[len(scheme):]
+			break
+		}
+	}
+
+	if at := strings.LastIndex(rest, "@"); at != -1 {
+		userinfo := rest[:at]
+		rest = rest[at+1:]
+
+		user, password := userinfo, ""
+		hasPassword := false
+		if i := strings.Index(userinfo, ":"); i != -1 {
+			user, password, hasPassword = userinfo[:i], userinfo[i+1:], true
+		}
+		issues = auditComponent(issues, "user", user, userUnreservedSet)
+		if hasPassword {
+			issues = auditComponent(issues, "password", password, passUnreservedSet)
+		}
+	}
+
+	var headers string
+	if i := strings.Index(rest, "?"); i != -1 {
+		rest, headers = rest[:i], rest[i+1:]
+	}
+
+	parts := strings.Split(rest, ";")
+	issues = auditHost(issues, parts[0])
+	for _, param := range parts[1:] {
+		issues = auditComponent(issues, "param", param, paramUnreservedSet+"=")
+	}
+	if headers != "" {
+		for _, header := range strings.Split(headers, "&") {
+			issues = auditComponent(issues, "header", header, hnvUnreservedSet+"=")
+		}
+	}
+
+	return issues
+}
+
+// AuditMessage renders URIs of the message (Request-URI and address headers) and audits them with AuditUri.
+// Since parsed values are stored unescaped, it checks escaping that the message would be sent with.
+func AuditMessage(msg Message) []EscapeIssue {
+	issues := make([]EscapeIssue, 0)
+	add := func(location string, uri Uri) {
+		if uri == nil {
+			return
+		}
+		for _, issue := range AuditUri(uri.String()) {
+			issue.Location = location
+			issues = append(issues, issue)
+		}
+	}
+
+	if req, ok := msg.(Request); ok {
+		add("Request-URI", req.Recipient())
+	}
+	for _, hdr := range msg.Headers() {
+		switch h := hdr.(type) {
+		case *FromHeader:
+			add(h.Name(), h.Address)
+		case *ToHeader:
+			add(h.Name(), h.Address)
+		case *ContactHeader:
+			add(h.Name(), h.Address)
+		case *RouteHeader:
+			for _, uri := range h.Addresses {
+				add(h.Name(), uri)
+			}
+		case *RecordRouteHeader:
+			for _, uri := range h.Addresses {
+				add(h.Name(), uri)
+			}
+		}
+	}
+
+	return issues
+}
+
+func auditComponent(issues []EscapeIssue, component, value, allowed string) []EscapeIssue {
+	isAllowed := func(c byte) bool {
+		return isAlphaNum(c) || strings.IndexByte(uriMarkChars, c) != -1 || strings.IndexByte(allowed, c) != -1
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c != '%' {
+			if !isAllowed(c) {
+				issues = append(issues, EscapeIssue{Kind: EscapeMissing, Component: component, Value: value, Offset: i})
+			}
+			continue
+		}
+
+		if i+2 >= len(value) || !ishex(value[i+1]) || !ishex(value[i+2]) {
+			issues = append(issues, EscapeIssue{Kind: EscapeMalformed, Component: component, Value: value, Offset: i})
+			continue
+		}
+		// '=' separates parameter name and value, so escaped '=' is meaningful there
+		decoded := unhex(value[i+1])<<4 | unhex(value[i+2])
+		if isAllowed(decoded) && !(decoded == '=' && (component == "param" || component == "header")) {
+			issues = append(issues, EscapeIssue{Kind: EscapeUnnecessary, Component: component, Value: value, Offset: i})
+		}
+		i += 2
+	}
+
+	return issues
+}
+
+func auditHost(issues []EscapeIssue, hostport string) []EscapeIssue {
+	for i := 0; i < len(hostport); i++ {
+		c := hostport[i]
+		if isAlphaNum(c) || strings.IndexByte("-.:[]", c) != -1 {
+			continue
+		}
+		// hosts can't be escaped - RFC 3261 25.1
+		kind := EscapeMissing
+		if c == '%' {
+			kind = EscapeMalformed
+		}
+		issues = append(issues, EscapeIssue{Kind: kind, Component: "host", Value: hostport, Offset: i})
+	}
+	return issues
+}
+
+func isAlphaNum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
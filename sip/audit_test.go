@@ -0,0 +1,64 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestAuditUri(t *testing.T) {
+	type issue struct {
+		kind      sip.EscapeIssueKind
+		component string
+		offset    int
+	}
+
+	cases := []struct {
+		uri    string
+		issues []issue
+	}{
+		{"sip:alice;ext=1?x/y@example.com;transport=tcp;lr?subject=hi%20there", nil},
+		{"sips:alice%40home:pa%3Ass@[::1]:5061", nil},
+		{"*", nil},
+		{"sip:alice bob@example.com", []issue{{sip.EscapeMissing, "user", 5}}},
+		{"sip:%61lice@example.com", []issue{{sip.EscapeUnnecessary, "user", 0}}},
+		{"sip:alice%2@example.com", []issue{{sip.EscapeMalformed, "user", 5}}},
+		{"sip:alice:p@ss@example.com", []issue{{sip.EscapeMissing, "password", 1}}},
+		{"sip:example.com;foo=b\"r", []issue{{sip.EscapeMissing, "param", 5}}},
+		{"sip:example.com;foo=a%3Db", nil},
+		{"sip:exam%70le.com", []issue{{sip.EscapeMalformed, "host", 4}}},
+		{"sip:example.com?subject=a b", []issue{{sip.EscapeMissing, "header", 9}}},
+	}
+
+	for _, c := range cases {
+		issues := sip.AuditUri(c.uri)
+		if len(issues) != len(c.issues) {
+			t.Errorf("URI %s: expected %d issues, got %v", c.uri, len(c.issues), issues)
+			continue
+		}
+		for i, expected := range c.issues {
+			if issues[i].Kind != expected.kind || issues[i].Component != expected.component || issues[i].Offset != expected.offset {
+				t.Errorf("URI %s: expected %v, got %s", c.uri, expected, issues[i])
+			}
+		}
+	}
+}
+
+func TestAuditMessage(t *testing.T) {
+	recipient := &sip.SipUri{FUser: sip.String{Str: "alice?"}, FHost: "example.com"}
+	req := sip.NewRequest("", sip.INVITE, recipient, "SIP/2.0", []sip.Header{
+		&sip.ToHeader{Address: recipient.Clone()},
+		&sip.FromHeader{Address: &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"}},
+	}, "", nil)
+
+	// user part allows raw '?', so the rendered '%3F' is an unnecessary escape
+	issues := sip.AuditMessage(req)
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %v", issues)
+	}
+	for i, location := range []string{"Request-URI", "To"} {
+		if issues[i].Location != location || issues[i].Kind != sip.EscapeUnnecessary {
+			t.Errorf("unexpected issue: %s", issues[i])
+		}
+	}
+}
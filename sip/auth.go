@@ -2,13 +2,61 @@ package sip
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"regexp"
 	"strings"
 )
 
-// currently only Digest and MD5
+// Digest algorithms in order of preference - RFC 7616 3.2, RFC 8760.
+var digestAlgorithms = []struct {
+	name string
+	hash func() hash.Hash
+}{
+	{"SHA-512-256", sha512.New512_256},
+	{"SHA-256", sha256.New},
+	{"MD5", md5.New},
+}
+
+// DigestAlgorithmSupported checks that the digest algorithm (with or without '-sess' suffix) is supported.
+func DigestAlgorithmSupported(algorithm string) bool {
+	return DigestAlgorithmRank(algorithm) >= 0
+}
+
+// DigestAlgorithmRank returns preference rank of the digest algorithm, the lower is the stronger,
+// -1 if the algorithm is unsupported. Empty algorithm is MD5.
+func DigestAlgorithmRank(algorithm string) int {
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	name := strings.TrimSuffix(TokenUpper(algorithm), "-SESS")
+	for i, alg := range digestAlgorithms {
+		if alg.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func digestHash(algorithm string, data string) string {
+	h := md5.New
+	if i := DigestAlgorithmRank(algorithm); i >= 0 {
+		h = digestAlgorithms[i].hash
+	}
+	encoder := h()
+	encoder.Write([]byte(data))
+
+	return hex.EncodeToString(encoder.Sum(nil))
+}
+
+func isSessAlgorithm(algorithm string) bool {
+	return strings.HasSuffix(TokenUpper(algorithm), "-SESS")
+}
+
+// Digest credentials, MD5, SHA-256 and SHA-512-256 algorithms are supported - RFC 7616.
 type Authorization struct {
 	realm     string
 	nonce     string
@@ -21,6 +69,7 @@ type Authorization struct {
 	qop       string
 	nc        string
 	cnonce    string
+	ha1       string
 	other     map[string]string
 }
 
@@ -101,6 +150,13 @@ func (auth *Authorization) SetPassword(password string) *Authorization {
 	return auth
 }
 
+// SetHA1 sets precomputed MD5(username:realm:password) that is used instead of the password.
+func (auth *Authorization) SetHA1(ha1 string) *Authorization {
+	auth.ha1 = ha1
+
+	return auth
+}
+
 func (auth *Authorization) Uri() string {
 	return auth.uri
 }
@@ -150,10 +206,17 @@ func (auth *Authorization) SetCNonce(cnonce string) {
 }
 
 func (auth *Authorization) CalcResponse() string {
-	return calcResponse(
-		auth.username,
-		auth.realm,
-		auth.password,
+	ha1 := auth.ha1
+	if ha1 == "" {
+		ha1 = CalcHA1WithAlgorithm(auth.algorithm, auth.username, auth.realm, auth.password)
+	}
+	if isSessAlgorithm(auth.algorithm) {
+		ha1 = digestHash(auth.algorithm, ha1+":"+auth.nonce+":"+auth.cnonce)
+	}
+
+	return calcDigest(
+		auth.algorithm,
+		ha1,
 		auth.method,
 		auth.uri,
 		auth.nonce,
@@ -180,33 +243,31 @@ func (auth *Authorization) String() string {
 	if auth.qop == "auth" {
 		str += fmt.Sprintf(`,qop=%s,nc=%s,cnonce="%s"`, auth.qop, auth.nc, auth.cnonce)
 	}
+	if opaque, ok := auth.other["opaque"]; ok {
+		str += fmt.Sprintf(`,opaque="%s"`, opaque)
+	}
 
 	return str
 }
 
-// calculates Authorization response https://www.ietf.org/rfc/rfc2617.txt
-func calcResponse(username, realm, password, method, uri, nonce, qop, cnonce, nc string) string {
-	calcA1 := func() string {
-		encoder := md5.New()
-		encoder.Write([]byte(username + ":" + realm + ":" + password))
-
-		return hex.EncodeToString(encoder.Sum(nil))
-	}
-	calcA2 := func() string {
-		encoder := md5.New()
-		encoder.Write([]byte(method + ":" + uri))
+// CalcHA1 calculates digest A1 hash that can be stored instead of plain password.
+func CalcHA1(username, realm, password string) string {
+	return CalcHA1WithAlgorithm("MD5", username, realm, password)
+}
 
-		return hex.EncodeToString(encoder.Sum(nil))
-	}
+// CalcHA1WithAlgorithm calculates digest A1 hash with hash function of the algorithm - RFC 7616 3.4.2.
+func CalcHA1WithAlgorithm(algorithm, username, realm, password string) string {
+	return digestHash(algorithm, username+":"+realm+":"+password)
+}
 
-	encoder := md5.New()
-	encoder.Write([]byte(calcA1() + ":" + nonce + ":"))
+// calculates Authorization response with hash function of the algorithm - RFC 7616 3.4.1
+func calcDigest(algorithm, ha1, method, uri, nonce, qop, cnonce, nc string) string {
+	data := ha1 + ":" + nonce + ":"
 	if qop != "" {
-		encoder.Write([]byte(nc + ":" + cnonce + ":" + qop + ":"))
+		data += nc + ":" + cnonce + ":" + qop + ":"
 	}
-	encoder.Write([]byte(calcA2()))
 
-	return hex.EncodeToString(encoder.Sum(nil))
+	return digestHash(algorithm, data+digestHash(algorithm, method+":"+uri))
 }
 
 func AuthorizeRequest(request Request, response Response, user, password MaybeString) error {
@@ -214,6 +275,12 @@ func AuthorizeRequest(request Request, response Response, user, password MaybeSt
 		return fmt.Errorf("authorize request: user is nil")
 	}
 
+	return AuthorizeRequestWithProvider(request, response, staticSecret(user, password))
+}
+
+// AuthorizeRequestWithProvider answers challenges of the response with secrets
+// looked up for each challenged realm.
+func AuthorizeRequestWithProvider(request Request, response Response, provider CredentialProvider) error {
 	var authenticateHeaderName, authorizeHeaderName string
 	if response.StatusCode() == 401 {
 		// on 401 Unauthorized increase request seq num, add Authorization header and send once again
@@ -225,38 +292,32 @@ func AuthorizeRequest(request Request, response Response, user, password MaybeSt
 		authorizeHeaderName = "Proxy-Authorization"
 	}
 
-	if hdrs := response.GetHeaders(authenticateHeaderName); len(hdrs) > 0 {
-		authenticateHeader := hdrs[0].(*GenericHeader)
-		auth := AuthFromValue(authenticateHeader.Contents).
-			SetMethod(string(request.Method())).
-			SetUri(request.Recipient().String()).
-			SetUsername(user.String())
-		if password != nil {
-			auth.SetPassword(password.String())
+	// answer each challenge, e.g. of several proxies traversed by the request
+	values := authValues(response, authenticateHeaderName)
+	if len(values) == 0 {
+		return fmt.Errorf("authorize request: header '%s' not found in response", authenticateHeaderName)
+	}
+	challenges := preferredChallenges(values)
+	if len(challenges) == 0 {
+		return fmt.Errorf("authorize request: no supported digest algorithm in '%s'", authenticateHeaderName)
+	}
+	target := request.Recipient().String()
+	for _, auth := range challenges {
+		secret, err := provider.Lookup(auth.Realm(), target)
+		if err != nil {
+			return fmt.Errorf("authorize request: %w", err)
 		}
+
+		auth.SetMethod(string(request.Method())).
+			SetUri(target).
+			setSecret(secret)
 		if auth.Qop() == "auth" {
 			auth.SetNc("00000001")
-			encoder := md5.New()
-			encoder.Write([]byte(user.String() + request.Recipient().String()))
-			if password != nil {
-				encoder.Write([]byte(password.String()))
-			}
-			auth.SetCNonce(hex.EncodeToString(encoder.Sum(nil)))
+			auth.SetCNonce(authCNonce(request, secret))
 		}
 		auth.SetResponse(auth.CalcResponse())
 
-		if hdrs = request.GetHeaders(authorizeHeaderName); len(hdrs) > 0 {
-			authorizationHeader := hdrs[0].Clone().(*GenericHeader)
-			authorizationHeader.Contents = auth.String()
-			request.ReplaceHeaders(authorizationHeader.Name(), []Header{authorizationHeader})
-		} else {
-			request.AppendHeader(&GenericHeader{
-				HeaderName: authorizeHeaderName,
-				Contents:   auth.String(),
-			})
-		}
-	} else {
-		return fmt.Errorf("authorize request: header '%s' not found in response", authenticateHeaderName)
+		SetCredentials(request, authorizeHeaderName, auth)
 	}
 
 	if viaHop, ok := request.ViaHop(); ok {
@@ -272,15 +333,112 @@ func AuthorizeRequest(request Request, response Response, user, password MaybeSt
 	return nil
 }
 
+// Picks the strongest supported challenge of each realm, the order of realms is kept - RFC 8760 2.4.
+func preferredChallenges(values []string) []*Authorization {
+	challenges := make([]*Authorization, 0, len(values))
+	byRealm := make(map[string]int)
+	for _, value := range values {
+		auth := AuthFromValue(value)
+		rank := DigestAlgorithmRank(auth.Algorithm())
+		if rank < 0 {
+			continue
+		}
+		if i, ok := byRealm[auth.Realm()]; ok {
+			if rank < DigestAlgorithmRank(challenges[i].Algorithm()) {
+				challenges[i] = auth
+			}
+			continue
+		}
+		byRealm[auth.Realm()] = len(challenges)
+		challenges = append(challenges, auth)
+	}
+	return challenges
+}
+
+func (auth *Authorization) setSecret(secret *Secret) *Authorization {
+	auth.username = secret.Username
+	auth.password = secret.Password
+	// precomputed HA1 is MD5 hash, it doesn't fit other algorithms
+	if DigestAlgorithmRank(auth.algorithm) == DigestAlgorithmRank("MD5") {
+		auth.ha1 = secret.HA1
+	}
+
+	return auth
+}
+
+func authCNonce(request Request, secret *Secret) string {
+	encoder := md5.New()
+	encoder.Write([]byte(secret.Username + request.Recipient().String()))
+	if secret.HA1 != "" {
+		encoder.Write([]byte(secret.HA1))
+	} else {
+		encoder.Write([]byte(secret.Password))
+	}
+
+	return hex.EncodeToString(encoder.Sum(nil))
+}
+
 type Authorizer interface {
 	AuthorizeRequest(request Request, response Response) error
 }
 
+// CachingAuthorizer is an Authorizer that can authorize requests before they are sent
+// with credentials accepted earlier.
+type CachingAuthorizer interface {
+	Authorizer
+	// PreAuthorizeRequest adds cached credentials to the request, returns false if there are none.
+	PreAuthorizeRequest(request Request) bool
+	// CacheResponse is called with the final response on the request.
+	CacheResponse(request Request, response Response)
+}
+
 type DefaultAuthorizer struct {
 	User     MaybeString
 	Password MaybeString
+	// Cache enables authorization of subsequent requests in advance, disabled if nil.
+	Cache *AuthCache
 }
 
 func (auth *DefaultAuthorizer) AuthorizeRequest(request Request, response Response) error {
 	return AuthorizeRequest(request, response, auth.User, auth.Password)
 }
+
+func (auth *DefaultAuthorizer) PreAuthorizeRequest(request Request) bool {
+	if auth.Cache == nil {
+		return false
+	}
+
+	return auth.Cache.Authorize(request, auth.User, auth.Password)
+}
+
+func (auth *DefaultAuthorizer) CacheResponse(request Request, response Response) {
+	if auth.Cache != nil {
+		auth.Cache.Update(request, response)
+	}
+}
+
+// ProviderAuthorizer authorizes requests with secrets looked up in the Provider on demand,
+// so they are not held by the authorizer itself.
+type ProviderAuthorizer struct {
+	Provider CredentialProvider
+	// Cache enables authorization of subsequent requests in advance, disabled if nil.
+	Cache *AuthCache
+}
+
+func (auth *ProviderAuthorizer) AuthorizeRequest(request Request, response Response) error {
+	return AuthorizeRequestWithProvider(request, response, auth.Provider)
+}
+
+func (auth *ProviderAuthorizer) PreAuthorizeRequest(request Request) bool {
+	if auth.Cache == nil {
+		return false
+	}
+
+	return auth.Cache.AuthorizeWithProvider(request, auth.Provider)
+}
+
+func (auth *ProviderAuthorizer) CacheResponse(request Request, response Response) {
+	if auth.Cache != nil {
+		auth.Cache.Update(request, response)
+	}
+}
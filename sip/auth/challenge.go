@@ -0,0 +1,200 @@
+// Package auth implements client side of SIP digest authentication:
+// parsing of WWW-Authenticate and Proxy-Authenticate challenges, digest responses
+// with MD5, SHA-256 and SHA-512-256 algorithms (RFC 7616, RFC 8760) and
+// a client transaction middleware that retries requests challenged with 401 or 407.
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Challenge is a parsed WWW-Authenticate or Proxy-Authenticate value.
+type Challenge struct {
+	Scheme    string
+	Realm     string
+	Domain    string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	Qop       []string
+	Stale     bool
+	// Params holds parameters not mapped to the fields above.
+	Params map[string]string
+}
+
+// ParseChallenge parses a single challenge like 'Digest realm="atlanta.com", nonce="84a4cc6f"'.
+func ParseChallenge(value string) (*Challenge, error) {
+	value = strings.TrimSpace(value)
+	i := strings.IndexAny(value, " \t")
+	if i <= 0 {
+		return nil, fmt.Errorf("parse challenge '%s': missing auth-scheme or parameters", value)
+	}
+
+	ch := &Challenge{
+		Scheme: value[:i],
+		Params: make(map[string]string),
+	}
+	params, err := splitParams(value[i+1:])
+	if err != nil {
+		return nil, fmt.Errorf("parse challenge '%s': %w", value, err)
+	}
+	for _, param := range params {
+		name, val := param[0], param[1]
+		switch sip.TokenLower(name) {
+		case "realm":
+			ch.Realm = val
+		case "domain":
+			ch.Domain = val
+		case "nonce":
+			ch.Nonce = val
+		case "opaque":
+			ch.Opaque = val
+		case "algorithm":
+			ch.Algorithm = val
+		case "qop":
+			for _, qop := range strings.Split(val, ",") {
+				if qop = strings.TrimSpace(qop); qop != "" {
+					ch.Qop = append(ch.Qop, qop)
+				}
+			}
+		case "stale":
+			ch.Stale = sip.TokenEqual(val, "true")
+		default:
+			ch.Params[name] = val
+		}
+	}
+
+	if sip.TokenEqual(ch.Scheme, "Digest") && ch.Nonce == "" {
+		return nil, fmt.Errorf("parse challenge '%s': missing nonce", value)
+	}
+
+	return ch, nil
+}
+
+// Challenges returns challenges of the 401 (WWW-Authenticate) or 407 (Proxy-Authenticate) response.
+func Challenges(res sip.Response) ([]*Challenge, error) {
+	headerName := "WWW-Authenticate"
+	switch res.StatusCode() {
+	case 401:
+	case 407:
+		headerName = "Proxy-Authenticate"
+	default:
+		return nil, fmt.Errorf("%s is not a challenge", res.Short())
+	}
+
+	challenges := make([]*Challenge, 0)
+	for _, hdr := range res.GetHeaders(headerName) {
+		for _, value := range sip.SplitAuthValues(hdr.Value()) {
+			ch, err := ParseChallenge(value)
+			if err != nil {
+				return nil, err
+			}
+			challenges = append(challenges, ch)
+		}
+	}
+	if len(challenges) == 0 {
+		return nil, fmt.Errorf("header '%s' not found in %s", headerName, res.Short())
+	}
+
+	return challenges, nil
+}
+
+// Supported checks that the challenge is a digest challenge with supported algorithm.
+func (ch *Challenge) Supported() bool {
+	return sip.TokenEqual(ch.Scheme, "Digest") && sip.DigestAlgorithmSupported(ch.Algorithm)
+}
+
+// Preferred returns the strongest supported challenge for each realm - RFC 8760 2.4.
+func Preferred(challenges []*Challenge) []*Challenge {
+	preferred := make([]*Challenge, 0, len(challenges))
+	byRealm := make(map[string]int)
+	for _, ch := range challenges {
+		if !ch.Supported() {
+			continue
+		}
+		if i, ok := byRealm[ch.Realm]; ok {
+			if algorithmRank(ch.Algorithm) < algorithmRank(preferred[i].Algorithm) {
+				preferred[i] = ch
+			}
+			continue
+		}
+		byRealm[ch.Realm] = len(preferred)
+		preferred = append(preferred, ch)
+	}
+	return preferred
+}
+
+func (ch *Challenge) String() string {
+	var buffer strings.Builder
+	buffer.WriteString(ch.Scheme)
+	buffer.WriteString(" ")
+	fmt.Fprintf(&buffer, `realm="%s"`, ch.Realm)
+	if ch.Domain != "" {
+		fmt.Fprintf(&buffer, `,domain="%s"`, ch.Domain)
+	}
+	fmt.Fprintf(&buffer, `,nonce="%s"`, ch.Nonce)
+	if ch.Opaque != "" {
+		fmt.Fprintf(&buffer, `,opaque="%s"`, ch.Opaque)
+	}
+	if ch.Stale {
+		buffer.WriteString(",stale=true")
+	}
+	if ch.Algorithm != "" {
+		fmt.Fprintf(&buffer, ",algorithm=%s", ch.Algorithm)
+	}
+	if len(ch.Qop) > 0 {
+		fmt.Fprintf(&buffer, `,qop="%s"`, strings.Join(ch.Qop, ","))
+	}
+	for name, value := range ch.Params {
+		fmt.Fprintf(&buffer, `,%s="%s"`, name, value)
+	}
+
+	return buffer.String()
+}
+
+// Splits comma-separated auth-params, values are unquoted.
+func splitParams(value string) ([][2]string, error) {
+	params := make([][2]string, 0)
+	for {
+		value = strings.TrimLeft(value, " \t,")
+		if value == "" {
+			return params, nil
+		}
+
+		eq := strings.IndexByte(value, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("malformed parameter '%s'", value)
+		}
+		name := strings.TrimSpace(value[:eq])
+		value = strings.TrimLeft(value[eq+1:], " \t")
+
+		var val string
+		if strings.HasPrefix(value, `"`) {
+			var buffer strings.Builder
+			i := 1
+			for ; i < len(value) && value[i] != '"'; i++ {
+				if value[i] == '\\' && i+1 < len(value) {
+					i++
+				}
+				buffer.WriteByte(value[i])
+			}
+			if i == len(value) {
+				return nil, fmt.Errorf("unterminated quoted value of parameter '%s'", name)
+			}
+			val = buffer.String()
+			value = value[i+1:]
+		} else {
+			end := strings.IndexByte(value, ',')
+			if end < 0 {
+				end = len(value)
+			}
+			val = strings.TrimSpace(value[:end])
+			value = value[end:]
+		}
+
+		params = append(params, [2]string{name, val})
+	}
+}
@@ -0,0 +1,104 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/auth"
+)
+
+func TestParseChallenge(t *testing.T) {
+	ch, err := auth.ParseChallenge(`Digest realm="http-auth@example.org", qop="auth, auth-int", ` +
+		`algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", ` +
+		`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", stale=TRUE, userhash=true`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ch.Scheme != "Digest" || ch.Realm != "http-auth@example.org" || ch.Algorithm != "SHA-256" ||
+		ch.Nonce != "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v" ||
+		ch.Opaque != "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS" || !ch.Stale {
+		t.Errorf("unexpected challenge %+v", ch)
+	}
+	if len(ch.Qop) != 2 || ch.Qop[0] != "auth" || ch.Qop[1] != "auth-int" {
+		t.Errorf("unexpected qop %v", ch.Qop)
+	}
+	if ch.Params["userhash"] != "true" {
+		t.Errorf("unexpected params %v", ch.Params)
+	}
+
+	for _, value := range []string{
+		"Digest",
+		`Digest realm="example.com"`,
+		`Digest realm="example.com,nonce="abc"`,
+	} {
+		if _, err := auth.ParseChallenge(value); err == nil {
+			t.Errorf("error expected for '%s'", value)
+		}
+	}
+}
+
+func TestChallenges(t *testing.T) {
+	res := sip.NewResponse("", "SIP/2.0", 407, "Proxy Authentication Required", []sip.Header{
+		&sip.GenericHeader{
+			HeaderName: "Proxy-Authenticate",
+			Contents:   `Digest realm="a.example.com",nonce="1",algorithm=MD5, Digest realm="a.example.com",nonce="2",algorithm=SHA-256`,
+		},
+		&sip.GenericHeader{HeaderName: "Proxy-Authenticate", Contents: `Digest realm="b.example.com",nonce="3",algorithm=SHA-1`},
+		&sip.GenericHeader{HeaderName: "WWW-Authenticate", Contents: `Digest realm="c.example.com",nonce="4"`},
+	}, "", nil)
+
+	challenges, err := auth.Challenges(res)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(challenges) != 3 {
+		t.Fatalf("unexpected challenges %v", challenges)
+	}
+
+	preferred := auth.Preferred(challenges)
+	if len(preferred) != 1 || preferred[0].Nonce != "2" {
+		t.Errorf("unexpected preferred challenges %v", preferred)
+	}
+
+	ok := sip.NewResponse("", "SIP/2.0", 200, "OK", nil, "", nil)
+	if _, err := auth.Challenges(ok); err == nil {
+		t.Errorf("error expected for 200 response")
+	}
+}
+
+// RFC 7616 3.9.1 example.
+func TestChallengeAuthorize(t *testing.T) {
+	secret := &sip.Secret{Username: "Mufasa", Password: "Circle of Life"}
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			ch, err := auth.ParseChallenge(`Digest realm="http-auth@example.org", qop="auth, auth-int", ` +
+				`algorithm=` + tt.algorithm + `, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", ` +
+				`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			creds, err := ch.Authorize("GET", "/dir/index.html", secret, 1, "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if creds.Response() != tt.want {
+				t.Errorf("response = %s, want %s", creds.Response(), tt.want)
+			}
+			if creds.Nc() != "00000001" {
+				t.Errorf("unexpected nc %s", creds.Nc())
+			}
+		})
+	}
+
+	ch := &auth.Challenge{Scheme: "Digest", Realm: "example.com", Nonce: "abc", Algorithm: "SHA-1"}
+	if _, err := ch.Authorize("GET", "/", secret, 1, "xyz"); err == nil {
+		t.Errorf("error expected for unsupported algorithm")
+	}
+}
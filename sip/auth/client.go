@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// DefaultMaxAttempts is the number of authorized retries made by Client if MaxAttempts is zero.
+const DefaultMaxAttempts = 2
+
+// Requester sends requests in client transactions, e.g. transaction.Layer.
+type Requester interface {
+	Request(req sip.Request) (sip.ClientTransaction, error)
+}
+
+// Client is a client transaction middleware that answers 401 and 407 challenges:
+// the request is re-sent with credentials in a new transaction, the challenge is not passed
+// to the caller unless the request can't be authorized.
+type Client struct {
+	requester Requester
+	provider  sip.CredentialProvider
+	// MaxAttempts limits number of authorized retries of the request.
+	MaxAttempts int
+}
+
+// NewClient creates middleware that sends requests through the requester
+// and looks up secrets for challenged realms in the provider.
+func NewClient(requester Requester, provider sip.CredentialProvider) *Client {
+	return &Client{
+		requester: requester,
+		provider:  provider,
+	}
+}
+
+// Request sends the request and returns client transaction that hides authentication round trips.
+func (c *Client) Request(req sip.Request) (sip.ClientTransaction, error) {
+	tx, err := c.requester.Request(req)
+	if err != nil {
+		return nil, err
+	}
+
+	atx := &authTx{
+		client:    c,
+		tx:        tx,
+		responses: make(chan sip.Response, 64),
+		errs:      make(chan error, 64),
+		done:      make(chan bool),
+	}
+	go atx.serve()
+
+	return atx, nil
+}
+
+func (c *Client) maxAttempts() int {
+	if c.MaxAttempts > 0 {
+		return c.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+// authTx proxies the current transaction of the request, switching to the new one on each retry.
+type authTx struct {
+	client    *Client
+	responses chan sip.Response
+	errs      chan error
+	done      chan bool
+
+	mu          sync.RWMutex
+	tx          sip.ClientTransaction
+	attempts    int
+	canceled    bool
+	onAckFns    []func(sip.Request)
+	onCancelFns []func(sip.Request)
+}
+
+func (tx *authTx) current() sip.ClientTransaction {
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+	return tx.tx
+}
+
+func (tx *authTx) Origin() sip.Request {
+	return tx.current().Origin()
+}
+
+func (tx *authTx) Key() sip.TransactionKey {
+	return tx.current().Key()
+}
+
+func (tx *authTx) String() string {
+	return fmt.Sprintf("auth.Tx<%s>", tx.current())
+}
+
+func (tx *authTx) Responses() <-chan sip.Response {
+	return tx.responses
+}
+
+func (tx *authTx) Errors() <-chan error {
+	return tx.errs
+}
+
+func (tx *authTx) Done() <-chan bool {
+	return tx.done
+}
+
+func (tx *authTx) Provisionals() []sip.ProvisionalResponse {
+	return sip.Provisionals(tx.current())
+}
+
+func (tx *authTx) Cancel() error {
+	tx.mu.Lock()
+	tx.canceled = true
+	current := tx.tx
+	tx.mu.Unlock()
+
+	return current.Cancel()
+}
+
+func (tx *authTx) OnAck(fn func(sip.Request)) {
+	tx.mu.Lock()
+	tx.onAckFns = append(tx.onAckFns, fn)
+	current := tx.tx
+	tx.mu.Unlock()
+
+	current.OnAck(fn)
+}
+
+func (tx *authTx) OnCancel(fn func(sip.Request)) {
+	tx.mu.Lock()
+	tx.onCancelFns = append(tx.onCancelFns, fn)
+	current := tx.tx
+	tx.mu.Unlock()
+
+	current.OnCancel(fn)
+}
+
+func (tx *authTx) serve() {
+	defer func() {
+		close(tx.done)
+		close(tx.responses)
+		close(tx.errs)
+	}()
+
+	current := tx.current()
+	for current != nil {
+		current = tx.forward(current)
+	}
+}
+
+// Forwards responses and errors of the transaction until it is done.
+// Returns the new transaction if the request was re-sent with credentials.
+func (tx *authTx) forward(current sip.ClientTransaction) sip.ClientTransaction {
+	responses, errs := current.Responses(), current.Errors()
+	for responses != nil || errs != nil {
+		select {
+		case res, ok := <-responses:
+			if !ok {
+				responses = nil
+				continue
+			}
+			if next := tx.retry(current, res); next != nil {
+				return next
+			}
+			tx.responses <- res
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			tx.errs <- err
+		}
+	}
+	return nil
+}
+
+// Re-sends the request of the transaction with credentials answering the challenge,
+// returns nil if the response must be passed to the caller.
+func (tx *authTx) retry(current sip.ClientTransaction, res sip.Response) sip.ClientTransaction {
+	if res.StatusCode() != 401 && res.StatusCode() != 407 {
+		return nil
+	}
+
+	tx.mu.Lock()
+	if tx.canceled || tx.attempts >= tx.client.maxAttempts() {
+		tx.mu.Unlock()
+		return nil
+	}
+	tx.attempts++
+	tx.mu.Unlock()
+
+	req := current.Origin().Clone().(sip.Request)
+	if err := sip.AuthorizeRequestWithProvider(req, res, tx.client.provider); err != nil {
+		tx.errs <- fmt.Errorf("authorize %s: %w", req.Short(), err)
+		return nil
+	}
+
+	next, err := tx.client.requester.Request(req)
+	if err != nil {
+		tx.errs <- fmt.Errorf("send authorized %s: %w", req.Short(), err)
+		return nil
+	}
+
+	tx.mu.Lock()
+	tx.tx = next
+	for _, fn := range tx.onAckFns {
+		next.OnAck(fn)
+	}
+	for _, fn := range tx.onCancelFns {
+		next.OnCancel(fn)
+	}
+	tx.mu.Unlock()
+
+	return next
+}
@@ -0,0 +1,150 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/auth"
+)
+
+type fakeTx struct {
+	origin    sip.Request
+	responses chan sip.Response
+	errs      chan error
+	done      chan bool
+}
+
+func newFakeTx(req sip.Request, responses ...sip.Response) *fakeTx {
+	tx := &fakeTx{
+		origin:    req,
+		responses: make(chan sip.Response, len(responses)),
+		errs:      make(chan error),
+		done:      make(chan bool),
+	}
+	for _, res := range responses {
+		tx.responses <- res
+	}
+	close(tx.responses)
+	close(tx.errs)
+	close(tx.done)
+	return tx
+}
+
+func (tx *fakeTx) Origin() sip.Request            { return tx.origin }
+func (tx *fakeTx) Key() sip.TransactionKey        { return "" }
+func (tx *fakeTx) String() string                 { return "fakeTx" }
+func (tx *fakeTx) Errors() <-chan error           { return tx.errs }
+func (tx *fakeTx) Done() <-chan bool              { return tx.done }
+func (tx *fakeTx) Responses() <-chan sip.Response { return tx.responses }
+func (tx *fakeTx) Cancel() error                  { return nil }
+func (tx *fakeTx) OnAck(fn func(sip.Request))     {}
+func (tx *fakeTx) OnCancel(fn func(sip.Request))  {}
+
+// fakeRequester answers requests with the status codes in order.
+type fakeRequester struct {
+	codes    []sip.StatusCode
+	requests []sip.Request
+}
+
+func (r *fakeRequester) Request(req sip.Request) (sip.ClientTransaction, error) {
+	r.requests = append(r.requests, req)
+	code := r.codes[0]
+	r.codes = r.codes[1:]
+
+	res := sip.NewResponseFromRequest("", req, code, "", "")
+	switch code {
+	case 401:
+		res.AppendHeader(&sip.GenericHeader{
+			HeaderName: "WWW-Authenticate",
+			Contents:   `Digest realm="example.com",nonce="1",algorithm=MD5, Digest realm="example.com",nonce="2",algorithm=SHA-256,qop="auth"`,
+		})
+	case 407:
+		res.AppendHeader(&sip.GenericHeader{HeaderName: "Proxy-Authenticate", Contents: `Digest realm="proxy.example.com",nonce="3"`})
+	}
+	return newFakeTx(req, res), nil
+}
+
+func newRegister() sip.Request {
+	req := sip.NewRequest("", sip.REGISTER, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", []sip.Header{
+		&sip.ViaHeader{&sip.ViaHop{
+			ProtocolName:    "SIP",
+			ProtocolVersion: "2.0",
+			Transport:       "UDP",
+			Host:            "192.0.2.1",
+			Params:          sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+		}},
+		&sip.CSeq{SeqNo: 1, MethodName: sip.REGISTER},
+	}, "", nil)
+	return req
+}
+
+func collect(t *testing.T, tx sip.ClientTransaction) []sip.Response {
+	var responses []sip.Response
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case res, ok := <-tx.Responses():
+			if !ok {
+				return responses
+			}
+			responses = append(responses, res)
+		case <-timeout:
+			t.Fatalf("transaction is not done")
+		}
+	}
+}
+
+func TestClientRetriesWithCredentials(t *testing.T) {
+	requester := &fakeRequester{codes: []sip.StatusCode{401, 407, 200}}
+	client := auth.NewClient(requester, &sip.StaticCredentials{
+		Default: &sip.Secret{Username: "alice", Password: "secret"},
+	})
+
+	tx, err := client.Request(newRegister())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	responses := collect(t, tx)
+	if len(responses) != 1 || responses[0].StatusCode() != 200 {
+		t.Fatalf("unexpected responses %v", responses)
+	}
+	if len(requester.requests) != 3 {
+		t.Fatalf("unexpected number of requests %d", len(requester.requests))
+	}
+
+	last := requester.requests[2]
+	if cseq, _ := last.CSeq(); cseq.SeqNo != 3 {
+		t.Errorf("unexpected CSeq %s", cseq)
+	}
+	creds, ok := sip.CredentialsByRealm(last, "Authorization", "example.com")
+	if !ok || creds.Algorithm() != "SHA-256" || creds.Nonce() != "2" {
+		t.Errorf("unexpected credentials %v", creds)
+	}
+	if _, ok := sip.CredentialsByRealm(last, "Proxy-Authorization", "proxy.example.com"); !ok {
+		t.Errorf("proxy credentials expected")
+	}
+	if tx.Origin() != last {
+		t.Errorf("origin must be the last sent request")
+	}
+}
+
+func TestClientGivesUp(t *testing.T) {
+	requester := &fakeRequester{codes: []sip.StatusCode{401, 401}}
+	client := auth.NewClient(requester, &sip.StaticCredentials{
+		Default: &sip.Secret{Username: "alice", Password: "wrong"},
+	})
+	client.MaxAttempts = 1
+
+	tx, err := client.Request(newRegister())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	responses := collect(t, tx)
+	if len(responses) != 1 || responses[0].StatusCode() != 401 {
+		t.Fatalf("unexpected responses %v", responses)
+	}
+	if len(requester.requests) != 2 {
+		t.Errorf("unexpected number of requests %d", len(requester.requests))
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Authorize computes digest credentials answering the challenge for the request method and uri - RFC 7616 3.4.
+// nc and cnonce are used only if the challenge offers qop=auth.
+func (ch *Challenge) Authorize(method, uri string, secret *sip.Secret, nc uint32, cnonce string) (*sip.Authorization, error) {
+	if !ch.Supported() {
+		return nil, fmt.Errorf("unsupported challenge %s with algorithm '%s'", ch.Scheme, ch.Algorithm)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("secret for realm '%s' is nil", ch.Realm)
+	}
+
+	auth := sip.AuthFromValue(ch.String()).
+		SetMethod(method).
+		SetUri(uri).
+		SetUsername(secret.Username).
+		SetPassword(secret.Password)
+	// precomputed HA1 is MD5 hash, it doesn't fit other algorithms
+	if secret.HA1 != "" && algorithmRank(ch.Algorithm) == algorithmRank("MD5") {
+		auth.SetHA1(secret.HA1)
+	}
+	if auth.Qop() == "auth" {
+		auth.SetNc(fmt.Sprintf("%08x", nc))
+		auth.SetCNonce(cnonce)
+	}
+	auth.SetResponse(auth.CalcResponse())
+
+	return auth, nil
+}
+
+func algorithmRank(algorithm string) int {
+	return sip.DigestAlgorithmRank(strings.TrimSpace(algorithm))
+}
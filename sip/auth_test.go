@@ -32,3 +32,41 @@ func TestAuthFromValue(t *testing.T) {
 		})
 	}
 }
+
+// RFC 7616 3.9.1 examples.
+func TestAuthorizationCalcResponseAlgorithms(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			auth := &Authorization{
+				realm:     "http-auth@example.org",
+				nonce:     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+				algorithm: tt.algorithm,
+				username:  "Mufasa",
+				password:  "Circle of Life",
+				uri:       "/dir/index.html",
+				method:    "GET",
+				qop:       "auth",
+				nc:        "00000001",
+				cnonce:    "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+				other:     map[string]string{},
+			}
+			if got := auth.CalcResponse(); got != tt.want {
+				t.Errorf("CalcResponse() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if DigestAlgorithmSupported("SHA-1") {
+		t.Errorf("SHA-1 must not be supported")
+	}
+	if !DigestAlgorithmSupported("sha-256-sess") {
+		t.Errorf("SHA-256-sess must be supported")
+	}
+}
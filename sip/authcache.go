@@ -0,0 +1,123 @@
+package sip
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+type authCacheKey struct {
+	realm       string
+	destination string
+}
+
+type authCacheEntry struct {
+	headerName string
+	auth       *Authorization
+	nc         uint64
+}
+
+// AuthCache remembers digest credentials accepted by the remote side per realm and destination,
+// so that subsequent requests (e.g. in-dialog requests) can be authorized in advance
+// instead of waiting for 401/407 challenge every time - RFC 3261 22.3, RFC 2617 3.2.2.
+type AuthCache struct {
+	mu      sync.Mutex
+	entries map[authCacheKey]*authCacheEntry
+}
+
+func NewAuthCache() *AuthCache {
+	return &AuthCache{
+		entries: make(map[authCacheKey]*authCacheEntry),
+	}
+}
+
+// Authorize adds cached credentials for the request destination to the request.
+// Nonce count is incremented for each reuse of the nonce.
+// Returns false if there are no cached credentials for the destination.
+func (cache *AuthCache) Authorize(request Request, user, password MaybeString) bool {
+	if user == nil {
+		return false
+	}
+
+	return cache.AuthorizeWithProvider(request, staticSecret(user, password))
+}
+
+// AuthorizeWithProvider is like Authorize but looks up secrets for cached realms in the provider.
+func (cache *AuthCache) AuthorizeWithProvider(request Request, provider CredentialProvider) bool {
+	destination := request.Destination()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	found := false
+	for key, entry := range cache.entries {
+		if key.destination != destination {
+			continue
+		}
+
+		target := request.Recipient().String()
+		secret, err := provider.Lookup(key.realm, target)
+		if err != nil {
+			continue
+		}
+
+		auth := &Authorization{
+			realm:     entry.auth.realm,
+			nonce:     entry.auth.nonce,
+			algorithm: entry.auth.algorithm,
+			qop:       entry.auth.qop,
+			other:     entry.auth.other,
+		}
+		auth.SetMethod(string(request.Method())).
+			SetUri(target).
+			setSecret(secret)
+		if auth.Qop() == "auth" {
+			entry.nc++
+			auth.SetNc(fmt.Sprintf("%08x", entry.nc))
+			auth.SetCNonce(authCNonce(request, secret))
+		}
+		auth.SetResponse(auth.CalcResponse())
+
+		SetCredentials(request, entry.headerName, auth)
+		found = true
+	}
+
+	return found
+}
+
+// Update remembers credentials of the request if the final response accepted them,
+// or forgets credentials for the request destination if the response is a new challenge.
+func (cache *AuthCache) Update(request Request, response Response) {
+	if response.IsProvisional() {
+		return
+	}
+
+	destination := request.Destination()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if response.StatusCode() == 401 || response.StatusCode() == 407 {
+		for key := range cache.entries {
+			if key.destination == destination {
+				delete(cache.entries, key)
+			}
+		}
+		return
+	}
+
+	for _, headerName := range []string{"Authorization", "Proxy-Authorization"} {
+		for _, auth := range Credentials(request, headerName) {
+			if auth.Nonce() == "" {
+				continue
+			}
+
+			nc, _ := strconv.ParseUint(auth.Nc(), 16, 32)
+			cache.entries[authCacheKey{auth.Realm(), destination}] = &authCacheEntry{
+				headerName: headerName,
+				auth:       auth,
+				nc:         nc,
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestAuthCache(t *testing.T) {
+	newRequest := func(method sip.RequestMethod) sip.Request {
+		return sip.NewRequest("", method, &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"}, "SIP/2.0", []sip.Header{
+			&sip.CSeq{SeqNo: 1, MethodName: method},
+		}, "", nil)
+	}
+	user, password := sip.String{Str: "alice"}, sip.String{Str: "secret"}
+	cache := sip.NewAuthCache()
+
+	req := newRequest(sip.INVITE)
+	if cache.Authorize(req, user, password) {
+		t.Fatalf("empty cache must not authorize request")
+	}
+
+	challenge := sip.NewResponse("", "SIP/2.0", 401, "Unauthorized", []sip.Header{
+		&sip.GenericHeader{HeaderName: "WWW-Authenticate", Contents: `Digest realm="example.com",nonce="abc",qop="auth"`},
+	}, "", nil)
+	if err := sip.AuthorizeRequest(req, challenge, user, password); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cache.Update(req, sip.NewResponse("", "SIP/2.0", 200, "OK", nil, "", nil))
+
+	bye := newRequest(sip.BYE)
+	if !cache.Authorize(bye, user, password) {
+		t.Fatalf("cached credentials expected")
+	}
+	auth, ok := sip.CredentialsByRealm(bye, "Authorization", "example.com")
+	if !ok {
+		t.Fatalf("Authorization header expected")
+	}
+	if auth.Nonce() != "abc" || auth.Nc() != "00000002" {
+		t.Errorf("unexpected credentials %s", auth)
+	}
+	expected := sip.AuthFromValue(auth.String()).
+		SetMethod(string(sip.BYE)).
+		SetUri(bye.Recipient().String()).
+		SetPassword(password.String())
+	if auth.Response() != expected.CalcResponse() {
+		t.Errorf("unexpected response %s", auth.Response())
+	}
+
+	other := sip.NewRequest("", sip.BYE, &sip.SipUri{FHost: "example.org"}, "SIP/2.0", nil, "", nil)
+	if cache.Authorize(other, user, password) {
+		t.Errorf("credentials must not be used for another destination")
+	}
+
+	cache.Update(bye, challenge)
+	if cache.Authorize(newRequest(sip.BYE), user, password) {
+		t.Errorf("credentials must be forgotten after new challenge")
+	}
+}
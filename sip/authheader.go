@@ -0,0 +1,365 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AuthValue is a parsed credentials or challenge value of the authentication headers - RFC 3261 25.1.
+// Well-known parameters are mapped to the fields, the rest are kept in Params in order of appearance.
+type AuthValue struct {
+	Scheme    string
+	Realm     string
+	Domain    string
+	Nonce     string
+	Opaque    string
+	Stale     string
+	Algorithm string
+	// Qop is the single qop-value of credentials or comma-separated qop-options of a challenge.
+	Qop      string
+	Username string
+	Uri      string
+	Response string
+	CNonce   string
+	Nc       string
+	Params   []AuthParam
+}
+
+// AuthParam is an auth parameter not mapped to the AuthValue fields.
+// Parameter without name holds the value of a non-parameterized scheme, e.g. token68 of Basic.
+type AuthParam struct {
+	Name   string
+	Value  string
+	Quoted bool
+}
+
+// ParseAuthValue parses a single credentials or challenge value like 'Digest realm="atlanta.com", nonce="84a4cc6f"'.
+// Quoted strings are unquoted and unescaped.
+func ParseAuthValue(value string) (AuthValue, error) {
+	var auth AuthValue
+
+	value = strings.TrimSpace(value)
+	i := strings.IndexAny(value, " \t")
+	if i < 0 {
+		i = len(value)
+	}
+	if i == 0 {
+		return auth, fmt.Errorf("parse auth value '%s': missing auth-scheme", value)
+	}
+	auth.Scheme = value[:i]
+
+	rest := strings.TrimSpace(value[i:])
+	if rest == "" {
+		return auth, nil
+	}
+	params, err := splitAuthParams(rest)
+	if err != nil {
+		// token68 value
+		if !strings.ContainsAny(rest, " \t,\"") {
+			auth.Params = []AuthParam{{Value: rest}}
+			return auth, nil
+		}
+		return auth, fmt.Errorf("parse auth value '%s': %w", value, err)
+	}
+	for _, param := range params {
+		switch TokenLower(param.Name) {
+		case "realm":
+			auth.Realm = param.Value
+		case "domain":
+			auth.Domain = param.Value
+		case "nonce":
+			auth.Nonce = param.Value
+		case "opaque":
+			auth.Opaque = param.Value
+		case "stale":
+			auth.Stale = param.Value
+		case "algorithm":
+			auth.Algorithm = param.Value
+		case "qop":
+			auth.Qop = param.Value
+		case "username":
+			auth.Username = param.Value
+		case "uri":
+			auth.Uri = param.Value
+		case "response":
+			auth.Response = param.Value
+		case "cnonce":
+			auth.CNonce = param.Value
+		case "nc":
+			auth.Nc = param.Value
+		default:
+			auth.Params = append(auth.Params, param)
+		}
+	}
+
+	return auth, nil
+}
+
+// Splits comma-separated auth parameters, quoted values may contain commas and escaped quotes.
+func splitAuthParams(value string) ([]AuthParam, error) {
+	params := make([]AuthParam, 0)
+	for i := 0; i < len(value); {
+		for i < len(value) && (value[i] == ',' || value[i] == ' ' || value[i] == '\t') {
+			i++
+		}
+		if i == len(value) {
+			break
+		}
+
+		eq := strings.IndexByte(value[i:], '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("missing '=' in parameter '%s'", value[i:])
+		}
+		param := AuthParam{Name: strings.TrimSpace(value[i : i+eq])}
+		if strings.ContainsAny(param.Name, " \t,\"") {
+			return nil, fmt.Errorf("invalid parameter name '%s'", param.Name)
+		}
+		i += eq + 1
+		for i < len(value) && (value[i] == ' ' || value[i] == '\t') {
+			i++
+		}
+
+		if i < len(value) && value[i] == '"' {
+			var buf strings.Builder
+			closed := false
+			for i++; i < len(value); i++ {
+				if value[i] == '\\' && i+1 < len(value) {
+					i++
+					buf.WriteByte(value[i])
+					continue
+				}
+				if value[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				buf.WriteByte(value[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated quoted value of parameter '%s'", param.Name)
+			}
+			param.Value, param.Quoted = buf.String(), true
+		} else {
+			end := strings.IndexByte(value[i:], ',')
+			if end < 0 {
+				end = len(value) - i
+			}
+			param.Value = strings.TrimSpace(value[i : i+end])
+			i += end
+		}
+
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// Renders the value, quoting of qop differs in challenges and credentials - RFC 3261 25.1.
+func (auth *AuthValue) render(challenge bool) string {
+	var buf strings.Builder
+	buf.WriteString(auth.Scheme)
+
+	first := true
+	write := func(name, value string, quoted bool) {
+		if first {
+			buf.WriteString(" ")
+			first = false
+		} else {
+			buf.WriteString(", ")
+		}
+		if name != "" {
+			buf.WriteString(name)
+			buf.WriteString("=")
+		}
+		if quoted {
+			buf.WriteString(quoteAuthValue(value))
+		} else {
+			buf.WriteString(value)
+		}
+	}
+	field := func(name, value string, quoted bool) {
+		if value != "" {
+			write(name, value, quoted)
+		}
+	}
+
+	field("username", auth.Username, true)
+	field("realm", auth.Realm, true)
+	field("domain", auth.Domain, true)
+	field("nonce", auth.Nonce, true)
+	field("uri", auth.Uri, true)
+	field("response", auth.Response, true)
+	field("algorithm", auth.Algorithm, false)
+	field("cnonce", auth.CNonce, true)
+	field("opaque", auth.Opaque, true)
+	field("stale", auth.Stale, false)
+	field("qop", auth.Qop, challenge)
+	field("nc", auth.Nc, false)
+	for _, param := range auth.Params {
+		write(param.Name, param.Value, param.Quoted)
+	}
+
+	return buf.String()
+}
+
+func quoteAuthValue(value string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		if value[i] == '"' || value[i] == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(value[i])
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func (auth *AuthValue) clone() AuthValue {
+	newAuth := *auth
+	if auth.Params != nil {
+		newAuth.Params = make([]AuthParam, len(auth.Params))
+		copy(newAuth.Params, auth.Params)
+	}
+	return newAuth
+}
+
+func (auth *AuthValue) equals(other *AuthValue) bool {
+	if !TokenEqual(auth.Scheme, other.Scheme) ||
+		auth.Realm != other.Realm ||
+		auth.Domain != other.Domain ||
+		auth.Nonce != other.Nonce ||
+		auth.Opaque != other.Opaque ||
+		!TokenEqual(auth.Stale, other.Stale) ||
+		!TokenEqual(auth.Algorithm, other.Algorithm) ||
+		auth.Qop != other.Qop ||
+		auth.Username != other.Username ||
+		auth.Uri != other.Uri ||
+		auth.Response != other.Response ||
+		auth.CNonce != other.CNonce ||
+		auth.Nc != other.Nc ||
+		len(auth.Params) != len(other.Params) {
+		return false
+	}
+	for i := range auth.Params {
+		if !TokenEqual(auth.Params[i].Name, other.Params[i].Name) || auth.Params[i].Value != other.Params[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthorizationHeader holds credentials of the user agent - RFC 3261 20.7.
+type AuthorizationHeader struct {
+	AuthValue
+}
+
+func (auth *AuthorizationHeader) Name() string  { return "Authorization" }
+func (auth *AuthorizationHeader) Value() string { return auth.render(false) }
+func (auth *AuthorizationHeader) String() string {
+	return fmt.Sprintf("%s: %s", auth.Name(), auth.Value())
+}
+
+func (auth *AuthorizationHeader) Clone() Header {
+	var newAuth *AuthorizationHeader
+	if auth == nil {
+		return newAuth
+	}
+	return &AuthorizationHeader{auth.clone()}
+}
+
+func (auth *AuthorizationHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*AuthorizationHeader); ok {
+		if auth == nil || h == nil {
+			return auth == h
+		}
+		return auth.equals(&h.AuthValue)
+	}
+	return false
+}
+
+// ProxyAuthorizationHeader holds credentials of the user agent for the proxy - RFC 3261 20.28.
+type ProxyAuthorizationHeader struct {
+	AuthValue
+}
+
+func (auth *ProxyAuthorizationHeader) Name() string  { return "Proxy-Authorization" }
+func (auth *ProxyAuthorizationHeader) Value() string { return auth.render(false) }
+func (auth *ProxyAuthorizationHeader) String() string {
+	return fmt.Sprintf("%s: %s", auth.Name(), auth.Value())
+}
+
+func (auth *ProxyAuthorizationHeader) Clone() Header {
+	var newAuth *ProxyAuthorizationHeader
+	if auth == nil {
+		return newAuth
+	}
+	return &ProxyAuthorizationHeader{auth.clone()}
+}
+
+func (auth *ProxyAuthorizationHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*ProxyAuthorizationHeader); ok {
+		if auth == nil || h == nil {
+			return auth == h
+		}
+		return auth.equals(&h.AuthValue)
+	}
+	return false
+}
+
+// WWWAuthenticateHeader holds the challenge of the user agent server - RFC 3261 20.44.
+type WWWAuthenticateHeader struct {
+	AuthValue
+}
+
+func (auth *WWWAuthenticateHeader) Name() string  { return "WWW-Authenticate" }
+func (auth *WWWAuthenticateHeader) Value() string { return auth.render(true) }
+func (auth *WWWAuthenticateHeader) String() string {
+	return fmt.Sprintf("%s: %s", auth.Name(), auth.Value())
+}
+
+func (auth *WWWAuthenticateHeader) Clone() Header {
+	var newAuth *WWWAuthenticateHeader
+	if auth == nil {
+		return newAuth
+	}
+	return &WWWAuthenticateHeader{auth.clone()}
+}
+
+func (auth *WWWAuthenticateHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*WWWAuthenticateHeader); ok {
+		if auth == nil || h == nil {
+			return auth == h
+		}
+		return auth.equals(&h.AuthValue)
+	}
+	return false
+}
+
+// ProxyAuthenticateHeader holds the challenge of the proxy - RFC 3261 20.27.
+type ProxyAuthenticateHeader struct {
+	AuthValue
+}
+
+func (auth *ProxyAuthenticateHeader) Name() string  { return "Proxy-Authenticate" }
+func (auth *ProxyAuthenticateHeader) Value() string { return auth.render(true) }
+func (auth *ProxyAuthenticateHeader) String() string {
+	return fmt.Sprintf("%s: %s", auth.Name(), auth.Value())
+}
+
+func (auth *ProxyAuthenticateHeader) Clone() Header {
+	var newAuth *ProxyAuthenticateHeader
+	if auth == nil {
+		return newAuth
+	}
+	return &ProxyAuthenticateHeader{auth.clone()}
+}
+
+func (auth *ProxyAuthenticateHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*ProxyAuthenticateHeader); ok {
+		if auth == nil || h == nil {
+			return auth == h
+		}
+		return auth.equals(&h.AuthValue)
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestParseAuthValue(t *testing.T) {
+	auth, err := sip.ParseAuthValue(`Digest realm="a \"quoted\", realm", nonce="abc",qop="auth,auth-int",stale=FALSE,foo=bar`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if auth.Scheme != "Digest" || auth.Realm != `a "quoted", realm` || auth.Nonce != "abc" ||
+		auth.Qop != "auth,auth-int" || auth.Stale != "FALSE" {
+		t.Errorf("unexpected value %+v", auth)
+	}
+	if len(auth.Params) != 1 || auth.Params[0] != (sip.AuthParam{Name: "foo", Value: "bar"}) {
+		t.Errorf("unexpected extension params %v", auth.Params)
+	}
+
+	challenge := &sip.WWWAuthenticateHeader{AuthValue: auth}
+	expected := `Digest realm="a \"quoted\", realm", nonce="abc", stale=FALSE, qop="auth,auth-int", foo=bar`
+	if challenge.Value() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, challenge.Value())
+	}
+
+	basic, err := sip.ParseAuthValue("Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if creds := (&sip.AuthorizationHeader{AuthValue: basic}); creds.Value() != "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==" {
+		t.Errorf("unexpected token68 credentials '%s'", creds.Value())
+	}
+
+	if _, err := sip.ParseAuthValue(`Digest realm="atlanta.com", nonce`); err == nil {
+		t.Error("expected error on parameter without value")
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+	creds := &sip.AuthorizationHeader{AuthValue: sip.AuthValue{
+		Scheme:   "Digest",
+		Username: "bob",
+		Realm:    "biloxi.com",
+		Nonce:    "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+		Uri:      "sip:bob@biloxi.com",
+		Response: "6629fae49393a05397450978507c4ef1",
+		Qop:      "auth",
+		Nc:       "00000001",
+		CNonce:   "0a4f113b",
+	}}
+	expected := `Authorization: Digest username="bob", realm="biloxi.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", ` +
+		`uri="sip:bob@biloxi.com", response="6629fae49393a05397450978507c4ef1", cnonce="0a4f113b", qop=auth, nc=00000001`
+	if creds.String() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, creds.String())
+	}
+
+	// rendered credentials are readable by the digest helpers
+	if auth := sip.AuthFromValue(creds.Value()); auth.Username() != "bob" || auth.Qop() != "auth" {
+		t.Errorf("unexpected digest credentials %s", auth)
+	}
+
+	clone := creds.Clone().(*sip.AuthorizationHeader)
+	if !clone.Equals(creds) {
+		t.Error("clone is not equal to the original")
+	}
+	clone.Nonce = "other"
+	if clone.Equals(creds) || (&sip.ProxyAuthorizationHeader{AuthValue: creds.AuthValue}).Equals(creds) {
+		t.Error("unexpected equality")
+	}
+}
@@ -0,0 +1,344 @@
+package sip
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ghettovoice/gosip/util"
+)
+
+// B2BUALeg is a side of the back-to-back user agent session.
+type B2BUALeg int
+
+const (
+	// LegA is the incoming leg, the B2BUA acts as the UAS on it.
+	LegA B2BUALeg = iota
+	// LegB is the outgoing leg, the B2BUA acts as the UAC on it.
+	LegB
+)
+
+func (leg B2BUALeg) String() string {
+	switch leg {
+	case LegA:
+		return "A"
+	case LegB:
+		return "B"
+	default:
+		return fmt.Sprintf("B2BUALeg(%d)", int(leg))
+	}
+}
+
+func (leg B2BUALeg) other() B2BUALeg {
+	if leg == LegA {
+		return LegB
+	}
+	return LegA
+}
+
+// SDPRewriteFunc rewrites the session description of the message received on the from leg
+// before it is passed to the other leg, e.g. to anchor media on a relay.
+type SDPRewriteFunc func(from B2BUALeg, msg Message, sdp string) (string, error)
+
+// B2BUA pairs the dialog of the incoming request with the dialog of the outgoing one - RFC 3261 6 (B2BUA).
+// The legs have own Call-IDs, tags and CSeq spaces, B2BUA builds the message of one leg
+// from the message received on the other one and keeps both dialogs in sync.
+// Only the first dialog established on the leg B is paired, responses of other forks are rejected with error.
+//
+// Usage: NewB2BUA on the incoming INVITE, send OutgoingRequest on the leg B and pass each response on it
+// to Response to get the response for the leg A. Requests received within dialogs are passed to Forward,
+// responses on the forwarded requests to ForwardResponse.
+type B2BUA struct {
+	// RewriteSDP is called with the session description passed between the legs, nil keeps it as is.
+	RewriteSDP SDPRewriteFunc
+	// Headers are names of end-to-end headers copied between the legs along with the body,
+	// e.g. "Subject" or "Allow". Dialog, routing and body headers are always built by B2BUA.
+	Headers []string
+
+	mu       sync.Mutex
+	contact  Uri
+	incoming Request
+	outgoing Request
+	localTag string
+	dialogs  [2]*Dialog
+	pending  map[b2buaKey]Request
+}
+
+// Identifies the request forwarded to the leg by the CSeq of the leg.
+type b2buaKey struct {
+	leg    B2BUALeg
+	seq    uint32
+	method RequestMethod
+}
+
+// NewB2BUA creates B2BUA session of the incoming dialog creating request,
+// contact is the Contact address of the B2BUA on both legs.
+func NewB2BUA(incoming Request, contact Uri) *B2BUA {
+	return &B2BUA{
+		contact:  contact,
+		incoming: incoming,
+		localTag: util.RandString(8),
+		pending:  make(map[b2buaKey]Request),
+	}
+}
+
+// Incoming returns the dialog creating request received on the leg A.
+func (b *B2BUA) Incoming() Request { return b.incoming }
+
+// Outgoing returns the dialog creating request of the leg B, nil until OutgoingRequest is called.
+func (b *B2BUA) Outgoing() Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.outgoing
+}
+
+// Dialog returns the dialog of the leg, nil until it is established.
+func (b *B2BUA) Dialog(leg B2BUALeg) *Dialog {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dialogs[leg]
+}
+
+// OutgoingRequest builds the dialog creating request of the leg B to the recipient.
+// The request has the From and To addresses of the incoming one with a new From tag,
+// a new Call-ID, CSeq 1 and decremented 'Max-Forwards'.
+// The request with zero 'Max-Forwards' should be rejected with '483 Too Many Hops' before.
+func (b *B2BUA) OutgoingRequest(recipient Uri) (Request, error) {
+	from, ok := b.incoming.From()
+	if !ok {
+		return nil, fmt.Errorf("missing From header in %s", b.incoming.Short())
+	}
+	to, ok := b.incoming.To()
+	if !ok {
+		return nil, fmt.Errorf("missing To header in %s", b.incoming.Short())
+	}
+	if IsTooManyHops(b.incoming) {
+		return nil, fmt.Errorf("too many hops of %s", b.incoming.Short())
+	}
+
+	builder := NewRequestBuilder().
+		SetMethod(b.incoming.Method()).
+		SetRecipient(recipient).
+		SetFrom(&Address{
+			DisplayName: from.DisplayName,
+			Uri:         from.Address.Clone(),
+			Params:      NewParams().Add("tag", String{Str: util.RandString(8)}),
+		}).
+		SetTo(&Address{
+			DisplayName: to.DisplayName,
+			Uri:         to.Address.Clone(),
+		}).
+		SetContact(&Address{Uri: b.contact.Clone()})
+	if maxForwards, ok := GetMaxForwards(b.incoming); ok {
+		maxForwards--
+		builder.SetMaxForwards(&maxForwards)
+	}
+	req, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.copyBody(LegA, b.incoming, req); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.outgoing = req
+	b.mu.Unlock()
+
+	return req, nil
+}
+
+// Response maps the response received on the leg B on the outgoing request to the response
+// on the incoming request, establishes or updates dialogs of both legs.
+// Responses other than 100 take the To tag of the B2BUA on the leg A, 1xx and 2xx ones take the Contact.
+func (b *B2BUA) Response(res Response) (Response, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.outgoing == nil {
+		return nil, fmt.Errorf("outgoing request is not sent")
+	}
+
+	out := NewResponseFromRequest("", b.incoming, res.StatusCode(), res.Reason(), "")
+	if res.StatusCode() > 100 {
+		if to, ok := out.To(); ok {
+			if to.Params == nil {
+				to.Params = NewParams()
+			}
+			if !to.Params.Has("tag") {
+				to.Params.Add("tag", String{Str: b.localTag})
+			}
+		}
+	}
+	if err := b.copyBody(LegB, res, out); err != nil {
+		return nil, err
+	}
+	if res.StatusCode() == 100 {
+		return out, nil
+	}
+
+	if res.IsProvisional() && hasToTag(res) || res.IsSuccess() {
+		out.AppendHeader(&ContactHeader{Address: b.contact.Clone()})
+		if err := b.establish(res, out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	// failure terminates early dialogs of both legs
+	for _, dlg := range b.dialogs {
+		if dlg != nil && dlg.State() == DialogEarly {
+			dlg.Terminate()
+		}
+	}
+
+	return out, nil
+}
+
+// Establishes dialogs by the response of the leg B and the mapped response of the leg A. Should be called under lock.
+func (b *B2BUA) establish(res, out Response) error {
+	if dlg := b.dialogs[LegB]; dlg != nil {
+		to, _ := res.To()
+		if tag, _ := to.Params.Get("tag"); tag == nil || tag.String() != dlg.RemoteTag() {
+			return fmt.Errorf("response %s of another dialog than %s", res.Short(), dlg.ID())
+		}
+		if err := dlg.ReceiveResponse(res); err != nil {
+			return err
+		}
+		return b.dialogs[LegA].SendResponse(out)
+	}
+
+	legB, err := NewDialogUAC(b.outgoing, res)
+	if err != nil {
+		return err
+	}
+	legA, err := NewDialogUAS(b.incoming, out)
+	if err != nil {
+		return err
+	}
+	b.dialogs[LegA], b.dialogs[LegB] = legA, legB
+
+	return nil
+}
+
+// Forward validates the request received within the dialog of the from leg and builds the request
+// of the dialog of the other leg with own CSeq. DialogError is returned for the request that should be
+// rejected with its status code. Responses on the returned request are passed to ForwardResponse.
+func (b *B2BUA) Forward(from B2BUALeg, req Request) (Request, error) {
+	if req.IsCancel() {
+		return nil, fmt.Errorf("CANCEL is answered on the leg it is received")
+	}
+
+	b.mu.Lock()
+	src, dst := b.dialogs[from], b.dialogs[from.other()]
+	b.mu.Unlock()
+	if src == nil || dst == nil {
+		return nil, &DialogError{"", 481, fmt.Sprintf("dialog of the leg %s is not established", from)}
+	}
+
+	if err := src.ReceiveRequest(req); err != nil {
+		return nil, err
+	}
+
+	body, err := b.rewrite(from, req)
+	if err != nil {
+		return nil, err
+	}
+	out, err := dst.NewRequest(req.Method(), body)
+	if err != nil {
+		return nil, err
+	}
+	b.copyHeaders(req, out)
+	if body != "" {
+		CopyHeaders("Content-Type", req, out)
+	}
+
+	if !req.IsAck() {
+		cseq, _ := out.CSeq()
+
+		b.mu.Lock()
+		b.pending[b2buaKey{from.other(), cseq.SeqNo, cseq.MethodName}] = req
+		b.mu.Unlock()
+	}
+
+	return out, nil
+}
+
+// ForwardResponse maps the response received on the from leg on the request built by Forward
+// to the response on the original request of the other leg.
+func (b *B2BUA) ForwardResponse(from B2BUALeg, res Response) (Response, error) {
+	cseq, ok := res.CSeq()
+	if !ok {
+		return nil, fmt.Errorf("missing CSeq header in %s", res.Short())
+	}
+	key := b2buaKey{from, cseq.SeqNo, cseq.MethodName}
+
+	b.mu.Lock()
+	req, ok := b.pending[key]
+	if ok && !res.IsProvisional() {
+		delete(b.pending, key)
+	}
+	src, dst := b.dialogs[from], b.dialogs[from.other()]
+	b.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no forwarded request of %s on the leg %s", res.Short(), from)
+	}
+
+	if err := src.ReceiveResponse(res); err != nil {
+		return nil, err
+	}
+
+	out := NewResponseFromRequest("", req, res.StatusCode(), res.Reason(), "")
+	if err := b.copyBody(from, res, out); err != nil {
+		return nil, err
+	}
+	if res.IsSuccess() && (req.IsInvite() || req.Method() == UPDATE) {
+		out.AppendHeader(&ContactHeader{Address: b.contact.Clone()})
+	}
+	if err := dst.SendResponse(out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Copies the rewritten body of the message received on the from leg with the mapped headers.
+func (b *B2BUA) copyBody(from B2BUALeg, src, dst Message) error {
+	body, err := b.rewrite(from, src)
+	if err != nil {
+		return err
+	}
+	b.copyHeaders(src, dst)
+	if body != "" {
+		CopyHeaders("Content-Type", src, dst)
+	}
+	dst.SetBody(body, true)
+
+	return nil
+}
+
+func (b *B2BUA) copyHeaders(src, dst Message) {
+	for _, name := range b.Headers {
+		CopyHeaders(name, src, dst)
+	}
+}
+
+// Returns the body of the message, the session description is rewritten by RewriteSDP.
+func (b *B2BUA) rewrite(from B2BUALeg, msg Message) (string, error) {
+	sdp := sessionBody(msg)
+	if sdp == "" || b.RewriteSDP == nil {
+		return msg.Body(), nil
+	}
+
+	body, err := b.RewriteSDP(from, msg, sdp)
+	if err != nil {
+		return "", fmt.Errorf("rewrite SDP of %s: %w", msg.Short(), err)
+	}
+	return body, nil
+}
+
+func hasToTag(msg Message) bool {
+	to, ok := msg.To()
+	return ok && to.Params != nil && to.Params.Has("tag")
+}
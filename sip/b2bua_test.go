@@ -0,0 +1,167 @@
+package sip_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+const b2buaOffer = "v=0\r\no=alice 2890844526 2890844526 IN IP4 pc33.atlanta.com\r\nc=IN IP4 pc33.atlanta.com\r\n"
+
+func b2buaIncoming(t *testing.T) sip.Request {
+	req := parseDialogMessage(t,
+		"INVITE sip:bob@biloxi.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"From: \"Alice\" <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 314159 INVITE",
+		"Contact: <sip:alice@pc33.atlanta.com>",
+		"Max-Forwards: 70",
+		"Subject: lunch",
+		"Content-Type: application/sdp",
+	).(sip.Request)
+	req.SetBody(b2buaOffer, true)
+	return req
+}
+
+// Answers the request of the leg B on behalf of the callee.
+func b2buaAnswer(req sip.Request, code sip.StatusCode, reason, body string) sip.Response {
+	res := sip.NewResponseFromRequest("", req, code, reason, body)
+	if to, ok := res.To(); ok {
+		if to.Params == nil {
+			to.Params = sip.NewParams()
+		}
+		to.Params.Add("tag", sip.String{Str: "a6c85cf"})
+	}
+	res.AppendHeader(&sip.ContactHeader{Address: &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "192.0.2.4"}})
+	if body != "" {
+		contentType := sip.ContentType("application/sdp")
+		res.AppendHeader(&contentType)
+	}
+	return res
+}
+
+func TestB2BUA(t *testing.T) {
+	incoming := b2buaIncoming(t)
+	contact, _ := parser.ParseUri("sip:b2bua@192.0.2.10")
+	b2bua := sip.NewB2BUA(incoming, contact)
+	b2bua.Headers = []string{"Subject"}
+	b2bua.RewriteSDP = func(from sip.B2BUALeg, msg sip.Message, sdp string) (string, error) {
+		return strings.Replace(sdp, "c=IN IP4 ", "c=IN IP4 relay.", 1), nil
+	}
+
+	recipient, _ := parser.ParseUri("sip:bob@192.0.2.4")
+	out, err := b2bua.OutgoingRequest(recipient)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if callID, _ := out.CallID(); string(*callID) == "a84b4c76e66710" {
+		t.Error("leg B must have own Call-ID")
+	}
+	if from, _ := out.From(); from.DisplayName.String() != "Alice" || from.Params.Equals(sip.NewParams().Add("tag", sip.String{Str: "1928301774"})) {
+		t.Errorf("expected From of the caller with own tag, got %s", from)
+	}
+	if cseq, _ := out.CSeq(); cseq.SeqNo != 1 || cseq.MethodName != sip.INVITE {
+		t.Errorf("expected own CSeq space, got %s", cseq)
+	}
+	if maxForwards, _ := sip.GetMaxForwards(out); maxForwards != 69 {
+		t.Errorf("expected decremented Max-Forwards, got %d", maxForwards)
+	}
+	if !strings.Contains(out.Body(), "c=IN IP4 relay.pc33.atlanta.com") || len(out.GetHeaders("Subject")) != 1 {
+		t.Errorf("expected rewritten offer and copied Subject, got\n%s", out)
+	}
+
+	ringing, err := b2bua.Response(b2buaAnswer(out, 180, "Ringing", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if callID, _ := ringing.CallID(); string(*callID) != "a84b4c76e66710" || !strings.Contains(ringing.String(), ";tag=") {
+		t.Errorf("expected response of the leg A with own To tag, got\n%s", ringing)
+	}
+	legA, legB := b2bua.Dialog(sip.LegA), b2bua.Dialog(sip.LegB)
+	if legA == nil || legB == nil || legA.State() != sip.DialogEarly || legB.RemoteTag() != "a6c85cf" {
+		t.Fatalf("expected early dialogs of both legs, got %s, %s", legA, legB)
+	}
+
+	answer := "v=0\r\no=bob 2808844564 2808844564 IN IP4 192.0.2.4\r\nc=IN IP4 192.0.2.4\r\n"
+	ok, err := b2bua.Response(b2buaAnswer(out, 200, "OK", answer))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(ok.Body(), "c=IN IP4 relay.192.0.2.4") {
+		t.Errorf("expected rewritten answer, got\n%s", ok.Body())
+	}
+	if contact, _ := ok.Contact(); contact.Address.String() != "sip:b2bua@192.0.2.10" {
+		t.Errorf("expected B2BUA contact, got %s", contact)
+	}
+	if legA.State() != sip.DialogConfirmed || legB.State() != sip.DialogConfirmed {
+		t.Fatalf("expected confirmed dialogs, got %s, %s", legA.State(), legB.State())
+	}
+	if legA.LocalTag() == legB.LocalTag() || legA.CallID() == legB.CallID() {
+		t.Error("legs must not share dialog identifiers")
+	}
+
+	// the callee hangs up
+	callee, _ := sip.NewDialogUAS(out, b2buaAnswer(out, 200, "OK", answer))
+	bye, _ := callee.NewRequest(sip.BYE, "")
+	forwarded, err := b2bua.Forward(sip.LegB, bye)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if forwarded.Recipient().String() != "sip:alice@pc33.atlanta.com" {
+		t.Errorf("unexpected Request-URI %s", forwarded.Recipient())
+	}
+	if callID, _ := forwarded.CallID(); string(*callID) != "a84b4c76e66710" {
+		t.Errorf("expected Call-ID of the leg A, got %s", callID)
+	}
+	if cseq, _ := forwarded.CSeq(); cseq.SeqNo != 1 || cseq.MethodName != sip.BYE {
+		t.Errorf("expected CSeq of the leg A, got %s", cseq)
+	}
+
+	res, err := b2bua.ForwardResponse(sip.LegA, sip.NewResponseFromRequest("", forwarded, 200, "OK", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cseq, _ := res.CSeq(); cseq.Value() != "1 BYE" || res.StatusCode() != 200 {
+		t.Errorf("expected 200 on BYE of the leg B, got\n%s", res)
+	}
+	if legA.State() != sip.DialogTerminated || legB.State() != sip.DialogTerminated {
+		t.Errorf("expected terminated dialogs, got %s, %s", legA.State(), legB.State())
+	}
+
+	if _, err := b2bua.Forward(sip.LegB, bye); !errors.Is(err, sip.ErrDialogNotFound) {
+		t.Errorf("expected ErrDialogNotFound, got %v", err)
+	}
+	if _, err := b2bua.ForwardResponse(sip.LegA, res); err == nil {
+		t.Error("expected error on response of not forwarded request")
+	}
+}
+
+func TestB2BUAFailure(t *testing.T) {
+	contact, _ := parser.ParseUri("sip:b2bua@192.0.2.10")
+	b2bua := sip.NewB2BUA(b2buaIncoming(t), contact)
+
+	recipient, _ := parser.ParseUri("sip:bob@192.0.2.4")
+	out, _ := b2bua.OutgoingRequest(recipient)
+	if _, err := b2bua.Response(b2buaAnswer(out, 183, "Session Progress", "")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	busy, err := b2bua.Response(b2buaAnswer(out, 486, "Busy Here", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if busy.StatusCode() != 486 || busy.Body() != "" {
+		t.Errorf("unexpected response\n%s", busy)
+	}
+	if _, ok := busy.Contact(); ok {
+		t.Error("failure response must not carry Contact")
+	}
+	if b2bua.Dialog(sip.LegA).State() != sip.DialogTerminated || b2bua.Dialog(sip.LegB).State() != sip.DialogTerminated {
+		t.Error("early dialogs must be terminated on failure")
+	}
+}
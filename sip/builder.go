@@ -182,6 +182,17 @@ func (rb *RequestBuilder) SetContact(address *Address) *RequestBuilder {
 	return rb
 }
 
+// DeregisterAll sets up REGISTER request that removes all bindings of the address-of-record
+// with the wildcard 'Contact: *' and 'Expires: 0' - RFC 3261 10.2.2.
+func (rb *RequestBuilder) DeregisterAll() *RequestBuilder {
+	expires := Expires(0)
+	rb.SetMethod(REGISTER)
+	rb.contact = NewWildcardContact()
+	rb.expires = &expires
+
+	return rb
+}
+
 func (rb *RequestBuilder) SetExpires(expires *Expires) *RequestBuilder {
 	rb.expires = expires
 
@@ -0,0 +1,100 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CallerIDHistory describes how the original caller identity is recorded on rewrite.
+type CallerIDHistory int
+
+const (
+	// CallerIDHistoryNone doesn't record the original identity.
+	CallerIDHistoryNone CallerIDHistory = iota
+	// CallerIDHistoryInfo records the original identity in 'History-Info' header (RFC 7044).
+	CallerIDHistoryInfo
+	// CallerIDHistoryDiversion records the original identity in 'Diversion' header (RFC 5806).
+	CallerIDHistoryDiversion
+)
+
+// CallerID describes caller identity rewrite of the forwarded request.
+type CallerID struct {
+	// DisplayName replaces 'From' display name, nil keeps it untouched.
+	DisplayName MaybeString
+	// User replaces 'From' URI user part, nil keeps it untouched.
+	User MaybeString
+	// AssertedIdentity replaces 'P-Asserted-Identity' header, nil keeps it untouched.
+	AssertedIdentity *Address
+	History          CallerIDHistory
+	// DiversionReason is a 'reason' parameter of 'Diversion' header, "unknown" if empty.
+	DiversionReason string
+}
+
+// RewriteCallerID rewrites caller identity of the request keeping 'From' tag untouched,
+// so it is safe for dialog-forming and in-dialog requests.
+// The original identity is recorded according to the history policy only for dialog-forming requests,
+// since in-dialog requests already belong to the recorded dialog.
+func RewriteCallerID(req Request, id CallerID) error {
+	from, ok := req.From()
+	if !ok {
+		return fmt.Errorf("'From' header not found in request '%s'", req.Short())
+	}
+
+	original := NewAddressFromFromHeader(from)
+	if original.Params != nil {
+		original.Params = original.Params.Clone().Remove("tag")
+	}
+
+	changed := false
+	if id.DisplayName != nil && (from.DisplayName == nil || !from.DisplayName.Equals(id.DisplayName)) {
+		from.DisplayName = id.DisplayName
+		changed = true
+	}
+	if id.User != nil && from.Address != nil && (from.Address.User() == nil || !from.Address.User().Equals(id.User)) {
+		from.Address.SetUser(id.User)
+		changed = true
+	}
+	if id.AssertedIdentity != nil {
+		req.RemoveHeader("P-Asserted-Identity")
+		req.AppendHeader(&GenericHeader{
+			HeaderName: "P-Asserted-Identity",
+			Contents:   id.AssertedIdentity.String(),
+		})
+	}
+
+	if !changed || IsInDialog(req) {
+		return nil
+	}
+
+	switch id.History {
+	case CallerIDHistoryInfo:
+		index := len(req.GetHeaders("History-Info")) + 1
+		req.AppendHeader(&GenericHeader{
+			HeaderName: "History-Info",
+			Contents:   fmt.Sprintf("<%s>;index=%d", original.Uri, index),
+		})
+	case CallerIDHistoryDiversion:
+		reason := id.DiversionReason
+		if reason == "" {
+			reason = "unknown"
+		}
+		counter := len(req.GetHeaders("Diversion")) + 1
+		req.AppendHeader(&GenericHeader{
+			HeaderName: "Diversion",
+			Contents:   fmt.Sprintf("%s;reason=%s;counter=%d", original, reason, counter),
+		})
+	}
+
+	return nil
+}
+
+// IsInDialog checks that the request is sent within a dialog, i.e. has tag in the 'To' header - RFC 3261 12.2.
+func IsInDialog(req Request) bool {
+	to, ok := req.To()
+	if !ok || to.Params == nil {
+		return false
+	}
+
+	tag, ok := to.Params.Get("tag")
+	return ok && tag != nil && strings.TrimSpace(tag.String()) != ""
+}
@@ -0,0 +1,88 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func newCallerIDRequest(toParams sip.Params) sip.Request {
+	return sip.NewRequest(
+		"",
+		sip.INVITE,
+		&sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"},
+		"SIP/2.0",
+		[]sip.Header{
+			&sip.FromHeader{
+				DisplayName: sip.String{Str: "Alice"},
+				Address:     &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "wonderland.com"},
+				Params:      sip.NewParams().Add("tag", sip.String{Str: "1928301774"}),
+			},
+			&sip.ToHeader{
+				Address: &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"},
+				Params:  toParams,
+			},
+		},
+		"",
+		nil,
+	)
+}
+
+func TestRewriteCallerID(t *testing.T) {
+	req := newCallerIDRequest(nil)
+	err := sip.RewriteCallerID(req, sip.CallerID{
+		DisplayName: sip.String{Str: "Operator"},
+		User:        sip.String{Str: "100"},
+		AssertedIdentity: &sip.Address{
+			Uri: &sip.SipUri{FUser: sip.String{Str: "100"}, FHost: "wonderland.com"},
+		},
+		History: sip.CallerIDHistoryDiversion,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	from, _ := req.From()
+	if expected := "\"Operator\" <sip:100@wonderland.com>;tag=1928301774"; from.Value() != expected {
+		t.Errorf("expected From '%s', got '%s'", expected, from.Value())
+	}
+	if hdrs := req.GetHeaders("P-Asserted-Identity"); len(hdrs) != 1 || hdrs[0].Value() != "<sip:100@wonderland.com>" {
+		t.Errorf("unexpected P-Asserted-Identity headers: %v", hdrs)
+	}
+	expected := "\"Alice\" <sip:alice@wonderland.com>;reason=unknown;counter=1"
+	if hdrs := req.GetHeaders("Diversion"); len(hdrs) != 1 || hdrs[0].Value() != expected {
+		t.Errorf("expected Diversion '%s', got %v", expected, hdrs)
+	}
+}
+
+func TestRewriteCallerIDHistoryInfo(t *testing.T) {
+	req := newCallerIDRequest(nil)
+	if err := sip.RewriteCallerID(req, sip.CallerID{
+		User:    sip.String{Str: "100"},
+		History: sip.CallerIDHistoryInfo,
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if hdrs := req.GetHeaders("History-Info"); len(hdrs) != 1 || hdrs[0].Value() != "<sip:alice@wonderland.com>;index=1" {
+		t.Errorf("unexpected History-Info headers: %v", hdrs)
+	}
+}
+
+func TestRewriteCallerIDInDialog(t *testing.T) {
+	req := newCallerIDRequest(sip.NewParams().Add("tag", sip.String{Str: "a6c85cf"}))
+	if err := sip.RewriteCallerID(req, sip.CallerID{
+		User:    sip.String{Str: "100"},
+		History: sip.CallerIDHistoryInfo,
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	from, _ := req.From()
+	if from.Address.User().String() != "100" {
+		t.Errorf("expected From user '100', got '%s'", from.Address.User())
+	}
+	if hdrs := req.GetHeaders("History-Info"); len(hdrs) != 0 {
+		t.Errorf("expected no History-Info on in-dialog request, got %v", hdrs)
+	}
+}
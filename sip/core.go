@@ -274,6 +274,7 @@ type BrokenMessageError struct {
 	Msg string
 }
 
+func (err *BrokenMessageError) Unwrap() error   { return err.Err }
 func (err *BrokenMessageError) Malformed() bool { return false }
 func (err *BrokenMessageError) Broken() bool    { return true }
 func (err *BrokenMessageError) Error() string {
@@ -295,6 +296,7 @@ type MalformedMessageError struct {
 	Msg string
 }
 
+func (err *MalformedMessageError) Unwrap() error   { return err.Err }
 func (err *MalformedMessageError) Malformed() bool { return true }
 func (err *MalformedMessageError) Broken() bool    { return false }
 func (err *MalformedMessageError) Error() string {
@@ -315,6 +317,7 @@ type UnsupportedMessageError struct {
 	Msg string
 }
 
+func (err *UnsupportedMessageError) Unwrap() error   { return err.Err }
 func (err *UnsupportedMessageError) Malformed() bool { return true }
 func (err *UnsupportedMessageError) Broken() bool    { return false }
 func (err *UnsupportedMessageError) Error() string {
@@ -360,22 +363,13 @@ func GenerateBranch() string {
 	}, ".")
 }
 
-// DefaultPort returns protocol default port by network.
+// DefaultPort returns protocol default port by network, see LookupTransportProto.
+// Default port of unknown protocol is DefaultTcpPort.
 func DefaultPort(protocol string) Port {
-	switch strings.ToLower(protocol) {
-	case "tls":
-		return DefaultTlsPort
-	case "tcp":
-		return DefaultTcpPort
-	case "udp":
-		return DefaultUdpPort
-	case "ws":
-		return DefaultWsPort
-	case "wss":
-		return DefaultWssPort
-	default:
-		return DefaultTcpPort
+	if proto, ok := LookupTransportProto(protocol); ok {
+		return proto.DefaultPort
 	}
+	return DefaultTcpPort
 }
 
 func MakeDialogIDFromMessage(msg Message) (string, error) {
@@ -0,0 +1,106 @@
+package sip
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Beginning of the next credentials or challenge in the comma-separated list: auth-scheme followed by auth-param.
+var authSchemeStart = regexp.MustCompile(`^\s*[A-Za-z][\w-]*\s+[\w-]+\s*=`)
+
+// SplitAuthValues splits value of Authorization, Proxy-Authorization, WWW-Authenticate
+// or Proxy-Authenticate header that holds several comma-separated credentials (challenges)
+// like 'Digest realm="a",nonce="1", Digest realm="b",nonce="2"'.
+func SplitAuthValues(value string) []string {
+	values := make([]string, 0, 1)
+
+	start, quoted := 0, false
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted && authSchemeStart.MatchString(value[i+1:]) {
+				values = append(values, strings.TrimSpace(value[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if v := strings.TrimSpace(value[start:]); v != "" {
+		values = append(values, v)
+	}
+
+	return values
+}
+
+// Credentials returns credentials of all headers with the name (e.g. Authorization or Proxy-Authorization)
+// in order of appearance, values with several credentials are split.
+func Credentials(msg Message, headerName string) []*Authorization {
+	creds := make([]*Authorization, 0)
+	for _, value := range authValues(msg, headerName) {
+		creds = append(creds, AuthFromValue(value))
+	}
+	return creds
+}
+
+// CredentialsByRealm returns credentials for the realm from headers with the name.
+func CredentialsByRealm(msg Message, headerName, realm string) (*Authorization, bool) {
+	for _, auth := range Credentials(msg, headerName) {
+		if auth.Realm() == realm {
+			return auth, true
+		}
+	}
+	return nil, false
+}
+
+// SetCredentials replaces credentials for the realm of auth keeping their position,
+// or appends them as a new header if there are no credentials for the realm.
+// Headers with the name are re-rendered one credentials per header, untouched credentials are kept verbatim.
+// This allows stacking of Proxy-Authorization headers for each realm traversed by the request - RFC 3261 22.3.
+func SetCredentials(msg Message, headerName string, auth *Authorization) {
+	values := authValues(msg, headerName)
+	replaced := false
+	for i, value := range values {
+		if AuthFromValue(value).Realm() == auth.Realm() {
+			values[i] = auth.String()
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		values = append(values, auth.String())
+	}
+
+	// keep header name as it was sent
+	existing := msg.GetHeaders(headerName)
+	if len(existing) > 0 {
+		headerName = existing[0].Name()
+	}
+	headers := make([]Header, 0, len(values))
+	for _, value := range values {
+		headers = append(headers, &GenericHeader{
+			HeaderName: headerName,
+			Contents:   value,
+		})
+	}
+
+	if len(existing) > 0 {
+		msg.ReplaceHeaders(headerName, headers)
+		return
+	}
+	for _, header := range headers {
+		msg.AppendHeader(header)
+	}
+}
+
+func authValues(msg Message, headerName string) []string {
+	values := make([]string, 0)
+	for _, hdr := range msg.GetHeaders(headerName) {
+		values = append(values, SplitAuthValues(hdr.Value())...)
+	}
+	return values
+}
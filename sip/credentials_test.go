@@ -0,0 +1,79 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestSplitAuthValues(t *testing.T) {
+	values := sip.SplitAuthValues(`Digest realm="a, b",qop="auth,auth-int",nonce="1", Digest realm="c",nonce="2"`)
+	expected := []string{`Digest realm="a, b",qop="auth,auth-int",nonce="1"`, `Digest realm="c",nonce="2"`}
+	if len(values) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, values)
+	}
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], values[i])
+		}
+	}
+}
+
+func TestCredentialsStacking(t *testing.T) {
+	req := sip.NewRequest("", sip.INVITE, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", []sip.Header{
+		&sip.GenericHeader{
+			HeaderName: "Proxy-Authorization",
+			Contents:   `Digest realm="p1",username="alice",opaque="x", Digest realm="p2",username="alice"`,
+		},
+		&sip.GenericHeader{HeaderName: "Max-Forwards", Contents: "70"},
+	}, "", nil)
+
+	creds := sip.Credentials(req, "Proxy-Authorization")
+	if len(creds) != 2 || creds[0].Realm() != "p1" || creds[1].Realm() != "p2" {
+		t.Fatalf("unexpected credentials: %v", creds)
+	}
+	if auth, ok := sip.CredentialsByRealm(req, "proxy-authorization", "p2"); !ok || auth.Username() != "alice" {
+		t.Errorf("credentials for realm p2 not found")
+	}
+
+	sip.SetCredentials(req, "Proxy-Authorization", sip.AuthFromValue(`Digest realm="p3",username="bob"`))
+	sip.SetCredentials(req, "Proxy-Authorization", sip.AuthFromValue(`Digest realm="p2",username="bob"`))
+
+	hdrs := req.GetHeaders("Proxy-Authorization")
+	if len(hdrs) != 3 {
+		t.Fatalf("expected 3 headers, got %d", len(hdrs))
+	}
+	if hdrs[0].Value() != `Digest realm="p1",username="alice",opaque="x"` {
+		t.Errorf("untouched credentials must be kept verbatim, got %s", hdrs[0].Value())
+	}
+	for i, realm := range []string{"p1", "p2", "p3"} {
+		if auth := sip.AuthFromValue(hdrs[i].Value()); auth.Realm() != realm {
+			t.Errorf("expected realm %s at %d, got %s", realm, i, auth.Realm())
+		}
+	}
+	if auth, _ := sip.CredentialsByRealm(req, "Proxy-Authorization", "p2"); auth.Username() != "bob" {
+		t.Errorf("credentials for realm p2 must be replaced")
+	}
+	if all := req.Headers(); all[0].Name() != "Proxy-Authorization" || all[len(all)-1].Name() != "Max-Forwards" {
+		t.Errorf("header order must be kept")
+	}
+}
+
+func TestAuthorizeRequestMultipleRealms(t *testing.T) {
+	req := sip.NewRequest("", sip.INVITE, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", []sip.Header{
+		&sip.CSeq{SeqNo: 1, MethodName: sip.INVITE},
+	}, "", nil)
+	res := sip.NewResponse("", "SIP/2.0", 407, "Proxy Authentication Required", []sip.Header{
+		&sip.GenericHeader{HeaderName: "Proxy-Authenticate", Contents: `Digest realm="p1",nonce="1"`},
+		&sip.GenericHeader{HeaderName: "Proxy-Authenticate", Contents: `Digest realm="p2",nonce="2"`},
+	}, "", nil)
+
+	if err := sip.AuthorizeRequest(req, res, sip.String{Str: "alice"}, sip.String{Str: "secret"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	creds := sip.Credentials(req, "Proxy-Authorization")
+	if len(creds) != 2 || creds[0].Realm() != "p1" || creds[1].Realm() != "p2" {
+		t.Fatalf("unexpected credentials: %v", creds)
+	}
+}
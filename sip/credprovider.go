@@ -0,0 +1,116 @@
+package sip
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secret is a digest authentication secret for a realm.
+type Secret struct {
+	Username string
+	Password string
+	// HA1 is precomputed MD5(username:realm:password), used instead of Password if not empty.
+	HA1 string
+}
+
+// CredentialProvider looks up secrets for digest authentication
+// by challenged realm and target (Request-URI) of the request.
+// Secrets are requested on each authorization, so they can be kept in a vault or keyring
+// instead of long-lived structs.
+type CredentialProvider interface {
+	Lookup(realm, target string) (*Secret, error)
+}
+
+// CredentialsNotFoundError is returned by providers that have no secret for the realm.
+type CredentialsNotFoundError struct {
+	Realm  string
+	Target string
+}
+
+func (err *CredentialsNotFoundError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("credentials for realm '%s' and target '%s' not found", err.Realm, err.Target)
+}
+
+// CredentialProviderFunc is an adapter to use ordinary functions as CredentialProvider.
+type CredentialProviderFunc func(realm, target string) (*Secret, error)
+
+func (fn CredentialProviderFunc) Lookup(realm, target string) (*Secret, error) {
+	return fn(realm, target)
+}
+
+// StaticCredentials provides secrets from static configuration.
+type StaticCredentials struct {
+	// Realms holds secrets per realm.
+	Realms map[string]*Secret
+	// Default is used for realms missing in Realms, can be nil.
+	Default *Secret
+}
+
+func (creds *StaticCredentials) Lookup(realm, target string) (*Secret, error) {
+	if secret, ok := creds.Realms[realm]; ok {
+		return secret, nil
+	}
+	if creds.Default != nil {
+		return creds.Default, nil
+	}
+
+	return nil, &CredentialsNotFoundError{realm, target}
+}
+
+// EnvCredentials provides secrets from environment variables
+// <Prefix>_<REALM>_USERNAME, <Prefix>_<REALM>_PASSWORD and <Prefix>_<REALM>_HA1,
+// where REALM is the upper-cased realm with all characters except letters and digits replaced by '_'.
+// Variables without realm part (<Prefix>_USERNAME etc) are used as a fallback.
+// Variables are read on each lookup.
+type EnvCredentials struct {
+	Prefix string
+}
+
+func (creds *EnvCredentials) Lookup(realm, target string) (*Secret, error) {
+	prefixes := []string{
+		creds.Prefix + "_" + envRealm(realm) + "_",
+		creds.Prefix + "_",
+	}
+	for _, prefix := range prefixes {
+		username, ok := os.LookupEnv(prefix + "USERNAME")
+		if !ok {
+			continue
+		}
+
+		return &Secret{
+			Username: username,
+			Password: os.Getenv(prefix + "PASSWORD"),
+			HA1:      os.Getenv(prefix + "HA1"),
+		}, nil
+	}
+
+	return nil, &CredentialsNotFoundError{realm, target}
+}
+
+func envRealm(realm string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, realm)
+}
+
+// staticSecret adapts plain user and password to CredentialProvider for any realm.
+func staticSecret(user, password MaybeString) CredentialProvider {
+	secret := &Secret{Username: user.String()}
+	if password != nil {
+		secret.Password = password.String()
+	}
+
+	return &StaticCredentials{Default: secret}
+}
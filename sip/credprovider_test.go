@@ -0,0 +1,66 @@
+package sip_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestCredentialProviders(t *testing.T) {
+	static := &sip.StaticCredentials{
+		Realms: map[string]*sip.Secret{"a.example.com": {Username: "alice", Password: "secret"}},
+	}
+	if secret, err := static.Lookup("a.example.com", "sip:bob@example.com"); err != nil || secret.Username != "alice" {
+		t.Errorf("unexpected lookup result %v, %v", secret, err)
+	}
+	if _, err := static.Lookup("b.example.com", "sip:bob@example.com"); err == nil {
+		t.Errorf("error expected for unknown realm")
+	} else if _, ok := err.(*sip.CredentialsNotFoundError); !ok {
+		t.Errorf("unexpected error %s", err)
+	}
+
+	os.Setenv("GOSIP_TEST_A_EXAMPLE_COM_USERNAME", "carol")
+	os.Setenv("GOSIP_TEST_A_EXAMPLE_COM_HA1", "0123")
+	defer os.Unsetenv("GOSIP_TEST_A_EXAMPLE_COM_USERNAME")
+	defer os.Unsetenv("GOSIP_TEST_A_EXAMPLE_COM_HA1")
+	env := &sip.EnvCredentials{Prefix: "GOSIP_TEST"}
+	if secret, err := env.Lookup("a.example.com", ""); err != nil || secret.Username != "carol" || secret.HA1 != "0123" {
+		t.Errorf("unexpected lookup result %v, %v", secret, err)
+	}
+	if _, err := env.Lookup("b.example.com", ""); err == nil {
+		t.Errorf("error expected for unknown realm")
+	}
+}
+
+func TestAuthorizeRequestWithHA1(t *testing.T) {
+	newRequest := func() sip.Request {
+		return sip.NewRequest("", sip.REGISTER, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+	}
+	res := sip.NewResponse("", "SIP/2.0", 401, "Unauthorized", []sip.Header{
+		&sip.GenericHeader{HeaderName: "WWW-Authenticate", Contents: `Digest realm="example.com",nonce="abc",qop="auth"`},
+	}, "", nil)
+
+	hashed := newRequest()
+	provider := sip.CredentialProviderFunc(func(realm, target string) (*sip.Secret, error) {
+		return &sip.Secret{Username: "alice", HA1: sip.CalcHA1("alice", realm, "secret")}, nil
+	})
+	if err := sip.AuthorizeRequestWithProvider(hashed, res, provider); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	auth, _ := sip.CredentialsByRealm(hashed, "Authorization", "example.com")
+	expected := sip.AuthFromValue(auth.String()).
+		SetMethod(string(sip.REGISTER)).
+		SetPassword("secret")
+	if auth.Response() != expected.CalcResponse() {
+		t.Errorf("response calculated with HA1 %s differs from %s", auth.Response(), expected.CalcResponse())
+	}
+
+	failing := sip.CredentialProviderFunc(func(realm, target string) (*sip.Secret, error) {
+		return nil, &sip.CredentialsNotFoundError{Realm: realm, Target: target}
+	})
+	if err := sip.AuthorizeRequestWithProvider(newRequest(), res, failing); err == nil {
+		t.Errorf("error expected")
+	}
+}
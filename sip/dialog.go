@@ -0,0 +1,654 @@
+package sip
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type DialogState int
+
+const (
+	DialogEarly DialogState = iota
+	DialogConfirmed
+	DialogTerminated
+)
+
+func (state DialogState) String() string {
+	switch state {
+	case DialogEarly:
+		return "Early"
+	case DialogConfirmed:
+		return "Confirmed"
+	case DialogTerminated:
+		return "Terminated"
+	default:
+		return fmt.Sprintf("DialogState(%d)", int(state))
+	}
+}
+
+// DialogError is returned when a message doesn't fit the dialog.
+// StatusCode is the response code the UAS should reject the request with.
+type DialogError struct {
+	DialogID   string
+	StatusCode StatusCode
+	Reason     string
+}
+
+func (err *DialogError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("sip.DialogError<%s>: %s", err.DialogID, err.Reason)
+}
+
+// Is reports whether the error rejects request of unknown or terminated dialog,
+// so errors.Is(err, ErrDialogNotFound) can be used instead of checking the status code.
+func (err *DialogError) Is(target error) bool {
+	return target == ErrDialogNotFound && err.StatusCode == 481
+}
+
+// Dialog is a peer-to-peer relationship between two UAs - RFC 3261 12.
+// It is created with NewDialogUAC or NewDialogUAS from the dialog creating request and the response on it,
+// builds in-dialog requests and validates incoming ones.
+type Dialog struct {
+	mu           sync.Mutex
+	callID       string
+	localTag     string
+	remoteTag    string
+	localUri     Uri
+	remoteUri    Uri
+	localTarget  Uri
+	remoteTarget Uri
+	routeSet     []Uri
+	localSeq     uint32
+	remoteSeq    uint32
+	inviteSeq    uint32
+	secure       bool
+	state        DialogState
+	offerAnswer  *OfferAnswer
+	onRefreshFns []func(Request)
+	history      *DialogHistory
+	onFailureFns []DialogFailureFunc
+}
+
+// DialogFailureFunc is called when the dialog is terminated because of failure,
+// history is nil if the dialog history is not enabled.
+type DialogFailureFunc func(err *DialogError, history []DialogHistoryEntry)
+
+// NewDialogUAC creates dialog on the UAC side from the sent request and the received
+// 1xx (with 'To' tag) or 2xx response on it - RFC 3261 12.1.2.
+func NewDialogUAC(req Request, res Response) (*Dialog, error) {
+	if err := checkDialogResponse(res); err != nil {
+		return nil, err
+	}
+
+	dlg := &Dialog{
+		routeSet:    reverseUris(RecordRoutes(res)),
+		secure:      req.Recipient().IsEncrypted(),
+		offerAnswer: NewOfferAnswer(),
+	}
+	if err := dlg.init(res, false); err != nil {
+		return nil, err
+	}
+	if contact, ok := res.Contact(); ok {
+		dlg.remoteTarget = contact.Address.Clone()
+	}
+	if contact, ok := req.Contact(); ok {
+		dlg.localTarget = contact.Address.Clone()
+	}
+	if cseq, ok := req.CSeq(); ok {
+		dlg.localSeq = cseq.SeqNo
+		if cseq.MethodName == INVITE {
+			dlg.inviteSeq = cseq.SeqNo
+		}
+	}
+	if res.IsSuccess() {
+		dlg.state = DialogConfirmed
+	}
+	// violations of the initial exchange don't prevent the dialog creation,
+	// the UAC still must ACK 2xx and may send BYE then - RFC 3261 13.2.1
+	if req.IsInvite() {
+		_ = dlg.offerAnswer.Sent(req)
+		_ = dlg.offerAnswer.Received(res)
+	}
+
+	return dlg, nil
+}
+
+// NewDialogUAS creates dialog on the UAS side from the received request and the sent
+// 1xx (with 'To' tag) or 2xx response on it - RFC 3261 12.1.1.
+func NewDialogUAS(req Request, res Response) (*Dialog, error) {
+	if err := checkDialogResponse(res); err != nil {
+		return nil, err
+	}
+
+	dlg := &Dialog{
+		routeSet:    RecordRoutes(req),
+		secure:      req.Recipient().IsEncrypted(),
+		offerAnswer: NewOfferAnswer(),
+	}
+	if err := dlg.init(res, true); err != nil {
+		return nil, err
+	}
+	if contact, ok := req.Contact(); ok {
+		dlg.remoteTarget = contact.Address.Clone()
+	}
+	if contact, ok := res.Contact(); ok {
+		dlg.localTarget = contact.Address.Clone()
+	}
+	if cseq, ok := req.CSeq(); ok {
+		dlg.remoteSeq = cseq.SeqNo
+	}
+	if res.IsSuccess() {
+		dlg.state = DialogConfirmed
+	}
+	if req.IsInvite() {
+		_ = dlg.offerAnswer.Received(req)
+		_ = dlg.offerAnswer.Sent(res)
+	}
+
+	return dlg, nil
+}
+
+func checkDialogResponse(res Response) error {
+	if !res.IsProvisional() && !res.IsSuccess() || res.StatusCode() == 100 {
+		return fmt.Errorf("response %s can not create a dialog", res.Short())
+	}
+	if cseq, ok := res.CSeq(); !ok || cseq.MethodName != INVITE && cseq.MethodName != SUBSCRIBE && cseq.MethodName != REFER {
+		return fmt.Errorf("response %s is not on a dialog creating request", res.Short())
+	}
+	if _, ok := res.Contact(); !ok {
+		return fmt.Errorf("missing Contact header in %s", res.Short())
+	}
+
+	return nil
+}
+
+// Initializes dialog identifiers from the response, uas flag swaps local and remote sides.
+func (dlg *Dialog) init(res Response, uas bool) error {
+	callID, ok := res.CallID()
+	if !ok {
+		return fmt.Errorf("missing Call-ID header in %s", res.Short())
+	}
+	from, ok := res.From()
+	if !ok {
+		return fmt.Errorf("missing From header in %s", res.Short())
+	}
+	to, ok := res.To()
+	if !ok {
+		return fmt.Errorf("missing To header in %s", res.Short())
+	}
+
+	var fromTag, toTag string
+	if tag, ok := from.Params.Get("tag"); ok && tag != nil {
+		fromTag = tag.String()
+	}
+	if to.Params != nil {
+		if tag, ok := to.Params.Get("tag"); ok && tag != nil {
+			toTag = tag.String()
+		}
+	}
+	if toTag == "" {
+		return fmt.Errorf("missing tag param in To header of %s", res.Short())
+	}
+
+	dlg.callID = string(*callID)
+	if uas {
+		dlg.localTag, dlg.remoteTag = toTag, fromTag
+		dlg.localUri, dlg.remoteUri = to.Address.Clone(), from.Address.Clone()
+	} else {
+		dlg.localTag, dlg.remoteTag = fromTag, toTag
+		dlg.localUri, dlg.remoteUri = from.Address.Clone(), to.Address.Clone()
+	}
+
+	return nil
+}
+
+// ID returns dialog ID in the form of MakeDialogID(Call-ID, local tag, remote tag).
+func (dlg *Dialog) ID() string {
+	return MakeDialogID(dlg.callID, dlg.localTag, dlg.remoteTag)
+}
+
+func (dlg *Dialog) CallID() string    { return dlg.callID }
+func (dlg *Dialog) LocalTag() string  { return dlg.localTag }
+func (dlg *Dialog) RemoteTag() string { return dlg.remoteTag }
+func (dlg *Dialog) Secure() bool      { return dlg.secure }
+
+func (dlg *Dialog) State() DialogState {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	return dlg.state
+}
+
+func (dlg *Dialog) LocalSeq() uint32 {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	return dlg.localSeq
+}
+
+func (dlg *Dialog) RemoteSeq() uint32 {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	return dlg.remoteSeq
+}
+
+func (dlg *Dialog) RemoteTarget() Uri {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	return dlg.remoteTarget.Clone()
+}
+
+func (dlg *Dialog) RouteSet() []Uri {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	return cloneUris(dlg.routeSet)
+}
+
+// OfferAnswer returns offer/answer state of the INVITE dialog usage.
+func (dlg *Dialog) OfferAnswer() *OfferAnswer {
+	return dlg.offerAnswer
+}
+
+// Terminate moves dialog to the terminated state.
+func (dlg *Dialog) Terminate() {
+	dlg.mu.Lock()
+	dlg.state = DialogTerminated
+	dlg.mu.Unlock()
+}
+
+// EnableHistory starts recording of the last size messages sent and received within the dialog,
+// bodies are truncated to maxBody bytes. Messages recorded before are kept if the history is already enabled.
+func (dlg *Dialog) EnableHistory(size, maxBody int) *DialogHistory {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	history := NewDialogHistory(size, maxBody)
+	if dlg.history != nil {
+		for _, entry := range dlg.history.Entries() {
+			history.add(entry)
+		}
+	}
+	dlg.history = history
+	return history
+}
+
+// History returns the dialog history, nil if it is not enabled.
+func (dlg *Dialog) History() *DialogHistory {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+	return dlg.history
+}
+
+// OnFailure registers callback that is called when the dialog is terminated because of failure:
+// 408 or 481 response, failure response on the dialog creating INVITE or Fail call.
+// The callback receives the dialog history to dump it for the investigation.
+func (dlg *Dialog) OnFailure(fn DialogFailureFunc) {
+	dlg.mu.Lock()
+	dlg.onFailureFns = append(dlg.onFailureFns, fn)
+	dlg.mu.Unlock()
+}
+
+// Fail terminates the dialog because of failure detected by the application,
+// e.g. ACK or BYE transaction timeout, and calls OnFailure callbacks.
+// Terminated dialog is not changed.
+func (dlg *Dialog) Fail(reason string) {
+	dlg.mu.Lock()
+	if dlg.state == DialogTerminated {
+		dlg.mu.Unlock()
+		return
+	}
+	dlg.state = DialogTerminated
+	dlg.mu.Unlock()
+
+	dlg.failed(&DialogError{DialogID: dlg.ID(), Reason: reason})
+}
+
+// Calls OnFailure callbacks.
+func (dlg *Dialog) failed(err *DialogError) {
+	dlg.mu.Lock()
+	callbacks := make([]DialogFailureFunc, len(dlg.onFailureFns))
+	copy(callbacks, dlg.onFailureFns)
+	history := dlg.history
+	dlg.mu.Unlock()
+
+	var entries []DialogHistoryEntry
+	if history != nil {
+		entries = history.Entries()
+	}
+	for _, fn := range callbacks {
+		fn(err, entries)
+	}
+}
+
+// Records message to the history if it is enabled. Should be called under lock.
+func (dlg *Dialog) record(msg Message, outgoing bool) {
+	if dlg.history != nil {
+		dlg.history.Add(msg, outgoing)
+	}
+}
+
+// NewRequest builds in-dialog request - RFC 3261 12.2.1.1.
+// Local CSeq is incremented for every request except ACK that takes CSeq of the last INVITE.
+// The route set with strict router on top is handled as described in RFC 3261 12.2.1.1.
+// ACK or PRACK without body that must answer the offer from the response takes the answer
+// from the function registered with OfferAnswer().OnAnswerRequired, the function must not call dialog methods.
+func (dlg *Dialog) NewRequest(method RequestMethod, body string) (Request, error) {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	if dlg.state == DialogTerminated {
+		return nil, &DialogError{dlg.ID(), 481, "dialog is terminated"}
+	}
+	if method == CANCEL {
+		return nil, fmt.Errorf("CANCEL is not an in-dialog request")
+	}
+
+	localSeq, inviteSeq := dlg.localSeq, dlg.inviteSeq
+	rollback := func() {
+		dlg.localSeq, dlg.inviteSeq = localSeq, inviteSeq
+	}
+
+	var seq uint32
+	if method == ACK {
+		if dlg.inviteSeq == 0 {
+			return nil, fmt.Errorf("no INVITE to acknowledge in dialog %s", dlg.ID())
+		}
+		seq = dlg.inviteSeq
+	} else {
+		dlg.localSeq++
+		seq = dlg.localSeq
+		if method == INVITE {
+			dlg.inviteSeq = seq
+		}
+	}
+
+	var contentType *ContentType
+	if body == "" {
+		answer, err := dlg.offerAnswer.requiredAnswer(method, seq)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if answer != "" {
+			body = answer
+			ct := ContentType("application/sdp")
+			contentType = &ct
+		}
+	}
+
+	recipient, routes := routeTarget(dlg.remoteTarget.Clone(), cloneUris(dlg.routeSet))
+
+	callID := CallID(dlg.callID)
+	maxForwards := MaxForwards(70)
+	hdrs := []Header{
+		&FromHeader{
+			Address: dlg.localUri.Clone(),
+			Params:  NewParams().Add("tag", String{Str: dlg.localTag}),
+		},
+		&ToHeader{
+			Address: dlg.remoteUri.Clone(),
+			Params:  NewParams().Add("tag", String{Str: dlg.remoteTag}),
+		},
+		&callID,
+		&CSeq{SeqNo: seq, MethodName: method},
+		&maxForwards,
+	}
+	if len(routes) > 0 {
+		hdrs = append(hdrs, &RouteHeader{Addresses: routes})
+	}
+	if dlg.localTarget != nil && method != ACK && method != BYE {
+		hdrs = append(hdrs, &ContactHeader{Address: dlg.localTarget.Clone()})
+	}
+	if contentType != nil {
+		hdrs = append(hdrs, contentType)
+	}
+	length := ContentLength(len(body))
+	hdrs = append(hdrs, &length)
+
+	req := NewRequest("", method, recipient, "SIP/2.0", hdrs, body, nil)
+	if err := dlg.offerAnswer.Sent(req); err != nil {
+		rollback()
+		return nil, err
+	}
+	dlg.record(req, true)
+
+	return req, nil
+}
+
+// ReceiveRequest validates request received within the dialog and updates the dialog state - RFC 3261 12.2.2.
+// Out of order request is rejected with DialogError with 500 status code.
+func (dlg *Dialog) ReceiveRequest(req Request) error {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	dlg.record(req, false)
+	if dlg.state == DialogTerminated {
+		return &DialogError{dlg.ID(), 481, "dialog is terminated"}
+	}
+
+	cseq, ok := req.CSeq()
+	if !ok {
+		return fmt.Errorf("missing CSeq header in %s", req.Short())
+	}
+	if req.IsAck() {
+		return dlg.offerAnswerError(dlg.offerAnswer.Received(req))
+	}
+	if req.IsCancel() {
+		return nil
+	}
+	if dlg.remoteSeq != 0 && cseq.SeqNo <= dlg.remoteSeq {
+		return &DialogError{
+			DialogID:   dlg.ID(),
+			StatusCode: 500,
+			Reason:     fmt.Sprintf("CSeq %d is out of order, last is %d", cseq.SeqNo, dlg.remoteSeq),
+		}
+	}
+	dlg.remoteSeq = cseq.SeqNo
+
+	switch {
+	case req.IsInvite() || req.Method() == UPDATE:
+		if contact, ok := req.Contact(); ok {
+			dlg.remoteTarget = contact.Address.Clone()
+		}
+	case req.Method() == BYE:
+		dlg.state = DialogTerminated
+	}
+
+	return dlg.offerAnswerError(dlg.offerAnswer.Received(req))
+}
+
+// SendResponse updates the offer/answer state with the response sent on in-dialog request.
+func (dlg *Dialog) SendResponse(res Response) error {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	dlg.record(res, true)
+	if res.IsSuccess() {
+		if cseq, ok := res.CSeq(); ok && cseq.MethodName == INVITE && dlg.state == DialogEarly {
+			dlg.state = DialogConfirmed
+		}
+	}
+	return dlg.offerAnswer.Sent(res)
+}
+
+// Converts offer/answer error of the received request to DialogError with the status code to reject the request.
+func (dlg *Dialog) offerAnswerError(err error) error {
+	if oaErr, ok := err.(*OfferAnswerError); ok && oaErr.StatusCode != 0 {
+		return &DialogError{dlg.ID(), oaErr.StatusCode, oaErr.Reason}
+	}
+	return err
+}
+
+// ReceiveResponse updates the dialog with the response on in-dialog request or on the dialog creating INVITE.
+// 2xx confirms early dialog and refreshes remote target, 481 and 408 terminate the dialog - RFC 3261 12.2.1.2.
+// Returns OfferAnswerError if the session description in the response breaks the offer/answer sequence.
+// Dialog terminated by the failure response calls OnFailure callbacks.
+func (dlg *Dialog) ReceiveResponse(res Response) error {
+	failure, err := dlg.receiveResponse(res)
+	if failure != nil {
+		dlg.failed(failure)
+	}
+	return err
+}
+
+func (dlg *Dialog) receiveResponse(res Response) (*DialogError, error) {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	dlg.record(res, false)
+	cseq, ok := res.CSeq()
+	if !ok || dlg.state == DialogTerminated {
+		return nil, nil
+	}
+
+	var failure *DialogError
+	switch {
+	case res.StatusCode() == 481 || res.StatusCode() == 408:
+		dlg.state = DialogTerminated
+		failure = &DialogError{dlg.ID(), res.StatusCode(), fmt.Sprintf("dialog terminated by %s", res.Short())}
+	case res.IsSuccess():
+		if cseq.MethodName == BYE {
+			dlg.state = DialogTerminated
+			return nil, nil
+		}
+		if cseq.MethodName == INVITE || cseq.MethodName == UPDATE {
+			if contact, ok := res.Contact(); ok {
+				dlg.remoteTarget = contact.Address.Clone()
+			}
+		}
+		if dlg.state == DialogEarly && cseq.MethodName == INVITE {
+			dlg.state = DialogConfirmed
+		}
+	case dlg.state == DialogEarly && cseq.MethodName == INVITE && res.StatusCode() >= 300:
+		dlg.state = DialogTerminated
+		failure = &DialogError{dlg.ID(), res.StatusCode(), fmt.Sprintf("early dialog terminated by %s", res.Short())}
+	}
+
+	return failure, dlg.offerAnswer.Received(res)
+}
+
+// DialogSnapshot is a serializable state of a Dialog, URIs are stored in the string form.
+type DialogSnapshot struct {
+	CallID       string
+	LocalTag     string
+	RemoteTag    string
+	LocalUri     string
+	RemoteUri    string
+	LocalTarget  string
+	RemoteTarget string
+	RouteSet     []string
+	LocalSeq     uint32
+	RemoteSeq    uint32
+	InviteSeq    uint32
+	Secure       bool
+	State        DialogState
+	TakenAt      time.Time
+}
+
+func (dlg *Dialog) Snapshot() DialogSnapshot {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+
+	snapshot := DialogSnapshot{
+		CallID:       dlg.callID,
+		LocalTag:     dlg.localTag,
+		RemoteTag:    dlg.remoteTag,
+		LocalUri:     dlg.localUri.String(),
+		RemoteUri:    dlg.remoteUri.String(),
+		RemoteTarget: dlg.remoteTarget.String(),
+		LocalSeq:     dlg.localSeq,
+		RemoteSeq:    dlg.remoteSeq,
+		InviteSeq:    dlg.inviteSeq,
+		Secure:       dlg.secure,
+		State:        dlg.state,
+		TakenAt:      time.Now(),
+	}
+	if dlg.localTarget != nil {
+		snapshot.LocalTarget = dlg.localTarget.String()
+	}
+	for _, uri := range dlg.routeSet {
+		snapshot.RouteSet = append(snapshot.RouteSet, uri.String())
+	}
+
+	return snapshot
+}
+
+// RestoreDialog creates a Dialog from the snapshot.
+// The sip package doesn't parse URIs, so parseUri is usually parser.ParseUri.
+func RestoreDialog(snapshot DialogSnapshot, parseUri func(uri string) (Uri, error)) (*Dialog, error) {
+	dlg := &Dialog{
+		callID:    snapshot.CallID,
+		localTag:  snapshot.LocalTag,
+		remoteTag: snapshot.RemoteTag,
+		localSeq:  snapshot.LocalSeq,
+		remoteSeq: snapshot.RemoteSeq,
+		inviteSeq: snapshot.InviteSeq,
+		secure:    snapshot.Secure,
+		state:     snapshot.State,
+		// the exchange is not restored, the next offer starts a new one
+		offerAnswer: NewOfferAnswer(),
+	}
+
+	var err error
+	if dlg.localUri, err = parseUri(snapshot.LocalUri); err != nil {
+		return nil, fmt.Errorf("restore dialog local URI: %w", err)
+	}
+	if dlg.remoteUri, err = parseUri(snapshot.RemoteUri); err != nil {
+		return nil, fmt.Errorf("restore dialog remote URI: %w", err)
+	}
+	if dlg.remoteTarget, err = parseUri(snapshot.RemoteTarget); err != nil {
+		return nil, fmt.Errorf("restore dialog remote target: %w", err)
+	}
+	if snapshot.LocalTarget != "" {
+		if dlg.localTarget, err = parseUri(snapshot.LocalTarget); err != nil {
+			return nil, fmt.Errorf("restore dialog local target: %w", err)
+		}
+	}
+	for _, s := range snapshot.RouteSet {
+		uri, err := parseUri(s)
+		if err != nil {
+			return nil, fmt.Errorf("restore dialog route set: %w", err)
+		}
+		dlg.routeSet = append(dlg.routeSet, uri)
+	}
+
+	return dlg, nil
+}
+
+func (dlg *Dialog) String() string {
+	if dlg == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("sip.Dialog<%s>", dlg.ID())
+}
+
+func isLooseRouter(uri Uri) bool {
+	if params := uri.UriParams(); params != nil {
+		return params.Has("lr")
+	}
+	return false
+}
+
+func reverseUris(uris []Uri) []Uri {
+	reversed := make([]Uri, len(uris))
+	for i, uri := range uris {
+		reversed[len(uris)-1-i] = uri
+	}
+	return reversed
+}
+
+func cloneUris(uris []Uri) []Uri {
+	cloned := make([]Uri, len(uris))
+	for i, uri := range uris {
+		cloned[i] = uri.Clone()
+	}
+	return cloned
+}
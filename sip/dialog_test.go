@@ -0,0 +1,173 @@
+package sip_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func parseDialogMessage(t *testing.T, lines ...string) sip.Message {
+	msg, err := parser.ParseMessage([]byte(strings.Join(append(lines, "Content-Length: 0", "", ""), "\r\n")), log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return msg
+}
+
+func dialogInvite(t *testing.T) sip.Request {
+	return parseDialogMessage(t,
+		"INVITE sip:bob@biloxi.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"Record-Route: <sip:p2.biloxi.com;lr>, <sip:p1.atlanta.com;lr>",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 314159 INVITE",
+		"Contact: <sip:alice@pc33.atlanta.com>",
+	).(sip.Request)
+}
+
+func dialogResponse(t *testing.T, status string) sip.Response {
+	return parseDialogMessage(t,
+		"SIP/2.0 "+status,
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"Record-Route: <sip:p2.biloxi.com;lr>, <sip:p1.atlanta.com;lr>",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>;tag=a6c85cf",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 314159 INVITE",
+		"Contact: <sip:bob@192.0.2.4>",
+	).(sip.Response)
+}
+
+func TestDialogUAC(t *testing.T) {
+	client := sip.NewDialogClient()
+	invite := dialogInvite(t)
+
+	dlg, err := client.Establish(invite, dialogResponse(t, "180 Ringing"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if dlg.State() != sip.DialogEarly {
+		t.Fatalf("expected early dialog, got %s", dlg.State())
+	}
+	if same, _ := client.Establish(invite, dialogResponse(t, "200 OK")); same != dlg || dlg.State() != sip.DialogConfirmed {
+		t.Fatalf("expected confirmed dialog %s, got %s in %s", dlg, same, dlg.State())
+	}
+
+	ack, err := dlg.NewRequest(sip.ACK, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cseq, _ := ack.CSeq(); cseq.SeqNo != 314159 {
+		t.Errorf("ACK must take INVITE CSeq, got %d", cseq.SeqNo)
+	}
+
+	bye, err := dlg.NewRequest(sip.BYE, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cseq, _ := bye.CSeq(); cseq.SeqNo != 314160 {
+		t.Errorf("expected CSeq 314160, got %d", cseq.SeqNo)
+	}
+	if bye.Recipient().String() != "sip:bob@192.0.2.4" {
+		t.Errorf("unexpected Request-URI %s", bye.Recipient())
+	}
+	// UAC route set is the reversed Record-Route.
+	if routes := sip.Routes(bye); len(routes) != 2 || routes[0].Host() != "p1.atlanta.com" {
+		t.Errorf("expected reversed Record-Route, got %v", routes)
+	}
+	if to, _ := bye.To(); !strings.Contains(to.String(), "tag=a6c85cf") {
+		t.Errorf("unexpected To %s", to)
+	}
+
+	res := sip.NewResponseFromRequest("", bye, 200, "OK", "")
+	if _, ok := client.ReceiveResponse(res); !ok {
+		t.Fatal("response must match the dialog")
+	}
+	if dlg.State() != sip.DialogTerminated {
+		t.Errorf("expected terminated dialog, got %s", dlg.State())
+	}
+	if _, ok := client.Dialog(dlg.ID()); ok {
+		t.Error("terminated dialog must be removed")
+	}
+}
+
+func TestDialogUASMatch(t *testing.T) {
+	server := sip.NewDialogServer()
+	invite := dialogInvite(t)
+	res := dialogResponse(t, "200 OK")
+
+	dlg, err := server.Establish(invite, res)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if dlg.LocalTag() != "a6c85cf" || dlg.RemoteTag() != "1928301774" {
+		t.Fatalf("unexpected tags %s/%s", dlg.LocalTag(), dlg.RemoteTag())
+	}
+	if routes := dlg.RouteSet(); len(routes) != 2 || routes[0].Host() != "p2.biloxi.com" {
+		t.Errorf("UAS route set must keep Record-Route order, got %v", routes)
+	}
+
+	bye := func(seq string) sip.Request {
+		return parseDialogMessage(t,
+			"BYE sip:bob@192.0.2.4 SIP/2.0",
+			"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bKnashds7",
+			"From: <sip:alice@atlanta.com>;tag=1928301774",
+			"To: <sip:bob@biloxi.com>;tag=a6c85cf",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: "+seq+" BYE",
+		).(sip.Request)
+	}
+
+	if _, err := server.Match(bye("314159")); err == nil {
+		t.Fatal("out of order request must be rejected")
+	} else if dlgErr, ok := err.(*sip.DialogError); !ok || dlgErr.StatusCode != 500 {
+		t.Fatalf("expected DialogError with 500, got %s", err)
+	} else if errors.Is(err, sip.ErrDialogNotFound) {
+		t.Fatalf("out of order request must not match ErrDialogNotFound")
+	}
+	if matched, err := server.Match(bye("314160")); err != nil || matched != dlg {
+		t.Fatalf("expected dialog %s, got %s: %v", dlg, matched, err)
+	}
+	if _, err := server.Match(bye("314161")); err == nil {
+		t.Fatal("request to removed dialog must be rejected")
+	} else if dlgErr, ok := err.(*sip.DialogError); !ok || dlgErr.StatusCode != 481 {
+		t.Fatalf("expected DialogError with 481, got %s", err)
+	} else if !errors.Is(err, sip.ErrDialogNotFound) {
+		t.Fatalf("expected ErrDialogNotFound, got %s", err)
+	}
+}
+
+func TestDialogSnapshot(t *testing.T) {
+	client := sip.NewDialogClient()
+	dlg, err := client.Establish(dialogInvite(t), dialogResponse(t, "200 OK"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := dlg.NewRequest(sip.INFO, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	restored := sip.NewDialogClient()
+	if err := restored.Restore(client.Snapshot(), parser.ParseUri); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dlg2, ok := restored.Dialog(dlg.ID())
+	if !ok {
+		t.Fatal("dialog not restored")
+	}
+	if dlg2.State() != sip.DialogConfirmed || dlg2.LocalSeq() != dlg.LocalSeq() {
+		t.Errorf("unexpected restored dialog state %s, CSeq %d", dlg2.State(), dlg2.LocalSeq())
+	}
+
+	req1, _ := dlg.NewRequest(sip.BYE, "")
+	req2, _ := dlg2.NewRequest(sip.BYE, "")
+	if req1.String() != req2.String() {
+		t.Errorf("restored dialog builds different request:\n%s\n%s", req1, req2)
+	}
+}
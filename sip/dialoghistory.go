@@ -0,0 +1,177 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DialogHistoryEntry is a message exchanged within the dialog.
+type DialogHistoryEntry struct {
+	Time     time.Time
+	Outgoing bool
+	// Source and Destination are transport addresses of the message if known.
+	Source      string
+	Destination string
+	// Message is the message text with the body truncated to the history limit.
+	Message string
+
+	summary messageSummary
+}
+
+// Fields of the message needed to build accounting records, see AccRecords.
+type messageSummary struct {
+	method     RequestMethod
+	request    bool
+	statusCode StatusCode
+	reason     string
+	seq        uint32
+	callID     string
+	fromUri    string
+	fromTag    string
+	toUri      string
+	toTag      string
+}
+
+func summarize(msg Message) messageSummary {
+	var summary messageSummary
+	switch msg := msg.(type) {
+	case Request:
+		summary.request = true
+		summary.method = msg.Method()
+	case Response:
+		summary.statusCode = msg.StatusCode()
+		summary.reason = msg.Reason()
+	}
+	if cseq, ok := msg.CSeq(); ok {
+		summary.seq = cseq.SeqNo
+		if !summary.request {
+			summary.method = cseq.MethodName
+		}
+	}
+	if callID, ok := msg.CallID(); ok {
+		summary.callID = string(*callID)
+	}
+	if from, ok := msg.From(); ok {
+		summary.fromUri, summary.fromTag = addressSummary(from.Address, from.Params)
+	}
+	if to, ok := msg.To(); ok {
+		summary.toUri, summary.toTag = addressSummary(to.Address, to.Params)
+	}
+	return summary
+}
+
+func addressSummary(uri Uri, params Params) (string, string) {
+	var addr, tag string
+	if uri != nil {
+		addr = uri.String()
+	}
+	if params != nil {
+		if value, ok := params.Get("tag"); ok && value != nil {
+			tag = value.String()
+		}
+	}
+	return addr, tag
+}
+
+func (entry DialogHistoryEntry) String() string {
+	direction := "<-"
+	if entry.Outgoing {
+		direction = "->"
+	}
+	return fmt.Sprintf("%s %s %s %s\n%s", entry.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+		entry.Source, direction, entry.Destination, entry.Message)
+}
+
+// DialogHistory retains the last messages exchanged within the dialog to ease debugging of failed dialogs.
+// Bodies longer than maxBody bytes are truncated, negative maxBody keeps bodies as is.
+type DialogHistory struct {
+	mu      sync.Mutex
+	entries []DialogHistoryEntry
+	next    int
+	full    bool
+	maxBody int
+}
+
+// NewDialogHistory creates history of the last size messages, size less than 1 is treated as 1.
+func NewDialogHistory(size, maxBody int) *DialogHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &DialogHistory{
+		entries: make([]DialogHistoryEntry, size),
+		maxBody: maxBody,
+	}
+}
+
+// Add records the message, the oldest message is evicted when the history is full.
+func (history *DialogHistory) Add(msg Message, outgoing bool) {
+	entry := DialogHistoryEntry{
+		Time:        time.Now(),
+		Outgoing:    outgoing,
+		Source:      msg.Source(),
+		Destination: msg.Destination(),
+		Message:     msg.String(),
+		summary:     summarize(msg),
+	}
+
+	if body := msg.Body(); history.maxBody >= 0 && len(body) > history.maxBody {
+		entry.Message = fmt.Sprintf("%s%s... (%d bytes truncated)",
+			entry.Message[:len(entry.Message)-len(body)], body[:history.maxBody], len(body)-history.maxBody)
+	}
+	history.add(entry)
+}
+
+func (history *DialogHistory) add(entry DialogHistoryEntry) {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	history.entries[history.next] = entry
+	history.next = (history.next + 1) % len(history.entries)
+	if history.next == 0 {
+		history.full = true
+	}
+}
+
+// Entries returns recorded messages from the oldest to the newest.
+func (history *DialogHistory) Entries() []DialogHistoryEntry {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if !history.full {
+		entries := make([]DialogHistoryEntry, history.next)
+		copy(entries, history.entries[:history.next])
+		return entries
+	}
+	entries := make([]DialogHistoryEntry, 0, len(history.entries))
+	entries = append(entries, history.entries[history.next:]...)
+	return append(entries, history.entries[:history.next]...)
+}
+
+// Len returns number of recorded messages.
+func (history *DialogHistory) Len() int {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.full {
+		return len(history.entries)
+	}
+	return history.next
+}
+
+// String dumps recorded messages.
+func (history *DialogHistory) String() string {
+	if history == nil {
+		return "<nil>"
+	}
+
+	var buf strings.Builder
+	for i, entry := range history.Entries() {
+		if i > 0 {
+			buf.WriteString("\n\n")
+		}
+		buf.WriteString(entry.String())
+	}
+	return buf.String()
+}
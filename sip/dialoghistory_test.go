@@ -0,0 +1,63 @@
+package sip_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestDialogHistory(t *testing.T) {
+	client := sip.NewDialogClient()
+	client.EnableHistory(3, 10)
+
+	invite := withSDP(dialogInvite(t), testOffer).(sip.Request)
+	dlg, err := client.Establish(invite, withSDP(dialogResponse(t, "200 OK"), testAnswer).(sip.Response))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	entries := dlg.History().Entries()
+	if len(entries) != 2 || !entries[0].Outgoing || entries[1].Outgoing {
+		t.Fatalf("unexpected dialog creating exchange in history: %v", entries)
+	}
+	if !strings.HasSuffix(entries[0].Message, "\r\n\r\nv=0\r\no=ali... (114 bytes truncated)") {
+		t.Errorf("body is not truncated: %q", entries[0].Message)
+	}
+
+	if _, err := dlg.NewRequest(sip.ACK, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reinvite, err := dlg.NewRequest(sip.INVITE, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	entries = dlg.History().Entries()
+	if len(entries) != 3 || !strings.HasPrefix(entries[0].Message, "SIP/2.0 200 OK") ||
+		!strings.HasPrefix(entries[2].Message, "INVITE ") {
+		t.Fatalf("unexpected history after eviction:\n%s", dlg.History())
+	}
+
+	var (
+		failure *sip.DialogError
+		dump    []sip.DialogHistoryEntry
+	)
+	dlg.OnFailure(func(err *sip.DialogError, history []sip.DialogHistoryEntry) {
+		failure, dump = err, history
+	})
+	if _, ok := client.ReceiveResponse(sip.NewResponseFromRequest("", reinvite, 481, "Call/Transaction Does Not Exist", "")); !ok {
+		t.Fatal("response must match the dialog")
+	}
+	if failure == nil || failure.StatusCode != 481 {
+		t.Fatalf("unexpected failure %v", failure)
+	}
+	if len(dump) != 3 || dump[2].Outgoing || !strings.HasPrefix(dump[2].Message, "SIP/2.0 481") {
+		t.Errorf("unexpected history dump %v", dump)
+	}
+
+	// terminated dialog doesn't fail again
+	failure = nil
+	dlg.Fail("BYE timeout")
+	if failure != nil {
+		t.Errorf("unexpected failure %v", failure)
+	}
+}
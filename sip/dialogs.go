@@ -0,0 +1,262 @@
+package sip
+
+import (
+	"fmt"
+	"sync"
+)
+
+// dialogSet keeps dialogs of a UA by ID.
+type dialogSet struct {
+	mu             sync.RWMutex
+	dialogs        map[string]*Dialog
+	historySize    int
+	historyMaxBody int
+}
+
+// EnableHistory enables history of the last size messages in the dialogs created after the call,
+// the history starts with the dialog creating exchange. See Dialog.EnableHistory.
+func (set *dialogSet) EnableHistory(size, maxBody int) {
+	set.mu.Lock()
+	set.historySize, set.historyMaxBody = size, maxBody
+	set.mu.Unlock()
+}
+
+// Enables history of the new dialog and records the dialog creating exchange.
+func (set *dialogSet) initHistory(dlg *Dialog, req Request, res Response, uas bool) {
+	set.mu.RLock()
+	size, maxBody := set.historySize, set.historyMaxBody
+	set.mu.RUnlock()
+	if size <= 0 {
+		return
+	}
+
+	history := dlg.EnableHistory(size, maxBody)
+	history.Add(req, !uas)
+	history.Add(res, uas)
+}
+
+func (set *dialogSet) store(dlg *Dialog) {
+	set.mu.Lock()
+	if set.dialogs == nil {
+		set.dialogs = make(map[string]*Dialog)
+	}
+	set.dialogs[dlg.ID()] = dlg
+	set.mu.Unlock()
+}
+
+// Dialog returns dialog by ID.
+func (set *dialogSet) Dialog(id string) (*Dialog, bool) {
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+
+	dlg, ok := set.dialogs[id]
+	return dlg, ok
+}
+
+// Dialogs returns all dialogs.
+func (set *dialogSet) Dialogs() []*Dialog {
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+
+	dialogs := make([]*Dialog, 0, len(set.dialogs))
+	for _, dlg := range set.dialogs {
+		dialogs = append(dialogs, dlg)
+	}
+	return dialogs
+}
+
+// Remove terminates and forgets the dialog.
+func (set *dialogSet) Remove(id string) {
+	set.mu.Lock()
+	dlg, ok := set.dialogs[id]
+	delete(set.dialogs, id)
+	set.mu.Unlock()
+
+	if ok {
+		dlg.Terminate()
+	}
+}
+
+// Match routes request received within a dialog to the dialog and validates it - RFC 3261 12.2.2.
+// Request that doesn't match any dialog is rejected with DialogError with 481 status code.
+// Dialog terminated by BYE is removed from the set.
+func (set *dialogSet) Match(req Request) (*Dialog, error) {
+	callID, ok := req.CallID()
+	if !ok {
+		return nil, fmt.Errorf("missing Call-ID header in %s", req.Short())
+	}
+	from, ok := req.From()
+	if !ok {
+		return nil, fmt.Errorf("missing From header in %s", req.Short())
+	}
+	to, ok := req.To()
+	if !ok {
+		return nil, fmt.Errorf("missing To header in %s", req.Short())
+	}
+
+	var localTag, remoteTag string
+	if to.Params != nil {
+		if tag, ok := to.Params.Get("tag"); ok && tag != nil {
+			localTag = tag.String()
+		}
+	}
+	if from.Params != nil {
+		if tag, ok := from.Params.Get("tag"); ok && tag != nil {
+			remoteTag = tag.String()
+		}
+	}
+
+	id := MakeDialogID(string(*callID), localTag, remoteTag)
+	dlg, ok := set.Dialog(id)
+	if !ok {
+		return nil, &DialogError{id, 481, "dialog does not exist"}
+	}
+	if err := dlg.ReceiveRequest(req); err != nil {
+		return nil, err
+	}
+	if dlg.State() == DialogTerminated {
+		set.Remove(id)
+	}
+
+	return dlg, nil
+}
+
+// Snapshot returns snapshots of all not terminated dialogs.
+func (set *dialogSet) Snapshot() []DialogSnapshot {
+	snapshots := make([]DialogSnapshot, 0)
+	for _, dlg := range set.Dialogs() {
+		if snapshot := dlg.Snapshot(); snapshot.State != DialogTerminated {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots
+}
+
+// Restore adds dialogs restored from the snapshots, parseUri is usually parser.ParseUri.
+func (set *dialogSet) Restore(snapshots []DialogSnapshot, parseUri func(uri string) (Uri, error)) error {
+	for _, snapshot := range snapshots {
+		dlg, err := RestoreDialog(snapshot, parseUri)
+		if err != nil {
+			return err
+		}
+		set.store(dlg)
+	}
+	return nil
+}
+
+// DialogClient keeps dialogs created by requests sent by the UA.
+type DialogClient struct {
+	dialogSet
+}
+
+func NewDialogClient() *DialogClient {
+	return &DialogClient{}
+}
+
+// Establish creates or updates dialog on the response to the dialog creating request.
+// Forked responses with different 'To' tags create different dialogs.
+// Non-2xx final response terminates and removes early dialogs of the request.
+func (client *DialogClient) Establish(req Request, res Response) (*Dialog, error) {
+	if res.StatusCode() >= 300 {
+		client.terminateEarly(res)
+		return nil, fmt.Errorf("dialog is not established by %s", res.Short())
+	}
+
+	dlg, err := NewDialogUAC(req, res)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := client.Dialog(dlg.ID()); ok {
+		if err := existing.ReceiveResponse(res); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+
+	client.initHistory(dlg, req, res, false)
+	client.store(dlg)
+	return dlg, nil
+}
+
+// ReceiveResponse updates dialog of the response on in-dialog request.
+// Dialog terminated by the response is removed.
+// Offer/answer violations are not reported, use Dialog.ReceiveResponse to check them.
+func (client *DialogClient) ReceiveResponse(res Response) (*Dialog, bool) {
+	id, err := responseDialogID(res)
+	if err != nil {
+		return nil, false
+	}
+	dlg, ok := client.Dialog(id)
+	if !ok {
+		return nil, false
+	}
+
+	_ = dlg.ReceiveResponse(res)
+	if dlg.State() == DialogTerminated {
+		client.Remove(id)
+	}
+	return dlg, true
+}
+
+func (client *DialogClient) terminateEarly(res Response) {
+	callID, ok := res.CallID()
+	if !ok {
+		return
+	}
+	for _, dlg := range client.Dialogs() {
+		if dlg.CallID() == string(*callID) && dlg.State() == DialogEarly {
+			client.Remove(dlg.ID())
+		}
+	}
+}
+
+// DialogServer keeps dialogs created by requests received by the UA.
+type DialogServer struct {
+	dialogSet
+}
+
+func NewDialogServer() *DialogServer {
+	return &DialogServer{}
+}
+
+// Establish creates dialog on the sent response with 'To' tag to the dialog creating request.
+// Following responses of the same dialog only update its state.
+func (server *DialogServer) Establish(req Request, res Response) (*Dialog, error) {
+	dlg, err := NewDialogUAS(req, res)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := server.Dialog(dlg.ID()); ok {
+		if err := existing.SendResponse(res); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+
+	server.initHistory(dlg, req, res, true)
+	server.store(dlg)
+	return dlg, nil
+}
+
+// Dialog ID of the response received by UAC: 'From' tag is local, 'To' tag is remote.
+func responseDialogID(res Response) (string, error) {
+	callID, ok := res.CallID()
+	if !ok {
+		return "", fmt.Errorf("missing Call-ID header")
+	}
+	from, ok := res.From()
+	if !ok || from.Params == nil {
+		return "", fmt.Errorf("missing From header")
+	}
+	to, ok := res.To()
+	if !ok || to.Params == nil {
+		return "", fmt.Errorf("missing To header")
+	}
+	fromTag, _ := from.Params.Get("tag")
+	toTag, _ := to.Params.Get("tag")
+	if fromTag == nil || toTag == nil {
+		return "", fmt.Errorf("missing tag")
+	}
+
+	return MakeDialogID(string(*callID), fromTag.String(), toTag.String()), nil
+}
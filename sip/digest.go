@@ -0,0 +1,365 @@
+package sip
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/timing"
+)
+
+const DefaultNonceTTL = 5 * time.Minute
+
+// HA1Store looks up stored HA1 digests (MD5 of username:realm:password) of subscribers,
+// so that the verifier never deals with plaintext passwords.
+type HA1Store interface {
+	LookupHA1(username, realm string) (string, error)
+}
+
+// HA1StoreFunc is an adapter to use ordinary functions as HA1Store.
+type HA1StoreFunc func(username, realm string) (string, error)
+
+func (fn HA1StoreFunc) LookupHA1(username, realm string) (string, error) {
+	return fn(username, realm)
+}
+
+// AlgorithmHA1Store is implemented by HA1 stores that also keep digests of username:realm:password
+// calculated with other algorithms than MD5 (SHA-256, SHA-512-256 - RFC 7616, RFC 8760).
+type AlgorithmHA1Store interface {
+	HA1Store
+	LookupAlgorithmHA1(username, realm, algorithm string) (string, error)
+}
+
+// StaticHA1Store holds HA1 digests per realm and username.
+type StaticHA1Store map[string]map[string]string
+
+func (store StaticHA1Store) LookupHA1(username, realm string) (string, error) {
+	if ha1, ok := store[realm][username]; ok {
+		return ha1, nil
+	}
+
+	return "", &DigestAuthError{Realm: realm, Username: username, Reason: "unknown user"}
+}
+
+// Add stores HA1 calculated from the password.
+func (store StaticHA1Store) Add(username, realm, password string) {
+	if store[realm] == nil {
+		store[realm] = make(map[string]string)
+	}
+	store[realm][username] = CalcHA1(username, realm, password)
+}
+
+// DigestAuthError is returned by DigestVerifier when request credentials are rejected.
+type DigestAuthError struct {
+	Realm    string
+	Username string
+	Reason   string
+	// Stale reports that credentials are valid but the nonce is expired,
+	// the request should be challenged with stale=true.
+	Stale bool
+	// RetryAfter is set when attempts are blocked by AuthGuard.
+	RetryAfter time.Duration
+}
+
+func (err *DigestAuthError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("digest authentication of '%s' in realm '%s' failed: %s", err.Username, err.Realm, err.Reason)
+}
+
+// DigestVerifier challenges and verifies digest credentials of incoming requests - RFC 3261 22.
+// Nonces carry issue time and realm signed with the verifier's key, the key is generated on first use.
+// The verifier remembers the last nonce count of each accepted nonce until it expires, so credentials
+// are accepted once per nonce count: replayed ones (and reused nonces without qop) are rejected as stale.
+// The counts are kept in memory, so requests with the nonce must reach the verifier that issued it.
+// MD5 is the only algorithm unless Algorithms lists others and Store implements AlgorithmHA1Store,
+// '-sess' algorithms are not supported.
+type DigestVerifier struct {
+	Store HA1Store
+	// Algorithms offered in challenges in order of preference, MD5 is used if empty.
+	Algorithms []string
+	// Realms served by the verifier. Realm of the request is the Request-URI host
+	// if it is one of the Realms, otherwise the first one.
+	Realms []string
+	// RealmFunc selects realm for the request, overrides Realms if set.
+	RealmFunc func(req Request) string
+	// NonceTTL limits nonce lifetime, DefaultNonceTTL is used if zero.
+	NonceTTL time.Duration
+	// Guard enables brute-force protection, disabled if nil.
+	Guard *AuthGuard
+	// ParseUri parses the digest uri to compare it with the Request-URI by URI equality - RFC 3261 19.1.4,
+	// usually parser.ParseUri. The strings are compared exactly if nil.
+	ParseUri func(uri string) (Uri, error)
+
+	key     []byte
+	keyOnce sync.Once
+
+	mu       sync.Mutex
+	counts   map[string]nonceCount
+	prunedAt time.Time
+}
+
+// Last nonce count accepted with the nonce.
+type nonceCount struct {
+	nc     uint64
+	issued time.Time
+}
+
+func NewDigestVerifier(store HA1Store, realms ...string) *DigestVerifier {
+	return &DigestVerifier{
+		Store:  store,
+		Realms: realms,
+	}
+}
+
+// Realm returns realm the request is authenticated in.
+func (v *DigestVerifier) Realm(req Request) string {
+	if v.RealmFunc != nil {
+		return v.RealmFunc(req)
+	}
+
+	var host string
+	if uri, ok := req.Recipient().(*SipUri); ok {
+		host = uri.FHost
+	}
+	for _, realm := range v.Realms {
+		if TokenEqual(realm, host) {
+			return realm
+		}
+	}
+	if len(v.Realms) > 0 {
+		return v.Realms[0]
+	}
+
+	return host
+}
+
+// Challenge creates 401 Unauthorized (or 407 Proxy Authentication Required if proxy is true)
+// response on the request with a fresh nonce.
+func (v *DigestVerifier) Challenge(req Request, proxy, stale bool) Response {
+	code, reason, headerName := StatusCode(401), "Unauthorized", "WWW-Authenticate"
+	if proxy {
+		code, reason, headerName = 407, "Proxy Authentication Required", "Proxy-Authenticate"
+	}
+
+	realm := v.Realm(req)
+	nonce := v.nonce(realm, timing.Now())
+	res := NewResponseFromRequest("", req, code, reason, "")
+	for _, algorithm := range v.algorithms() {
+		value := fmt.Sprintf(`Digest realm="%s",nonce="%s",algorithm=%s,qop="auth"`, realm, nonce, algorithm)
+		if stale {
+			value += ",stale=true"
+		}
+		res.AppendHeader(&GenericHeader{
+			HeaderName: headerName,
+			Contents:   value,
+		})
+	}
+
+	return res
+}
+
+// Verify checks credentials of the request (Proxy-Authorization if proxy is true)
+// for the request realm and returns authenticated username.
+// Returned error is *DigestAuthError.
+func (v *DigestVerifier) Verify(req Request, proxy bool) (string, error) {
+	headerName := "Authorization"
+	if proxy {
+		headerName = "Proxy-Authorization"
+	}
+
+	realm := v.Realm(req)
+	auth, ok := CredentialsByRealm(req, headerName, realm)
+	if !ok {
+		return "", &DigestAuthError{Realm: realm, Reason: "credentials missing"}
+	}
+	if v.Guard != nil {
+		if wait := v.Guard.Check(req.Source(), auth.Username()); wait > 0 {
+			return "", &DigestAuthError{
+				Realm:      realm,
+				Username:   auth.Username(),
+				Reason:     "too many failed attempts",
+				RetryAfter: wait,
+			}
+		}
+	}
+
+	username, err := v.verify(req, realm, auth)
+	if v.Guard != nil {
+		if err == nil {
+			v.Guard.Success(req.Source(), username)
+		} else if !err.Stale {
+			v.Guard.Failure(req.Source(), auth.Username())
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return username, nil
+}
+
+func (v *DigestVerifier) verify(req Request, realm string, auth *Authorization) (string, *DigestAuthError) {
+	algorithm := auth.Algorithm()
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	if !v.supports(algorithm) {
+		return "", &DigestAuthError{Realm: realm, Username: auth.Username(), Reason: "unsupported algorithm " + algorithm}
+	}
+
+	issued, ok := v.parseNonce(realm, auth.Nonce())
+	if !ok {
+		return "", &DigestAuthError{Realm: realm, Username: auth.Username(), Reason: "invalid nonce"}
+	}
+	ttl := v.NonceTTL
+	if ttl == 0 {
+		ttl = DefaultNonceTTL
+	}
+	if timing.Now().Sub(issued) > ttl {
+		return "", &DigestAuthError{Realm: realm, Username: auth.Username(), Reason: "nonce expired", Stale: true}
+	}
+	// credentials must be calculated for this Request-URI - RFC 2617 3.2.2.5
+	if !v.matchUri(auth.Uri(), req.Recipient()) {
+		return "", &DigestAuthError{Realm: realm, Username: auth.Username(), Reason: "uri mismatch"}
+	}
+	var nc uint64
+	if auth.Qop() != "" {
+		var err error
+		if nc, err = strconv.ParseUint(auth.Nc(), 16, 32); err != nil || nc == 0 {
+			return "", &DigestAuthError{Realm: realm, Username: auth.Username(), Reason: "invalid nonce count"}
+		}
+	}
+
+	ha1, err := v.lookupHA1(auth.Username(), realm, algorithm)
+	if err != nil {
+		if authErr, ok := err.(*DigestAuthError); ok {
+			return "", authErr
+		}
+		return "", &DigestAuthError{Realm: realm, Username: auth.Username(), Reason: err.Error()}
+	}
+
+	expected := calcDigest(algorithm, ha1, string(req.Method()), auth.Uri(), auth.Nonce(), auth.Qop(), auth.CNonce(), auth.Nc())
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(auth.Response())) != 1 {
+		return "", &DigestAuthError{Realm: realm, Username: auth.Username(), Reason: "invalid response"}
+	}
+	// counted only for valid credentials, otherwise anyone could exhaust the nonce
+	if !v.count(auth.Nonce(), nc, issued, ttl) {
+		return "", &DigestAuthError{Realm: realm, Username: auth.Username(), Reason: "nonce count replayed", Stale: true}
+	}
+
+	return auth.Username(), nil
+}
+
+func (v *DigestVerifier) matchUri(uri string, recipient Uri) bool {
+	if recipient == nil {
+		return false
+	}
+	if v.ParseUri == nil {
+		return uri == recipient.String()
+	}
+
+	parsed, err := v.ParseUri(uri)
+	return err == nil && parsed.Equals(recipient)
+}
+
+// Stores nonce count of the nonce, returns false if it is not greater than the last one.
+func (v *DigestVerifier) count(nonce string, nc uint64, issued time.Time, ttl time.Duration) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := timing.Now()
+	if v.counts == nil {
+		v.counts = make(map[string]nonceCount)
+	}
+	if now.Sub(v.prunedAt) > ttl {
+		for key, count := range v.counts {
+			if now.Sub(count.issued) > ttl {
+				delete(v.counts, key)
+			}
+		}
+		v.prunedAt = now
+	}
+
+	if last, ok := v.counts[nonce]; ok && nc <= last.nc {
+		return false
+	}
+	v.counts[nonce] = nonceCount{nc, issued}
+
+	return true
+}
+
+func (v *DigestVerifier) algorithms() []string {
+	if len(v.Algorithms) == 0 {
+		return []string{"MD5"}
+	}
+	return v.Algorithms
+}
+
+func (v *DigestVerifier) supports(algorithm string) bool {
+	if isSessAlgorithm(algorithm) || !DigestAlgorithmSupported(algorithm) {
+		return false
+	}
+	for _, a := range v.algorithms() {
+		if TokenEqual(a, algorithm) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *DigestVerifier) lookupHA1(username, realm, algorithm string) (string, error) {
+	if TokenEqual(algorithm, "MD5") {
+		return v.Store.LookupHA1(username, realm)
+	}
+	if store, ok := v.Store.(AlgorithmHA1Store); ok {
+		return store.LookupAlgorithmHA1(username, realm, algorithm)
+	}
+
+	return "", &DigestAuthError{Realm: realm, Username: username, Reason: "no HA1 for algorithm " + algorithm}
+}
+
+func (v *DigestVerifier) nonce(realm string, t time.Time) string {
+	ts := strconv.FormatInt(t.UnixNano(), 16)
+	return ts + "." + v.sign(realm, ts)
+}
+
+func (v *DigestVerifier) parseNonce(realm, nonce string) (time.Time, bool) {
+	i := strings.IndexByte(nonce, '.')
+	if i < 0 || !hmac.Equal([]byte(nonce[i+1:]), []byte(v.sign(realm, nonce[:i]))) {
+		return time.Time{}, false
+	}
+	ts, err := strconv.ParseInt(nonce[:i], 16, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, ts), true
+}
+
+func (v *DigestVerifier) sign(realm, ts string) string {
+	mac := hmac.New(sha256.New, v.signKey())
+	mac.Write([]byte(realm + ":" + ts))
+
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (v *DigestVerifier) signKey() []byte {
+	v.keyOnce.Do(func() {
+		v.key = make([]byte, 32)
+		if _, err := rand.Read(v.key); err != nil {
+			panic(fmt.Errorf("generate nonce key: %w", err))
+		}
+	})
+
+	return v.key
+}
@@ -0,0 +1,179 @@
+package sip_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+func TestDigestVerifier(t *testing.T) {
+	store := sip.StaticHA1Store{}
+	store.Add("alice", "a.example.com", "secret")
+	store.Add("alice", "b.example.com", "other")
+	verifier := sip.NewDigestVerifier(store, "a.example.com", "b.example.com")
+
+	newRequest := func(host string) sip.Request {
+		return sip.NewRequest("", sip.REGISTER, &sip.SipUri{FHost: host}, "SIP/2.0", []sip.Header{
+			&sip.CSeq{SeqNo: 1, MethodName: sip.REGISTER},
+		}, "", nil)
+	}
+
+	for host, password := range map[string]string{"a.example.com": "secret", "b.example.com": "other"} {
+		req := newRequest(host)
+		if _, err := verifier.Verify(req, false); err == nil {
+			t.Fatalf("request without credentials must be rejected")
+		}
+
+		challenge := verifier.Challenge(req, false, false)
+		if challenge.StatusCode() != 401 {
+			t.Fatalf("unexpected challenge %s", challenge.Short())
+		}
+		if err := sip.AuthorizeRequest(req, challenge, sip.String{Str: "alice"}, sip.String{Str: password}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if username, err := verifier.Verify(req, false); err != nil || username != "alice" {
+			t.Errorf("unexpected verification result for %s: %s, %v", host, username, err)
+		}
+	}
+
+	req := newRequest("a.example.com")
+	if err := sip.AuthorizeRequest(req, verifier.Challenge(req, false, false), sip.String{Str: "alice"}, sip.String{Str: "wrong"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := verifier.Verify(req, false); err == nil {
+		t.Errorf("invalid password must be rejected")
+	}
+
+	req = newRequest("a.example.com")
+	if err := sip.AuthorizeRequest(req, verifier.Challenge(req, false, false), sip.String{Str: "alice"}, sip.String{Str: "secret"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	req.SetRecipient(&sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "a.example.com"})
+	if _, err := verifier.Verify(req, false); err == nil {
+		t.Errorf("credentials replayed for another Request-URI must be rejected")
+	}
+
+	// nonce issued for realm a.example.com presented for realm b.example.com
+	challenge := verifier.Challenge(newRequest("a.example.com"), false, false)
+	hdr := challenge.GetHeaders("WWW-Authenticate")[0]
+	challenge.RemoveHeader("WWW-Authenticate")
+	challenge.AppendHeader(&sip.GenericHeader{
+		HeaderName: "WWW-Authenticate",
+		Contents:   strings.Replace(hdr.Value(), `realm="a.example.com"`, `realm="b.example.com"`, 1),
+	})
+	req = newRequest("b.example.com")
+	if err := sip.AuthorizeRequest(req, challenge, sip.String{Str: "alice"}, sip.String{Str: "other"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := verifier.Verify(req, false); err == nil {
+		t.Errorf("nonce of another realm must be rejected")
+	}
+}
+
+func TestDigestVerifierNonceExpiry(t *testing.T) {
+	timing.MockMode = true
+	defer func() { timing.MockMode = false }()
+
+	store := sip.StaticHA1Store{}
+	store.Add("alice", "b.example.com", "other")
+	verifier := &sip.DigestVerifier{
+		Store:     store,
+		RealmFunc: func(req sip.Request) string { return "b.example.com" },
+		NonceTTL:  time.Minute,
+	}
+
+	for _, password := range []string{"other", "wrong"} {
+		req := sip.NewRequest("", sip.INVITE, &sip.SipUri{FHost: "a.example.com"}, "SIP/2.0", nil, "", nil)
+		if err := sip.AuthorizeRequest(req, verifier.Challenge(req, true, false), sip.String{Str: "alice"}, sip.String{Str: password}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		timing.Elapse(2 * time.Minute)
+		if _, err := verifier.Verify(req, true); err == nil {
+			t.Errorf("expired nonce must be rejected")
+		} else if authErr, ok := err.(*sip.DigestAuthError); !ok || !authErr.Stale {
+			t.Errorf("stale error expected, got %s", err)
+		}
+	}
+}
+
+func TestDigestVerifierReplay(t *testing.T) {
+	store := sip.StaticHA1Store{}
+	store.Add("alice", "example.com", "secret")
+	verifier := sip.NewDigestVerifier(store, "example.com")
+	verifier.ParseUri = parser.ParseUri
+
+	recipient, _ := parser.ParseUri("sip:example.com;transport=udp;lr")
+	req := sip.NewRequest("", sip.REGISTER, recipient, "SIP/2.0", nil, "", nil)
+	if err := sip.AuthorizeRequest(req, verifier.Challenge(req, false, false), sip.String{Str: "alice"}, sip.String{Str: "secret"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := verifier.Verify(req, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := verifier.Verify(req, false); err == nil {
+		t.Errorf("replayed credentials must be rejected")
+	} else if authErr, ok := err.(*sip.DigestAuthError); !ok || !authErr.Stale {
+		t.Errorf("stale error expected, got %s", err)
+	}
+
+	// the next request with the same nonce, increased nonce count and equal Request-URI
+	auth, _ := sip.CredentialsByRealm(req, "Authorization", "example.com")
+	auth.SetNc("00000002")
+	auth.SetMethod(string(sip.REGISTER)).SetPassword("secret")
+	auth.SetResponse(auth.CalcResponse())
+	recipient, _ = parser.ParseUri("sip:example.com;lr;transport=udp")
+	req = sip.NewRequest("", sip.REGISTER, recipient, "SIP/2.0", []sip.Header{
+		&sip.GenericHeader{HeaderName: "Authorization", Contents: auth.String()},
+	}, "", nil)
+	if username, err := verifier.Verify(req, false); err != nil || username != "alice" {
+		t.Errorf("unexpected verification result: %s, %v", username, err)
+	}
+}
+
+type algorithmHA1Store map[string]string
+
+func (store algorithmHA1Store) LookupHA1(username, realm string) (string, error) {
+	return store.LookupAlgorithmHA1(username, realm, "MD5")
+}
+
+func (store algorithmHA1Store) LookupAlgorithmHA1(username, realm, algorithm string) (string, error) {
+	if ha1, ok := store[algorithm]; ok {
+		return ha1, nil
+	}
+	return "", fmt.Errorf("no HA1")
+}
+
+func TestDigestVerifierAlgorithms(t *testing.T) {
+	store := algorithmHA1Store{
+		"MD5":     sip.CalcHA1("alice", "example.com", "secret"),
+		"SHA-256": sip.CalcHA1WithAlgorithm("SHA-256", "alice", "example.com", "secret"),
+	}
+	verifier := sip.NewDigestVerifier(store, "example.com")
+	verifier.Algorithms = []string{"SHA-256", "MD5"}
+
+	req := sip.NewRequest("", sip.REGISTER, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+	challenge := verifier.Challenge(req, false, false)
+	if n := len(challenge.GetHeaders("WWW-Authenticate")); n != 2 {
+		t.Fatalf("expected challenge per algorithm, got %d", n)
+	}
+	if err := sip.AuthorizeRequest(req, challenge, sip.String{Str: "alice"}, sip.String{Str: "secret"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	auth, _ := sip.CredentialsByRealm(req, "Authorization", "example.com")
+	if auth.Algorithm() != "SHA-256" {
+		t.Fatalf("expected SHA-256 credentials, got %s", auth.Algorithm())
+	}
+	if username, err := verifier.Verify(req, false); err != nil || username != "alice" {
+		t.Errorf("unexpected verification result: %s, %v", username, err)
+	}
+
+	verifier.Algorithms = nil
+	if _, err := verifier.Verify(req, false); err == nil {
+		t.Errorf("algorithm not offered must be rejected")
+	}
+}
@@ -0,0 +1,137 @@
+package sip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// UnsupportedContentCodingError is returned on the body encoded with unknown content coding.
+type UnsupportedContentCodingError struct {
+	Coding string
+}
+
+func (err *UnsupportedContentCodingError) Error() string {
+	return fmt.Sprintf("unsupported content coding '%s'", err.Coding)
+}
+
+// ContentCodingSupported reports whether the body can be encoded and decoded with the coding,
+// 'deflate' is zlib format as in HTTP.
+func ContentCodingSupported(coding string) bool {
+	switch TokenLower(coding) {
+	case "gzip", "deflate", "identity":
+		return true
+	default:
+		return false
+	}
+}
+
+// ContentCodings returns codings of 'Content-Encoding' headers in order they were applied to the body,
+// 'identity' is omitted - RFC 3261 20.12.
+func ContentCodings(msg Message) []string {
+	return headerTokens(msg, "Content-Encoding", "e")
+}
+
+// AcceptedCodings returns codings listed in 'Accept-Encoding' headers,
+// ok is false if the message has no such header - RFC 3261 20.2.
+func AcceptedCodings(msg Message) (codings []string, ok bool) {
+	if len(msg.GetHeaders("Accept-Encoding")) == 0 {
+		return nil, false
+	}
+	return headerTokens(msg, "Accept-Encoding"), true
+}
+
+func headerTokens(msg Message, names ...string) []string {
+	tokens := make([]string, 0)
+	for _, name := range names {
+		for _, hdr := range msg.GetHeaders(name) {
+			for _, token := range strings.Split(hdr.Value(), ",") {
+				// drop q-value
+				token = strings.TrimSpace(strings.Split(token, ";")[0])
+				if token != "" && !TokenEqual(token, "identity") {
+					tokens = append(tokens, token)
+				}
+			}
+		}
+	}
+	return tokens
+}
+
+// EncodeBody compresses the message body with the coding, adds it to 'Content-Encoding'
+// and updates 'Content-Length'. Empty body is left as is.
+func EncodeBody(msg Message, coding string) error {
+	body := msg.Body()
+	if body == "" || TokenEqual(coding, "identity") {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch TokenLower(coding) {
+	case "gzip":
+		writer = gzip.NewWriter(&buf)
+	case "deflate":
+		writer = zlib.NewWriter(&buf)
+	default:
+		return &UnsupportedContentCodingError{coding}
+	}
+	if _, err := io.WriteString(writer, body); err != nil {
+		return fmt.Errorf("encode body with %s: %w", coding, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("encode body with %s: %w", coding, err)
+	}
+
+	codings := append(ContentCodings(msg), TokenLower(coding))
+	msg.RemoveHeader("Content-Encoding")
+	msg.RemoveHeader("e")
+	msg.AppendHeader(&GenericHeader{
+		HeaderName: "Content-Encoding",
+		Contents:   strings.Join(codings, ", "),
+	})
+	msg.SetBody(buf.String(), true)
+	return nil
+}
+
+// DecodeBody decodes the body in reverse order of 'Content-Encoding' codings,
+// removes 'Content-Encoding' and updates 'Content-Length' to the decoded body length.
+// On error, e.g. UnsupportedContentCodingError, the message is left intact.
+func DecodeBody(msg Message) error {
+	codings := ContentCodings(msg)
+	if len(codings) == 0 {
+		return nil
+	}
+	for _, coding := range codings {
+		if !ContentCodingSupported(coding) {
+			return &UnsupportedContentCodingError{coding}
+		}
+	}
+
+	body := []byte(msg.Body())
+	for i := len(codings) - 1; i >= 0; i-- {
+		var reader io.ReadCloser
+		var err error
+		switch TokenLower(codings[i]) {
+		case "gzip":
+			reader, err = gzip.NewReader(bytes.NewReader(body))
+		case "deflate":
+			reader, err = zlib.NewReader(bytes.NewReader(body))
+		}
+		if err == nil {
+			body, err = ioutil.ReadAll(reader)
+			reader.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("decode body with %s: %w", codings[i], err)
+		}
+	}
+
+	msg.RemoveHeader("Content-Encoding")
+	msg.RemoveHeader("e")
+	msg.SetBody(string(body), true)
+	return nil
+}
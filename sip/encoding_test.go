@@ -0,0 +1,84 @@
+package sip_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestEncodeDecodeBody(t *testing.T) {
+	body := strings.Repeat("v=0\r\n", 50)
+	for _, coding := range []string{"gzip", "deflate"} {
+		msg := parseDialogMessage(t, "MESSAGE sip:bob@biloxi.com SIP/2.0", "Content-Encoding: identity")
+		msg.SetBody(body, true)
+
+		if err := sip.EncodeBody(msg, coding); err != nil {
+			t.Fatalf("%s: unexpected error: %s", coding, err)
+		}
+		if codings := sip.ContentCodings(msg); len(codings) != 1 || codings[0] != coding {
+			t.Fatalf("%s: unexpected codings %v", coding, codings)
+		}
+		if length, _ := msg.ContentLength(); msg.Body() == body || int(*length) != len(msg.Body()) {
+			t.Fatalf("%s: body is not encoded: %q", coding, msg.Body())
+		}
+
+		if err := sip.DecodeBody(msg); err != nil {
+			t.Fatalf("%s: unexpected error: %s", coding, err)
+		}
+		if length, _ := msg.ContentLength(); msg.Body() != body || int(*length) != len(body) {
+			t.Errorf("%s: unexpected decoded body %q", coding, msg.Body())
+		}
+		if len(msg.GetHeaders("Content-Encoding")) != 0 {
+			t.Errorf("%s: Content-Encoding is not removed", coding)
+		}
+	}
+
+	// codings are decoded in reverse order
+	msg := parseDialogMessage(t, "MESSAGE sip:bob@biloxi.com SIP/2.0")
+	msg.SetBody(body, true)
+	if err := sip.EncodeBody(msg, "gzip"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := sip.EncodeBody(msg, "deflate"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if hdrs := msg.GetHeaders("Content-Encoding"); len(hdrs) != 1 || hdrs[0].Value() != "gzip, deflate" {
+		t.Fatalf("unexpected Content-Encoding %v", hdrs)
+	}
+	if err := sip.DecodeBody(msg); err != nil || msg.Body() != body {
+		t.Errorf("unexpected decoded body %q, error %v", msg.Body(), err)
+	}
+
+	// unsupported coding leaves the message intact
+	msg = parseDialogMessage(t, "MESSAGE sip:bob@biloxi.com SIP/2.0", "e: gzip, br")
+	msg.SetBody("compressed", true)
+	var codingErr *sip.UnsupportedContentCodingError
+	if err := sip.DecodeBody(msg); !errors.As(err, &codingErr) || codingErr.Coding != "br" {
+		t.Errorf("expected unsupported coding error, got %v", err)
+	}
+	if msg.Body() != "compressed" || len(msg.GetHeaders("e")) != 1 {
+		t.Errorf("message is changed: %s", msg)
+	}
+
+	// corrupted body
+	msg = parseDialogMessage(t, "MESSAGE sip:bob@biloxi.com SIP/2.0", "Content-Encoding: gzip")
+	msg.SetBody("not gzip", true)
+	if err := sip.DecodeBody(msg); err == nil || msg.Body() != "not gzip" {
+		t.Errorf("expected decode error, got %v", err)
+	}
+}
+
+func TestAcceptedCodings(t *testing.T) {
+	msg := parseDialogMessage(t, "OPTIONS sip:bob@biloxi.com SIP/2.0")
+	if _, ok := sip.AcceptedCodings(msg); ok {
+		t.Error("expected missing Accept-Encoding")
+	}
+
+	msg = parseDialogMessage(t, "OPTIONS sip:bob@biloxi.com SIP/2.0", "Accept-Encoding: gzip;q=1.0, identity, deflate;q=0.5")
+	codings, ok := sip.AcceptedCodings(msg)
+	if !ok || len(codings) != 2 || codings[0] != "gzip" || codings[1] != "deflate" {
+		t.Errorf("unexpected accepted codings %v", codings)
+	}
+}
@@ -1,12 +1,26 @@
 package sip
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrDialogNotFound is matched by errors of requests that don't match any dialog
+	// or are received within the terminated dialog, the request should be rejected
+	// with '481 Call/Transaction Does Not Exist'.
+	ErrDialogNotFound = errors.New("dialog not found")
+	// ErrUnsupportedScheme is wrapped by errors of URIs with a scheme other than sip or sips.
+	ErrUnsupportedScheme = errors.New("unsupported URI scheme")
+)
 
 type RequestError struct {
 	Request  Request
 	Response Response
 	Code     uint
 	Reason   string
+	// Err is the cause of the failure if it is not the final response, e.g. terminated transaction.
+	Err error
 }
 
 func NewRequestError(code uint, reason string, request Request, response Response) *RequestError {
@@ -23,6 +37,7 @@ func NewRequestError(code uint, reason string, request Request, response Respons
 	return err
 }
 
+func (err *RequestError) Unwrap() error { return err.Err }
 func (err *RequestError) Error() string {
 	if err == nil {
 		return "<nil>"
@@ -0,0 +1,115 @@
+package sip
+
+import (
+	"strings"
+	"sync"
+)
+
+// ParseEvent splits value of the 'Event' header into the event package with optional templates
+// and the 'id' parameter - RFC 6665 8.2.1.
+func ParseEvent(value string) (pkg string, id string) {
+	parts := strings.Split(value, ";")
+	pkg = strings.TrimSpace(parts[0])
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 && TokenEqual(strings.TrimSpace(kv[0]), "id") {
+			id = strings.Trim(strings.TrimSpace(kv[1]), "\"")
+		}
+	}
+	return pkg, id
+}
+
+// GetEvent returns event package and 'id' parameter of the message 'Event' header.
+func GetEvent(msg Message) (pkg string, id string, ok bool) {
+	hdrs := msg.GetHeaders("Event")
+	if len(hdrs) == 0 {
+		return "", "", false
+	}
+	pkg, id = ParseEvent(hdrs[0].Value())
+	return pkg, id, true
+}
+
+// EventRegistry holds event packages supported by the SUBSCRIBE/NOTIFY framework - RFC 6665 7.2.
+// Package names are case-sensitive, templates like 'presence.winfo' are registered as separate packages.
+type EventRegistry struct {
+	mu       sync.RWMutex
+	packages []string
+}
+
+func NewEventRegistry(packages ...string) *EventRegistry {
+	r := &EventRegistry{}
+	for _, pkg := range packages {
+		r.Register(pkg)
+	}
+	return r
+}
+
+// Register adds the event package, registered packages are listed in the order of registration.
+func (r *EventRegistry) Register(pkg string) {
+	pkg = strings.TrimSpace(pkg)
+	if pkg == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.packages {
+		if p == pkg {
+			return
+		}
+	}
+	r.packages = append(r.packages, pkg)
+}
+
+// Unregister removes the event package, returns false if it was not registered.
+func (r *EventRegistry) Unregister(pkg string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, p := range r.packages {
+		if p == pkg {
+			r.packages = append(r.packages[:i], r.packages[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Supports checks the event package of the 'Event' header value.
+func (r *EventRegistry) Supports(event string) bool {
+	pkg, _ := ParseEvent(event)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.packages {
+		if p == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// Packages returns registered event packages.
+func (r *EventRegistry) Packages() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	packages := make([]string, len(r.packages))
+	copy(packages, r.packages)
+	return packages
+}
+
+// Len returns number of registered event packages.
+func (r *EventRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.packages)
+}
+
+// AllowEvents returns 'Allow-Events' header with registered event packages.
+func (r *EventRegistry) AllowEvents() *AllowEventsHeader {
+	return &AllowEventsHeader{Events: r.Packages()}
+}
@@ -0,0 +1,35 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestParseEvent(t *testing.T) {
+	pkg, id := sip.ParseEvent("presence.winfo ; id=\"abc\";foo=bar")
+	if pkg != "presence.winfo" || id != "abc" {
+		t.Errorf("unexpected event package '%s' and id '%s'", pkg, id)
+	}
+
+	event := sip.Event("dialog")
+	req := sip.NewRequest("", sip.SUBSCRIBE, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", []sip.Header{&event}, "", nil)
+	if pkg, id, ok := sip.GetEvent(req); !ok || pkg != "dialog" || id != "" {
+		t.Errorf("unexpected event of the request: '%s', '%s', %v", pkg, id, ok)
+	}
+}
+
+func TestEventRegistry(t *testing.T) {
+	r := sip.NewEventRegistry("presence", "dialog", "presence")
+	r.Register("message-summary")
+
+	if !r.Supports("presence;id=1") || r.Supports("Presence") || r.Supports("presence.winfo") {
+		t.Error("unexpected supported event packages")
+	}
+	if !r.Unregister("dialog") || r.Unregister("dialog") {
+		t.Error("unexpected unregister result")
+	}
+	if hdr := r.AllowEvents(); hdr.String() != "Allow-Events: presence, message-summary" {
+		t.Errorf("unexpected header %s", hdr)
+	}
+}
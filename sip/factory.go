@@ -0,0 +1,76 @@
+package sip
+
+import "sync"
+
+// ResponseFactory builds responses on requests with default headers and reason phrases from the catalog.
+type ResponseFactory struct {
+	mu      sync.RWMutex
+	headers []Header
+	reasons ReasonCatalog
+}
+
+// NewResponseFactory creates response factory with the reason phrases catalog,
+// nil catalog means DefaultReasons. Missed phrases are taken from DefaultReasons.
+func NewResponseFactory(reasons ReasonCatalog, headers ...Header) *ResponseFactory {
+	return &ResponseFactory{
+		headers: headers,
+		reasons: reasons,
+	}
+}
+
+// SetDefaultHeaders replaces headers appended to each built response.
+func (f *ResponseFactory) SetDefaultHeaders(headers ...Header) {
+	f.mu.Lock()
+	f.headers = headers
+	f.mu.Unlock()
+}
+
+// SetReasons replaces the reason phrases catalog.
+func (f *ResponseFactory) SetReasons(reasons ReasonCatalog) {
+	f.mu.Lock()
+	f.reasons = reasons
+	f.mu.Unlock()
+}
+
+// Reason returns reason phrase of the status code.
+func (f *ResponseFactory) Reason(code StatusCode) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.reasons.Reason(code)
+}
+
+// NewResponse creates response on the request with the reason phrase from the catalog.
+func (f *ResponseFactory) NewResponse(req Request, code StatusCode, body string, headers ...Header) Response {
+	return f.NewResponseWithReason(req, code, "", body, headers...)
+}
+
+// NewResponseWithReason creates response on the request with the custom reason phrase,
+// empty reason means phrase from the catalog.
+// Default headers are appended unless the same headers are passed.
+func (f *ResponseFactory) NewResponseWithReason(
+	req Request,
+	code StatusCode,
+	reason, body string,
+	headers ...Header,
+) Response {
+	if reason == "" {
+		reason = f.Reason(code)
+	}
+
+	res := NewResponseFromRequest("", req, code, reason, body)
+	for _, header := range headers {
+		res.AppendHeader(header)
+	}
+
+	f.mu.RLock()
+	defaults := f.headers
+	f.mu.RUnlock()
+	for _, header := range defaults {
+		if len(res.GetHeaders(header.Name())) == 0 {
+			res.AppendHeader(header.Clone())
+		}
+	}
+
+	return res
+}
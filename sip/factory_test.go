@@ -0,0 +1,50 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestReasonCatalog(t *testing.T) {
+	catalog := sip.ReasonCatalog{486: "Occupé"}
+
+	for _, test := range []struct {
+		code     sip.StatusCode
+		expected string
+	}{
+		{486, "Occupé"},
+		{404, "Not Found"},
+		{499, "Bad Request"},
+		{182, "Queued"},
+		{199, "Early Dialog Terminated"},
+		{650, "Busy Everywhere"},
+	} {
+		if reason := catalog.Reason(test.code); reason != test.expected {
+			t.Errorf("expected reason '%s' of %d, got '%s'", test.expected, test.code, reason)
+		}
+	}
+}
+
+func TestResponseFactory(t *testing.T) {
+	server := sip.ServerHeader("GoSIP")
+	factory := sip.NewResponseFactory(sip.ReasonCatalog{404: "Nicht gefunden"}, &server)
+	req := newCallerIDRequest(nil)
+
+	res := factory.NewResponse(req, 404, "")
+	if res.Reason() != "Nicht gefunden" {
+		t.Errorf("expected localized reason, got '%s'", res.Reason())
+	}
+	if hdrs := res.GetHeaders("Server"); len(hdrs) != 1 || hdrs[0].Value() != "GoSIP" {
+		t.Errorf("expected default 'Server' header, got %v", hdrs)
+	}
+
+	custom := sip.ServerHeader("Custom")
+	res = factory.NewResponseWithReason(req, 486, "Try Later", "", &custom)
+	if res.Reason() != "Try Later" {
+		t.Errorf("expected custom reason, got '%s'", res.Reason())
+	}
+	if hdrs := res.GetHeaders("Server"); len(hdrs) != 1 || hdrs[0].Value() != "Custom" {
+		t.Errorf("expected passed 'Server' header, got %v", hdrs)
+	}
+}
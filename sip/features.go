@@ -0,0 +1,151 @@
+package sip
+
+import "strings"
+
+// Option tags of SIP extensions listed in the 'Supported', 'Require', 'Proxy-Require'
+// and 'Unsupported' headers - RFC 3261 19.2.
+const (
+	// Option100rel is the option tag of reliable provisional responses - RFC 3262.
+	Option100rel = "100rel"
+	// OptionTimer is the option tag of session timers - RFC 4028.
+	OptionTimer = "timer"
+	// OptionPath is the option tag of the 'Path' header of registrations - RFC 3327.
+	OptionPath = "path"
+	// OptionOutbound is the option tag of SIP Outbound - RFC 5626.
+	OptionOutbound = "outbound"
+	// OptionGruu is the option tag of globally routable UA URIs - RFC 5627.
+	OptionGruu = "gruu"
+	// OptionReplaces is the option tag of the 'Replaces' header - RFC 3891.
+	OptionReplaces = "replaces"
+	// OptionJoin is the option tag of the 'Join' header - RFC 3911.
+	OptionJoin = "join"
+	// OptionNoReferSub is the option tag of REFER without implicit subscription - RFC 4488.
+	OptionNoReferSub = "norefersub"
+	// OptionTargetDialog is the option tag of the 'Target-Dialog' header - RFC 4538.
+	OptionTargetDialog = "tdialog"
+	// OptionPrecondition is the option tag of preconditions - RFC 3312.
+	OptionPrecondition = "precondition"
+	// OptionHistInfo is the option tag of the 'History-Info' header - RFC 7044.
+	OptionHistInfo = "histinfo"
+	// OptionEventList is the option tag of resource list subscriptions - RFC 4662.
+	OptionEventList = "eventlist"
+)
+
+// Features toggles SIP extensions supported by the UA. It builds the 'Supported'
+// and 'Require' headers of outgoing messages and validates option tags required by the peer.
+type Features struct {
+	Reliable100 bool
+	Timer       bool
+	Path        bool
+	Outbound    bool
+	Gruu        bool
+	Replaces    bool
+	// Extra are option tags of other supported extensions.
+	Extra []string
+	// Required are option tags of extensions the peer must support, they are listed
+	// in the 'Require' header and added to supported ones.
+	Required []string
+}
+
+// Tags returns option tags of all supported extensions without duplicates.
+func (f *Features) Tags() []string {
+	if f == nil {
+		return nil
+	}
+
+	var tags []string
+	add := func(tag string) {
+		if !HasToken(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, toggle := range []struct {
+		on  bool
+		tag string
+	}{
+		{f.Reliable100, Option100rel},
+		{f.Timer, OptionTimer},
+		{f.Path, OptionPath},
+		{f.Outbound, OptionOutbound},
+		{f.Gruu, OptionGruu},
+		{f.Replaces, OptionReplaces},
+	} {
+		if toggle.on {
+			add(toggle.tag)
+		}
+	}
+	for _, tag := range f.Extra {
+		add(tag)
+	}
+	for _, tag := range f.Required {
+		add(tag)
+	}
+
+	return tags
+}
+
+// Supports checks that the extension with the option tag is supported.
+func (f *Features) Supports(tag string) bool {
+	return HasToken(f.Tags(), tag)
+}
+
+// SupportedHeader returns the 'Supported' header listing all supported extensions,
+// nil if there are none.
+func (f *Features) SupportedHeader() *SupportedHeader {
+	tags := f.Tags()
+	if len(tags) == 0 {
+		return nil
+	}
+	return &SupportedHeader{Options: tags}
+}
+
+// RequireHeader returns the 'Require' header listing required extensions, nil if there are none.
+func (f *Features) RequireHeader() *RequireHeader {
+	if f == nil || len(f.Required) == 0 {
+		return nil
+	}
+
+	tags := make([]string, len(f.Required))
+	copy(tags, f.Required)
+	return &RequireHeader{Options: tags}
+}
+
+// Unsupported returns option tags of the 'Require' header of the message that are not supported.
+// The request with such tags must be rejected with '420 Bad Extension' listing them
+// in the 'Unsupported' header - RFC 3261 8.2.2.3, see NewBadExtensionResponse.
+func (f *Features) Unsupported(msg Message) []string {
+	tags := f.Tags()
+
+	var unsupported []string
+	for _, tag := range RequiredOptions(msg) {
+		if !HasToken(tags, tag) && !HasToken(unsupported, tag) {
+			unsupported = append(unsupported, tag)
+		}
+	}
+	return unsupported
+}
+
+// RequiredOptions returns option tags listed in all 'Require' headers of the message.
+func RequiredOptions(msg Message) []string {
+	var tags []string
+	for _, hdr := range msg.GetHeaders("Require") {
+		if require, ok := hdr.(*RequireHeader); ok {
+			tags = append(tags, require.Options...)
+			continue
+		}
+		for _, tag := range strings.Split(hdr.Value(), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// NewBadExtensionResponse builds '420 Bad Extension' response on the request
+// listing unsupported option tags in the 'Unsupported' header - RFC 3261 8.2.2.3.
+func NewBadExtensionResponse(req Request, unsupported []string) Response {
+	res := NewResponseFromRequest("", req, 420, "Bad Extension", "")
+	res.AppendHeader(&UnsupportedHeader{Options: unsupported})
+	return res
+}
@@ -0,0 +1,55 @@
+package sip_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestFeatures(t *testing.T) {
+	features := &sip.Features{
+		Reliable100: true,
+		Replaces:    true,
+		Extra:       []string{"norefersub", "100REL"},
+		Required:    []string{sip.OptionTimer},
+	}
+
+	if tags := features.Tags(); !reflect.DeepEqual(tags, []string{"100rel", "replaces", "norefersub", "timer"}) {
+		t.Errorf("unexpected option tags %v", tags)
+	}
+	if supported := features.SupportedHeader(); supported.Value() != "100rel, replaces, norefersub, timer" {
+		t.Errorf("unexpected Supported header %s", supported)
+	}
+	if require := features.RequireHeader(); require.Value() != "timer" {
+		t.Errorf("unexpected Require header %s", require)
+	}
+	if !features.Supports("Replaces") || features.Supports(sip.OptionGruu) {
+		t.Error("unexpected supported extensions")
+	}
+
+	req := parseDialogMessage(t,
+		"INVITE sip:bob@biloxi.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 314159 INVITE",
+		"Require: 100rel, gruu",
+		"Require: foo, gruu",
+	).(sip.Request)
+	unsupported := features.Unsupported(req)
+	if !reflect.DeepEqual(unsupported, []string{"gruu", "foo"}) {
+		t.Fatalf("unexpected unsupported extensions %v", unsupported)
+	}
+
+	res := sip.NewBadExtensionResponse(req, unsupported)
+	if hdrs := res.GetHeaders("Unsupported"); res.StatusCode() != 420 || len(hdrs) != 1 || hdrs[0].Value() != "gruu, foo" {
+		t.Errorf("unexpected response\n%s", res)
+	}
+
+	var disabled *sip.Features
+	if disabled.SupportedHeader() != nil || disabled.RequireHeader() != nil || len(disabled.Unsupported(req)) != 3 {
+		t.Error("nil features must support nothing")
+	}
+}
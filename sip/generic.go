@@ -0,0 +1,58 @@
+//go:build go1.18
+// +build go1.18
+
+package sip
+
+import "fmt"
+
+// FindHeader returns the first header of type T from the list,
+// e.g. FindHeader[*ContactHeader](headers) instead of type assertion of each header.
+func FindHeader[T Header](headers []Header) (T, bool) {
+	for _, header := range headers {
+		if typed, ok := header.(T); ok {
+			return typed, true
+		}
+	}
+
+	var zero T
+	return zero, false
+}
+
+// FindHeaders returns all headers of type T from the list in the order of the list.
+func FindHeaders[T Header](headers []Header) []T {
+	typed := make([]T, 0)
+	for _, header := range headers {
+		if h, ok := header.(T); ok {
+			typed = append(typed, h)
+		}
+	}
+	return typed
+}
+
+// GetHeader returns the first header of type T of the message, e.g. GetHeader[*CSeq](msg).
+func GetHeader[T Header](msg Message) (T, bool) {
+	return FindHeader[T](msg.Headers())
+}
+
+// GetHeaders returns all headers of type T of the message.
+func GetHeaders[T Header](msg Message) []T {
+	return FindHeaders[T](msg.Headers())
+}
+
+// MustFindHeader is like FindHeader but panics if the header is not found, it is intended for tests.
+func MustFindHeader[T Header](headers []Header) T {
+	header, ok := FindHeader[T](headers)
+	if !ok {
+		panic(fmt.Sprintf("header of type %T not found", header))
+	}
+	return header
+}
+
+// MustGetHeader is like GetHeader but panics if the header is not found, it is intended for tests.
+func MustGetHeader[T Header](msg Message) T {
+	header, ok := GetHeader[T](msg)
+	if !ok {
+		panic(fmt.Sprintf("header of type %T not found in %s", header, msg.Short()))
+	}
+	return header
+}
@@ -0,0 +1,44 @@
+//go:build go1.18
+// +build go1.18
+
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestGetHeader(t *testing.T) {
+	req := parseDialogMessage(t,
+		"INVITE sip:bob@biloxi.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 314159 INVITE",
+		"Contact: <sip:alice@pc33.atlanta.com>",
+		"Contact: <sip:alice@192.0.2.1>",
+	)
+
+	cseq, ok := sip.GetHeader[*sip.CSeq](req)
+	if !ok || cseq.SeqNo != 314159 {
+		t.Errorf("unexpected CSeq %v", cseq)
+	}
+	if contacts := sip.GetHeaders[*sip.ContactHeader](req); len(contacts) != 2 || contacts[1].Address.Host() != "192.0.2.1" {
+		t.Errorf("unexpected contacts %v", contacts)
+	}
+	if to := sip.MustFindHeader[*sip.ToHeader](req.GetHeaders("To")); to.Address.User().String() != "bob" {
+		t.Errorf("unexpected To %s", to)
+	}
+	if route, ok := sip.GetHeader[*sip.RouteHeader](req); ok || route != nil {
+		t.Errorf("unexpected Route %v", route)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on missing header")
+		}
+	}()
+	sip.MustGetHeader[*sip.RouteHeader](req)
+}
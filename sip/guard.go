@@ -0,0 +1,209 @@
+package sip
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type AuthGuardEventKind int
+
+const (
+	// AuthFailed is emitted on each failed authentication attempt.
+	AuthFailed AuthGuardEventKind = iota
+	// AuthLockedOut is emitted when the source or username is temporary locked out.
+	AuthLockedOut
+	// AuthBanned is emitted when the source is handed over to the Ban hook.
+	AuthBanned
+)
+
+func (kind AuthGuardEventKind) String() string {
+	switch kind {
+	case AuthFailed:
+		return "failed"
+	case AuthLockedOut:
+		return "locked out"
+	case AuthBanned:
+		return "banned"
+	default:
+		return "unknown"
+	}
+}
+
+type AuthGuardEvent struct {
+	Kind     AuthGuardEventKind
+	Source   string
+	Username string
+	Failures int
+	// Until is the end of backoff or lockout.
+	Until time.Time
+}
+
+type authAttempts struct {
+	failures int
+	lockouts int
+	until    time.Time
+	last     time.Time
+}
+
+// AuthGuard protects authentication from brute-force attacks.
+// It tracks failed attempts per source host and per username, blocks further attempts
+// with exponentially growing backoff, locks out after MaxFailures
+// and passes persistent offenders to the Ban hook (e.g. ACL or blacklist).
+type AuthGuard struct {
+	// MaxFailures is a number of consecutive failures that causes lockout.
+	MaxFailures int
+	// BaseDelay is a backoff after the first failure, doubled with each next failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutDuration is how long locked out source or username is blocked.
+	LockoutDuration time.Duration
+	// BanAfter is a number of lockouts of the source after which Ban is called, zero disables banning.
+	BanAfter int
+	// ForgetAfter is an idle period after which attempts are forgotten.
+	ForgetAfter time.Duration
+
+	// Ban is called with the source host of a persistent offender.
+	Ban func(source string)
+	// OnEvent receives guard events.
+	OnEvent func(event AuthGuardEvent)
+
+	mu      sync.Mutex
+	sources map[string]*authAttempts
+	users   map[string]*authAttempts
+}
+
+func NewAuthGuard() *AuthGuard {
+	return &AuthGuard{
+		MaxFailures:     5,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		BanAfter:        3,
+		ForgetAfter:     time.Hour,
+		sources:         make(map[string]*authAttempts),
+		users:           make(map[string]*authAttempts),
+	}
+}
+
+// Check returns for how long attempts from the source or for the username are blocked, zero if allowed.
+// Source may be in host:port form, only host is taken into account.
+func (g *AuthGuard) Check(source, username string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, attempts := range []*authAttempts{g.get(g.sources, sourceHost(source), now), g.get(g.users, username, now)} {
+		if attempts != nil && attempts.until.After(now) {
+			if d := attempts.until.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+
+	return wait
+}
+
+// Failure registers failed authentication attempt.
+func (g *AuthGuard) Failure(source, username string) {
+	host := sourceHost(source)
+	events := make([]AuthGuardEvent, 0, 3)
+
+	g.mu.Lock()
+	now := time.Now()
+	for _, entry := range []struct {
+		attempts map[string]*authAttempts
+		key      string
+		isSource bool
+	}{{g.sources, host, true}, {g.users, username, false}} {
+		if entry.key == "" {
+			continue
+		}
+
+		attempts := g.get(entry.attempts, entry.key, now)
+		if attempts == nil {
+			attempts = &authAttempts{}
+			entry.attempts[entry.key] = attempts
+		}
+		attempts.failures++
+		attempts.last = now
+
+		if attempts.failures < g.MaxFailures {
+			delay := g.BaseDelay << uint(attempts.failures-1)
+			if delay > g.MaxDelay || delay <= 0 {
+				delay = g.MaxDelay
+			}
+			attempts.until = now.Add(delay)
+			continue
+		}
+
+		attempts.failures = 0
+		attempts.lockouts++
+		attempts.until = now.Add(g.LockoutDuration)
+		event := AuthGuardEvent{Kind: AuthLockedOut, Failures: g.MaxFailures, Until: attempts.until}
+		if entry.isSource {
+			event.Source = host
+		} else {
+			event.Username = username
+		}
+		events = append(events, event)
+
+		if entry.isSource && g.BanAfter > 0 && attempts.lockouts >= g.BanAfter {
+			events = append(events, AuthGuardEvent{Kind: AuthBanned, Source: host, Until: attempts.until})
+		}
+	}
+	failures := 0
+	if attempts, ok := g.sources[host]; ok {
+		failures = attempts.failures
+	}
+	g.mu.Unlock()
+
+	g.emit(AuthGuardEvent{Kind: AuthFailed, Source: host, Username: username, Failures: failures})
+	for _, event := range events {
+		if event.Kind == AuthBanned && g.Ban != nil {
+			g.Ban(event.Source)
+		}
+		g.emit(event)
+	}
+}
+
+// Success resets failures of the source and the username.
+func (g *AuthGuard) Success(source, username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, attempts := range []*authAttempts{g.sources[sourceHost(source)], g.users[username]} {
+		if attempts != nil {
+			attempts.failures = 0
+			attempts.until = time.Time{}
+		}
+	}
+}
+
+func (g *AuthGuard) get(attempts map[string]*authAttempts, key string, now time.Time) *authAttempts {
+	entry, ok := attempts[key]
+	if !ok {
+		return nil
+	}
+	if g.ForgetAfter > 0 && entry.until.Before(now) && now.Sub(entry.last) > g.ForgetAfter {
+		delete(attempts, key)
+		return nil
+	}
+
+	return entry
+}
+
+func (g *AuthGuard) emit(event AuthGuardEvent) {
+	if g.OnEvent != nil {
+		g.OnEvent(event)
+	}
+}
+
+func sourceHost(source string) string {
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		return host
+	}
+
+	return source
+}
@@ -0,0 +1,96 @@
+package sip_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestAuthGuard(t *testing.T) {
+	guard := sip.NewAuthGuard()
+	guard.MaxFailures = 3
+	guard.BaseDelay = 10 * time.Millisecond
+	guard.MaxDelay = 15 * time.Millisecond
+	guard.LockoutDuration = time.Hour
+	guard.BanAfter = 1
+
+	var banned []string
+	var events []sip.AuthGuardEventKind
+	guard.Ban = func(source string) { banned = append(banned, source) }
+	guard.OnEvent = func(event sip.AuthGuardEvent) { events = append(events, event.Kind) }
+
+	if wait := guard.Check("10.0.0.1:5060", "alice"); wait != 0 {
+		t.Fatalf("unexpected wait %s", wait)
+	}
+
+	guard.Failure("10.0.0.1:5060", "alice")
+	if wait := guard.Check("10.0.0.1:5070", "bob"); wait <= 0 || wait > 10*time.Millisecond {
+		t.Errorf("backoff for the source host expected, got %s", wait)
+	}
+	if wait := guard.Check("10.0.0.2:5060", "alice"); wait <= 0 {
+		t.Errorf("backoff for the username expected, got %s", wait)
+	}
+	if wait := guard.Check("10.0.0.2:5060", "bob"); wait != 0 {
+		t.Errorf("unexpected wait %s", wait)
+	}
+
+	guard.Failure("10.0.0.1:5060", "alice")
+	if wait := guard.Check("10.0.0.1:5060", ""); wait <= 10*time.Millisecond {
+		t.Errorf("exponential backoff expected, got %s", wait)
+	}
+
+	guard.Success("10.0.0.1:5060", "alice")
+	if wait := guard.Check("10.0.0.1:5060", "alice"); wait != 0 {
+		t.Errorf("success must reset backoff, got %s", wait)
+	}
+
+	for i := 0; i < 3; i++ {
+		guard.Failure("10.0.0.1:5060", "alice")
+	}
+	if wait := guard.Check("10.0.0.1:5060", ""); wait < time.Minute {
+		t.Errorf("lockout expected, got %s", wait)
+	}
+	if len(banned) != 1 || banned[0] != "10.0.0.1" {
+		t.Errorf("source must be banned, got %v", banned)
+	}
+	expected := []sip.AuthGuardEventKind{
+		sip.AuthFailed, sip.AuthFailed, sip.AuthFailed, sip.AuthFailed,
+		sip.AuthFailed, sip.AuthLockedOut, sip.AuthBanned, sip.AuthLockedOut,
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("expected events %v, got %v", expected, events)
+			break
+		}
+	}
+}
+
+func TestDigestVerifierGuard(t *testing.T) {
+	store := sip.StaticHA1Store{}
+	store.Add("alice", "example.com", "secret")
+	verifier := sip.NewDigestVerifier(store, "example.com")
+	verifier.Guard = sip.NewAuthGuard()
+
+	req := sip.NewRequest("", sip.REGISTER, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+	req.SetSource("10.0.0.1:5060")
+	if err := sip.AuthorizeRequest(req, verifier.Challenge(req, false, false), sip.String{Str: "alice"}, sip.String{Str: "wrong"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := verifier.Verify(req, false); err == nil {
+		t.Fatalf("invalid password must be rejected")
+	}
+
+	req = sip.NewRequest("", sip.REGISTER, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+	req.SetSource("10.0.0.1:5060")
+	if err := sip.AuthorizeRequest(req, verifier.Challenge(req, false, false), sip.String{Str: "alice"}, sip.String{Str: "secret"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err := verifier.Verify(req, false)
+	if authErr, ok := err.(*sip.DigestAuthError); !ok || authErr.RetryAfter <= 0 {
+		t.Errorf("attempt during backoff must be blocked, got %v", err)
+	}
+}
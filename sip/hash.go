@@ -0,0 +1,247 @@
+package sip
+
+import (
+	"hash"
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Hasher is implemented by URIs and headers that have a stable hash of their canonical form.
+// Values equal by the RFC 3261 rules have equal hashes, so the hash can be used as a map key
+// to find candidates that are compared with Equals afterwards.
+type Hasher interface {
+	Hash() uint64
+}
+
+// URI parameters that must match if present in either URI - RFC 3261 19.1.4.
+var specialUriParams = []string{"maddr", "method", "transport", "ttl", "user"}
+
+// UriHash returns hash of the URI, URIs without Hash method are hashed by their string representation.
+func UriHash(uri Uri) uint64 {
+	if uri == nil {
+		return 0
+	}
+	if h, ok := uri.(Hasher); ok {
+		return h.Hash()
+	}
+
+	w := newHashWriter()
+	w.field(uri.String())
+	return w.Sum64()
+}
+
+// HeaderHash returns hash of the header, headers without Hash method are hashed
+// by case-insensitive name and value.
+func HeaderHash(header Header) uint64 {
+	if header == nil {
+		return 0
+	}
+	if h, ok := header.(Hasher); ok {
+		return h.Hash()
+	}
+
+	w := newHashWriter()
+	w.field(TokenLower(header.Name()))
+	w.field(header.Value())
+	return w.Sum64()
+}
+
+// Hash returns hash of the canonical form of the URI: case-insensitive host, URI parameters
+// that are significant for comparison and URI headers - RFC 3261 19.1.4.
+// Other URI parameters are ignored, since they are compared only if present in both URIs.
+func (uri *SipUri) Hash() uint64 {
+	if uri == nil {
+		return 0
+	}
+
+	w := newHashWriter()
+	uri.writeHash(w)
+	return w.Sum64()
+}
+
+func (uri *SipUri) writeHash(w hashWriter) {
+	if uri.FIsEncrypted {
+		w.field("sips")
+	} else {
+		w.field("sip")
+	}
+	w.unescaped(uri.FUser)
+	w.unescaped(uri.FPassword)
+	w.field(TokenLower(uri.FHost))
+	if uri.FPort != nil {
+		w.field(strconv.Itoa(int(*uri.FPort)))
+	} else {
+		w.field("")
+	}
+
+	special := make(map[string]MaybeString)
+	if uri.FUriParams != nil {
+		for _, key := range uri.FUriParams.Keys() {
+			val, _ := uri.FUriParams.Get(key)
+			special[TokenLower(key)] = val
+		}
+	}
+	for _, key := range specialUriParams {
+		if val, ok := special[key]; ok {
+			w.field(key)
+			w.lowerMaybe(val)
+		} else {
+			w.field("")
+		}
+	}
+
+	w.params(uri.FHeaders, false)
+}
+
+// Hash of the wildcard URI is the same for all wildcards.
+func (uri WildcardUri) Hash() uint64 {
+	w := newHashWriter()
+	w.field("*")
+	return w.Sum64()
+}
+
+// Hash is calculated from the URI and header parameters, display name is ignored - RFC 3261 20.39.
+func (to *ToHeader) Hash() uint64 {
+	return addressHeaderHash("to", to.Address, to.Params)
+}
+
+// Hash is calculated from the URI and header parameters, display name is ignored - RFC 3261 20.20.
+func (from *FromHeader) Hash() uint64 {
+	return addressHeaderHash("from", from.Address, from.Params)
+}
+
+// Hash is calculated from the URI and header parameters, display name is ignored - RFC 3261 20.10.
+func (contact *ContactHeader) Hash() uint64 {
+	return addressHeaderHash("contact", contact.Address, contact.Params)
+}
+
+func (callId *CallID) Hash() uint64 {
+	w := newHashWriter()
+	w.field("call-id")
+	w.field(string(*callId))
+	return w.Sum64()
+}
+
+func (cseq *CSeq) Hash() uint64 {
+	w := newHashWriter()
+	w.field("cseq")
+	w.field(strconv.FormatUint(uint64(cseq.SeqNo), 10))
+	w.field(string(cseq.MethodName))
+	return w.Sum64()
+}
+
+func (via ViaHeader) Hash() uint64 {
+	w := newHashWriter()
+	for _, hop := range via {
+		w.field(strconv.FormatUint(hop.Hash(), 16))
+	}
+	return w.Sum64()
+}
+
+// Hash is calculated from case-insensitive protocol, transport, sent-by and parameters.
+func (hop *ViaHop) Hash() uint64 {
+	w := newHashWriter()
+	w.field("via")
+	w.field(TokenLower(hop.ProtocolName))
+	w.field(hop.ProtocolVersion)
+	w.field(TokenLower(hop.Transport))
+	w.field(TokenLower(hop.Host))
+	if hop.Port != nil {
+		w.field(strconv.Itoa(int(*hop.Port)))
+	} else {
+		w.field("")
+	}
+	w.params(hop.Params, true)
+	return w.Sum64()
+}
+
+func (header *GenericHeader) Hash() uint64 {
+	w := newHashWriter()
+	w.field(TokenLower(header.HeaderName))
+	w.field(header.Contents)
+	return w.Sum64()
+}
+
+func addressHeaderHash(name string, uri Uri, params Params) uint64 {
+	w := newHashWriter()
+	w.field(name)
+	if sipUri, ok := uri.(*SipUri); ok && sipUri != nil {
+		sipUri.writeHash(w)
+	} else {
+		w.field(strconv.FormatUint(UriHash(uri), 16))
+	}
+	w.params(params, true)
+	return w.Sum64()
+}
+
+type hashWriter struct {
+	hash.Hash64
+}
+
+func newHashWriter() hashWriter {
+	return hashWriter{fnv.New64a()}
+}
+
+// Writes the value followed by separator, so that adjacent fields can't be confused.
+func (w hashWriter) field(s string) {
+	w.Write([]byte(s))
+	w.Write([]byte{0})
+}
+
+func (w hashWriter) maybe(val MaybeString) {
+	if val == nil {
+		w.field("")
+		return
+	}
+	w.field(val.String())
+}
+
+// Writes the value with percent-encoded characters decoded, so that '%61lice' and 'alice' are the same.
+func (w hashWriter) unescaped(val MaybeString) {
+	if val == nil {
+		w.field("")
+		return
+	}
+	s := val.String()
+	if unescaped, err := Unescape(s, EncodeUserPassword); err == nil {
+		s = unescaped
+	}
+	w.field(s)
+}
+
+func (w hashWriter) lowerMaybe(val MaybeString) {
+	if val == nil {
+		w.field("")
+		return
+	}
+	w.field(TokenLower(val.String()))
+}
+
+// Writes parameters sorted by lowercase name, values are lowercased if lowerValues is set.
+func (w hashWriter) params(params Params, lowerValues bool) {
+	if params == nil {
+		w.field("")
+		return
+	}
+
+	items := make(map[string]MaybeString, params.Length())
+	keys := make([]string, 0, params.Length())
+	for _, key := range params.Keys() {
+		val, _ := params.Get(key)
+		key = TokenLower(key)
+		items[key] = val
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		w.field(key)
+		if lowerValues {
+			w.lowerMaybe(items[key])
+		} else {
+			w.maybe(items[key])
+		}
+	}
+	w.field("")
+}
@@ -0,0 +1,110 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func TestUriHash(t *testing.T) {
+	parse := func(s string) sip.Uri {
+		uri, err := parser.ParseUri(s)
+		if err != nil {
+			t.Fatalf("parse %s: %s", s, err)
+		}
+		return uri
+	}
+
+	// RFC 3261 19.1.4 examples
+	equal := [][2]string{
+		{"sip:%61lice@atlanta.com;transport=TCP", "sip:alice@AtLanTa.CoM;Transport=tcp"},
+		{"sip:carol@chicago.com", "sip:carol@chicago.com;newparam=5"},
+		{"sip:carol@chicago.com;security=on", "sip:carol@chicago.com;newparam=5"},
+		{"sip:biloxi.com;transport=tcp;method=REGISTER?to=sip:bob%40biloxi.com",
+			"sip:biloxi.com;method=REGISTER;transport=tcp?to=sip:bob%40biloxi.com"},
+		{"sip:alice@atlanta.com?subject=project%20x&priority=urgent",
+			"sip:alice@atlanta.com?priority=urgent&subject=project%20x"},
+	}
+	for _, pair := range equal {
+		a, b := parse(pair[0]), parse(pair[1])
+		if sip.UriHash(a) != sip.UriHash(b) {
+			t.Errorf("hashes of %s and %s differ", pair[0], pair[1])
+		}
+	}
+
+	different := [][2]string{
+		{"SIP:ALICE@AtLanTa.CoM;Transport=udp", "sip:alice@AtLanTa.CoM;Transport=UDP"},
+		{"sip:bob@biloxi.com", "sip:bob@biloxi.com:5060"},
+		{"sip:bob@biloxi.com", "sip:bob@biloxi.com;transport=udp"},
+		{"sip:bob@biloxi.com", "sips:bob@biloxi.com"},
+		{"sip:carol@chicago.com", "sip:carol@chicago.com?Subject=next%20meeting"},
+	}
+	for _, pair := range different {
+		a, b := parse(pair[0]), parse(pair[1])
+		if sip.UriHash(a) == sip.UriHash(b) {
+			t.Errorf("hashes of %s and %s are equal", pair[0], pair[1])
+		}
+	}
+
+	if sip.UriHash(sip.WildcardUri{}) != sip.UriHash(&sip.WildcardUri{}) {
+		t.Errorf("hashes of wildcard URIs differ")
+	}
+}
+
+func TestHeaderHash(t *testing.T) {
+	msg, err := parser.ParseMessage([]byte(
+		"INVITE sip:bob@biloxi.com SIP/2.0\r\n"+
+			"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds\r\n"+
+			"Via: SIP/2.0/udp PC33.atlanta.com;BRANCH=z9hG4bK776asdhds\r\n"+
+			"To: Bob <sip:bob@biloxi.com>\r\n"+
+			"From: Alice <sip:alice@atlanta.com>;tag=1928301774\r\n"+
+			"Contact: <sip:alice@pc33.atlanta.com;foo=bar>;expires=60\r\n"+
+			"Contact: \"Alice\" <sip:alice@PC33.atlanta.com>;EXPIRES=60\r\n"+
+			"Call-ID: a84b4c76e66710@pc33.atlanta.com\r\n"+
+			"CSeq: 314159 INVITE\r\n"+
+			"X-Custom: value\r\n"+
+			"x-custom: value\r\n"+
+			"Content-Length: 0\r\n"+
+			"\r\n",
+	), log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("parse message: %s", err)
+	}
+
+	vias := msg.GetHeaders("Via")
+	if sip.HeaderHash(vias[0]) != sip.HeaderHash(vias[1]) {
+		t.Errorf("hashes of %s and %s differ", vias[0], vias[1])
+	}
+	contacts := msg.GetHeaders("Contact")
+	if sip.HeaderHash(contacts[0]) != sip.HeaderHash(contacts[1]) {
+		t.Errorf("hashes of %s and %s differ", contacts[0], contacts[1])
+	}
+	custom := msg.GetHeaders("X-Custom")
+	if len(custom) != 2 || sip.HeaderHash(custom[0]) != sip.HeaderHash(custom[1]) {
+		t.Errorf("hashes of %v differ", custom)
+	}
+
+	to, _ := msg.To()
+	from, _ := msg.From()
+	if sip.HeaderHash(to) == sip.HeaderHash(from) {
+		t.Errorf("hashes of %s and %s are equal", to, from)
+	}
+	tagged := to.Clone().(*sip.ToHeader)
+	tagged.Params.Add("tag", sip.String{Str: "a6c85cf"})
+	if sip.HeaderHash(to) == sip.HeaderHash(tagged) {
+		t.Errorf("hashes of %s and %s are equal", to, tagged)
+	}
+
+	callID, _ := msg.CallID()
+	if sip.HeaderHash(callID) != sip.HeaderHash(callID.Clone()) {
+		t.Errorf("hashes of Call-ID clones differ")
+	}
+	cseq, _ := msg.CSeq()
+	next := cseq.Clone().(*sip.CSeq)
+	next.SeqNo++
+	if sip.HeaderHash(cseq) == sip.HeaderHash(next) {
+		t.Errorf("hashes of %s and %s are equal", cseq, next)
+	}
+}
@@ -114,6 +114,53 @@ func (params *headerParams) Get(key string) (MaybeString, bool) {
 	return v, ok
 }
 
+// AllParams returns iterator over parameters in order, it is iter.Seq2[string, string] of Go 1.23.
+// Value of a parameter without value is empty.
+func AllParams(params Params) func(yield func(key, val string) bool) {
+	if params, ok := params.(*headerParams); ok {
+		return params.all()
+	}
+
+	return func(yield func(key, val string) bool) {
+		if params == nil {
+			return
+		}
+		for _, key := range params.Keys() {
+			var str string
+			if val, ok := params.Get(key); ok && val != nil {
+				str = val.String()
+			}
+			if !yield(key, str) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates parameters without copying them, the lock is not held while yielding.
+func (params *headerParams) all() func(yield func(key, val string) bool) {
+	return func(yield func(key, val string) bool) {
+		for i := 0; ; i++ {
+			params.mu.RLock()
+			if i >= len(params.paramOrder) {
+				params.mu.RUnlock()
+				return
+			}
+			key := params.paramOrder[i]
+			val := params.params[key]
+			params.mu.RUnlock()
+
+			var str string
+			if val != nil {
+				str = val.String()
+			}
+			if !yield(key, str) {
+				return
+			}
+		}
+	}
+}
+
 // Put a new parameter.
 func (params *headerParams) Add(key string, val MaybeString) Params {
 	params.mu.Lock()
@@ -522,7 +569,7 @@ func (uri WildcardUri) String() string {
 // This is true if and only if the other URI is also a wildcard URI.
 func (uri WildcardUri) Equals(other interface{}) bool {
 	switch other.(type) {
-	case WildcardUri:
+	case WildcardUri, *WildcardUri:
 		return true
 	default:
 		return false
@@ -766,6 +813,11 @@ func (from *FromHeader) Equals(other interface{}) bool {
 	return false
 }
 
+// NewWildcardContact creates the wildcard 'Contact: *' header.
+func NewWildcardContact() *ContactHeader {
+	return &ContactHeader{Address: WildcardUri{}}
+}
+
 type ContactHeader struct {
 	// The display name from the header, may be omitted.
 	DisplayName MaybeString
@@ -787,11 +839,10 @@ func (contact *ContactHeader) Value() string {
 		buffer.WriteString(fmt.Sprintf("\"%s\" ", displayName))
 	}
 
-	switch contact.Address.(type) {
-	case *WildcardUri:
+	if contact.IsWildcard() {
 		// Treat the Wildcard URI separately as it must not be contained in < > angle brackets.
 		buffer.WriteString("*")
-	default:
+	} else {
 		buffer.WriteString(fmt.Sprintf("<%s>", contact.Address.String()))
 	}
 
@@ -803,6 +854,11 @@ func (contact *ContactHeader) Value() string {
 	return buffer.String()
 }
 
+// IsWildcard checks that the header is the wildcard 'Contact: *' used to remove all bindings - RFC 3261 10.2.2.
+func (contact *ContactHeader) IsWildcard() bool {
+	return contact.Address != nil && contact.Address.IsWildcard()
+}
+
 // Copy the header.
 func (contact *ContactHeader) Clone() Header {
 	var newCnt *ContactHeader
@@ -1054,6 +1110,17 @@ func (via ViaHeader) String() string {
 
 func (via ViaHeader) Name() string { return "Via" }
 
+// Hops returns iterator over the hops, it is iter.Seq[*ViaHop] of Go 1.23.
+func (via ViaHeader) Hops() func(yield func(*ViaHop) bool) {
+	return func(yield func(*ViaHop) bool) {
+		for _, hop := range via {
+			if !yield(hop) {
+				return
+			}
+		}
+	}
+}
+
 func (via ViaHeader) Value() string {
 	var buffer bytes.Buffer
 	for idx, hop := range via {
@@ -1296,6 +1363,57 @@ func (support *SupportedHeader) Equals(other interface{}) bool {
 	return false
 }
 
+// AllowEventsHeader lists event packages supported by the user agent - RFC 6665 8.2.2.
+type AllowEventsHeader struct {
+	Events []string
+}
+
+func (allowEvents *AllowEventsHeader) String() string {
+	return fmt.Sprintf("%s: %s", allowEvents.Name(), allowEvents.Value())
+}
+
+func (allowEvents *AllowEventsHeader) Name() string { return "Allow-Events" }
+
+func (allowEvents *AllowEventsHeader) Value() string {
+	return strings.Join(allowEvents.Events, ", ")
+}
+
+func (allowEvents *AllowEventsHeader) Clone() Header {
+	if allowEvents == nil {
+		var newAllowEvents *AllowEventsHeader
+		return newAllowEvents
+	}
+
+	dup := make([]string, len(allowEvents.Events))
+	copy(dup, allowEvents.Events)
+	return &AllowEventsHeader{dup}
+}
+
+func (allowEvents *AllowEventsHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*AllowEventsHeader); ok {
+		if allowEvents == h {
+			return true
+		}
+		if allowEvents == nil && h != nil || allowEvents != nil && h == nil {
+			return false
+		}
+
+		if len(allowEvents.Events) != len(h.Events) {
+			return false
+		}
+
+		for i, event := range allowEvents.Events {
+			if event != h.Events[i] {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
 type ProxyRequireHeader struct {
 	Options []string
 }
@@ -1619,6 +1737,9 @@ func (route *RouteHeader) Equals(other interface{}) bool {
 		if route == nil && h != nil || route != nil && h == nil {
 			return false
 		}
+		if len(route.Addresses) != len(h.Addresses) {
+			return false
+		}
 
 		for i, uri := range route.Addresses {
 			if !uri.Equals(h.Addresses[i]) {
@@ -1675,6 +1796,9 @@ func (route *RecordRouteHeader) Equals(other interface{}) bool {
 		if route == nil && h != nil || route != nil && h == nil {
 			return false
 		}
+		if len(route.Addresses) != len(h.Addresses) {
+			return false
+		}
 
 		for i, uri := range route.Addresses {
 			if !uri.Equals(h.Addresses[i]) {
@@ -0,0 +1,201 @@
+package sip
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HeaderChangeKind is a kind of header transformation.
+type HeaderChangeKind int
+
+const (
+	HeaderAdded HeaderChangeKind = iota
+	HeaderRemoved
+	HeaderModified
+)
+
+func (kind HeaderChangeKind) String() string {
+	switch kind {
+	case HeaderAdded:
+		return "added"
+	case HeaderRemoved:
+		return "removed"
+	case HeaderModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// HeaderChange records header transformation made by the component.
+// Before is empty for added headers, After is empty for removed ones.
+type HeaderChange struct {
+	Component string
+	Kind      HeaderChangeKind
+	Header    string
+	Before    string
+	After     string
+	At        time.Time
+}
+
+func (change HeaderChange) String() string {
+	switch change.Kind {
+	case HeaderAdded:
+		return fmt.Sprintf("sip.HeaderChange<%s %s '%s: %s'>", change.Component, change.Kind, change.Header, change.After)
+	case HeaderRemoved:
+		return fmt.Sprintf("sip.HeaderChange<%s %s '%s: %s'>", change.Component, change.Kind, change.Header, change.Before)
+	default:
+		return fmt.Sprintf(
+			"sip.HeaderChange<%s %s '%s: %s' -> '%s'>",
+			change.Component,
+			change.Kind,
+			change.Header,
+			change.Before,
+			change.After,
+		)
+	}
+}
+
+// HeaderTrace is a transformation log of message headers, e.g. for debugging or audit of identity headers handling.
+// It is attached to the message metadata, so clones of the message share the trace.
+type HeaderTrace struct {
+	mu      sync.RWMutex
+	changes []HeaderChange
+}
+
+type headerTraceKey struct{}
+
+// EnableHeaderTrace attaches transformation log to the message, returns already attached log if any.
+// Messages without the log are not traced.
+func EnableHeaderTrace(msg Message) *HeaderTrace {
+	if trace, ok := GetHeaderTrace(msg); ok {
+		return trace
+	}
+
+	trace := &HeaderTrace{}
+	MessageMetadata(msg).SetValue(headerTraceKey{}, trace)
+	return trace
+}
+
+// GetHeaderTrace returns transformation log attached to the message.
+func GetHeaderTrace(msg Message) (*HeaderTrace, bool) {
+	trace, ok := MessageMetadata(msg).Value(headerTraceKey{}).(*HeaderTrace)
+	return trace, ok
+}
+
+// TraceHeaders captures headers of the message and returns function that records changes made since then
+// on behalf of the component. The returned function records changes only once, subsequent calls are no-op.
+// It does nothing if the message has no transformation log.
+func TraceHeaders(msg Message, component string) func() {
+	trace, ok := GetHeaderTrace(msg)
+	if !ok {
+		return func() {}
+	}
+
+	before := headerValues(msg)
+	once := new(sync.Once)
+	return func() {
+		once.Do(func() {
+			trace.record(component, before, headerValues(msg))
+		})
+	}
+}
+
+// Changes returns recorded changes in order of occurrence.
+func (trace *HeaderTrace) Changes() []HeaderChange {
+	trace.mu.RLock()
+	defer trace.mu.RUnlock()
+
+	changes := make([]HeaderChange, len(trace.changes))
+	copy(changes, trace.changes)
+	return changes
+}
+
+// Provenance returns recorded changes of the header.
+func (trace *HeaderTrace) Provenance(name string) []HeaderChange {
+	trace.mu.RLock()
+	defer trace.mu.RUnlock()
+
+	changes := make([]HeaderChange, 0)
+	for _, change := range trace.changes {
+		if TokenEqual(change.Header, name) {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Record appends the change, e.g. for transformations that are not visible as header diff.
+func (trace *HeaderTrace) Record(change HeaderChange) {
+	if change.At.IsZero() {
+		change.At = time.Now()
+	}
+
+	trace.mu.Lock()
+	trace.changes = append(trace.changes, change)
+	trace.mu.Unlock()
+}
+
+// Compares header values by name, values of the same name are compared positionally.
+func (trace *HeaderTrace) record(component string, before, after *orderedHeaderValues) {
+	now := time.Now()
+	change := func(kind HeaderChangeKind, name, before, after string) {
+		trace.Record(HeaderChange{
+			Component: component,
+			Kind:      kind,
+			Header:    name,
+			Before:    before,
+			After:     after,
+			At:        now,
+		})
+	}
+
+	names := append([]string{}, before.names...)
+	for _, name := range after.names {
+		if _, ok := before.values[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		old, cur := before.values[name], after.values[name]
+		header := before.canonical[name]
+		if header == "" {
+			header = after.canonical[name]
+		}
+
+		for i := 0; i < len(old) || i < len(cur); i++ {
+			switch {
+			case i >= len(old):
+				change(HeaderAdded, header, "", cur[i])
+			case i >= len(cur):
+				change(HeaderRemoved, header, old[i], "")
+			case old[i] != cur[i]:
+				change(HeaderModified, header, old[i], cur[i])
+			}
+		}
+	}
+}
+
+type orderedHeaderValues struct {
+	names     []string
+	canonical map[string]string
+	values    map[string][]string
+}
+
+func headerValues(msg Message) *orderedHeaderValues {
+	hvs := &orderedHeaderValues{
+		canonical: make(map[string]string),
+		values:    make(map[string][]string),
+	}
+	for _, hdr := range msg.Headers() {
+		name := TokenLower(hdr.Name())
+		if _, ok := hvs.values[name]; !ok {
+			hvs.names = append(hvs.names, name)
+			hvs.canonical[name] = hdr.Name()
+		}
+		hvs.values[name] = append(hvs.values[name], hdr.Value())
+	}
+	return hvs
+}
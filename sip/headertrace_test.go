@@ -0,0 +1,67 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestHeaderTrace(t *testing.T) {
+	req := sip.NewRequest("", sip.INVITE, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", []sip.Header{
+		&sip.GenericHeader{HeaderName: "P-Asserted-Identity", Contents: "<sip:alice@example.com>"},
+		&sip.GenericHeader{HeaderName: "Privacy", Contents: "none"},
+	}, "", nil)
+
+	// not traced without the log
+	sip.TraceHeaders(req, "noop")()
+	if _, ok := sip.GetHeaderTrace(req); ok {
+		t.Fatal("expected no header trace")
+	}
+
+	trace := sip.EnableHeaderTrace(req)
+	if sip.EnableHeaderTrace(req) != trace {
+		t.Error("expected the same trace on repeated enable")
+	}
+
+	done := sip.TraceHeaders(req, "identity")
+	req.RemoveHeader("Privacy")
+	req.RemoveHeader("P-Asserted-Identity")
+	req.AppendHeader(&sip.GenericHeader{HeaderName: "P-Asserted-Identity", Contents: "<sip:bob@example.com>"})
+	req.AppendHeader(&sip.GenericHeader{HeaderName: "Identity", Contents: "token"})
+	done()
+	done()
+
+	changes := trace.Changes()
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %v", changes)
+	}
+	expected := []struct {
+		kind          sip.HeaderChangeKind
+		header        string
+		before, after string
+	}{
+		{sip.HeaderModified, "P-Asserted-Identity", "<sip:alice@example.com>", "<sip:bob@example.com>"},
+		{sip.HeaderRemoved, "Privacy", "none", ""},
+		{sip.HeaderAdded, "Identity", "", "token"},
+	}
+	for i, e := range expected {
+		change := changes[i]
+		if change.Component != "identity" || change.Kind != e.kind || change.Header != e.header ||
+			change.Before != e.before || change.After != e.after {
+			t.Errorf("unexpected change %d: %s", i, change)
+		}
+		if change.At.IsZero() {
+			t.Errorf("expected change %d time", i)
+		}
+	}
+
+	if provenance := trace.Provenance("p-asserted-identity"); len(provenance) != 1 {
+		t.Errorf("expected 1 change of 'P-Asserted-Identity', got %v", provenance)
+	}
+
+	clone := req.Clone()
+	sip.TraceHeaders(clone, "clone")()
+	if len(trace.Changes()) != 3 {
+		t.Errorf("expected no changes recorded without modifications, got %v", trace.Changes())
+	}
+}
@@ -0,0 +1,142 @@
+package sip
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/timing"
+)
+
+// Keep returns value of the Via keep parameter - RFC 6223.
+// Returns false if the parameter is missing, zero interval if the parameter has no value,
+// i.e. the client only indicates willingness to send keep-alives.
+func (hop *ViaHop) Keep() (time.Duration, bool) {
+	if hop.Params == nil {
+		return 0, false
+	}
+	val, ok := hop.Params.Get("keep")
+	if !ok {
+		return 0, false
+	}
+	if val == nil || val.String() == "" {
+		return 0, true
+	}
+
+	secs, err := strconv.ParseUint(val.String(), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return time.Duration(secs) * time.Second, true
+}
+
+// SetKeep sets the Via keep parameter, zero interval adds the parameter without value.
+func (hop *ViaHop) SetKeep(interval time.Duration) {
+	if hop.Params == nil {
+		hop.Params = NewParams()
+	}
+	if interval <= 0 {
+		hop.Params.Add("keep", nil)
+		return
+	}
+	hop.Params.Add("keep", String{Str: fmt.Sprintf("%d", interval/time.Second)})
+}
+
+// AcceptKeep sets keep=<seconds> in the top Via of the response
+// if the client indicated willingness to send keep-alives - RFC 6223 4.3.
+// Returns false if keep-alives were not requested.
+func AcceptKeep(res Response, interval time.Duration) bool {
+	hop, ok := res.ViaHop()
+	if !ok {
+		return false
+	}
+	if val, ok := hop.Keep(); !ok || val != 0 {
+		return false
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	hop.SetKeep(interval)
+
+	return true
+}
+
+// FlowKeepAlive sends keep-alives over a flow with the interval negotiated
+// with the Via keep parameter - RFC 6223.
+// Keep-alives are sent at 80-100% of the negotiated interval.
+type FlowKeepAlive struct {
+	// OnChange is called when the negotiated interval changes, zero interval means that keep-alives stopped.
+	OnChange func(old, new time.Duration)
+	// TimerPanics configures handling of panics recovered from the ping function.
+	TimerPanics timing.PanicPolicy
+
+	mu       sync.Mutex
+	ping     func()
+	interval time.Duration
+	timer    timing.RecurringTimer
+}
+
+// NewFlowKeepAlive creates FlowKeepAlive that calls ping to send a keep-alive,
+// e.g. double CRLF over a stream connection or STUN binding request over UDP.
+func NewFlowKeepAlive(ping func()) *FlowKeepAlive {
+	return &FlowKeepAlive{ping: ping}
+}
+
+// Update adjusts keep-alive interval according to the keep parameter in the top Via of the response.
+// Returns true if the response carried keep value.
+func (ka *FlowKeepAlive) Update(res Response) bool {
+	hop, ok := res.ViaHop()
+	if !ok {
+		return false
+	}
+	interval, ok := hop.Keep()
+	if !ok || interval == 0 {
+		return false
+	}
+
+	ka.setInterval(interval)
+
+	return true
+}
+
+// Interval returns current negotiated interval, zero if keep-alives are not sent.
+func (ka *FlowKeepAlive) Interval() time.Duration {
+	ka.mu.Lock()
+	defer ka.mu.Unlock()
+
+	return ka.interval
+}
+
+// Stop stops sending keep-alives.
+func (ka *FlowKeepAlive) Stop() {
+	ka.setInterval(0)
+}
+
+func (ka *FlowKeepAlive) setInterval(interval time.Duration) {
+	ka.mu.Lock()
+	old := ka.interval
+	if old == interval {
+		ka.mu.Unlock()
+		return
+	}
+	if ka.timer != nil {
+		ka.timer.Stop()
+		ka.timer = nil
+	}
+	ka.interval = interval
+	if interval > 0 {
+		ka.timer = timing.NewRecurringTimer(timing.RecurringOptions{
+			Name:     "flow keep-alive",
+			Interval: interval * 4 / 5,
+			Jitter:   interval / 5,
+			Panics:   ka.TimerPanics,
+		}, ka.ping)
+	}
+	ka.mu.Unlock()
+
+	if ka.OnChange != nil {
+		ka.OnChange(old, interval)
+	}
+}
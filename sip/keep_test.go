@@ -0,0 +1,61 @@
+package sip_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func TestViaKeep(t *testing.T) {
+	msg, err := parser.ParseMessage([]byte(strings.Join([]string{
+		"OPTIONS sip:bob@example.com SIP/2.0",
+		"Via: SIP/2.0/TCP 10.0.0.1:5060;branch=z9hG4bK776asdhds;keep",
+		"From: <sip:alice@example.com>;tag=1928301774",
+		"To: <sip:bob@example.com>",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 1 OPTIONS",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")), log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	req := msg.(sip.Request)
+	hop, _ := req.ViaHop()
+	if interval, ok := hop.Keep(); !ok || interval != 0 {
+		t.Fatalf("keep flag expected, got %s, %v", interval, ok)
+	}
+
+	res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+	if !sip.AcceptKeep(res, 30*time.Second) {
+		t.Fatalf("keep must be accepted")
+	}
+	if hop, _ := res.ViaHop(); !strings.Contains(hop.String(), ";keep=30") {
+		t.Errorf("unexpected Via %s", hop)
+	}
+	if sip.AcceptKeep(res, 30*time.Second) {
+		t.Errorf("keep with value must not be accepted twice")
+	}
+
+	var changes [][2]time.Duration
+	ka := sip.NewFlowKeepAlive(func() {})
+	ka.OnChange = func(old, new time.Duration) { changes = append(changes, [2]time.Duration{old, new}) }
+	defer ka.Stop()
+
+	if ka.Update(sip.NewResponseFromRequest("", req, 200, "OK", "")) {
+		t.Errorf("response without keep value must be ignored")
+	}
+	if !ka.Update(res) || ka.Interval() != 30*time.Second {
+		t.Errorf("unexpected interval %s", ka.Interval())
+	}
+	ka.Update(res)
+	ka.Stop()
+	if len(changes) != 2 || changes[0] != [2]time.Duration{0, 30 * time.Second} || changes[1] != [2]time.Duration{30 * time.Second, 0} {
+		t.Errorf("unexpected changes %v", changes)
+	}
+}
@@ -0,0 +1,54 @@
+package sip
+
+// DefaultMaxForwards is a recommended initial value of 'Max-Forwards' header - RFC 3261 8.1.1.6.
+const DefaultMaxForwards MaxForwards = 70
+
+// GetMaxForwards returns value of 'Max-Forwards' header of the message.
+func GetMaxForwards(msg Message) (MaxForwards, bool) {
+	hdrs := msg.GetHeaders("Max-Forwards")
+	if len(hdrs) == 0 {
+		return 0, false
+	}
+	maxForwards, ok := hdrs[0].(*MaxForwards)
+	if !ok || maxForwards == nil {
+		return 0, false
+	}
+	return *maxForwards, true
+}
+
+// SetMaxForwards replaces 'Max-Forwards' header of the message.
+func SetMaxForwards(msg Message, value MaxForwards) {
+	msg.RemoveHeader("Max-Forwards")
+	msg.AppendHeader(&value)
+}
+
+// DecrementMaxForwards prepares request for forwarding - RFC 3261 16.6 step 3.
+// Absent header is inserted with the default value, otherwise it is decremented by one.
+// Returns false if 'Max-Forwards' is zero, such request must not be forwarded
+// and should be rejected with '483 Too Many Hops' - RFC 3261 16.3 step 2.
+func DecrementMaxForwards(req Request, def MaxForwards) bool {
+	value, ok := GetMaxForwards(req)
+	if !ok {
+		SetMaxForwards(req, def)
+		return true
+	}
+	if value == 0 {
+		return false
+	}
+
+	SetMaxForwards(req, value-1)
+	return true
+}
+
+// IsTooManyHops checks that the request has zero 'Max-Forwards' and can't be forwarded further - RFC 3261 16.3 step 2.
+func IsTooManyHops(req Request) bool {
+	value, ok := GetMaxForwards(req)
+	return ok && value == 0
+}
+
+// IsMaxForwardsProbe checks that the request is an OPTIONS request with zero 'Max-Forwards'.
+// Such request can't travel further, the element that receives it may answer it as the final recipient,
+// so it probes the hop at the 'Max-Forwards' distance - RFC 3261 11, 16.3 step 2.
+func IsMaxForwardsProbe(req Request) bool {
+	return req.Method() == OPTIONS && IsTooManyHops(req)
+}
@@ -0,0 +1,46 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestDecrementMaxForwards(t *testing.T) {
+	req := sip.NewRequest("", sip.INVITE, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+
+	if !sip.DecrementMaxForwards(req, sip.DefaultMaxForwards) {
+		t.Fatal("request without Max-Forwards must be forwardable")
+	}
+	if value, ok := sip.GetMaxForwards(req); !ok || value != sip.DefaultMaxForwards {
+		t.Errorf("expected inserted Max-Forwards %d, got %d", sip.DefaultMaxForwards, value)
+	}
+
+	sip.SetMaxForwards(req, 1)
+	if !sip.DecrementMaxForwards(req, sip.DefaultMaxForwards) {
+		t.Fatal("request with Max-Forwards 1 must be forwardable")
+	}
+	if value, _ := sip.GetMaxForwards(req); value != 0 {
+		t.Errorf("expected decremented Max-Forwards 0, got %d", value)
+	}
+	if sip.DecrementMaxForwards(req, sip.DefaultMaxForwards) {
+		t.Error("request with Max-Forwards 0 must not be forwardable")
+	}
+	if !sip.IsTooManyHops(req) {
+		t.Error("request with Max-Forwards 0 must be too many hops")
+	}
+	if len(req.GetHeaders("Max-Forwards")) != 1 {
+		t.Error("expected single Max-Forwards header")
+	}
+}
+
+func TestIsMaxForwardsProbe(t *testing.T) {
+	req := sip.NewRequest("", sip.OPTIONS, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+	if sip.IsMaxForwardsProbe(req) {
+		t.Error("OPTIONS without Max-Forwards is not a probe")
+	}
+	sip.SetMaxForwards(req, 0)
+	if !sip.IsMaxForwardsProbe(req) {
+		t.Error("OPTIONS with Max-Forwards 0 is a probe")
+	}
+}
@@ -2,7 +2,6 @@ package sip
 
 import (
 	"bytes"
-	"strings"
 	"sync"
 
 	uuid "github.com/satori/go.uuid"
@@ -23,7 +22,7 @@ type StatusCode uint16
 // This is syntactic sugar for case insensitive equality checking.
 func (method *RequestMethod) Equals(other *RequestMethod) bool {
 	if method != nil && other != nil {
-		return strings.EqualFold(string(*method), string(*other))
+		return TokenEqual(string(*method), string(*other))
 	} else {
 		return method == other
 	}
@@ -139,17 +138,15 @@ func newHeaders(hdrs []Header) *headers {
 }
 
 func (hs *headers) String() string {
+	return hs.render(nil)
+}
+
+func (hs *headers) render(opts *RenderOptions) string {
 	buffer := bytes.Buffer{}
 	hs.mu.RLock()
 	// Construct each header in turn and add it to the message.
-	for typeIdx, name := range hs.headerOrder {
-		headers := hs.headers[name]
-		for idx, header := range headers {
-			buffer.WriteString(header.String())
-			if typeIdx < len(hs.headerOrder) || idx < len(headers) {
-				buffer.WriteString("\r\n")
-			}
-		}
+	for _, name := range hs.headerOrder {
+		renderHeaders(&buffer, hs.headers[name], opts)
 	}
 	hs.mu.RUnlock()
 	return buffer.String()
@@ -157,7 +154,7 @@ func (hs *headers) String() string {
 
 // Add the given header.
 func (hs *headers) AppendHeader(header Header) {
-	name := strings.ToLower(header.Name())
+	name := TokenLower(header.Name())
 	hs.mu.Lock()
 	if _, ok := hs.headers[name]; ok {
 		hs.headers[name] = append(hs.headers[name], header)
@@ -172,7 +169,7 @@ func (hs *headers) AppendHeader(header Header) {
 // if there is no header has h's name, add h to the font of all headers
 // if there are some headers have h's name, add h to front of the sublist
 func (hs *headers) PrependHeader(header Header) {
-	name := strings.ToLower(header.Name())
+	name := TokenLower(header.Name())
 	hs.mu.Lock()
 	if hdrs, ok := hs.headers[name]; ok {
 		hs.headers[name] = append([]Header{header}, hdrs...)
@@ -186,8 +183,8 @@ func (hs *headers) PrependHeader(header Header) {
 }
 
 func (hs *headers) PrependHeaderAfter(header Header, afterName string) {
-	headerName := strings.ToLower(header.Name())
-	afterName = strings.ToLower(afterName)
+	headerName := TokenLower(header.Name())
+	afterName = TokenLower(afterName)
 	hs.mu.Lock()
 	if _, ok := hs.headers[afterName]; ok {
 		afterIdx := -1
@@ -232,7 +229,7 @@ func (hs *headers) PrependHeaderAfter(header Header, afterName string) {
 }
 
 func (hs *headers) ReplaceHeaders(name string, headers []Header) {
-	name = strings.ToLower(name)
+	name = TokenLower(name)
 	hs.mu.Lock()
 	if _, ok := hs.headers[name]; ok {
 		hs.headers[name] = headers
@@ -252,8 +249,59 @@ func (hs *headers) Headers() []Header {
 	return hdrs
 }
 
+// AllHeaders returns iterator over all message headers, it is iter.Seq[Header] of Go 1.23.
+// Headers may be modified in the loop body.
+func AllHeaders(msg Message) func(yield func(Header) bool) {
+	if hs, ok := msg.(interface {
+		allHeaders() func(yield func(Header) bool)
+	}); ok {
+		return hs.allHeaders()
+	}
+
+	return func(yield func(Header) bool) {
+		for _, hdr := range msg.Headers() {
+			if !yield(hdr) {
+				return
+			}
+		}
+	}
+}
+
+// Contacts returns iterator over entries of all 'Contact' headers, it is iter.Seq[*ContactHeader] of Go 1.23.
+func Contacts(msg Message) func(yield func(*ContactHeader) bool) {
+	return func(yield func(*ContactHeader) bool) {
+		for _, hdr := range msg.GetHeaders("Contact") {
+			if contact, ok := hdr.(*ContactHeader); ok && !yield(contact) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates headers without copying them into intermediate slice,
+// the lock is not held while yielding, so headers may be modified in the loop body.
+func (hs *headers) allHeaders() func(yield func(Header) bool) {
+	return func(yield func(Header) bool) {
+		for i := 0; ; i++ {
+			hs.mu.RLock()
+			if i >= len(hs.headerOrder) {
+				hs.mu.RUnlock()
+				return
+			}
+			hdrs := hs.headers[hs.headerOrder[i]]
+			hs.mu.RUnlock()
+
+			for _, hdr := range hdrs {
+				if !yield(hdr) {
+					return
+				}
+			}
+		}
+	}
+}
+
 func (hs *headers) GetHeaders(name string) []Header {
-	name = strings.ToLower(name)
+	name = TokenLower(name)
 	hs.mu.RLock()
 	defer hs.mu.RUnlock()
 	if hs.headers == nil {
@@ -268,7 +316,7 @@ func (hs *headers) GetHeaders(name string) []Header {
 }
 
 func (hs *headers) RemoveHeader(name string) {
-	name = strings.ToLower(name)
+	name = TokenLower(name)
 	hs.mu.Lock()
 	delete(hs.headers, name)
 	// update order slice
@@ -417,12 +465,17 @@ type message struct {
 	src        string
 	dest       string
 	fields     log.Fields
+	metadata   Metadata
 }
 
 func (msg *message) MessageID() MessageID {
 	return msg.messID
 }
 
+func (msg *message) Metadata() *Metadata {
+	return &msg.metadata
+}
+
 func (msg *message) StartLine() string {
 	return msg.startLine()
 }
@@ -443,8 +496,9 @@ func (msg *message) String() string {
 	// write message start line
 	buffer.WriteString(msg.StartLine() + "\r\n")
 	// Write the headers.
+	opts, _ := msg.metadata.Value(renderOptionsKey{}).(*RenderOptions)
 	msg.mu.RLock()
-	buffer.WriteString(msg.headers.String())
+	buffer.WriteString(msg.headers.render(opts))
 	msg.mu.RUnlock()
 	// message body
 	buffer.WriteString("\r\n" + msg.Body())
@@ -495,7 +549,7 @@ func (msg *message) Transport() string {
 
 func (msg *message) SetTransport(tp string) {
 	msg.mu.Lock()
-	msg.tp = strings.ToUpper(tp)
+	msg.tp = TokenUpper(tp)
 	msg.mu.Unlock()
 }
 
@@ -526,14 +580,14 @@ func (msg *message) SetDestination(dest string) {
 // Copy all headers of one type from one message to another.
 // Appending to any headers that were already there.
 func CopyHeaders(name string, from, to Message) {
-	name = strings.ToLower(name)
+	name = TokenLower(name)
 	for _, h := range from.GetHeaders(name) {
 		to.AppendHeader(h.Clone())
 	}
 }
 
 func PrependCopyHeaders(name string, from, to Message) {
-	name = strings.ToLower(name)
+	name = TokenLower(name)
 	for _, h := range from.GetHeaders(name) {
 		to.PrependHeader(h.Clone())
 	}
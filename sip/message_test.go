@@ -566,3 +566,58 @@ func TestHeaders_String(t *testing.T) {
 		},
 	}, t)
 }
+
+func TestMessage_Iterators(t *testing.T) {
+	port := sip.Port(5060)
+	callID := sip.CallID("a84b4c76e66710")
+	via := sip.ViaHeader{
+		&sip.ViaHop{ProtocolName: "SIP", ProtocolVersion: "2.0", Transport: "UDP", Host: "a.example.com", Port: &port,
+			Params: sip.NewParams().Add("branch", sip.String{Str: "z9hG4bK1"}).Add("rport", nil)},
+		&sip.ViaHop{ProtocolName: "SIP", ProtocolVersion: "2.0", Transport: "UDP", Host: "b.example.com"},
+	}
+	req := sip.NewRequest("", sip.REGISTER, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", []sip.Header{
+		via,
+		&sip.ContactHeader{Address: &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "a.example.com"}},
+		&sip.ContactHeader{Address: &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "b.example.com"}},
+		&callID,
+	}, "", nil)
+
+	var names []string
+	sip.AllHeaders(req)(func(hdr sip.Header) bool {
+		names = append(names, hdr.Name())
+		// modification of the message in the loop body must not deadlock
+		sip.MessageMetadata(req).SetValue("seen", true)
+		_ = req.GetHeaders("Call-ID")
+		return true
+	})
+	if fmt.Sprint(names) != "[Via Contact Contact Call-ID]" {
+		t.Errorf("unexpected headers %v", names)
+	}
+
+	var hosts []string
+	sip.Contacts(req)(func(contact *sip.ContactHeader) bool {
+		hosts = append(hosts, contact.Address.Host())
+		return false
+	})
+	if fmt.Sprint(hosts) != "[a.example.com]" {
+		t.Errorf("expected iteration stopped after the first contact, got %v", hosts)
+	}
+
+	hosts = nil
+	via.Hops()(func(hop *sip.ViaHop) bool {
+		hosts = append(hosts, hop.Host)
+		return true
+	})
+	if fmt.Sprint(hosts) != "[a.example.com b.example.com]" {
+		t.Errorf("unexpected hops %v", hosts)
+	}
+
+	var params []string
+	sip.AllParams(via[0].Params)(func(key, val string) bool {
+		params = append(params, key+"="+val)
+		return true
+	})
+	if fmt.Sprint(params) != "[branch=z9hG4bK1 rport=]" {
+		t.Errorf("unexpected params %v", params)
+	}
+}
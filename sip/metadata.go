@@ -0,0 +1,86 @@
+package sip
+
+import "sync"
+
+// Metadata is a concurrency-safe container of application values attached to a message,
+// e.g. routed tenant, authentication result or tracing info.
+// Like context.Context keys, keys should be of unexported types to avoid collisions between packages.
+type Metadata struct {
+	mu     sync.RWMutex
+	values map[interface{}]interface{}
+}
+
+// MetadataCarrier is implemented by messages that carry Metadata, messages of this package do.
+type MetadataCarrier interface {
+	// Metadata returns container of application values attached to the message.
+	// Metadata is copied on message clone and to the response created from the request.
+	Metadata() *Metadata
+}
+
+// MessageMetadata returns metadata of the message, nil if the message doesn't implement MetadataCarrier.
+// Nil Metadata is empty and drops stored values.
+func MessageMetadata(msg Message) *Metadata {
+	if carrier, ok := msg.(MetadataCarrier); ok {
+		return carrier.Metadata()
+	}
+	return nil
+}
+
+// SetValue stores value by the key, nil value removes the key.
+func (md *Metadata) SetValue(key, value interface{}) {
+	if md == nil {
+		return
+	}
+
+	md.mu.Lock()
+	defer md.mu.Unlock()
+
+	if value == nil {
+		delete(md.values, key)
+		return
+	}
+	if md.values == nil {
+		md.values = make(map[interface{}]interface{})
+	}
+	md.values[key] = value
+}
+
+// Value returns value stored by the key or nil.
+func (md *Metadata) Value(key interface{}) interface{} {
+	if md == nil {
+		return nil
+	}
+
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+
+	return md.values[key]
+}
+
+// Range calls f for each stored value until f returns false.
+func (md *Metadata) Range(f func(key, value interface{}) bool) {
+	if md == nil {
+		return
+	}
+
+	md.mu.RLock()
+	values := make(map[interface{}]interface{}, len(md.values))
+	for key, value := range md.values {
+		values[key] = value
+	}
+	md.mu.RUnlock()
+
+	for key, value := range values {
+		if !f(key, value) {
+			return
+		}
+	}
+}
+
+// copyTo copies all values to the other container.
+func (md *Metadata) copyTo(other *Metadata) {
+	md.Range(func(key, value interface{}) bool {
+		other.SetValue(key, value)
+		return true
+	})
+}
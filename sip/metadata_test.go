@@ -0,0 +1,57 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+type metadataKey string
+
+func TestMetadata(t *testing.T) {
+	req := sip.NewRequest("", sip.INVITE, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+	tenantKey := metadataKey("tenant")
+
+	if v := sip.MessageMetadata(req).Value(tenantKey); v != nil {
+		t.Errorf("expected nil value, got %v", v)
+	}
+
+	sip.MessageMetadata(req).SetValue(tenantKey, "acme")
+	if v := sip.MessageMetadata(req).Value(tenantKey); v != "acme" {
+		t.Errorf("expected 'acme', got %v", v)
+	}
+	if v := sip.MessageMetadata(req).Value("tenant"); v != nil {
+		t.Errorf("expected nil value for untyped key, got %v", v)
+	}
+
+	clone := req.Clone()
+	if v := sip.MessageMetadata(clone).Value(tenantKey); v != "acme" {
+		t.Errorf("expected 'acme' in cloned message, got %v", v)
+	}
+	sip.MessageMetadata(clone).SetValue(tenantKey, "other")
+	if v := sip.MessageMetadata(req).Value(tenantKey); v != "acme" {
+		t.Errorf("expected original message metadata untouched, got %v", v)
+	}
+
+	sip.MessageMetadata(req).SetValue(tenantKey, nil)
+	count := 0
+	sip.MessageMetadata(req).Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count != 0 {
+		t.Errorf("expected empty metadata, got %d values", count)
+	}
+}
+
+func TestNilMetadata(t *testing.T) {
+	var md *sip.Metadata
+	md.SetValue(metadataKey("tenant"), "acme")
+	if v := md.Value(metadataKey("tenant")); v != nil {
+		t.Errorf("expected nil value, got %v", v)
+	}
+	md.Range(func(key, value interface{}) bool {
+		t.Errorf("unexpected value %v", value)
+		return true
+	})
+}
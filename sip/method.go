@@ -0,0 +1,97 @@
+package sip
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry of known request methods. Requests of unknown methods are still parsed,
+// since UAS must answer them with '405 Method Not Allowed' or '501 Not Implemented' - RFC 3261 8.2.1.
+var methods = struct {
+	mu  sync.RWMutex
+	set map[RequestMethod]bool
+}{
+	set: map[RequestMethod]bool{
+		INVITE:    true,
+		ACK:       true,
+		CANCEL:    true,
+		BYE:       true,
+		REGISTER:  true,
+		OPTIONS:   true,
+		SUBSCRIBE: true,
+		NOTIFY:    true,
+		REFER:     true,
+		INFO:      true,
+		MESSAGE:   true,
+		PRACK:     true,
+		UPDATE:    true,
+		PUBLISH:   true,
+	},
+}
+
+// RegisterMethod registers extension method, e.g. proprietary one.
+// Extension methods are handled by non-INVITE transactions.
+func RegisterMethod(method RequestMethod) error {
+	if !IsValidMethod(method) {
+		return fmt.Errorf("invalid method name '%s'", method)
+	}
+
+	methods.mu.Lock()
+	methods.set[method] = true
+	methods.mu.Unlock()
+
+	return nil
+}
+
+// IsKnownMethod checks that the method is a standard or registered extension method.
+func IsKnownMethod(method RequestMethod) bool {
+	methods.mu.RLock()
+	defer methods.mu.RUnlock()
+
+	return methods.set[method]
+}
+
+// KnownMethods returns standard and registered extension methods sorted by name.
+func KnownMethods() []RequestMethod {
+	methods.mu.RLock()
+	list := make([]RequestMethod, 0, len(methods.set))
+	for method := range methods.set {
+		list = append(list, method)
+	}
+	methods.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i] < list[j]
+	})
+	return list
+}
+
+// IsValidMethod checks that the method name is a valid token - RFC 3261 25.1.
+func IsValidMethod(method RequestMethod) bool {
+	return isToken(string(method))
+}
+
+func isToken(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if !isTokenChar(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	switch c {
+	case '-', '.', '!', '%', '*', '_', '+', '`', '\'', '~':
+		return true
+	}
+	return false
+}
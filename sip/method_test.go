@@ -0,0 +1,34 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestRegisterMethod(t *testing.T) {
+	method := sip.RequestMethod("X-PING")
+	if sip.IsKnownMethod(method) {
+		t.Fatalf("method %s is known before registration", method)
+	}
+	if err := sip.RegisterMethod(method); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !sip.IsKnownMethod(method) {
+		t.Errorf("method %s is unknown after registration", method)
+	}
+
+	found := false
+	for _, m := range sip.KnownMethods() {
+		if m == method {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("method %s not found in known methods", method)
+	}
+
+	if err := sip.RegisterMethod("BAD METHOD"); err == nil {
+		t.Error("expected error on invalid method name")
+	}
+}
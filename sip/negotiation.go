@@ -0,0 +1,138 @@
+package sip
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AcceptedTypes returns media types listed in the 'Accept' headers of the message
+// ordered by the q-value preference. Result should be stored with subscription created by SUBSCRIBE request,
+// so notifications are built in the format accepted by the subscriber.
+func AcceptedTypes(msg Message) []string {
+	type mediaRange struct {
+		typ string
+		q   float64
+	}
+
+	ranges := make([]mediaRange, 0)
+	for _, hdr := range msg.GetHeaders("Accept") {
+		for _, part := range strings.Split(hdr.Value(), ",") {
+			params := strings.Split(part, ";")
+			typ := TokenLower(strings.TrimSpace(params[0]))
+			if typ == "" {
+				continue
+			}
+
+			q := 1.0
+			for _, param := range params[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) == 2 && TokenEqual(kv[0], "q") {
+					if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+						q = v
+					}
+				}
+			}
+			if q > 0 {
+				ranges = append(ranges, mediaRange{typ, q})
+			}
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	types := make([]string, len(ranges))
+	for i, r := range ranges {
+		types[i] = r.typ
+	}
+	return types
+}
+
+// BodyConverter converts message body from one media type to another.
+type BodyConverter func(body string) (string, error)
+
+// BodyNegotiator chooses body format accepted by the remote side,
+// converting body with registered converters if needed.
+type BodyNegotiator struct {
+	mu         sync.RWMutex
+	converters map[string]map[string]BodyConverter
+}
+
+func NewBodyNegotiator() *BodyNegotiator {
+	return &BodyNegotiator{
+		converters: make(map[string]map[string]BodyConverter),
+	}
+}
+
+// RegisterConverter registers converter of bodies from one media type to another.
+func (n *BodyNegotiator) RegisterConverter(from, to string, converter BodyConverter) {
+	from, to = TokenLower(from), TokenLower(to)
+
+	n.mu.Lock()
+	if n.converters[from] == nil {
+		n.converters[from] = make(map[string]BodyConverter)
+	}
+	n.converters[from][to] = converter
+	n.mu.Unlock()
+}
+
+// Negotiate returns body in the first accepted media type that can be produced from the body of the content type.
+// Empty accepted list means that any type is accepted, wildcards 'type/*' and '*/*' are supported.
+func (n *BodyNegotiator) Negotiate(accepted []string, contentType, body string) (string, string, error) {
+	contentType = TokenLower(contentType)
+	if len(accepted) == 0 {
+		return contentType, body, nil
+	}
+
+	n.mu.RLock()
+	converters := n.converters[contentType]
+	n.mu.RUnlock()
+
+	for _, accept := range accepted {
+		if matchMediaType(accept, contentType) {
+			return contentType, body, nil
+		}
+		for to, converter := range converters {
+			if !matchMediaType(accept, to) {
+				continue
+			}
+
+			converted, err := converter(body)
+			if err != nil {
+				return "", "", fmt.Errorf("convert body from '%s' to '%s': %w", contentType, to, err)
+			}
+			return to, converted, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("none of accepted types %v can be produced from '%s'", accepted, contentType)
+}
+
+// NegotiateBody sets the message body in the format accepted by the remote side.
+func (n *BodyNegotiator) NegotiateBody(msg Message, accepted []string, contentType, body string) error {
+	typ, converted, err := n.Negotiate(accepted, contentType, body)
+	if err != nil {
+		return err
+	}
+
+	ct := ContentType(typ)
+	msg.RemoveHeader("Content-Type")
+	msg.AppendHeader(&ct)
+	msg.SetBody(converted, true)
+	return nil
+}
+
+func matchMediaType(pattern, typ string) bool {
+	pattern = TokenLower(pattern)
+	if pattern == "*/*" || pattern == typ {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(typ, pattern[:len(pattern)-1])
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestAcceptedTypes(t *testing.T) {
+	accept := sip.Accept("application/xpidf+xml;q=0.5, application/pidf+xml")
+	req := sip.NewRequest("", sip.SUBSCRIBE, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", []sip.Header{&accept}, "", nil)
+
+	types := sip.AcceptedTypes(req)
+	if len(types) != 2 || types[0] != "application/pidf+xml" || types[1] != "application/xpidf+xml" {
+		t.Errorf("unexpected accepted types: %v", types)
+	}
+}
+
+func TestBodyNegotiator(t *testing.T) {
+	n := sip.NewBodyNegotiator()
+	n.RegisterConverter("application/pidf+xml", "application/xpidf+xml", func(body string) (string, error) {
+		return "xpidf:" + body, nil
+	})
+
+	typ, body, err := n.Negotiate([]string{"application/pidf+xml"}, "application/pidf+xml", "open")
+	if err != nil || typ != "application/pidf+xml" || body != "open" {
+		t.Errorf("unexpected negotiation result: %s, %s, %v", typ, body, err)
+	}
+
+	typ, body, err = n.Negotiate([]string{"application/xpidf+xml"}, "application/pidf+xml", "open")
+	if err != nil || typ != "application/xpidf+xml" || body != "xpidf:open" {
+		t.Errorf("unexpected negotiation result: %s, %s, %v", typ, body, err)
+	}
+
+	if _, _, err = n.Negotiate([]string{"text/plain"}, "application/pidf+xml", "open"); err == nil {
+		t.Error("expected error for not acceptable body")
+	}
+
+	typ, _, err = n.Negotiate([]string{"application/*"}, "application/pidf+xml", "open")
+	if err != nil || typ != "application/pidf+xml" {
+		t.Errorf("unexpected negotiation result for wildcard: %s, %v", typ, err)
+	}
+
+	req := sip.NewRequest("", sip.NOTIFY, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+	if err := n.NegotiateBody(req, []string{"application/xpidf+xml"}, "application/pidf+xml", "open"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ct, ok := req.ContentType(); !ok || ct.Value() != "application/xpidf+xml" || req.Body() != "xpidf:open" {
+		t.Errorf("unexpected NOTIFY body: %v %s", ct, req.Body())
+	}
+}
@@ -0,0 +1,179 @@
+package sip
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NumberPlan describes the numbering plan of the source country used to bring numbers to E.164 form.
+type NumberPlan struct {
+	// CountryCode is a country calling code without '+', e.g. "1" or "44".
+	CountryCode string
+	// NationalPrefix is a trunk prefix of national numbers, e.g. "1" or "0".
+	NationalPrefix string
+	// InternationalPrefix is an exit code of international numbers, e.g. "011" or "00".
+	InternationalPrefix string
+}
+
+// E164 converts dialed number to E.164 form with leading '+'.
+// Numbers that already start with '+' are only cleaned from visual separators.
+func (plan NumberPlan) E164(number string) string {
+	number = NormalizeNumber(number)
+	switch {
+	case number == "" || strings.HasPrefix(number, "+"):
+		return number
+	case plan.InternationalPrefix != "" && strings.HasPrefix(number, plan.InternationalPrefix):
+		return "+" + number[len(plan.InternationalPrefix):]
+	case plan.NationalPrefix != "" && strings.HasPrefix(number, plan.NationalPrefix):
+		return "+" + plan.CountryCode + number[len(plan.NationalPrefix):]
+	default:
+		return "+" + plan.CountryCode + number
+	}
+}
+
+// NormalizeNumber removes visual separators from the number - RFC 3966 5.1.1.
+func NormalizeNumber(number string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		default:
+			return r
+		}
+	}, number)
+}
+
+// NumberRule is a rule of the number translation table.
+// The number matched by Match is rewritten in order: Strip, Prepend, Pattern and Replace, E164.
+type NumberRule struct {
+	// Match is a PBX-style pattern of the whole number: 'X' matches any digit, 'Z' - 1-9, 'N' - 2-9,
+	// trailing '.' matches one or more any characters, trailing '!' - zero or more,
+	// other characters match themselves. Empty pattern matches any number.
+	Match string
+	// Strip is a number of leading characters to remove.
+	Strip int
+	// Prepend is a prefix to add after stripping.
+	Prepend string
+	// Pattern rewrites the number with Replace template (see regexp.Regexp.ReplaceAllString) if not nil.
+	Pattern *regexp.Regexp
+	Replace string
+	// E164 converts the result to E.164 form according to the plan if not nil.
+	E164 *NumberPlan
+}
+
+func (rule NumberRule) apply(number string) string {
+	if rule.Strip >= len(number) {
+		number = ""
+	} else if rule.Strip > 0 {
+		number = number[rule.Strip:]
+	}
+	number = rule.Prepend + number
+	if rule.Pattern != nil {
+		number = rule.Pattern.ReplaceAllString(number, rule.Replace)
+	}
+	if rule.E164 != nil {
+		number = rule.E164.E164(number)
+	}
+	return number
+}
+
+// TranslationTable rewrites numbers by the first matched rule, like classic PBX number plans.
+// Table is immutable and safe for concurrent use.
+type TranslationTable struct {
+	rules []NumberRule
+}
+
+// NewTranslationTable validates rules and creates translation table.
+func NewTranslationTable(rules ...NumberRule) (*TranslationTable, error) {
+	for i, rule := range rules {
+		if err := validateNumberPattern(rule.Match); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if rule.Strip < 0 {
+			return nil, fmt.Errorf("rule %d: negative strip %d", i, rule.Strip)
+		}
+	}
+
+	table := &TranslationTable{
+		rules: make([]NumberRule, len(rules)),
+	}
+	copy(table.rules, rules)
+	return table, nil
+}
+
+// Translate rewrites the number by the first matched rule.
+// Visual separators are removed before matching. Returns false if no rule matched.
+func (table *TranslationTable) Translate(number string) (string, bool) {
+	number = NormalizeNumber(number)
+	for _, rule := range table.rules {
+		if matchNumber(rule.Match, number) {
+			return rule.apply(number), true
+		}
+	}
+	return number, false
+}
+
+// TranslateUri rewrites the user part of the URI by the first matched rule.
+// Returns false if the URI has no user part or no rule matched.
+func (table *TranslationTable) TranslateUri(uri Uri) bool {
+	if uri == nil || uri.User() == nil || uri.User().String() == "" {
+		return false
+	}
+
+	number, ok := table.Translate(uri.User().String())
+	if !ok {
+		return false
+	}
+	uri.SetUser(String{Str: number})
+	return true
+}
+
+func validateNumberPattern(pattern string) error {
+	for i, c := range pattern {
+		if (c == '.' || c == '!') && i != len(pattern)-1 {
+			return fmt.Errorf("'%c' must be the last character of number pattern '%s'", c, pattern)
+		}
+	}
+	return nil
+}
+
+func matchNumber(pattern, number string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '.':
+			return len(number) > i
+		case '!':
+			return true
+		}
+		if i >= len(number) {
+			return false
+		}
+
+		c := number[i]
+		switch pattern[i] {
+		case 'X':
+			if c < '0' || c > '9' {
+				return false
+			}
+		case 'Z':
+			if c < '1' || c > '9' {
+				return false
+			}
+		case 'N':
+			if c < '2' || c > '9' {
+				return false
+			}
+		default:
+			if c != pattern[i] {
+				return false
+			}
+		}
+	}
+
+	return len(number) == len(pattern)
+}
@@ -0,0 +1,70 @@
+package sip_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestNumberPlanE164(t *testing.T) {
+	plan := sip.NumberPlan{CountryCode: "1", NationalPrefix: "1", InternationalPrefix: "011"}
+
+	cases := map[string]string{
+		"+1 (555) 123-4567": "+15551234567",
+		"01144201234567":    "+44201234567",
+		"15551234567":       "+15551234567",
+		"5551234567":        "+15551234567",
+		"":                  "",
+	}
+	for number, expected := range cases {
+		if e164 := plan.E164(number); e164 != expected {
+			t.Errorf("number %s: expected %s, got %s", number, expected, e164)
+		}
+	}
+}
+
+func TestTranslationTable(t *testing.T) {
+	plan := &sip.NumberPlan{CountryCode: "44", NationalPrefix: "0", InternationalPrefix: "00"}
+	table, err := sip.NewTranslationTable(
+		// internal extensions
+		sip.NumberRule{Match: "2XXX"},
+		// outside line '9' + national or international number
+		sip.NumberRule{Match: "90.", Strip: 1, E164: plan},
+		// short code to the operator
+		sip.NumberRule{Match: "100", Prepend: "+44", Pattern: regexp.MustCompile(`^\+44100$`), Replace: "+442070000000"},
+		sip.NumberRule{Match: "N!", Prepend: "+4420"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		number   string
+		expected string
+		ok       bool
+	}{
+		{"2001", "2001", true},
+		{"9020 7946 0000", "+442079460000", true},
+		{"900 1 555 123 4567", "+15551234567", true},
+		{"100", "+442070000000", true},
+		{"79460000", "+442079460000", true},
+		{"2", "+44202", true},
+		{"1234", "1234", false},
+	}
+	for _, c := range cases {
+		number, ok := table.Translate(c.number)
+		if number != c.expected || ok != c.ok {
+			t.Errorf("number %s: expected %s %v, got %s %v", c.number, c.expected, c.ok, number, ok)
+		}
+	}
+
+	uri := &sip.SipUri{FUser: sip.String{Str: "9020-7946-0000"}, FHost: "pbx.example.com"}
+	if !table.TranslateUri(uri) || uri.String() != "sip:+442079460000@pbx.example.com" {
+		t.Errorf("unexpected URI: %s", uri)
+	}
+
+	if _, err := sip.NewTranslationTable(sip.NumberRule{Match: "9.X"}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
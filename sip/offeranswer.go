@@ -0,0 +1,342 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type OfferAnswerState int
+
+const (
+	// OfferAnswerIdle - no session description was exchanged yet.
+	OfferAnswerIdle OfferAnswerState = iota
+	// OfferAnswerWaitingOffer - INVITE without body was sent or received,
+	// the offer is expected in the 2xx or reliable provisional response (delayed offer).
+	OfferAnswerWaitingOffer
+	// OfferAnswerLocalOffer - the offer was sent, waiting for the answer.
+	OfferAnswerLocalOffer
+	// OfferAnswerRemoteOffer - the offer was received, the answer must be sent.
+	OfferAnswerRemoteOffer
+	// OfferAnswerComplete - the last offer was answered, a new offer may be made.
+	OfferAnswerComplete
+)
+
+func (state OfferAnswerState) String() string {
+	switch state {
+	case OfferAnswerIdle:
+		return "Idle"
+	case OfferAnswerWaitingOffer:
+		return "WaitingOffer"
+	case OfferAnswerLocalOffer:
+		return "LocalOffer"
+	case OfferAnswerRemoteOffer:
+		return "RemoteOffer"
+	case OfferAnswerComplete:
+		return "Complete"
+	default:
+		return fmt.Sprintf("OfferAnswerState(%d)", int(state))
+	}
+}
+
+// OfferAnswerError is returned when the message breaks the offer/answer sequence.
+// StatusCode is the response code the UAS should reject the request with.
+type OfferAnswerError struct {
+	StatusCode StatusCode
+	Reason     string
+}
+
+func (err *OfferAnswerError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("sip.OfferAnswerError: %s", err.Reason)
+}
+
+// AnswerFunc supplies the answer on the offer received in the response, e.g. for ACK in the delayed offer flow.
+type AnswerFunc func(offer string) (answer string, err error)
+
+// OfferAnswer tracks the offer/answer exchange of session descriptions within INVITE dialog usage - RFC 3264, RFC 6337.
+// Offers are carried by INVITE, UPDATE and PRACK requests, by 2xx or reliable provisional responses
+// on INVITE without body, answers by responses on the offer, by PRACK or ACK.
+// Bodies without Content-Type are considered as session descriptions.
+type OfferAnswer struct {
+	mu    sync.Mutex
+	state OfferAnswerState
+	// state restored when the request with the offer fails
+	prev OfferAnswerState
+	// transaction of the pending offer
+	seq    uint32
+	method RequestMethod
+	// the pending offer or INVITE without offer was sent
+	local bool
+	// the pending offer was sent in the response
+	inResponse bool
+	offer      string
+	answer     string
+	onAnswer   AnswerFunc
+	// session descriptions of the last complete exchange
+	localSession  string
+	remoteSession string
+}
+
+func NewOfferAnswer() *OfferAnswer {
+	return &OfferAnswer{}
+}
+
+func (oa *OfferAnswer) State() OfferAnswerState {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+	return oa.state
+}
+
+// Offer returns the last offer.
+func (oa *OfferAnswer) Offer() string {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+	return oa.offer
+}
+
+// Answer returns the last answer.
+func (oa *OfferAnswer) Answer() string {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+	return oa.answer
+}
+
+// LocalSession returns the local session description of the last complete exchange.
+func (oa *OfferAnswer) LocalSession() string {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+	return oa.localSession
+}
+
+// RemoteSession returns the remote session description of the last complete exchange.
+func (oa *OfferAnswer) RemoteSession() string {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+	return oa.remoteSession
+}
+
+// OnAnswerRequired registers function that supplies the answer when ACK or PRACK
+// answering the offer from the response is built without body.
+func (oa *OfferAnswer) OnAnswerRequired(fn AnswerFunc) {
+	oa.mu.Lock()
+	oa.onAnswer = fn
+	oa.mu.Unlock()
+}
+
+// Sent updates the state with the sent message.
+func (oa *OfferAnswer) Sent(msg Message) error {
+	return oa.handle(msg, true)
+}
+
+// Received updates the state with the received message.
+func (oa *OfferAnswer) Received(msg Message) error {
+	return oa.handle(msg, false)
+}
+
+// Returns the answer that must be sent in ACK or PRACK request of the transaction, calls AnswerFunc if needed.
+// Empty answer means that the request doesn't answer the offer.
+func (oa *OfferAnswer) requiredAnswer(method RequestMethod, seq uint32) (string, error) {
+	oa.mu.Lock()
+	if !oa.answersOffer(method, seq, true) {
+		oa.mu.Unlock()
+		return "", nil
+	}
+	offer, fn := oa.offer, oa.onAnswer
+	oa.mu.Unlock()
+
+	if fn == nil {
+		return "", &OfferAnswerError{Reason: fmt.Sprintf("%s must carry the answer on the offer in the response", method)}
+	}
+	answer, err := fn(offer)
+	if err != nil {
+		return "", fmt.Errorf("supply answer for %s: %w", method, err)
+	}
+	if answer == "" {
+		return "", &OfferAnswerError{Reason: fmt.Sprintf("empty answer for %s", method)}
+	}
+	return answer, nil
+}
+
+// Checks that ACK or PRACK request answers the pending offer from the response. Should be called under lock.
+func (oa *OfferAnswer) answersOffer(method RequestMethod, seq uint32, local bool) bool {
+	if !oa.inResponse || oa.local == local {
+		return false
+	}
+	if oa.state != OfferAnswerLocalOffer && oa.state != OfferAnswerRemoteOffer {
+		return false
+	}
+	switch method {
+	case ACK:
+		return oa.method == INVITE && oa.seq == seq
+	case PRACK:
+		return true
+	default:
+		return false
+	}
+}
+
+func (oa *OfferAnswer) handle(msg Message, local bool) error {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+
+	switch msg := msg.(type) {
+	case Request:
+		return oa.handleRequest(msg, sessionBody(msg), local)
+	case Response:
+		return oa.handleResponse(msg, sessionBody(msg), local)
+	default:
+		return nil
+	}
+}
+
+func (oa *OfferAnswer) handleRequest(req Request, body string, local bool) error {
+	cseq, ok := req.CSeq()
+	if !ok {
+		return nil
+	}
+
+	switch req.Method() {
+	case ACK:
+		if oa.answersOffer(ACK, cseq.SeqNo, local) {
+			if body == "" {
+				return &OfferAnswerError{Reason: "ACK must carry the answer on the offer in 2xx response"}
+			}
+			oa.complete(body)
+			return nil
+		}
+		if body != "" && !(oa.state == OfferAnswerComplete && body == oa.answer) {
+			return &OfferAnswerError{Reason: "unexpected session description in ACK"}
+		}
+	case PRACK:
+		if body == "" {
+			return nil
+		}
+		if oa.answersOffer(PRACK, cseq.SeqNo, local) {
+			oa.complete(body)
+			return nil
+		}
+		return oa.newOffer(req, body, local)
+	case INVITE, UPDATE:
+		if body != "" {
+			return oa.newOffer(req, body, local)
+		}
+		if req.IsInvite() {
+			if oa.pending() {
+				if oa.seq == cseq.SeqNo && oa.method == INVITE {
+					return nil
+				}
+				return &OfferAnswerError{StatusCode: 491, Reason: "INVITE while offer/answer exchange is in progress"}
+			}
+			oa.prev = oa.state
+			oa.state = OfferAnswerWaitingOffer
+			oa.seq, oa.method, oa.local, oa.inResponse = cseq.SeqNo, INVITE, local, false
+		}
+	}
+
+	return nil
+}
+
+// Should be called under lock.
+func (oa *OfferAnswer) newOffer(req Request, body string, local bool) error {
+	cseq, _ := req.CSeq()
+	if oa.pending() {
+		// retransmission
+		if oa.seq == cseq.SeqNo && oa.method == req.Method() && oa.offer == body {
+			return nil
+		}
+		return &OfferAnswerError{StatusCode: 491, Reason: fmt.Sprintf("offer in %s while another offer is pending", req.Method())}
+	}
+
+	oa.prev = oa.state
+	if local {
+		oa.state = OfferAnswerLocalOffer
+	} else {
+		oa.state = OfferAnswerRemoteOffer
+	}
+	oa.seq, oa.method, oa.local, oa.inResponse = cseq.SeqNo, req.Method(), local, false
+	oa.offer = body
+	return nil
+}
+
+func (oa *OfferAnswer) handleResponse(res Response, body string, local bool) error {
+	cseq, ok := res.CSeq()
+	if !ok || res.StatusCode() == 100 {
+		return nil
+	}
+	// response is on the request sent by the other side
+	if cseq.SeqNo != oa.seq || cseq.MethodName != oa.method || !oa.pending() {
+		if body != "" && oa.state == OfferAnswerComplete && cseq.SeqNo == oa.seq &&
+			cseq.MethodName == oa.method && body != oa.answer && body != oa.offer {
+			return &OfferAnswerError{Reason: fmt.Sprintf("session description in %s differs from the answer", res.Short())}
+		}
+		return nil
+	}
+
+	if res.StatusCode() >= 300 {
+		// failed request cancels the offer
+		oa.state = oa.prev
+		oa.inResponse = false
+		return nil
+	}
+	if !res.IsSuccess() && !IsReliableProvisional(res) || body == "" {
+		return nil
+	}
+
+	switch {
+	case oa.state == OfferAnswerWaitingOffer:
+		if oa.local == local {
+			return nil
+		}
+		oa.local, oa.inResponse = local, true
+		oa.offer = body
+		if local {
+			oa.state = OfferAnswerLocalOffer
+		} else {
+			oa.state = OfferAnswerRemoteOffer
+		}
+	case oa.inResponse:
+		if body != oa.offer {
+			return &OfferAnswerError{Reason: fmt.Sprintf("new offer in %s while another offer is pending", res.Short())}
+		}
+	case oa.local != local:
+		oa.complete(body)
+	}
+
+	return nil
+}
+
+// Should be called under lock.
+func (oa *OfferAnswer) pending() bool {
+	return oa.state == OfferAnswerWaitingOffer || oa.state == OfferAnswerLocalOffer || oa.state == OfferAnswerRemoteOffer
+}
+
+// Should be called under lock.
+func (oa *OfferAnswer) complete(answer string) {
+	oa.state = OfferAnswerComplete
+	oa.answer = answer
+	oa.inResponse = false
+	if oa.local {
+		oa.localSession, oa.remoteSession = oa.offer, answer
+	} else {
+		oa.localSession, oa.remoteSession = answer, oa.offer
+	}
+}
+
+// Returns session description carried by the message body.
+func sessionBody(msg Message) string {
+	body := msg.Body()
+	if body == "" {
+		return ""
+	}
+	if ct, ok := msg.ContentType(); ok {
+		mediaType := strings.TrimSpace(strings.SplitN(ct.Value(), ";", 2)[0])
+		if !TokenEqual(mediaType, "application/sdp") {
+			return ""
+		}
+	}
+	return body
+}
@@ -0,0 +1,152 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+const (
+	testOffer  = "v=0\r\no=alice 2890844526 2890844526 IN IP4 pc33.atlanta.com\r\ns=-\r\nc=IN IP4 pc33.atlanta.com\r\nt=0 0\r\nm=audio 49172 RTP/AVP 0\r\n"
+	testAnswer = "v=0\r\no=bob 2808844564 2808844564 IN IP4 192.0.2.4\r\ns=-\r\nc=IN IP4 192.0.2.4\r\nt=0 0\r\nm=audio 3456 RTP/AVP 0\r\n"
+)
+
+func withSDP(msg sip.Message, body string) sip.Message {
+	ct := sip.ContentType("application/sdp")
+	msg.AppendHeader(&ct)
+	msg.SetBody(body, true)
+	return msg
+}
+
+func TestDialogDelayedOfferUAC(t *testing.T) {
+	invite := dialogInvite(t)
+	ok := withSDP(dialogResponse(t, "200 OK"), testOffer).(sip.Response)
+
+	dlg, err := sip.NewDialogUAC(invite, ok)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if state := dlg.OfferAnswer().State(); state != sip.OfferAnswerRemoteOffer {
+		t.Fatalf("expected remote offer, got %s", state)
+	}
+
+	if _, err := dlg.NewRequest(sip.ACK, ""); err == nil {
+		t.Fatal("ACK without answer must fail")
+	}
+
+	var offer string
+	dlg.OfferAnswer().OnAnswerRequired(func(o string) (string, error) {
+		offer = o
+		return testAnswer, nil
+	})
+	ack, err := dlg.NewRequest(sip.ACK, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if offer != testOffer {
+		t.Errorf("unexpected offer passed to the hook %q", offer)
+	}
+	if ack.Body() != testAnswer {
+		t.Errorf("ACK must carry the answer, got %q", ack.Body())
+	}
+	if ct, ok := ack.ContentType(); !ok || ct.Value() != "application/sdp" {
+		t.Errorf("unexpected Content-Type %v", ct)
+	}
+	if cseq, _ := ack.CSeq(); cseq.SeqNo != 314159 {
+		t.Errorf("ACK must take INVITE CSeq, got %d", cseq.SeqNo)
+	}
+	if state := dlg.OfferAnswer().State(); state != sip.OfferAnswerComplete {
+		t.Errorf("expected complete exchange, got %s", state)
+	}
+
+	// retransmitted 2xx with the same offer is ignored
+	if err := dlg.ReceiveResponse(ok); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestDialogDelayedOfferUAS(t *testing.T) {
+	invite := dialogInvite(t)
+	ok := withSDP(dialogResponse(t, "200 OK"), testOffer).(sip.Response)
+
+	dlg, err := sip.NewDialogUAS(invite, ok)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if state := dlg.OfferAnswer().State(); state != sip.OfferAnswerLocalOffer {
+		t.Fatalf("expected local offer, got %s", state)
+	}
+
+	ack := func(body string) sip.Request {
+		req := parseDialogMessage(t,
+			"ACK sip:bob@192.0.2.4 SIP/2.0",
+			"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bKnashds8",
+			"From: <sip:alice@atlanta.com>;tag=1928301774",
+			"To: <sip:bob@biloxi.com>;tag=a6c85cf",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 314159 ACK",
+		).(sip.Request)
+		if body != "" {
+			withSDP(req, body)
+		}
+		return req
+	}
+
+	if err := dlg.ReceiveRequest(ack("")); err == nil {
+		t.Fatal("ACK without answer must fail")
+	}
+	if err := dlg.ReceiveRequest(ack(testAnswer)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if dlg.OfferAnswer().State() != sip.OfferAnswerComplete || dlg.OfferAnswer().Answer() != testAnswer {
+		t.Errorf("unexpected exchange state %s", dlg.OfferAnswer().State())
+	}
+}
+
+func TestOfferAnswerSequence(t *testing.T) {
+	dlg, err := sip.NewDialogUAC(withSDP(dialogInvite(t), testOffer).(sip.Request),
+		withSDP(dialogResponse(t, "200 OK"), testAnswer).(sip.Response))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if state := dlg.OfferAnswer().State(); state != sip.OfferAnswerComplete {
+		t.Fatalf("expected complete exchange, got %s", state)
+	}
+	if _, err := dlg.NewRequest(sip.ACK, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	reinvite, err := dlg.NewRequest(sip.INVITE, testOffer)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if state := dlg.OfferAnswer().State(); state != sip.OfferAnswerLocalOffer {
+		t.Fatalf("expected local offer, got %s", state)
+	}
+	// the new offer can't be made until the pending one is answered
+	if _, err := dlg.NewRequest(sip.UPDATE, testOffer); err == nil {
+		t.Error("second offer must fail")
+	}
+
+	// glare: the remote offer while the local one is pending is rejected with 491
+	update := withSDP(parseDialogMessage(t,
+		"UPDATE sip:alice@pc33.atlanta.com SIP/2.0",
+		"Via: SIP/2.0/UDP 192.0.2.4;branch=z9hG4bKnashds9",
+		"From: <sip:bob@biloxi.com>;tag=a6c85cf",
+		"To: <sip:alice@atlanta.com>;tag=1928301774",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 1 UPDATE",
+	), testAnswer).(sip.Request)
+	err = dlg.ReceiveRequest(update)
+	if dlgErr, ok := err.(*sip.DialogError); !ok || dlgErr.StatusCode != 491 {
+		t.Errorf("expected 491 dialog error, got %v", err)
+	}
+
+	// rejected offer rolls back to the previous state
+	if err := dlg.ReceiveResponse(sip.NewResponseFromRequest("", reinvite, 488, "Not Acceptable Here", "")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if state := dlg.OfferAnswer().State(); state != sip.OfferAnswerComplete {
+		t.Errorf("expected complete exchange, got %s", state)
+	}
+}
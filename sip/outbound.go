@@ -0,0 +1,81 @@
+package sip
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// NewInstanceID generates the instance ID of the UA: urn:uuid URN that must be persisted
+// across reboots of the UA - RFC 5626 4.1.
+func NewInstanceID() string {
+	return "urn:uuid:" + uuid.Must(uuid.NewV4()).String()
+}
+
+// SetOutboundContact adds '+sip.instance' and 'reg-id' parameters to the Contact of REGISTER
+// that creates the flow - RFC 5626 4.2. Zero regID adds only the instance ID.
+func SetOutboundContact(contact *ContactHeader, instanceID string, regID uint32) {
+	if contact.Params == nil {
+		contact.Params = NewParams()
+	}
+	contact.Params.Add("+sip.instance", String{Str: `"<` + strings.Trim(instanceID, "<>") + `>"`})
+	if regID > 0 {
+		contact.Params.Add("reg-id", String{Str: strconv.FormatUint(uint64(regID), 10)})
+	}
+}
+
+// OutboundContact returns '+sip.instance' and 'reg-id' parameters of the Contact,
+// ok is false if the Contact doesn't register the outbound flow.
+func OutboundContact(contact *ContactHeader) (instanceID string, regID uint32, ok bool) {
+	if contact.Params == nil {
+		return "", 0, false
+	}
+	if val, ok := contact.Params.Get("+sip.instance"); ok && val != nil {
+		instanceID = strings.Trim(val.String(), `"<>`)
+	}
+	if val, ok := contact.Params.Get("reg-id"); ok && val != nil {
+		if id, err := strconv.ParseUint(val.String(), 10, 32); err == nil {
+			regID = uint32(id)
+		}
+	}
+	return instanceID, regID, instanceID != "" && regID > 0
+}
+
+// SupportsOutbound checks that the message lists 'outbound' option tag in the 'Supported' or 'Require' header.
+func SupportsOutbound(msg Message) bool {
+	for _, hdr := range msg.GetHeaders("Supported") {
+		if supported, ok := hdr.(*SupportedHeader); ok && HasToken(supported.Options, OptionOutbound) {
+			return true
+		}
+	}
+	for _, hdr := range msg.GetHeaders("Require") {
+		if require, ok := hdr.(*RequireHeader); ok && HasToken(require.Options, OptionOutbound) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOutboundUri checks that the URI has 'ob' parameter: the proxy or the UA supports outbound - RFC 5626 5.4.
+func IsOutboundUri(uri Uri) bool {
+	if uri == nil || uri.UriParams() == nil {
+		return false
+	}
+	return uri.UriParams().Has("ob")
+}
+
+// FlowTimer returns the keep-alive interval recommended by the registrar
+// in the 'Flow-Timer' header of the REGISTER response - RFC 5626 4.4.1.
+func FlowTimer(res Response) (time.Duration, bool) {
+	hdrs := res.GetHeaders("Flow-Timer")
+	if len(hdrs) == 0 {
+		return 0, false
+	}
+	secs, err := strconv.ParseUint(strings.TrimSpace(hdrs[0].Value()), 10, 32)
+	if err != nil || secs == 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
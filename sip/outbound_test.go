@@ -0,0 +1,74 @@
+package sip_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestOutboundContact(t *testing.T) {
+	instanceID := sip.NewInstanceID()
+	if !strings.HasPrefix(instanceID, "urn:uuid:") {
+		t.Fatalf("unexpected instance ID %s", instanceID)
+	}
+
+	contact := &sip.ContactHeader{Address: &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "192.0.2.1"}}
+	if _, _, ok := sip.OutboundContact(contact); ok {
+		t.Error("unexpected outbound contact")
+	}
+	sip.SetOutboundContact(contact, instanceID, 1)
+	if !strings.Contains(contact.String(), `;+sip.instance="<`+instanceID+`>";reg-id=1`) {
+		t.Errorf("unexpected contact %s", contact)
+	}
+
+	req := parseDialogMessage(t,
+		"REGISTER sip:example.com SIP/2.0",
+		"Via: SIP/2.0/TCP 192.0.2.1;branch=z9hG4bK776asdhds",
+		"From: <sip:alice@example.com>;tag=1928301774",
+		"To: <sip:alice@example.com>",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 1 REGISTER",
+		"Supported: path, outbound",
+		contact.String(),
+	)
+	if !sip.SupportsOutbound(req) {
+		t.Error("expected outbound support")
+	}
+	hdrs := req.GetHeaders("Contact")
+	if len(hdrs) != 1 {
+		t.Fatalf("unexpected contacts %v", hdrs)
+	}
+	id, regID, ok := sip.OutboundContact(hdrs[0].(*sip.ContactHeader))
+	if !ok || id != instanceID || regID != 1 {
+		t.Errorf("unexpected outbound params %s %d %v", id, regID, ok)
+	}
+}
+
+func TestFlowTimer(t *testing.T) {
+	res := parseDialogMessage(t,
+		"SIP/2.0 200 OK",
+		"Via: SIP/2.0/TCP 192.0.2.1;branch=z9hG4bK776asdhds",
+		"From: <sip:alice@example.com>;tag=1928301774",
+		"To: <sip:alice@example.com>;tag=1",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 1 REGISTER",
+		"Require: outbound",
+		"Flow-Timer: 25",
+	).(sip.Response)
+	if timer, ok := sip.FlowTimer(res); !ok || timer != 25*time.Second {
+		t.Errorf("unexpected flow timer %s", timer)
+	}
+	if !sip.SupportsOutbound(res) {
+		t.Error("expected outbound support")
+	}
+
+	uri := &sip.SipUri{FHost: "edge.example.com"}
+	if sip.IsOutboundUri(uri) {
+		t.Error("unexpected outbound URI")
+	}
+	if !sip.IsOutboundUri(uri.WithLR().SetParam("ob", nil)) {
+		t.Error("expected outbound URI")
+	}
+}
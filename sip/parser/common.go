@@ -73,8 +73,18 @@ func defaultHeaderParsers() map[string]HeaderParser {
 		"require":        parseRequire,
 		"supported":      parseSupported,
 		"k":              parseSupported,
+		"allow-events":   parseAllowEvents,
+		"u":              parseAllowEvents,
+		"event":          parseEvent,
+		"o":              parseEvent,
 		"route":          parseRouteHeader,
 		"record-route":   parseRecordRouteHeader,
+
+		"authorization":       parseAuthHeader,
+		"proxy-authorization": parseAuthHeader,
+		"www-authenticate":    parseAuthHeader,
+		"proxy-authenticate":  parseAuthHeader,
+
 		//"content-encoding","e"
 		//"subject":          "s",
 	}
@@ -117,7 +127,7 @@ func isRequest(startLine string) bool {
 	} else if len(parts[2]) < 3 {
 		return false
 	} else {
-		return strings.ToUpper(parts[2][:3]) == "SIP"
+		return sip.TokenUpper(parts[2][:3]) == "SIP"
 	}
 }
 
@@ -137,7 +147,7 @@ func isResponse(startLine string) bool {
 	} else if len(parts[0]) < 3 {
 		return false
 	} else {
-		return strings.ToUpper(parts[0][:3]) == "SIP"
+		return sip.TokenUpper(parts[0][:3]) == "SIP"
 	}
 }
 
@@ -153,12 +163,16 @@ func ParseRequestLine(requestLine string) (
 		return
 	}
 
-	method = sip.RequestMethod(strings.ToUpper(parts[0]))
+	method = sip.RequestMethod(sip.TokenUpper(parts[0]))
+	if !sip.IsValidMethod(method) {
+		err = fmt.Errorf("invalid method '%s' in request line: '%s'", parts[0], requestLine)
+		return
+	}
 	recipient, err = ParseUri(parts[1])
 	sipVersion = parts[2]
 
 	switch recipient.(type) {
-	case *sip.WildcardUri:
+	case sip.WildcardUri, *sip.WildcardUri:
 		err = fmt.Errorf("wildcard URI '*' not permitted in request line: '%s'", requestLine)
 	}
 
@@ -200,7 +214,7 @@ func ParseUri(uriStr string) (uri sip.Uri, err error) {
 		return
 	}
 
-	switch strings.ToLower(uriStr[:colonIdx]) {
+	switch sip.TokenLower(uriStr[:colonIdx]) {
 	case "sip":
 		var sipUri sip.SipUri
 		sipUri, err = ParseSipUri(uriStr)
@@ -211,7 +225,7 @@ func ParseUri(uriStr string) (uri sip.Uri, err error) {
 		sipUri, err = ParseSipUri(uriStr)
 		uri = &sipUri
 	default:
-		err = fmt.Errorf("unsupported URI schema %s", uriStr[:colonIdx])
+		err = fmt.Errorf("%w %s", sip.ErrUnsupportedScheme, uriStr[:colonIdx])
 	}
 
 	return
@@ -223,7 +237,7 @@ func ParseSipUri(uriStr string) (uri sip.SipUri, err error) {
 	uriStrCopy := uriStr
 
 	// URI should start 'sip' or 'sips'. Check the first 3 chars.
-	if strings.ToLower(uriStr[:3]) != "sip" {
+	if sip.TokenLower(uriStr[:3]) != "sip" {
 		err = fmt.Errorf("invalid SIP uri protocol name in '%s'", uriStrCopy)
 		return
 	}
@@ -233,7 +247,7 @@ func ParseSipUri(uriStr string) (uri sip.SipUri, err error) {
 		err = fmt.Errorf("uri too short to parse. '%s'", uriStrCopy)
 		return
 	}
-	if strings.ToLower(uriStr[0:1]) == "s" {
+	if sip.TokenLower(uriStr[0:1]) == "s" {
 		// URI started 'sips', so it's encrypted.
 		uri.FIsEncrypted = true
 		uriStr = uriStr[1:]
@@ -941,6 +955,24 @@ func parseSupported(headerName string, headerText string) (headers []sip.Header,
 	return
 }
 
+func parseAllowEvents(headerName string, headerText string) (headers []sip.Header, err error) {
+	var allowEvents sip.AllowEventsHeader
+	allowEvents.Events = make([]string, 0)
+	for _, event := range strings.Split(headerText, ",") {
+		allowEvents.Events = append(allowEvents.Events, strings.TrimSpace(event))
+	}
+	headers = []sip.Header{&allowEvents}
+
+	return
+}
+
+func parseEvent(headerName string, headerText string) (headers []sip.Header, err error) {
+	event := sip.Event(strings.TrimSpace(headerText))
+	headers = []sip.Header{&event}
+
+	return
+}
+
 // Parse a string representation of a Content-Length header into a slice of at most one ContentLength header object.
 func parseContentLength(headerName string, headerText string) (
 	headers []sip.Header, err error) {
@@ -1017,14 +1049,13 @@ func ParseAddressValue(addressText string) (
 
 	headerParams = sip.NewParams()
 
+	addressTextCopy := addressText
+	addressText = strings.TrimSpace(addressText)
 	if len(addressText) == 0 {
 		err = fmt.Errorf("address-type header has empty body")
 		return
 	}
 
-	addressTextCopy := addressText
-	addressText = strings.TrimSpace(addressText)
-
 	firstAngleBracket := findUnescaped(addressText, '<', quotesDelim)
 	displayName = nil
 	if firstAngleBracket > 0 {
@@ -1086,7 +1117,7 @@ func ParseAddressValue(addressText string) (
 	} else {
 		addressText = addressText[1:]
 		endOfUri = strings.Index(addressText, ">")
-		if endOfUri == 0 {
+		if endOfUri <= 0 {
 			err = fmt.Errorf("'<' without closing '>' in address %s",
 				addressTextCopy)
 			return
@@ -1133,6 +1164,35 @@ func parseRecordRouteHeader(headerName string, headerText string) (headers []sip
 	return []sip.Header{&routeHeader}, nil
 }
 
+// parseAuthHeader parses credentials and challenges, value with several of them gives a header for each one.
+func parseAuthHeader(headerName string, headerText string) (headers []sip.Header, err error) {
+	values := sip.SplitAuthValues(headerText)
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty %s header", headerName)
+	}
+
+	headers = make([]sip.Header, 0, len(values))
+	for _, value := range values {
+		auth, err := sip.ParseAuthValue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		switch headerName {
+		case "authorization":
+			headers = append(headers, &sip.AuthorizationHeader{AuthValue: auth})
+		case "proxy-authorization":
+			headers = append(headers, &sip.ProxyAuthorizationHeader{AuthValue: auth})
+		case "www-authenticate":
+			headers = append(headers, &sip.WWWAuthenticateHeader{AuthValue: auth})
+		case "proxy-authenticate":
+			headers = append(headers, &sip.ProxyAuthenticateHeader{AuthValue: auth})
+		}
+	}
+
+	return headers, nil
+}
+
 // GetNextHeaderLine extract the next logical header line from the message.
 // This may run over several actual lines; lines that start with whitespace are
 // a continuation of the previous line.
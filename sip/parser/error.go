@@ -1,5 +1,11 @@
 package parser
 
+import "errors"
+
+// ErrParse is matched by all syntax and framing errors of the parser,
+// errors.Is(err, ErrParse) tells them apart from transport and logic errors.
+var ErrParse = errors.New("parse error")
+
 type Error interface {
 	error
 	// Syntax indicates that this is syntax error
@@ -8,19 +14,32 @@ type Error interface {
 
 type InvalidStartLineError string
 
-func (err InvalidStartLineError) Syntax() bool    { return true }
-func (err InvalidStartLineError) Malformed() bool { return false }
-func (err InvalidStartLineError) Broken() bool    { return true }
-func (err InvalidStartLineError) Error() string   { return "parser.InvalidStartLineError: " + string(err) }
+func (err InvalidStartLineError) Syntax() bool         { return true }
+func (err InvalidStartLineError) Malformed() bool      { return false }
+func (err InvalidStartLineError) Broken() bool         { return true }
+func (err InvalidStartLineError) Is(target error) bool { return target == ErrParse }
+func (err InvalidStartLineError) Error() string {
+	return "parser.InvalidStartLineError: " + string(err)
+}
 
 type InvalidMessageFormat string
 
-func (err InvalidMessageFormat) Syntax() bool    { return true }
-func (err InvalidMessageFormat) Malformed() bool { return true }
-func (err InvalidMessageFormat) Broken() bool    { return true }
-func (err InvalidMessageFormat) Error() string   { return "parser.InvalidMessageFormat: " + string(err) }
+func (err InvalidMessageFormat) Syntax() bool         { return true }
+func (err InvalidMessageFormat) Malformed() bool      { return true }
+func (err InvalidMessageFormat) Broken() bool         { return true }
+func (err InvalidMessageFormat) Is(target error) bool { return target == ErrParse }
+func (err InvalidMessageFormat) Error() string        { return "parser.InvalidMessageFormat: " + string(err) }
 
 type WriteError string
 
 func (err WriteError) Syntax() bool  { return false }
 func (err WriteError) Error() string { return "parser.WriteError: " + string(err) }
+
+// FramingError is returned by the strict stream parser when message boundaries are lost
+// because of missing, duplicated or invalid Content-Length or broken start line - RFC 3261 18.3.
+// The rest of the stream can't be parsed, the connection should be closed.
+type FramingError string
+
+func (err FramingError) Syntax() bool         { return false }
+func (err FramingError) Is(target error) bool { return target == ErrParse }
+func (err FramingError) Error() string        { return "parser.FramingError: " + string(err) }
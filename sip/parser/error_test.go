@@ -0,0 +1,39 @@
+package parser_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func TestErrParse(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+	}{
+		{"broken start line", "HELLO\r\nCall-ID: abc\r\nContent-Length: 0\r\n\r\n"},
+		{"missing empty line", "SIP/2.0 200 OK\r\nCall-ID: abc"},
+	}
+	for _, c := range cases {
+		_, err := parser.ParseMessage([]byte(c.data), lenientLogger())
+		if !errors.Is(err, parser.ErrParse) {
+			t.Errorf("%s: expected ErrParse, got %v", c.name, err)
+		}
+	}
+
+	_, errs := parser.ParseMessageLenient([]byte("HELLO\r\n\r\n"), lenientLogger())
+	if len(errs) != 1 || !errors.Is(errs[0], parser.ErrParse) {
+		t.Errorf("expected lenient ErrParse, got %v", errs)
+	}
+}
+
+func TestErrUnsupportedScheme(t *testing.T) {
+	if _, err := parser.ParseUri("tel:+15551234567"); !errors.Is(err, sip.ErrUnsupportedScheme) {
+		t.Errorf("expected ErrUnsupportedScheme, got %v", err)
+	}
+	if _, err := parser.ParseUri("sip:"); errors.Is(err, sip.ErrUnsupportedScheme) {
+		t.Errorf("malformed SIP URI must not match ErrUnsupportedScheme, got %v", err)
+	}
+}
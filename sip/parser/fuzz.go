@@ -0,0 +1,25 @@
+//go:build gofuzz
+// +build gofuzz
+
+package parser
+
+import (
+	"github.com/ghettovoice/gosip/log"
+)
+
+var fuzzLogger = func() log.Logger {
+	logger := log.NewDefaultLogrusLogger()
+	logger.SetLevel(uint32(log.PanicLevel))
+	return logger
+}()
+
+// Fuzz is the entry point of go-fuzz (https://github.com/dvyukov/go-fuzz).
+// Parser panics are not recovered to be reported as crashes.
+func Fuzz(data []byte) int {
+	msg, err := NewPacketParser(fuzzLogger).ParseMessage(data)
+	if err != nil {
+		return 0
+	}
+	_ = msg.String()
+	return 1
+}
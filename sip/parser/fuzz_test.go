@@ -0,0 +1,84 @@
+//go:build go1.18
+// +build go1.18
+
+package parser_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+var fuzzSeeds = []string{
+	string(lazyInvite),
+	"SIP/2.0 180 Ringing\r\nVia: SIP/2.0/UDP 192.0.2.1;rport=;branch=z9hG4bK1\r\n" +
+		"To: <sip:bob@example.com>;tag=2\r\nFrom: <sip:alice@example.com>;tag=1\r\n" +
+		"Call-ID: abc\r\nCSeq: 1 INVITE\r\nContent-Length: 0\r\n\r\n",
+	"INVITE sip:bob@example.com SIP/2.0\r\nVia: SIP/2.0/UDP ;rport\r\nContent-Length: 0\r\n\r\n",
+	"OPTIONS sip:[2001:db8::1]:5060;transport=tcp SIP/2.0\nContact: *\nl: 3\n\nabc",
+	"REGISTER sip:example.com SIP/2.0\r\n" +
+		"Authorization: Digest username=\"a\", realm=\"b\", nonce=\"c\", uri=\"sip:example.com\"\r\n" +
+		"Contact: \"A\" <sip:a@192.0.2.1:5060;transport=ws>;expires=60;+sip.instance=\"<urn:uuid:1>\"\r\n\r\n",
+}
+
+var fuzzHeaderSeeds = []string{
+	"Via: SIP/2.0/UDP 192.0.2.1:5060;rport;branch=z9hG4bK1",
+	"Via: SIP/2.0/UDP 192.0.2.1;rport=",
+	"To: \"Bob\" <sip:bob@example.com;transport=tcp>;tag=1",
+	"Contact: <sip:a@b>;expires=60, *",
+	"CSeq: 1 INVITE",
+	"Max-Forwards: 70",
+	"Route: <sip:p1.example.com;lr>",
+	"Authorization: Digest username=\"a\", realm=\"b\", nonce=\"c\"",
+	"Content-Type: application/sdp",
+	"Content-Length: 10",
+}
+
+// FuzzParseMessage checks that the strict parser never panics.
+func FuzzParseMessage(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	logger := lenientLogger()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if msg, err := parser.ParseMessage(data, logger); err == nil {
+			_ = msg.String()
+		}
+	})
+}
+
+// FuzzParseMessageLenient checks that the lenient parser recovers from every malformed input
+// without hitting a parser panic.
+func FuzzParseMessageLenient(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	logger := lenientLogger()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, errs := parser.ParseMessageLenient(data, logger)
+		for _, err := range errs {
+			if errors.Is(err, parser.ErrPanic) {
+				t.Fatalf("%s on %q", err, data)
+			}
+		}
+		if msg != nil {
+			_ = msg.String()
+		}
+	})
+}
+
+// FuzzParseHeader checks that header parsers never panic.
+func FuzzParseHeader(f *testing.F) {
+	for _, seed := range fuzzHeaderSeeds {
+		f.Add(seed)
+	}
+	p := parser.NewPacketParser(lenientLogger())
+	f.Fuzz(func(t *testing.T, hdr string) {
+		if headers, err := p.ParseHeader(hdr); err == nil {
+			for _, h := range headers {
+				_ = h.String()
+			}
+		}
+	})
+}
@@ -0,0 +1,428 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Compact header forms - RFC 3261 7.3.3, RFC 3265, RFC 3515, RFC 4028.
+var compactHeaderNames = map[byte]string{
+	'a': "accept-contact",
+	'b': "referred-by",
+	'c': "content-type",
+	'd': "request-disposition",
+	'e': "content-encoding",
+	'f': "from",
+	'i': "call-id",
+	'j': "reject-contact",
+	'k': "supported",
+	'l': "content-length",
+	'm': "contact",
+	'o': "event",
+	'r': "refer-to",
+	's': "subject",
+	't': "to",
+	'u': "allow-events",
+	'v': "via",
+	'x': "session-expires",
+	'y': "identity",
+}
+
+// LazyParser parses SIP messages into LazyMessage views for high-throughput proxies.
+// The datagram is copied into the arena reused between calls and only the start line and
+// header boundaries are indexed, header values are parsed on access.
+// So forwarding that touches only Via, Route and Max-Forwards does not pay for parsing of other headers.
+//
+// LazyParser is not safe for concurrent use, the returned message is valid until the next Parse call,
+// use LazyMessage.Message to get sip.Message that outlives it.
+type LazyParser struct {
+	headerParsers map[string]HeaderParser
+	arena         []byte
+	msg           LazyMessage
+	log           log.Logger
+}
+
+func NewLazyParser(logger log.Logger) *LazyParser {
+	p := &LazyParser{}
+	p.log = logger.WithPrefix("parser.LazyParser").WithFields(
+		log.Fields{"parser_ptr": fmt.Sprintf("%p", p)})
+	p.headerParsers = make(map[string]HeaderParser)
+	for headerName, headerParser := range defaultHeaderParsers() {
+		p.SetHeaderParser(headerName, headerParser)
+	}
+	p.msg.parser = p
+	return p
+}
+
+func (lp *LazyParser) Log() log.Logger {
+	return lp.log
+}
+
+// SetHeaderParser registers parser of the header used on access, see Parser.SetHeaderParser.
+func (lp *LazyParser) SetHeaderParser(headerName string, headerParser HeaderParser) {
+	headerName = sip.TokenLower(headerName)
+	lp.headerParsers[headerName] = headerParser
+}
+
+func (lp *LazyParser) String() string {
+	if lp == nil {
+		return "LazyParser <nil>"
+	}
+	return fmt.Sprintf("LazyParser %p", lp)
+}
+
+// Parse indexes the message, the data is copied, so the caller may reuse it.
+// Errors are the same as of PacketParser.ParseMessage on the start line and header section format,
+// malformed header values are reported on access.
+func (lp *LazyParser) Parse(data []byte) (*LazyMessage, error) {
+	lp.arena = append(lp.arena[:0], data...)
+	msg := &lp.msg
+	msg.reset(lp.arena)
+
+	headEnd := bytes.Index(msg.data, []byte("\r\n\r\n"))
+	if headEnd == -1 {
+		return nil, InvalidMessageFormat("format error")
+	}
+	msg.body = msg.data[headEnd+4:]
+
+	head := msg.data[:headEnd]
+	// skip leading empty lines as PacketParser does
+	for bytes.HasPrefix(head, []byte("\r\n")) {
+		head = head[2:]
+	}
+	if len(head) == 0 {
+		return nil, InvalidMessageFormat(fmt.Sprintf("format error:%s", data))
+	}
+
+	lineEnd := bytes.Index(head, []byte("\r\n"))
+	if lineEnd == -1 {
+		lineEnd = len(head)
+	}
+	msg.startLine = head[:lineEnd]
+	if err := msg.indexStartLine(); err != nil {
+		return nil, InvalidStartLineError(fmt.Sprintf("%s failed to parse first line of message: %s", lp, err))
+	}
+
+	for rest := head[lineEnd:]; len(rest) > 0; {
+		rest = rest[2:]
+		end := bytes.Index(rest, []byte("\r\n"))
+		if end == -1 {
+			end = len(rest)
+		}
+		line := rest[:end]
+		rest = rest[end:]
+
+		switch {
+		case len(line) == 0:
+		case line[0] == ' ' || line[0] == '\t':
+			if len(msg.fields) == 0 {
+				lp.Log().Tracef("discard unexpected continuation line '%s' at start of header block", line)
+				continue
+			}
+			// continuation line, extend value of the last field
+			field := &msg.fields[len(msg.fields)-1]
+			field.value = field.value[:cap(field.value)-cap(line)+len(line)]
+			field.folded = true
+		default:
+			colon := bytes.IndexByte(line, ':')
+			if colon == -1 {
+				lp.Log().Warnf("skip header '%s' due to error: field name with no value", line)
+				continue
+			}
+			msg.fields = append(msg.fields, lazyField{
+				name:  bytes.TrimSpace(line[:colon]),
+				value: line[colon+1:],
+			})
+		}
+	}
+
+	return msg, nil
+}
+
+type lazyField struct {
+	// name and value are slices of the arena, value is untrimmed and may span folded lines
+	name    []byte
+	value   []byte
+	folded  bool
+	parsed  bool
+	headers []sip.Header
+	err     error
+}
+
+// Returns true if the field name equals to lowercase name or its compact form.
+func (field *lazyField) is(name string) bool {
+	if len(field.name) == 1 {
+		if full, ok := compactHeaderNames[lowerASCII(field.name[0])]; ok && full == name {
+			return true
+		}
+	}
+	if len(field.name) != len(name) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if lowerASCII(field.name[i]) != name[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (field *lazyField) text() string {
+	value := field.value
+	if !field.folded {
+		return string(bytes.TrimSpace(value))
+	}
+	// continuation lines are joined with a space as PacketParser does
+	return strings.TrimSpace(strings.Replace(string(value), "\r\n", " ", -1))
+}
+
+// LazyMessage is a view of the message in the LazyParser arena, headers are parsed on the first access.
+type LazyMessage struct {
+	parser    *LazyParser
+	data      []byte
+	startLine []byte
+	body      []byte
+	fields    []lazyField
+
+	isRequest  bool
+	method     []byte
+	statusCode sip.StatusCode
+}
+
+func (msg *LazyMessage) reset(data []byte) {
+	for i := range msg.fields {
+		msg.fields[i] = lazyField{}
+	}
+	msg.fields = msg.fields[:0]
+	msg.data = data
+	msg.startLine = nil
+	msg.body = nil
+	msg.isRequest = false
+	msg.method = nil
+	msg.statusCode = 0
+}
+
+// Classifies the start line as isRequest and isResponse do and takes the method or the status code
+// without allocations, the rest is parsed by Message.
+func (msg *LazyMessage) indexStartLine() error {
+	line := msg.startLine
+	sp1 := bytes.IndexByte(line, ' ')
+	if sp1 == -1 {
+		return fmt.Errorf("transmission beginning '%s' is not a SIP message", line)
+	}
+	sp2 := bytes.IndexByte(line[sp1+1:], ' ')
+	if sp2 == -1 {
+		return fmt.Errorf("transmission beginning '%s' is not a SIP message", line)
+	}
+	sp2 += sp1 + 1
+	first, second, third := line[:sp1], line[sp1+1:sp2], line[sp2+1:]
+
+	if bytes.IndexByte(third, ' ') == -1 && len(third) >= 3 && bytes.EqualFold(third[:3], []byte("SIP")) {
+		msg.isRequest = true
+		msg.method = first
+		return nil
+	}
+	if len(first) < 3 || !bytes.EqualFold(first[:3], []byte("SIP")) {
+		return fmt.Errorf("transmission beginning '%s' is not a SIP message", line)
+	}
+
+	if len(second) == 0 {
+		return fmt.Errorf("invalid status code in status line: '%s'", line)
+	}
+	var code int
+	for _, c := range second {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("invalid status code in status line: '%s'", line)
+		}
+		if code = code*10 + int(c-'0'); code > 0xffff {
+			return fmt.Errorf("invalid status code in status line: '%s'", line)
+		}
+	}
+	msg.statusCode = sip.StatusCode(code)
+	return nil
+}
+
+func (msg *LazyMessage) IsRequest() bool {
+	return msg.isRequest
+}
+
+// Method returns the request method, empty for responses.
+func (msg *LazyMessage) Method() sip.RequestMethod {
+	return sip.RequestMethod(sip.TokenUpper(string(msg.method)))
+}
+
+// StatusCode returns the response status code, zero for requests.
+func (msg *LazyMessage) StatusCode() sip.StatusCode {
+	return msg.statusCode
+}
+
+// Bytes returns the raw message, the slice is valid until the next Parse call.
+func (msg *LazyMessage) Bytes() []byte {
+	return msg.data
+}
+
+// Body returns the raw body, the slice is valid until the next Parse call.
+func (msg *LazyMessage) Body() []byte {
+	return msg.body
+}
+
+// RawHeader returns the trimmed value of the first header with the name or its compact form without parsing.
+// The slice is valid until the next Parse call, folded values are returned as is.
+func (msg *LazyMessage) RawHeader(name string) ([]byte, bool) {
+	name = sip.TokenLower(name)
+	for i := range msg.fields {
+		if msg.fields[i].is(name) {
+			return bytes.TrimSpace(msg.fields[i].value), true
+		}
+	}
+	return nil, false
+}
+
+// Parses the field once, the result is cached until the next Parse call.
+func (msg *LazyMessage) parseField(field *lazyField) ([]sip.Header, error) {
+	if field.parsed {
+		return field.headers, field.err
+	}
+	field.parsed = true
+
+	lowerName := sip.TokenLower(string(field.name))
+	text := field.text()
+	if headerParser, ok := msg.parser.headerParsers[lowerName]; ok {
+		field.headers, field.err = headerParser(lowerName, text)
+	} else {
+		field.headers = []sip.Header{&sip.GenericHeader{
+			HeaderName: string(field.name),
+			Contents:   text,
+		}}
+	}
+	if field.err != nil {
+		field.err = fmt.Errorf("parse header '%s': %w", field.name, field.err)
+		field.headers = nil
+	}
+	return field.headers, field.err
+}
+
+// Headers returns parsed headers with the name or its compact form.
+// The first malformed header aborts parsing with the error.
+func (msg *LazyMessage) Headers(name string) ([]sip.Header, error) {
+	name = sip.TokenLower(name)
+	var headers []sip.Header
+	for i := range msg.fields {
+		if !msg.fields[i].is(name) {
+			continue
+		}
+		hdrs, err := msg.parseField(&msg.fields[i])
+		if err != nil {
+			return nil, err
+		}
+		if headers == nil {
+			headers = hdrs
+		} else {
+			headers = append(headers[:len(headers):len(headers)], hdrs...)
+		}
+	}
+	return headers, nil
+}
+
+// ViaHop returns the top Via hop parsing only the first Via header.
+func (msg *LazyMessage) ViaHop() (*sip.ViaHop, bool, error) {
+	for i := range msg.fields {
+		if !msg.fields[i].is("via") {
+			continue
+		}
+		hdrs, err := msg.parseField(&msg.fields[i])
+		if err != nil {
+			return nil, false, err
+		}
+		for _, hdr := range hdrs {
+			if via, ok := hdr.(sip.ViaHeader); ok && len(via) > 0 {
+				return via[0], true, nil
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+// Routes returns route set of all 'Route' headers in order, see sip.Routes.
+func (msg *LazyMessage) Routes() ([]sip.Uri, error) {
+	hdrs, err := msg.Headers("route")
+	if err != nil {
+		return nil, err
+	}
+	uris := make([]sip.Uri, 0)
+	for _, hdr := range hdrs {
+		if route, ok := hdr.(*sip.RouteHeader); ok {
+			uris = append(uris, route.Addresses...)
+		}
+	}
+	return uris, nil
+}
+
+// MaxForwards returns 'Max-Forwards' value parsed in place without allocations,
+// ok is false if the message has no such header.
+func (msg *LazyMessage) MaxForwards() (value sip.MaxForwards, ok bool, err error) {
+	raw, ok := msg.RawHeader("max-forwards")
+	if !ok {
+		return 0, false, nil
+	}
+	if len(raw) == 0 {
+		return 0, true, fmt.Errorf("empty 'Max-Forwards' value")
+	}
+	var n uint64
+	for _, c := range raw {
+		if c < '0' || c > '9' {
+			return 0, true, fmt.Errorf("invalid 'Max-Forwards' value '%s'", raw)
+		}
+		n = n*10 + uint64(c-'0')
+		if n > 0xffffffff {
+			return 0, true, fmt.Errorf("invalid 'Max-Forwards' value '%s'", raw)
+		}
+	}
+	return sip.MaxForwards(n), true, nil
+}
+
+// Message builds sip.Message independent of the arena, headers already parsed by accessors are reused.
+// Malformed headers are skipped as PacketParser does.
+func (msg *LazyMessage) Message() (sip.Message, error) {
+	var out sip.Message
+	if msg.isRequest {
+		method, recipient, sipVersion, err := ParseRequestLine(string(msg.startLine))
+		if err != nil {
+			return nil, InvalidStartLineError(fmt.Sprintf("%s failed to parse first line of message: %s", msg.parser, err))
+		}
+		out = sip.NewRequest("", method, recipient, sipVersion, []sip.Header{}, "", nil)
+	} else {
+		sipVersion, statusCode, reason, err := ParseStatusLine(string(msg.startLine))
+		if err != nil {
+			return nil, InvalidStartLineError(fmt.Sprintf("%s failed to parse first line of message: %s", msg.parser, err))
+		}
+		out = sip.NewResponse("", sipVersion, statusCode, reason, []sip.Header{}, "", nil)
+	}
+
+	for i := range msg.fields {
+		hdrs, err := msg.parseField(&msg.fields[i])
+		if err != nil {
+			msg.parser.Log().Warnf("skip header '%s' due to error: %s", msg.fields[i].name, err)
+			continue
+		}
+		for _, hdr := range hdrs {
+			out.AppendHeader(hdr)
+		}
+	}
+
+	if len(bytes.TrimSpace(msg.body)) > 0 {
+		out.SetBody(string(msg.body), false)
+	}
+	return out, nil
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c - 'A' + 'a'
+	}
+	return c
+}
@@ -0,0 +1,236 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+var lazyInvite = []byte(strings.Join([]string{
+	"INVITE sip:bob@biloxi.example.com SIP/2.0",
+	"v: SIP/2.0/UDP pc33.atlanta.example.com;branch=z9hG4bK776asdhds",
+	"Via: SIP/2.0/UDP proxy.atlanta.example.com;branch=z9hG4bK1,",
+	" SIP/2.0/UDP 192.0.2.10:5070;branch=z9hG4bK2",
+	"Max-Forwards: 70",
+	"Route: <sip:p1.example.com;lr>,",
+	"\t<sip:p2.example.com;lr>",
+	"Route: <sip:p3.example.com;lr>",
+	"To: Bob <sip:bob@biloxi.example.com>",
+	"From: Alice <sip:alice@atlanta.example.com>;tag=1928301774",
+	"Call-ID: a84b4c76e66710@pc33.atlanta.example.com",
+	"CSeq: 314159 INVITE",
+	"Contact: <sip:alice@pc33.atlanta.example.com>",
+	"User-Agent: softphone/1.0",
+	"Allow: INVITE, ACK, CANCEL, BYE, OPTIONS",
+	"Supported: timer, 100rel",
+	"X-Account: 42",
+	"Content-Type: application/sdp",
+	"Content-Length: 4",
+	"",
+	"v=0\n",
+}, "\r\n"))
+
+func TestLazyParser_Parse(t *testing.T) {
+	p := parser.NewLazyParser(log.NewDefaultLogrusLogger())
+	msg, err := p.Parse(lazyInvite)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !msg.IsRequest() || msg.Method() != sip.INVITE || msg.StatusCode() != 0 {
+		t.Errorf("unexpected start line: request %v, method %s, status %d", msg.IsRequest(), msg.Method(), msg.StatusCode())
+	}
+	if string(msg.Body()) != "v=0\n" {
+		t.Errorf("unexpected body %q", msg.Body())
+	}
+
+	hop, ok, err := msg.ViaHop()
+	if err != nil || !ok {
+		t.Fatalf("unexpected ViaHop result: %v, %v", ok, err)
+	}
+	if hop.Host != "pc33.atlanta.example.com" {
+		t.Errorf("unexpected top Via host %s", hop.Host)
+	}
+
+	mf, ok, err := msg.MaxForwards()
+	if err != nil || !ok || mf != 70 {
+		t.Errorf("unexpected Max-Forwards: %d, %v, %v", mf, ok, err)
+	}
+
+	routes, err := msg.Routes()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(routes) != 3 || routes[1].Host() != "p2.example.com" || routes[2].Host() != "p3.example.com" {
+		t.Errorf("unexpected routes %v", routes)
+	}
+
+	vias, err := msg.Headers("Via")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(vias) != 2 || len(vias[1].(sip.ViaHeader)) != 2 {
+		t.Errorf("unexpected Via headers %v", vias)
+	}
+
+	if raw, ok := msg.RawHeader("x-account"); !ok || string(raw) != "42" {
+		t.Errorf("unexpected raw header %q, %v", raw, ok)
+	}
+	if _, ok := msg.RawHeader("Subject"); ok {
+		t.Error("unexpected raw header of absent header")
+	}
+}
+
+func TestLazyParser_Message(t *testing.T) {
+	logger := log.NewDefaultLogrusLogger()
+	want, err := parser.NewPacketParser(logger).ParseMessage(lazyInvite)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	p := parser.NewLazyParser(logger)
+	msg, err := p.Parse(lazyInvite)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// partially accessed message gives the same result
+	if _, _, err := msg.ViaHop(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, err := msg.Message()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("unexpected message:\n%s\nwant:\n%s", got, want)
+	}
+
+	// the message outlives the arena
+	if _, err := p.Parse([]byte("SIP/2.0 180 Ringing\r\nCSeq: 1 INVITE\r\nContent-Length: 0\r\n\r\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("message is changed by the next Parse:\n%s", got)
+	}
+}
+
+func TestLazyParser_Response(t *testing.T) {
+	p := parser.NewLazyParser(log.NewDefaultLogrusLogger())
+	msg, err := p.Parse([]byte(strings.Join([]string{
+		"SIP/2.0 486 Busy Here",
+		"Via: SIP/2.0/UDP 192.0.2.10:5070;branch=z9hG4bK2",
+		"CSeq: 1 INVITE",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if msg.IsRequest() || msg.StatusCode() != 486 || msg.Method() != "" {
+		t.Errorf("unexpected start line: request %v, method %s, status %d", msg.IsRequest(), msg.Method(), msg.StatusCode())
+	}
+	if _, ok, err := msg.MaxForwards(); ok || err != nil {
+		t.Errorf("unexpected Max-Forwards of response: %v, %v", ok, err)
+	}
+	res, err := msg.Message()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if res, ok := res.(sip.Response); !ok || res.Reason() != "Busy Here" {
+		t.Errorf("unexpected response %v", res)
+	}
+}
+
+func TestLazyParser_Errors(t *testing.T) {
+	p := parser.NewLazyParser(log.NewDefaultLogrusLogger())
+
+	if _, err := p.Parse([]byte("INVITE sip:bob@example.com SIP/2.0\r\nCSeq: 1 INVITE\r\n")); err == nil {
+		t.Error("expected error on message without the end of header section")
+	} else if _, ok := err.(parser.InvalidMessageFormat); !ok {
+		t.Errorf("unexpected error type %T", err)
+	}
+	for _, line := range []string{"HELLO", "INVITE sip:bob@example.com", "SIP/2.0 abc OK", "FOO BAR BAZ"} {
+		if _, err := p.Parse([]byte(line + "\r\n\r\n")); err == nil {
+			t.Errorf("expected error on start line '%s'", line)
+		} else if _, ok := err.(parser.InvalidStartLineError); !ok {
+			t.Errorf("unexpected error type %T on start line '%s'", err, line)
+		}
+	}
+
+	msg, err := p.Parse([]byte("OPTIONS sip:bob@example.com SIP/2.0\r\nMax-Forwards: x\r\nVia: broken\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, _, err := msg.MaxForwards(); err == nil {
+		t.Error("expected error on malformed Max-Forwards")
+	}
+	if _, _, err := msg.ViaHop(); err == nil {
+		t.Error("expected error on malformed Via")
+	}
+}
+
+// Proxy-style access: top Via, route set and Max-Forwards.
+func lazyProxyAccess(p *parser.LazyParser, data []byte) error {
+	msg, err := p.Parse(data)
+	if err != nil {
+		return err
+	}
+	if _, _, err := msg.ViaHop(); err != nil {
+		return err
+	}
+	if _, err := msg.Routes(); err != nil {
+		return err
+	}
+	_, _, err = msg.MaxForwards()
+	return err
+}
+
+func packetProxyAccess(p *parser.PacketParser, data []byte) error {
+	msg, err := p.ParseMessage(data)
+	if err != nil {
+		return err
+	}
+	msg.ViaHop()
+	sip.Routes(msg)
+	sip.GetMaxForwards(msg)
+	return nil
+}
+
+func TestLazyParser_Allocs(t *testing.T) {
+	logger := log.NewDefaultLogrusLogger()
+	lp := parser.NewLazyParser(logger)
+	pp := parser.NewPacketParser(logger)
+
+	lazy := testing.AllocsPerRun(100, func() { _ = lazyProxyAccess(lp, lazyInvite) })
+	packet := testing.AllocsPerRun(100, func() { _ = packetProxyAccess(pp, lazyInvite) })
+	t.Logf("allocs per message: lazy %.0f, packet %.0f", lazy, packet)
+	if lazy*3 > packet {
+		t.Errorf("lazy parser allocates %.0f times per message, want at least 3x fewer than %.0f", lazy, packet)
+	}
+}
+
+func BenchmarkLazyParser_Proxy(b *testing.B) {
+	p := parser.NewLazyParser(log.NewDefaultLogrusLogger())
+	b.ReportAllocs()
+	b.SetBytes(int64(len(lazyInvite)))
+	for i := 0; i < b.N; i++ {
+		if err := lazyProxyAccess(p, lazyInvite); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPacketParser_Proxy(b *testing.B) {
+	p := parser.NewPacketParser(log.NewDefaultLogrusLogger())
+	b.ReportAllocs()
+	b.SetBytes(int64(len(lazyInvite)))
+	for i := 0; i < b.N; i++ {
+		if err := packetProxyAccess(p, lazyInvite); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
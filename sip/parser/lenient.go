@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// ErrPanic is wrapped by errors of parts of the message the parser panicked on,
+// it indicates a bug of the parser and is never expected.
+var ErrPanic = errors.New("parser panic")
+
+// ParseError describes the part of the message skipped by the lenient parser.
+type ParseError struct {
+	// Line is the number of the first message line the error relates to counting from 1,
+	// 0 for errors of the message body.
+	Line int
+	// Header is the name of the skipped header, empty for the start line and the body.
+	Header string
+	// Text is the raw text that failed to parse.
+	Text string
+	Err  error
+}
+
+func (err ParseError) Syntax() bool         { return true }
+func (err ParseError) Unwrap() error        { return err.Err }
+func (err ParseError) Is(target error) bool { return target == ErrParse }
+func (err ParseError) Error() string {
+	switch {
+	case err.Header != "":
+		return fmt.Sprintf("parser.ParseError: line %d: header %s: %s", err.Line, err.Header, err.Err)
+	case err.Line > 0:
+		return fmt.Sprintf("parser.ParseError: line %d: %s", err.Line, err.Err)
+	default:
+		return fmt.Sprintf("parser.ParseError: %s", err.Err)
+	}
+}
+
+// ParseMessageLenient parses a SIP message by creating a parser on the fly,
+// see PacketParser.ParseMessageLenient.
+func ParseMessageLenient(msgData []byte, logger log.Logger) (sip.Message, []ParseError) {
+	parser := NewPacketParser(logger)
+	return parser.ParseMessageLenient(msgData)
+}
+
+// ParseMessageLenient parses the message skipping malformed parts instead of failing and never panics.
+// Headers that fail to parse are dropped, the body is truncated to or taken up to Content-Length.
+// The message is nil only if the start line can't be parsed, returned errors describe every
+// skipped part in the order of the message.
+func (pp *PacketParser) ParseMessageLenient(data []byte) (msg sip.Message, errs []ParseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			errs = append(errs, ParseError{Err: fmt.Errorf("%w: %v", ErrPanic, r)})
+		}
+	}()
+
+	// RFC 3261 7.5 - CRLFs preceding the start line are ignored,
+	// lineNum is the number of the data line preceding the start line
+	lineNum := 0
+	for len(data) > 0 && (data[0] == '\n' || data[0] == '\r') {
+		if data[0] == '\n' {
+			lineNum++
+		}
+		data = data[1:]
+	}
+	if len(data) == 0 {
+		return nil, append(errs, ParseError{Err: fmt.Errorf("empty message")})
+	}
+
+	head, body, bodyFound := splitMessage(data)
+	lines := strings.Split(string(head), "\n")
+	startLine := strings.TrimRight(lines[0], "\r")
+	msg, err := pp.parseStartLineSafe(startLine)
+	if err != nil {
+		return nil, append(errs, ParseError{Line: lineNum + 1, Text: startLine, Err: err})
+	}
+
+	var buffer bytes.Buffer
+	bufferLine := 0
+	flushBuffer := func() {
+		if buffer.Len() == 0 {
+			return
+		}
+		headers, err := pp.parseHeaderSafe(buffer.String())
+		if err == nil {
+			for _, header := range headers {
+				msg.AppendHeader(header)
+			}
+		} else {
+			text := buffer.String()
+			name := text
+			if idx := strings.Index(text, ":"); idx != -1 {
+				name = strings.TrimSpace(text[:idx])
+			}
+			errs = append(errs, ParseError{Line: bufferLine, Header: name, Text: text, Err: err})
+		}
+		buffer.Reset()
+	}
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		switch {
+		case line == "":
+			continue
+		case !strings.Contains(abnfWs, line[:1]):
+			flushBuffer()
+			buffer.WriteString(line)
+			bufferLine = lineNum + i + 1
+		case buffer.Len() > 0:
+			// RFC 3261 7.3.1 - folding is equivalent to a single SP
+			buffer.WriteString(" ")
+			buffer.WriteString(strings.TrimLeft(line, abnfWs))
+		default:
+			errs = append(errs, ParseError{
+				Line: lineNum + i + 1,
+				Text: line,
+				Err:  fmt.Errorf("unexpected continuation line at start of header block"),
+			})
+		}
+	}
+	flushBuffer()
+
+	if !bodyFound {
+		errs = append(errs, ParseError{Err: fmt.Errorf("missing empty line after headers")})
+	}
+	if cl, ok := msg.ContentLength(); ok {
+		switch bodyLen := int(*cl); {
+		case len(body) < bodyLen:
+			errs = append(errs, ParseError{
+				Err: fmt.Errorf("incomplete message body: read %d bytes, expected %d bytes", len(body), bodyLen),
+			})
+		case len(body) > bodyLen:
+			// RFC 3261 18.3 - bytes beyond Content-Length of datagram are discarded
+			body = body[:bodyLen]
+		}
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		msg.SetBody(string(body), false)
+	}
+	return msg, errs
+}
+
+// Splits the message at the first empty line, also accepts bare LF line endings.
+func splitMessage(data []byte) (head, body []byte, ok bool) {
+	crlf := bytes.Index(data, []byte("\r\n\r\n"))
+	lf := bytes.Index(data, []byte("\n\n"))
+	switch {
+	case crlf != -1 && (lf == -1 || crlf < lf):
+		return data[:crlf], data[crlf+4:], true
+	case lf != -1:
+		return data[:lf], data[lf+2:], true
+	default:
+		return data, nil, false
+	}
+}
+
+func (pp *PacketParser) parseStartLineSafe(startLine string) (msg sip.Message, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg, err = nil, fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	return pp.parseStartLine(startLine)
+}
+
+func (pp *PacketParser) parseHeaderSafe(headerText string) (headers []sip.Header, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			headers, err = nil, fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	return pp.ParseHeader(headerText)
+}
@@ -0,0 +1,144 @@
+package parser_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func lenientLogger() log.Logger {
+	logger := log.NewDefaultLogrusLogger()
+	logger.SetLevel(uint32(log.PanicLevel))
+	return logger
+}
+
+func TestParseMessageLenient_MalformedHeaders(t *testing.T) {
+	data := strings.Join([]string{
+		"INVITE sip:bob@example.com SIP/2.0",
+		"Via: SIP/2.0/UDP 192.0.2.1;rport;branch=z9hG4bK1",
+		"Via: SIP/2.0",
+		"From: <sip:alice@example.com>;tag=1",
+		"To: <sip:bob@example.com>",
+		"CSeq: one",
+		" INVITE",
+		"Call-ID: abc",
+		"Content-Length: 4",
+		"",
+		"v=0\n",
+	}, "\r\n")
+
+	msg, errs := parser.ParseMessageLenient([]byte(data), lenientLogger())
+	if msg == nil {
+		t.Fatal("message is not parsed")
+	}
+	if len(errs) != 2 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	for i, want := range []struct {
+		line   int
+		header string
+	}{
+		{3, "Via"},
+		{6, "CSeq"},
+	} {
+		if errs[i].Line != want.line || errs[i].Header != want.header || errs[i].Err == nil {
+			t.Errorf("unexpected error %d: %#v", i, errs[i])
+		}
+	}
+	if errs[1].Text != "CSeq: one INVITE" {
+		t.Errorf("unexpected text of folded header %q", errs[1].Text)
+	}
+
+	req, ok := msg.(sip.Request)
+	if !ok || req.Method() != sip.INVITE {
+		t.Fatalf("unexpected message %s", msg.Short())
+	}
+	if hop, ok := req.ViaHop(); !ok || hop.Host != "192.0.2.1" || !hop.Params.Has("rport") {
+		t.Errorf("unexpected Via %v", hop)
+	}
+	if _, ok := req.CSeq(); ok {
+		t.Error("malformed CSeq is not skipped")
+	}
+	if callID, ok := req.CallID(); !ok || string(*callID) != "abc" {
+		t.Errorf("unexpected Call-ID %v", callID)
+	}
+	if req.Body() != "v=0\n" {
+		t.Errorf("unexpected body %q", req.Body())
+	}
+
+	var parseErr parser.ParseError
+	if err := error(errs[0]); !errors.As(err, &parseErr) || !parseErr.Syntax() {
+		t.Errorf("unexpected error type %T", err)
+	}
+	if errors.Is(errs[0], parser.ErrPanic) {
+		t.Errorf("unexpected panic %s", errs[0])
+	}
+}
+
+func TestParseMessageLenient_StartLine(t *testing.T) {
+	msg, errs := parser.ParseMessageLenient([]byte("\r\n\r\nHELLO\r\nVia: SIP/2.0/UDP a\r\n\r\n"), lenientLogger())
+	if msg != nil {
+		t.Errorf("unexpected message %s", msg.Short())
+	}
+	if len(errs) != 1 || errs[0].Line != 3 || errs[0].Text != "HELLO" {
+		t.Errorf("unexpected errors %#v", errs)
+	}
+
+	if msg, errs := parser.ParseMessageLenient(nil, lenientLogger()); msg != nil || len(errs) != 1 {
+		t.Errorf("unexpected result of empty data %v %v", msg, errs)
+	}
+}
+
+func TestParseMessageLenient_Body(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   string
+		body   string
+		errors int
+	}{
+		{
+			"truncated body",
+			"SIP/2.0 200 OK\r\nCall-ID: abc\r\nContent-Length: 10\r\n\r\nv=0\r\n",
+			"v=0\r\n",
+			1,
+		},
+		{
+			"datagram padding",
+			"SIP/2.0 200 OK\r\nCall-ID: abc\r\nContent-Length: 5\r\n\r\nv=0\r\n\x00\x00\x00",
+			"v=0\r\n",
+			0,
+		},
+		{
+			"bare LF line endings",
+			"SIP/2.0 200 OK\nCall-ID: abc\nContent-Length: 5\n\nv=0\r\n",
+			"v=0\r\n",
+			0,
+		},
+		{
+			"missing empty line",
+			"SIP/2.0 200 OK\r\nCall-ID: abc",
+			"",
+			1,
+		},
+	}
+	for _, c := range cases {
+		msg, errs := parser.ParseMessageLenient([]byte(c.data), lenientLogger())
+		if msg == nil {
+			t.Errorf("%s: message is not parsed: %v", c.name, errs)
+			continue
+		}
+		if len(errs) != c.errors {
+			t.Errorf("%s: unexpected errors %v", c.name, errs)
+		}
+		if msg.Body() != c.body {
+			t.Errorf("%s: unexpected body %q", c.name, msg.Body())
+		}
+		if callID, ok := msg.CallID(); !ok || string(*callID) != "abc" {
+			t.Errorf("%s: unexpected Call-ID %v", c.name, callID)
+		}
+	}
+}
@@ -128,7 +128,7 @@ func (pp *PacketParser) fillBody(msg sip.Message, body string, bodyLen int) erro
 	// RFC 3261 - 18.3.
 	if len(body) != bodyLen {
 		return &sip.BrokenMessageError{
-			Err: fmt.Errorf("incomplete message body: read %d bytes, expected %d bytes", len(body), bodyLen),
+			Err: fmt.Errorf("%w: incomplete message body: read %d bytes, expected %d bytes", ErrParse, len(body), bodyLen),
 			Msg: msg.String(),
 		}
 	}
@@ -154,7 +154,7 @@ func (pp *PacketParser) ParseHeader(headerText string) (headers []sip.Header, er
 	}
 
 	fieldName := strings.TrimSpace(headerText[:colonIdx])
-	lowerFieldName := strings.ToLower(fieldName)
+	lowerFieldName := sip.TokenLower(fieldName)
 	fieldText := strings.TrimSpace(headerText[colonIdx+1:])
 	if headerParser, ok := pp.headerParsers[lowerFieldName]; ok {
 		// We have a registered parser for this header type - use it.
@@ -176,7 +176,7 @@ func (pp *PacketParser) ParseHeader(headerText string) (headers []sip.Header, er
 
 // SetHeaderParser implements ParserFactory.SetHeaderParser.
 func (pp *PacketParser) SetHeaderParser(headerName string, headerParser HeaderParser) {
-	headerName = strings.ToLower(headerName)
+	headerName = sip.TokenLower(headerName)
 	pp.headerParsers[headerName] = headerParser
 }
 
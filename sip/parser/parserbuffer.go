@@ -91,6 +91,20 @@ func (pb *parserBuffer) NextLine() (response string, err error) {
 	}
 }
 
+// SkipBufferedCRLF removes CRLF from the start of the buffered data without blocking,
+// returns false if the data already written to the buffer doesn't start with CRLF.
+func (pb *parserBuffer) SkipBufferedCRLF() bool {
+	if pb.reader.Buffered() < 2 {
+		return false
+	}
+	data, err := pb.reader.Peek(2)
+	if err != nil || data[0] != '\r' || data[1] != '\n' {
+		return false
+	}
+	_, _ = pb.reader.Discard(2)
+	return true
+}
+
 // NextChunk block until the buffer contains at least n characters.
 // Return precisely those n characters, then delete them from the buffer.
 func (pb *parserBuffer) NextChunk(n int) (response string, err error) {
@@ -33,11 +33,15 @@ func NewParser(
 	errs chan<- error,
 	streamed bool,
 	logger log.Logger,
+	options ...ParserOption,
 ) Parser {
 	p := &parser{
 		streamed: streamed,
 		done:     make(chan struct{}),
 	}
+	for _, opt := range options {
+		opt(p)
+	}
 	p.PacketParser = NewPacketParser(logger)
 	p.output = output
 	p.errs = errs
@@ -49,11 +53,59 @@ func NewParser(
 	return p
 }
 
+// ParserOption configures the parser created by NewParser.
+type ParserOption func(p *parser)
+
+// WithStrictContentLength enables strict framing of the streamed parser - RFC 3261 18.3.
+// Message without Content-Length, with multiple or invalid Content-Length headers,
+// with Content-Length greater than maxLength (if maxLength > 0) or with broken start line
+// stops the parser with FramingError instead of searching for the next message in the stream.
+func WithStrictContentLength(maxLength int) ParserOption {
+	return func(p *parser) {
+		p.strict = true
+		p.maxContentLength = maxLength
+	}
+}
+
+// KeepAlive is CRLF keep-alive received between messages of the stream - RFC 5626 3.5.1.
+type KeepAlive int
+
+const (
+	// KeepAlivePing is double CRLF, the receiver responds with KeepAlivePong.
+	KeepAlivePing KeepAlive = iota
+	// KeepAlivePong is single CRLF.
+	KeepAlivePong
+)
+
+func (ka KeepAlive) String() string {
+	switch ka {
+	case KeepAlivePing:
+		return "ping"
+	case KeepAlivePong:
+		return "pong"
+	default:
+		return fmt.Sprintf("KeepAlive(%d)", int(ka))
+	}
+}
+
+// WithKeepAliveHandler sets the handler of CRLF keep-alives received by the streamed parser,
+// e.g. to respond with pong on ping. The handler is called from the parsing goroutine.
+// Double CRLF is recognized as ping when it is written to the parser within one Write call.
+func WithKeepAliveHandler(handler func(ka KeepAlive)) ParserOption {
+	return func(p *parser) {
+		p.onKeepAlive = handler
+	}
+}
+
 type parser struct {
 	*PacketParser
 	streamed bool
 	input    *parserBuffer
 
+	strict           bool
+	maxContentLength int
+	onKeepAlive      func(ka KeepAlive)
+
 	output chan<- sip.Message
 	errs   chan<- error
 
@@ -167,6 +219,18 @@ func (p *parser) parse(done chan<- struct{}) {
 		if err != nil {
 			break
 		}
+		// CRLF keep-alive between messages - RFC 5626 3.5.1
+		if p.streamed && startLine == "" {
+			ka := KeepAlivePong
+			if p.input.SkipBufferedCRLF() {
+				ka = KeepAlivePing
+			}
+			p.Log().Tracef("%s received keep-alive %s", p, ka)
+			if p.onKeepAlive != nil {
+				p.onKeepAlive(ka)
+			}
+			continue
+		}
 
 		p.Log().Tracef("start reading start line: %s", startLine)
 		msg, termErr := p.parseStartLine(startLine)
@@ -175,6 +239,10 @@ func (p *parser) parse(done chan<- struct{}) {
 			termErr = InvalidStartLineError(fmt.Sprintf("%s failed to parse first line of message: %s", p, termErr))
 
 			if p.streamed {
+				if p.strict {
+					p.errs <- FramingError(termErr.Error())
+					return
+				}
 				if !skipStreamedErr {
 					skipStreamedErr = true
 					p.errs <- termErr
@@ -202,6 +270,12 @@ func (p *parser) parse(done chan<- struct{}) {
 			}
 			lines = append(lines, line)
 		}
+		if p.streamed && p.strict {
+			if _, err := strictContentLength(lines, p.maxContentLength); err != nil {
+				p.errs <- FramingError(fmt.Sprintf("%s: %s", msg.Short(), err))
+				return
+			}
+		}
 		p.fillHeaders(msg, lines)
 
 		var contentLength int
@@ -265,6 +339,39 @@ func (p *parser) parse(done chan<- struct{}) {
 
 // SetHeaderParser implements ParserFactory.SetHeaderParser.
 func (p *parser) SetHeaderParser(headerName string, headerParser HeaderParser) {
-	headerName = strings.ToLower(headerName)
+	headerName = sip.TokenLower(headerName)
 	p.headerParsers[headerName] = headerParser
 }
+
+// Validates raw Content-Length headers of the header lines.
+func strictContentLength(lines []string, maxLength int) (int, error) {
+	length, found := 0, false
+	for _, line := range lines {
+		colon := strings.IndexByte(line, ':')
+		if colon == -1 || strings.ContainsAny(line[:1], abnfWs) {
+			continue
+		}
+		name := sip.TokenLower(strings.TrimSpace(line[:colon]))
+		if name != "content-length" && name != "l" {
+			continue
+		}
+		if found {
+			return 0, fmt.Errorf("multiple 'Content-Length' headers")
+		}
+		found = true
+
+		value := strings.TrimSpace(line[colon+1:])
+		n, err := strconv.ParseUint(value, 10, 31)
+		if err != nil {
+			return 0, fmt.Errorf("invalid 'Content-Length' value '%s'", value)
+		}
+		length = int(n)
+		if maxLength > 0 && length > maxLength {
+			return 0, fmt.Errorf("'Content-Length' %d exceeds limit %d", length, maxLength)
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("missing required 'Content-Length' header")
+	}
+	return length, nil
+}
@@ -1109,6 +1109,13 @@ func TestSupported(t *testing.T) {
 	}, t)
 }
 
+func TestAllowEvents(t *testing.T) {
+	doTests([]test{
+		{allowEventsInput("Allow-Events: presence, dialog"), &allowEventsResult{pass, &sip.AllowEventsHeader{Events: []string{"presence", "dialog"}}}},
+		{allowEventsInput("u: presence.winfo"), &allowEventsResult{pass, &sip.AllowEventsHeader{Events: []string{"presence.winfo"}}}},
+	}, t)
+}
+
 // Basic test of unstreamed parsing, using empty INVITE.
 func TestUnstreamedParse1(t *testing.T) {
 	test := ParserTest{false, []parserTestStep{
@@ -2338,6 +2345,41 @@ func (expected *supportedResult) equals(other result) (equal bool, reason string
 	return true, ""
 }
 
+type allowEventsInput string
+
+func (data allowEventsInput) String() string {
+	return string(data)
+}
+
+func (data allowEventsInput) evaluate() result {
+	headers, err := parseHeader(data.String())
+	if len(headers) == 1 {
+		return &allowEventsResult{err, headers[0].(*sip.AllowEventsHeader)}
+	} else if len(headers) == 0 {
+		return &allowEventsResult{err, &sip.AllowEventsHeader{}}
+	} else {
+		panic(fmt.Sprintf("Multiple headers returned by Allow-Events test: %s", string(data)))
+	}
+}
+
+type allowEventsResult struct {
+	err    error
+	header *sip.AllowEventsHeader
+}
+
+func (expected *allowEventsResult) equals(other result) (equal bool, reason string) {
+	actual := *(other.(*allowEventsResult))
+	if expected.err == nil && actual.err != nil {
+		return false, fmt.Sprintf("unexpected error: %s", actual.err.Error())
+	} else if expected.err != nil && actual.err == nil {
+		return false, fmt.Sprintf("unexpected success: got \"%s\"", actual.header.String())
+	} else if actual.err == nil && !expected.header.Equals(actual.header) {
+		return false, fmt.Sprintf("unexpected Allow-Events value: expected \"%s\", got \"%s\"",
+			expected.header, actual.header)
+	}
+	return true, ""
+}
+
 type ParserTest struct {
 	streamed bool
 	steps    []parserTestStep
@@ -2461,6 +2503,126 @@ func (step *parserTestStep) Test(parser parser.Parser, msgChan chan sip.Message,
 	return
 }
 
+func TestStrictStreamedParse(t *testing.T) {
+	cases := map[string]string{
+		"missing":  "INVITE sip:bob@biloxi.com SIP/2.0\r\nCall-ID: a\r\n\r\n",
+		"negative": "INVITE sip:bob@biloxi.com SIP/2.0\r\nContent-Length: -1\r\n\r\n",
+		"overflow": "INVITE sip:bob@biloxi.com SIP/2.0\r\nContent-Length: 99999999999\r\n\r\n",
+		"limit":    "INVITE sip:bob@biloxi.com SIP/2.0\r\nContent-Length: 1025\r\n\r\n",
+		"multiple": "INVITE sip:bob@biloxi.com SIP/2.0\r\nContent-Length: 0\r\nl: 0\r\n\r\n",
+		"garbage":  "This is not SIP\r\n\r\n",
+	}
+	valid := "INVITE sip:bob@biloxi.com SIP/2.0\r\nl: 0\r\n\r\n"
+
+	for name, data := range cases {
+		output := make(chan sip.Message, 1)
+		errs := make(chan error, 1)
+		p := parser.NewParser(output, errs, true, testutils.NewLogrusLogger(), parser.WithStrictContentLength(1024))
+
+		if _, err := p.Write([]byte(valid + data + valid)); err != nil {
+			t.Fatalf("%s: unexpected write error: %s", name, err)
+		}
+		select {
+		case <-output:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: message before broken one is not parsed", name)
+		}
+		select {
+		case err := <-errs:
+			if _, ok := err.(parser.FramingError); !ok {
+				t.Errorf("%s: unexpected error %v", name, err)
+			}
+		case msg := <-output:
+			t.Errorf("%s: unexpected message %s", name, msg.Short())
+		case <-time.After(time.Second):
+			t.Errorf("%s: framing error is not sent", name)
+		}
+		p.Stop()
+		select {
+		case msg := <-output:
+			t.Errorf("%s: stream must not be parsed after framing error, got %s", name, msg.Short())
+		default:
+		}
+	}
+}
+
+func TestStreamedParseKeepAlive(t *testing.T) {
+	output := make(chan sip.Message, 2)
+	errs := make(chan error, 1)
+	keepAlives := make(chan parser.KeepAlive, 4)
+	p := parser.NewParser(output, errs, true, testutils.NewLogrusLogger(),
+		parser.WithKeepAliveHandler(func(ka parser.KeepAlive) {
+			keepAlives <- ka
+		}))
+	defer p.Stop()
+
+	msg := "INVITE sip:bob@biloxi.com SIP/2.0\r\nl: 0\r\n\r\n"
+	for _, data := range []string{"\r\n\r\n", "\r\n", msg + "\r\n\r\n" + msg} {
+		if _, err := p.Write([]byte(data)); err != nil {
+			t.Fatalf("unexpected write error: %s", err)
+		}
+	}
+
+	for i, want := range []parser.KeepAlive{parser.KeepAlivePing, parser.KeepAlivePong, parser.KeepAlivePing} {
+		select {
+		case ka := <-keepAlives:
+			if ka != want {
+				t.Errorf("keep-alive %d: expected %s, got %s", i, want, ka)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("keep-alive %d: %s is not received", i, want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-output:
+		case err := <-errs:
+			t.Fatalf("unexpected error: %s", err)
+		case <-time.After(time.Second):
+			t.Fatalf("message %d is not parsed", i)
+		}
+	}
+}
+
+func TestParseAuthHeaders(t *testing.T) {
+	p := parser.NewPacketParser(testutils.NewLogrusLogger())
+
+	headers, err := p.ParseHeader(`Proxy-Authenticate: Digest realm="atlanta.com", ` +
+		`nonce="f84f1cec41e6cbe5aea9c8e88d359", qop="auth,auth-int", algorithm=SHA-256, ` +
+		`Digest realm="atlanta.com", nonce="b1ab", algorithm=MD5`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(headers) != 2 {
+		t.Fatalf("expected header for each challenge, got %d", len(headers))
+	}
+	challenge, ok := headers[0].(*sip.ProxyAuthenticateHeader)
+	if !ok {
+		t.Fatalf("unexpected header type %T", headers[0])
+	}
+	if challenge.Realm != "atlanta.com" || challenge.Qop != "auth,auth-int" || challenge.Algorithm != "SHA-256" {
+		t.Errorf("unexpected challenge %+v", challenge.AuthValue)
+	}
+
+	headers, err = p.ParseHeader(`Authorization: Digest username="bob", realm="biloxi.com", ` +
+		`nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", uri="sip:bob@biloxi.com", qop=auth, nc=00000001, ` +
+		`cnonce="0a4f113b", response="6629fae49393a05397450978507c4ef1", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	creds, ok := headers[0].(*sip.AuthorizationHeader)
+	if !ok {
+		t.Fatalf("unexpected header type %T", headers[0])
+	}
+	if creds.Username != "bob" || creds.Response != "6629fae49393a05397450978507c4ef1" || creds.Nc != "00000001" {
+		t.Errorf("unexpected credentials %+v", creds.AuthValue)
+	}
+
+	if _, err := p.ParseHeader(`WWW-Authenticate: Digest realm="unterminated`); err == nil {
+		t.Error("expected error on unterminated quoted string")
+	}
+}
+
 func TestZZZCountTests(t *testing.T) {
 	fmt.Printf("\n *** %d tests run ***", testsRun)
 	fmt.Printf("\n *** %d tests passed (%.2f%%) ***\n\n", testsPassed, float32(testsPassed)*100.0/float32(testsRun))
@@ -0,0 +1,206 @@
+package sip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UriPattern matches SIP URIs by glob patterns on the user and host parts.
+// Pattern has form '[sip:|sips:]user@host' or '[sip:|sips:]host' that matches any user,
+// '*' in the user and host parts matches any sequence of characters (including empty),
+// host is matched case-insensitively. Pattern '*' matches any URI.
+// For example 'sip:+1555*@*.example.com' matches 'sip:+15551234@eu.example.com' with captures '1234' and 'eu'.
+// Pattern is compiled once and safe for concurrent use.
+type UriPattern struct {
+	raw    string
+	scheme string
+	user   []string
+	host   []string
+}
+
+// CompileUriPattern parses URI pattern.
+func CompileUriPattern(pattern string) (*UriPattern, error) {
+	p := &UriPattern{raw: pattern}
+	if pattern == "*" {
+		p.user, p.host = []string{"", ""}, []string{"", ""}
+		return p, nil
+	}
+
+	rest := pattern
+	for _, scheme := range []string{"sip", "sips"} {
+		if len(rest) > len(scheme) && TokenEqual(rest[:len(scheme)+1], scheme+":") {
+			p.scheme, rest = scheme, rest[len(scheme)+1:]
+			break
+		}
+	}
+
+	switch parts := strings.SplitN(rest, "@", 2); {
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		p.user, p.host = strings.Split(parts[0], "*"), strings.Split(parts[1], "*")
+	case len(parts) == 1 && parts[0] != "":
+		p.user, p.host = []string{"", ""}, strings.Split(parts[0], "*")
+	default:
+		return nil, fmt.Errorf("invalid URI pattern '%s'", pattern)
+	}
+
+	return p, nil
+}
+
+// MustCompileUriPattern is like CompileUriPattern but panics on invalid pattern.
+func MustCompileUriPattern(pattern string) *UriPattern {
+	p, err := CompileUriPattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (p *UriPattern) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return p.raw
+}
+
+// Match checks that the URI matches the pattern and returns strings matched by '*' in order of appearance.
+func (p *UriPattern) Match(uri Uri) ([]string, bool) {
+	if uri == nil || uri.IsWildcard() {
+		return nil, false
+	}
+	if p.scheme != "" && (p.scheme == "sips") != uri.IsEncrypted() {
+		return nil, false
+	}
+
+	var user string
+	if uri.User() != nil {
+		user = uri.User().String()
+	}
+	captures, ok := matchGlob(p.user, user, false, make([]string, 0))
+	if !ok {
+		return nil, false
+	}
+	return matchGlob(p.host, uri.Host(), true, captures)
+}
+
+// matchGlob matches s by literal parts separated by '*' appending the star matches to captures.
+func matchGlob(parts []string, s string, fold bool, captures []string) ([]string, bool) {
+	lit := parts[0]
+	if len(s) < len(lit) {
+		return nil, false
+	}
+	if fold && !TokenEqual(s[:len(lit)], lit) || !fold && s[:len(lit)] != lit {
+		return nil, false
+	}
+	s = s[len(lit):]
+
+	if len(parts) == 1 {
+		return captures, s == ""
+	}
+	// the shortest match of each star, full cap forces a copy of captures on append
+	captures = captures[:len(captures):len(captures)]
+	for i := 0; i <= len(s); i++ {
+		if result, ok := matchGlob(parts[1:], s[i:], fold, append(captures, s[:i])); ok {
+			return result, true
+		}
+	}
+	return nil, false
+}
+
+// UriTemplate generates URIs from captures of UriPattern match.
+// References to captures are '$1'...'$9' or '${N}', '$$' is a literal '$'.
+// For example template 'sip:$1@$2.gw.example.com' with captures '1234' and 'eu'
+// generates 'sip:1234@eu.gw.example.com'.
+type UriTemplate struct {
+	raw      string
+	segments []templateSegment
+}
+
+type templateSegment struct {
+	literal string
+	// 1-based capture index, 0 for literal segment
+	capture int
+}
+
+// CompileUriTemplate parses URI template.
+func CompileUriTemplate(template string) (*UriTemplate, error) {
+	t := &UriTemplate{raw: template}
+
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			t.segments = append(t.segments, templateSegment{literal: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' {
+			lit.WriteByte(template[i])
+			continue
+		}
+		if i+1 == len(template) {
+			return nil, fmt.Errorf("unterminated reference in URI template '%s'", template)
+		}
+
+		var ref string
+		switch next := template[i+1]; {
+		case next == '$':
+			lit.WriteByte('$')
+			i++
+			continue
+		case next == '{':
+			end := strings.IndexByte(template[i+2:], '}')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated reference in URI template '%s'", template)
+			}
+			ref = template[i+2 : i+2+end]
+			i += end + 2
+		default:
+			ref = template[i+1 : i+2]
+			i++
+		}
+
+		index, err := strconv.Atoi(ref)
+		if err != nil || index < 1 {
+			return nil, fmt.Errorf("invalid reference '%s' in URI template '%s'", ref, template)
+		}
+		flush()
+		t.segments = append(t.segments, templateSegment{capture: index})
+	}
+	flush()
+
+	return t, nil
+}
+
+// MustCompileUriTemplate is like CompileUriTemplate but panics on invalid template.
+func MustCompileUriTemplate(template string) *UriTemplate {
+	t, err := CompileUriTemplate(template)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (t *UriTemplate) String() string {
+	if t == nil {
+		return "<nil>"
+	}
+	return t.raw
+}
+
+// Expand substitutes captures into the template.
+func (t *UriTemplate) Expand(captures []string) (string, error) {
+	var buf strings.Builder
+	for _, segment := range t.segments {
+		if segment.capture == 0 {
+			buf.WriteString(segment.literal)
+			continue
+		}
+		if segment.capture > len(captures) {
+			return "", fmt.Errorf("URI template '%s' references capture %d of %d", t.raw, segment.capture, len(captures))
+		}
+		buf.WriteString(captures[segment.capture-1])
+	}
+	return buf.String(), nil
+}
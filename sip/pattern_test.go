@@ -0,0 +1,73 @@
+package sip_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestUriPatternMatch(t *testing.T) {
+	uri := func(scheme, user, host string) sip.Uri {
+		u := &sip.SipUri{FIsEncrypted: scheme == "sips", FHost: host}
+		if user != "" {
+			u.FUser = sip.String{Str: user}
+		}
+		return u
+	}
+
+	cases := []struct {
+		pattern  string
+		uri      sip.Uri
+		captures []string
+		ok       bool
+	}{
+		{"*", uri("sip", "", "example.com"), []string{"", "example.com"}, true},
+		{"sip:+1555*@*.example.com", uri("sip", "+15551234", "eu.Example.com"), []string{"1234", "eu"}, true},
+		{"sip:+1555*@*.example.com", uri("sip", "+15551234", "example.com"), nil, false},
+		{"sip:+1555*@*.example.com", uri("sips", "+15551234", "eu.example.com"), nil, false},
+		{"+1555*@*.example.com", uri("sips", "+15551234", "eu.example.com"), []string{"1234", "eu"}, true},
+		{"sip:bob@example.com", uri("sip", "bob", "EXAMPLE.com"), []string{}, true},
+		{"sip:bob@example.com", uri("sip", "Bob", "example.com"), nil, false},
+		{"example.com", uri("sip", "", "example.com"), []string{""}, true},
+		{"sip:*-*@gw*", uri("sip", "a-b-c", "gw1"), []string{"a", "b-c", "1"}, true},
+	}
+
+	for _, c := range cases {
+		captures, ok := sip.MustCompileUriPattern(c.pattern).Match(c.uri)
+		if ok != c.ok || c.ok && !reflect.DeepEqual(captures, c.captures) {
+			t.Errorf("pattern %s, URI %s: expected %v %q, got %v %q", c.pattern, c.uri, c.ok, c.captures, ok, captures)
+		}
+	}
+
+	for _, pattern := range []string{"", "sip:", "sip:@", "sip:bob@"} {
+		if _, err := sip.CompileUriPattern(pattern); err == nil {
+			t.Errorf("expected error for pattern '%s'", pattern)
+		}
+	}
+}
+
+func TestUriTemplateExpand(t *testing.T) {
+	captures, ok := sip.MustCompileUriPattern("sip:+1555*@*.example.com").
+		Match(&sip.SipUri{FUser: sip.String{Str: "+15551234"}, FHost: "eu.example.com"})
+	if !ok {
+		t.Fatal("expected match")
+	}
+
+	target, err := sip.MustCompileUriTemplate("sip:${1}@$2.gw.example.com;cost=$$1").Expand(captures)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if target != "sip:1234@eu.gw.example.com;cost=$1" {
+		t.Errorf("unexpected target: %s", target)
+	}
+
+	if _, err := sip.MustCompileUriTemplate("sip:$3@example.com").Expand(captures); err == nil {
+		t.Error("expected error for missing capture")
+	}
+	for _, template := range []string{"sip:$", "sip:${1", "sip:$x", "sip:${0}"} {
+		if _, err := sip.CompileUriTemplate(template); err == nil {
+			t.Errorf("expected error for template '%s'", template)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package sip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghettovoice/gosip/log"
+)
+
+// RSeq returns value of the 'RSeq' header of the response.
+func RSeq(res Response) (uint32, bool) {
+	hdrs := res.GetHeaders("RSeq")
+	if len(hdrs) == 0 {
+		return 0, false
+	}
+
+	rseq, err := strconv.ParseUint(strings.TrimSpace(hdrs[0].Value()), 10, 32)
+	if err != nil || rseq == 0 {
+		return 0, false
+	}
+	return uint32(rseq), true
+}
+
+// RAck returns values of the 'RAck' header of the PRACK request.
+func RAck(req Request) (rseq uint32, cseq uint32, method RequestMethod, ok bool) {
+	hdrs := req.GetHeaders("RAck")
+	if len(hdrs) == 0 {
+		return 0, 0, "", false
+	}
+
+	parts := strings.Fields(hdrs[0].Value())
+	if len(parts) != 3 {
+		return 0, 0, "", false
+	}
+	r, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	c, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, "", false
+	}
+
+	return uint32(r), uint32(c), RequestMethod(TokenUpper(parts[2])), true
+}
+
+// RequiresReliable checks that the provisional response requires reliable delivery with '100rel' option tag.
+func RequiresReliable(res Response) bool {
+	if !res.IsProvisional() || res.StatusCode() == 100 {
+		return false
+	}
+
+	for _, hdr := range res.GetHeaders("Require") {
+		if require, ok := hdr.(*RequireHeader); ok && HasToken(require.Options, Option100rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsReliableProvisional checks that the response is a reliable provisional response:
+// 101-199 with '100rel' in the 'Require' header and 'RSeq' header - RFC 3262 3.
+func IsReliableProvisional(res Response) bool {
+	if !RequiresReliable(res) {
+		return false
+	}
+	_, ok := RSeq(res)
+	return ok
+}
+
+// SetRSeq makes the provisional response reliable with the given response sequence number.
+func SetRSeq(res Response, rseq uint32) {
+	if !RequiresReliable(res) {
+		res.AppendHeader(&RequireHeader{Options: []string{Option100rel}})
+	}
+	res.RemoveHeader("RSeq")
+	res.AppendHeader(&GenericHeader{
+		HeaderName: "RSeq",
+		Contents:   strconv.FormatUint(uint64(rseq), 10),
+	})
+}
+
+// NewPrackRequest creates PRACK request acknowledging the reliable provisional response on INVITE - RFC 3262 7.2.
+// PRACK is sent within the early dialog, seq is its CSeq number that must be greater than INVITE one.
+func NewPrackRequest(
+	prackID MessageID,
+	inviteRequest Request,
+	inviteResponse Response,
+	seq uint32,
+	fields log.Fields,
+) (Request, error) {
+	rseq, ok := RSeq(inviteResponse)
+	if !ok {
+		return nil, fmt.Errorf("missing RSeq header in %s", inviteResponse.Short())
+	}
+	inviteCSeq, ok := inviteRequest.CSeq()
+	if !ok {
+		return nil, fmt.Errorf("missing CSeq header in %s", inviteRequest.Short())
+	}
+
+	recipient := inviteRequest.Recipient()
+	if contact, ok := inviteResponse.Contact(); ok {
+		recipient = contact.Address
+	}
+	prackRequest := NewRequest(
+		prackID,
+		PRACK,
+		recipient,
+		inviteRequest.SipVersion(),
+		[]Header{},
+		"",
+		inviteRequest.Fields().
+			WithFields(fields).
+			WithFields(log.Fields{
+				"invite_request_id":  inviteRequest.MessageID(),
+				"invite_response_id": inviteResponse.MessageID(),
+			}),
+	)
+
+	// PRACK is a separate Tx
+	CopyHeaders("Via", inviteRequest, prackRequest)
+	if viaHop, ok := prackRequest.ViaHop(); ok {
+		viaHop.Params.Add("branch", String{Str: GenerateBranch()})
+	}
+
+	if routes := reverseUris(RecordRoutes(inviteResponse)); len(routes) > 0 {
+		prackRequest.AppendHeader(&RouteHeader{Addresses: routes})
+	} else {
+		CopyHeaders("Route", inviteRequest, prackRequest)
+	}
+
+	maxForwardsHeader := MaxForwards(70)
+	prackRequest.AppendHeader(&maxForwardsHeader)
+	CopyHeaders("From", inviteRequest, prackRequest)
+	CopyHeaders("To", inviteResponse, prackRequest)
+	CopyHeaders("Call-ID", inviteRequest, prackRequest)
+	prackRequest.AppendHeader(&CSeq{SeqNo: seq, MethodName: PRACK})
+	prackRequest.AppendHeader(&GenericHeader{
+		HeaderName: "RAck",
+		Contents:   fmt.Sprintf("%d %d %s", rseq, inviteCSeq.SeqNo, inviteCSeq.MethodName),
+	})
+
+	prackRequest.SetBody("", true)
+	prackRequest.SetTransport(inviteRequest.Transport())
+	prackRequest.SetSource(inviteRequest.Source())
+	prackRequest.SetDestination(inviteRequest.Destination())
+
+	return prackRequest, nil
+}
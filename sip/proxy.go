@@ -0,0 +1,416 @@
+package sip
+
+import (
+	"errors"
+	"sync"
+)
+
+// ForkingPolicy defines how ProxyContext forwards the request to the targets of the target set - RFC 3261 16.6.
+type ForkingPolicy int
+
+const (
+	// ForkParallel forwards the request to all targets with the highest q-value at once,
+	// targets with lower q-values are tried after all branches of the previous group fail.
+	ForkParallel ForkingPolicy = iota
+	// ForkSequential forwards the request to one target at a time in order of preference.
+	ForkSequential
+)
+
+// ProxyContext is a stateful proxy processing of a single request - RFC 3261 16.
+// It forwards the request received in the server transaction to the targets of the target set
+// in client transactions, one per target, and aggregates their responses - RFC 3261 16.7:
+// provisional and 2xx responses are forwarded immediately, the best of other final responses
+// is forwarded when all branches are completed. Pending branches are canceled on 2xx, 6xx and
+// CANCEL of the original request, the CANCEL is answered by the context.
+// Handlers running the proxy context should be registered with forwarding handler option,
+// so requests with zero 'Max-Forwards' are rejected before the context is created.
+type ProxyContext struct {
+	// Forking is the forking policy, ForkParallel by default.
+	Forking ForkingPolicy
+	// Via is the sent-by of the proxy inserted into forwarded requests with a new branch - RFC 3261 16.6 step 8.
+	Via ViaHop
+	// MaxForwards is inserted into forwarded requests without 'Max-Forwards', DefaultMaxForwards if zero.
+	MaxForwards MaxForwards
+	// Recurse adds contacts of 3xx responses to the target set instead of storing the responses - RFC 3261 16.5.
+	Recurse bool
+	// Prepare is called with the forwarded copy of the request before it is sent to the target,
+	// e.g. to insert 'Record-Route' or set the destination of the outbound proxy.
+	Prepare func(req Request, target *Target)
+
+	txl     TransactionLayer
+	req     Request
+	tx      ServerTransaction
+	targets *TargetSet
+
+	mu        sync.Mutex
+	branches  []*proxyBranch
+	responses []Response
+	final     Response
+	answered  bool
+	stopped   bool
+	events    chan proxyEvent
+	done      chan struct{}
+}
+
+type proxyBranch struct {
+	target *Target
+	req    Request
+	tx     ClientTransaction
+	final  Response
+}
+
+// Response of the branch, nil if the transaction is terminated.
+type proxyEvent struct {
+	branch *proxyBranch
+	res    Response
+}
+
+// NewProxyContext creates proxy context of the request received in the server transaction,
+// the request is forwarded through the transaction layer to the targets of the set.
+func NewProxyContext(txl TransactionLayer, req Request, tx ServerTransaction, targets *TargetSet) *ProxyContext {
+	return &ProxyContext{
+		txl:     txl,
+		req:     req,
+		tx:      tx,
+		targets: targets,
+		events:  make(chan proxyEvent),
+		done:    make(chan struct{}),
+	}
+}
+
+// Run forwards the request and blocks until the final response is forwarded upstream,
+// the response is returned with the error of sending it.
+// The request with zero 'Max-Forwards' is answered with '483 Too Many Hops' - RFC 3261 16.3 step 2,
+// the request without targets with '480 Temporarily Unavailable' - RFC 3261 16.6.
+// 2xx responses of other branches received after Run returns are still forwarded.
+func (p *ProxyContext) Run() (Response, error) {
+	defer close(p.done)
+
+	if IsTooManyHops(p.req) {
+		return p.respond(NewResponseFromRequest("", p.req, 483, "Too Many Hops", ""))
+	}
+
+	var (
+		pending int
+		cancels = p.tx.Cancels()
+	)
+	for {
+		if pending == 0 {
+			if p.isStopped() {
+				break
+			}
+			targets := p.nextTargets()
+			if len(targets) == 0 {
+				break
+			}
+			for _, target := range targets {
+				if p.fork(target) {
+					pending++
+				}
+			}
+			continue
+		}
+
+		select {
+		case ev := <-p.events:
+			if p.handle(ev) {
+				pending--
+			}
+		case cancel, ok := <-cancels:
+			if !ok {
+				cancels = nil
+				continue
+			}
+			// RFC 3261 16.10
+			_ = p.tx.Respond(NewResponseFromRequest("", cancel, 200, "OK", ""))
+			p.stop()
+		}
+	}
+
+	p.mu.Lock()
+	final := p.final
+	p.mu.Unlock()
+	if final != nil {
+		return final, nil
+	}
+
+	final = BestResponse(p.responses)
+	if final == nil {
+		if p.targets.Len() == 0 && len(p.branches) == 0 {
+			final = NewResponseFromRequest("", p.req, 480, "Temporarily Unavailable", "")
+		} else {
+			final = NewResponseFromRequest("", p.req, 408, "Request Timeout", "")
+		}
+	}
+	return p.respond(final)
+}
+
+// Cancel stops forking and cancels pending branches, e.g. when the proxy gives up on timeout.
+// The best response of completed branches is forwarded when the pending ones are completed.
+func (p *ProxyContext) Cancel() {
+	p.stop()
+}
+
+func (p *ProxyContext) nextTargets() []*Target {
+	if p.Forking == ForkSequential {
+		if target, ok := p.targets.Next(); ok {
+			return []*Target{target}
+		}
+		return nil
+	}
+	return p.targets.NextGroup()
+}
+
+// Forwards the request to the target in a new client transaction - RFC 3261 16.6.
+// Returns false if the transaction can't be created, then '503 Service Unavailable' is stored - RFC 3261 16.9.
+func (p *ProxyContext) fork(target *Target) bool {
+	req := CopyRequest(p.req)
+	req.SetRecipient(target.Uri.Clone())
+	req.SetSource("")
+	req.SetDestination("")
+	maxForwards := p.MaxForwards
+	if maxForwards == 0 {
+		maxForwards = DefaultMaxForwards
+	}
+	DecrementMaxForwards(req, maxForwards)
+
+	via := p.Via.Clone()
+	if via.Params == nil {
+		via.Params = NewParams()
+	}
+	via.Params.Add("branch", String{Str: GenerateBranch()})
+	req.PrependHeader(ViaHeader{via})
+
+	if p.Prepare != nil {
+		p.Prepare(req, target)
+	}
+
+	branch := &proxyBranch{target: target, req: req}
+	tx, err := p.txl.Request(req)
+	if err != nil {
+		p.store(NewResponseFromRequest("", req, 503, "Service Unavailable", ""))
+		return false
+	}
+	branch.tx = tx
+
+	p.mu.Lock()
+	p.branches = append(p.branches, branch)
+	p.mu.Unlock()
+
+	go p.serve(branch)
+
+	return true
+}
+
+// Passes responses and errors of the branch transaction to the context.
+func (p *ProxyContext) serve(branch *proxyBranch) {
+	responses := branch.tx.Responses()
+	errs := branch.tx.Errors()
+	for responses != nil || errs != nil {
+		select {
+		case res, ok := <-responses:
+			if !ok {
+				responses = nil
+				continue
+			}
+			p.post(branch, res)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			// RFC 3261 16.7 step 2, 16.9
+			var txErr interface{ Timeout() bool }
+			if errors.As(err, &txErr) && txErr.Timeout() {
+				p.post(branch, NewResponseFromRequest("", branch.req, 408, "Request Timeout", ""))
+			} else {
+				p.post(branch, NewResponseFromRequest("", branch.req, 503, "Service Unavailable", ""))
+			}
+		}
+	}
+	p.post(branch, nil)
+}
+
+func (p *ProxyContext) post(branch *proxyBranch, res Response) {
+	select {
+	case p.events <- proxyEvent{branch, res}:
+	case <-p.done:
+		// late 2xx of forked INVITE - RFC 3261 16.7 step 5
+		if res != nil && res.IsSuccess() && p.req.IsInvite() {
+			_, _ = p.relay(res)
+		}
+	}
+}
+
+// Processes response of the branch - RFC 3261 16.7, returns true when the branch is completed.
+func (p *ProxyContext) handle(ev proxyEvent) bool {
+	branch, res := ev.branch, ev.res
+	p.mu.Lock()
+	completed := branch.final != nil
+	p.mu.Unlock()
+	if completed {
+		if res != nil && res.IsSuccess() && p.req.IsInvite() {
+			_, _ = p.relay(res)
+		}
+		return false
+	}
+	if res == nil {
+		// terminated without the final response
+		res = NewResponseFromRequest("", branch.req, 408, "Request Timeout", "")
+	}
+
+	switch {
+	case res.StatusCode() == 100:
+		return false
+	case res.IsProvisional():
+		if !p.isAnswered() {
+			_, _ = p.relay(res)
+		}
+		return false
+	}
+
+	p.mu.Lock()
+	branch.final = res
+	first := res.IsSuccess() && !p.answered
+	if res.IsSuccess() {
+		p.answered = true
+	}
+	p.mu.Unlock()
+
+	switch {
+	case res.IsSuccess():
+		final, _ := p.relay(res)
+		if first {
+			p.mu.Lock()
+			p.final = final
+			p.mu.Unlock()
+		}
+		p.stop()
+	case res.IsGlobalError():
+		p.store(res)
+		p.stop()
+	case res.IsRedirection() && p.Recurse && !p.isStopped():
+		if p.targets.AddResponse(res) == 0 {
+			p.store(res)
+		}
+	default:
+		p.store(res)
+	}
+
+	return true
+}
+
+// Stores copy of the final response in the response context without the proxy Via - RFC 3261 16.7 step 3.
+func (p *ProxyContext) store(res Response) {
+	res = CopyResponse(res)
+	removeTopVia(res)
+	p.responses = append(p.responses, res)
+}
+
+func (p *ProxyContext) isAnswered() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.answered
+}
+
+func (p *ProxyContext) isStopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stopped
+}
+
+// Stops forking and cancels pending INVITE branches - RFC 3261 16.7 step 10.
+func (p *ProxyContext) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	pending := make([]*proxyBranch, 0, len(p.branches))
+	for _, branch := range p.branches {
+		if branch.final == nil {
+			pending = append(pending, branch)
+		}
+	}
+	p.mu.Unlock()
+
+	if !p.req.IsInvite() {
+		return
+	}
+	for _, branch := range pending {
+		_ = branch.tx.Cancel()
+	}
+}
+
+// Forwards response of the branch upstream without the proxy Via - RFC 3261 16.7 step 9.
+func (p *ProxyContext) relay(res Response) (Response, error) {
+	res = CopyResponse(res)
+	removeTopVia(res)
+	return p.respond(res)
+}
+
+// Sends the response through the server transaction.
+func (p *ProxyContext) respond(res Response) (Response, error) {
+	res.SetSource(p.req.Destination())
+	res.SetDestination(p.req.Source())
+	res.SetTransport(p.req.Transport())
+
+	return res, p.tx.Respond(res)
+}
+
+// BestResponse selects the final response forwarded upstream when no branch of the proxy answered
+// with 2xx - RFC 3261 16.7 step 6: 6xx if any, otherwise the response of the lowest class.
+// '503 Service Unavailable' is replaced with '500 Server Internal Error', challenges of all 401 and 407
+// responses are collected into the selected 401 or 407 one - RFC 3261 16.7 step 7.
+// Returns nil if there are no responses, the responses are not modified.
+func BestResponse(responses []Response) Response {
+	selected := -1
+	for i, res := range responses {
+		switch {
+		case selected == -1:
+			selected = i
+		case responses[selected].IsGlobalError():
+		case res.IsGlobalError() || res.StatusCode()/100 < responses[selected].StatusCode()/100:
+			selected = i
+		}
+	}
+	if selected == -1 {
+		return nil
+	}
+
+	best := CopyResponse(responses[selected])
+	switch best.StatusCode() {
+	case 503:
+		best.SetStatusCode(500)
+		best.SetReason("Server Internal Error")
+	case 401, 407:
+		for i, res := range responses {
+			if i == selected || res.StatusCode() != 401 && res.StatusCode() != 407 {
+				continue
+			}
+			for _, name := range []string{"WWW-Authenticate", "Proxy-Authenticate"} {
+				for _, hdr := range res.GetHeaders(name) {
+					best.AppendHeader(hdr.Clone())
+				}
+			}
+		}
+	}
+	return best
+}
+
+// Removes the topmost Via hop of the message.
+func removeTopVia(msg Message) {
+	hdrs := msg.GetHeaders("Via")
+	if len(hdrs) == 0 {
+		return
+	}
+
+	rest := hdrs[1:]
+	if via, ok := hdrs[0].(ViaHeader); ok && len(via) > 1 {
+		rest = append([]Header{via[1:]}, rest...)
+	}
+	if len(rest) == 0 {
+		msg.RemoveHeader("Via")
+	} else {
+		msg.ReplaceHeaders("Via", rest)
+	}
+}
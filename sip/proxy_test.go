@@ -0,0 +1,298 @@
+package sip_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+type fakeClientTx struct {
+	req       sip.Request
+	responses chan sip.Response
+	errs      chan error
+	canceled  chan struct{}
+	once      sync.Once
+}
+
+func (tx *fakeClientTx) Origin() sip.Request            { return tx.req }
+func (tx *fakeClientTx) Key() sip.TransactionKey        { return "" }
+func (tx *fakeClientTx) String() string                 { return "fakeClientTx" }
+func (tx *fakeClientTx) Errors() <-chan error           { return tx.errs }
+func (tx *fakeClientTx) Done() <-chan bool              { return nil }
+func (tx *fakeClientTx) Responses() <-chan sip.Response { return tx.responses }
+func (tx *fakeClientTx) OnAck(fn func(sip.Request))     {}
+func (tx *fakeClientTx) OnCancel(fn func(sip.Request))  {}
+func (tx *fakeClientTx) Cancel() error {
+	tx.once.Do(func() { close(tx.canceled) })
+	return nil
+}
+
+// Answers the forwarded request with the status, the final response terminates the transaction.
+func (tx *fakeClientTx) answer(t *testing.T, code sip.StatusCode, reason string, headers ...sip.Header) {
+	res := sip.NewResponseFromRequest("", tx.req, code, reason, "")
+	for _, hdr := range headers {
+		res.AppendHeader(hdr)
+	}
+	tx.responses <- res
+	if code >= 200 {
+		close(tx.responses)
+		close(tx.errs)
+	}
+}
+
+type fakeServerTx struct {
+	req       sip.Request
+	mu        sync.Mutex
+	responses []sip.Response
+	cancels   chan sip.Request
+}
+
+func (tx *fakeServerTx) Origin() sip.Request         { return tx.req }
+func (tx *fakeServerTx) Key() sip.TransactionKey     { return "" }
+func (tx *fakeServerTx) String() string              { return "fakeServerTx" }
+func (tx *fakeServerTx) Errors() <-chan error        { return nil }
+func (tx *fakeServerTx) Done() <-chan bool           { return nil }
+func (tx *fakeServerTx) Acks() <-chan sip.Request    { return nil }
+func (tx *fakeServerTx) Cancels() <-chan sip.Request { return tx.cancels }
+func (tx *fakeServerTx) Respond(res sip.Response) error {
+	tx.mu.Lock()
+	tx.responses = append(tx.responses, res)
+	tx.mu.Unlock()
+	return nil
+}
+
+func (tx *fakeServerTx) statuses() []sip.StatusCode {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	codes := make([]sip.StatusCode, 0, len(tx.responses))
+	for _, res := range tx.responses {
+		codes = append(codes, res.StatusCode())
+	}
+	return codes
+}
+
+// Waits until the number of responses forwarded upstream reaches n.
+func (tx *fakeServerTx) waitStatuses(t *testing.T, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for len(tx.statuses()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d responses forwarded, got %v", n, tx.statuses())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type fakeTxLayer struct {
+	sip.TransactionLayer
+	requests chan *fakeClientTx
+}
+
+func (txl *fakeTxLayer) Request(req sip.Request) (sip.ClientTransaction, error) {
+	tx := &fakeClientTx{
+		req:       req,
+		responses: make(chan sip.Response, 4),
+		errs:      make(chan error, 1),
+		canceled:  make(chan struct{}),
+	}
+	txl.requests <- tx
+	return tx, nil
+}
+
+func proxyTargets(t *testing.T, contacts ...string) *sip.TargetSet {
+	targets := sip.NewTargetSet()
+	for _, contact := range contacts {
+		uri, err := parser.ParseUri(contact)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		targets.AddUri(uri, sip.DefaultTargetQ)
+	}
+	return targets
+}
+
+func newProxyContext(t *testing.T, targets *sip.TargetSet) (*sip.ProxyContext, *fakeTxLayer, *fakeServerTx) {
+	txl := &fakeTxLayer{requests: make(chan *fakeClientTx, 4)}
+	tx := &fakeServerTx{req: dialogInvite(t), cancels: make(chan sip.Request, 1)}
+	proxy := sip.NewProxyContext(txl, tx.req, tx, targets)
+	port := sip.Port(5060)
+	proxy.Via = sip.ViaHop{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       "UDP",
+		Host:            "proxy.biloxi.com",
+		Port:            &port,
+	}
+	return proxy, txl, tx
+}
+
+func runProxy(proxy *sip.ProxyContext) chan sip.Response {
+	final := make(chan sip.Response, 1)
+	go func() {
+		res, _ := proxy.Run()
+		final <- res
+	}()
+	return final
+}
+
+func nextBranch(t *testing.T, txl *fakeTxLayer) *fakeClientTx {
+	t.Helper()
+
+	select {
+	case tx := <-txl.requests:
+		return tx
+	case <-time.After(time.Second):
+		t.Fatal("request is not forwarded")
+		return nil
+	}
+}
+
+func TestProxyContextParallel(t *testing.T) {
+	proxy, txl, tx := newProxyContext(t, proxyTargets(t, "sip:bob@192.0.2.4", "sip:bob@192.0.2.5"))
+	final := runProxy(proxy)
+
+	first, second := nextBranch(t, txl), nextBranch(t, txl)
+	if first.req.Recipient().Host() != "192.0.2.4" || second.req.Recipient().Host() != "192.0.2.5" {
+		t.Fatalf("unexpected branches %s, %s", first.req.Recipient(), second.req.Recipient())
+	}
+	if via, _ := first.req.ViaHop(); via.Host != "proxy.biloxi.com" {
+		t.Errorf("expected proxy Via on top, got %s", via)
+	}
+	if maxForwards, ok := sip.GetMaxForwards(first.req); !ok || maxForwards != sip.DefaultMaxForwards {
+		t.Errorf("unexpected Max-Forwards %v", maxForwards)
+	}
+
+	first.answer(t, 100, "Trying")
+	first.answer(t, 180, "Ringing")
+	tx.waitStatuses(t, 1)
+	second.answer(t, 200, "OK")
+
+	select {
+	case <-first.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("losing branch is not canceled")
+	}
+	first.answer(t, 487, "Request Terminated")
+
+	res := <-final
+	if res.StatusCode() != 200 {
+		t.Fatalf("expected 200 forwarded, got %s", res.Short())
+	}
+	if via, _ := res.ViaHop(); via.Host != "pc33.atlanta.com" {
+		t.Errorf("proxy Via must be removed from forwarded response, got %s", via)
+	}
+	if codes := tx.statuses(); len(codes) != 2 || codes[0] != 180 || codes[1] != 200 {
+		t.Errorf("expected 180 and 200 forwarded, got %v", codes)
+	}
+}
+
+func TestProxyContextSequential(t *testing.T) {
+	targets := proxyTargets(t, "sip:bob@192.0.2.4")
+	uri, _ := parser.ParseUri("sip:bob@192.0.2.5")
+	targets.AddUri(uri, 0.5)
+
+	proxy, txl, tx := newProxyContext(t, targets)
+	proxy.Forking = sip.ForkSequential
+	final := runProxy(proxy)
+
+	nextBranch(t, txl).answer(t, 480, "Temporarily Unavailable")
+	second := nextBranch(t, txl)
+	if second.req.Recipient().Host() != "192.0.2.5" {
+		t.Fatalf("unexpected second branch %s", second.req.Recipient())
+	}
+	second.answer(t, 486, "Busy Here")
+
+	if res := <-final; res.StatusCode() != 480 {
+		t.Fatalf("expected the first stored 4xx forwarded, got %s", res.Short())
+	}
+	if codes := tx.statuses(); len(codes) != 1 {
+		t.Errorf("expected single final response forwarded, got %v", codes)
+	}
+}
+
+func TestProxyContextCancel(t *testing.T) {
+	proxy, txl, tx := newProxyContext(t, proxyTargets(t, "sip:bob@192.0.2.4"))
+	final := runProxy(proxy)
+
+	branch := nextBranch(t, txl)
+	branch.answer(t, 180, "Ringing")
+	tx.waitStatuses(t, 1)
+	tx.cancels <- parseDialogMessage(t,
+		"CANCEL sip:bob@biloxi.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 314159 CANCEL",
+	).(sip.Request)
+
+	select {
+	case <-branch.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("branch is not canceled")
+	}
+	branch.answer(t, 487, "Request Terminated")
+
+	if res := <-final; res.StatusCode() != 487 {
+		t.Fatalf("expected 487 forwarded, got %s", res.Short())
+	}
+	if codes := tx.statuses(); len(codes) != 3 || codes[1] != 200 {
+		t.Errorf("expected 180, 200 on CANCEL and 487, got %v", codes)
+	}
+}
+
+func TestProxyContextTooManyHops(t *testing.T) {
+	proxy, txl, tx := newProxyContext(t, proxyTargets(t, "sip:bob@192.0.2.4"))
+	sip.SetMaxForwards(tx.req, 0)
+
+	if res, _ := proxy.Run(); res.StatusCode() != 483 {
+		t.Fatalf("expected 483, got %s", res.Short())
+	}
+	if len(txl.requests) != 0 {
+		t.Error("request must not be forwarded")
+	}
+}
+
+func TestBestResponse(t *testing.T) {
+	response := func(status string, headers ...string) sip.Response {
+		return parseDialogMessage(t, append([]string{
+			"SIP/2.0 " + status,
+			"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+			"From: <sip:alice@atlanta.com>;tag=1928301774",
+			"To: <sip:bob@biloxi.com>;tag=a6c85cf",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 314159 INVITE",
+		}, headers...)...).(sip.Response)
+	}
+
+	cases := []struct {
+		name      string
+		responses []sip.Response
+		expected  sip.StatusCode
+	}{
+		{"lowest class", []sip.Response{response("503 Service Unavailable"), response("486 Busy Here"), response("302 Moved")}, 302},
+		{"global error", []sip.Response{response("302 Moved"), response("603 Decline"), response("486 Busy Here")}, 603},
+		{"503 replaced", []sip.Response{response("503 Service Unavailable")}, 500},
+	}
+	for _, c := range cases {
+		if best := sip.BestResponse(c.responses); best == nil || best.StatusCode() != c.expected {
+			t.Errorf("%s: expected %d, got %v", c.name, c.expected, best)
+		}
+	}
+
+	best := sip.BestResponse([]sip.Response{
+		response("401 Unauthorized", `WWW-Authenticate: Digest realm="atlanta.com", nonce="1"`),
+		response("407 Proxy Authentication Required", `Proxy-Authenticate: Digest realm="biloxi.com", nonce="2"`),
+	})
+	if best.StatusCode() != 401 || len(best.GetHeaders("WWW-Authenticate")) != 1 || len(best.GetHeaders("Proxy-Authenticate")) != 1 {
+		t.Errorf("expected 401 with collected challenges, got\n%s", best)
+	}
+	if sip.BestResponse(nil) != nil {
+		t.Error("expected nil on empty responses")
+	}
+}
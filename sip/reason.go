@@ -0,0 +1,104 @@
+package sip
+
+// ReasonCatalog maps status codes to reason phrases, e.g. localized ones.
+type ReasonCatalog map[StatusCode]string
+
+// DefaultReasons is a catalog of reason phrases recommended by RFC 3261 21 and its extensions.
+var DefaultReasons = ReasonCatalog{
+	StatusTrying:                "Trying",
+	StatusRinging:               "Ringing",
+	StatusCallIsBeingForwarded:  "Call Is Being Forwarded",
+	StatusQueued:                "Queued",
+	StatusSessionProgress:       "Session Progress",
+	StatusEarlyDialogTerminated: "Early Dialog Terminated",
+
+	StatusOK:             "OK",
+	StatusAccepted:       "Accepted",
+	StatusNoNotification: "No Notification",
+
+	StatusMultipleChoices:    "Multiple Choices",
+	StatusMovedPermanently:   "Moved Permanently",
+	StatusMovedTemporarily:   "Moved Temporarily",
+	StatusUseProxy:           "Use Proxy",
+	StatusAlternativeService: "Alternative Service",
+
+	StatusBadRequest:                   "Bad Request",
+	StatusUnauthorized:                 "Unauthorized",
+	StatusPaymentRequired:              "Payment Required",
+	StatusForbidden:                    "Forbidden",
+	StatusNotFound:                     "Not Found",
+	StatusMethodNotAllowed:             "Method Not Allowed",
+	StatusNotAcceptable:                "Not Acceptable",
+	StatusProxyAuthenticationRequired:  "Proxy Authentication Required",
+	StatusRequestTimeout:               "Request Timeout",
+	StatusGone:                         "Gone",
+	StatusConditionalRequestFailed:     "Conditional Request Failed",
+	StatusRequestEntityTooLarge:        "Request Entity Too Large",
+	StatusRequestURITooLong:            "Request-URI Too Long",
+	StatusUnsupportedMediaType:         "Unsupported Media Type",
+	StatusUnsupportedURIScheme:         "Unsupported URI Scheme",
+	StatusUnknownResourcePriority:      "Unknown Resource-Priority",
+	StatusBadExtension:                 "Bad Extension",
+	StatusExtensionRequired:            "Extension Required",
+	StatusSessionIntervalTooSmall:      "Session Interval Too Small",
+	StatusIntervalTooBrief:             "Interval Too Brief",
+	StatusUseIdentityHeader:            "Use Identity Header",
+	StatusProvideReferrerIdentity:      "Provide Referrer Identity",
+	StatusFlowFailed:                   "Flow Failed",
+	StatusAnonymityDisallowed:          "Anonymity Disallowed",
+	StatusBadIdentityInfo:              "Bad Identity-Info",
+	StatusUnsupportedCertificate:       "Unsupported Certificate",
+	StatusInvalidIdentityHeader:        "Invalid Identity Header",
+	StatusFirstHopLacksOutboundSupport: "First Hop Lacks Outbound Support",
+	StatusMaxBreadthExceeded:           "Max-Breadth Exceeded",
+	StatusBadInfoPackage:               "Bad Info Package",
+	StatusConsentNeeded:                "Consent Needed",
+	StatusTemporarilyUnavailable:       "Temporarily Unavailable",
+	StatusCallTransactionDoesNotExist:  "Call/Transaction Does Not Exist",
+	StatusLoopDetected:                 "Loop Detected",
+	StatusTooManyHops:                  "Too Many Hops",
+	StatusAddressIncomplete:            "Address Incomplete",
+	StatusAmbiguous:                    "Ambiguous",
+	StatusBusyHere:                     "Busy Here",
+	StatusRequestTerminated:            "Request Terminated",
+	StatusNotAcceptableHere:            "Not Acceptable Here",
+	StatusBadEvent:                     "Bad Event",
+	StatusRequestPending:               "Request Pending",
+	StatusUndecipherable:               "Undecipherable",
+	StatusSecurityAgreementRequired:    "Security Agreement Required",
+
+	StatusServerInternalError:                 "Server Internal Error",
+	StatusNotImplemented:                      "Not Implemented",
+	StatusBadGateway:                          "Bad Gateway",
+	StatusServiceUnavailable:                  "Service Unavailable",
+	StatusServerTimeout:                       "Server Time-out",
+	StatusVersionNotSupported:                 "Version Not Supported",
+	StatusMessageTooLarge:                     "Message Too Large",
+	StatusPushNotificationServiceNotSupported: "Push Notification Service Not Supported",
+	StatusPreconditionFailure:                 "Precondition Failure",
+
+	StatusBusyEverywhere:        "Busy Everywhere",
+	StatusDecline:               "Decline",
+	StatusDoesNotExistAnywhere:  "Does Not Exist Anywhere",
+	StatusNotAcceptableAnywhere: "Not Acceptable",
+	StatusUnwanted:              "Unwanted",
+	StatusRejected:              "Rejected",
+}
+
+// Reason returns reason phrase of the status code from the catalog.
+// If the catalog has no phrase for the code, then the default phrase is returned,
+// and then the default phrase of the status code class (e.g. "Bad Request" for unknown 4xx).
+func (catalog ReasonCatalog) Reason(code StatusCode) string {
+	if reason, ok := catalog[code]; ok {
+		return reason
+	}
+	if reason, ok := DefaultReasons[code]; ok {
+		return reason
+	}
+	return DefaultReasons[code/100*100]
+}
+
+// ReasonPhrase returns default reason phrase of the status code.
+func ReasonPhrase(code StatusCode) string {
+	return DefaultReasons.Reason(code)
+}
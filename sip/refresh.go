@@ -0,0 +1,122 @@
+package sip
+
+import (
+	"strings"
+)
+
+// SessionDescriptionUnchanged checks that the session description is semantically the same as the previous one.
+// Descriptions with the same origin ('o=' line) are the same if the session version is not changed - RFC 3264 8.
+// Descriptions without origin are compared line by line ignoring line endings and blank lines.
+func SessionDescriptionUnchanged(prev, next string) bool {
+	prevLines, nextLines := sdpLines(prev), sdpLines(next)
+	prevOrigin, prevOk := sdpOrigin(prevLines)
+	nextOrigin, nextOk := sdpOrigin(nextLines)
+	if prevOk && nextOk {
+		return prevOrigin == nextOrigin
+	}
+
+	if len(prevLines) != len(nextLines) {
+		return false
+	}
+	for i := range prevLines {
+		if prevLines[i] != nextLines[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sdpLines(sdp string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(sdp, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Returns 'o=' line fields normalized by whitespace.
+func sdpOrigin(lines []string) (string, bool) {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "o=") {
+			return strings.Join(strings.Fields(line[2:]), " "), true
+		}
+	}
+	return "", false
+}
+
+// OnSessionRefresh registers callback that is called when re-INVITE or UPDATE that doesn't change
+// the session is accepted by AcceptSessionRefresh, e.g. to reset session timers - RFC 4028.
+func (dlg *Dialog) OnSessionRefresh(fn func(req Request)) {
+	dlg.mu.Lock()
+	dlg.onRefreshFns = append(dlg.onRefreshFns, fn)
+	dlg.mu.Unlock()
+}
+
+// AcceptSessionRefresh accepts re-INVITE or UPDATE request that only refreshes the session:
+// without body or with the session description unchanged since the last exchange.
+// The request is received by the dialog, 200 OK with the previous local session description
+// is built and registered in the dialog, OnSessionRefresh callbacks are called.
+// The returned response must be sent by the server transaction of the request.
+// ok is false if the request changes the session, then the dialog is not changed
+// and the request must be handled by the application.
+// err is returned if the dialog rejects the request, e.g. DialogError with the status code to respond with.
+func (dlg *Dialog) AcceptSessionRefresh(req Request) (res Response, ok bool, err error) {
+	answer, ok := dlg.refreshAnswer(req)
+	if !ok {
+		return nil, false, nil
+	}
+	if err := dlg.ReceiveRequest(req); err != nil {
+		return nil, false, err
+	}
+
+	res = NewResponseFromRequest("", req, 200, "OK", "")
+	dlg.mu.Lock()
+	if dlg.localTarget != nil {
+		res.AppendHeader(&ContactHeader{Address: dlg.localTarget.Clone()})
+	}
+	callbacks := make([]func(Request), len(dlg.onRefreshFns))
+	copy(callbacks, dlg.onRefreshFns)
+	dlg.mu.Unlock()
+	if answer != "" {
+		ct := ContentType("application/sdp")
+		res.AppendHeader(&ct)
+		res.SetBody(answer, true)
+	}
+	if err := dlg.SendResponse(res); err != nil {
+		return nil, false, err
+	}
+
+	for _, fn := range callbacks {
+		fn(req)
+	}
+
+	return res, true, nil
+}
+
+// Returns the session description to respond with if the request refreshes the session.
+func (dlg *Dialog) refreshAnswer(req Request) (string, bool) {
+	if dlg.State() != DialogConfirmed {
+		return "", false
+	}
+
+	oa := dlg.offerAnswer
+	local, remote := oa.LocalSession(), oa.RemoteSession()
+	if oa.State() != OfferAnswerComplete || local == "" {
+		return "", false
+	}
+
+	body := sessionBody(req)
+	switch {
+	case req.Method() == UPDATE && body == "":
+		return "", true
+	case req.IsInvite() && body == "":
+		// the previous description is the offer in 2xx, the answer comes in ACK
+		return local, true
+	case (req.IsInvite() || req.Method() == UPDATE) && SessionDescriptionUnchanged(remote, body):
+		return local, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,80 @@
+package sip_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestSessionDescriptionUnchanged(t *testing.T) {
+	refreshed := strings.Replace(testOffer, "\r\n", "\n", -1) + "a=sendrecv\n"
+	if !sip.SessionDescriptionUnchanged(testOffer, refreshed) {
+		t.Error("description with the same origin version must be unchanged")
+	}
+	changed := strings.Replace(testOffer, "2890844526 IN", "2890844527 IN", 1)
+	if sip.SessionDescriptionUnchanged(testOffer, changed) {
+		t.Error("description with the new origin version must be changed")
+	}
+	if !sip.SessionDescriptionUnchanged("v=0\r\ns=-\r\n", "v=0\ns=-\n\n") || sip.SessionDescriptionUnchanged("v=0\r\ns=-\r\n", "v=0\r\ns=a\r\n") {
+		t.Error("descriptions without origin must be compared line by line")
+	}
+}
+
+func TestDialogAcceptSessionRefresh(t *testing.T) {
+	dlg, err := sip.NewDialogUAS(withSDP(dialogInvite(t), testOffer).(sip.Request),
+		withSDP(dialogResponse(t, "200 OK"), testAnswer).(sip.Response))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	refreshes := 0
+	dlg.OnSessionRefresh(func(req sip.Request) { refreshes++ })
+
+	reinvite := func(seq, body string) sip.Request {
+		req := parseDialogMessage(t,
+			"INVITE sip:bob@192.0.2.4 SIP/2.0",
+			"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK"+seq,
+			"From: <sip:alice@atlanta.com>;tag=1928301774",
+			"To: <sip:bob@biloxi.com>;tag=a6c85cf",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: "+seq+" INVITE",
+			"Contact: <sip:alice@pc33.atlanta.com>",
+		).(sip.Request)
+		if body != "" {
+			withSDP(req, body)
+		}
+		return req
+	}
+
+	res, ok, err := dlg.AcceptSessionRefresh(reinvite("314160", strings.Replace(testOffer, "\r\n", "\n", -1)))
+	if err != nil || !ok {
+		t.Fatalf("refresh must be accepted: %v", err)
+	}
+	if res.StatusCode() != 200 || res.Body() != testAnswer {
+		t.Errorf("unexpected response %s with body %q", res.Short(), res.Body())
+	}
+	if _, ok := res.Contact(); !ok {
+		t.Error("missing Contact in 2xx on re-INVITE")
+	}
+	if refreshes != 1 || dlg.OfferAnswer().State() != sip.OfferAnswerComplete || dlg.RemoteSeq() != 314160 {
+		t.Errorf("unexpected dialog state after refresh: %d refreshes, %s, seq %d",
+			refreshes, dlg.OfferAnswer().State(), dlg.RemoteSeq())
+	}
+
+	changed := strings.Replace(testOffer, "2890844526 IN", "2890844527 IN", 1)
+	if _, ok, err := dlg.AcceptSessionRefresh(reinvite("314161", changed)); ok || err != nil {
+		t.Fatalf("changed session must be handled by the application: %v", err)
+	}
+	if refreshes != 1 || dlg.RemoteSeq() != 314160 {
+		t.Error("dialog must not be changed by not accepted refresh")
+	}
+
+	// re-INVITE without body gets the previous description as the offer
+	res, ok, err = dlg.AcceptSessionRefresh(reinvite("314162", ""))
+	if err != nil || !ok {
+		t.Fatalf("refresh must be accepted: %v", err)
+	}
+	if res.Body() != testAnswer || dlg.OfferAnswer().State() != sip.OfferAnswerLocalOffer {
+		t.Errorf("unexpected body %q in state %s", res.Body(), dlg.OfferAnswer().State())
+	}
+}
@@ -0,0 +1,101 @@
+package sip
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultRegisterExpires is a binding expiration used when REGISTER request doesn't specify it - RFC 3261 10.2.1.1.
+const DefaultRegisterExpires uint32 = 3600
+
+// ValidateWildcardContact checks usage of the wildcard 'Contact: *' in the REGISTER request - RFC 3261 10.3.
+// Wildcard contact must be the only one contact of the request and must be used with 'Expires: 0'.
+// Registrar should respond with '400 Bad Request' on error.
+func ValidateWildcardContact(req Request) error {
+	hdrs := req.GetHeaders("Contact")
+
+	wildcard := false
+	for _, hdr := range hdrs {
+		if contact, ok := hdr.(*ContactHeader); ok && contact.IsWildcard() {
+			wildcard = true
+			break
+		}
+	}
+	if !wildcard {
+		return nil
+	}
+
+	if len(hdrs) > 1 {
+		return fmt.Errorf("wildcard contact must be the only one 'Contact' header")
+	}
+	expires, ok := getExpires(req)
+	if !ok {
+		return fmt.Errorf("wildcard contact requires 'Expires: 0' header")
+	}
+	if expires != 0 {
+		return fmt.Errorf("wildcard contact requires 'Expires: 0' header, got 'Expires: %d'", expires)
+	}
+
+	return nil
+}
+
+func getExpires(msg Message) (Expires, bool) {
+	hdrs := msg.GetHeaders("Expires")
+	if len(hdrs) == 0 {
+		return 0, false
+	}
+	expires, ok := hdrs[0].(*Expires)
+	if !ok {
+		return 0, false
+	}
+	return *expires, true
+}
+
+// ContactExpires computes the effective expiration in seconds of the binding - RFC 3261 10.2.4, 10.3.
+// 'expires' parameter of the contact takes precedence over the 'Expires' header of the message,
+// def is used when neither is present or valid.
+// Clients can use it with the contacts of the REGISTER response to schedule the refresh.
+func ContactExpires(msg Message, contact *ContactHeader, def uint32) uint32 {
+	if contact != nil && contact.Params != nil {
+		if val, ok := contact.Params.Get("expires"); ok && val != nil {
+			if expires, err := strconv.ParseUint(val.String(), 10, 32); err == nil {
+				return uint32(expires)
+			}
+		}
+	}
+	if expires, ok := getExpires(msg); ok {
+		return uint32(expires)
+	}
+	return def
+}
+
+// ClampExpires applies registrar limits to the requested expiration.
+// It returns false if non-zero expiration is less than min, then registrar should respond
+// with '423 Interval Too Brief' - RFC 3261 10.3. Zero limit means no limit.
+func ClampExpires(expires, min, max uint32) (uint32, bool) {
+	if expires == 0 {
+		return 0, true
+	}
+	if min > 0 && expires < min {
+		return min, false
+	}
+	if max > 0 && expires > max {
+		return max, true
+	}
+	return expires, true
+}
+
+// RefreshInterval returns the time after which the client should refresh the binding of the given expiration.
+// The binding is refreshed 10% before expiration, but at least 5 seconds and no later than at the half of expiration.
+func RefreshInterval(expires uint32) time.Duration {
+	total := time.Duration(expires) * time.Second
+	margin := total / 10
+	if margin < 5*time.Second {
+		margin = 5 * time.Second
+	}
+	if margin > total/2 {
+		margin = total / 2
+	}
+	return total - margin
+}
@@ -0,0 +1,113 @@
+package sip_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func newDeregisterAllRequest(t *testing.T) sip.Request {
+	aor := &sip.Address{Uri: &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "example.com"}}
+	req, err := sip.NewRequestBuilder().
+		DeregisterAll().
+		SetRecipient(&sip.SipUri{FHost: "example.com"}).
+		SetFrom(aor).
+		SetTo(aor).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return req
+}
+
+func TestDeregisterAll(t *testing.T) {
+	req := newDeregisterAllRequest(t)
+
+	if req.Method() != sip.REGISTER {
+		t.Errorf("expected REGISTER method, got %s", req.Method())
+	}
+	str := req.String()
+	for _, expected := range []string{"\r\nContact: *\r\n", "\r\nExpires: 0\r\n"} {
+		if !strings.Contains(str, expected) {
+			t.Errorf("expected request to contain %q, got %q", expected, str)
+		}
+	}
+	if err := sip.ValidateWildcardContact(req); err != nil {
+		t.Errorf("unexpected validation error: %s", err)
+	}
+}
+
+func TestValidateWildcardContact(t *testing.T) {
+	req := newDeregisterAllRequest(t)
+	expires := sip.Expires(3600)
+	req.ReplaceHeaders("Expires", []sip.Header{&expires})
+	if err := sip.ValidateWildcardContact(req); err == nil {
+		t.Error("expected error for wildcard contact with non-zero expires")
+	}
+
+	req = newDeregisterAllRequest(t)
+	req.AppendHeader(&sip.ContactHeader{Address: &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "10.0.0.1"}})
+	if err := sip.ValidateWildcardContact(req); err == nil {
+		t.Error("expected error for wildcard contact along with other contacts")
+	}
+
+	req = newDeregisterAllRequest(t)
+	req.RemoveHeader("Expires")
+	if err := sip.ValidateWildcardContact(req); err == nil {
+		t.Error("expected error for wildcard contact without expires")
+	}
+}
+
+func TestContactExpires(t *testing.T) {
+	req := newDeregisterAllRequest(t)
+	req.RemoveHeader("Contact")
+	req.RemoveHeader("Expires")
+	contact := &sip.ContactHeader{
+		Address: &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "10.0.0.1"},
+		Params:  sip.NewParams(),
+	}
+
+	if expires := sip.ContactExpires(req, contact, sip.DefaultRegisterExpires); expires != 3600 {
+		t.Errorf("expected default expires 3600, got %d", expires)
+	}
+
+	hdr := sip.Expires(1800)
+	req.AppendHeader(&hdr)
+	if expires := sip.ContactExpires(req, contact, sip.DefaultRegisterExpires); expires != 1800 {
+		t.Errorf("expected expires 1800 from the header, got %d", expires)
+	}
+
+	contact.Params.Add("expires", sip.String{Str: "60"})
+	if expires := sip.ContactExpires(req, contact, sip.DefaultRegisterExpires); expires != 60 {
+		t.Errorf("expected expires 60 from the contact, got %d", expires)
+	}
+}
+
+func TestClampExpires(t *testing.T) {
+	if expires, ok := sip.ClampExpires(30, 60, 7200); ok || expires != 60 {
+		t.Errorf("expected too brief interval with min 60, got %d, %v", expires, ok)
+	}
+	if expires, ok := sip.ClampExpires(10000, 60, 7200); !ok || expires != 7200 {
+		t.Errorf("expected expires clamped to 7200, got %d, %v", expires, ok)
+	}
+	if expires, ok := sip.ClampExpires(0, 60, 7200); !ok || expires != 0 {
+		t.Errorf("expected zero expires accepted, got %d, %v", expires, ok)
+	}
+}
+
+func TestRefreshInterval(t *testing.T) {
+	for _, test := range []struct {
+		expires  uint32
+		expected time.Duration
+	}{
+		{3600, 3240 * time.Second},
+		{30, 25 * time.Second},
+		{6, 3 * time.Second},
+	} {
+		if interval := sip.RefreshInterval(test.expires); interval != test.expected {
+			t.Errorf("expected refresh after %s for expires %d, got %s", test.expected, test.expires, interval)
+		}
+	}
+}
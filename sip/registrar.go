@@ -0,0 +1,396 @@
+package sip
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/timing"
+)
+
+// Binding is a registered contact address of the address-of-record - RFC 3261 10.3.
+type Binding struct {
+	// AOR is the address-of-record key, see AORKey.
+	AOR     string
+	Contact ContactUri
+	// Q is the preference of the contact from 0 to 1, contacts without 'q' parameter have DefaultTargetQ.
+	Q      float64
+	CallID string
+	CSeq   uint32
+	// InstanceID and RegID identify the outbound flow of the binding - RFC 5626 6.
+	InstanceID string
+	RegID      uint32
+	Expires    time.Time
+}
+
+func (b Binding) matches(contact ContactUri, instanceID string, regID uint32) bool {
+	if instanceID != "" && regID > 0 {
+		return b.InstanceID == instanceID && b.RegID == regID
+	}
+	return b.Contact.Equals(contact)
+}
+
+// BindingSnapshot is a serializable state of a Binding, the contact URI is stored in the string form.
+// The expiration timer is stored as a monotonic duration, see timing.RecurringSnapshot.
+type BindingSnapshot struct {
+	AOR        string
+	Contact    string
+	Q          float64
+	CallID     string
+	CSeq       uint32
+	InstanceID string
+	RegID      uint32
+	Timer      timing.RecurringSnapshot
+}
+
+type registration struct {
+	Binding
+	timer timing.RecurringTimer
+}
+
+// Registrar processes REGISTER requests and keeps bindings of addresses-of-record - RFC 3261 10.3.
+// Each binding expires on its own timer, the timers are captured by Snapshot,
+// so bindings survive restart with the remaining expiration.
+type Registrar struct {
+	// MinExpires is the minimal accepted expiration in seconds, shorter ones are rejected
+	// with '423 Interval Too Brief'. Zero means no limit.
+	MinExpires uint32
+	// MaxExpires limits expiration in seconds. Zero means no limit.
+	MaxExpires uint32
+	// DefaultExpires is used when the request doesn't specify expiration, DefaultRegisterExpires if zero.
+	DefaultExpires uint32
+	// OnExpire is called when the binding expires.
+	OnExpire func(binding Binding)
+	// TimerPanics configures handling of panics recovered from OnExpire.
+	TimerPanics timing.PanicPolicy
+
+	mu       sync.Mutex
+	bindings map[string][]*registration
+}
+
+func NewRegistrar() *Registrar {
+	return &Registrar{
+		bindings: make(map[string][]*registration),
+	}
+}
+
+// AORKey returns the canonical address-of-record of the URI used as the bindings key:
+// scheme, user and host without parameters and headers, the host is case-insensitive - RFC 3261 10.3 step 5.
+func AORKey(uri Uri) string {
+	sipUri, ok := uri.(*SipUri)
+	if !ok {
+		return uri.String()
+	}
+
+	scheme := "sip"
+	if sipUri.IsEncrypted() {
+		scheme = "sips"
+	}
+	if sipUri.FUser == nil || sipUri.FUser.String() == "" {
+		return scheme + ":" + TokenLower(sipUri.FHost)
+	}
+	return scheme + ":" + sipUri.FUser.String() + "@" + TokenLower(sipUri.FHost)
+}
+
+// Register processes the REGISTER request and returns the response to send.
+// The response is '200 OK' listing all current bindings of the address-of-record,
+// or an error response, then no binding is changed.
+func (r *Registrar) Register(req Request) Response {
+	if req.Method() != REGISTER {
+		res := NewResponseFromRequest("", req, 405, "Method Not Allowed", "")
+		res.AppendHeader(AllowHeader{REGISTER})
+		return res
+	}
+
+	to, ok := req.To()
+	if !ok || to.Address == nil {
+		return NewResponseFromRequest("", req, 400, "Missing To", "")
+	}
+	callID, ok := req.CallID()
+	if !ok {
+		return NewResponseFromRequest("", req, 400, "Missing Call-ID", "")
+	}
+	cseq, ok := req.CSeq()
+	if !ok {
+		return NewResponseFromRequest("", req, 400, "Missing CSeq", "")
+	}
+	if err := ValidateWildcardContact(req); err != nil {
+		return NewResponseFromRequest("", req, 400, "Bad Request", "")
+	}
+
+	aor := AORKey(to.Address)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var contacts []*ContactHeader
+	Contacts(req)(func(contact *ContactHeader) bool {
+		contacts = append(contacts, contact)
+		return true
+	})
+
+	if len(contacts) == 1 && contacts[0].IsWildcard() {
+		// remove all bindings, the request of the same client that is not newer than
+		// the binding aborts the update - RFC 3261 10.3 step 6
+		regs := append([]*registration(nil), r.bindings[aor]...)
+		for _, reg := range regs {
+			if reg.CallID == string(*callID) && reg.CSeq >= cseq.SeqNo {
+				return NewResponseFromRequest("", req, 500, "Server Internal Error", "")
+			}
+		}
+		for _, reg := range regs {
+			r.remove(reg)
+		}
+		return r.respond(req, aor)
+	}
+
+	updates := make([]Binding, 0, len(contacts))
+	for _, contact := range contacts {
+		if contact.Address == nil {
+			return NewResponseFromRequest("", req, 400, "Bad Contact", "")
+		}
+
+		expires, ok := ClampExpires(ContactExpires(req, contact, r.defaultExpires()), r.MinExpires, r.MaxExpires)
+		if !ok {
+			res := NewResponseFromRequest("", req, 423, "Interval Too Brief", "")
+			res.AppendHeader(&GenericHeader{
+				HeaderName: "Min-Expires",
+				Contents:   strconv.FormatUint(uint64(r.MinExpires), 10),
+			})
+			return res
+		}
+
+		binding := Binding{
+			AOR:     aor,
+			Contact: contact.Address,
+			Q:       contactQ(contact),
+			CallID:  string(*callID),
+			CSeq:    cseq.SeqNo,
+		}
+		binding.InstanceID, binding.RegID, _ = OutboundContact(contact)
+		if expires > 0 {
+			binding.Expires = timing.Now().Add(time.Duration(expires) * time.Second)
+		}
+
+		// out of order or retransmitted request of the same client - RFC 3261 10.3 step 7
+		if reg := r.lookup(aor, binding); reg != nil && reg.CallID == binding.CallID && reg.CSeq >= binding.CSeq {
+			return NewResponseFromRequest("", req, 500, "Server Internal Error", "")
+		}
+
+		updates = append(updates, binding)
+	}
+
+	for _, binding := range updates {
+		if reg := r.lookup(aor, binding); reg != nil {
+			r.remove(reg)
+		}
+		if !binding.Expires.IsZero() {
+			reg := &registration{Binding: binding}
+			reg.timer = timing.NewRecurringTimer(timing.RecurringOptions{
+				Name:     "registrar binding " + binding.Contact.String(),
+				Interval: binding.Expires.Sub(timing.Now()),
+				MaxCount: 1,
+				Panics:   r.TimerPanics,
+			}, r.expireFunc(reg))
+			r.add(reg)
+		}
+	}
+
+	return r.respond(req, aor)
+}
+
+// Bindings returns current bindings of the address-of-record in the order of preference:
+// descending q-value, then the registration order.
+func (r *Registrar) Bindings(aor string) []Binding {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.list(aor)
+}
+
+// Unregister removes all bindings of the address-of-record.
+func (r *Registrar) Unregister(aor string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, reg := range r.bindings[aor] {
+		r.remove(reg)
+	}
+}
+
+// Snapshot returns snapshots of all bindings.
+func (r *Registrar) Snapshot() []BindingSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshots := make([]BindingSnapshot, 0)
+	for _, regs := range r.bindings {
+		for _, reg := range regs {
+			snapshots = append(snapshots, BindingSnapshot{
+				AOR:        reg.AOR,
+				Contact:    reg.Contact.String(),
+				Q:          reg.Q,
+				CallID:     reg.CallID,
+				CSeq:       reg.CSeq,
+				InstanceID: reg.InstanceID,
+				RegID:      reg.RegID,
+				Timer:      reg.timer.Snapshot(),
+			})
+		}
+	}
+
+	return snapshots
+}
+
+// Restore adds bindings restored from the snapshots, parseUri is usually parser.ParseUri.
+// Time passed since the capture is subtracted from the binding expiration,
+// bindings expired in the meantime expire immediately. Nothing is restored if any snapshot is corrupted.
+func (r *Registrar) Restore(snapshots []BindingSnapshot, parseUri func(uri string) (Uri, error)) error {
+	bindings := make([]Binding, 0, len(snapshots))
+	timers := make([]timing.RecurringSnapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if err := snapshot.Timer.Verify(); err != nil {
+			return fmt.Errorf("restore binding of '%s': %w", snapshot.AOR, err)
+		}
+		if snapshot.Timer.Remaining == 0 {
+			// the binding has already expired
+			continue
+		}
+		uri, err := parseUri(snapshot.Contact)
+		if err != nil {
+			return fmt.Errorf("restore binding of '%s': %w", snapshot.AOR, err)
+		}
+		bindings = append(bindings, Binding{
+			AOR:        snapshot.AOR,
+			Contact:    uri,
+			Q:          snapshot.Q,
+			CallID:     snapshot.CallID,
+			CSeq:       snapshot.CSeq,
+			InstanceID: snapshot.InstanceID,
+			RegID:      snapshot.RegID,
+		})
+		timers = append(timers, snapshot.Timer)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, binding := range bindings {
+		if reg := r.lookup(binding.AOR, binding); reg != nil {
+			r.remove(reg)
+		}
+		reg := &registration{Binding: binding}
+		timer, err := timing.RestoreRecurringTimer(timers[i], r.TimerPanics, r.expireFunc(reg))
+		if err != nil {
+			return fmt.Errorf("restore binding of '%s': %w", binding.AOR, err)
+		}
+		reg.timer = timer
+		reg.Expires = timing.Now().Add(reg.timer.Remaining())
+		r.add(reg)
+	}
+
+	return nil
+}
+
+func (r *Registrar) defaultExpires() uint32 {
+	if r.DefaultExpires == 0 {
+		return DefaultRegisterExpires
+	}
+	return r.DefaultExpires
+}
+
+func (r *Registrar) lookup(aor string, binding Binding) *registration {
+	for _, reg := range r.bindings[aor] {
+		if reg.matches(binding.Contact, binding.InstanceID, binding.RegID) {
+			return reg
+		}
+	}
+	return nil
+}
+
+func (r *Registrar) add(reg *registration) {
+	if r.bindings == nil {
+		r.bindings = make(map[string][]*registration)
+	}
+	r.bindings[reg.AOR] = append(r.bindings[reg.AOR], reg)
+}
+
+func (r *Registrar) remove(reg *registration) {
+	reg.timer.Stop()
+
+	regs := r.bindings[reg.AOR]
+	for i := range regs {
+		if regs[i] == reg {
+			regs = append(regs[:i], regs[i+1:]...)
+			break
+		}
+	}
+	if len(regs) == 0 {
+		delete(r.bindings, reg.AOR)
+	} else {
+		r.bindings[reg.AOR] = regs
+	}
+}
+
+// Returns expiration callback of the registration. The timer of the replaced registration
+// may fire concurrently with the refresh, so only the same registration is removed.
+func (r *Registrar) expireFunc(reg *registration) func() {
+	return func() {
+		r.mu.Lock()
+		expired := false
+		for _, current := range r.bindings[reg.AOR] {
+			if current == reg {
+				expired = true
+				break
+			}
+		}
+		if expired {
+			r.remove(reg)
+		}
+		r.mu.Unlock()
+
+		if expired && r.OnExpire != nil {
+			r.OnExpire(reg.Binding)
+		}
+	}
+}
+
+func (r *Registrar) list(aor string) []Binding {
+	regs := r.bindings[aor]
+	bindings := make([]Binding, 0, len(regs))
+	for _, reg := range regs {
+		bindings = append(bindings, reg.Binding)
+	}
+	sort.SliceStable(bindings, func(i, j int) bool {
+		return bindings[i].Q > bindings[j].Q
+	})
+	return bindings
+}
+
+// Builds '200 OK' with all current bindings - RFC 3261 10.3 step 8.
+func (r *Registrar) respond(req Request, aor string) Response {
+	res := NewResponseFromRequest("", req, 200, "OK", "")
+	now := timing.Now()
+	for _, binding := range r.list(aor) {
+		expires := binding.Expires.Sub(now).Round(time.Second) / time.Second
+		if expires < 0 {
+			expires = 0
+		}
+
+		contact := &ContactHeader{
+			Address: binding.Contact.Clone(),
+			Params:  NewParams().Add("expires", String{Str: strconv.FormatInt(int64(expires), 10)}),
+		}
+		if binding.Q != DefaultTargetQ {
+			contact.Params.Add("q", String{Str: strconv.FormatFloat(binding.Q, 'f', -1, 64)})
+		}
+		if binding.InstanceID != "" {
+			SetOutboundContact(contact, binding.InstanceID, binding.RegID)
+		}
+		res.AppendHeader(contact)
+	}
+
+	return res
+}
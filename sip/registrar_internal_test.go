@@ -0,0 +1,48 @@
+package sip
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/timing"
+)
+
+func registrarRequest(cseq uint32, expires Expires) Request {
+	aor := &SipUri{FUser: String{Str: "alice"}, FHost: "example.com"}
+	callID := CallID("reg-1")
+	return NewRequest("", REGISTER, &SipUri{FHost: "example.com"}, "SIP/2.0", []Header{
+		&FromHeader{Address: aor.Clone(), Params: NewParams().Add("tag", String{Str: "1928301774"})},
+		&ToHeader{Address: aor.Clone()},
+		&callID,
+		&CSeq{SeqNo: cseq, MethodName: REGISTER},
+		&ContactHeader{Address: &SipUri{FUser: String{Str: "alice"}, FHost: "10.0.0.1"}},
+		&expires,
+	}, "", nil)
+}
+
+func TestRegistrarStaleExpiration(t *testing.T) {
+	timing.MockMode = true
+	defer func() { timing.MockMode = false }()
+
+	expired := 0
+	registrar := NewRegistrar()
+	registrar.OnExpire = func(binding Binding) {
+		expired++
+	}
+
+	if res := registrar.Register(registrarRequest(1, 60)); res.StatusCode() != 200 {
+		t.Fatalf("unexpected response %s", res.Short())
+	}
+	// the timer of the first registration fires while it is refreshed
+	stale := registrar.expireFunc(registrar.bindings["sip:alice@example.com"][0])
+	if res := registrar.Register(registrarRequest(2, 3600)); res.StatusCode() != 200 {
+		t.Fatalf("unexpected response %s", res.Short())
+	}
+	stale()
+
+	if bindings := registrar.Bindings("sip:alice@example.com"); len(bindings) != 1 || bindings[0].CSeq != 2 {
+		t.Errorf("refreshed binding must survive the stale timer, got %v", bindings)
+	}
+	if expired != 0 {
+		t.Errorf("expected no expiration reported, got %d", expired)
+	}
+}
@@ -0,0 +1,162 @@
+package sip_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/snapshot"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+func registerRequest(t *testing.T, callID string, cseq int, headers ...string) sip.Request {
+	t.Helper()
+
+	lines := []string{
+		"REGISTER sip:example.com SIP/2.0",
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=" + sip.GenerateBranch(),
+		"From: <sip:alice@example.com>;tag=1928301774",
+		"To: <sip:alice@EXAMPLE.com>",
+		"Call-ID: " + callID,
+		"CSeq: " + strconv.Itoa(cseq) + " REGISTER",
+	}
+	lines = append(lines, headers...)
+	msg, err := parser.ParseMessage([]byte(strings.Join(append(lines, "Content-Length: 0", "", ""), "\r\n")), log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return msg.(sip.Request)
+}
+
+func responseContacts(t *testing.T, res sip.Response) []string {
+	t.Helper()
+
+	var contacts []string
+	sip.Contacts(res)(func(contact *sip.ContactHeader) bool {
+		contacts = append(contacts, contact.Value())
+		return true
+	})
+	return contacts
+}
+
+func TestRegistrar(t *testing.T) {
+	timing.MockMode = true
+	defer func() { timing.MockMode = false }()
+
+	expired := make(chan sip.Binding, 1)
+	registrar := sip.NewRegistrar()
+	registrar.MinExpires = 60
+	registrar.OnExpire = func(binding sip.Binding) {
+		expired <- binding
+	}
+
+	res := registrar.Register(registerRequest(t, "reg-1", 1,
+		"Contact: <sip:alice@10.0.0.1:5060>;q=0.5",
+		"Contact: <sip:alice@10.0.0.2:5060>;expires=120",
+		"Expires: 300",
+	))
+	if res.StatusCode() != 200 {
+		t.Fatalf("unexpected response %s", res.Short())
+	}
+	expected := []string{
+		"<sip:alice@10.0.0.2:5060>;expires=120",
+		"<sip:alice@10.0.0.1:5060>;expires=300;q=0.5",
+	}
+	if contacts := responseContacts(t, res); len(contacts) != 2 || contacts[0] != expected[0] || contacts[1] != expected[1] {
+		t.Errorf("expected contacts %v, got %v", expected, contacts)
+	}
+
+	res = registrar.Register(registerRequest(t, "reg-1", 1, "Contact: <sip:alice@10.0.0.2:5060>"))
+	if res.StatusCode() != 500 {
+		t.Errorf("expected 500 on out of order request, got %s", res.Short())
+	}
+	res = registrar.Register(registerRequest(t, "reg-1", 2, "Contact: <sip:alice@10.0.0.3:5060>;expires=10"))
+	if res.StatusCode() != 423 || len(res.GetHeaders("Min-Expires")) != 1 {
+		t.Errorf("expected 423 with Min-Expires, got %s", res.Short())
+	}
+	if bindings := registrar.Bindings("sip:alice@example.com"); len(bindings) != 2 {
+		t.Fatalf("rejected requests must not change bindings, got %v", bindings)
+	}
+
+	res = registrar.Register(registerRequest(t, "reg-1", 3))
+	if contacts := responseContacts(t, res); res.StatusCode() != 200 || len(contacts) != 2 {
+		t.Errorf("expected query of 2 bindings, got %s %v", res.Short(), contacts)
+	}
+
+	timing.Elapse(121 * time.Second)
+	select {
+	case binding := <-expired:
+		if binding.Contact.String() != "sip:alice@10.0.0.2:5060" {
+			t.Errorf("unexpected expired binding %v", binding.Contact)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("binding did not expire")
+	}
+	if bindings := registrar.Bindings("sip:alice@example.com"); len(bindings) != 1 {
+		t.Errorf("expected 1 binding left, got %v", bindings)
+	}
+
+	res = registrar.Register(registerRequest(t, "reg-1", 1, "Contact: *", "Expires: 0"))
+	if res.StatusCode() != 500 {
+		t.Errorf("expected 500 on wildcard removal older than the binding, got %s", res.Short())
+	}
+	if bindings := registrar.Bindings("sip:alice@example.com"); len(bindings) != 1 {
+		t.Errorf("aborted wildcard removal must keep bindings, got %v", bindings)
+	}
+
+	res = registrar.Register(registerRequest(t, "reg-2", 1, "Contact: *", "Expires: 0"))
+	if contacts := responseContacts(t, res); res.StatusCode() != 200 || len(contacts) != 0 {
+		t.Errorf("expected removal of all bindings, got %s %v", res.Short(), contacts)
+	}
+	res = registrar.Register(registerRequest(t, "reg-2", 2, "Contact: *"))
+	if res.StatusCode() != 400 {
+		t.Errorf("expected 400 on wildcard without 'Expires: 0', got %s", res.Short())
+	}
+}
+
+func TestRegistrarSnapshot(t *testing.T) {
+	timing.MockMode = true
+	defer func() { timing.MockMode = false }()
+
+	registrar := sip.NewRegistrar()
+	registrar.Register(registerRequest(t, "reg-1", 1,
+		`Contact: <sip:alice@10.0.0.1:5060>;+sip.instance="<urn:uuid:00000000-0000-1000-8000-000A95A0E128>";reg-id=1`,
+		"Expires: 600",
+	))
+	snapshots := registrar.Snapshot()
+	if len(snapshots) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(snapshots))
+	}
+
+	timing.Elapse(100 * time.Second)
+	restored := sip.NewRegistrar()
+	if err := restored.Restore(snapshots, parser.ParseUri); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	bindings := restored.Bindings("sip:alice@example.com")
+	if len(bindings) != 1 || bindings[0].InstanceID != "urn:uuid:00000000-0000-1000-8000-000A95A0E128" || bindings[0].RegID != 1 {
+		t.Fatalf("unexpected restored bindings %v", bindings)
+	}
+	if left := bindings[0].Expires.Sub(timing.Now()); left != 500*time.Second {
+		t.Errorf("expected 500s left, got %s", left)
+	}
+
+	// the same flow from another address replaces the binding - RFC 5626 6
+	res := restored.Register(registerRequest(t, "reg-1", 2,
+		`Contact: <sip:alice@10.0.0.9:5060>;+sip.instance="<urn:uuid:00000000-0000-1000-8000-000A95A0E128>";reg-id=1`,
+	))
+	if contacts := responseContacts(t, res); len(contacts) != 1 {
+		t.Errorf("expected flow binding replaced, got %v", contacts)
+	}
+
+	corrupted := append([]sip.BindingSnapshot(nil), snapshots...)
+	corrupted[0].Timer.Left *= 2
+	if err := sip.NewRegistrar().Restore(corrupted, parser.ParseUri); !errors.Is(err, snapshot.ErrCorrupted) {
+		t.Errorf("expected snapshot.ErrCorrupted on mangled timer, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package sip
+
+import (
+	"bytes"
+	"strings"
+)
+
+// MultiValueStyle defines how headers with multiple values are rendered.
+type MultiValueStyle int
+
+const (
+	// MultiValueAsIs renders headers as they are stored in the message.
+	MultiValueAsIs MultiValueStyle = iota
+	// MultiValueRepeated renders each value on a separate header line.
+	MultiValueRepeated
+	// MultiValueFolded renders all values of the header in a single comma-separated line.
+	MultiValueFolded
+)
+
+// DefaultMultiValueHeaders are headers affected by the RenderOptions.MultiValue style by default.
+var DefaultMultiValueHeaders = []string{"Via", "Route", "Record-Route", "Contact", "Allow"}
+
+// RenderOptions controls serialization of the message, since some legacy devices accept only one style
+// of multi-value headers. Parser accepts both styles.
+type RenderOptions struct {
+	MultiValue MultiValueStyle
+	// MultiValueHeaders are names of headers affected by the MultiValue style,
+	// if empty then DefaultMultiValueHeaders are used.
+	MultiValueHeaders []string
+}
+
+type renderOptionsKey struct{}
+
+// SetRenderOptions attaches render options to the message, they are used by the message String method.
+// Options are stored in the message metadata, so they are copied to clones and to responses created from the request.
+// Nil options restore the default rendering.
+func SetRenderOptions(msg Message, opts *RenderOptions) {
+	if opts == nil {
+		MessageMetadata(msg).SetValue(renderOptionsKey{}, nil)
+		return
+	}
+	MessageMetadata(msg).SetValue(renderOptionsKey{}, opts)
+}
+
+// GetRenderOptions returns render options attached to the message.
+func GetRenderOptions(msg Message) (*RenderOptions, bool) {
+	opts, ok := MessageMetadata(msg).Value(renderOptionsKey{}).(*RenderOptions)
+	return opts, ok
+}
+
+func (opts *RenderOptions) affects(name string) bool {
+	names := opts.MultiValueHeaders
+	if len(names) == 0 {
+		names = DefaultMultiValueHeaders
+	}
+	for _, n := range names {
+		if TokenEqual(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Renders headers of the same name according to the options.
+func renderHeaders(buffer *bytes.Buffer, hdrs []Header, opts *RenderOptions) {
+	if len(hdrs) == 0 {
+		return
+	}
+
+	style := MultiValueAsIs
+	if opts != nil && opts.affects(hdrs[0].Name()) {
+		style = opts.MultiValue
+	}
+
+	switch style {
+	case MultiValueFolded:
+		values := make([]string, 0, len(hdrs))
+		for _, header := range hdrs {
+			if value := header.Value(); value != "" {
+				values = append(values, value)
+			}
+		}
+		buffer.WriteString(hdrs[0].Name() + ": " + strings.Join(values, ", "))
+		buffer.WriteString("\r\n")
+	case MultiValueRepeated:
+		for _, header := range hdrs {
+			for _, value := range splitHeader(header) {
+				buffer.WriteString(value.String())
+				buffer.WriteString("\r\n")
+			}
+		}
+	default:
+		for _, header := range hdrs {
+			buffer.WriteString(header.String())
+			buffer.WriteString("\r\n")
+		}
+	}
+}
+
+// Splits multi-value header into single value headers.
+func splitHeader(header Header) []Header {
+	var hdrs []Header
+	switch h := header.(type) {
+	case ViaHeader:
+		for _, hop := range h {
+			hdrs = append(hdrs, ViaHeader{hop})
+		}
+	case *RouteHeader:
+		for _, uri := range h.Addresses {
+			hdrs = append(hdrs, &RouteHeader{Addresses: []Uri{uri}})
+		}
+	case *RecordRouteHeader:
+		for _, uri := range h.Addresses {
+			hdrs = append(hdrs, &RecordRouteHeader{Addresses: []Uri{uri}})
+		}
+	case AllowHeader:
+		for _, method := range h {
+			hdrs = append(hdrs, AllowHeader{method})
+		}
+	}
+	if len(hdrs) == 0 {
+		return []Header{header}
+	}
+	return hdrs
+}
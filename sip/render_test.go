@@ -0,0 +1,66 @@
+package sip_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func newRenderRequest() sip.Request {
+	port := sip.Port(5060)
+	return sip.NewRequest(
+		"",
+		sip.OPTIONS,
+		&sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"},
+		"SIP/2.0",
+		[]sip.Header{
+			sip.ViaHeader{
+				&sip.ViaHop{ProtocolName: "SIP", ProtocolVersion: "2.0", Transport: "UDP", Host: "p1.example.com", Port: &port, Params: sip.NewParams()},
+				&sip.ViaHop{ProtocolName: "SIP", ProtocolVersion: "2.0", Transport: "UDP", Host: "p2.example.com", Port: &port, Params: sip.NewParams()},
+			},
+			sip.AllowHeader{sip.INVITE},
+			sip.AllowHeader{sip.ACK, sip.BYE},
+		},
+		"",
+		nil,
+	)
+}
+
+func TestRenderOptionsRepeated(t *testing.T) {
+	req := newRenderRequest()
+	sip.SetRenderOptions(req, &sip.RenderOptions{MultiValue: sip.MultiValueRepeated})
+
+	str := req.String()
+	for _, expected := range []string{
+		"Via: SIP/2.0/UDP p1.example.com:5060\r\nVia: SIP/2.0/UDP p2.example.com:5060\r\n",
+		"Allow: INVITE\r\nAllow: ACK\r\nAllow: BYE\r\n",
+	} {
+		if !strings.Contains(str, expected) {
+			t.Errorf("expected message to contain %q, got %q", expected, str)
+		}
+	}
+}
+
+func TestRenderOptionsFolded(t *testing.T) {
+	req := newRenderRequest()
+	sip.SetRenderOptions(req, &sip.RenderOptions{
+		MultiValue:        sip.MultiValueFolded,
+		MultiValueHeaders: []string{"Allow"},
+	})
+
+	str := req.String()
+	for _, expected := range []string{
+		"Via: SIP/2.0/UDP p1.example.com:5060, SIP/2.0/UDP p2.example.com:5060\r\n",
+		"Allow: INVITE, ACK, BYE\r\n",
+	} {
+		if !strings.Contains(str, expected) {
+			t.Errorf("expected message to contain %q, got %q", expected, str)
+		}
+	}
+
+	sip.SetRenderOptions(req, nil)
+	if str := req.String(); !strings.Contains(str, "Allow: INVITE\r\nAllow: ACK, BYE\r\n") {
+		t.Errorf("expected headers rendered as is, got %q", str)
+	}
+}
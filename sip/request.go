@@ -16,6 +16,11 @@ type Request interface {
 	SetMethod(method RequestMethod)
 	Recipient() Uri
 	SetRecipient(recipient Uri)
+	// ApplyRouteSet sets Request-URI and 'Route' headers for the route set taking
+	// the current Request-URI as the remote target - RFC 3261 12.2.1.1.
+	ApplyRouteSet(routes []Uri)
+	// ReverseRecordRoute returns 'Record-Route' entries in reverse order.
+	ReverseRecordRoute() []Uri
 	/* Common Helpers */
 	IsInvite() bool
 }
@@ -147,7 +152,7 @@ func (req *request) IsCancel() bool {
 
 func (req *request) Transport() string {
 	if tp := req.message.Transport(); tp != "" {
-		return strings.ToUpper(tp)
+		return TokenUpper(tp)
 	}
 
 	var tp string
@@ -168,7 +173,7 @@ func (req *request) Transport() string {
 	if uri != nil {
 		if uri.UriParams() != nil {
 			if val, ok := uri.UriParams().Get("transport"); ok && !val.Equals("") {
-				tp = strings.ToUpper(val.String())
+				tp = TokenUpper(val.String())
 			}
 		}
 
@@ -261,7 +266,7 @@ func NewAckRequest(ackID MessageID, inviteRequest Request, inviteResponse Respon
 	recipient := inviteRequest.Recipient()
 	if contact, ok := inviteResponse.Contact(); ok {
 		// For ws and wss (like clients in browser), don't use Contact
-		if strings.Index(strings.ToLower(recipient.String()), "transport=ws") == -1 {
+		if strings.Index(TokenLower(recipient.String()), "transport=ws") == -1 {
 			recipient = contact.Address
 		}
 	}
@@ -373,6 +378,7 @@ func cloneRequest(req Request, id MessageID, fields log.Fields) Request {
 	newReq.SetTransport(req.Transport())
 	newReq.SetSource(req.Source())
 	newReq.SetDestination(req.Destination())
+	MessageMetadata(req).copyTo(MessageMetadata(newReq))
 
 	return newReq
 }
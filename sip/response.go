@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"strconv"
-	"strings"
 
 	"github.com/ghettovoice/gosip/log"
 )
@@ -196,7 +195,7 @@ func (res *response) IsCancel() bool {
 
 func (res *response) Transport() string {
 	if tp := res.message.Transport(); tp != "" {
-		return strings.ToUpper(tp)
+		return TokenUpper(tp)
 	}
 
 	var tp string
@@ -278,6 +277,7 @@ func NewResponseFromRequest(
 	res.SetTransport(req.Transport())
 	res.SetSource(req.Destination())
 	res.SetDestination(req.Source())
+	MessageMetadata(req).copyTo(MessageMetadata(res))
 
 	return res
 }
@@ -301,6 +301,7 @@ func cloneResponse(res Response, id MessageID, fields log.Fields) Response {
 	newRes.SetTransport(res.Transport())
 	newRes.SetSource(res.Source())
 	newRes.SetDestination(res.Destination())
+	MessageMetadata(res).copyTo(MessageMetadata(newRes))
 
 	return newRes
 }
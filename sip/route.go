@@ -0,0 +1,156 @@
+package sip
+
+// Len returns number of route entries.
+func (route *RouteHeader) Len() int { return len(route.Addresses) }
+
+// Append adds route entries to the end of the route set.
+func (route *RouteHeader) Append(uris ...Uri) {
+	route.Addresses = append(route.Addresses, uris...)
+}
+
+// Prepend adds route entries to the beginning of the route set.
+func (route *RouteHeader) Prepend(uris ...Uri) {
+	route.Addresses = prependUris(route.Addresses, uris)
+}
+
+// Remove removes route entry at the index, returns false if the index is out of range.
+func (route *RouteHeader) Remove(i int) bool {
+	var ok bool
+	route.Addresses, ok = removeUri(route.Addresses, i)
+	return ok
+}
+
+// Dedup removes consecutive identical route entries.
+func (route *RouteHeader) Dedup() {
+	route.Addresses = dedupUris(route.Addresses)
+}
+
+// Len returns number of route entries.
+func (route *RecordRouteHeader) Len() int { return len(route.Addresses) }
+
+// Append adds route entries to the end of the route set.
+func (route *RecordRouteHeader) Append(uris ...Uri) {
+	route.Addresses = append(route.Addresses, uris...)
+}
+
+// Prepend adds route entries to the beginning of the route set.
+func (route *RecordRouteHeader) Prepend(uris ...Uri) {
+	route.Addresses = prependUris(route.Addresses, uris)
+}
+
+// Remove removes route entry at the index, returns false if the index is out of range.
+func (route *RecordRouteHeader) Remove(i int) bool {
+	var ok bool
+	route.Addresses, ok = removeUri(route.Addresses, i)
+	return ok
+}
+
+// Dedup removes consecutive identical route entries.
+func (route *RecordRouteHeader) Dedup() {
+	route.Addresses = dedupUris(route.Addresses)
+}
+
+// Routes returns route set of the message built from all 'Route' headers in order,
+// so comma-separated and multi-line forms give the same result.
+func Routes(msg Message) []Uri {
+	uris := make([]Uri, 0)
+	for _, hdr := range msg.GetHeaders("Route") {
+		if route, ok := hdr.(*RouteHeader); ok {
+			uris = append(uris, route.Addresses...)
+		}
+	}
+	return uris
+}
+
+// RecordRoutes returns route set of the message built from all 'Record-Route' headers in order.
+func RecordRoutes(msg Message) []Uri {
+	uris := make([]Uri, 0)
+	for _, hdr := range msg.GetHeaders("Record-Route") {
+		if route, ok := hdr.(*RecordRouteHeader); ok {
+			uris = append(uris, route.Addresses...)
+		}
+	}
+	return uris
+}
+
+// CanonicalizeRoutes merges all 'Route' and 'Record-Route' header lines into single comma-separated headers
+// and removes consecutive identical entries.
+func CanonicalizeRoutes(msg Message) {
+	if hdrs := msg.GetHeaders("Route"); len(hdrs) > 0 {
+		route := &RouteHeader{Addresses: dedupUris(Routes(msg))}
+		msg.ReplaceHeaders("Route", []Header{route})
+	}
+	if hdrs := msg.GetHeaders("Record-Route"); len(hdrs) > 0 {
+		route := &RecordRouteHeader{Addresses: dedupUris(RecordRoutes(msg))}
+		msg.ReplaceHeaders("Record-Route", []Header{route})
+	}
+}
+
+// ApplyRouteSet sets Request-URI and 'Route' headers of the request for the route set - RFC 3261 12.2.1.1.
+// The current Request-URI is the remote target. If the first route entry is a loose router,
+// the Request-URI is kept and the route set is put to 'Route' as is. Otherwise the first entry
+// becomes the Request-URI and the remote target is appended to the end of 'Route'.
+// Existing 'Route' headers are replaced, empty route set removes them.
+func (req *request) ApplyRouteSet(routes []Uri) {
+	recipient, routes := routeTarget(req.Recipient(), cloneUris(routes))
+	req.SetRecipient(recipient)
+
+	if len(routes) == 0 {
+		req.RemoveHeader("Route")
+		return
+	}
+
+	route := &RouteHeader{Addresses: routes}
+	if len(req.GetHeaders("Route")) > 0 {
+		req.ReplaceHeaders("Route", []Header{route})
+	} else {
+		req.AppendHeader(route)
+	}
+}
+
+// ReverseRecordRoute returns 'Record-Route' entries of the request in reverse order.
+// The response copies 'Record-Route' of the request, so this is the route set
+// the request originator builds from the response - RFC 3261 12.1.2.
+func (req *request) ReverseRecordRoute() []Uri {
+	return reverseUris(RecordRoutes(req))
+}
+
+// Returns Request-URI and route set for the request to the remote target - RFC 3261 12.2.1.1.
+// Strict router on top of the route set becomes the Request-URI with parameters
+// not allowed in the Request-URI stripped - RFC 3261 19.1.1.
+func routeTarget(remoteTarget Uri, routes []Uri) (Uri, []Uri) {
+	if len(routes) == 0 || isLooseRouter(routes[0]) {
+		return remoteTarget, routes
+	}
+
+	recipient := routes[0]
+	if params := recipient.UriParams(); params != nil {
+		params.Remove("method")
+	}
+	recipient.SetHeaders(NewParams())
+	return recipient, append(routes[1:], remoteTarget)
+}
+
+func prependUris(uris []Uri, prefix []Uri) []Uri {
+	newUris := make([]Uri, 0, len(prefix)+len(uris))
+	newUris = append(newUris, prefix...)
+	return append(newUris, uris...)
+}
+
+func removeUri(uris []Uri, i int) ([]Uri, bool) {
+	if i < 0 || i >= len(uris) {
+		return uris, false
+	}
+	return append(uris[:i], uris[i+1:]...), true
+}
+
+func dedupUris(uris []Uri) []Uri {
+	newUris := make([]Uri, 0, len(uris))
+	for _, uri := range uris {
+		if len(newUris) > 0 && newUris[len(newUris)-1].Equals(uri) {
+			continue
+		}
+		newUris = append(newUris, uri)
+	}
+	return newUris
+}
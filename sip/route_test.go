@@ -0,0 +1,135 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func routeUri(host string) sip.Uri {
+	return &sip.SipUri{FHost: host, FUriParams: sip.NewParams().Add("lr", nil)}
+}
+
+func TestRouteHeaderSliceAPI(t *testing.T) {
+	route := &sip.RouteHeader{}
+	route.Append(routeUri("p2.example.com"), routeUri("p3.example.com"))
+	route.Prepend(routeUri("p1.example.com"))
+	if route.Len() != 3 || route.Addresses[0].Host() != "p1.example.com" {
+		t.Fatalf("unexpected route set: %s", route.Value())
+	}
+
+	if !route.Remove(1) {
+		t.Fatal("Remove() of existing entry returned false")
+	}
+	if route.Remove(5) {
+		t.Error("Remove() of out of range entry returned true")
+	}
+	if expected := "<sip:p1.example.com;lr>, <sip:p3.example.com;lr>"; route.Value() != expected {
+		t.Errorf("expected route '%s', got '%s'", expected, route.Value())
+	}
+
+	route.Append(routeUri("p3.example.com"), routeUri("p1.example.com"))
+	route.Dedup()
+	if expected := "<sip:p1.example.com;lr>, <sip:p3.example.com;lr>, <sip:p1.example.com;lr>"; route.Value() != expected {
+		t.Errorf("expected route '%s', got '%s'", expected, route.Value())
+	}
+}
+
+func TestCanonicalizeRoutes(t *testing.T) {
+	req := sip.NewRequest(
+		"",
+		sip.INVITE,
+		&sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"},
+		"SIP/2.0",
+		[]sip.Header{
+			&sip.RouteHeader{Addresses: []sip.Uri{routeUri("p1.example.com"), routeUri("p2.example.com")}},
+			&sip.RouteHeader{Addresses: []sip.Uri{routeUri("p2.example.com")}},
+			&sip.RouteHeader{Addresses: []sip.Uri{routeUri("p3.example.com")}},
+			&sip.RecordRouteHeader{Addresses: []sip.Uri{routeUri("p1.example.com")}},
+			&sip.RecordRouteHeader{Addresses: []sip.Uri{routeUri("p0.example.com")}},
+		},
+		"",
+		nil,
+	)
+
+	if routes := sip.Routes(req); len(routes) != 4 {
+		t.Errorf("expected 4 routes in the route set, got %d", len(routes))
+	}
+
+	sip.CanonicalizeRoutes(req)
+
+	hdrs := req.GetHeaders("Route")
+	if len(hdrs) != 1 {
+		t.Fatalf("expected single 'Route' header, got %d", len(hdrs))
+	}
+	if expected := "<sip:p1.example.com;lr>, <sip:p2.example.com;lr>, <sip:p3.example.com;lr>"; hdrs[0].Value() != expected {
+		t.Errorf("expected route '%s', got '%s'", expected, hdrs[0].Value())
+	}
+
+	hdrs = req.GetHeaders("Record-Route")
+	if len(hdrs) != 1 || len(sip.RecordRoutes(req)) != 2 {
+		t.Errorf("unexpected 'Record-Route' headers: %v", hdrs)
+	}
+}
+
+func TestRequest_ApplyRouteSet(t *testing.T) {
+	target := &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "192.0.2.4"}
+	req := sip.NewRequest(
+		"",
+		sip.BYE,
+		target,
+		"SIP/2.0",
+		[]sip.Header{&sip.RouteHeader{Addresses: []sip.Uri{routeUri("old.example.com")}}},
+		"",
+		nil,
+	)
+
+	req.ApplyRouteSet([]sip.Uri{routeUri("p1.example.com"), routeUri("p2.example.com")})
+	if !req.Recipient().Equals(target) {
+		t.Errorf("unexpected Request-URI %s for loose router", req.Recipient())
+	}
+	if hdrs := req.GetHeaders("Route"); len(hdrs) != 1 ||
+		hdrs[0].Value() != "<sip:p1.example.com;lr>, <sip:p2.example.com;lr>" {
+		t.Errorf("unexpected Route headers %v", hdrs)
+	}
+
+	strict := &sip.SipUri{
+		FHost:      "strict.example.com",
+		FUriParams: sip.NewParams().Add("method", sip.String{Str: "INVITE"}),
+		FHeaders:   sip.NewParams().Add("subject", sip.String{Str: "test"}),
+	}
+	req.ApplyRouteSet([]sip.Uri{strict, routeUri("p2.example.com")})
+	if expected := "sip:strict.example.com"; req.Recipient().String() != expected {
+		t.Errorf("expected Request-URI '%s' for strict router, got '%s'", expected, req.Recipient())
+	}
+	if routes := sip.Routes(req); len(routes) != 2 || !routes[1].Equals(target) {
+		t.Errorf("expected remote target at the end of the route set, got %v", routes)
+	}
+	if strict.UriParams().Length() != 1 {
+		t.Error("route set entry is modified")
+	}
+
+	req.ApplyRouteSet(nil)
+	if hdrs := req.GetHeaders("Route"); len(hdrs) != 0 {
+		t.Errorf("expected no Route headers, got %v", hdrs)
+	}
+}
+
+func TestRequest_ReverseRecordRoute(t *testing.T) {
+	req := sip.NewRequest(
+		"",
+		sip.INVITE,
+		&sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"},
+		"SIP/2.0",
+		[]sip.Header{
+			&sip.RecordRouteHeader{Addresses: []sip.Uri{routeUri("p2.example.com"), routeUri("p1.example.com")}},
+		},
+		"",
+		nil,
+	)
+
+	routes := req.ReverseRecordRoute()
+	if len(routes) != 2 || routes[0].Host() != "p1.example.com" || routes[1].Host() != "p2.example.com" {
+		t.Errorf("unexpected reversed route set %v", routes)
+	}
+}
@@ -0,0 +1,123 @@
+package sip
+
+// Status codes of RFC 3261 21 and its extensions.
+const (
+	StatusTrying                StatusCode = 100
+	StatusRinging               StatusCode = 180
+	StatusCallIsBeingForwarded  StatusCode = 181
+	StatusQueued                StatusCode = 182
+	StatusSessionProgress       StatusCode = 183
+	StatusEarlyDialogTerminated StatusCode = 199
+
+	StatusOK             StatusCode = 200
+	StatusAccepted       StatusCode = 202
+	StatusNoNotification StatusCode = 204
+
+	StatusMultipleChoices    StatusCode = 300
+	StatusMovedPermanently   StatusCode = 301
+	StatusMovedTemporarily   StatusCode = 302
+	StatusUseProxy           StatusCode = 305
+	StatusAlternativeService StatusCode = 380
+
+	StatusBadRequest                   StatusCode = 400
+	StatusUnauthorized                 StatusCode = 401
+	StatusPaymentRequired              StatusCode = 402
+	StatusForbidden                    StatusCode = 403
+	StatusNotFound                     StatusCode = 404
+	StatusMethodNotAllowed             StatusCode = 405
+	StatusNotAcceptable                StatusCode = 406
+	StatusProxyAuthenticationRequired  StatusCode = 407
+	StatusRequestTimeout               StatusCode = 408
+	StatusGone                         StatusCode = 410
+	StatusConditionalRequestFailed     StatusCode = 412
+	StatusRequestEntityTooLarge        StatusCode = 413
+	StatusRequestURITooLong            StatusCode = 414
+	StatusUnsupportedMediaType         StatusCode = 415
+	StatusUnsupportedURIScheme         StatusCode = 416
+	StatusUnknownResourcePriority      StatusCode = 417
+	StatusBadExtension                 StatusCode = 420
+	StatusExtensionRequired            StatusCode = 421
+	StatusSessionIntervalTooSmall      StatusCode = 422
+	StatusIntervalTooBrief             StatusCode = 423
+	StatusUseIdentityHeader            StatusCode = 428
+	StatusProvideReferrerIdentity      StatusCode = 429
+	StatusFlowFailed                   StatusCode = 430
+	StatusAnonymityDisallowed          StatusCode = 433
+	StatusBadIdentityInfo              StatusCode = 436
+	StatusUnsupportedCertificate       StatusCode = 437
+	StatusInvalidIdentityHeader        StatusCode = 438
+	StatusFirstHopLacksOutboundSupport StatusCode = 439
+	StatusMaxBreadthExceeded           StatusCode = 440
+	StatusBadInfoPackage               StatusCode = 469
+	StatusConsentNeeded                StatusCode = 470
+	StatusTemporarilyUnavailable       StatusCode = 480
+	StatusCallTransactionDoesNotExist  StatusCode = 481
+	StatusLoopDetected                 StatusCode = 482
+	StatusTooManyHops                  StatusCode = 483
+	StatusAddressIncomplete            StatusCode = 484
+	StatusAmbiguous                    StatusCode = 485
+	StatusBusyHere                     StatusCode = 486
+	StatusRequestTerminated            StatusCode = 487
+	StatusNotAcceptableHere            StatusCode = 488
+	StatusBadEvent                     StatusCode = 489
+	StatusRequestPending               StatusCode = 491
+	StatusUndecipherable               StatusCode = 493
+	StatusSecurityAgreementRequired    StatusCode = 494
+
+	StatusServerInternalError                 StatusCode = 500
+	StatusNotImplemented                      StatusCode = 501
+	StatusBadGateway                          StatusCode = 502
+	StatusServiceUnavailable                  StatusCode = 503
+	StatusServerTimeout                       StatusCode = 504
+	StatusVersionNotSupported                 StatusCode = 505
+	StatusMessageTooLarge                     StatusCode = 513
+	StatusPushNotificationServiceNotSupported StatusCode = 555
+	StatusPreconditionFailure                 StatusCode = 580
+
+	StatusBusyEverywhere        StatusCode = 600
+	StatusDecline               StatusCode = 603
+	StatusDoesNotExistAnywhere  StatusCode = 604
+	StatusNotAcceptableAnywhere StatusCode = 606
+	StatusUnwanted              StatusCode = 607
+	StatusRejected              StatusCode = 608
+)
+
+// StatusClass is a class of the status code - RFC 3261 7.2.
+type StatusClass uint8
+
+const (
+	StatusClassProvisional StatusClass = 1
+	StatusClassSuccess     StatusClass = 2
+	StatusClassRedirect    StatusClass = 3
+	StatusClassClientError StatusClass = 4
+	StatusClassServerError StatusClass = 5
+	StatusClassGlobalError StatusClass = 6
+)
+
+// Class returns class of the status code.
+func (code StatusCode) Class() StatusClass { return StatusClass(code / 100) }
+
+func (code StatusCode) IsProvisional() bool { return code >= 100 && code < 200 }
+
+func (code StatusCode) IsSuccess() bool { return code >= 200 && code < 300 }
+
+func (code StatusCode) IsRedirect() bool { return code >= 300 && code < 400 }
+
+func (code StatusCode) IsClientError() bool { return code >= 400 && code < 500 }
+
+func (code StatusCode) IsServerError() bool { return code >= 500 && code < 600 }
+
+func (code StatusCode) IsGlobalError() bool { return code >= 600 && code < 700 }
+
+// IsFinal checks that the status code is a final one (2xx - 6xx).
+func (code StatusCode) IsFinal() bool { return code >= 200 && code < 700 }
+
+// IsFailover checks that the request can be retried with the next target resolved from the same URI.
+// RFC 3263 4.3 allows failover on '503 Service Unavailable' response, and on transport errors and timeouts
+// which are represented by locally generated '408 Request Timeout'.
+func (code StatusCode) IsFailover() bool {
+	return code == StatusServiceUnavailable || code == StatusRequestTimeout
+}
+
+// Reason returns default reason phrase of the status code.
+func (code StatusCode) Reason() string { return ReasonPhrase(code) }
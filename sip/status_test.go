@@ -0,0 +1,34 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestStatusCodeHelpers(t *testing.T) {
+	if !sip.StatusRinging.IsProvisional() || sip.StatusRinging.IsFinal() {
+		t.Errorf("expected %d to be provisional", sip.StatusRinging)
+	}
+	if !sip.StatusOK.IsSuccess() || !sip.StatusOK.IsFinal() {
+		t.Errorf("expected %d to be final success", sip.StatusOK)
+	}
+	if !sip.StatusMovedTemporarily.IsRedirect() {
+		t.Errorf("expected %d to be redirect", sip.StatusMovedTemporarily)
+	}
+	if !sip.StatusBusyHere.IsClientError() || sip.StatusBusyHere.Class() != sip.StatusClassClientError {
+		t.Errorf("expected %d to be client error", sip.StatusBusyHere)
+	}
+	if !sip.StatusServiceUnavailable.IsServerError() || !sip.StatusServiceUnavailable.IsFailover() {
+		t.Errorf("expected %d to be failover-able server error", sip.StatusServiceUnavailable)
+	}
+	if sip.StatusServerInternalError.IsFailover() {
+		t.Errorf("expected %d to be not failover-able", sip.StatusServerInternalError)
+	}
+	if !sip.StatusDecline.IsGlobalError() {
+		t.Errorf("expected %d to be global error", sip.StatusDecline)
+	}
+	if reason := sip.StatusCallTransactionDoesNotExist.Reason(); reason != "Call/Transaction Does Not Exist" {
+		t.Errorf("unexpected reason of %d: %s", sip.StatusCallTransactionDoesNotExist, reason)
+	}
+}
@@ -0,0 +1,283 @@
+package sip
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultTargetQ is the q-value of Contact without 'q' parameter.
+const DefaultTargetQ = 1.0
+
+// Target is a single target URI of the target set built from Contact headers.
+type Target struct {
+	Uri Uri
+	// Q is the preference from 0 to 1, targets with higher q are tried first - RFC 3261 16.6.
+	Q float64
+	// Contact is the header the target was taken from, nil for targets added by URI.
+	Contact *ContactHeader
+
+	seq int
+}
+
+func (target *Target) String() string {
+	return fmt.Sprintf("%s;q=%s", target.Uri, strconv.FormatFloat(target.Q, 'f', -1, 64))
+}
+
+// TargetPredicate filters targets of the target set, e.g. by features of the Contact.
+type TargetPredicate func(target *Target) bool
+
+// TargetFeature matches targets which Contact has the feature parameter - RFC 3840 9.
+// Empty value matches any value of the parameter, including the flag parameter.
+func TargetFeature(name, value string) TargetPredicate {
+	return func(target *Target) bool {
+		if target.Contact == nil || target.Contact.Params == nil {
+			return false
+		}
+		for _, key := range target.Contact.Params.Keys() {
+			if !TokenEqual(key, name) {
+				continue
+			}
+			if value == "" {
+				return true
+			}
+			val, _ := target.Contact.Params.Get(key)
+			return val != nil && TokenEqual(strings.Trim(val.String(), `"`), value)
+		}
+		return false
+	}
+}
+
+// TargetSet is an ordered set of targets built from Contact headers of REGISTER bindings
+// or 3xx responses - RFC 3261 16.5.
+// Targets are ordered by q-value, targets with the same q-value keep the order they were added in.
+// Each URI is tried once: targets already attempted are not added again,
+// so contacts of redirect responses can be fed back into the set when the request is recursed.
+// URIs are compared by their canonical hash, see UriHash.
+type TargetSet struct {
+	mu        sync.Mutex
+	pending   []*Target
+	attempted map[uint64]bool
+	seq       int
+}
+
+func NewTargetSet() *TargetSet {
+	return &TargetSet{
+		attempted: make(map[uint64]bool),
+	}
+}
+
+// Add adds targets of the Contact headers, wildcard and duplicate contacts are skipped.
+// Returns number of added targets.
+func (ts *TargetSet) Add(contacts ...*ContactHeader) int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	added := 0
+	for _, contact := range contacts {
+		if contact == nil || contact.Address == nil || contact.IsWildcard() {
+			continue
+		}
+		if ts.add(contact.Address, contactQ(contact), contact) {
+			added++
+		}
+	}
+	ts.sort()
+
+	return added
+}
+
+// AddUri adds target URI with the q-value. Returns false if the URI is already in the set.
+func (ts *TargetSet) AddUri(uri Uri, q float64) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if !ts.add(uri, q, nil) {
+		return false
+	}
+	ts.sort()
+	return true
+}
+
+// AddResponse adds targets of the 3xx response Contact headers to recurse on the redirect - RFC 3261 16.5.
+// Responses of other classes are ignored.
+func (ts *TargetSet) AddResponse(res Response) int {
+	if !res.IsRedirection() {
+		return 0
+	}
+
+	contacts := make([]*ContactHeader, 0)
+	for _, hdr := range res.GetHeaders("Contact") {
+		if contact, ok := hdr.(*ContactHeader); ok {
+			contacts = append(contacts, contact)
+		}
+	}
+	return ts.Add(contacts...)
+}
+
+// Prune removes pending targets that don't match the predicate. Returns number of removed targets.
+func (ts *TargetSet) Prune(keep TargetPredicate) int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	kept := ts.pending[:0]
+	for _, target := range ts.pending {
+		if keep(target) {
+			kept = append(kept, target)
+		}
+	}
+	removed := len(ts.pending) - len(kept)
+	for i := len(kept); i < len(ts.pending); i++ {
+		ts.pending[i] = nil
+	}
+	ts.pending = kept
+
+	return removed
+}
+
+// MarkAttempted marks URI as attempted, it is removed from pending targets and will not be added again.
+func (ts *TargetSet) MarkAttempted(uri Uri) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.markAttempted(uri)
+	hash := UriHash(uri)
+	kept := ts.pending[:0]
+	for _, target := range ts.pending {
+		if UriHash(target.Uri) != hash {
+			kept = append(kept, target)
+		}
+	}
+	ts.pending = kept
+}
+
+// Attempted checks that the URI was already attempted.
+func (ts *TargetSet) Attempted(uri Uri) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.isAttempted(uri)
+}
+
+// Next pops the most preferred pending target for sequential search and marks it as attempted.
+func (ts *TargetSet) Next() (*Target, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if len(ts.pending) == 0 {
+		return nil, false
+	}
+	target := ts.pending[0]
+	ts.pending = ts.pending[1:]
+	ts.markAttempted(target.Uri)
+
+	return target, true
+}
+
+// NextGroup pops all pending targets with the highest q-value to fork the request to them in parallel,
+// groups with lower q-values are tried after the previous group fails - RFC 3261 16.6.
+// Returned targets are marked as attempted.
+func (ts *TargetSet) NextGroup() []*Target {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if len(ts.pending) == 0 {
+		return nil
+	}
+	n := 1
+	for n < len(ts.pending) && ts.pending[n].Q == ts.pending[0].Q {
+		n++
+	}
+	group := make([]*Target, n)
+	copy(group, ts.pending[:n])
+	ts.pending = ts.pending[n:]
+	for _, target := range group {
+		ts.markAttempted(target.Uri)
+	}
+
+	return group
+}
+
+// Targets returns ordered copy of the pending targets.
+func (ts *TargetSet) Targets() []*Target {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	targets := make([]*Target, len(ts.pending))
+	copy(targets, ts.pending)
+	return targets
+}
+
+// Len returns number of pending targets.
+func (ts *TargetSet) Len() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return len(ts.pending)
+}
+
+// Should be called under lock.
+func (ts *TargetSet) add(uri Uri, q float64, contact *ContactHeader) bool {
+	if ts.isAttempted(uri) {
+		return false
+	}
+	hash := UriHash(uri)
+	for _, target := range ts.pending {
+		if UriHash(target.Uri) == hash {
+			return false
+		}
+	}
+
+	ts.seq++
+	ts.pending = append(ts.pending, &Target{
+		Uri:     uri,
+		Q:       q,
+		Contact: contact,
+		seq:     ts.seq,
+	})
+	return true
+}
+
+// Should be called under lock.
+func (ts *TargetSet) sort() {
+	sort.SliceStable(ts.pending, func(i, j int) bool {
+		if ts.pending[i].Q != ts.pending[j].Q {
+			return ts.pending[i].Q > ts.pending[j].Q
+		}
+		return ts.pending[i].seq < ts.pending[j].seq
+	})
+}
+
+// Should be called under lock.
+func (ts *TargetSet) isAttempted(uri Uri) bool {
+	return ts.attempted[UriHash(uri)]
+}
+
+// Should be called under lock.
+func (ts *TargetSet) markAttempted(uri Uri) {
+	ts.attempted[UriHash(uri)] = true
+}
+
+// Returns q-value of the Contact, invalid values are clamped to [0, 1].
+func contactQ(contact *ContactHeader) float64 {
+	if contact.Params == nil {
+		return DefaultTargetQ
+	}
+	val, ok := contact.Params.Get("q")
+	if !ok || val == nil {
+		return DefaultTargetQ
+	}
+	q, err := strconv.ParseFloat(val.String(), 64)
+	if err != nil {
+		return DefaultTargetQ
+	}
+	if q < 0 {
+		return 0
+	}
+	if q > 1 {
+		return 1
+	}
+	return q
+}
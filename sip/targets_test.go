@@ -0,0 +1,75 @@
+package sip_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func targetUris(targets []*sip.Target) string {
+	uris := make([]string, len(targets))
+	for i, target := range targets {
+		uris[i] = target.Uri.String()
+	}
+	return strings.Join(uris, ",")
+}
+
+func TestTargetSet(t *testing.T) {
+	msg, err := parser.ParseMessage([]byte(strings.Join([]string{
+		"SIP/2.0 300 Multiple Choices",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"To: <sip:bob@biloxi.com>;tag=a6c85cf",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"Call-ID: a84b4c76e66710@pc33.atlanta.com",
+		"CSeq: 314159 INVITE",
+		"Contact: <sip:bob@a.biloxi.com>;q=0.5, <sip:bob@b.biloxi.com>;video",
+		"Contact: <sip:bob@c.biloxi.com>;q=0.5;video, <sip:bob@d.biloxi.com>",
+		"Contact: <sip:bob@a.biloxi.com>;q=1",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")), log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("parse message: %s", err)
+	}
+
+	ts := sip.NewTargetSet()
+	if n := ts.AddResponse(msg.(sip.Response)); n != 4 {
+		t.Errorf("unexpected number of added targets %d", n)
+	}
+	if uris := targetUris(ts.Targets()); uris != "sip:bob@b.biloxi.com,sip:bob@d.biloxi.com,sip:bob@a.biloxi.com,sip:bob@c.biloxi.com" {
+		t.Errorf("unexpected targets order %s", uris)
+	}
+
+	group := ts.NextGroup()
+	if uris := targetUris(group); uris != "sip:bob@b.biloxi.com,sip:bob@d.biloxi.com" {
+		t.Errorf("unexpected first group %s", uris)
+	}
+	if !ts.Attempted(group[0].Uri) {
+		t.Errorf("target %s must be attempted", group[0])
+	}
+	// recursion on redirect doesn't add attempted targets again
+	if n := ts.AddResponse(msg.(sip.Response)); n != 0 {
+		t.Errorf("unexpected number of added targets %d", n)
+	}
+
+	if n := ts.Prune(sip.TargetFeature("video", "")); n != 1 {
+		t.Errorf("unexpected number of pruned targets %d", n)
+	}
+	target, ok := ts.Next()
+	if !ok || target.Uri.String() != "sip:bob@c.biloxi.com" || target.Q != 0.5 {
+		t.Errorf("unexpected target %v", target)
+	}
+	if _, ok := ts.Next(); ok || ts.Len() != 0 {
+		t.Errorf("target set must be empty")
+	}
+
+	ts.AddUri(&sip.SipUri{FHost: "e.biloxi.com"}, 0.1)
+	ts.MarkAttempted(&sip.SipUri{FHost: "E.biloxi.com"})
+	if ts.Len() != 0 {
+		t.Errorf("attempted target must be removed")
+	}
+}
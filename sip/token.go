@@ -0,0 +1,79 @@
+package sip
+
+import "strings"
+
+// Tokens of SIP grammar (header, parameter and method names, option tags, transports)
+// and host names are compared case-insensitively in ASCII only - RFC 3261 7.3.1, 19.1.4.
+// Unlike strings.EqualFold and strings.ToLower the helpers below don't apply unicode case mapping,
+// so e.g. 'K' (Kelvin sign) doesn't match 'k' and the result doesn't depend on the input script.
+
+// TokenEqual reports whether tokens are equal under ASCII case folding.
+func TokenEqual(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if lowerASCII(a[i]) != lowerASCII(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenHasPrefix reports whether the token begins with prefix under ASCII case folding.
+func TokenHasPrefix(s, prefix string) bool {
+	return len(s) >= len(prefix) && TokenEqual(s[:len(prefix)], prefix)
+}
+
+// TokenLower maps ASCII upper case letters to lower case, other bytes are kept as is.
+func TokenLower(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; 'A' <= c && c <= 'Z' {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				b[j] = lowerASCII(b[j])
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+// TokenUpper maps ASCII lower case letters to upper case, other bytes are kept as is.
+func TokenUpper(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; 'a' <= c && c <= 'z' {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				if c := b[j]; 'a' <= c && c <= 'z' {
+					b[j] = c - 'a' + 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+// HasToken checks that the list contains the token, e.g. option tag of the 'Supported' header.
+func HasToken(tokens []string, token string) bool {
+	for _, t := range tokens {
+		if TokenEqual(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// HostEqual compares host names under ASCII case folding,
+// IPv6 references are equal with and without brackets.
+func HostEqual(a, b string) bool {
+	return TokenEqual(strings.Trim(a, "[]"), strings.Trim(b, "[]"))
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c - 'A' + 'a'
+	}
+	return c
+}
@@ -0,0 +1,54 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestTokenEqual(t *testing.T) {
+	cases := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"Via", "via", true},
+		{"INVITE", "invite", true},
+		{"100rel", "100REL", true},
+		{"timer", "timers", false},
+		// unicode folding is not applied: Kelvin sign, Turkish dotless i and dotted I
+		{"Key", "key", false},
+		{"ınvite", "invite", false},
+		{"İNVITE", "invite", false},
+	}
+	for _, c := range cases {
+		if equal := sip.TokenEqual(c.a, c.b); equal != c.equal {
+			t.Errorf("TokenEqual(%q, %q) = %v, expected %v", c.a, c.b, equal, c.equal)
+		}
+	}
+
+	if !sip.TokenHasPrefix("SIPS+D2T", "sips+") || sip.TokenHasPrefix("SIP", "sips") {
+		t.Error("unexpected TokenHasPrefix result")
+	}
+	if !sip.HasToken([]string{"timer", "100rel"}, "100REL") || sip.HasToken([]string{"timer"}, "path") {
+		t.Error("unexpected HasToken result")
+	}
+	if !sip.HostEqual("[::1]", "::1") || !sip.HostEqual("Example.COM", "example.com") {
+		t.Error("unexpected HostEqual result")
+	}
+}
+
+func TestTokenCase(t *testing.T) {
+	if lower := sip.TokenLower("Content-TYPE"); lower != "content-type" {
+		t.Errorf("unexpected lower case %q", lower)
+	}
+	if upper := sip.TokenUpper("invite"); upper != "INVITE" {
+		t.Errorf("unexpected upper case %q", upper)
+	}
+	// non-ASCII bytes are kept as is
+	if lower := sip.TokenLower("İD"); lower != "İd" {
+		t.Errorf("unexpected lower case %q", lower)
+	}
+	if upper := sip.TokenUpper("ıd"); upper != "ıD" {
+		t.Errorf("unexpected upper case %q", upper)
+	}
+}
@@ -1,5 +1,7 @@
 package sip
 
+import "time"
+
 type TransactionKey string
 
 func (key TransactionKey) String() string {
@@ -29,3 +31,44 @@ type ClientTransaction interface {
 	OnAck(fn func(Request))
 	OnCancel(fn func(Request))
 }
+
+// TransactionLayer owns client and server transactions. Incoming responses are matched to client transactions
+// by the top 'Via' branch and 'CSeq' method - RFC 3261 17.1.3, incoming requests are matched to server transactions
+// by the top 'Via' branch, sent-by and method - RFC 3261 17.2.3, new server transactions are created
+// on non-matched requests.
+type TransactionLayer interface {
+	// Request sends request with a new client transaction.
+	Request(req Request) (ClientTransaction, error)
+	// Respond sends response through the matched server transaction.
+	Respond(res Response) (ServerTransaction, error)
+	// ClientTransaction returns active client transaction by key.
+	ClientTransaction(key TransactionKey) (ClientTransaction, bool)
+	// ServerTransaction returns active server transaction by key.
+	ServerTransaction(key TransactionKey) (ServerTransaction, bool)
+	// Requests returns channel with new incoming server transactions.
+	Requests() <-chan ServerTransaction
+	Cancel()
+	Done() <-chan struct{}
+}
+
+// ProvisionalResponse is a provisional response received by the client transaction.
+type ProvisionalResponse struct {
+	Response   Response
+	ReceivedAt time.Time
+}
+
+// ProvisionalRecorder is implemented by client transactions that keep received provisional responses,
+// transactions of the transaction package do.
+type ProvisionalRecorder interface {
+	// Provisionals returns provisional responses received by the transaction in order of arrival.
+	Provisionals() []ProvisionalResponse
+}
+
+// Provisionals returns provisional responses received by the transaction in order of arrival,
+// nil if the transaction doesn't implement ProvisionalRecorder.
+func Provisionals(tx ClientTransaction) []ProvisionalResponse {
+	if recorder, ok := tx.(ProvisionalRecorder); ok {
+		return recorder.Provisionals()
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package sip
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// TransportProto describes the transport protocol: traits the transaction and routing layers rely on.
+type TransportProto struct {
+	// Network is the name of the protocol in the transport layer, e.g. "udp".
+	Network string
+	// ViaToken is the transport token of Via sent-protocol and 'transport' URI parameter,
+	// default is upper cased Network.
+	ViaToken string
+	// Reliable protocol doesn't need retransmissions of the transactions - RFC 3261 17.1.1.1.
+	Reliable bool
+	// Streamed protocol requires Content-Length to frame messages - RFC 3261 18.3.
+	Streamed bool
+	// Secure protocol can be used for SIPS URIs - RFC 3261 26.2.
+	Secure bool
+	// DefaultPort is used when the port is missing in URI or Via sent-by.
+	DefaultPort Port
+}
+
+// Registry of transport protocols, standard protocols can't be replaced.
+var transportProtos = struct {
+	mu    sync.RWMutex
+	set   map[string]TransportProto
+	fixed map[string]bool
+}{
+	set: map[string]TransportProto{
+		"udp": {Network: "udp", ViaToken: "UDP", DefaultPort: DefaultUdpPort},
+		"tcp": {Network: "tcp", ViaToken: "TCP", Reliable: true, Streamed: true, DefaultPort: DefaultTcpPort},
+		"tls": {Network: "tls", ViaToken: "TLS", Reliable: true, Streamed: true, Secure: true, DefaultPort: DefaultTlsPort},
+		"ws":  {Network: "ws", ViaToken: "WS", Reliable: true, DefaultPort: DefaultWsPort},
+		"wss": {Network: "wss", ViaToken: "WSS", Reliable: true, Secure: true, DefaultPort: DefaultWssPort},
+	},
+	fixed: map[string]bool{"udp": true, "tcp": true, "tls": true, "ws": true, "wss": true},
+}
+
+// RegisterTransportProto registers extension transport protocol, e.g. experimental one.
+// Registered protocol replaces the previously registered one with the same network.
+func RegisterTransportProto(proto TransportProto) error {
+	proto.Network = TokenLower(proto.Network)
+	if proto.ViaToken == "" {
+		proto.ViaToken = proto.Network
+	}
+	proto.ViaToken = TokenUpper(proto.ViaToken)
+	if !isToken(proto.Network) {
+		return fmt.Errorf("invalid transport protocol name '%s'", proto.Network)
+	}
+	if !isToken(proto.ViaToken) {
+		return fmt.Errorf("invalid transport token '%s'", proto.ViaToken)
+	}
+	if proto.DefaultPort == 0 {
+		return fmt.Errorf("missing default port of transport protocol '%s'", proto.Network)
+	}
+
+	transportProtos.mu.Lock()
+	defer transportProtos.mu.Unlock()
+
+	replaced := make([]string, 0, 1)
+	for network, registered := range transportProtos.set {
+		if network == proto.Network || registered.ViaToken == proto.ViaToken {
+			if transportProtos.fixed[network] {
+				return fmt.Errorf("standard transport protocol '%s' can't be replaced", network)
+			}
+			replaced = append(replaced, network)
+		}
+	}
+	for _, network := range replaced {
+		delete(transportProtos.set, network)
+	}
+	transportProtos.set[proto.Network] = proto
+
+	return nil
+}
+
+// LookupTransportProto returns the standard or registered transport protocol
+// by the network name or the Via transport token, case-insensitively.
+func LookupTransportProto(network string) (TransportProto, bool) {
+	network = TokenLower(network)
+
+	transportProtos.mu.RLock()
+	defer transportProtos.mu.RUnlock()
+
+	if proto, ok := transportProtos.set[network]; ok {
+		return proto, true
+	}
+	for _, proto := range transportProtos.set {
+		if TokenLower(proto.ViaToken) == network {
+			return proto, true
+		}
+	}
+	return TransportProto{}, false
+}
+
+// TransportProtos returns standard and registered transport protocols sorted by network.
+func TransportProtos() []TransportProto {
+	transportProtos.mu.RLock()
+	list := make([]TransportProto, 0, len(transportProtos.set))
+	for _, proto := range transportProtos.set {
+		list = append(list, proto)
+	}
+	transportProtos.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Network < list[j].Network
+	})
+	return list
+}
@@ -0,0 +1,69 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestLookupTransportProto(t *testing.T) {
+	for _, token := range []string{"tcp", "TCP"} {
+		proto, ok := sip.LookupTransportProto(token)
+		if !ok || proto.Network != "tcp" || !proto.Reliable || !proto.Streamed || proto.Secure {
+			t.Errorf("unexpected protocol of %s: %+v", token, proto)
+		}
+	}
+	if proto, ok := sip.LookupTransportProto("WSS"); !ok || !proto.Secure || proto.Streamed {
+		t.Errorf("unexpected protocol of WSS: %+v", proto)
+	}
+	if _, ok := sip.LookupTransportProto("SCTP"); ok {
+		t.Error("unexpected unknown protocol")
+	}
+	if port := sip.DefaultPort("SCTP"); port != sip.DefaultTcpPort {
+		t.Errorf("unexpected default port of unknown protocol %d", port)
+	}
+}
+
+func TestRegisterTransportProto(t *testing.T) {
+	if err := sip.RegisterTransportProto(sip.TransportProto{
+		Network:     "X-Unix",
+		ViaToken:    "x-uds",
+		Reliable:    true,
+		Streamed:    true,
+		DefaultPort: 5090,
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, token := range []string{"x-unix", "X-UDS"} {
+		proto, ok := sip.LookupTransportProto(token)
+		if !ok || proto.Network != "x-unix" || proto.ViaToken != "X-UDS" || !proto.Reliable {
+			t.Errorf("unexpected protocol of %s: %+v", token, proto)
+		}
+	}
+	if port := sip.DefaultPort("X-UDS"); port != 5090 {
+		t.Errorf("unexpected default port %d", port)
+	}
+
+	found := false
+	for _, proto := range sip.TransportProtos() {
+		found = found || proto.Network == "x-unix"
+	}
+	if !found {
+		t.Error("registered protocol not found in the list")
+	}
+
+	for name, proto := range map[string]sip.TransportProto{
+		"standard":  {Network: "tcp", DefaultPort: 5060},
+		"via token": {Network: "x-tcp", ViaToken: "TCP", DefaultPort: 5060},
+		"name":      {Network: "x unix", DefaultPort: 5060},
+		"port":      {Network: "x-sock"},
+	} {
+		if err := sip.RegisterTransportProto(proto); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if proto, _ := sip.LookupTransportProto("tcp"); proto.DefaultPort != sip.DefaultTcpPort {
+		t.Errorf("standard protocol is replaced: %+v", proto)
+	}
+}
@@ -0,0 +1,83 @@
+package sip
+
+// WithTransport sets 'transport' URI parameter, empty transport removes it.
+func (uri *SipUri) WithTransport(transport string) *SipUri {
+	if transport == "" {
+		return uri.DelParam("transport")
+	}
+	return uri.SetParam("transport", String{Str: TokenLower(transport)})
+}
+
+// WithUser sets the user part of the URI, empty user removes it.
+func (uri *SipUri) WithUser(user string) *SipUri {
+	if user == "" {
+		uri.FUser = nil
+		uri.FPassword = nil
+		return uri
+	}
+	uri.FUser = String{Str: user}
+	return uri
+}
+
+// WithLR sets 'lr' URI parameter marking the loose router - RFC 3261 19.1.1.
+func (uri *SipUri) WithLR() *SipUri {
+	return uri.SetParam("lr", nil)
+}
+
+// WithMAddr sets 'maddr' URI parameter, empty address removes it.
+func (uri *SipUri) WithMAddr(addr string) *SipUri {
+	if addr == "" {
+		return uri.DelParam("maddr")
+	}
+	return uri.SetParam("maddr", String{Str: addr})
+}
+
+// SetParam sets URI parameter, nil value sets a flag parameter like 'lr'.
+func (uri *SipUri) SetParam(key string, val MaybeString) *SipUri {
+	if uri.FUriParams == nil {
+		uri.FUriParams = NewParams()
+	}
+	uri.FUriParams.Add(key, val)
+	return uri
+}
+
+// DelParam removes URI parameter.
+func (uri *SipUri) DelParam(key string) *SipUri {
+	if uri.FUriParams != nil {
+		uri.FUriParams.Remove(key)
+	}
+	return uri
+}
+
+// DefaultPort returns port used when the URI has no explicit port - RFC 3261 19.1.2.
+func (uri *SipUri) DefaultPort() Port {
+	if uri.FIsEncrypted {
+		return DefaultTlsPort
+	}
+	if uri.FUriParams != nil {
+		if transport, ok := uri.FUriParams.Get("transport"); ok && transport != nil && transport.String() != "" {
+			return DefaultPort(transport.String())
+		}
+	}
+	return DefaultUdpPort
+}
+
+// Normalize brings the URI to the canonical form: lowercase host, 'transport' and 'maddr' values,
+// and no explicit port if it is equal to the default one.
+func (uri *SipUri) Normalize() *SipUri {
+	uri.FHost = TokenLower(uri.FHost)
+
+	if uri.FUriParams != nil {
+		for _, key := range []string{"transport", "maddr"} {
+			if val, ok := uri.FUriParams.Get(key); ok && val != nil {
+				uri.FUriParams.Add(key, String{Str: TokenLower(val.String())})
+			}
+		}
+	}
+
+	if uri.FPort != nil && *uri.FPort == uri.DefaultPort() {
+		uri.FPort = nil
+	}
+
+	return uri
+}
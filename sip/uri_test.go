@@ -0,0 +1,50 @@
+package sip_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+func TestSipUriMutationHelpers(t *testing.T) {
+	uri := (&sip.SipUri{FHost: "proxy.example.com"}).
+		WithUser("alice").
+		WithTransport("TCP").
+		WithLR().
+		WithMAddr("239.255.255.1").
+		SetParam("foo", sip.String{Str: "bar"})
+	if s := uri.String(); s != "sip:alice@proxy.example.com;transport=tcp;lr;maddr=239.255.255.1;foo=bar" {
+		t.Errorf("unexpected URI: %s", s)
+	}
+
+	uri.DelParam("foo").WithMAddr("").WithUser("")
+	if s := uri.String(); s != "sip:proxy.example.com;transport=tcp;lr" {
+		t.Errorf("unexpected URI: %s", s)
+	}
+}
+
+func TestSipUriNormalize(t *testing.T) {
+	port := func(p sip.Port) *sip.Port { return &p }
+
+	cases := []struct {
+		uri      *sip.SipUri
+		expected string
+	}{
+		{&sip.SipUri{FHost: "Example.COM", FPort: port(5060)}, "sip:example.com"},
+		{&sip.SipUri{FHost: "example.com", FPort: port(5061)}, "sip:example.com:5061"},
+		{&sip.SipUri{FIsEncrypted: true, FHost: "example.com", FPort: port(5061)}, "sips:example.com"},
+		{
+			(&sip.SipUri{FHost: "example.com", FPort: port(5061)}).
+				SetParam("transport", sip.String{Str: "TLS"}).
+				SetParam("maddr", sip.String{Str: "Host.Example.com"}),
+			"sip:example.com;transport=tls;maddr=host.example.com",
+		},
+		{(&sip.SipUri{FHost: "example.com", FPort: port(80)}).WithTransport("ws"), "sip:example.com;transport=ws"},
+	}
+
+	for _, c := range cases {
+		if s := c.uri.Normalize().String(); s != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, s)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package snapshot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+)
+
+const checksumFormatVersion = 1
+
+// ChecksumStore wraps any Store with integrity checksums validated on load.
+// SHA-256 is used if secret is empty, otherwise HMAC-SHA256 keyed with the secret
+// that also protects snapshots from deliberate modification.
+// Corrupted snapshots are reported with CorruptedError.
+type ChecksumStore struct {
+	store  Store
+	secret []byte
+}
+
+func NewChecksumStore(store Store, secret []byte) *ChecksumStore {
+	return &ChecksumStore{
+		store:  store,
+		secret: secret,
+	}
+}
+
+func (store *ChecksumStore) sum(key string, data []byte) []byte {
+	var h hash.Hash
+	if len(store.secret) > 0 {
+		h = hmac.New(sha256.New, store.secret)
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Blob format: version (1 byte) | checksum (32 bytes) | data.
+func (store *ChecksumStore) Save(key string, data []byte) error {
+	blob := make([]byte, 0, 1+sha256.Size+len(data))
+	blob = append(blob, checksumFormatVersion)
+	blob = append(blob, store.sum(key, data)...)
+	blob = append(blob, data...)
+
+	return store.store.Save(key, blob)
+}
+
+func (store *ChecksumStore) Load(key string) ([]byte, error) {
+	blob, err := store.store.Load(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blob) < 1+sha256.Size {
+		return nil, &CorruptedError{key, "snapshot is truncated"}
+	}
+	if blob[0] != checksumFormatVersion {
+		return nil, &CorruptedError{key, "unsupported checksum format"}
+	}
+
+	sum, data := blob[1:1+sha256.Size], blob[1+sha256.Size:]
+	if !hmac.Equal(sum, store.sum(key, data)) {
+		return nil, &CorruptedError{key, "checksum mismatch"}
+	}
+
+	return data, nil
+}
+
+func (store *ChecksumStore) Delete(key string) error {
+	return store.store.Delete(key)
+}
+
+func (store *ChecksumStore) List() ([]string, error) {
+	return store.store.List()
+}
+
+// Sum returns hex encoded SHA-256 checksum of the JSON encoding of the snapshot value.
+// Snapshot formats embed the checksum computed with the checksum field cleared
+// and verify it on restore with Verify, so corruption is detected wherever the snapshot is stored.
+func Sum(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify compares the checksum embedded into the snapshot with the key to the computed sum
+// and returns CorruptedError on mismatch.
+func Verify(key, checksum, sum string) error {
+	if !hmac.Equal([]byte(checksum), []byte(sum)) {
+		return &CorruptedError{key, "checksum mismatch"}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChecksumStore(t *testing.T) {
+	for _, secret := range [][]byte{nil, []byte("secret")} {
+		backend := NewMemoryStore()
+		store := NewChecksumStore(backend, secret)
+		data := []byte("INVITE sip:bob@example.com SIP/2.0")
+
+		if err := store.Save("tx1", data); err != nil {
+			t.Fatalf("save failed: %s", err)
+		}
+		loaded, err := store.Load("tx1")
+		if err != nil {
+			t.Fatalf("load failed: %s", err)
+		}
+		if !bytes.Equal(loaded, data) {
+			t.Errorf("expected '%s', got '%s'", data, loaded)
+		}
+
+		raw, _ := backend.Load("tx1")
+		for name, blob := range map[string][]byte{
+			"truncated": raw[:len(raw)-5],
+			"short":     raw[:10],
+			"mangled":   append(append([]byte{}, raw[:len(raw)-1]...), raw[len(raw)-1]^0xff),
+		} {
+			_ = backend.Save("tx1", blob)
+			_, err := store.Load("tx1")
+			var corrupted *CorruptedError
+			if !errors.As(err, &corrupted) || !errors.Is(err, ErrCorrupted) {
+				t.Errorf("expected CorruptedError on %s snapshot, got %v", name, err)
+			}
+		}
+	}
+}
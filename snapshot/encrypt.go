@@ -0,0 +1,163 @@
+package snapshot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const encryptedFormatVersion = 1
+
+// ErrUnknownKey is returned by KeyProvider when there is no key with the requested ID.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyProvider supplies AES keys (16, 24 or 32 bytes) for snapshots encryption.
+// Keys are identified by ID to support rotation:
+// new snapshots are encrypted with the current key while old ones can still be decrypted.
+type KeyProvider interface {
+	// CurrentKey returns key used to encrypt new snapshots.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns key by ID or ErrUnknownKey.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider with keys held in memory.
+type StaticKeyProvider struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+func NewStaticKeyProvider(id string, key []byte) *StaticKeyProvider {
+	p := &StaticKeyProvider{
+		keys: make(map[string][]byte),
+	}
+	p.Rotate(id, key)
+	return p
+}
+
+// Rotate adds a new key and makes it current, previous keys are kept for decryption.
+func (p *StaticKeyProvider) Rotate(id string, key []byte) {
+	p.mu.Lock()
+	p.keys[id] = key
+	p.current = id
+	p.mu.Unlock()
+}
+
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.current, p.keys[p.current], nil
+}
+
+func (p *StaticKeyProvider) Key(id string) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// EncryptingStore wraps any Store with AES-GCM authenticated encryption,
+// since snapshots contain full SIP messages with credentials and personal data.
+// Snapshot key is used as additional authenticated data, so encrypted blobs can't be swapped between keys.
+type EncryptingStore struct {
+	store Store
+	keys  KeyProvider
+}
+
+func NewEncryptingStore(store Store, keys KeyProvider) *EncryptingStore {
+	return &EncryptingStore{
+		store: store,
+		keys:  keys,
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Blob format: version (1 byte) | key ID length (1 byte) | key ID | nonce | ciphertext.
+func (store *EncryptingStore) Save(key string, data []byte) error {
+	keyID, encKey, err := store.keys.CurrentKey()
+	if err != nil {
+		return fmt.Errorf("get current encryption key: %w", err)
+	}
+	if len(keyID) > 255 {
+		return fmt.Errorf("encryption key ID '%s' is too long", keyID)
+	}
+
+	gcm, err := newGCM(encKey)
+	if err != nil {
+		return fmt.Errorf("init cipher with key '%s': %w", keyID, err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+
+	blob := make([]byte, 0, 2+len(keyID)+len(nonce)+len(data)+gcm.Overhead())
+	blob = append(blob, encryptedFormatVersion, byte(len(keyID)))
+	blob = append(blob, keyID...)
+	blob = append(blob, nonce...)
+	blob = gcm.Seal(blob, nonce, data, []byte(key))
+
+	return store.store.Save(key, blob)
+}
+
+func (store *EncryptingStore) Load(key string) ([]byte, error) {
+	blob, err := store.store.Load(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blob) < 2 || blob[0] != encryptedFormatVersion {
+		return nil, &CorruptedError{key, "unsupported encryption format"}
+	}
+	idLen := int(blob[1])
+	if len(blob) < 2+idLen {
+		return nil, &CorruptedError{key, "snapshot is truncated"}
+	}
+	keyID := string(blob[2 : 2+idLen])
+	blob = blob[2+idLen:]
+
+	encKey, err := store.keys.Key(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("get encryption key '%s': %w", keyID, err)
+	}
+	gcm, err := newGCM(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("init cipher with key '%s': %w", keyID, err)
+	}
+
+	if len(blob) < gcm.NonceSize() {
+		return nil, &CorruptedError{key, "snapshot is truncated"}
+	}
+	data, err := gcm.Open(nil, blob[:gcm.NonceSize()], blob[gcm.NonceSize():], []byte(key))
+	if err != nil {
+		return nil, &CorruptedError{key, fmt.Sprintf("decryption failed: %s", err)}
+	}
+
+	return data, nil
+}
+
+func (store *EncryptingStore) Delete(key string) error {
+	return store.store.Delete(key)
+}
+
+func (store *EncryptingStore) List() ([]string, error) {
+	return store.store.List()
+}
@@ -0,0 +1,86 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncryptingStore(t *testing.T) {
+	backend := NewMemoryStore()
+	keys := NewStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))
+	store := NewEncryptingStore(backend, keys)
+	data := []byte("INVITE sip:bob@example.com SIP/2.0")
+
+	if err := store.Save("tx1", data); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+
+	raw, _ := backend.Load("tx1")
+	if bytes.Contains(raw, data) {
+		t.Error("backend store contains plain snapshot")
+	}
+
+	loaded, err := store.Load("tx1")
+	if err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	if !bytes.Equal(loaded, data) {
+		t.Errorf("expected '%s', got '%s'", data, loaded)
+	}
+}
+
+func TestEncryptingStoreKeyRotation(t *testing.T) {
+	backend := NewMemoryStore()
+	keys := NewStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))
+	store := NewEncryptingStore(backend, keys)
+
+	if err := store.Save("tx1", []byte("old")); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+	keys.Rotate("k2", bytes.Repeat([]byte{2}, 16))
+	if err := store.Save("tx2", []byte("new")); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+
+	for key, expected := range map[string]string{"tx1": "old", "tx2": "new"} {
+		loaded, err := store.Load(key)
+		if err != nil {
+			t.Fatalf("load '%s' failed: %s", key, err)
+		}
+		if string(loaded) != expected {
+			t.Errorf("expected '%s', got '%s'", expected, loaded)
+		}
+	}
+
+	empty := NewEncryptingStore(backend, NewStaticKeyProvider("k2", bytes.Repeat([]byte{2}, 16)))
+	if _, err := empty.Load("tx1"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestEncryptingStoreTampered(t *testing.T) {
+	backend := NewMemoryStore()
+	store := NewEncryptingStore(backend, NewStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32)))
+
+	if err := store.Save("tx1", []byte("data")); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+
+	raw, _ := backend.Load("tx1")
+	// moved to another key
+	_ = backend.Save("tx2", raw)
+	if _, err := store.Load("tx2"); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted on snapshot moved to another key, got %v", err)
+	}
+
+	raw[len(raw)-1] ^= 0xff
+	_ = backend.Save("tx1", raw)
+	if _, err := store.Load("tx1"); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted on tampered snapshot, got %v", err)
+	}
+
+	if _, err := store.Load("tx3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
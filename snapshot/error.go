@@ -0,0 +1,27 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCorrupted matches any CorruptedError with errors.Is.
+var ErrCorrupted = errors.New("snapshot corrupted")
+
+// CorruptedError is returned on restore of a snapshot that was truncated or mangled by the storage layer.
+type CorruptedError struct {
+	Key    string
+	Reason string
+}
+
+func (err *CorruptedError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("snapshot.CorruptedError<%s>: %s", err.Key, err.Reason)
+}
+
+func (err *CorruptedError) Is(target error) bool {
+	return target == ErrCorrupted
+}
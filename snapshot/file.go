@@ -0,0 +1,93 @@
+package snapshot
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const fileExt = ".snapshot"
+
+// FileStore is a Store that keeps each snapshot in a separate file of the directory.
+// File names are hex-encoded keys, so any key is safe to use.
+// Snapshots are written to a temporary file first and renamed, so a crash never leaves a partial snapshot.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates the directory if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create snapshot directory: %w", err)
+	}
+
+	return &FileStore{dir}, nil
+}
+
+func (store *FileStore) path(key string) string {
+	return filepath.Join(store.dir, hex.EncodeToString([]byte(key))+fileExt)
+}
+
+func (store *FileStore) Save(key string, data []byte) error {
+	tmp, err := ioutil.TempFile(store.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), store.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (store *FileStore) Load(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(store.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (store *FileStore) Delete(key string) error {
+	if err := os.Remove(store.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (store *FileStore) List() ([]string, error) {
+	files, err := ioutil.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+		key, err := hex.DecodeString(strings.TrimSuffix(name, fileExt))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, string(key))
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
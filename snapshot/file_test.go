@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosip-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("create store failed: %s", err)
+	}
+
+	keys := []string{"z9hG4bK1__INVITE", "../escape/attempt"}
+	for i, key := range keys {
+		if err := store.Save(key, []byte{byte(i)}); err != nil {
+			t.Fatalf("save %s failed: %s", key, err)
+		}
+	}
+	if err := store.Save(keys[0], []byte("updated")); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+
+	listed, err := store.List()
+	if err != nil {
+		t.Fatalf("list failed: %s", err)
+	}
+	if expected := []string{keys[1], keys[0]}; !reflect.DeepEqual(listed, expected) {
+		t.Errorf("expected keys %v, got %v", expected, listed)
+	}
+
+	data, err := store.Load(keys[0])
+	if err != nil || !bytes.Equal(data, []byte("updated")) {
+		t.Errorf("unexpected loaded snapshot '%s': %v", data, err)
+	}
+
+	if err := store.Delete(keys[0]); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if err := store.Delete(keys[0]); err != nil {
+		t.Errorf("delete of missing snapshot failed: %s", err)
+	}
+	if _, err := store.Load(keys[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package snapshot
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUStore is an in-memory Store limited by the number of snapshots,
+// the least recently saved or loaded snapshot is evicted when the limit is exceeded.
+type LRUStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type lruItem struct {
+	key  string
+	data []byte
+}
+
+// NewLRUStore creates a store of the capacity, non-positive capacity means no limit.
+func NewLRUStore(capacity int) *LRUStore {
+	return &LRUStore{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (store *LRUStore) Save(key string, data []byte) error {
+	buf := make([]byte, len(data))
+	copy(buf, data)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if el, ok := store.items[key]; ok {
+		el.Value.(*lruItem).data = buf
+		store.order.MoveToFront(el)
+		return nil
+	}
+
+	store.items[key] = store.order.PushFront(&lruItem{key, buf})
+	if store.capacity > 0 && store.order.Len() > store.capacity {
+		oldest := store.order.Back()
+		store.order.Remove(oldest)
+		delete(store.items, oldest.Value.(*lruItem).key)
+	}
+	return nil
+}
+
+func (store *LRUStore) Load(key string) ([]byte, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	el, ok := store.items[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	store.order.MoveToFront(el)
+
+	data := el.Value.(*lruItem).data
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	return buf, nil
+}
+
+func (store *LRUStore) Delete(key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if el, ok := store.items[key]; ok {
+		store.order.Remove(el)
+		delete(store.items, key)
+	}
+	return nil
+}
+
+// List returns keys from the most to the least recently used.
+func (store *LRUStore) List() ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	keys := make([]string, 0, store.order.Len())
+	for el := store.order.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*lruItem).key)
+	}
+	return keys, nil
+}
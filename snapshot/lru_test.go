@@ -0,0 +1,33 @@
+package snapshot
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLRUStore(t *testing.T) {
+	store := NewLRUStore(2)
+
+	_ = store.Save("tx1", []byte("1"))
+	_ = store.Save("tx2", []byte("2"))
+	// touch tx1, so tx2 becomes the least recently used
+	if _, err := store.Load("tx1"); err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	_ = store.Save("tx3", []byte("3"))
+
+	if _, err := store.Load("tx2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected tx2 evicted, got %v", err)
+	}
+	keys, _ := store.List()
+	if expected := []string{"tx3", "tx1"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+
+	_ = store.Delete("tx1")
+	keys, _ = store.List()
+	if expected := []string{"tx3"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+}
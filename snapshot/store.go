@@ -0,0 +1,78 @@
+// Package snapshot provides persistence of serialized transaction and timer snapshots.
+package snapshot
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound is returned when there is no snapshot with the requested key.
+var ErrNotFound = errors.New("snapshot not found")
+
+// Store persists serialized snapshots by key.
+type Store interface {
+	Save(key string, data []byte) error
+	// Load returns ErrNotFound if there is no snapshot with the key.
+	Load(key string) ([]byte, error)
+	Delete(key string) error
+	// List returns keys of all stored snapshots.
+	List() ([]string, error)
+}
+
+// MemoryStore is an in-memory Store implementation.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	items map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		items: make(map[string][]byte),
+	}
+}
+
+func (store *MemoryStore) Save(key string, data []byte) error {
+	buf := make([]byte, len(data))
+	copy(buf, data)
+
+	store.mu.Lock()
+	store.items[key] = buf
+	store.mu.Unlock()
+
+	return nil
+}
+
+func (store *MemoryStore) Load(key string) ([]byte, error) {
+	store.mu.RLock()
+	data, ok := store.items[key]
+	store.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	return buf, nil
+}
+
+func (store *MemoryStore) Delete(key string) error {
+	store.mu.Lock()
+	delete(store.items, key)
+	store.mu.Unlock()
+
+	return nil
+}
+
+func (store *MemoryStore) List() ([]string, error) {
+	store.mu.RLock()
+	keys := make([]string, 0, len(store.items))
+	for key := range store.items {
+		keys = append(keys, key)
+	}
+	store.mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys, nil
+}
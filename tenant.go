@@ -0,0 +1,216 @@
+package gosip
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// TenantConfig describes a logical SIP service served by the server.
+type TenantConfig struct {
+	// Name is an unique tenant name, can be used as a namespace of tenant data (registrar bindings etc).
+	Name string
+	// LocalAddrs are listening addresses (host:port) that belong to the tenant.
+	LocalAddrs []string
+	// Domains are matched against the Request-URI host and then against the 'To' header host,
+	// wildcard domains like '*.example.com' match any subdomain.
+	Domains []string
+	// Realm is an authentication realm of the tenant.
+	Realm string
+	// MaxConcurrentRequests limits number of requests handled simultaneously,
+	// exceeded requests are rejected with '503 Service Unavailable'. Zero means unlimited.
+	MaxConcurrentRequests int
+}
+
+// Tenant is a logical SIP service with isolated set of request handlers.
+type Tenant interface {
+	Name() string
+	Realm() string
+	OnRequest(method sip.RequestMethod, handler RequestHandler, options ...HandlerOption) error
+}
+
+type tenantKey struct{}
+
+// TenantOf returns tenant selected for the incoming request.
+func TenantOf(req sip.Request) (Tenant, bool) {
+	tenant, ok := sip.MessageMetadata(req).Value(tenantKey{}).(Tenant)
+	return tenant, ok
+}
+
+type tenant struct {
+	config TenantConfig
+
+	mu              sync.RWMutex
+	requestHandlers map[sip.RequestMethod]RequestHandler
+	handlerOptions  map[sip.RequestMethod]*HandlerOptions
+	active          int
+}
+
+func newTenant(config TenantConfig) *tenant {
+	return &tenant{
+		config:          config,
+		requestHandlers: make(map[sip.RequestMethod]RequestHandler),
+		handlerOptions:  make(map[sip.RequestMethod]*HandlerOptions),
+	}
+}
+
+func (t *tenant) String() string {
+	if t == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("gosip.Tenant<%s>", t.config.Name)
+}
+
+func (t *tenant) Name() string {
+	return t.config.Name
+}
+
+func (t *tenant) Realm() string {
+	return t.config.Realm
+}
+
+func (t *tenant) OnRequest(method sip.RequestMethod, handler RequestHandler, options ...HandlerOption) error {
+	if err := checkMethod(method); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.requestHandlers[method] = handler
+	t.handlerOptions[method] = applyHandlerOptions(options...)
+	t.mu.Unlock()
+
+	return nil
+}
+
+func (t *tenant) handler(method sip.RequestMethod) (RequestHandler, *HandlerOptions, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	handler, ok := t.requestHandlers[method]
+	return handler, t.handlerOptions[method], ok
+}
+
+func (t *tenant) allowedMethods() []sip.RequestMethod {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return allowedMethods(t.requestHandlers)
+}
+
+// Takes a slot for the request handling, returns false if limit is exceeded.
+func (t *tenant) acquire() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.config.MaxConcurrentRequests > 0 && t.active >= t.config.MaxConcurrentRequests {
+		return false
+	}
+	t.active++
+	return true
+}
+
+func (t *tenant) release() {
+	t.mu.Lock()
+	t.active--
+	t.mu.Unlock()
+}
+
+func (t *tenant) servesAddr(addr string) bool {
+	for _, localAddr := range t.config.LocalAddrs {
+		if localAddr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tenant) servesDomain(host string) bool {
+	for _, domain := range t.config.Domains {
+		if matchDomain(domain, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantStore keeps server tenants in order of addition.
+type tenantStore struct {
+	mu      sync.RWMutex
+	tenants []*tenant
+}
+
+func (store *tenantStore) add(t *tenant) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, other := range store.tenants {
+		if other.Name() == t.Name() {
+			return fmt.Errorf("tenant '%s' already exists", t.Name())
+		}
+	}
+	store.tenants = append(store.tenants, t)
+	return nil
+}
+
+func (store *tenantStore) remove(name string) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for i, t := range store.tenants {
+		if t.Name() == name {
+			store.tenants = append(store.tenants[:i], store.tenants[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (store *tenantStore) get(name string) (*tenant, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, t := range store.tenants {
+		if t.Name() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Selects tenant of the incoming request by listening socket,
+// then by Request-URI host and then by 'To' header host.
+func (store *tenantStore) match(req sip.Request) (*tenant, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	if len(store.tenants) == 0 {
+		return nil, false
+	}
+
+	if dest := req.Destination(); dest != "" {
+		for _, t := range store.tenants {
+			if t.servesAddr(dest) {
+				return t, true
+			}
+		}
+	}
+
+	hosts := make([]string, 0, 2)
+	if uri := req.Recipient(); uri != nil {
+		hosts = append(hosts, uri.Host())
+	}
+	if to, ok := req.To(); ok && to.Address != nil {
+		hosts = append(hosts, to.Address.Host())
+	}
+	for _, host := range hosts {
+		for _, t := range store.tenants {
+			if t.servesDomain(host) {
+				return t, true
+			}
+		}
+	}
+
+	return nil, false
+}
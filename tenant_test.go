@@ -0,0 +1,86 @@
+package gosip_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("GoSIP Server tenants", func() {
+	var (
+		srv     gosip.Server
+		client1 net.Conn
+	)
+
+	clientAddr := "127.0.0.1:9002"
+	localTarget := transport.NewTarget("127.0.0.1", 5062)
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		srv = gosip.NewServer(gosip.ServerConfig{}, nil, nil, logger)
+		Expect(srv.Listen("udp", localTarget.Addr())).To(Succeed())
+	})
+
+	AfterEach(func() {
+		srv.Shutdown()
+	}, 3)
+
+	It("should reject tenant with duplicate name", func() {
+		_, err := srv.AddTenant(gosip.TenantConfig{Name: "acme"})
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = srv.AddTenant(gosip.TenantConfig{Name: "acme"})
+		Expect(err).Should(HaveOccurred())
+
+		t, ok := srv.Tenant("acme")
+		Expect(ok).To(BeTrue())
+		Expect(t.Name()).To(Equal("acme"))
+		Expect(srv.RemoveTenant("acme")).To(BeTrue())
+		_, ok = srv.Tenant("acme")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should route request to the tenant selected by Request-URI domain", func(done Done) {
+		defer close(done)
+
+		acme, err := srv.AddTenant(gosip.TenantConfig{
+			Name:    "acme",
+			Domains: []string{"acme.example.com"},
+			Realm:   "acme",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(srv.OnRequest(sip.INVITE, func(req sip.Request, tx sip.ServerTransaction) {
+			Fail("global handler called for tenant request")
+		})).To(Succeed())
+
+		handled := make(chan gosip.Tenant, 1)
+		Expect(acme.OnRequest(sip.INVITE, func(req sip.Request, tx sip.ServerTransaction) {
+			t, _ := gosip.TenantOf(req)
+			handled <- t
+		})).To(Succeed())
+
+		client1 = testutils.CreateClient("udp", localTarget.Addr(), clientAddr)
+		defer func() {
+			Expect(client1.Close()).To(BeNil())
+		}()
+		inviteReq := testutils.Request([]string{
+			"INVITE sip:bob@ACME.example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@acme.example.com>",
+			"CSeq: 1 INVITE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+		testutils.WriteToConn(client1, []byte(inviteReq.String()))
+
+		Expect((<-handled).Name()).To(Equal("acme"))
+	}, 3)
+})
@@ -0,0 +1,203 @@
+package testutils
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// DefaultScriptTimeout is a default time to wait for an expected inbound message.
+const DefaultScriptTimeout = time.Second
+
+// EndpointTransport is a transport used by ScriptedEndpoint.
+// transport.Layer fits it as is, MockTransportLayer.Peer returns in-memory one.
+type EndpointTransport interface {
+	Messages() <-chan sip.Message
+	Send(msg sip.Message) error
+}
+
+// ScriptError is returned by ScriptedEndpoint.Run when the remote side deviates from the script.
+type ScriptError struct {
+	Step        int
+	Description string
+	Reason      string
+	Message     sip.Message
+}
+
+func (err *ScriptError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	s := fmt.Sprintf("testutils.ScriptError: step %d '%s' failed: %s", err.Step, err.Description, err.Reason)
+	if err.Message != nil {
+		s += fmt.Sprintf(", got %s", err.Message.Short())
+	}
+	return s
+}
+
+type scriptStep struct {
+	description string
+	timeout     time.Duration
+	// inbound step
+	match func(msg sip.Message) bool
+	// outbound step
+	build func(last sip.Message) (sip.Message, error)
+}
+
+// ScriptedEndpoint plays back a declared sequence of expected inbound and sent outbound messages
+// acting as a remote SIP endpoint in end-to-end tests.
+//
+//	ep := testutils.NewScriptedEndpoint(tpl.Peer()).
+//	    ExpectRequest(sip.INVITE).
+//	    Respond(180, "Ringing").
+//	    Respond(200, "OK").
+//	    ExpectRequest(sip.ACK)
+//	Expect(<-ep.Start()).To(Succeed())
+type ScriptedEndpoint struct {
+	// Timeout is applied to expected steps declared without explicit timeout.
+	Timeout time.Duration
+
+	tp    EndpointTransport
+	steps []scriptStep
+
+	mu       sync.Mutex
+	received []sip.Message
+}
+
+func NewScriptedEndpoint(tp EndpointTransport) *ScriptedEndpoint {
+	return &ScriptedEndpoint{
+		Timeout: DefaultScriptTimeout,
+		tp:      tp,
+	}
+}
+
+// Expect declares inbound message step, description is used in failure reports.
+func (ep *ScriptedEndpoint) Expect(description string, match func(msg sip.Message) bool) *ScriptedEndpoint {
+	return ep.ExpectWithin(description, 0, match)
+}
+
+// ExpectWithin declares inbound message step that must be completed within the timeout.
+func (ep *ScriptedEndpoint) ExpectWithin(
+	description string,
+	timeout time.Duration,
+	match func(msg sip.Message) bool,
+) *ScriptedEndpoint {
+	ep.steps = append(ep.steps, scriptStep{
+		description: description,
+		timeout:     timeout,
+		match:       match,
+	})
+	return ep
+}
+
+// ExpectRequest declares inbound request step with the method.
+func (ep *ScriptedEndpoint) ExpectRequest(method sip.RequestMethod) *ScriptedEndpoint {
+	return ep.Expect(fmt.Sprintf("expect %s", method), func(msg sip.Message) bool {
+		req, ok := msg.(sip.Request)
+		return ok && req.Method() == method
+	})
+}
+
+// ExpectResponse declares inbound response step with the status code.
+func (ep *ScriptedEndpoint) ExpectResponse(code sip.StatusCode) *ScriptedEndpoint {
+	return ep.Expect(fmt.Sprintf("expect %d", code), func(msg sip.Message) bool {
+		res, ok := msg.(sip.Response)
+		return ok && res.StatusCode() == code
+	})
+}
+
+// Send declares outbound step, build receives the last inbound message or nil.
+func (ep *ScriptedEndpoint) Send(description string, build func(last sip.Message) (sip.Message, error)) *ScriptedEndpoint {
+	ep.steps = append(ep.steps, scriptStep{
+		description: description,
+		build:       build,
+	})
+	return ep
+}
+
+// SendMessage declares outbound step that sends the message as is.
+func (ep *ScriptedEndpoint) SendMessage(msg sip.Message) *ScriptedEndpoint {
+	return ep.Send(fmt.Sprintf("send %s", msg.Short()), func(last sip.Message) (sip.Message, error) {
+		return msg, nil
+	})
+}
+
+// Respond declares outbound step that responds on the last inbound request.
+func (ep *ScriptedEndpoint) Respond(code sip.StatusCode, reason string, headers ...sip.Header) *ScriptedEndpoint {
+	return ep.Send(fmt.Sprintf("respond %d", code), func(last sip.Message) (sip.Message, error) {
+		req, ok := last.(sip.Request)
+		if !ok {
+			return nil, fmt.Errorf("no request to respond on")
+		}
+
+		res := sip.NewResponseFromRequest("", req, code, reason, "")
+		for _, h := range headers {
+			res.AppendHeader(h.Clone())
+		}
+		return res, nil
+	})
+}
+
+// Run plays the script back, it blocks until all steps are done or the first failure.
+func (ep *ScriptedEndpoint) Run() error {
+	var last sip.Message
+	for i, step := range ep.steps {
+		if step.build != nil {
+			msg, err := step.build(last)
+			if err != nil {
+				return &ScriptError{Step: i + 1, Description: step.description, Reason: err.Error()}
+			}
+			if err := ep.tp.Send(msg); err != nil {
+				return &ScriptError{Step: i + 1, Description: step.description, Reason: err.Error(), Message: msg}
+			}
+			continue
+		}
+
+		timeout := step.timeout
+		if timeout <= 0 {
+			timeout = ep.Timeout
+		}
+
+		select {
+		case msg, ok := <-ep.tp.Messages():
+			if !ok {
+				return &ScriptError{Step: i + 1, Description: step.description, Reason: "transport closed"}
+			}
+
+			ep.mu.Lock()
+			ep.received = append(ep.received, msg)
+			ep.mu.Unlock()
+
+			if !step.match(msg) {
+				return &ScriptError{Step: i + 1, Description: step.description, Reason: "unexpected message", Message: msg}
+			}
+			last = msg
+		case <-time.After(timeout):
+			return &ScriptError{Step: i + 1, Description: step.description, Reason: fmt.Sprintf("timed out after %s", timeout)}
+		}
+	}
+
+	return nil
+}
+
+// Start plays the script back in background, result of Run is sent to the returned channel.
+func (ep *ScriptedEndpoint) Start() <-chan error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- ep.Run()
+	}()
+	return errs
+}
+
+// Received returns all inbound messages received so far.
+func (ep *ScriptedEndpoint) Received() []sip.Message {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	received := make([]sip.Message, len(ep.received))
+	copy(received, ep.received)
+	return received
+}
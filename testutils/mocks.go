@@ -175,3 +175,32 @@ func (tpl *MockTransportLayer) Cancel() {
 func (tpl *MockTransportLayer) Done() <-chan struct{} {
 	return tpl.done
 }
+
+// Peer returns in-memory transport of the remote side:
+// it receives messages sent through the mock layer and delivers sent messages to the layer.
+func (tpl *MockTransportLayer) Peer() *MockTransportPeer {
+	return &MockTransportPeer{tpl}
+}
+
+type MockTransportPeer struct {
+	tpl *MockTransportLayer
+}
+
+func (peer *MockTransportPeer) Messages() <-chan sip.Message {
+	return peer.tpl.OutMsgs
+}
+
+func (peer *MockTransportPeer) Send(msg sip.Message) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = io.EOF
+		}
+	}()
+
+	select {
+	case <-peer.tpl.done:
+		return io.EOF
+	case peer.tpl.InMsgs <- msg:
+		return nil
+	}
+}
@@ -0,0 +1,70 @@
+package timing
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/ghettovoice/gosip/log"
+)
+
+// PanicHandler handles panic recovered from the timer callback.
+// Timer is an identity of the timer, recovered is a value returned by recover().
+type PanicHandler func(timer string, recovered interface{}, stack []byte)
+
+// PanicPolicy describes handling of panics recovered from timer callbacks,
+// it is set per timer. Zero value only logs reports with the default logger.
+type PanicPolicy struct {
+	// Logger receives panic reports, log.NewDefaultLogrusLogger is used if nil.
+	Logger log.Logger
+	// Handler is called with the recovered panic after it is logged.
+	Handler PanicHandler
+	// RePanic re-raises the panic after handling.
+	RePanic bool
+}
+
+var panicCount uint64
+
+// PanicCount returns number of panics recovered from protected timer callbacks.
+func PanicCount() uint64 {
+	return atomic.LoadUint64(&panicCount)
+}
+
+// Protect wraps timer callback with panic recovery of the zero PanicPolicy,
+// so a panic inside one callback doesn't kill the whole process.
+func Protect(timer string, f func()) func() {
+	return PanicPolicy{}.Protect(timer, f)
+}
+
+// Protect wraps timer callback with panic recovery handled according to the policy.
+func (policy PanicPolicy) Protect(timer string, f func()) func() {
+	return func() {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			atomic.AddUint64(&panicCount, 1)
+
+			stack := debug.Stack()
+			logger := policy.Logger
+			if logger == nil {
+				logger = log.NewDefaultLogrusLogger()
+			}
+			logger.WithFields(log.Fields{
+				"timer": timer,
+				"panic": fmt.Sprintf("%v", recovered),
+			}).Errorf("timer callback panicked:\n%s", stack)
+
+			if policy.Handler != nil {
+				policy.Handler(timer, recovered, stack)
+			}
+			if policy.RePanic {
+				panic(recovered)
+			}
+		}()
+
+		f()
+	}
+}
@@ -0,0 +1,75 @@
+package timing
+
+// Tests for the timer callbacks panic recovery.
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProtect(t *testing.T) {
+	reports := make(chan string, 1)
+	policy := PanicPolicy{
+		Handler: func(timer string, recovered interface{}, stack []byte) {
+			reports <- timer
+		},
+	}
+
+	count := PanicCount()
+	policy.Protect("test_timer", func() {
+		panic("boom")
+	})()
+
+	select {
+	case timer := <-reports:
+		if timer != "test_timer" {
+			t.Errorf("expected report for 'test_timer', got '%s'", timer)
+		}
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("panic was not reported")
+	}
+	if PanicCount() != count+1 {
+		t.Errorf("expected panic count %d, got %d", count+1, PanicCount())
+	}
+}
+
+func TestProtectRePanic(t *testing.T) {
+	defer func() {
+		if recovered := recover(); recovered != "boom" {
+			t.Errorf("expected re-panic with 'boom', got %v", recovered)
+		}
+	}()
+	PanicPolicy{RePanic: true}.Protect("test_timer", func() {
+		panic("boom")
+	})()
+}
+
+func TestRecurringTimerPanicPolicy(t *testing.T) {
+	MockMode = true
+	defer func() { MockMode = false }()
+
+	reports := make(chan string, 1)
+	timer := NewRecurringTimer(RecurringOptions{
+		Name:     "refresh",
+		Interval: 5 * time.Second,
+		MaxCount: 1,
+		Panics: PanicPolicy{
+			Handler: func(timer string, recovered interface{}, stack []byte) {
+				reports <- timer
+			},
+		},
+	}, func() {
+		panic("boom")
+	})
+	defer timer.Stop()
+
+	Elapse(5 * time.Second)
+	select {
+	case timer := <-reports:
+		if timer != "refresh" {
+			t.Errorf("expected report for 'refresh', got '%s'", timer)
+		}
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("panic was not reported")
+	}
+}
@@ -0,0 +1,297 @@
+package timing
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/snapshot"
+)
+
+// RecurringOptions describes schedule of a RecurringTimer.
+type RecurringOptions struct {
+	// Name identifies the timer in panic reports.
+	Name string
+	// Interval between fires.
+	Interval time.Duration
+	// Jitter is a maximum random deviation added to each interval.
+	Jitter time.Duration
+	// MaxCount limits number of fires, zero means unlimited.
+	MaxCount int
+	// Panics configures handling of panics recovered from the callback.
+	Panics PanicPolicy
+}
+
+// RecurringSnapshot is a serializable state of a RecurringTimer.
+// Schedule is stored as a duration left to the next fire measured with the monotonic clock,
+// so the snapshot is not affected by wall clock changes between capture and restore.
+type RecurringSnapshot struct {
+	Name     string
+	Interval time.Duration
+	Jitter   time.Duration
+	// TakenAt is a time when the snapshot was captured.
+	TakenAt time.Time
+	// Left is a duration left to the next fire at the moment of capture.
+	Left time.Duration
+	// Remaining is a number of fires left, negative value means unlimited.
+	Remaining int
+	// Paused indicates that the timer is paused, time doesn't count down for paused timer.
+	Paused bool
+	// Checksum is verified on restore to detect corruption in the storage, see snapshot.Sum.
+	// Snapshots without checksum, e.g. built by hand, are restored unchecked.
+	Checksum string
+}
+
+// Returns checksum of the snapshot computed with the checksum field cleared.
+func recurringSum(s RecurringSnapshot) string {
+	s.Checksum = ""
+	return snapshot.Sum(s)
+}
+
+func verifyRecurring(s RecurringSnapshot) error {
+	if s.Checksum == "" {
+		return nil
+	}
+	return snapshot.Verify("timer "+s.Name, s.Checksum, recurringSum(s))
+}
+
+// Elapsed returns time passed since the snapshot capture.
+// Monotonic clock is used while the snapshot is restored in the same process,
+// otherwise the wall clock is used and backward jumps are ignored.
+func (snapshot RecurringSnapshot) Elapsed() time.Duration {
+	if elapsed := Now().Sub(snapshot.TakenAt); elapsed > 0 {
+		return elapsed
+	}
+	return 0
+}
+
+// Verify checks the snapshot checksum, corrupted snapshot is reported with snapshot.CorruptedError.
+func (snapshot RecurringSnapshot) Verify() error {
+	return verifyRecurring(snapshot)
+}
+
+// RecurringTimer calls function periodically with optional jitter and fires limit.
+// Can be used for registration refresh, keep-alive and subscription refresh
+// instead of manual rescheduling of one-shot timers.
+type RecurringTimer interface {
+	// Stops the timer, preventing further fires.
+	// Returns true if the timer had been active, and false if it had expired or been stopped.
+	Stop() bool
+	// Returns current state of the timer that can be restored with RestoreRecurringTimer.
+	Snapshot() RecurringSnapshot
+	// Suspends the timer keeping duration left to the next fire.
+	// Returns false if the timer had been already paused or stopped.
+	Pause() bool
+	// Resumes paused timer, the next fire happens after the duration left on pause.
+	// Returns false if the timer had not been paused.
+	Resume() bool
+	// Returns time of the next fire, zero time if the timer is paused or stopped.
+	Deadline() time.Time
+	// Returns duration left to the next fire, zero if the timer is stopped.
+	Remaining() time.Duration
+}
+
+type recurringTimer struct {
+	mu        sync.Mutex
+	name      string
+	interval  time.Duration
+	jitter    time.Duration
+	remaining int
+	nextFire  time.Time
+	timer     Timer
+	stopped   bool
+	paused    bool
+	left      time.Duration
+	gen       uint64 // bumped by Pause and Resume, fires scheduled before are stale
+	panics    PanicPolicy
+	f         func()
+}
+
+// NewRecurringTimer creates a new RecurringTimer that calls f according to the options.
+func NewRecurringTimer(opts RecurringOptions, f func()) RecurringTimer {
+	remaining := opts.MaxCount
+	if remaining <= 0 {
+		remaining = -1
+	}
+
+	t := &recurringTimer{
+		name:      opts.Name,
+		interval:  opts.Interval,
+		jitter:    opts.Jitter,
+		remaining: remaining,
+		panics:    opts.Panics,
+		f:         f,
+	}
+
+	t.mu.Lock()
+	t.schedule(t.nextInterval())
+	t.mu.Unlock()
+
+	return t
+}
+
+// RestoreRecurringTimer creates a RecurringTimer from the snapshot.
+// Time elapsed since the capture is subtracted from the time left to the next fire,
+// missed fire is scheduled immediately. Corrupted snapshot is reported with snapshot.CorruptedError.
+// Panics of f are handled according to the policy, it is not a part of the snapshot.
+func RestoreRecurringTimer(snapshot RecurringSnapshot, panics PanicPolicy, f func()) (RecurringTimer, error) {
+	if err := snapshot.Verify(); err != nil {
+		return nil, err
+	}
+
+	t := &recurringTimer{
+		name:      snapshot.Name,
+		interval:  snapshot.Interval,
+		jitter:    snapshot.Jitter,
+		remaining: snapshot.Remaining,
+		panics:    panics,
+		f:         f,
+	}
+
+	t.mu.Lock()
+	if t.remaining == 0 {
+		t.stopped = true
+	} else if snapshot.Paused {
+		t.paused = true
+		t.left = snapshot.Left
+	} else {
+		t.schedule(snapshot.Left - snapshot.Elapsed())
+	}
+	t.mu.Unlock()
+
+	return t, nil
+}
+
+func (t *recurringTimer) nextInterval() time.Duration {
+	d := t.interval
+	if t.jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(t.jitter)))
+	}
+	return d
+}
+
+func (t *recurringTimer) schedule(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	t.nextFire = Now().Add(d)
+	gen := t.gen
+	t.timer = AfterFunc(d, func() { t.fire(gen) })
+}
+
+func (t *recurringTimer) fire(gen uint64) {
+	t.mu.Lock()
+	if t.stopped || t.paused || gen != t.gen {
+		t.mu.Unlock()
+		return
+	}
+	if t.remaining > 0 {
+		t.remaining--
+	}
+	if t.remaining == 0 {
+		t.stopped = true
+	} else {
+		t.schedule(t.nextInterval())
+	}
+	t.mu.Unlock()
+
+	t.panics.Protect(t.name, t.f)()
+}
+
+func (t *recurringTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped {
+		return false
+	}
+	t.stopped = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	return true
+}
+
+func (t *recurringTimer) Pause() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped || t.paused {
+		return false
+	}
+	t.paused = true
+	t.gen++
+	t.timer.Stop()
+	t.left = t.nextFire.Sub(Now())
+	if t.left < 0 {
+		t.left = 0
+	}
+	return true
+}
+
+func (t *recurringTimer) Resume() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped || !t.paused {
+		return false
+	}
+	t.paused = false
+	t.gen++
+	t.schedule(t.left)
+	t.left = 0
+	return true
+}
+
+func (t *recurringTimer) Deadline() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped || t.paused {
+		return time.Time{}
+	}
+	return t.nextFire
+}
+
+func (t *recurringTimer) Remaining() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case t.stopped:
+		return 0
+	case t.paused:
+		return t.left
+	}
+	if left := t.nextFire.Sub(Now()); left > 0 {
+		return left
+	}
+	return 0
+}
+
+func (t *recurringTimer) Snapshot() RecurringSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := Now()
+	snapshot := RecurringSnapshot{
+		Name:      t.name,
+		Interval:  t.interval,
+		Jitter:    t.jitter,
+		TakenAt:   now,
+		Remaining: t.remaining,
+	}
+	switch {
+	case t.stopped:
+		snapshot.Remaining = 0
+	case t.paused:
+		snapshot.Paused = true
+		snapshot.Left = t.left
+	default:
+		if left := t.nextFire.Sub(now); left > 0 {
+			snapshot.Left = left
+		}
+	}
+	snapshot.Checksum = recurringSum(snapshot)
+	return snapshot
+}
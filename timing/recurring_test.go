@@ -0,0 +1,217 @@
+package timing
+
+// Tests for the recurring timer.
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/snapshot"
+)
+
+func expectFire(t *testing.T, done <-chan struct{}, msg string) {
+	select {
+	case <-done:
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal(msg)
+	}
+}
+
+func expectNoFire(t *testing.T, done <-chan struct{}, msg string) {
+	select {
+	case <-done:
+		t.Fatal(msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRecurringTimer(t *testing.T) {
+	MockMode = true
+	done := make(chan struct{}, 1)
+	timer := NewRecurringTimer(RecurringOptions{Interval: 5 * time.Second}, func() {
+		done <- struct{}{}
+	})
+	defer timer.Stop()
+
+	for i := 0; i < 3; i++ {
+		Elapse(5 * time.Second)
+		expectFire(t, done, "RecurringTimer didn't fire at its interval.")
+	}
+}
+
+func TestRecurringTimerMaxCount(t *testing.T) {
+	MockMode = true
+	done := make(chan struct{}, 1)
+	timer := NewRecurringTimer(RecurringOptions{Interval: 5 * time.Second, MaxCount: 2}, func() {
+		done <- struct{}{}
+	})
+
+	Elapse(5 * time.Second)
+	expectFire(t, done, "RecurringTimer didn't fire first time.")
+	Elapse(5 * time.Second)
+	expectFire(t, done, "RecurringTimer didn't fire second time.")
+	Elapse(5 * time.Second)
+	expectNoFire(t, done, "RecurringTimer fired after max count reached.")
+
+	if timer.Stop() {
+		t.Error("Stop() on exhausted RecurringTimer returned true")
+	}
+}
+
+func TestRecurringTimerStop(t *testing.T) {
+	MockMode = true
+	done := make(chan struct{}, 1)
+	timer := NewRecurringTimer(RecurringOptions{Interval: 5 * time.Second}, func() {
+		done <- struct{}{}
+	})
+
+	if !timer.Stop() {
+		t.Error("Stop() on active RecurringTimer returned false")
+	}
+	Elapse(5 * time.Second)
+	expectNoFire(t, done, "RecurringTimer fired after being stopped.")
+}
+
+func TestRecurringTimerSnapshot(t *testing.T) {
+	MockMode = true
+	done := make(chan struct{}, 1)
+	timer := NewRecurringTimer(RecurringOptions{Interval: 5 * time.Second, MaxCount: 3}, func() {
+		done <- struct{}{}
+	})
+
+	Elapse(5 * time.Second)
+	expectFire(t, done, "RecurringTimer didn't fire at its interval.")
+	Elapse(2 * time.Second)
+
+	snapshot := timer.Snapshot()
+	timer.Stop()
+	if snapshot.Remaining != 2 {
+		t.Errorf("expected 2 remaining fires, got %d", snapshot.Remaining)
+	}
+	if snapshot.Left != 3*time.Second {
+		t.Errorf("expected 3s left to the next fire, got %s", snapshot.Left)
+	}
+
+	restored, err := RestoreRecurringTimer(snapshot, PanicPolicy{}, func() {
+		done <- struct{}{}
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer restored.Stop()
+
+	Elapse(3 * time.Second)
+	expectFire(t, done, "restored RecurringTimer didn't fire at its next fire time.")
+	if remaining := restored.Snapshot().Remaining; remaining != 1 {
+		t.Errorf("expected 1 remaining fire, got %d", remaining)
+	}
+}
+
+func TestRecurringTimerPauseResume(t *testing.T) {
+	MockMode = true
+	done := make(chan struct{}, 1)
+	timer := NewRecurringTimer(RecurringOptions{Interval: 5 * time.Second}, func() {
+		done <- struct{}{}
+	})
+	defer timer.Stop()
+
+	Elapse(2 * time.Second)
+	if !timer.Pause() {
+		t.Fatal("Pause() on active RecurringTimer returned false")
+	}
+	if timer.Pause() {
+		t.Error("Pause() on paused RecurringTimer returned true")
+	}
+	if !timer.Deadline().IsZero() {
+		t.Errorf("expected zero deadline of paused RecurringTimer, got %s", timer.Deadline())
+	}
+
+	Elapse(10 * time.Second)
+	expectNoFire(t, done, "RecurringTimer fired while paused.")
+	if left := timer.Remaining(); left != 3*time.Second {
+		t.Errorf("expected 3s remaining, got %s", left)
+	}
+
+	if !timer.Resume() {
+		t.Fatal("Resume() on paused RecurringTimer returned false")
+	}
+	if expected := Now().Add(3 * time.Second); !timer.Deadline().Equal(expected) {
+		t.Errorf("expected deadline %s, got %s", expected, timer.Deadline())
+	}
+
+	Elapse(3 * time.Second)
+	expectFire(t, done, "resumed RecurringTimer didn't fire after time left on pause.")
+}
+
+func TestRecurringTimerStaleFire(t *testing.T) {
+	MockMode = true
+	done := make(chan struct{}, 2)
+	timer := NewRecurringTimer(RecurringOptions{Interval: 5 * time.Second, MaxCount: 2}, func() {
+		done <- struct{}{}
+	})
+	defer timer.Stop()
+
+	rt := timer.(*recurringTimer)
+	rt.mu.Lock()
+	stale := rt.gen
+	rt.mu.Unlock()
+
+	Elapse(2 * time.Second)
+	timer.Pause()
+	timer.Resume()
+	// the fire of the schedule before Pause raced with it and comes late
+	rt.fire(stale)
+	expectNoFire(t, done, "stale fire called the function.")
+	if remaining := timer.Snapshot().Remaining; remaining != 2 {
+		t.Errorf("expected 2 remaining fires, got %d", remaining)
+	}
+
+	Elapse(3 * time.Second)
+	expectFire(t, done, "resumed RecurringTimer didn't fire after time left on pause.")
+}
+
+func TestRecurringSnapshotElapsed(t *testing.T) {
+	MockMode = true
+	done := make(chan struct{}, 1)
+	timer := NewRecurringTimer(RecurringOptions{Interval: 5 * time.Second}, func() {
+		done <- struct{}{}
+	})
+	snapshot := timer.Snapshot()
+	timer.Stop()
+
+	Elapse(2 * time.Second)
+	if elapsed := snapshot.Elapsed(); elapsed != 2*time.Second {
+		t.Errorf("expected 2s elapsed, got %s", elapsed)
+	}
+
+	// wall clock moved backwards after the capture
+	snapshot.TakenAt = Now().Add(time.Hour)
+	snapshot.Checksum = recurringSum(snapshot)
+	if elapsed := snapshot.Elapsed(); elapsed != 0 {
+		t.Errorf("expected zero elapsed for snapshot from the future, got %s", elapsed)
+	}
+
+	restored, err := RestoreRecurringTimer(snapshot, PanicPolicy{}, func() {
+		done <- struct{}{}
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer restored.Stop()
+
+	Elapse(5 * time.Second)
+	expectFire(t, done, "restored RecurringTimer didn't fire after time left on capture.")
+}
+
+func TestRecurringSnapshotCorrupted(t *testing.T) {
+	MockMode = true
+	timer := NewRecurringTimer(RecurringOptions{Name: "refresh", Interval: 5 * time.Second, MaxCount: 3}, func() {})
+	corrupted := timer.Snapshot()
+	timer.Stop()
+
+	corrupted.Remaining = 100
+	if _, err := RestoreRecurringTimer(corrupted, PanicPolicy{}, func() {}); !errors.Is(err, snapshot.ErrCorrupted) {
+		t.Errorf("expected snapshot.ErrCorrupted on mangled snapshot, got %v", err)
+	}
+}
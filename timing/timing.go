@@ -29,33 +29,6 @@ type Timer interface {
 	Stop() bool
 }
 
-// Implementation of Timer that just wraps time.Timer.
-type realTimer struct {
-	*time.Timer
-}
-
-func (t *realTimer) C() <-chan time.Time {
-	return t.Timer.C
-}
-
-func (t *realTimer) Reset(d time.Duration) bool {
-	t.Stop()
-	return t.Timer.Reset(d)
-}
-
-func (t *realTimer) Stop() bool {
-	// return t.Timer.Stop()
-	if !t.Timer.Stop() {
-		select {
-		case <-t.Timer.C:
-			return true
-		default:
-			return false
-		}
-	}
-	return true
-}
-
 // Implementation of Timer that mocks time.Timer, firing when the total elapsed time (as controlled by Elapse)
 // exceeds the duration specified when the timer was constructed.
 type mockTimer struct {
@@ -98,7 +71,7 @@ func (t *mockTimer) Stop() bool {
 	return true
 }
 
-// Creates a new Timer; either a wrapper around a standard Go time.Timer, or a mocked-out Timer,
+// Creates a new Timer; either a timer scheduled on the shared timer wheel, or a mocked-out Timer,
 // depending on whether MockMode is set.
 func NewTimer(d time.Duration) Timer {
 	if MockMode {
@@ -112,7 +85,7 @@ func NewTimer(d time.Duration) Timer {
 		}
 		return &t
 	} else {
-		return &realTimer{time.NewTimer(d)}
+		return defaultWheel.NewTimer(d)
 	}
 }
 
@@ -137,7 +110,7 @@ func AfterFunc(d time.Duration, f func()) Timer {
 		}
 		return &t
 	} else {
-		return &realTimer{time.AfterFunc(d, f)}
+		return defaultWheel.AfterFunc(d, f)
 	}
 }
 
@@ -0,0 +1,196 @@
+package timing
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// WheelTick is a resolution of the shared timer wheel.
+	WheelTick = 10 * time.Millisecond
+	// WheelSize is a number of slots of the shared timer wheel.
+	WheelSize = 512
+)
+
+// Shared hashed timer wheel that serves all real timers.
+// It keeps a single ticking goroutine instead of a runtime timer per pending timer,
+// which matters when hundreds of thousands of transaction timers are scheduled.
+var defaultWheel = newWheel(WheelTick, WheelSize)
+
+// Hashed timer wheel.
+// Each slot holds timers that expire on that slot after the remaining number of rounds.
+// Ticking goroutine is started on the first scheduled timer and exits when the wheel becomes empty.
+type wheel struct {
+	mu      sync.Mutex
+	tick    time.Duration
+	slots   []*list.List
+	pos     int
+	last    time.Time // time of the last tick
+	pending int
+	running bool
+}
+
+func newWheel(tick time.Duration, size int) *wheel {
+	w := &wheel{
+		tick:  tick,
+		slots: make([]*list.List, size),
+	}
+	for i := range w.slots {
+		w.slots[i] = list.New()
+	}
+	return w
+}
+
+// Implementation of Timer that is scheduled on the timer wheel.
+type wheelTimer struct {
+	wheel  *wheel
+	c      chan time.Time
+	f      func()
+	slot   int
+	rounds int
+	elem   *list.Element
+}
+
+func (w *wheel) NewTimer(d time.Duration) Timer {
+	t := &wheelTimer{
+		wheel: w,
+		c:     make(chan time.Time, 1),
+	}
+	w.schedule(t, d)
+	return t
+}
+
+func (w *wheel) AfterFunc(d time.Duration, f func()) Timer {
+	t := &wheelTimer{
+		wheel: w,
+		f:     f,
+	}
+	w.schedule(t, d)
+	return t
+}
+
+func (w *wheel) schedule(t *wheelTimer, d time.Duration) {
+	w.mu.Lock()
+	now := time.Now()
+	if d <= 0 {
+		t.fire(now)
+		w.mu.Unlock()
+		return
+	}
+
+	if !w.running {
+		w.last = now
+	}
+	// count from the last tick and round up, so the timer never fires early
+	d += now.Sub(w.last)
+	ticks := int((d + w.tick - 1) / w.tick)
+	t.slot = (w.pos + ticks) % len(w.slots)
+	t.rounds = (ticks - 1) / len(w.slots)
+	t.elem = w.slots[t.slot].PushBack(t)
+	w.pending++
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+	w.mu.Unlock()
+}
+
+// Removes timer from the wheel, returns false if it has already expired or been stopped.
+func (w *wheel) remove(t *wheelTimer) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t.elem == nil {
+		return false
+	}
+	w.slots[t.slot].Remove(t.elem)
+	t.elem = nil
+	w.pending--
+	return true
+}
+
+func (w *wheel) run() {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if !w.advance(now) {
+			return
+		}
+	}
+}
+
+// Moves wheel to the next slot and fires timers expired on it,
+// returns false when the wheel becomes empty and the ticking goroutine should exit.
+// Timers are fired under the lock, so Stop or Reset that finds the timer removed
+// always finds the value in the channel and drains it.
+func (w *wheel) advance(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.last = now
+	w.pos = (w.pos + 1) % len(w.slots)
+	slot := w.slots[w.pos]
+
+	for e := slot.Front(); e != nil; {
+		next := e.Next()
+		t := e.Value.(*wheelTimer)
+		if t.rounds > 0 {
+			t.rounds--
+		} else {
+			slot.Remove(e)
+			t.elem = nil
+			w.pending--
+			t.fire(now)
+		}
+		e = next
+	}
+
+	if w.pending == 0 {
+		w.running = false
+		return false
+	}
+	return true
+}
+
+// Delivers expiration of the timer, must be called under the wheel lock.
+func (t *wheelTimer) fire(now time.Time) {
+	if t.f != nil {
+		go t.f()
+		return
+	}
+
+	// Clear the channel if something is already in it.
+	select {
+	case <-t.c:
+	default:
+	}
+	// Never block the wheel goroutine, the channel may be filled by Reset with d <= 0.
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+func (t *wheelTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *wheelTimer) Reset(d time.Duration) bool {
+	wasActive := t.Stop()
+	t.wheel.schedule(t, d)
+	return wasActive
+}
+
+func (t *wheelTimer) Stop() bool {
+	if !t.wheel.remove(t) {
+		select {
+		case <-t.c:
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package timing
+
+// Tests for the timer wheel.
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWheelTimer(t *testing.T) {
+	w := newWheel(time.Millisecond, 8)
+	start := time.Now()
+	timer := w.NewTimer(20 * time.Millisecond)
+
+	select {
+	case <-timer.C():
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("timer fired too early: %s", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire")
+	}
+}
+
+func TestWheelAfterFunc(t *testing.T) {
+	w := newWheel(time.Millisecond, 8)
+	done := make(chan struct{})
+	w.AfterFunc(5*time.Millisecond, func() {
+		close(done)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("function was not called")
+	}
+}
+
+func TestWheelStop(t *testing.T) {
+	w := newWheel(time.Millisecond, 8)
+	timer := w.AfterFunc(5*time.Millisecond, func() {
+		t.Error("stopped timer fired")
+	})
+
+	if !timer.Stop() {
+		t.Error("Stop() on pending timer returned false")
+	}
+	if timer.Stop() {
+		t.Error("Stop() on stopped timer returned true")
+	}
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestWheelReset(t *testing.T) {
+	w := newWheel(time.Millisecond, 8)
+	done := make(chan time.Time, 1)
+	start := time.Now()
+	timer := w.AfterFunc(5*time.Millisecond, func() {
+		done <- time.Now()
+	})
+
+	if !timer.Reset(30 * time.Millisecond) {
+		t.Error("Reset() on pending timer returned false")
+	}
+
+	select {
+	case firedAt := <-done:
+		if elapsed := firedAt.Sub(start); elapsed < 30*time.Millisecond {
+			t.Errorf("reset timer fired too early: %s", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reset timer did not fire")
+	}
+}
+
+func TestWheelNotEarly(t *testing.T) {
+	w := newWheel(10*time.Millisecond, 8)
+	count := 50
+	fired := make(chan time.Duration, count)
+	for i := 0; i < count; i++ {
+		// schedule between the wheel ticks
+		time.Sleep(time.Millisecond)
+		start := time.Now()
+		w.AfterFunc(10*time.Millisecond, func() {
+			fired <- time.Since(start)
+		})
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case elapsed := <-fired:
+			if elapsed < 10*time.Millisecond {
+				t.Fatalf("timer fired too early: %s", elapsed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of %d timers fired", i, count)
+		}
+	}
+}
+
+func TestWheelResetWhileFiring(t *testing.T) {
+	w := newWheel(time.Millisecond, 8)
+	// the test ticks the wheel as fast as possible instead of the ticking goroutine
+	w.running = true
+	w.last = time.Now()
+	timers := make([]Timer, 50)
+	for i := range timers {
+		timers[i] = w.NewTimer(time.Millisecond)
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				w.advance(time.Now())
+				runtime.Gosched()
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	for i := 0; i < 2000; i++ {
+		timer := timers[i%len(timers)]
+		timer.Reset(time.Millisecond)
+		// land the next Reset at different moments around the firing tick
+		for j := 0; j < i%6; j++ {
+			runtime.Gosched()
+		}
+		// the old expiration is either drained or not delivered at all
+		timer.Reset(24 * time.Hour)
+		runtime.Gosched()
+		select {
+		case <-timer.C():
+			t.Fatalf("stale expiration delivered after Reset on iteration %d", i)
+		default:
+		}
+	}
+}
+
+func TestWheelFireNonBlocking(t *testing.T) {
+	w := newWheel(time.Millisecond, 8)
+	timer := w.NewTimer(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	// channel is full, synchronous fire must not block
+	done := make(chan struct{})
+	go func() {
+		timer.(*wheelTimer).fire(time.Now())
+		timer.(*wheelTimer).fire(time.Now())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("fire blocked on full channel")
+	}
+	<-timer.C()
+}
+
+func TestWheelManyTimers(t *testing.T) {
+	w := newWheel(time.Millisecond, 8)
+	count := 10000
+	done := make(chan struct{}, count)
+	for i := 0; i < count; i++ {
+		// spread over several wheel rounds
+		w.AfterFunc(time.Duration(i%50+1)*time.Millisecond, func() {
+			done <- struct{}{}
+		})
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of %d timers fired", i, count)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending != 0 {
+		t.Errorf("wheel has %d pending timers", w.pending)
+	}
+}
@@ -16,6 +16,7 @@ type ClientTx interface {
 	Tx
 	Responses() <-chan sip.Response
 	Cancel() error
+	Provisionals() []sip.ProvisionalResponse
 
 	OnAck(fn func(sip.Request))
 	OnCancel(fn func(sip.Request))
@@ -24,13 +25,23 @@ type ClientTx interface {
 type clientTx struct {
 	commonTx
 	responses    chan sip.Response
+	t1           time.Duration // Retransmission interval T1, may be adapted to the destination RTT.
+	timers       TimerOptions
 	timer_a_time time.Duration // Current duration of timer A.
 	timer_a      timing.Timer
 	timer_b      timing.Timer
+	timer_c_time time.Duration // Duration of proxy timer C, zero if disabled.
+	timer_c      timing.Timer
 	timer_d_time time.Duration // Current duration of timer D.
 	timer_d      timing.Timer
 	timer_m      timing.Timer
 	reliable     bool
+	resent       bool
+	sampled      bool
+	provisionals []sip.ProvisionalResponse
+	rseqs        map[string]uint32 // Last acknowledged RSeq by 'To' tag.
+	pracks       uint32
+	congestion   *CongestionControl
 
 	mu        sync.RWMutex
 	closeOnce sync.Once
@@ -39,6 +50,20 @@ type clientTx struct {
 }
 
 func NewClientTx(origin sip.Request, tpl sip.Transport, logger log.Logger) (ClientTx, error) {
+	return NewClientTxWithOptions(origin, tpl, logger)
+}
+
+func NewClientTxWithOptions(
+	origin sip.Request,
+	tpl sip.Transport,
+	logger log.Logger,
+	options ...ClientTransactionOption,
+) (ClientTx, error) {
+	opts := ClientTransactionOptions{}
+	for _, opt := range options {
+		opt.ApplyClientTransaction(&opts)
+	}
+
 	origin = prepareClientRequest(origin)
 	key, err := MakeClientTxKey(origin)
 	if err != nil {
@@ -65,6 +90,11 @@ func NewClientTx(origin sip.Request, tpl sip.Transport, logger log.Logger) (Clie
 		"transaction_key": tx.key,
 	}).(sip.Request)
 	tx.reliable = tx.tpl.IsReliable(origin.Transport())
+	tx.timers = opts.Timers
+	tx.t1 = T1
+	if opts.Timers.T1 > 0 {
+		tx.t1 = opts.Timers.T1
+	}
 
 	return tx, nil
 }
@@ -108,22 +138,24 @@ func (tx *clientTx) Init() error {
 		return err
 	}
 
-	if tx.reliable {
-		tx.mu.Lock()
-		tx.timer_d_time = 0
-		tx.mu.Unlock()
-	} else {
+	tx.mu.Lock()
+	// the transport layer may select another transport while sending, e.g. fall back
+	// from TCP to UDP or follow NAPTR records, it is pinned to the sent request
+	tx.reliable = tx.tpl.IsReliable(tx.Origin().Transport())
+	tx.timer_d_time = tx.waitInterval()
+	tx.mu.Unlock()
+
+	if !tx.reliable {
 		// RFC 3261 - 17.1.1.2.
 		// If an unreliable transport is being used, the client transaction MUST start timer A with a value of T1.
 		// If a reliable transport is being used, the client transaction SHOULD NOT
 		// start timer A (Timer A controls request retransmissions).
 		// Timer A - retransmission
-		tx.Log().Tracef("timer_a set to %v", Timer_A)
-
 		tx.mu.Lock()
-		tx.timer_a_time = Timer_A
+		tx.timer_a_time = tx.retransmitInterval()
+		tx.Log().Tracef("timer_a set to %v", tx.timer_a_time)
 
-		tx.timer_a = timing.AfterFunc(tx.timer_a_time, func() {
+		tx.timer_a = timing.AfterFunc(tx.timer_a_time, tx.timerFunc("timer_a", func() {
 			select {
 			case <-tx.done:
 				return
@@ -137,17 +169,16 @@ func (tx *clientTx) Init() error {
 				tx.Log().Errorf("spin FSM to client_input_timer_a failed: %s", err)
 			}
 			tx.fsmMu.RUnlock()
-		})
-		// Timer D is set to 32 seconds for unreliable transports
-		tx.timer_d_time = Timer_D
+		}))
 		tx.mu.Unlock()
 	}
 
 	// Timer B - timeout
-	tx.Log().Tracef("timer_b set to %v", Timer_B)
-
 	tx.mu.Lock()
-	tx.timer_b = timing.AfterFunc(Timer_B, func() {
+	timerB := tx.timeoutInterval()
+	tx.Log().Tracef("timer_b set to %v", timerB)
+
+	tx.timer_b = timing.AfterFunc(timerB, tx.timerFunc("timer_b", func() {
 		select {
 		case <-tx.done:
 			return
@@ -161,9 +192,11 @@ func (tx *clientTx) Init() error {
 			tx.Log().Errorf("spin FSM to client_input_timer_b failed: %s", err)
 		}
 		tx.fsmMu.RUnlock()
-	})
+	}))
 	tx.mu.Unlock()
 
+	tx.startTimerC()
+
 	tx.mu.RLock()
 	err := tx.lastErr
 	tx.mu.RUnlock()
@@ -171,6 +204,48 @@ func (tx *clientTx) Init() error {
 	return err
 }
 
+// RFC 3261 - 16.6 step 11, 16.7 step 2.
+// Timer C guards INVITE forwarded by a proxy, it is reset by provisional responses other than 100.
+// On fire the branch is canceled if a provisional response was received,
+// otherwise the transaction times out, which the TU treats as 408 - RFC 3261 16.8.
+func (tx *clientTx) startTimerC() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.timer_c_time <= 0 || !tx.Origin().IsInvite() {
+		return
+	}
+
+	tx.Log().Tracef("timer_c set to %v", tx.timer_c_time)
+
+	tx.timer_c = timing.AfterFunc(tx.timer_c_time, tx.timerFunc("timer_c", func() {
+		select {
+		case <-tx.done:
+			return
+		default:
+		}
+
+		tx.Log().Trace("timer_c fired")
+
+		tx.mu.RLock()
+		lastResp := tx.lastResp
+		tx.mu.RUnlock()
+
+		switch {
+		case lastResp == nil:
+			tx.fsmMu.RLock()
+			if err := tx.fsm.Spin(client_input_timer_b); err != nil {
+				tx.Log().Errorf("spin FSM to client_input_timer_b failed: %s", err)
+			}
+			tx.fsmMu.RUnlock()
+		case lastResp.IsProvisional():
+			if err := tx.Cancel(); err != nil {
+				tx.Log().Errorf("cancel on timer_c failed: %s", err)
+			}
+		}
+	}))
+}
+
 func (tx *clientTx) Receive(msg sip.Message) error {
 	res, ok := msg.(sip.Response)
 	if !ok {
@@ -190,6 +265,18 @@ func (tx *clientTx) Receive(msg sip.Message) error {
 	} else {
 		tx.mu.Lock()
 		tx.lastResp = res
+		if res.IsProvisional() {
+			tx.provisionals = append(tx.provisionals, sip.ProvisionalResponse{
+				Response:   res,
+				ReceivedAt: timing.Now(),
+			})
+			if tx.timer_c != nil && res.StatusCode() > 100 {
+				tx.timer_c.Reset(tx.timer_c_time)
+			}
+		} else if tx.timer_c != nil {
+			tx.timer_c.Stop()
+			tx.timer_c = nil
+		}
 		tx.mu.Unlock()
 
 		switch {
@@ -212,6 +299,17 @@ func (tx *clientTx) Responses() <-chan sip.Response {
 	return tx.responses
 }
 
+// Provisionals returns copy of the provisional responses history.
+func (tx *clientTx) Provisionals() []sip.ProvisionalResponse {
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+
+	provisionals := make([]sip.ProvisionalResponse, len(tx.provisionals))
+	copy(provisionals, tx.provisionals)
+
+	return provisionals
+}
+
 func (tx *clientTx) Cancel() error {
 	tx.fsmMu.RLock()
 	defer tx.fsmMu.RUnlock()
@@ -423,7 +521,7 @@ func (tx *clientTx) initInviteFSM() {
 		},
 	}
 
-	fsm_, err := fsm.Define(
+	fsm_, err := tx.defineFSM(
 		client_state_def_calling,
 		client_state_def_proceeding,
 		client_state_def_completed,
@@ -503,7 +601,7 @@ func (tx *clientTx) initNonInviteFSM() {
 		},
 	}
 
-	fsm_, err := fsm.Define(
+	fsm_, err := tx.defineFSM(
 		client_state_def_calling,
 		client_state_def_proceeding,
 		client_state_def_completed,
@@ -536,6 +634,17 @@ func (tx *clientTx) resend() {
 	tx.lastErr = err
 	tx.mu.Unlock()
 
+	if err != nil && tx.congestion != nil && tx.congestion.suppress(tx.Origin().Destination(), err) {
+		tx.Log().Debugf("resend origin request failed on congestion, wait for the next retransmission: %s", err)
+
+		tx.mu.Lock()
+		if tx.timer_a != nil {
+			tx.timer_a.Reset(tx.backoff(tx.timer_a_time))
+		}
+		tx.mu.Unlock()
+
+		return
+	}
 	if err != nil {
 		go func() {
 			tx.fsmMu.RLock()
@@ -585,7 +694,7 @@ func (tx *clientTx) timeoutErr() {
 	defer func() { recover() }()
 
 	err := &TxTimeoutError{
-		fmt.Errorf("transaction timed out"),
+		ErrTimeout,
 		tx.Key(),
 		fmt.Sprintf("%p", tx),
 	}
@@ -628,6 +737,10 @@ func (tx *clientTx) delete() {
 		tx.timer_b.Stop()
 		tx.timer_b = nil
 	}
+	if tx.timer_c != nil {
+		tx.timer_c.Stop()
+		tx.timer_c = nil
+	}
 	if tx.timer_d != nil {
 		tx.timer_d.Stop()
 		tx.timer_d = nil
@@ -658,7 +771,8 @@ func (tx *clientTx) act_invite_resend() fsm.Input {
 	tx.mu.Lock()
 
 	tx.timer_a_time *= 2
-	tx.timer_a.Reset(tx.timer_a_time)
+	tx.timer_a.Reset(tx.backoff(tx.timer_a_time))
+	tx.resent = true
 
 	tx.mu.Unlock()
 
@@ -682,10 +796,11 @@ func (tx *clientTx) act_non_invite_resend() fsm.Input {
 
 	tx.timer_a_time *= 2
 	// For non-INVITE, cap timer A at T2 seconds.
-	if tx.timer_a_time > T2 {
-		tx.timer_a_time = T2
+	if t2 := tx.timers.t2(); tx.timer_a_time > t2 {
+		tx.timer_a_time = t2
 	}
-	tx.timer_a.Reset(tx.timer_a_time)
+	tx.timer_a.Reset(tx.backoff(tx.timer_a_time))
+	tx.resent = true
 
 	tx.mu.Unlock()
 
@@ -751,7 +866,7 @@ func (tx *clientTx) act_invite_final() fsm.Input {
 
 	tx.Log().Tracef("timer_d set to %v", tx.timer_d_time)
 
-	tx.timer_d = timing.AfterFunc(tx.timer_d_time, func() {
+	tx.timer_d = timing.AfterFunc(tx.timer_d_time, tx.timerFunc("timer_d", func() {
 		select {
 		case <-tx.done:
 			return
@@ -765,7 +880,7 @@ func (tx *clientTx) act_invite_final() fsm.Input {
 			tx.Log().Errorf("spin FSM to client_input_timer_d failed: %s", err)
 		}
 		tx.fsmMu.RUnlock()
-	})
+	}))
 
 	tx.mu.Unlock()
 
@@ -790,7 +905,7 @@ func (tx *clientTx) act_non_invite_final() fsm.Input {
 
 	tx.Log().Tracef("timer_d set to %v", tx.timer_d_time)
 
-	tx.timer_d = timing.AfterFunc(tx.timer_d_time, func() {
+	tx.timer_d = timing.AfterFunc(tx.timer_d_time, tx.timerFunc("timer_d", func() {
 		select {
 		case <-tx.done:
 			return
@@ -804,7 +919,7 @@ func (tx *clientTx) act_non_invite_final() fsm.Input {
 			tx.Log().Errorf("spin FSM to client_input_timer_d failed: %s", err)
 		}
 		tx.fsmMu.RUnlock()
-	})
+	}))
 
 	tx.mu.Unlock()
 
@@ -830,7 +945,7 @@ func (tx *clientTx) act_cancel_timeout() fsm.Input {
 	if tx.timer_b != nil {
 		tx.timer_b.Stop()
 	}
-	tx.timer_b = timing.AfterFunc(Timer_B, func() {
+	tx.timer_b = timing.AfterFunc(Timer_B, tx.timerFunc("timer_b", func() {
 		select {
 		case <-tx.done:
 			return
@@ -844,7 +959,7 @@ func (tx *clientTx) act_cancel_timeout() fsm.Input {
 			tx.Log().Errorf("spin FSM to client_input_timer_b failed: %s", err)
 		}
 		tx.fsmMu.RUnlock()
-	})
+	}))
 	tx.mu.Unlock()
 
 	return fsm.NO_INPUT
@@ -927,7 +1042,7 @@ func (tx *clientTx) act_passup_accept() fsm.Input {
 
 	tx.Log().Tracef("timer_m set to %v", Timer_M)
 
-	tx.timer_m = timing.AfterFunc(Timer_M, func() {
+	tx.timer_m = timing.AfterFunc(Timer_M, tx.timerFunc("timer_m", func() {
 		select {
 		case <-tx.done:
 			return
@@ -941,7 +1056,7 @@ func (tx *clientTx) act_passup_accept() fsm.Input {
 			tx.Log().Errorf("spin FSM to client_input_timer_m failed: %s", err)
 		}
 		tx.fsmMu.RUnlock()
-	})
+	}))
 	tx.mu.Unlock()
 
 	return fsm.NO_INPUT
@@ -954,3 +1069,78 @@ func (tx *clientTx) act_delete() fsm.Input {
 
 	return fsm.NO_INPUT
 }
+
+// setTimerC enables proxy timer C before Init.
+func (tx *clientTx) setTimerC(d time.Duration) {
+	tx.mu.Lock()
+	tx.timer_c_time = d
+	tx.mu.Unlock()
+}
+
+// Initial retransmission interval: timer A of INVITE, timer E of non-INVITE - RFC 3261 17.1.1.2, 17.1.2.2.
+func (tx *clientTx) retransmitInterval() time.Duration {
+	if !tx.origin.IsInvite() && tx.timers.TimerE > 0 {
+		return tx.timers.TimerE
+	}
+	return tx.t1
+}
+
+// Transaction timeout: timer B of INVITE, timer F of non-INVITE.
+func (tx *clientTx) timeoutInterval() time.Duration {
+	if !tx.origin.IsInvite() && tx.timers.TimerF > 0 {
+		return tx.timers.TimerF
+	}
+	return 64 * tx.t1
+}
+
+// Wait time for response retransmissions: timer D of INVITE, timer K of non-INVITE,
+// zero for reliable transports.
+func (tx *clientTx) waitInterval() time.Duration {
+	switch {
+	case tx.reliable:
+		return 0
+	case tx.origin.IsInvite():
+		return Timer_D
+	case tx.timers.TimerK > 0:
+		return tx.timers.TimerK
+	default:
+		return tx.timers.t4()
+	}
+}
+
+// setCongestion enables congestion control of retransmissions before Init.
+func (tx *clientTx) setCongestion(cc *CongestionControl) {
+	tx.mu.Lock()
+	tx.congestion = cc
+	tx.mu.Unlock()
+}
+
+// Retransmission interval adapted to the destination congestion.
+func (tx *clientTx) backoff(interval time.Duration) time.Duration {
+	if tx.congestion == nil {
+		return interval
+	}
+	return tx.congestion.Backoff(tx.origin.Destination(), interval)
+}
+
+// setT1 overrides T1 before Init.
+func (tx *clientTx) setT1(t1 time.Duration) {
+	tx.mu.Lock()
+	tx.t1 = t1
+	tx.mu.Unlock()
+}
+
+// takeRTTSample reports whether the response may be used as RTT sample:
+// only the first response is taken and only if the request was not retransmitted,
+// since samples of retransmitted requests are ambiguous (Karn's algorithm).
+func (tx *clientTx) takeRTTSample() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.resent || tx.sampled {
+		return false
+	}
+	tx.sampled = true
+
+	return true
+}
@@ -36,6 +36,32 @@ var _ = Describe("ClientTx", func() {
 		})
 	})
 
+	Context("sends ACK request without transaction", func() {
+		It("should add Via with branch and pass request to transport", func(done Done) {
+			ack := testutils.Request([]string{
+				"ACK sip:bob@example.com SIP/2.0",
+				"CSeq: 1 ACK",
+				"",
+				"",
+			})
+
+			go func() {
+				defer GinkgoRecover()
+				Expect(txl.Send(ack)).To(Succeed())
+			}()
+
+			msg := <-tpl.OutMsgs
+			Expect(msg).To(Equal(ack))
+			viaHop, ok := msg.ViaHop()
+			Expect(ok).To(BeTrue())
+			Expect(viaHop.Params.Has("branch")).To(BeTrue())
+
+			_, err := txl.Request(ack)
+			Expect(err).To(HaveOccurred())
+			close(done)
+		}, 3)
+	})
+
 	Context("sends INVITE request", func() {
 		var err error
 		var invite, trying, ok, notOk, ack, canceled sip.Message
@@ -208,6 +234,11 @@ var _ = Describe("ClientTx", func() {
 				msg = <-tx.Responses()
 				Expect(msg).ToNot(BeNil())
 				Expect(msg.String()).To(Equal(notOk.String()))
+
+				provisionals := sip.Provisionals(tx)
+				Expect(provisionals).To(HaveLen(1))
+				Expect(provisionals[0].Response.String()).To(Equal(trying.String()))
+				Expect(provisionals[0].ReceivedAt.IsZero()).To(BeFalse())
 			})
 		})
 
@@ -271,3 +302,60 @@ var _ = Describe("ClientTx", func() {
 		})
 	})
 })
+
+// fallbackTransport sends requests over UDP whatever transport they select,
+// like the transport layer falling back from TCP to UDP.
+type fallbackTransport struct {
+	msgs chan sip.Message
+	mu   sync.Mutex
+	sent int
+}
+
+func (tpl *fallbackTransport) Messages() <-chan sip.Message   { return tpl.msgs }
+func (tpl *fallbackTransport) IsReliable(network string) bool { return network != "UDP" }
+func (tpl *fallbackTransport) IsStreamed(network string) bool { return network != "UDP" }
+
+func (tpl *fallbackTransport) Send(msg sip.Message) error {
+	tpl.mu.Lock()
+	defer tpl.mu.Unlock()
+
+	msg.SetTransport("UDP")
+	tpl.sent++
+	return nil
+}
+
+func (tpl *fallbackTransport) sends() int {
+	tpl.mu.Lock()
+	defer tpl.mu.Unlock()
+	return tpl.sent
+}
+
+var _ = Describe("ClientTx with transport fallback", func() {
+	It("should retransmit request sent over unreliable transport selected on sending", func() {
+		tpl := &fallbackTransport{msgs: make(chan sip.Message)}
+		txl := transaction.NewLayerWithOptions(tpl, testutils.NewLogrusLogger(),
+			transaction.WithTimers(transaction.TimerOptions{T1: 20 * time.Millisecond}),
+		)
+		defer func() {
+			txl.Cancel()
+			<-txl.Done()
+		}()
+
+		req := testutils.Request([]string{
+			"MESSAGE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/TCP 10.0.0.1:5070;branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: fallback",
+			"CSeq: 1 MESSAGE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+		Expect(req.Transport()).To(Equal("TCP"))
+
+		_, err := txl.Request(req)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(tpl.sends, time.Second).Should(BeNumerically(">=", 3))
+	})
+})
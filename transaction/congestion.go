@@ -0,0 +1,197 @@
+package transaction
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ghettovoice/gosip/timing"
+)
+
+// CongestionMode defines reaction of transactions on the congestion of the destination.
+type CongestionMode int
+
+const (
+	// CongestionStrict keeps RFC 3261 retransmission schedule, congestion is only reported with events.
+	CongestionStrict CongestionMode = iota
+	// CongestionConservative backs off retransmissions to the congested destination faster than
+	// the standard schedule and keeps transactions alive on congestion errors of retransmissions,
+	// so the transactions time out by timer B/F instead of failing on the transport error.
+	CongestionConservative
+)
+
+// Default values of CongestionControl.
+const (
+	DefaultCongestionHold     = 32 * time.Second
+	DefaultCongestionMaxLevel = 3
+)
+
+// CongestionEvent reports change of the destination congestion.
+type CongestionEvent struct {
+	Destination string
+	// Level is the backoff level, retransmission intervals are multiplied by 2^Level in conservative mode.
+	// Zero level means the congestion is cleared.
+	Level int
+	// Err is the transport error that signaled the congestion, nil on clearing.
+	Err  error
+	Time time.Time
+}
+
+type congestionEntry struct {
+	level int
+	until time.Time
+}
+
+// CongestionControl tracks congestion of destinations signaled by transport errors of sent messages:
+// send-buffer pressure (ENOBUFS, EAGAIN) and ICMP errors (ECONNREFUSED, EHOSTUNREACH, ENETUNREACH).
+// Each signal raises the backoff level of the destination up to MaxLevel,
+// the level drops when a response from the destination is received or Hold passes since the last signal.
+type CongestionControl struct {
+	Mode CongestionMode
+	// Hold is the time the destination stays congested after the last signal, zero means DefaultCongestionHold.
+	Hold time.Duration
+	// MaxLevel limits the backoff level, zero means DefaultCongestionMaxLevel.
+	MaxLevel int
+	// MaxInterval limits the backed off retransmission interval, zero means 4*T2.
+	MaxInterval time.Duration
+	// OnEvent is called on the destination congestion change.
+	OnEvent func(event CongestionEvent)
+
+	mu      sync.Mutex
+	entries map[string]*congestionEntry
+}
+
+func NewCongestionControl(mode CongestionMode) *CongestionControl {
+	return &CongestionControl{
+		Mode:     mode,
+		Hold:     DefaultCongestionHold,
+		MaxLevel: DefaultCongestionMaxLevel,
+		entries:  make(map[string]*congestionEntry),
+	}
+}
+
+// IsCongestionError checks that the transport error signals congestion of the destination.
+func IsCongestionError(err error) bool {
+	for _, errno := range []syscall.Errno{
+		syscall.ENOBUFS,
+		syscall.EAGAIN,
+		syscall.ECONNREFUSED,
+		syscall.EHOSTUNREACH,
+		syscall.ENETUNREACH,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// Signal raises the backoff level of the destination if the error signals congestion.
+// Returns false if the error is not a congestion signal.
+func (cc *CongestionControl) Signal(destination string, err error) bool {
+	if !IsCongestionError(err) {
+		return false
+	}
+
+	now := timing.Now()
+
+	cc.mu.Lock()
+	if cc.entries == nil {
+		cc.entries = make(map[string]*congestionEntry)
+	}
+	entry, ok := cc.entries[destination]
+	if !ok || now.After(entry.until) {
+		entry = &congestionEntry{}
+		cc.entries[destination] = entry
+	}
+	if entry.level < cc.maxLevel() {
+		entry.level++
+	}
+	entry.until = now.Add(cc.hold())
+	level := entry.level
+	cc.mu.Unlock()
+
+	cc.emit(CongestionEvent{Destination: destination, Level: level, Err: err, Time: now})
+
+	return true
+}
+
+// Clear drops the congestion of the destination, e.g. when a response from it is received.
+func (cc *CongestionControl) Clear(destination string) {
+	cc.mu.Lock()
+	entry, ok := cc.entries[destination]
+	delete(cc.entries, destination)
+	cc.mu.Unlock()
+
+	now := timing.Now()
+	if ok && now.Before(entry.until) {
+		cc.emit(CongestionEvent{Destination: destination, Time: now})
+	}
+}
+
+// Level returns the current backoff level of the destination.
+func (cc *CongestionControl) Level(destination string) int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	entry, ok := cc.entries[destination]
+	if !ok {
+		return 0
+	}
+	if timing.Now().After(entry.until) {
+		delete(cc.entries, destination)
+		return 0
+	}
+	return entry.level
+}
+
+// Backoff returns retransmission interval to the destination: the interval of the standard schedule
+// multiplied by 2^level in conservative mode, the interval as is in strict mode.
+func (cc *CongestionControl) Backoff(destination string, interval time.Duration) time.Duration {
+	if cc.Mode != CongestionConservative {
+		return interval
+	}
+	level := cc.Level(destination)
+	if level == 0 {
+		return interval
+	}
+
+	max := cc.MaxInterval
+	if max == 0 {
+		max = 4 * T2
+	}
+	backoff := interval << uint(level)
+	if backoff > max {
+		backoff = max
+	}
+	if backoff < interval {
+		backoff = interval
+	}
+	return backoff
+}
+
+func (cc *CongestionControl) hold() time.Duration {
+	if cc.Hold == 0 {
+		return DefaultCongestionHold
+	}
+	return cc.Hold
+}
+
+func (cc *CongestionControl) maxLevel() int {
+	if cc.MaxLevel == 0 {
+		return DefaultCongestionMaxLevel
+	}
+	return cc.MaxLevel
+}
+
+// Suppresses the transport error of the retransmission in conservative mode.
+func (cc *CongestionControl) suppress(destination string, err error) bool {
+	return cc.Signal(destination, err) && cc.Mode == CongestionConservative
+}
+
+func (cc *CongestionControl) emit(event CongestionEvent) {
+	if cc.OnEvent != nil {
+		cc.OnEvent(event)
+	}
+}
@@ -0,0 +1,161 @@
+package transaction_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+// congestedTransport is an unreliable transport failing all sends after the first one with ENOBUFS.
+type congestedTransport struct {
+	msgs chan sip.Message
+	mu   sync.Mutex
+	sent []time.Time
+}
+
+func (tpl *congestedTransport) Messages() <-chan sip.Message { return tpl.msgs }
+func (tpl *congestedTransport) IsReliable(string) bool       { return false }
+func (tpl *congestedTransport) IsStreamed(string) bool       { return false }
+
+func (tpl *congestedTransport) Send(msg sip.Message) error {
+	tpl.mu.Lock()
+	defer tpl.mu.Unlock()
+
+	tpl.sent = append(tpl.sent, time.Now())
+	if len(tpl.sent) == 1 {
+		return nil
+	}
+	return &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", syscall.ENOBUFS)}
+}
+
+func (tpl *congestedTransport) sends() int {
+	tpl.mu.Lock()
+	defer tpl.mu.Unlock()
+	return len(tpl.sent)
+}
+
+var _ = Describe("CongestionControl", func() {
+	congestion := &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", syscall.ECONNREFUSED)}
+
+	It("should detect congestion errors", func() {
+		Expect(transaction.IsCongestionError(congestion)).To(BeTrue())
+		Expect(transaction.IsCongestionError(syscall.ENOBUFS)).To(BeTrue())
+		Expect(transaction.IsCongestionError(errors.New("broken"))).To(BeFalse())
+	})
+
+	It("should back off congested destinations in conservative mode", func() {
+		var events []transaction.CongestionEvent
+		cc := transaction.NewCongestionControl(transaction.CongestionConservative)
+		cc.OnEvent = func(event transaction.CongestionEvent) {
+			events = append(events, event)
+		}
+
+		Expect(cc.Signal("example.com:5060", errors.New("broken"))).To(BeFalse())
+		Expect(cc.Backoff("example.com:5060", time.Second)).To(Equal(time.Second))
+
+		for i := 0; i < 5; i++ {
+			Expect(cc.Signal("example.com:5060", congestion)).To(BeTrue())
+		}
+		Expect(cc.Level("example.com:5060")).To(Equal(transaction.DefaultCongestionMaxLevel))
+		Expect(cc.Backoff("example.com:5060", time.Second)).To(Equal(8 * time.Second))
+		Expect(cc.Backoff("example.com:5060", 4*time.Second)).To(Equal(4 * transaction.T2))
+		Expect(cc.Backoff("other.com:5060", time.Second)).To(Equal(time.Second))
+
+		cc.Clear("example.com:5060")
+		Expect(cc.Level("example.com:5060")).To(Equal(0))
+		Expect(events).To(HaveLen(6))
+		Expect(events[0].Level).To(Equal(1))
+		Expect(events[0].Err).To(Equal(congestion))
+		Expect(events[5].Level).To(Equal(0))
+		Expect(events[5].Err).To(BeNil())
+	})
+
+	It("should keep RFC schedule in strict mode", func() {
+		cc := transaction.NewCongestionControl(transaction.CongestionStrict)
+		Expect(cc.Signal("example.com:5060", congestion)).To(BeTrue())
+		Expect(cc.Level("example.com:5060")).To(Equal(1))
+		Expect(cc.Backoff("example.com:5060", time.Second)).To(Equal(time.Second))
+	})
+
+	It("should be usable as zero value", func() {
+		cc := &transaction.CongestionControl{Mode: transaction.CongestionConservative}
+		Expect(cc.Signal("example.com:5060", congestion)).To(BeTrue())
+		Expect(cc.Level("example.com:5060")).To(Equal(1))
+		Expect(cc.Backoff("example.com:5060", time.Second)).To(Equal(2 * time.Second))
+	})
+
+	It("should expire congestion after hold time", func() {
+		cc := transaction.NewCongestionControl(transaction.CongestionConservative)
+		cc.Hold = 10 * time.Millisecond
+		Expect(cc.Signal("example.com:5060", congestion)).To(BeTrue())
+		time.Sleep(20 * time.Millisecond)
+		Expect(cc.Level("example.com:5060")).To(Equal(0))
+	})
+
+	Context("client transaction", func() {
+		var (
+			tpl *congestedTransport
+			txl transaction.Layer
+			cc  *transaction.CongestionControl
+			req sip.Request
+		)
+
+		newLayer := func(mode transaction.CongestionMode) {
+			cc = transaction.NewCongestionControl(mode)
+			txl = transaction.NewLayerWithOptions(tpl, testutils.NewLogrusLogger(),
+				transaction.WithCongestionControl(cc),
+				transaction.WithTimers(transaction.TimerOptions{T1: 20 * time.Millisecond}),
+			)
+		}
+
+		BeforeEach(func() {
+			tpl = &congestedTransport{msgs: make(chan sip.Message)}
+			req = testutils.Request([]string{
+				"OPTIONS sip:bob@example.com:5060 SIP/2.0",
+				"Via: SIP/2.0/UDP 10.0.0.1:5070;branch=" + sip.GenerateBranch(),
+				"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+				"To: \"Bob\" <sip:bob@far-far-away.com>",
+				"Call-ID: congested",
+				"CSeq: 1 OPTIONS",
+				"Content-Length: 0",
+				"",
+				"",
+			})
+		})
+		AfterEach(func() {
+			txl.Cancel()
+			<-txl.Done()
+		})
+
+		It("should back off retransmissions and keep the transaction in conservative mode", func() {
+			newLayer(transaction.CongestionConservative)
+			tx, err := txl.Request(req)
+			Expect(err).ToNot(HaveOccurred())
+
+			// sends at 0, T1 and 5*T1 instead of 0, T1, 3*T1, 7*T1, 15*T1
+			time.Sleep(350 * time.Millisecond)
+			Expect(tpl.sends()).To(Equal(3))
+			Expect(cc.Level("example.com:5060")).To(Equal(2))
+			Consistently(tx.Done()).ShouldNot(BeClosed())
+		})
+
+		It("should fail the transaction on the congestion error in strict mode", func() {
+			newLayer(transaction.CongestionStrict)
+			tx, err := txl.Request(req)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(tx.Errors(), time.Second).Should(Receive())
+			Expect(cc.Level("example.com:5060")).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,308 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+// TargetResolver resolves URI of the next hop to the ordered list of targets - RFC 3263 4.
+// transport.Resolver implements it.
+type TargetResolver interface {
+	Resolve(ctx context.Context, uri sip.Uri) ([]*transport.ResolvedTarget, error)
+}
+
+type withResolver struct {
+	resolver TargetResolver
+}
+
+func (o withResolver) ApplyLayer(opts *LayerOptions) {
+	opts.Resolver = o.resolver
+}
+
+// WithResolver resolves next hop of requests of client transactions to the list of targets.
+// Request is sent to the first target, when the transaction times out, fails on transport
+// or receives '503 Service Unavailable' before any other response,
+// it is retried with a new client transaction on the next target - RFC 3263 4.3.
+// Requests with explicitly set destination are sent as is.
+func WithResolver(resolver TargetResolver) LayerOption {
+	return withResolver{resolver}
+}
+
+// Returns targets of the request next hop, nil means the request is sent without failover.
+// Error is returned only if the context is done, failed resolution falls back to sending as is.
+func (txl *layer) resolveTargets(ctx context.Context, req sip.Request) ([]*transport.ResolvedTarget, error) {
+	// destination set by the user differs from the one derived from the next hop URI
+	uri, ok := transport.NextHop(req)
+	if !ok || net.ParseIP(strings.Trim(uri.Host(), "[]")) != nil {
+		return nil, nil
+	}
+
+	resolveCtx, cancel := context.WithTimeout(ctx, Timer_B)
+	defer cancel()
+
+	targets, err := txl.resolver.Resolve(resolveCtx, uri)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("resolve next hop %s: %w", uri, ctx.Err())
+		}
+		txl.Log().Warnf("resolve next hop %s failed, request is sent without failover: %s", uri, err)
+		return nil, nil
+	}
+	return targets, nil
+}
+
+// failoverTx is a client transaction that retries request on the next resolved target
+// with a new client transaction.
+type failoverTx struct {
+	txl      *layer
+	template sip.Request
+	options  []ClientTransactionOption
+
+	mu       sync.RWMutex
+	tx       sip.ClientTransaction
+	targets  []*transport.ResolvedTarget
+	answered bool
+	canceled bool
+
+	onAckFn, onCancFn func(sip.Request)
+
+	responses chan sip.Response
+	errs      chan error
+	done      chan bool
+
+	log log.Logger
+}
+
+func newFailoverTx(
+	txl *layer,
+	req sip.Request,
+	targets []*transport.ResolvedTarget,
+	options []ClientTransactionOption,
+) (sip.ClientTransaction, error) {
+	tx := &failoverTx{
+		txl:       txl,
+		template:  sip.CopyRequest(req),
+		options:   options,
+		targets:   targets,
+		responses: make(chan sip.Response, 64),
+		errs:      make(chan error, 64),
+		done:      make(chan bool),
+	}
+	tx.log = txl.Log().
+		WithPrefix("transaction.FailoverTx").
+		WithFields(log.Fields{
+			"transaction_ptr": fmt.Sprintf("%p", tx),
+		})
+
+	if err := tx.next(req); err != nil {
+		return nil, err
+	}
+
+	go tx.serve()
+
+	return tx, nil
+}
+
+func (tx *failoverTx) String() string {
+	if tx == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("%s<%s>", tx.Log().Prefix(), tx.Log().Fields().WithFields(log.Fields{
+		"key": tx.Key(),
+	}))
+}
+
+func (tx *failoverTx) Log() log.Logger {
+	return tx.log
+}
+
+// Origin returns request of the current client transaction.
+func (tx *failoverTx) Origin() sip.Request {
+	return tx.current().Origin()
+}
+
+// Key returns key of the current client transaction.
+func (tx *failoverTx) Key() TxKey {
+	return tx.current().Key()
+}
+
+func (tx *failoverTx) Responses() <-chan sip.Response {
+	return tx.responses
+}
+
+func (tx *failoverTx) Errors() <-chan error {
+	return tx.errs
+}
+
+func (tx *failoverTx) Done() <-chan bool {
+	return tx.done
+}
+
+func (tx *failoverTx) Provisionals() []sip.ProvisionalResponse {
+	return sip.Provisionals(tx.current())
+}
+
+func (tx *failoverTx) Cancel() error {
+	tx.mu.Lock()
+	tx.canceled = true
+	cur := tx.tx
+	tx.mu.Unlock()
+
+	return cur.Cancel()
+}
+
+func (tx *failoverTx) OnAck(fn func(sip.Request)) {
+	tx.mu.Lock()
+	tx.onAckFn = fn
+	cur := tx.tx
+	tx.mu.Unlock()
+
+	cur.OnAck(fn)
+}
+
+func (tx *failoverTx) OnCancel(fn func(sip.Request)) {
+	tx.mu.Lock()
+	tx.onCancFn = fn
+	cur := tx.tx
+	tx.mu.Unlock()
+
+	cur.OnCancel(fn)
+}
+
+func (tx *failoverTx) current() sip.ClientTransaction {
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+
+	return tx.tx
+}
+
+// Sends request to the next target with a new client transaction,
+// targets that fail on the transaction initialization are skipped.
+// The first request is sent as is, following requests are copies of the template with a new branch.
+func (tx *failoverTx) next(req sip.Request) error {
+	var lastErr error
+	for {
+		tx.mu.Lock()
+		if len(tx.targets) == 0 {
+			tx.mu.Unlock()
+			break
+		}
+		target := tx.targets[0]
+		tx.targets = tx.targets[1:]
+		tx.mu.Unlock()
+
+		if req == nil {
+			req = sip.CopyRequest(tx.template)
+			if viaHop, ok := req.ViaHop(); ok && viaHop.Params != nil {
+				viaHop.Params.Remove("branch")
+			}
+		}
+		req.SetDestination(target.Addr())
+		req.SetTransport(target.Network)
+
+		tx.Log().Debugf("sending request to %s", target)
+
+		cur, err := tx.txl.request(req, tx.options...)
+		req = nil
+		if err != nil {
+			tx.Log().Debugf("send request to %s failed: %s", target, err)
+			lastErr = err
+			continue
+		}
+
+		tx.mu.Lock()
+		tx.tx = cur
+		if tx.onAckFn != nil {
+			cur.OnAck(tx.onAckFn)
+		}
+		if tx.onCancFn != nil {
+			cur.OnCancel(tx.onCancFn)
+		}
+		tx.mu.Unlock()
+
+		return nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no targets to send request to")
+	}
+	return lastErr
+}
+
+// Returns true if the request can be retried on the next target.
+func (tx *failoverTx) canFailover() bool {
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+
+	return !tx.answered && !tx.canceled && len(tx.targets) > 0
+}
+
+func (tx *failoverTx) serve() {
+	defer func() {
+		close(tx.responses)
+		close(tx.errs)
+		close(tx.done)
+	}()
+
+	for tx.serveTx(tx.current()) {
+		if err := tx.next(nil); err != nil {
+			tx.errs <- err
+			return
+		}
+	}
+}
+
+// Passes up responses and errors of the client transaction until it is done.
+// Returns true if the request should be retried on the next target.
+func (tx *failoverTx) serveTx(cur sip.ClientTransaction) bool {
+	var failover bool
+
+	responses, errs := cur.Responses(), cur.Errors()
+	for responses != nil || errs != nil {
+		select {
+		case res, ok := <-responses:
+			if !ok {
+				responses = nil
+				continue
+			}
+
+			if res.StatusCode() == 503 && tx.canFailover() {
+				tx.Log().Debugf("%s answered with %s, failover to the next target", cur, res.Short())
+				failover = true
+				continue
+			}
+			if res.StatusCode() > 100 {
+				tx.mu.Lock()
+				tx.answered = true
+				tx.mu.Unlock()
+			}
+
+			tx.responses <- res
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			var txErr TxError
+			if errors.As(err, &txErr) && (txErr.Timeout() || txErr.Transport()) && tx.canFailover() {
+				tx.Log().Debugf("%s failed, failover to the next target: %s", cur, err)
+				failover = true
+				continue
+			}
+
+			tx.errs <- err
+		}
+	}
+
+	return failover
+}
@@ -0,0 +1,157 @@
+package transaction_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+type fakeTargetResolver []*transport.ResolvedTarget
+
+func (r fakeTargetResolver) Resolve(ctx context.Context, uri sip.Uri) ([]*transport.ResolvedTarget, error) {
+	return r, nil
+}
+
+type ctxTargetResolver struct{}
+
+func (ctxTargetResolver) Resolve(ctx context.Context, uri sip.Uri) ([]*transport.ResolvedTarget, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+var _ = Describe("Failover", func() {
+	var (
+		tpl *testutils.MockTransportLayer
+		txl transaction.Layer
+		req sip.Request
+	)
+
+	target := func(network, host string, port sip.Port) *transport.ResolvedTarget {
+		return &transport.ResolvedTarget{Network: network, Target: transport.NewTarget(host, int(port))}
+	}
+	respond := func(req sip.Request, code sip.StatusCode, reason string) {
+		tpl.InMsgs <- sip.NewResponseFromRequest("", req, code, reason, "")
+	}
+
+	BeforeEach(func() {
+		tpl = testutils.NewMockTransportLayer()
+		txl = transaction.NewLayerWithOptions(tpl, testutils.NewLogrusLogger(),
+			transaction.WithResolver(fakeTargetResolver{
+				target("UDP", "10.0.0.1", 5060),
+				target("TCP", "10.0.0.2", 5070),
+			}),
+		)
+		req = testutils.Request([]string{
+			"OPTIONS sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP 127.0.0.1:5060",
+			"From: <sip:alice@example.com>;tag=1928301774",
+			"To: <sip:bob@example.com>",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 1 OPTIONS",
+			"",
+			"",
+		})
+	})
+	AfterEach(func(done Done) {
+		txl.Cancel()
+		<-txl.Done()
+		close(done)
+	}, 3)
+
+	It("should retry request on the next target after '503 Service Unavailable'", func(done Done) {
+		defer close(done)
+
+		txs := make(chan sip.ClientTransaction, 1)
+		go func() {
+			tx, err := txl.Request(req)
+			Expect(err).ToNot(HaveOccurred())
+			txs <- tx
+		}()
+
+		first := (<-tpl.OutMsgs).(sip.Request)
+		Expect(first.Destination()).To(Equal("10.0.0.1:5060"))
+		Expect(first.Transport()).To(Equal("UDP"))
+		tx := <-txs
+		go respond(first, 503, "Service Unavailable")
+
+		second := (<-tpl.OutMsgs).(sip.Request)
+		Expect(second.Destination()).To(Equal("10.0.0.2:5070"))
+		Expect(second.Transport()).To(Equal("TCP"))
+		firstHop, _ := first.ViaHop()
+		secondHop, _ := second.ViaHop()
+		firstBranch, _ := firstHop.Params.Get("branch")
+		secondBranch, _ := secondHop.Params.Get("branch")
+		Expect(secondBranch).ToNot(Equal(firstBranch))
+		go respond(second, 200, "OK")
+
+		res := <-tx.Responses()
+		Expect(res.StatusCode()).To(Equal(sip.StatusCode(200)))
+		Expect(tx.Origin().Destination()).To(Equal("10.0.0.2:5070"))
+	}, 3)
+
+	It("should pass up '503 Service Unavailable' of the last target", func(done Done) {
+		defer close(done)
+
+		txs := make(chan sip.ClientTransaction, 1)
+		go func() {
+			tx, err := txl.Request(req)
+			Expect(err).ToNot(HaveOccurred())
+			txs <- tx
+		}()
+
+		first := (<-tpl.OutMsgs).(sip.Request)
+		tx := <-txs
+		go respond(first, 503, "Service Unavailable")
+		second := (<-tpl.OutMsgs).(sip.Request)
+		go respond(second, 503, "Service Unavailable")
+
+		res := <-tx.Responses()
+		Expect(res.StatusCode()).To(Equal(sip.StatusCode(503)))
+		Eventually(tx.Done()).Should(BeClosed())
+	}, 3)
+
+	It("should not resolve request with explicit destination", func(done Done) {
+		defer close(done)
+
+		req.SetDestination("10.0.0.3:5080")
+		errs := make(chan error, 1)
+		go func() {
+			_, err := txl.Request(req)
+			errs <- err
+		}()
+
+		Expect((<-tpl.OutMsgs).Destination()).To(Equal("10.0.0.3:5080"))
+		Expect(<-errs).ToNot(HaveOccurred())
+	}, 3)
+	It("should resolve request with destination of the next hop", func(done Done) {
+		defer close(done)
+
+		req.SetDestination("EXAMPLE.com:5060")
+		go txl.Request(req)
+
+		Expect((<-tpl.OutMsgs).Destination()).To(Equal("10.0.0.1:5060"))
+	}, 3)
+
+	It("should return error when context is done before next hop is resolved", func(done Done) {
+		defer close(done)
+
+		txl.Cancel()
+		<-txl.Done()
+		txl = transaction.NewLayerWithOptions(tpl, testutils.NewLogrusLogger(),
+			transaction.WithResolver(ctxTargetResolver{}),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := txl.RequestContext(ctx, req)
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		Consistently(tpl.OutMsgs, "100ms").ShouldNot(Receive())
+	}, 3)
+})
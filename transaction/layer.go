@@ -1,28 +1,40 @@
 package transaction
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/snapshot"
 )
 
 // Layer serves client and server transactions.
 type Layer interface {
-	Cancel()
-	Done() <-chan struct{}
+	sip.TransactionLayer
 	String() string
-	Request(req sip.Request) (sip.ClientTransaction, error)
-	Respond(res sip.Response) (sip.ServerTransaction, error)
+	// RequestWithOptions sends request with a new client transaction created with the options.
+	RequestWithOptions(req sip.Request, options ...ClientTransactionOption) (sip.ClientTransaction, error)
+	// RequestContext is RequestWithOptions with the context bounding the next hop resolution, see WithResolver.
+	RequestContext(ctx context.Context, req sip.Request, options ...ClientTransactionOption) (sip.ClientTransaction, error)
+	// Send sends request without creating a client transaction,
+	// e.g. ACK on 2xx or CANCEL relayed by stateless proxy.
+	// Top 'Via' header with branch is added if it is missing.
+	Send(req sip.Request) error
 	Transport() sip.Transport
-	// Requests returns channel with new incoming server transactions.
-	Requests() <-chan sip.ServerTransaction
-	// ACKs on 2xx
+	// ACKs on 2xx, not passed if LayerOptions.OnUnmatched is set.
 	Acks() <-chan sip.Request
-	// Responses returns channel with not matched responses.
+	// Responses returns channel with not matched responses, not passed if LayerOptions.OnUnmatched is set.
 	Responses() <-chan sip.Response
 	Errors() <-chan error
+	// SnapshotAll captures all live transactions in a single serializable document.
+	SnapshotAll() LayerSnapshot
+	// RestoreAll rebuilds transactions from the snapshot and registers them in the layer.
+	// listeners map transport network (e.g. "udp") to the local address to rebind the restored transactions to.
+	// Either all transactions are restored or none, corrupted snapshot is reported with snapshot.CorruptedError.
+	RestoreAll(snapshot LayerSnapshot, listeners map[string]string, options ...RestoreOption) error
 }
 
 type layer struct {
@@ -40,13 +52,201 @@ type layer struct {
 	serveTxCh  chan Tx
 	cancelOnce sync.Once
 
+	rtt         *RTTEstimator
+	congestion  *CongestionControl
+	trying      TryingPolicy
+	timerC      time.Duration
+	manualPrack bool
+	resolver    TargetResolver
+	onUnmatched func(msg sip.Message)
+	store       snapshot.Store
+	timers      TimerOptions
+
 	log log.Logger
 }
 
+type LayerOption interface {
+	ApplyLayer(opts *LayerOptions)
+}
+
+type LayerOptions struct {
+	// RTTEstimator enables RTT estimation of client transactions destinations.
+	RTTEstimator *RTTEstimator
+	// Congestion enables adaptive retransmissions to the destinations congested by transport errors.
+	Congestion *CongestionControl
+	// Mode selects behaviour that differs between user agents and proxies.
+	Mode Mode
+	// Trying defines '100 Trying' emission of INVITE server transactions.
+	Trying TryingPolicy
+	// TimerC is a duration of proxy timer C of INVITE client transactions, used only in ProxyMode.
+	// Zero means Timer_C, negative value disables the timer, e.g. when TU manages it on its own.
+	TimerC time.Duration
+	// ManualPrack disables automatic PRACK on reliable provisional responses - RFC 3262.
+	ManualPrack bool
+	// Resolver enables failover of client transactions to the next resolved target - RFC 3263 4.3.
+	Resolver TargetResolver
+	// OnUnmatched is called with responses that don't match any client transaction
+	// and ACKs on 2xx instead of passing them to Responses and Acks channels.
+	OnUnmatched func(msg sip.Message)
+	// SnapshotStore enables persistence of transaction snapshots on every state change,
+	// snapshots are deleted when transactions terminate. Use LoadSnapshot to restore them after restart.
+	SnapshotStore snapshot.Store
+	// Timers overrides timer values of all transactions, see WithTimers.
+	Timers TimerOptions
+}
+
+// Mode selects behaviour of the transaction layer that differs between user agents and proxies.
+type Mode int
+
+const (
+	// UAMode is a user agent behaviour: '100 Trying' is delayed, no timer C.
+	UAMode Mode = iota
+	// ProxyMode is a stateful proxy behaviour: '100 Trying' is sent immediately,
+	// client INVITE transactions are guarded with timer C - RFC 3261 16.
+	ProxyMode
+)
+
+// TryingPolicy defines '100 Trying' emission of INVITE server transactions.
+type TryingPolicy int
+
+const (
+	// TryingAuto selects policy by the layer mode: TryingDelayed in UAMode, TryingImmediate in ProxyMode.
+	TryingAuto TryingPolicy = iota
+	// TryingDelayed sends '100 Trying' after Timer_1xx if the TU has not responded yet - RFC 3261 17.2.1.
+	TryingDelayed
+	// TryingImmediate sends '100 Trying' as soon as INVITE is received - RFC 3261 16.2.
+	TryingImmediate
+	// TryingSuppressed never sends '100 Trying', the TU is responsible for it.
+	TryingSuppressed
+)
+
+type withMode struct {
+	mode Mode
+}
+
+func (o withMode) ApplyLayer(opts *LayerOptions) {
+	opts.Mode = o.mode
+}
+
+func WithMode(mode Mode) LayerOption {
+	return withMode{mode}
+}
+
+type withTrying struct {
+	policy TryingPolicy
+}
+
+func (o withTrying) ApplyLayer(opts *LayerOptions) {
+	opts.Trying = o.policy
+}
+
+func WithTrying(policy TryingPolicy) LayerOption {
+	return withTrying{policy}
+}
+
+type withTimerC struct {
+	d time.Duration
+}
+
+func (o withTimerC) ApplyLayer(opts *LayerOptions) {
+	opts.TimerC = o.d
+}
+
+func WithTimerC(d time.Duration) LayerOption {
+	return withTimerC{d}
+}
+
+type withUnmatchedHandler struct {
+	fn func(msg sip.Message)
+}
+
+func (o withUnmatchedHandler) ApplyLayer(opts *LayerOptions) {
+	opts.OnUnmatched = o.fn
+}
+
+// WithUnmatchedHandler passes responses that don't match any client transaction and ACKs on 2xx to the callback.
+func WithUnmatchedHandler(fn func(msg sip.Message)) LayerOption {
+	return withUnmatchedHandler{fn}
+}
+
+type withSnapshotStore struct {
+	store snapshot.Store
+}
+
+func (o withSnapshotStore) ApplyLayer(opts *LayerOptions) {
+	opts.SnapshotStore = o.store
+}
+
+// WithSnapshotStore persists snapshots of transactions into the store on every state change.
+func WithSnapshotStore(store snapshot.Store) LayerOption {
+	return withSnapshotStore{store}
+}
+
+type withRTTEstimator struct {
+	est *RTTEstimator
+}
+
+func (o withRTTEstimator) ApplyLayer(opts *LayerOptions) {
+	opts.RTTEstimator = o.est
+}
+
+// WithRTTEstimator stamps requests of client transactions with 'Timestamp' header,
+// feeds the estimator with RTT samples from responses and takes T1 of new client transactions from it.
+func WithRTTEstimator(est *RTTEstimator) LayerOption {
+	return withRTTEstimator{est}
+}
+
+type withCongestionControl struct {
+	cc *CongestionControl
+}
+
+func (o withCongestionControl) ApplyLayer(opts *LayerOptions) {
+	opts.Congestion = o.cc
+}
+
+// WithCongestionControl feeds the congestion control with transport errors of transactions
+// and backs off their retransmissions to congested destinations, see CongestionMode.
+func WithCongestionControl(cc *CongestionControl) LayerOption {
+	return withCongestionControl{cc}
+}
+
 func NewLayer(tpl sip.Transport, logger log.Logger) Layer {
+	return NewLayerWithOptions(tpl, logger)
+}
+
+func NewLayerWithOptions(tpl sip.Transport, logger log.Logger, options ...LayerOption) Layer {
+	opts := LayerOptions{}
+	for _, opt := range options {
+		opt.ApplyLayer(&opts)
+	}
+
+	trying := opts.Trying
+	if trying == TryingAuto {
+		trying = TryingDelayed
+		if opts.Mode == ProxyMode {
+			trying = TryingImmediate
+		}
+	}
+	var timerC time.Duration
+	if opts.Mode == ProxyMode {
+		timerC = opts.TimerC
+		if timerC == 0 {
+			timerC = Timer_C
+		}
+	}
+
 	txl := &layer{
 		tpl:          tpl,
 		transactions: newTransactionStore(),
+		rtt:          opts.RTTEstimator,
+		congestion:   opts.Congestion,
+		trying:       trying,
+		timerC:       timerC,
+		manualPrack:  opts.ManualPrack,
+		resolver:     opts.Resolver,
+		onUnmatched:  opts.OnUnmatched,
+		store:        opts.SnapshotStore,
+		timers:       opts.Timers,
 
 		requests:  make(chan sip.ServerTransaction),
 		acks:      make(chan sip.Request),
@@ -119,6 +319,18 @@ func (txl *layer) Transport() sip.Transport {
 }
 
 func (txl *layer) Request(req sip.Request) (sip.ClientTransaction, error) {
+	return txl.RequestWithOptions(req)
+}
+
+func (txl *layer) RequestWithOptions(req sip.Request, options ...ClientTransactionOption) (sip.ClientTransaction, error) {
+	return txl.RequestContext(context.Background(), req, options...)
+}
+
+func (txl *layer) RequestContext(
+	ctx context.Context,
+	req sip.Request,
+	options ...ClientTransactionOption,
+) (sip.ClientTransaction, error) {
 	select {
 	case <-txl.canceled:
 		return nil, fmt.Errorf("transaction layer is canceled")
@@ -126,13 +338,46 @@ func (txl *layer) Request(req sip.Request) (sip.ClientTransaction, error) {
 	}
 
 	if req.IsAck() {
-		return nil, fmt.Errorf("ACK request must be sent directly through transport")
+		return nil, fmt.Errorf("ACK request must be sent without transaction")
 	}
 
-	tx, err := NewClientTx(req, txl.tpl, txl.Log())
+	if txl.resolver != nil {
+		targets, err := txl.resolveTargets(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if len(targets) > 0 {
+			return newFailoverTx(txl, req, targets, options)
+		}
+	}
+
+	return txl.request(req, options...)
+}
+
+func (txl *layer) request(req sip.Request, options ...ClientTransactionOption) (sip.ClientTransaction, error) {
+	if txl.rtt != nil {
+		AddTimestamp(req)
+	}
+
+	opts := ClientTransactionOptions{Timers: txl.timers}
+	for _, opt := range options {
+		opt.ApplyClientTransaction(&opts)
+	}
+
+	tx, err := NewClientTxWithOptions(req, txl.tpl, txl.Log(), WithTimers(opts.Timers))
 	if err != nil {
 		return nil, err
 	}
+	// explicitly set T1 takes precedence over the estimated one
+	if txl.rtt != nil && opts.Timers.T1 == 0 {
+		tx.(*clientTx).setT1(txl.rtt.T1(req.Destination()))
+	}
+	if txl.timerC > 0 {
+		tx.(*clientTx).setTimerC(txl.timerC)
+	}
+	tx.(*clientTx).setCongestion(txl.congestion)
+
+	txl.trackChanges(tx)
 
 	logger := log.AddFieldsFrom(txl.Log(), req, tx)
 	logger.Debug("client transaction created")
@@ -142,6 +387,7 @@ func (txl *layer) Request(req sip.Request) (sip.ClientTransaction, error) {
 	}
 
 	txl.transactions.put(tx.Key(), tx)
+	txl.persist(tx)
 
 	select {
 	case <-txl.canceled:
@@ -152,6 +398,21 @@ func (txl *layer) Request(req sip.Request) (sip.ClientTransaction, error) {
 	return tx, nil
 }
 
+func (txl *layer) Send(req sip.Request) error {
+	select {
+	case <-txl.canceled:
+		return fmt.Errorf("transaction layer is canceled")
+	default:
+	}
+
+	req = prepareClientRequest(req)
+
+	logger := log.AddFieldsFrom(txl.Log(), req)
+	logger.Trace("sending SIP request without transaction...")
+
+	return txl.tpl.Send(req)
+}
+
 func (txl *layer) Respond(res sip.Response) (sip.ServerTransaction, error) {
 	select {
 	case <-txl.canceled:
@@ -172,6 +433,26 @@ func (txl *layer) Respond(res sip.Response) (sip.ServerTransaction, error) {
 	return tx, nil
 }
 
+func (txl *layer) ClientTransaction(key TxKey) (sip.ClientTransaction, bool) {
+	tx, ok := txl.transactions.get(key)
+	if !ok {
+		return nil, false
+	}
+
+	clientTx, ok := tx.(ClientTx)
+	return clientTx, ok
+}
+
+func (txl *layer) ServerTransaction(key TxKey) (sip.ServerTransaction, bool) {
+	tx, ok := txl.transactions.get(key)
+	if !ok {
+		return nil, false
+	}
+
+	serverTx, ok := tx.(ServerTx)
+	return serverTx, ok
+}
+
 func (txl *layer) listenMessages() {
 	defer func() {
 		txl.txWg.Wait()
@@ -223,6 +504,7 @@ func (txl *layer) serveTransaction(tx Tx) {
 			tx.Terminate()
 			return
 		case <-tx.Done():
+			txl.unpersist(tx)
 			return
 		}
 	}
@@ -269,6 +551,11 @@ func (txl *layer) handleRequest(req sip.Request, logger log.Logger) {
 	}
 	// ACK on 2xx
 	if req.IsAck() {
+		if txl.onUnmatched != nil {
+			txl.onUnmatched(req)
+			return
+		}
+
 		select {
 		case <-txl.canceled:
 		case txl.acks <- req:
@@ -284,12 +571,19 @@ func (txl *layer) handleRequest(req sip.Request, logger log.Logger) {
 		return
 	}
 
-	tx, err = NewServerTx(req, txl.tpl, txl.Log())
+	tx, err = NewServerTxWithOptions(req, txl.tpl, txl.Log(), WithTimers(txl.timers))
 	if err != nil {
 		logger.Error(err)
 
 		return
 	}
+	tx.(*serverTx).setTrying(txl.trying)
+	tx.(*serverTx).setCongestion(txl.congestion)
+	if req.Method() == sip.PRACK && !txl.matchPrack(req) {
+		logger.Debug("PRACK does not match any reliable provisional response")
+	}
+
+	txl.trackChanges(tx)
 
 	logger = log.AddFieldsFrom(logger, tx)
 	logger.Debug("new server transaction created")
@@ -302,6 +596,7 @@ func (txl *layer) handleRequest(req sip.Request, logger log.Logger) {
 
 	// put tx to store, to match retransmitting requests later
 	txl.transactions.put(tx.Key(), tx)
+	txl.persist(tx)
 
 	txl.txWg.Add(1)
 	go txl.serveTransaction(tx)
@@ -330,6 +625,11 @@ func (txl *layer) handleResponse(res sip.Response, logger log.Logger) {
 
 		// RFC 3261 - 17.1.1.2.
 		// Not matched responses should be passed directly to the UA
+		if txl.onUnmatched != nil {
+			txl.onUnmatched(res)
+			return
+		}
+
 		select {
 		case <-txl.canceled:
 		case txl.responses <- res:
@@ -341,11 +641,27 @@ func (txl *layer) handleResponse(res sip.Response, logger log.Logger) {
 
 	logger = log.AddFieldsFrom(logger, tx)
 
+	if txl.rtt != nil {
+		if ctx, ok := tx.(*clientTx); ok && ctx.takeRTTSample() {
+			txl.rtt.ObserveResponse(ctx.Origin(), res)
+		}
+	}
+	if txl.congestion != nil {
+		txl.congestion.Clear(tx.Origin().Destination())
+	}
+
 	if err := tx.Receive(res); err != nil {
 		logger.Error(err)
 
 		return
 	}
+
+	// RFC 3262 4 - acknowledge reliable provisional response
+	if ctx, ok := tx.(*clientTx); ok && !txl.manualPrack && ctx.Origin().IsInvite() && sip.IsReliableProvisional(res) {
+		if seq, ok := ctx.nextPrack(res); ok {
+			go txl.sendPrack(ctx.Origin(), res, seq)
+		}
+	}
 }
 
 // RFC 17.1.3.
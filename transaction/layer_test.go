@@ -0,0 +1,76 @@
+package transaction_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("Layer", func() {
+	var (
+		tpl       *testutils.MockTransportLayer
+		txl       transaction.Layer
+		unmatched chan sip.Message
+		req       sip.Request
+	)
+
+	BeforeEach(func() {
+		unmatched = make(chan sip.Message, 1)
+		tpl = testutils.NewMockTransportLayer()
+		txl = transaction.NewLayerWithOptions(tpl, testutils.NewLogrusLogger(),
+			transaction.WithUnmatchedHandler(func(msg sip.Message) {
+				unmatched <- msg
+			}),
+		)
+		req = testutils.Request([]string{
+			"OPTIONS sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP 127.0.0.1:5060;branch=" + sip.GenerateBranch(),
+			"From: <sip:alice@example.com>;tag=1928301774",
+			"To: <sip:bob@example.com>",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 1 OPTIONS",
+			"",
+			"",
+		})
+	})
+	AfterEach(func(done Done) {
+		txl.Cancel()
+		<-txl.Done()
+		close(done)
+	}, 3)
+
+	It("should match response to client transaction", func(done Done) {
+		defer close(done)
+
+		txs := make(chan sip.ClientTransaction, 1)
+		go func() {
+			tx, err := txl.Request(req)
+			Expect(err).ToNot(HaveOccurred())
+			txs <- tx
+		}()
+		Expect(<-tpl.OutMsgs).ToNot(BeNil())
+		tx := <-txs
+
+		found, ok := txl.ClientTransaction(tx.Key())
+		Expect(ok).To(BeTrue())
+		Expect(found.Key()).To(Equal(tx.Key()))
+		_, ok = txl.ServerTransaction(tx.Key())
+		Expect(ok).To(BeFalse())
+
+		tpl.InMsgs <- sip.NewResponseFromRequest("", req, 200, "OK", "")
+		Expect((<-tx.Responses()).StatusCode()).To(Equal(sip.StatusCode(200)))
+	}, 3)
+
+	It("should pass non-matched response to the callback", func(done Done) {
+		defer close(done)
+
+		tpl.InMsgs <- sip.NewResponseFromRequest("", req, 200, "OK", "")
+
+		res, ok := (<-unmatched).(sip.Response)
+		Expect(ok).To(BeTrue())
+		Expect(res.StatusCode()).To(Equal(sip.StatusCode(200)))
+	}, 3)
+})
@@ -0,0 +1,117 @@
+package transaction_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("Layer modes", func() {
+	var (
+		tpl     *testutils.MockTransportLayer
+		txl     transaction.Layer
+		options []transaction.LayerOption
+		invite  sip.Request
+		branch  string
+	)
+
+	clientAddr := "localhost:9001"
+
+	JustBeforeEach(func() {
+		tpl = testutils.NewMockTransportLayer()
+		txl = transaction.NewLayerWithOptions(tpl, testutils.NewLogrusLogger(), options...)
+	})
+	BeforeEach(func() {
+		branch = sip.GenerateBranch()
+		invite = testutils.Request([]string{
+			"INVITE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + branch,
+			"From: <sip:alice@example.com>;tag=1928301774",
+			"To: <sip:bob@example.com>",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 1 INVITE",
+			"",
+			"",
+		})
+	})
+	AfterEach(func(done Done) {
+		txl.Cancel()
+		<-txl.Done()
+		close(done)
+	}, 3)
+
+	Context("in proxy mode", func() {
+		BeforeEach(func() {
+			options = []transaction.LayerOption{
+				transaction.WithMode(transaction.ProxyMode),
+				transaction.WithTimerC(100 * time.Millisecond),
+			}
+		})
+
+		It("should send '100 Trying' immediately", func(done Done) {
+			defer close(done)
+
+			go func() { tpl.InMsgs <- invite.Clone() }()
+
+			msg := <-tpl.OutMsgs
+			res, ok := msg.(sip.Response)
+			Expect(ok).To(BeTrue())
+			Expect(res.StatusCode()).To(Equal(sip.StatusCode(100)))
+			Expect(<-txl.Requests()).ToNot(BeNil())
+		}, 3)
+
+		It("should cancel branch on timer C", func(done Done) {
+			defer close(done)
+
+			txs := make(chan sip.ClientTransaction, 1)
+			go func() {
+				tx, err := txl.Request(invite.Clone().(sip.Request))
+				Expect(err).ToNot(HaveOccurred())
+				txs <- tx
+			}()
+			Expect((<-tpl.OutMsgs).(sip.Request).IsInvite()).To(BeTrue())
+			tx := <-txs
+
+			ringing := testutils.Response([]string{
+				"SIP/2.0 180 Ringing",
+				"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + branch,
+				"From: <sip:alice@example.com>;tag=1928301774",
+				"To: <sip:bob@example.com>;tag=a6c85cf",
+				"Call-ID: a84b4c76e66710",
+				"CSeq: 1 INVITE",
+				"",
+				"",
+			})
+			tpl.InMsgs <- ringing
+			Expect((<-tx.Responses()).StatusCode()).To(Equal(sip.StatusCode(180)))
+
+			start := time.Now()
+			cancel, ok := (<-tpl.OutMsgs).(sip.Request)
+			Expect(ok).To(BeTrue())
+			Expect(cancel.IsCancel()).To(BeTrue())
+			Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		}, 3)
+	})
+
+	Context("with suppressed '100 Trying'", func() {
+		BeforeEach(func() {
+			options = []transaction.LayerOption{
+				transaction.WithTrying(transaction.TryingSuppressed),
+			}
+		})
+
+		It("should not send '100 Trying'", func(done Done) {
+			defer close(done)
+
+			go func() { tpl.InMsgs <- invite.Clone() }()
+
+			Expect(<-txl.Requests()).ToNot(BeNil())
+			Consistently(tpl.OutMsgs, 2*transaction.Timer_1xx).ShouldNot(Receive())
+		}, 3)
+	})
+})
@@ -0,0 +1,247 @@
+package transaction
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+type withManualPrack struct{}
+
+func (o withManualPrack) ApplyLayer(opts *LayerOptions) {
+	opts.ManualPrack = true
+}
+
+// WithManualPrack disables automatic PRACK on reliable provisional responses,
+// the TU sends PRACK requests on its own.
+func WithManualPrack() LayerOption {
+	return withManualPrack{}
+}
+
+// ReliableProvisionalError is sent to the server transaction errors
+// when the reliable provisional response is not acknowledged with PRACK in 64*T1 - RFC 3262 3.
+type ReliableProvisionalError struct {
+	Response sip.Response
+}
+
+func (err *ReliableProvisionalError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("transaction.ReliableProvisionalError<%s>: PRACK not received in %s", err.Response.Short(), 64*T1)
+}
+
+// Prepares reliable provisional response: assigns RSeq if it is missing.
+// Only one reliable provisional response may be unacknowledged at a time - RFC 3262 3.
+func (tx *serverTx) prepareReliable(res sip.Response) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.rel_pending != nil {
+		return fmt.Errorf("%s has unacknowledged reliable provisional response %s", tx, tx.rel_pending.Short())
+	}
+
+	if rseq, ok := sip.RSeq(res); ok {
+		tx.rseq = rseq
+	} else {
+		if tx.rseq == 0 {
+			// RFC 3262 7.1 - initial value between 1 and 2**31 - 1
+			tx.rseq = uint32(rand.Int31n(1<<31-1)) + 1
+		} else {
+			tx.rseq++
+		}
+		sip.SetRSeq(res, tx.rseq)
+	}
+	tx.rel_pending = res
+
+	return nil
+}
+
+// Starts retransmission of the pending reliable provisional response
+// with T1 interval doubled each time until PRACK arrives or 64*T1 expires.
+func (tx *serverTx) startReliable() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.rel_pending == nil {
+		return
+	}
+
+	tx.rel_time = T1
+	tx.rel_deadline = timing.Now().Add(64 * T1)
+	tx.timer_rel = timing.AfterFunc(tx.rel_time, tx.timerFunc("timer_rel", tx.retransmitReliable))
+}
+
+func (tx *serverTx) retransmitReliable() {
+	select {
+	case <-tx.done:
+		return
+	default:
+	}
+
+	tx.mu.Lock()
+	res := tx.rel_pending
+	if res == nil {
+		tx.mu.Unlock()
+		return
+	}
+	if !timing.Now().Before(tx.rel_deadline) {
+		tx.rel_pending = nil
+		tx.timer_rel = nil
+		tx.mu.Unlock()
+
+		tx.Log().Warnf("reliable provisional response %s is not acknowledged", res.Short())
+		select {
+		case <-tx.done:
+		case tx.errs <- &ReliableProvisionalError{res}:
+		}
+		// RFC 3262 3 - the UAS SHOULD reject the original request with a 5xx response
+		if err := tx.Respond(sip.NewResponseFromRequest("", tx.Origin(), 500, "Server Internal Error", "")); err != nil {
+			tx.Log().Errorf("send '500 Server Internal Error' response failed: %s", err)
+		}
+		return
+	}
+
+	tx.rel_time *= 2
+	tx.timer_rel = timing.AfterFunc(tx.rel_time, tx.timerFunc("timer_rel", tx.retransmitReliable))
+	tx.mu.Unlock()
+
+	tx.Log().Tracef("retransmitting reliable provisional response %s", res.Short())
+	if err := tx.tpl.Send(res); err != nil {
+		tx.Log().Errorf("retransmit reliable provisional response failed: %s", err)
+	}
+}
+
+// Should be called under lock.
+func (tx *serverTx) stopReliable() {
+	tx.rel_pending = nil
+	if tx.timer_rel != nil {
+		tx.timer_rel.Stop()
+		tx.timer_rel = nil
+	}
+}
+
+// Matches PRACK request to the pending reliable provisional response, stops its retransmission
+// and calls OnPrack callbacks. Returns false if PRACK doesn't acknowledge the response.
+func (tx *serverTx) prack(req sip.Request) bool {
+	rseq, cseq, method, ok := sip.RAck(req)
+	if !ok {
+		return false
+	}
+	origin, ok := tx.Origin().CSeq()
+	if !ok || origin.SeqNo != cseq || origin.MethodName != method {
+		return false
+	}
+
+	tx.mu.Lock()
+	if tx.rel_pending == nil || tx.rseq != rseq {
+		tx.mu.Unlock()
+		return false
+	}
+	tx.stopReliable()
+	callbacks := make([]func(sip.Request), len(tx.onPrackFns))
+	copy(callbacks, tx.onPrackFns)
+	tx.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(req)
+	}
+
+	return true
+}
+
+// OnPrack registers callback that is called when PRACK acknowledges reliable provisional response
+// sent by the INVITE server transaction.
+func (tx *serverTx) OnPrack(fn func(prack sip.Request)) {
+	tx.mu.Lock()
+	tx.onPrackFns = append(tx.onPrackFns, fn)
+	tx.mu.Unlock()
+}
+
+// Matches new PRACK request to the INVITE server transaction by Call-ID.
+func (txl *layer) matchPrack(req sip.Request) bool {
+	callID, ok := req.CallID()
+	if !ok {
+		return false
+	}
+
+	for _, tx := range txl.transactions.all() {
+		stx, ok := tx.(*serverTx)
+		if !ok || !stx.Origin().IsInvite() {
+			continue
+		}
+		if id, ok := stx.Origin().CallID(); ok && *id == *callID && stx.prack(req) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns CSeq of the next PRACK if the reliable provisional response must be acknowledged.
+// Retransmissions and out of order responses are ignored - RFC 3262 4.
+func (tx *clientTx) nextPrack(res sip.Response) (uint32, bool) {
+	rseq, ok := sip.RSeq(res)
+	if !ok {
+		return 0, false
+	}
+	to, ok := res.To()
+	if !ok || to.Params == nil {
+		return 0, false
+	}
+	var toTag string
+	if tag, ok := to.Params.Get("tag"); ok && tag != nil {
+		toTag = tag.String()
+	}
+	cseq, ok := tx.Origin().CSeq()
+	if !ok {
+		return 0, false
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.rseqs == nil {
+		tx.rseqs = make(map[string]uint32)
+	}
+	if last, ok := tx.rseqs[toTag]; ok && rseq != last+1 {
+		return 0, false
+	}
+	tx.rseqs[toTag] = rseq
+	tx.pracks++
+
+	return cseq.SeqNo + tx.pracks, true
+}
+
+// Sends PRACK on the reliable provisional response in a separate client transaction.
+func (txl *layer) sendPrack(invite sip.Request, res sip.Response, seq uint32) {
+	prack, err := sip.NewPrackRequest("", invite, res, seq, nil)
+	if err != nil {
+		txl.Log().Errorf("create PRACK on %s failed: %s", res.Short(), err)
+		return
+	}
+
+	tx, err := txl.Request(prack)
+	if err != nil {
+		txl.Log().Errorf("send PRACK on %s failed: %s", res.Short(), err)
+		return
+	}
+
+	timer := time.NewTimer(Timer_F)
+	defer timer.Stop()
+	for {
+		select {
+		case <-tx.Done():
+			return
+		case <-timer.C:
+			return
+		case _, ok := <-tx.Responses():
+			if !ok {
+				return
+			}
+		}
+	}
+}
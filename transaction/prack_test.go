@@ -0,0 +1,131 @@
+package transaction_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("Reliable provisional responses", func() {
+	var (
+		tpl    *testutils.MockTransportLayer
+		txl    transaction.Layer
+		invite sip.Request
+		branch string
+	)
+
+	clientAddr := "localhost:9001"
+
+	BeforeEach(func() {
+		tpl = testutils.NewMockTransportLayer()
+		txl = transaction.NewLayer(tpl, testutils.NewLogrusLogger())
+		branch = sip.GenerateBranch()
+		invite = testutils.Request([]string{
+			"INVITE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + branch,
+			"From: <sip:alice@example.com>;tag=1928301774",
+			"To: <sip:bob@example.com>",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 1 INVITE",
+			"Supported: 100rel",
+			"Contact: <sip:alice@" + clientAddr + ">",
+			"",
+			"",
+		})
+	})
+	AfterEach(func(done Done) {
+		txl.Cancel()
+		<-txl.Done()
+		close(done)
+	}, 3)
+
+	It("should retransmit reliable provisional response until PRACK", func(done Done) {
+		defer close(done)
+
+		go func() { tpl.InMsgs <- invite.Clone() }()
+		tx := (<-txl.Requests()).(transaction.ServerTx)
+		pracks := make(chan sip.Request, 1)
+		tx.OnPrack(func(prack sip.Request) { pracks <- prack })
+
+		ringing := sip.NewResponseFromRequest("", tx.Origin(), 180, "Ringing", "")
+		ringing.AppendHeader(&sip.RequireHeader{Options: []string{sip.Option100rel}})
+		go func() {
+			defer GinkgoRecover()
+			Expect(tx.Respond(ringing)).To(Succeed())
+		}()
+
+		first := (<-tpl.OutMsgs).(sip.Response)
+		rseq, ok := sip.RSeq(first)
+		Expect(ok).To(BeTrue())
+		start := time.Now()
+		retransmitted := (<-tpl.OutMsgs).(sip.Response)
+		Expect(time.Since(start)).To(BeNumerically(">=", transaction.T1/2))
+		retransmittedRSeq, _ := sip.RSeq(retransmitted)
+		Expect(retransmittedRSeq).To(Equal(rseq))
+
+		prack := testutils.Request([]string{
+			"PRACK sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"From: <sip:alice@example.com>;tag=1928301774",
+			"To: <sip:bob@example.com>;tag=a6c85cf",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 2 PRACK",
+			"RAck: " + first.GetHeaders("RSeq")[0].Value() + " 1 INVITE",
+			"",
+			"",
+		})
+		tpl.InMsgs <- prack
+		Expect((<-pracks).Method()).To(Equal(sip.PRACK))
+		Expect((<-txl.Requests()).Origin().Method()).To(Equal(sip.PRACK))
+		Consistently(tpl.OutMsgs, 2*transaction.T1).ShouldNot(Receive())
+	}, 5)
+
+	It("should send PRACK on reliable provisional response", func(done Done) {
+		defer close(done)
+
+		txs := make(chan sip.ClientTransaction, 1)
+		go func() {
+			defer GinkgoRecover()
+			tx, err := txl.Request(invite.Clone().(sip.Request))
+			Expect(err).ToNot(HaveOccurred())
+			txs <- tx
+		}()
+		Expect((<-tpl.OutMsgs).(sip.Request).IsInvite()).To(BeTrue())
+		tx := <-txs
+
+		progress := testutils.Response([]string{
+			"SIP/2.0 183 Session Progress",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + branch,
+			"From: <sip:alice@example.com>;tag=1928301774",
+			"To: <sip:bob@example.com>;tag=a6c85cf",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 1 INVITE",
+			"Require: 100rel",
+			"RSeq: 813520",
+			"Contact: <sip:bob@192.0.2.4>",
+			"",
+			"",
+		})
+		tpl.InMsgs <- progress
+		Expect((<-tx.Responses()).StatusCode()).To(Equal(sip.StatusCode(183)))
+
+		prack, ok := (<-tpl.OutMsgs).(sip.Request)
+		Expect(ok).To(BeTrue())
+		Expect(prack.Method()).To(Equal(sip.PRACK))
+		Expect(prack.Recipient().String()).To(Equal("sip:bob@192.0.2.4"))
+		Expect(prack.GetHeaders("RAck")[0].Value()).To(Equal("813520 1 INVITE"))
+		cseq, _ := prack.CSeq()
+		Expect(cseq.SeqNo).To(Equal(uint32(2)))
+		rseq, _, _, _ := sip.RAck(prack)
+		Expect(rseq).To(Equal(uint32(813520)))
+
+		// retransmission is not acknowledged again
+		tpl.InMsgs <- progress
+		Consistently(tpl.OutMsgs, 200*time.Millisecond).ShouldNot(Receive())
+	}, 5)
+})
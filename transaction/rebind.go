@@ -0,0 +1,94 @@
+package transaction
+
+import (
+	"fmt"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// TxRebindError is returned when message of the restored transaction references local address
+// that doesn't match address of the transport it is restored on.
+type TxRebindError struct {
+	TxKey    TxKey
+	Header   string
+	Expected string
+	Actual   string
+}
+
+func (err *TxRebindError) Terminated() bool { return false }
+func (err *TxRebindError) Timeout() bool    { return false }
+func (err *TxRebindError) Transport() bool  { return true }
+func (err *TxRebindError) Key() TxKey       { return err.TxKey }
+func (err *TxRebindError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	fields := log.Fields{
+		"transaction_key": "???",
+	}
+
+	if err.TxKey != "" {
+		fields["transaction_key"] = err.TxKey
+	}
+
+	return fmt.Sprintf(
+		"transaction.TxRebindError<%s>: '%s' header references local address %s, but transport is bound to %s",
+		fields,
+		err.Header,
+		err.Actual,
+		err.Expected,
+	)
+}
+
+// Rebind validates local address referenced by the message of the restored transaction
+// against the address of the transport it is restored on (e.g. local port changed after restart).
+// Requests of client transactions are checked by the top 'Via' sent-by and 'Contact',
+// responses of server transactions - by 'Contact' only, since 'Via' belongs to the remote side.
+// If adapt is true then mismatched headers are rewritten, otherwise TxRebindError is returned.
+func Rebind(msg sip.Message, host string, port sip.Port, adapt bool) error {
+	expected := fmt.Sprintf("%s:%d", host, port)
+
+	var key TxKey
+	if _, ok := msg.(sip.Request); ok {
+		key, _ = MakeClientTxKey(msg)
+
+		if hop, ok := msg.ViaHop(); ok {
+			hopPort := sip.DefaultPort(hop.Transport)
+			if hop.Port != nil {
+				hopPort = *hop.Port
+			}
+
+			if hop.Host != host || hopPort != port {
+				if !adapt {
+					return &TxRebindError{key, "Via", expected, fmt.Sprintf("%s:%d", hop.Host, hopPort)}
+				}
+
+				hop.Host = host
+				hop.Port = &port
+			}
+		}
+	} else {
+		key, _ = MakeServerTxKey(msg)
+	}
+
+	if contact, ok := msg.Contact(); ok && contact.Address != nil && contact.Address.Host() != "" {
+		uri := contact.Address
+		uriPort := sip.DefaultPort("udp")
+		if uri.Port() != nil {
+			uriPort = *uri.Port()
+		}
+
+		if uri.Host() != host || uriPort != port {
+			if !adapt {
+				return &TxRebindError{key, "Contact", expected, fmt.Sprintf("%s:%d", uri.Host(), uriPort)}
+			}
+
+			uri.SetHost(host)
+			uri.SetPort(&port)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package transaction_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("Rebind", func() {
+	var req sip.Request
+
+	BeforeEach(func() {
+		req = testutils.Request([]string{
+			"INVITE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP 10.0.0.1:5070;branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Contact: <sip:alice@10.0.0.1:5070>",
+			"CSeq: 1 INVITE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	})
+
+	It("should accept matched local address", func() {
+		Expect(transaction.Rebind(req, "10.0.0.1", 5070, false)).To(Succeed())
+	})
+
+	It("should fail on mismatched local address", func() {
+		err := transaction.Rebind(req, "10.0.0.1", 5080, false)
+		Expect(err).To(HaveOccurred())
+		rebindErr, ok := err.(*transaction.TxRebindError)
+		Expect(ok).To(BeTrue())
+		Expect(rebindErr.Header).To(Equal("Via"))
+		Expect(rebindErr.Actual).To(Equal("10.0.0.1:5070"))
+		Expect(rebindErr.Expected).To(Equal("10.0.0.1:5080"))
+	})
+
+	It("should rewrite Via and Contact on mismatched local address", func() {
+		Expect(transaction.Rebind(req, "10.0.0.1", 5080, true)).To(Succeed())
+		hop, _ := req.ViaHop()
+		Expect(hop.SentBy()).To(Equal("10.0.0.1:5080"))
+		contact, _ := req.Contact()
+		Expect(contact.Address.String()).To(Equal("sip:alice@10.0.0.1:5080"))
+		Expect(transaction.Rebind(req, "10.0.0.1", 5080, false)).To(Succeed())
+	})
+})
@@ -0,0 +1,147 @@
+package transaction
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+type rttEntry struct {
+	srtt   time.Duration
+	rttvar time.Duration
+}
+
+// RTTEstimator estimates round-trip time per destination from the 'Timestamp' header echo - RFC 3261 8.2.6.1,
+// or from RTT reported by a reliable transport, with smoothing of RFC 6298.
+// If Adapt is true, client transactions to the destination use T1 derived from the estimated RTT
+// bounded by MinT1 and MaxT1, which reduces spurious retransmissions to slow peers.
+type RTTEstimator struct {
+	// Adapt enables per-destination T1, otherwise RTT is only estimated.
+	Adapt bool
+	MinT1 time.Duration
+	MaxT1 time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]*rttEntry
+}
+
+func NewRTTEstimator(adapt bool) *RTTEstimator {
+	return &RTTEstimator{
+		Adapt:   adapt,
+		MinT1:   T1,
+		MaxT1:   T2,
+		entries: make(map[string]*rttEntry),
+	}
+}
+
+// Observe updates estimation for the destination (host:port) with the RTT sample.
+func (est *RTTEstimator) Observe(destination string, rtt time.Duration) {
+	if rtt < 0 {
+		return
+	}
+
+	est.mu.Lock()
+	defer est.mu.Unlock()
+
+	entry, ok := est.entries[destination]
+	if !ok {
+		est.entries[destination] = &rttEntry{srtt: rtt, rttvar: rtt / 2}
+		return
+	}
+
+	delta := entry.srtt - rtt
+	if delta < 0 {
+		delta = -delta
+	}
+	entry.rttvar = (3*entry.rttvar + delta) / 4
+	entry.srtt = (7*entry.srtt + rtt) / 8
+}
+
+// ObserveResponse takes RTT sample from the 'Timestamp' header echoed in the response on the request
+// stamped with AddTimestamp. Returns false if the response has no valid echo.
+func (est *RTTEstimator) ObserveResponse(req sip.Request, res sip.Response) bool {
+	hdrs := res.GetHeaders("Timestamp")
+	if len(hdrs) == 0 {
+		return false
+	}
+
+	fields := strings.Fields(hdrs[0].Value())
+	if len(fields) == 0 {
+		return false
+	}
+	sent, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return false
+	}
+	var delay float64
+	if len(fields) > 1 {
+		if delay, err = strconv.ParseFloat(fields[1], 64); err != nil {
+			return false
+		}
+	}
+
+	now := float64(timing.Now().UnixNano()) / float64(time.Second)
+	rtt := time.Duration((now - sent - delay) * float64(time.Second))
+	if rtt < 0 {
+		return false
+	}
+
+	est.Observe(req.Destination(), rtt)
+
+	return true
+}
+
+// RTT returns smoothed RTT of the destination.
+func (est *RTTEstimator) RTT(destination string) (time.Duration, bool) {
+	est.mu.RLock()
+	defer est.mu.RUnlock()
+
+	entry, ok := est.entries[destination]
+	if !ok {
+		return 0, false
+	}
+
+	return entry.srtt, true
+}
+
+// T1 returns retransmission interval T1 for the destination.
+// Default T1 is returned if adaptation is disabled or there is no estimation yet.
+func (est *RTTEstimator) T1(destination string) time.Duration {
+	if !est.Adapt {
+		return T1
+	}
+
+	est.mu.RLock()
+	entry, ok := est.entries[destination]
+	est.mu.RUnlock()
+	if !ok {
+		return T1
+	}
+
+	t1 := entry.srtt + 4*entry.rttvar
+	if t1 < est.MinT1 {
+		t1 = est.MinT1
+	}
+	if t1 > est.MaxT1 {
+		t1 = est.MaxT1
+	}
+
+	return t1
+}
+
+// AddTimestamp adds 'Timestamp' header with the current time to the request if it has none.
+func AddTimestamp(req sip.Request) {
+	if len(req.GetHeaders("Timestamp")) > 0 {
+		return
+	}
+
+	req.AppendHeader(&sip.GenericHeader{
+		HeaderName: "Timestamp",
+		Contents:   fmt.Sprintf("%.3f", float64(timing.Now().UnixNano())/float64(time.Second)),
+	})
+}
@@ -0,0 +1,80 @@
+package transaction_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("RTTEstimator", func() {
+	var req sip.Request
+
+	BeforeEach(func() {
+		req = testutils.Request([]string{
+			"OPTIONS sip:bob@example.com:5060 SIP/2.0",
+			"Via: SIP/2.0/UDP 10.0.0.1:5070;branch=" + sip.GenerateBranch(),
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"CSeq: 1 OPTIONS",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	})
+
+	It("should keep default T1 without adaptation", func() {
+		est := transaction.NewRTTEstimator(false)
+		est.Observe("example.com:5060", 3*time.Second)
+		rtt, ok := est.RTT("example.com:5060")
+		Expect(ok).To(BeTrue())
+		Expect(rtt).To(Equal(3 * time.Second))
+		Expect(est.T1("example.com:5060")).To(Equal(transaction.T1))
+	})
+
+	It("should adapt T1 within bounds", func() {
+		est := transaction.NewRTTEstimator(true)
+		Expect(est.T1("example.com:5060")).To(Equal(transaction.T1))
+
+		est.Observe("example.com:5060", 10*time.Millisecond)
+		Expect(est.T1("example.com:5060")).To(Equal(est.MinT1))
+
+		est.Observe("slow.example.com:5060", 2*time.Second)
+		Expect(est.T1("slow.example.com:5060")).To(Equal(est.MaxT1))
+
+		for i := 0; i < 50; i++ {
+			est.Observe("slow.example.com:5060", 600*time.Millisecond)
+		}
+		t1 := est.T1("slow.example.com:5060")
+		Expect(t1).To(BeNumerically(">", transaction.T1))
+		Expect(t1).To(BeNumerically("<", est.MaxT1))
+	})
+
+	It("should take RTT sample from Timestamp echo", func() {
+		est := transaction.NewRTTEstimator(true)
+		sent := float64(time.Now().Add(-300*time.Millisecond).UnixNano()) / float64(time.Second)
+		res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+		res.AppendHeader(&sip.GenericHeader{
+			HeaderName: "Timestamp",
+			Contents:   fmt.Sprintf("%.3f 0.1", sent),
+		})
+
+		Expect(est.ObserveResponse(req, res)).To(BeTrue())
+		rtt, ok := est.RTT("example.com:5060")
+		Expect(ok).To(BeTrue())
+		Expect(rtt).To(BeNumerically("~", 200*time.Millisecond, 50*time.Millisecond))
+
+		Expect(est.ObserveResponse(req, sip.NewResponseFromRequest("", req, 200, "OK", ""))).To(BeFalse())
+	})
+
+	It("should stamp request with Timestamp once", func() {
+		transaction.AddTimestamp(req)
+		transaction.AddTimestamp(req)
+		Expect(req.GetHeaders("Timestamp")).To(HaveLen(1))
+	})
+})
@@ -17,6 +17,8 @@ type ServerTx interface {
 	Respond(res sip.Response) error
 	Acks() <-chan sip.Request
 	Cancels() <-chan sip.Request
+	// OnPrack registers callback on PRACK acknowledging reliable provisional response - RFC 3262.
+	OnPrack(fn func(prack sip.Request))
 }
 
 type serverTx struct {
@@ -34,12 +36,35 @@ type serverTx struct {
 	timer_1xx    timing.Timer
 	timer_l      timing.Timer
 	reliable     bool
+	trying       TryingPolicy
+	timers       TimerOptions
+	rseq         uint32        // RSeq of the last reliable provisional response.
+	rel_pending  sip.Response  // Reliable provisional response waiting for PRACK.
+	rel_time     time.Duration // Current retransmission interval of the reliable provisional response.
+	rel_deadline time.Time
+	timer_rel    timing.Timer
+	onPrackFns   []func(sip.Request)
+	congestion   *CongestionControl
 
 	mu        sync.RWMutex
 	closeOnce sync.Once
 }
 
 func NewServerTx(origin sip.Request, tpl sip.Transport, logger log.Logger) (ServerTx, error) {
+	return NewServerTxWithOptions(origin, tpl, logger)
+}
+
+func NewServerTxWithOptions(
+	origin sip.Request,
+	tpl sip.Transport,
+	logger log.Logger,
+	options ...ServerTransactionOption,
+) (ServerTx, error) {
+	opts := ServerTransactionOptions{}
+	for _, opt := range options {
+		opt.ApplyServerTransaction(&opts)
+	}
+
 	key, err := MakeServerTxKey(origin)
 	if err != nil {
 		return nil, err
@@ -66,6 +91,8 @@ func NewServerTx(origin sip.Request, tpl sip.Transport, logger log.Logger) (Serv
 		"transaction_key": tx.key,
 	}).(sip.Request)
 	tx.reliable = tx.tpl.IsReliable(origin.Transport())
+	tx.trying = TryingDelayed
+	tx.timers = opts.Timers
 
 	return tx, nil
 }
@@ -84,12 +111,23 @@ func (tx *serverTx) Init() error {
 
 	tx.mu.Unlock()
 
+	tx.mu.RLock()
+	trying := tx.trying
+	tx.mu.RUnlock()
+
+	// RFC 3261 - 16.2
+	if tx.Origin().IsInvite() && trying == TryingImmediate {
+		if err := tx.Respond(sip.NewResponseFromRequest("", tx.Origin(), 100, "Trying", "")); err != nil {
+			tx.Log().Errorf("send '100 Trying' response failed: %s", err)
+		}
+	}
+
 	// RFC 3261 - 17.2.1
-	if tx.Origin().IsInvite() {
+	if tx.Origin().IsInvite() && trying == TryingDelayed {
 		tx.Log().Tracef("set timer_1xx to %v", Timer_1xx)
 
 		tx.mu.Lock()
-		tx.timer_1xx = timing.AfterFunc(Timer_1xx, func() {
+		tx.timer_1xx = timing.AfterFunc(Timer_1xx, tx.timerFunc("timer_1xx", func() {
 			select {
 			case <-tx.done:
 				return
@@ -109,7 +147,7 @@ func (tx *serverTx) Init() error {
 			); err != nil {
 				tx.Log().Errorf("send '100 Trying' response failed: %s", err)
 			}
-		})
+		}))
 		tx.mu.Unlock()
 	}
 
@@ -165,8 +203,18 @@ func (tx *serverTx) Respond(res sip.Response) error {
 		return nil
 	}
 
+	reliable1xx := res.IsProvisional() && tx.Origin().IsInvite() && sip.RequiresReliable(res)
+	if reliable1xx {
+		if err := tx.prepareReliable(res); err != nil {
+			return err
+		}
+	}
+
 	tx.mu.Lock()
 	tx.lastResp = res
+	if !res.IsProvisional() {
+		tx.stopReliable()
+	}
 
 	if tx.timer_1xx != nil {
 		tx.timer_1xx.Stop()
@@ -185,9 +233,20 @@ func (tx *serverTx) Respond(res sip.Response) error {
 	}
 
 	tx.fsmMu.RLock()
-	defer tx.fsmMu.RUnlock()
+	err := tx.fsm.Spin(input)
+	tx.fsmMu.RUnlock()
+
+	if reliable1xx {
+		if err != nil {
+			tx.mu.Lock()
+			tx.stopReliable()
+			tx.mu.Unlock()
+		} else {
+			tx.startReliable()
+		}
+	}
 
-	return tx.fsm.Spin(input)
+	return err
 }
 
 func (tx *serverTx) Acks() <-chan sip.Request {
@@ -324,7 +383,7 @@ func (tx *serverTx) initInviteFSM() {
 	}
 
 	// Define FSM
-	fsm_, err := fsm.Define(
+	fsm_, err := tx.defineFSM(
 		server_state_def_proceeding,
 		server_state_def_completed,
 		server_state_def_confirmed,
@@ -401,7 +460,7 @@ func (tx *serverTx) initNonInviteFSM() {
 	}
 
 	// Define FSM
-	fsm_, err := fsm.Define(
+	fsm_, err := tx.defineFSM(
 		server_state_def_trying,
 		server_state_def_proceeding,
 		server_state_def_completed,
@@ -447,7 +506,7 @@ func (tx *serverTx) timeoutErr() {
 	defer func() { recover() }()
 
 	err := &TxTimeoutError{
-		fmt.Errorf("transaction timed out"),
+		ErrTimeout,
 		tx.Key(),
 		fmt.Sprintf("%p", tx),
 	}
@@ -507,6 +566,7 @@ func (tx *serverTx) delete() {
 		tx.timer_1xx.Stop()
 		tx.timer_1xx = nil
 	}
+	tx.stopReliable()
 	tx.mu.Unlock()
 }
 
@@ -551,9 +611,14 @@ func (tx *serverTx) act_respond_complete() fsm.Input {
 
 	tx.mu.Lock()
 	tx.lastErr = lastErr
+	// only retransmissions are kept on congestion
+	retransmit := tx.timer_g != nil
 	tx.mu.Unlock()
 
-	if lastErr != nil {
+	if lastErr != nil && retransmit && tx.congestion != nil &&
+		tx.congestion.suppress(lastResp.Destination(), lastErr) {
+		tx.Log().Debugf("retransmit response failed on congestion, wait for the next retransmission: %s", lastErr)
+	} else if lastErr != nil {
 		return server_input_transport_err
 	}
 
@@ -562,7 +627,7 @@ func (tx *serverTx) act_respond_complete() fsm.Input {
 		if tx.timer_g == nil {
 			tx.Log().Tracef("timer_g set to %v", tx.timer_g_time)
 
-			tx.timer_g = timing.AfterFunc(tx.timer_g_time, func() {
+			tx.timer_g = timing.AfterFunc(tx.timer_g_time, tx.timerFunc("timer_g", func() {
 				select {
 				case <-tx.done:
 					return
@@ -576,16 +641,16 @@ func (tx *serverTx) act_respond_complete() fsm.Input {
 					tx.Log().Errorf("spin FSM to server_input_timer_g failed: %s", err)
 				}
 				tx.fsmMu.RUnlock()
-			})
+			}))
 		} else {
 			tx.timer_g_time *= 2
-			if tx.timer_g_time > T2 {
-				tx.timer_g_time = T2
+			if t2 := tx.timers.t2(); tx.timer_g_time > t2 {
+				tx.timer_g_time = t2
 			}
 
 			tx.Log().Tracef("timer_g reset to %v", tx.timer_g_time)
 
-			tx.timer_g.Reset(tx.timer_g_time)
+			tx.timer_g.Reset(tx.backoff(lastResp, tx.timer_g_time))
 		}
 		tx.mu.Unlock()
 	}
@@ -594,7 +659,7 @@ func (tx *serverTx) act_respond_complete() fsm.Input {
 	if tx.timer_h == nil {
 		tx.Log().Tracef("timer_h set to %v", Timer_H)
 
-		tx.timer_h = timing.AfterFunc(Timer_H, func() {
+		tx.timer_h = timing.AfterFunc(Timer_H, tx.timerFunc("timer_h", func() {
 			select {
 			case <-tx.done:
 				return
@@ -608,7 +673,7 @@ func (tx *serverTx) act_respond_complete() fsm.Input {
 				tx.Log().Errorf("spin FSM to server_input_timer_h failed: %s", err)
 			}
 			tx.fsmMu.RUnlock()
-		})
+		}))
 	}
 	tx.mu.Unlock()
 
@@ -639,7 +704,7 @@ func (tx *serverTx) act_respond_accept() fsm.Input {
 	tx.mu.Lock()
 	tx.Log().Tracef("timer_l set to %v", Timer_L)
 
-	tx.timer_l = timing.AfterFunc(Timer_L, func() {
+	tx.timer_l = timing.AfterFunc(Timer_L, tx.timerFunc("timer_l", func() {
 		select {
 		case <-tx.done:
 			return
@@ -653,7 +718,7 @@ func (tx *serverTx) act_respond_accept() fsm.Input {
 			tx.Log().Errorf("spin FSM to server_input_timer_l failed: %s", err)
 		}
 		tx.fsmMu.RUnlock()
-	})
+	}))
 	tx.mu.Unlock()
 
 	return fsm.NO_INPUT
@@ -700,9 +765,10 @@ func (tx *serverTx) act_final() fsm.Input {
 
 	tx.mu.Lock()
 
-	tx.Log().Tracef("timer_j set to %v", Timer_J)
+	timerJ := tx.timerJ()
+	tx.Log().Tracef("timer_j set to %v", timerJ)
 
-	tx.timer_j = timing.AfterFunc(Timer_J, func() {
+	tx.timer_j = timing.AfterFunc(timerJ, tx.timerFunc("timer_j", func() {
 		select {
 		case <-tx.done:
 			return
@@ -716,7 +782,7 @@ func (tx *serverTx) act_final() fsm.Input {
 			tx.Log().Errorf("spin FSM to server_input_timer_j failed: %s", err)
 		}
 		tx.fsmMu.RUnlock()
-	})
+	}))
 
 	tx.mu.Unlock()
 
@@ -791,7 +857,7 @@ func (tx *serverTx) act_confirm() fsm.Input {
 
 	tx.Log().Tracef("timer_i set to %v", Timer_I)
 
-	tx.timer_i = timing.AfterFunc(Timer_I, func() {
+	tx.timer_i = timing.AfterFunc(Timer_I, tx.timerFunc("timer_i", func() {
 		select {
 		case <-tx.done:
 			return
@@ -805,7 +871,7 @@ func (tx *serverTx) act_confirm() fsm.Input {
 			tx.Log().Errorf("spin FSM to server_input_timer_i failed: %s", err)
 		}
 		tx.fsmMu.RUnlock()
-	})
+	}))
 
 	tx.mu.Unlock()
 
@@ -842,3 +908,33 @@ func (tx *serverTx) act_cancel() fsm.Input {
 
 	return fsm.NO_INPUT
 }
+
+// Wait time for request retransmissions of non-INVITE transaction - RFC 3261 17.2.2.
+func (tx *serverTx) timerJ() time.Duration {
+	if tx.timers.T1 > 0 {
+		return 64 * tx.timers.T1
+	}
+	return Timer_J
+}
+
+// setTrying sets '100 Trying' policy before Init.
+func (tx *serverTx) setTrying(policy TryingPolicy) {
+	tx.mu.Lock()
+	tx.trying = policy
+	tx.mu.Unlock()
+}
+
+// setCongestion enables congestion control of response retransmissions.
+func (tx *serverTx) setCongestion(cc *CongestionControl) {
+	tx.mu.Lock()
+	tx.congestion = cc
+	tx.mu.Unlock()
+}
+
+// Retransmission interval of the response adapted to the destination congestion.
+func (tx *serverTx) backoff(res sip.Response, interval time.Duration) time.Duration {
+	if tx.congestion == nil {
+		return interval
+	}
+	return tx.congestion.Backoff(res.Destination(), interval)
+}
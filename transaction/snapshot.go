@@ -0,0 +1,476 @@
+package transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/snapshot"
+)
+
+// TxSnapshot is a serializable state of a transaction, messages are stored in the raw form.
+// Timers are not captured, timers of the restored state are restarted with their initial durations,
+// so the restored transaction may live longer than the original one but never shorter.
+type TxSnapshot struct {
+	Key    TxKey
+	Server bool
+	// State is an index of the transaction FSM state.
+	State  int
+	Origin string
+	// Transport, Source and Destination of the origin request, they are not a part of the raw message.
+	Transport    string
+	Source       string
+	Destination  string
+	LastResponse string
+	// T1 is a retransmission interval of the client transaction.
+	T1      time.Duration
+	TakenAt time.Time
+	// Checksum is verified on restore to detect corruption in the storage, see snapshot.Sum.
+	// Snapshots without checksum, e.g. built by hand, are restored unchecked.
+	Checksum string
+}
+
+// Returns checksum of the snapshot computed with the checksum field cleared.
+func txSum(txSnapshot TxSnapshot) string {
+	txSnapshot.Checksum = ""
+	return snapshot.Sum(txSnapshot)
+}
+
+func verifyTx(txSnapshot TxSnapshot) error {
+	if txSnapshot.Checksum == "" {
+		return nil
+	}
+	return snapshot.Verify(string(txSnapshot.Key), txSnapshot.Checksum, txSum(txSnapshot))
+}
+
+func (snapshot TxSnapshot) terminated() bool {
+	if snapshot.Server {
+		return snapshot.State == server_state_terminated
+	}
+	return snapshot.State == client_state_terminated
+}
+
+// LayerSnapshot is a serializable state of all live transactions of the transaction layer.
+type LayerSnapshot struct {
+	Transactions []TxSnapshot
+	TakenAt      time.Time
+}
+
+// Captures state common to client and server transactions, should be called with transaction lock held.
+func (tx *commonTx) snapshot() TxSnapshot {
+	snapshot := TxSnapshot{
+		Key:         tx.key,
+		State:       int(atomic.LoadInt32(&tx.state)),
+		Origin:      tx.origin.String(),
+		Transport:   tx.origin.Transport(),
+		Source:      tx.origin.Source(),
+		Destination: tx.origin.Destination(),
+		TakenAt:     time.Now(),
+	}
+	if tx.lastResp != nil {
+		snapshot.LastResponse = tx.lastResp.String()
+	}
+
+	return snapshot
+}
+
+func (tx *clientTx) Snapshot() TxSnapshot {
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+
+	snapshot := tx.snapshot()
+	snapshot.T1 = tx.t1
+	snapshot.Checksum = txSum(snapshot)
+
+	return snapshot
+}
+
+func (tx *serverTx) Snapshot() TxSnapshot {
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+
+	snapshot := tx.snapshot()
+	snapshot.Server = true
+	snapshot.Checksum = txSum(snapshot)
+
+	return snapshot
+}
+
+// RestoreTx creates a transaction from the snapshot and restarts timers of the restored state.
+// Restored transaction is not bound to any transaction layer, use Layer.RestoreAll to serve it.
+// Pending reliable provisional responses (RFC 3262) and proxy timer C are not restored.
+// Corrupted snapshot is reported with snapshot.CorruptedError.
+func RestoreTx(snapshot TxSnapshot, tpl sip.Transport, logger log.Logger) (Tx, error) {
+	tx, err := restoreTx(snapshot, tpl, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	resumeTx(tx)
+
+	return tx, nil
+}
+
+func restoreTx(snapshot TxSnapshot, tpl sip.Transport, logger log.Logger) (Tx, error) {
+	if err := verifyTx(snapshot); err != nil {
+		return nil, fmt.Errorf("restore transaction %s: %w", snapshot.Key, err)
+	}
+
+	origin, err := parseSnapshotMessage(snapshot.Origin, logger)
+	if err != nil {
+		return nil, fmt.Errorf("restore transaction %s origin: %w", snapshot.Key, err)
+	}
+	req, ok := origin.(sip.Request)
+	if !ok {
+		return nil, fmt.Errorf("restore transaction %s origin: %s is not a request", snapshot.Key, origin.Short())
+	}
+	req.SetTransport(snapshot.Transport)
+	req.SetSource(snapshot.Source)
+	req.SetDestination(snapshot.Destination)
+
+	var lastResp sip.Response
+	if snapshot.LastResponse != "" {
+		msg, err := parseSnapshotMessage(snapshot.LastResponse, logger)
+		if err != nil {
+			return nil, fmt.Errorf("restore transaction %s last response: %w", snapshot.Key, err)
+		}
+		if lastResp, ok = msg.(sip.Response); !ok {
+			return nil, fmt.Errorf("restore transaction %s last response: %s is not a response", snapshot.Key, msg.Short())
+		}
+		lastResp.SetTransport(snapshot.Transport)
+		lastResp.SetSource(snapshot.Destination)
+		lastResp.SetDestination(snapshot.Source)
+	}
+
+	if snapshot.Server {
+		tx, err := NewServerTx(req, tpl, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		stx := tx.(*serverTx)
+		stx.restored = true
+		stx.state = int32(snapshot.State)
+		stx.lastResp = lastResp
+		stx.initFSM()
+		if stx.fsm == nil {
+			return nil, fmt.Errorf("restore transaction %s: invalid state %d", snapshot.Key, snapshot.State)
+		}
+
+		return stx, nil
+	}
+
+	tx, err := NewClientTx(req, tpl, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := tx.(*clientTx)
+	ctx.restored = true
+	ctx.state = int32(snapshot.State)
+	ctx.lastResp = lastResp
+	if snapshot.T1 > 0 {
+		ctx.t1 = snapshot.T1
+	}
+	ctx.initFSM()
+	if ctx.fsm == nil {
+		return nil, fmt.Errorf("restore transaction %s: invalid state %d", snapshot.Key, snapshot.State)
+	}
+
+	return ctx, nil
+}
+
+func parseSnapshotMessage(data string, logger log.Logger) (sip.Message, error) {
+	return parser.ParseMessage([]byte(data), logger)
+}
+
+func resumeTx(tx Tx) {
+	switch tx := tx.(type) {
+	case *clientTx:
+		tx.resume()
+	case *serverTx:
+		tx.resume()
+	}
+}
+
+// Restarts timers of the restored state - RFC 3261 17.1.1, 17.1.2.
+func (tx *clientTx) resume() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.timer_d_time = tx.waitInterval()
+
+	switch atomic.LoadInt32(&tx.state) {
+	case client_state_calling:
+		if !tx.reliable {
+			tx.timer_a_time = tx.retransmitInterval()
+			tx.timer_a = tx.restoreTimer("timer_a", tx.timer_a_time, client_input_timer_a)
+		}
+		tx.timer_b = tx.restoreTimer("timer_b", tx.timeoutInterval(), client_input_timer_b)
+	case client_state_proceeding:
+		// INVITE waits for the final response without timers, non-INVITE is still guarded by timer B
+		if !tx.origin.IsInvite() {
+			tx.timer_b = tx.restoreTimer("timer_b", tx.timeoutInterval(), client_input_timer_b)
+		}
+	case client_state_completed:
+		tx.timer_d = tx.restoreTimer("timer_d", tx.timer_d_time, client_input_timer_d)
+	case client_state_accepted:
+		tx.timer_m = tx.restoreTimer("timer_m", Timer_M, client_input_timer_m)
+	}
+}
+
+// Restarts timers of the restored state - RFC 3261 17.2.1, 17.2.2.
+func (tx *serverTx) resume() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.reliable {
+		tx.timer_i_time = 0
+	} else {
+		tx.timer_g_time = Timer_G
+		tx.timer_i_time = Timer_I
+	}
+
+	switch atomic.LoadInt32(&tx.state) {
+	case server_state_completed:
+		if !tx.origin.IsInvite() {
+			tx.timer_j = tx.restoreTimer("timer_j", tx.timerJ(), server_input_timer_j)
+			break
+		}
+		if !tx.reliable {
+			tx.timer_g = tx.restoreTimer("timer_g", tx.timer_g_time, server_input_timer_g)
+		}
+		tx.timer_h = tx.restoreTimer("timer_h", Timer_H, server_input_timer_h)
+	case server_state_confirmed:
+		tx.timer_i = tx.restoreTimer("timer_i", Timer_I, server_input_timer_i)
+	case server_state_accepted:
+		tx.timer_l = tx.restoreTimer("timer_l", Timer_L, server_input_timer_l)
+	}
+}
+
+type RestoreOption interface {
+	ApplyRestore(opts *RestoreOptions)
+}
+
+type RestoreOptions struct {
+	// Adapt rewrites local addresses of the restored messages that don't match the listeners, see Rebind.
+	Adapt bool
+}
+
+type withAdapt struct {
+	adapt bool
+}
+
+func (o withAdapt) ApplyRestore(opts *RestoreOptions) {
+	opts.Adapt = o.adapt
+}
+
+// WithAdapt toggles rewriting of mismatched local addresses on restore.
+func WithAdapt(adapt bool) RestoreOption {
+	return withAdapt{adapt}
+}
+
+func (txl *layer) SnapshotAll() LayerSnapshot {
+	snapshot := LayerSnapshot{
+		TakenAt: time.Now(),
+	}
+	for _, tx := range txl.transactions.all() {
+		select {
+		case <-tx.Done():
+			continue
+		default:
+		}
+
+		txSnapshot := tx.Snapshot()
+		if txSnapshot.terminated() {
+			continue
+		}
+		snapshot.Transactions = append(snapshot.Transactions, txSnapshot)
+	}
+
+	return snapshot
+}
+
+func (txl *layer) RestoreAll(snapshot LayerSnapshot, listeners map[string]string, options ...RestoreOption) error {
+	select {
+	case <-txl.canceled:
+		return fmt.Errorf("transaction layer is canceled")
+	default:
+	}
+
+	opts := RestoreOptions{}
+	for _, opt := range options {
+		opt.ApplyRestore(&opts)
+	}
+
+	txs := make([]Tx, 0, len(snapshot.Transactions))
+	keys := make(map[TxKey]bool, len(snapshot.Transactions))
+	for _, txSnapshot := range snapshot.Transactions {
+		tx, err := restoreTx(txSnapshot, txl.tpl, txl.Log())
+		if err != nil {
+			return err
+		}
+		if _, ok := txl.transactions.get(tx.Key()); ok || keys[tx.Key()] {
+			return fmt.Errorf("restore transaction %s: transaction already exists", tx.Key())
+		}
+		if err := rebindTx(tx, listeners, opts.Adapt); err != nil {
+			return err
+		}
+
+		txs = append(txs, tx)
+		keys[tx.Key()] = true
+	}
+
+	for _, tx := range txs {
+		txl.trackChanges(tx)
+		txl.transactions.put(tx.Key(), tx)
+	}
+	for _, tx := range txs {
+		resumeTx(tx)
+		txl.persist(tx)
+
+		select {
+		case <-txl.canceled:
+			return fmt.Errorf("transaction layer is canceled")
+		case txl.serveTxCh <- tx:
+		}
+	}
+
+	return nil
+}
+
+// Rebinds the restored transaction to the listener of its transport,
+// listeners map transport network to the local address.
+func rebindTx(tx Tx, listeners map[string]string, adapt bool) error {
+	addr, ok := listeners[sip.TokenLower(tx.Origin().Transport())]
+	if !ok {
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("rebind transaction %s: %w", tx.Key(), err)
+	}
+	num, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("rebind transaction %s: %w", tx.Key(), err)
+	}
+
+	switch tx := tx.(type) {
+	case *clientTx:
+		return Rebind(tx.origin, host, sip.Port(num), adapt)
+	case *serverTx:
+		if tx.lastResp != nil {
+			return Rebind(tx.lastResp, host, sip.Port(num), adapt)
+		}
+	}
+
+	return nil
+}
+
+// LoadSnapshot reads snapshots of transactions persisted with WithSnapshotStore,
+// the result is passed to Layer.RestoreAll. Truncated or mangled snapshots are reported with snapshot.CorruptedError.
+func LoadSnapshot(store snapshot.Store) (LayerSnapshot, error) {
+	loaded := LayerSnapshot{
+		TakenAt: time.Now(),
+	}
+
+	keys, err := store.List()
+	if err != nil {
+		return loaded, fmt.Errorf("list transaction snapshots: %w", err)
+	}
+	for _, key := range keys {
+		data, err := store.Load(key)
+		if errors.Is(err, snapshot.ErrNotFound) {
+			// terminated after listing
+			continue
+		}
+		if err != nil {
+			return loaded, fmt.Errorf("load transaction %s snapshot: %w", key, err)
+		}
+
+		var txSnapshot TxSnapshot
+		if err := json.Unmarshal(data, &txSnapshot); err != nil {
+			return loaded, fmt.Errorf("decode transaction %s snapshot: %w", key, &snapshot.CorruptedError{
+				Key:    key,
+				Reason: err.Error(),
+			})
+		}
+		// persisted snapshots always have checksum
+		if txSnapshot.Checksum == "" {
+			return loaded, fmt.Errorf("decode transaction %s snapshot: %w", key, &snapshot.CorruptedError{
+				Key:    key,
+				Reason: "missing checksum",
+			})
+		}
+		if err := verifyTx(txSnapshot); err != nil {
+			return loaded, fmt.Errorf("decode transaction %s snapshot: %w", key, err)
+		}
+		loaded.Transactions = append(loaded.Transactions, txSnapshot)
+	}
+
+	return loaded, nil
+}
+
+// Persists snapshot of the transaction on every state change.
+func (txl *layer) trackChanges(tx Tx) {
+	if txl.store == nil {
+		return
+	}
+
+	onChange := func() { txl.persist(tx) }
+	switch tx := tx.(type) {
+	case *clientTx:
+		tx.onChange = onChange
+	case *serverTx:
+		tx.onChange = onChange
+	}
+}
+
+func (txl *layer) persist(tx Tx) {
+	if txl.store == nil {
+		return
+	}
+	// snapshots of the canceled layer are kept to be restored after restart
+	select {
+	case <-txl.canceled:
+		return
+	default:
+	}
+
+	txSnapshot := tx.Snapshot()
+	if txSnapshot.terminated() {
+		txl.unpersist(tx)
+		return
+	}
+
+	data, err := json.Marshal(txSnapshot)
+	if err == nil {
+		err = txl.store.Save(string(tx.Key()), data)
+	}
+	if err != nil {
+		log.AddFieldsFrom(txl.Log(), tx).Errorf("persist transaction snapshot failed: %s", err)
+	}
+}
+
+func (txl *layer) unpersist(tx Tx) {
+	if txl.store == nil {
+		return
+	}
+	select {
+	case <-txl.canceled:
+		return
+	default:
+	}
+
+	if err := txl.store.Delete(string(tx.Key())); err != nil {
+		log.AddFieldsFrom(txl.Log(), tx).Errorf("delete transaction snapshot failed: %s", err)
+	}
+}
@@ -0,0 +1,205 @@
+package transaction_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/snapshot"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("Layer snapshot", func() {
+	var (
+		tpl, restoredTpl *testutils.MockTransportLayer
+		txl, restoredTxl transaction.Layer
+		invite           sip.Request
+	)
+
+	BeforeEach(func() {
+		tpl = testutils.NewMockTransportLayer()
+		txl = transaction.NewLayer(tpl, testutils.NewLogrusLogger())
+		restoredTpl = testutils.NewMockTransportLayer()
+		restoredTxl = transaction.NewLayer(restoredTpl, testutils.NewLogrusLogger())
+		invite = testutils.Request([]string{
+			"INVITE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=" + sip.GenerateBranch(),
+			"From: <sip:alice@example.com>;tag=1928301774",
+			"To: <sip:bob@example.com>",
+			"Call-ID: a84b4c76e66710",
+			"Contact: <sip:alice@10.0.0.1:5060>",
+			"CSeq: 1 INVITE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	})
+	AfterEach(func(done Done) {
+		txl.Cancel()
+		<-txl.Done()
+		restoredTxl.Cancel()
+		<-restoredTxl.Done()
+		close(done)
+	}, 3)
+
+	It("should restore completed INVITE server transaction", func(done Done) {
+		defer close(done)
+
+		tpl.InMsgs <- invite
+		tx := <-txl.Requests()
+		go func() {
+			defer GinkgoRecover()
+			res := sip.NewResponseFromRequest("", tx.Origin(), 486, "Busy Here", "")
+			Expect(tx.Respond(res)).To(Succeed())
+		}()
+		Expect((<-tpl.OutMsgs).(sip.Response).StatusCode()).To(Equal(sip.StatusCode(486)))
+
+		data, err := json.Marshal(txl.SnapshotAll())
+		Expect(err).ToNot(HaveOccurred())
+		var snapshot transaction.LayerSnapshot
+		Expect(json.Unmarshal(data, &snapshot)).To(Succeed())
+		Expect(snapshot.Transactions).To(HaveLen(1))
+		Expect(snapshot.Transactions[0].Key).To(Equal(tx.Key()))
+		Expect(snapshot.Transactions[0].Server).To(BeTrue())
+
+		Expect(restoredTxl.RestoreAll(snapshot, nil)).To(Succeed())
+		restored, ok := restoredTxl.ServerTransaction(tx.Key())
+		Expect(ok).To(BeTrue())
+		Expect(restored.Origin().String()).To(Equal(invite.String()))
+
+		// retransmitted INVITE is answered with the restored final response
+		restoredTpl.InMsgs <- invite
+		msg := <-restoredTpl.OutMsgs
+		Expect(msg.(sip.Response).StatusCode()).To(Equal(sip.StatusCode(486)))
+	}, 3)
+
+	It("should restore nothing if any transaction fails", func() {
+		key, err := transaction.MakeServerTxKey(invite)
+		Expect(err).ToNot(HaveOccurred())
+		snapshot := transaction.LayerSnapshot{
+			Transactions: []transaction.TxSnapshot{
+				{Key: key, Server: true, State: 1, Origin: invite.String(), Transport: "UDP"},
+				{Key: "broken", Origin: "not a SIP message"},
+			},
+		}
+
+		Expect(restoredTxl.RestoreAll(snapshot, nil)).ToNot(Succeed())
+		_, ok := restoredTxl.ServerTransaction(key)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should fail on mismatched local address without adaptation", func() {
+		key, err := transaction.MakeClientTxKey(invite)
+		Expect(err).ToNot(HaveOccurred())
+		snapshot := transaction.LayerSnapshot{
+			Transactions: []transaction.TxSnapshot{
+				{Key: key, State: 1, Origin: invite.String(), Transport: "UDP"},
+			},
+		}
+		listeners := map[string]string{"udp": "10.0.0.1:5080"}
+
+		err = restoredTxl.RestoreAll(snapshot, listeners)
+		Expect(err).To(HaveOccurred())
+		_, ok := err.(*transaction.TxRebindError)
+		Expect(ok).To(BeTrue())
+
+		Expect(restoredTxl.RestoreAll(snapshot, listeners, transaction.WithAdapt(true))).To(Succeed())
+		restored, ok := restoredTxl.ClientTransaction(key)
+		Expect(ok).To(BeTrue())
+		hop, _ := restored.Origin().ViaHop()
+		Expect(hop.SentBy()).To(Equal("10.0.0.1:5080"))
+	})
+
+	Context("with snapshot store", func() {
+		var store *snapshot.MemoryStore
+
+		BeforeEach(func() {
+			txl.Cancel()
+			<-txl.Done()
+
+			store = snapshot.NewMemoryStore()
+			tpl = testutils.NewMockTransportLayer()
+			txl = transaction.NewLayerWithOptions(tpl, testutils.NewLogrusLogger(), transaction.WithSnapshotStore(store))
+		})
+
+		It("should persist transactions on state change and restore them", func(done Done) {
+			defer close(done)
+
+			tpl.InMsgs <- invite
+			tx := <-txl.Requests()
+			keys, _ := store.List()
+			Expect(keys).To(Equal([]string{string(tx.Key())}))
+
+			go func() {
+				defer GinkgoRecover()
+				res := sip.NewResponseFromRequest("", tx.Origin(), 486, "Busy Here", "")
+				Expect(tx.Respond(res)).To(Succeed())
+			}()
+			<-tpl.OutMsgs
+
+			var loaded transaction.LayerSnapshot
+			Eventually(func() string {
+				var err error
+				loaded, err = transaction.LoadSnapshot(store)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(loaded.Transactions).To(HaveLen(1))
+				return loaded.Transactions[0].LastResponse
+			}).Should(ContainSubstring("486 Busy Here"))
+
+			// snapshots survive layer shutdown
+			txl.Cancel()
+			<-txl.Done()
+			keys, _ = store.List()
+			Expect(keys).To(HaveLen(1))
+
+			Expect(restoredTxl.RestoreAll(loaded, nil)).To(Succeed())
+			_, ok := restoredTxl.ServerTransaction(tx.Key())
+			Expect(ok).To(BeTrue())
+		}, 3)
+
+		It("should report corrupted snapshots", func(done Done) {
+			defer close(done)
+
+			tpl.InMsgs <- invite
+			tx := <-txl.Requests()
+			key := string(tx.Key())
+
+			loaded, err := transaction.LoadSnapshot(store)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded.Transactions).To(HaveLen(1))
+
+			mangled := loaded
+			mangled.Transactions = []transaction.TxSnapshot{loaded.Transactions[0]}
+			mangled.Transactions[0].Origin = strings.Replace(mangled.Transactions[0].Origin, "INVITE", "OPTIONS", 1)
+			Expect(errors.Is(restoredTxl.RestoreAll(mangled, nil), snapshot.ErrCorrupted)).To(BeTrue())
+			_, err = transaction.RestoreTx(mangled.Transactions[0], tpl, testutils.NewLogrusLogger())
+			Expect(errors.Is(err, snapshot.ErrCorrupted)).To(BeTrue())
+
+			txl.Cancel()
+			<-txl.Done()
+			data, err := store.Load(key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(store.Save(key, data[:len(data)/2])).To(Succeed())
+			_, err = transaction.LoadSnapshot(store)
+			Expect(errors.Is(err, snapshot.ErrCorrupted)).To(BeTrue())
+		}, 3)
+
+		It("should delete snapshot of terminated transaction", func(done Done) {
+			defer close(done)
+
+			tpl.InMsgs <- invite
+			tx := <-txl.Requests()
+			tx.(transaction.ServerTx).Terminate()
+
+			Eventually(func() []string {
+				keys, _ := store.List()
+				return keys
+			}).Should(BeEmpty())
+		}, 3)
+	})
+})
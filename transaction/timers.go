@@ -0,0 +1,97 @@
+package transaction
+
+import "time"
+
+// TimerOptions overrides RFC 3261 timer values, zero fields keep the defaults - RFC 3261 17.1.2.2, 17.2.2.
+// Timers E, F and K of non-INVITE client transactions are derived from T1 and T4 unless set explicitly.
+// Server transactions take T1 for timer J and T2 for the cap of timer G retransmissions.
+type TimerOptions struct {
+	T1     time.Duration
+	T2     time.Duration
+	T4     time.Duration
+	TimerE time.Duration
+	TimerF time.Duration
+	TimerK time.Duration
+}
+
+// Merges non-zero values of the other options.
+func (timers TimerOptions) merge(other TimerOptions) TimerOptions {
+	if other.T1 > 0 {
+		timers.T1 = other.T1
+	}
+	if other.T2 > 0 {
+		timers.T2 = other.T2
+	}
+	if other.T4 > 0 {
+		timers.T4 = other.T4
+	}
+	if other.TimerE > 0 {
+		timers.TimerE = other.TimerE
+	}
+	if other.TimerF > 0 {
+		timers.TimerF = other.TimerF
+	}
+	if other.TimerK > 0 {
+		timers.TimerK = other.TimerK
+	}
+	return timers
+}
+
+func (timers TimerOptions) t2() time.Duration {
+	if timers.T2 > 0 {
+		return timers.T2
+	}
+	return T2
+}
+
+func (timers TimerOptions) t4() time.Duration {
+	if timers.T4 > 0 {
+		return timers.T4
+	}
+	return T4
+}
+
+type ClientTransactionOption interface {
+	ApplyClientTransaction(opts *ClientTransactionOptions)
+}
+
+type ClientTransactionOptions struct {
+	Timers TimerOptions
+}
+
+type ServerTransactionOption interface {
+	ApplyServerTransaction(opts *ServerTransactionOptions)
+}
+
+type ServerTransactionOptions struct {
+	Timers TimerOptions
+}
+
+type withTimers struct {
+	timers TimerOptions
+}
+
+func (o withTimers) ApplyLayer(opts *LayerOptions) {
+	opts.Timers = opts.Timers.merge(o.timers)
+}
+
+func (o withTimers) ApplyClientTransaction(opts *ClientTransactionOptions) {
+	opts.Timers = opts.Timers.merge(o.timers)
+}
+
+func (o withTimers) ApplyServerTransaction(opts *ServerTransactionOptions) {
+	opts.Timers = opts.Timers.merge(o.timers)
+}
+
+// TimersOption is accepted by the layer and by client and server transactions.
+type TimersOption interface {
+	LayerOption
+	ClientTransactionOption
+	ServerTransactionOption
+}
+
+// WithTimers overrides timer values of all transactions of the layer or of the single transaction.
+// Options of the transaction take precedence over options of the layer.
+func WithTimers(timers TimerOptions) TimersOption {
+	return withTimers{timers}
+}
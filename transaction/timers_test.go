@@ -0,0 +1,79 @@
+package transaction_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("Transaction timers", func() {
+	var (
+		tpl *testutils.MockTransportLayer
+		txl transaction.Layer
+		req sip.Request
+	)
+
+	BeforeEach(func() {
+		tpl = testutils.NewMockTransportLayer()
+		req = testutils.Request([]string{
+			"OPTIONS sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=" + sip.GenerateBranch(),
+			"From: <sip:alice@example.com>;tag=1928301774",
+			"To: <sip:bob@example.com>",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 1 OPTIONS",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	})
+	AfterEach(func(done Done) {
+		txl.Cancel()
+		<-txl.Done()
+		close(done)
+	}, 3)
+
+	It("should time out non-INVITE client transaction after layer timer F", func(done Done) {
+		defer close(done)
+
+		txl = transaction.NewLayerWithOptions(tpl, testutils.NewLogrusLogger(),
+			transaction.WithTimers(transaction.TimerOptions{TimerF: 200 * time.Millisecond}))
+		txs := make(chan sip.ClientTransaction, 1)
+		go func() {
+			defer GinkgoRecover()
+			tx, err := txl.Request(req)
+			Expect(err).ToNot(HaveOccurred())
+			txs <- tx
+		}()
+		<-tpl.OutMsgs
+		tx := <-txs
+
+		start := time.Now()
+		Expect(<-tx.Errors()).To(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	}, 3)
+
+	It("should prefer per request timers over layer timers", func(done Done) {
+		defer close(done)
+
+		txl = transaction.NewLayerWithOptions(tpl, testutils.NewLogrusLogger(),
+			transaction.WithTimers(transaction.TimerOptions{TimerF: time.Minute}))
+		txs := make(chan sip.ClientTransaction, 1)
+		go func() {
+			defer GinkgoRecover()
+			tx, err := txl.RequestWithOptions(req,
+				transaction.WithTimers(transaction.TimerOptions{TimerF: 200 * time.Millisecond}))
+			Expect(err).ToNot(HaveOccurred())
+			txs <- tx
+		}()
+		<-tpl.OutMsgs
+		tx := <-txs
+
+		Expect(<-tx.Errors()).To(HaveOccurred())
+	}, 3)
+})
@@ -2,6 +2,7 @@
 package transaction
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -16,6 +17,7 @@ const (
 	T4        = 5 * time.Second
 	Timer_A   = T1
 	Timer_B   = 64 * T1
+	Timer_C   = 3*time.Minute + 5*time.Second
 	Timer_D   = 32 * time.Second
 	Timer_E   = T1
 	Timer_F   = 64 * T1
@@ -29,6 +31,14 @@ const (
 	Timer_M   = 64 * T1
 )
 
+var (
+	// ErrTransactionTerminated is matched by errors of transactions terminated
+	// before the final response.
+	ErrTransactionTerminated = errors.New("transaction terminated")
+	// ErrTimeout is matched by errors of transactions timed out by timer B, F, H or J.
+	ErrTimeout = errors.New("transaction timed out")
+)
+
 type TxError interface {
 	error
 	Key() TxKey
@@ -43,11 +53,12 @@ type TxTerminatedError struct {
 	TxPtr string
 }
 
-func (err *TxTerminatedError) Unwrap() error    { return err.Err }
-func (err *TxTerminatedError) Terminated() bool { return true }
-func (err *TxTerminatedError) Timeout() bool    { return false }
-func (err *TxTerminatedError) Transport() bool  { return false }
-func (err *TxTerminatedError) Key() TxKey       { return err.TxKey }
+func (err *TxTerminatedError) Unwrap() error        { return err.Err }
+func (err *TxTerminatedError) Is(target error) bool { return target == ErrTransactionTerminated }
+func (err *TxTerminatedError) Terminated() bool     { return true }
+func (err *TxTerminatedError) Timeout() bool        { return false }
+func (err *TxTerminatedError) Transport() bool      { return false }
+func (err *TxTerminatedError) Key() TxKey           { return err.TxKey }
 func (err *TxTerminatedError) Error() string {
 	if err == nil {
 		return "<nil>"
@@ -74,11 +85,12 @@ type TxTimeoutError struct {
 	TxPtr string
 }
 
-func (err *TxTimeoutError) Unwrap() error    { return err.Err }
-func (err *TxTimeoutError) Terminated() bool { return false }
-func (err *TxTimeoutError) Timeout() bool    { return true }
-func (err *TxTimeoutError) Transport() bool  { return false }
-func (err *TxTimeoutError) Key() TxKey       { return err.TxKey }
+func (err *TxTimeoutError) Unwrap() error        { return err.Err }
+func (err *TxTimeoutError) Is(target error) bool { return target == ErrTimeout }
+func (err *TxTimeoutError) Terminated() bool     { return false }
+func (err *TxTimeoutError) Timeout() bool        { return true }
+func (err *TxTimeoutError) Transport() bool      { return false }
+func (err *TxTimeoutError) Key() TxKey           { return err.TxKey }
 func (err *TxTimeoutError) Error() string {
 	if err == nil {
 		return "<nil>"
@@ -0,0 +1,40 @@
+package transaction_test
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/transaction"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("TxError", func() {
+	It("should match timed out transaction", func() {
+		var err error = &transaction.TxTimeoutError{Err: transaction.ErrTimeout, TxKey: "key"}
+		Expect(errors.Is(err, transaction.ErrTimeout)).To(BeTrue())
+		Expect(errors.Is(err, transaction.ErrTransactionTerminated)).To(BeFalse())
+	})
+
+	It("should match terminated transaction", func() {
+		var err error = &transaction.TxTerminatedError{Err: fmt.Errorf("terminated by user"), TxKey: "key"}
+		Expect(errors.Is(err, transaction.ErrTransactionTerminated)).To(BeTrue())
+		Expect(errors.Is(err, transaction.ErrTimeout)).To(BeFalse())
+	})
+
+	It("should unwrap transport error", func() {
+		var err error = &transaction.TxTransportError{
+			Err: fmt.Errorf("transaction failed to send: %w", &transport.ConnectionError{
+				Err: syscall.ECONNREFUSED,
+				Op:  "write",
+			}),
+			TxKey: "key",
+		}
+		Expect(errors.Is(err, transport.ErrTransportUnreachable)).To(BeTrue())
+		var connErr *transport.ConnectionError
+		Expect(errors.As(err, &connErr)).To(BeTrue())
+	})
+})
@@ -3,11 +3,14 @@ package transaction
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/discoviking/fsm"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
 )
 
 type TxKey = sip.TransactionKey
@@ -24,12 +27,17 @@ type Tx interface {
 	Terminate()
 	Errors() <-chan error
 	Done() <-chan bool
+	// Snapshot captures state of the transaction to restore it later with RestoreTx.
+	Snapshot() TxSnapshot
 }
 
 type commonTx struct {
 	key      TxKey
 	fsm      *fsm.FSM
 	fsmMu    sync.RWMutex
+	state    int32 // Current FSM state, tracked for snapshots.
+	restored bool
+	onChange func() // Called after transition to another state.
 	origin   sip.Request
 	tpl      sip.Transport
 	lastResp sip.Response
@@ -53,6 +61,11 @@ func (tx *commonTx) String() string {
 	return fmt.Sprintf("%s<%s>", tx.Log().Prefix(), fields)
 }
 
+// Wraps timer callback with panic recovery, reports include transaction and timer name.
+func (tx *commonTx) timerFunc(timer string, f func()) func() {
+	return timing.PanicPolicy{Logger: tx.Log()}.Protect(fmt.Sprintf("%s %s", tx, timer), f)
+}
+
 func (tx *commonTx) Log() log.Logger {
 	return tx.log
 }
@@ -76,3 +89,70 @@ func (tx *commonTx) Errors() <-chan error {
 func (tx *commonTx) Done() <-chan bool {
 	return tx.done
 }
+
+// Defines FSM that starts from the restored state (the first state by default)
+// and tracks the current state for snapshots.
+func (tx *commonTx) defineFSM(states ...fsm.State) (*fsm.FSM, error) {
+	start := states[0].Index
+	if tx.restored {
+		start = int(atomic.LoadInt32(&tx.state))
+	}
+
+	ordered := make([]fsm.State, 0, len(states))
+	for _, state := range states {
+		outcomes := make(map[fsm.Input]fsm.Outcome, len(state.Outcomes))
+		for input, outcome := range state.Outcomes {
+			outcomes[input] = tx.trackOutcome(outcome)
+		}
+		state.Outcomes = outcomes
+
+		if state.Index == start {
+			ordered = append([]fsm.State{state}, ordered...)
+		} else {
+			ordered = append(ordered, state)
+		}
+	}
+	if ordered[0].Index != start {
+		return nil, fmt.Errorf("unknown FSM state %d", start)
+	}
+
+	atomic.StoreInt32(&tx.state, int32(start))
+
+	return fsm.Define(ordered...)
+}
+
+func (tx *commonTx) trackOutcome(outcome fsm.Outcome) fsm.Outcome {
+	state, action := outcome.State, outcome.Action
+	return fsm.Outcome{
+		State: state,
+		Action: func() fsm.Input {
+			prev := atomic.SwapInt32(&tx.state, int32(state))
+			input := action()
+			if prev != int32(state) && tx.onChange != nil {
+				tx.onChange()
+			}
+			return input
+		},
+	}
+}
+
+// Starts timer of the restored transaction that spins FSM with the input on fire.
+func (tx *commonTx) restoreTimer(timer string, d time.Duration, input fsm.Input) timing.Timer {
+	tx.Log().Tracef("%s set to %v", timer, d)
+
+	return timing.AfterFunc(d, tx.timerFunc(timer, func() {
+		select {
+		case <-tx.done:
+			return
+		default:
+		}
+
+		tx.Log().Tracef("%s fired", timer)
+
+		tx.fsmMu.RLock()
+		if err := tx.fsm.Spin(input); err != nil {
+			tx.Log().Errorf("spin FSM on %s failed: %s", timer, err)
+		}
+		tx.fsmMu.RUnlock()
+	}))
+}
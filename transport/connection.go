@@ -7,6 +7,9 @@ import (
 	"sync"
 	"time"
 
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
 	"github.com/ghettovoice/gosip/log"
 )
 
@@ -34,6 +37,8 @@ type connection struct {
 	laddr    net.Addr
 	raddr    net.Addr
 	streamed bool
+	// time of the last successful read
+	readTime time.Time
 	mu       sync.RWMutex
 
 	log log.Logger
@@ -116,11 +121,22 @@ func (conn *connection) Read(buf []byte) (int, error) {
 		}
 	}
 
+	conn.mu.Lock()
+	conn.readTime = time.Now()
+	conn.mu.Unlock()
+
 	conn.Log().Tracef("read %d bytes %s <- %s:\n%s", num, conn.LocalAddr(), conn.RemoteAddr(), buf[:num])
 
 	return num, err
 }
 
+// lastRead returns time of the last data read from the stream connection.
+func (conn *connection) lastRead() time.Time {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	return conn.readTime
+}
+
 func (conn *connection) ReadFrom(buf []byte) (num int, raddr net.Addr, err error) {
 	num, raddr, err = conn.baseConn.(net.PacketConn).ReadFrom(buf)
 	if err != nil {
@@ -217,3 +233,16 @@ func (conn *connection) SetReadDeadline(t time.Time) error {
 func (conn *connection) SetWriteDeadline(t time.Time) error {
 	return conn.baseConn.SetWriteDeadline(t)
 }
+
+// SetMulticastTTL sets TTL (hop limit for IPv6) of outgoing multicast packets of the packet connection.
+func (conn *connection) SetMulticastTTL(ttl int) error {
+	pc, ok := conn.baseConn.(net.PacketConn)
+	if !ok {
+		return fmt.Errorf("connection %s is not a packet connection", conn.Key())
+	}
+
+	if addr, ok := pc.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil && addr.IP.To16() != nil {
+		return ipv6.NewPacketConn(pc).SetMulticastHopLimit(ttl)
+	}
+	return ipv4.NewPacketConn(pc).SetMulticastTTL(ttl)
+}
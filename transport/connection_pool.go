@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ghettovoice/gosip/log"
@@ -50,9 +51,20 @@ type ConnectionHandler interface {
 	Serve()
 }
 
+// Number of stream connections closed because of lost framing.
+var streamResyncs uint64
+
+// StreamResyncCount returns number of stream connections closed to resynchronize
+// after the malformed message in the strict Content-Length mode, see WithStrictContentLength.
+func StreamResyncCount() uint64 {
+	return atomic.LoadUint64(&streamResyncs)
+}
+
 type connectionPool struct {
 	store     map[ConnectionKey]ConnectionHandler
 	msgMapper sip.MessageMapper
+	// options of the stream parsers
+	parserOptions []parser.ParserOption
 
 	output chan<- sip.Message
 	errs   chan<- error
@@ -75,6 +87,7 @@ func NewConnectionPool(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) ConnectionPool {
 	pool := &connectionPool{
 		store:     make(map[ConnectionKey]ConnectionHandler),
@@ -90,6 +103,10 @@ func NewConnectionPool(
 		srvhDone: make(chan struct{}),
 	}
 
+	if optsHash := applyProtocolOptions(options...); optsHash.StrictContentLength {
+		pool.parserOptions = append(pool.parserOptions, parser.WithStrictContentLength(optsHash.MaxContentLength))
+	}
+
 	pool.log = logger.
 		WithPrefix("transport.ConnectionPool").
 		WithFields(log.Fields{
@@ -347,6 +364,7 @@ func (pool *connectionPool) put(key ConnectionKey, conn Connection, ttl time.Dur
 		pool.herrs,
 		pool.msgMapper,
 		pool.Log(),
+		pool.parserOptions...,
 	)
 
 	logger := log.AddFieldsFrom(pool.Log(), handler)
@@ -406,8 +424,9 @@ func (pool *connectionPool) getConnection(key ConnectionKey) (Connection, error)
 
 // connectionHandler actually serves associated connection
 type connectionHandler struct {
-	connection Connection
-	msgMapper  sip.MessageMapper
+	connection    Connection
+	msgMapper     sip.MessageMapper
+	parserOptions []parser.ParserOption
 
 	timer  timing.Timer
 	ttl    time.Duration
@@ -429,10 +448,12 @@ func NewConnectionHandler(
 	errs chan<- error,
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	parserOptions ...parser.ParserOption,
 ) ConnectionHandler {
 	handler := &connectionHandler{
-		connection: conn,
-		msgMapper:  msgMapper,
+		connection:    conn,
+		msgMapper:     msgMapper,
+		parserOptions: parserOptions,
 
 		output:   output,
 		errs:     errs,
@@ -538,8 +559,19 @@ func (handler *connectionHandler) Serve() {
 func (handler *connectionHandler) readStream() {
 	msgs := make(chan sip.Message)
 	errs := make(chan error)
-	strPrs := parser.NewParser(msgs, errs, true, handler.Log())
+	keepAlives := make(chan struct{}, 1)
 	raddr := handler.Connection().RemoteAddr().String()
+	options := append(
+		append([]parser.ParserOption{}, handler.parserOptions...),
+		parser.WithKeepAliveHandler(func(ka parser.KeepAlive) {
+			handler.handleKeepAlive(ka, raddr)
+			select {
+			case keepAlives <- struct{}{}:
+			default:
+			}
+		}),
+	)
+	strPrs := parser.NewParser(msgs, errs, true, handler.Log(), options...)
 	go func() {
 		defer func() {
 			_ = handler.Connection().Close()
@@ -567,13 +599,25 @@ func (handler *connectionHandler) readStream() {
 
 				return
 			}
-			data := buf[:num]
-			if _, err := strPrs.Write(data); err != nil {
+			// CRLF keep-alives are recognized by the parser
+			if _, err := strPrs.Write(buf[:num]); err != nil {
 				handler.handleError(err, raddr)
 			}
 		}
 	}()
-	handler.pipeOutputs(raddr, msgs, errs)
+	handler.pipeOutputs(raddr, msgs, errs, keepAlives)
+}
+
+// Responds with pong on the double CRLF ping - RFC 5626 3.5.1.
+func (handler *connectionHandler) handleKeepAlive(ka parser.KeepAlive, raddr string) {
+	handler.Log().Tracef("keep-alive %s received from %s", ka, raddr)
+	if ka != parser.KeepAlivePing {
+		return
+	}
+
+	if _, err := handler.Connection().Write(keepAlivePong); err != nil {
+		handler.handleError(err, raddr)
+	}
 }
 
 func (handler *connectionHandler) readPacket() {
@@ -613,7 +657,7 @@ func (handler *connectionHandler) readConnection() {
 	}
 }
 
-func (handler *connectionHandler) pipeOutputs(raddr string, msgs <-chan sip.Message, errs <-chan error) {
+func (handler *connectionHandler) pipeOutputs(raddr string, msgs <-chan sip.Message, errs <-chan error, keepAlives <-chan struct{}) {
 	handler.Log().Debug("begin pipe outputs")
 	defer handler.Log().Debug("stop pipe outputs")
 
@@ -633,17 +677,35 @@ func (handler *connectionHandler) pipeOutputs(raddr string, msgs <-chan sip.Mess
 				return
 			}
 			handler.handleMessage(msg, raddr)
+		case <-keepAlives:
+			// keep-alive shows that the flow is still in use
+			handler.resetExpiry()
 		case err, ok := <-errs:
 			if !ok {
 				return
 			}
+			var ferr parser.FramingError
+			if errors.As(err, &ferr) {
+				handler.resync(err)
+			}
 			handler.handleError(err, raddr)
 		}
 	}
 }
 
+// Closes the stream connection that lost message framing, the pool drops it on the read error.
+func (handler *connectionHandler) resync(err error) {
+	count := atomic.AddUint64(&streamResyncs, 1)
+	handler.Log().WithFields(log.Fields{
+		"stream_resyncs": count,
+	}).Warnf("close connection to resynchronize the stream: %s", err)
+
+	_ = handler.Connection().Close()
+}
+
 func (handler *connectionHandler) handleMessage(msg sip.Message, raddr string) {
 	msg.SetDestination(handler.Connection().LocalAddr().String())
+	setRemoteAddr(msg, raddr)
 	rhost, rport, _ := net.SplitHostPort(raddr)
 
 	switch msg := msg.(type) {
@@ -656,7 +718,8 @@ func (handler *connectionHandler) handleMessage(msg sip.Message, raddr string) {
 			return
 		}
 
-		if rhost != "" && rhost != viaHop.Host {
+		// RFC 3581 4 - 'received' must be added with 'rport' even if sent-by host is the source address
+		if rhost != "" && (rhost != viaHop.Host || viaHop.Params.Has("rport")) {
 			viaHop.Params.Add("received", sip.String{Str: rhost})
 		}
 
@@ -685,6 +748,17 @@ func (handler *connectionHandler) handleMessage(msg sip.Message, raddr string) {
 		msg.SetSource(raddr)
 	}
 
+	if conn, ok := handler.Connection().(*connection); ok {
+		// the connection is accepted behind the load balancer
+		if hdr := proxyHeaderOf(conn.baseConn); hdr != nil {
+			setProxyHeader(msg, hdr)
+		}
+		if tlsConn := tlsConnOf(conn.baseConn); tlsConn != nil {
+			state := tlsConn.ConnectionState()
+			setTLSState(msg, &state)
+		}
+	}
+
 	msg = handler.msgMapper(msg.WithFields(log.Fields{
 		"connection_key": handler.Connection().Key(),
 		"received_at":    time.Now(),
@@ -697,6 +771,10 @@ func (handler *connectionHandler) handleMessage(msg sip.Message, raddr string) {
 	case handler.output <- msg:
 	}
 
+	handler.resetExpiry()
+}
+
+func (handler *connectionHandler) resetExpiry() {
 	if !handler.Expiry().IsZero() {
 		handler.expiry = time.Now().Add(handler.ttl)
 		handler.timer.Reset(handler.ttl)
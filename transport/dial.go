@@ -0,0 +1,151 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"time"
+)
+
+// Resolves host and port of the address honoring the context,
+// IPv4 addresses are preferred unless the network is limited to IPv6 as net.ResolveTCPAddr does.
+func lookupAddr(ctx context.Context, network, addr string) (net.IP, int, string, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	port, err := net.DefaultResolver.LookupPort(ctx, network, portStr)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if host == "" {
+		return nil, port, "", nil
+	}
+
+	zone := ""
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		host, zone = host[:i], host[i+1:]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, port, zone, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	var found *net.IPAddr
+	for i := range addrs {
+		ip4 := addrs[i].IP.To4() != nil
+		switch {
+		case strings.HasSuffix(network, "4") && !ip4,
+			strings.HasSuffix(network, "6") && ip4:
+			continue
+		case found == nil:
+			found = &addrs[i]
+		case ip4 && found.IP.To4() == nil:
+			found = &addrs[i]
+		}
+	}
+	if found == nil {
+		return nil, 0, "", &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	return found.IP, port, found.Zone, nil
+}
+
+func resolveTCPAddr(ctx context.Context, network, addr string) (*net.TCPAddr, error) {
+	ip, port, zone, err := lookupAddr(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &net.TCPAddr{IP: ip, Port: port, Zone: zone}, nil
+}
+
+func resolveUDPAddr(ctx context.Context, network, addr string) (*net.UDPAddr, error) {
+	ip, port, zone, err := lookupAddr(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &net.UDPAddr{IP: ip, Port: port, Zone: zone}, nil
+}
+
+// Dials TLS connection, both connect and handshake are interrupted when the context is done.
+func dialTLS(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
+	var dialer net.Dialer
+	rawConn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// the same as tls.Dial does
+	if config.ServerName == "" {
+		config = config.Clone()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+
+	conn := tls.Client(rawConn, config)
+	if err := handshakeContext(ctx, conn); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func handshakeContext(ctx context.Context, conn *tls.Conn) error {
+	if ctx.Done() == nil {
+		return conn.Handshake()
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- conn.Handshake()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		// unblock the handshake
+		conn.SetDeadline(time.Now())
+		<-errs
+		return ctx.Err()
+	}
+}
+
+// Writes data to the connection, pending write is interrupted when the context is done.
+// Interrupted write may leave a partial message, so stream connection should be dropped after that.
+func writeContext(ctx context.Context, conn net.Conn, data []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if ctx.Done() == nil {
+		return conn.Write(data)
+	}
+
+	type result struct {
+		num int
+		err error
+	}
+	results := make(chan result, 1)
+	go func() {
+		num, err := conn.Write(data)
+		results <- result{num, err}
+	}()
+
+	select {
+	case res := <-results:
+		return res.num, res.err
+	case <-ctx.Done():
+		conn.SetWriteDeadline(time.Now())
+		res := <-results
+		conn.SetWriteDeadline(time.Time{})
+		if res.err == nil {
+			// managed to complete before the deadline took effect
+			return res.num, nil
+		}
+		return res.num, ctx.Err()
+	}
+}
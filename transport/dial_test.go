@@ -0,0 +1,115 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("Send with context", func() {
+	var (
+		output   chan sip.Message
+		errs     chan error
+		cancel   chan struct{}
+		listener net.Listener
+		msg      sip.Message
+	)
+
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		output = make(chan sip.Message)
+		errs = make(chan error)
+		cancel = make(chan struct{})
+
+		var err error
+		// accepts connections but never answers
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		msg = testutils.Request([]string{
+			"OPTIONS sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/TLS 127.0.0.1;branch=" + sip.GenerateBranch(),
+			"From: <sip:alice@example.com>;tag=1928301774",
+			"To: <sip:bob@example.com>",
+			"Call-ID: a84b4c76e66710",
+			"CSeq: 1 OPTIONS",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+	})
+	AfterEach(func() {
+		listener.Close()
+		close(cancel)
+	})
+
+	target := func() *transport.Target {
+		return transport.NewTarget("127.0.0.1", listener.Addr().(*net.TCPAddr).Port)
+	}
+
+	It("should not dial with canceled context", func() {
+		protocol := transport.NewTcpProtocol(output, errs, cancel, nil, logger)
+		ctx, stop := context.WithCancel(context.Background())
+		stop()
+
+		err := protocol.SendContext(ctx, target(), msg)
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		var ctxErr *transport.ContextError
+		Expect(errors.As(err, &ctxErr)).To(BeTrue())
+		Expect(ctxErr.Canceled()).To(BeTrue())
+		Expect(err.(transport.Error).Network()).To(BeFalse())
+	})
+
+	It("should interrupt handshake of secure connection on deadline", func() {
+		protocol := transport.NewTlsProtocol(output, errs, cancel, nil, logger)
+		ctx, stop := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer stop()
+
+		start := time.Now()
+		err := protocol.SendContext(ctx, target(), msg)
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		var ctxErr *transport.ContextError
+		Expect(errors.As(err, &ctxErr)).To(BeTrue())
+		Expect(ctxErr.Expired()).To(BeTrue())
+		Expect(err.(transport.Error).Network()).To(BeFalse())
+	})
+
+	It("should report refused connection as unreachable transport", func() {
+		protocol := transport.NewTcpProtocol(output, errs, cancel, nil, logger)
+		closed := target()
+		listener.Close()
+
+		err := protocol.SendContext(context.Background(), closed, msg)
+		Expect(errors.Is(err, transport.ErrTransportUnreachable)).To(BeTrue())
+		Expect(err.(transport.Error).Network()).To(BeTrue())
+	})
+
+	It("should not report interrupted dial as unreachable transport", func() {
+		protocol := transport.NewTcpProtocol(output, errs, cancel, nil, logger)
+		ctx, stop := context.WithCancel(context.Background())
+		stop()
+
+		err := protocol.SendContext(ctx, target(), msg)
+		Expect(errors.Is(err, transport.ErrTransportUnreachable)).To(BeFalse())
+	})
+})
@@ -0,0 +1,302 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultDNSCacheTTL is the cache time of DNS records with unknown TTL, e.g. resolved with net.Resolver.
+const DefaultDNSCacheTTL = time.Minute
+
+const (
+	dnsTypeNAPTR   dnsmessage.Type = 35
+	dnsTimeout                     = 5 * time.Second
+	dnsDefaultAddr                 = "127.0.0.1:53"
+)
+
+// NAPTR is a naming authority pointer DNS record - RFC 3403.
+type NAPTR struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+func (rr *NAPTR) String() string {
+	return fmt.Sprintf("%d %d \"%s\" \"%s\" \"%s\" %s", rr.Order, rr.Preference, rr.Flags, rr.Service, rr.Regexp, rr.Replacement)
+}
+
+// DNSLookup performs DNS queries of the Resolver.
+// Each lookup returns TTL the records may be cached for.
+type DNSLookup interface {
+	LookupNAPTR(ctx context.Context, name string) ([]*NAPTR, time.Duration, error)
+	LookupSRV(ctx context.Context, service, proto, name string) ([]*net.SRV, time.Duration, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error)
+}
+
+// NewDNSLookup creates DNSLookup that resolves SRV and A/AAAA records with the resolver
+// and queries NAPTR records from the DNS server with the address.
+// If the address is empty, the first nameserver of /etc/resolv.conf is used.
+func NewDNSLookup(resolver *net.Resolver, server string) DNSLookup {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &dnsLookup{
+		resolver: resolver,
+		server:   server,
+	}
+}
+
+type dnsLookup struct {
+	resolver *net.Resolver
+	server   string
+}
+
+func (l *dnsLookup) LookupSRV(ctx context.Context, service, proto, name string) ([]*net.SRV, time.Duration, error) {
+	_, addrs, err := l.resolver.LookupSRV(ctx, service, proto, name)
+	return addrs, DefaultDNSCacheTTL, err
+}
+
+func (l *dnsLookup) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	addrs, err := l.resolver.LookupIPAddr(ctx, host)
+	return addrs, DefaultDNSCacheTTL, err
+}
+
+func (l *dnsLookup) LookupNAPTR(ctx context.Context, name string) ([]*NAPTR, time.Duration, error) {
+	qname, err := dnsmessage.NewName(dnsFQDN(name))
+	if err != nil {
+		return nil, 0, fmt.Errorf("build NAPTR query of %s: %w", name, err)
+	}
+
+	id := uint16(rand.Uint32())
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := builder.Question(dnsmessage.Question{
+		Name:  qname,
+		Type:  dnsTypeNAPTR,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return nil, 0, err
+	}
+	query, err := builder.Finish()
+	if err != nil {
+		return nil, 0, fmt.Errorf("build NAPTR query of %s: %w", name, err)
+	}
+
+	server := l.server
+	if server == "" {
+		server = resolvConfNameserver()
+	}
+
+	var conn net.Conn
+	if l.resolver.Dial != nil {
+		conn, err = l.resolver.Dial(ctx, "udp", server)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "udp", server)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("dial DNS server %s: %w", server, err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dnsTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, 0, err
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, 0, fmt.Errorf("send NAPTR query of %s: %w", name, err)
+	}
+	buf := make([]byte, 65535)
+	for {
+		num, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, fmt.Errorf("read NAPTR response of %s: %w", name, err)
+		}
+		// skip stray responses of previous queries
+		if num >= 2 && binary.BigEndian.Uint16(buf) != id {
+			continue
+		}
+
+		return parseNAPTRResponse(buf[:num])
+	}
+}
+
+// Parses NAPTR records of the DNS response, records of other types are skipped.
+// Name error response gives empty result - RFC 1035 4.1.1.
+func parseNAPTRResponse(msg []byte) ([]*NAPTR, time.Duration, error) {
+	if len(msg) < 12 {
+		return nil, 0, errors.New("DNS response is too short")
+	}
+	switch rcode := msg[3] & 0x0f; rcode {
+	case 0:
+	case 3:
+		return nil, DefaultDNSCacheTTL, nil
+	default:
+		return nil, 0, fmt.Errorf("DNS response code %d", rcode)
+	}
+
+	qdCount := int(binary.BigEndian.Uint16(msg[4:]))
+	anCount := int(binary.BigEndian.Uint16(msg[6:]))
+	off := 12
+	for i := 0; i < qdCount; i++ {
+		var err error
+		if _, off, err = readDNSName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		off += 4
+	}
+
+	var (
+		records []*NAPTR
+		ttl     time.Duration = -1
+	)
+	for i := 0; i < anCount; i++ {
+		var err error
+		if _, off, err = readDNSName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		if off+10 > len(msg) {
+			return nil, 0, errors.New("DNS resource record is truncated")
+		}
+		typ := dnsmessage.Type(binary.BigEndian.Uint16(msg[off:]))
+		rrTTL := time.Duration(binary.BigEndian.Uint32(msg[off+4:])) * time.Second
+		rdLen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdLen > len(msg) {
+			return nil, 0, errors.New("DNS resource record is truncated")
+		}
+		end := off + rdLen
+		if typ != dnsTypeNAPTR {
+			off = end
+			continue
+		}
+
+		rr, err := readNAPTR(msg, off, end)
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, rr)
+		if ttl < 0 || rrTTL < ttl {
+			ttl = rrTTL
+		}
+		off = end
+	}
+	if ttl < 0 {
+		ttl = DefaultDNSCacheTTL
+	}
+
+	return records, ttl, nil
+}
+
+func readNAPTR(msg []byte, off, end int) (*NAPTR, error) {
+	if off+4 > end {
+		return nil, errors.New("NAPTR record is truncated")
+	}
+	rr := &NAPTR{
+		Order:      binary.BigEndian.Uint16(msg[off:]),
+		Preference: binary.BigEndian.Uint16(msg[off+2:]),
+	}
+	off += 4
+
+	strs := make([]string, 3)
+	for i := range strs {
+		if off >= end || off+1+int(msg[off]) > end {
+			return nil, errors.New("NAPTR record is truncated")
+		}
+		strs[i] = string(msg[off+1 : off+1+int(msg[off])])
+		off += 1 + int(msg[off])
+	}
+	rr.Flags, rr.Service, rr.Regexp = strs[0], strs[1], strs[2]
+
+	replacement, _, err := readDNSName(msg, off)
+	if err != nil {
+		return nil, err
+	}
+	rr.Replacement = replacement
+
+	return rr, nil
+}
+
+// Reads possibly compressed domain name, returns offset after the name - RFC 1035 4.1.4.
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var (
+		labels []string
+		next   = -1
+	)
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("DNS name is truncated")
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			off++
+			if next < 0 {
+				next = off
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errors.New("DNS name is truncated")
+			}
+			if jumps++; jumps > 10 {
+				return "", 0, errors.New("too many DNS name compression pointers")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errors.New("DNS name is truncated")
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+func dnsFQDN(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// Returns address of the first nameserver of /etc/resolv.conf.
+func resolvConfNameserver() string {
+	file, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return dnsDefaultAddr
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+	return dnsDefaultAddr
+}
@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// BodyEncoding configures content coding of message bodies by the transport layer - RFC 3261 20.12.
+// Received bodies encoded with supported codings are decoded before the message is passed up,
+// so upper layers see plain bodies with 'Content-Length' of the decoded body.
+// Bodies with unsupported codings are passed up as is to be rejected with '415 Unsupported Media Type'.
+type BodyEncoding struct {
+	// Coding is used to compress bodies of outgoing messages, 'gzip' or 'deflate'.
+	// Empty coding disables compression.
+	// Requests are compressed unconditionally, the peer not supporting the coding answers with 415.
+	// Responses are compressed only if the coding is listed in 'Accept-Encoding' of the request,
+	// i.e. responses must be built with sip.NewResponseFromRequest.
+	Coding string
+	// MinSize is the minimal size of the body to compress.
+	MinSize int
+	// AcceptEncoding adds 'Accept-Encoding' with supported codings to outgoing requests without it.
+	AcceptEncoding bool
+}
+
+// Codings accepted by the peer that sent the request, copied to responses in metadata.
+type acceptedCodingsKey struct{}
+
+type bodyEncoder struct {
+	mu       sync.RWMutex
+	encoding *BodyEncoding
+}
+
+func (enc *bodyEncoder) set(encoding *BodyEncoding) error {
+	if encoding != nil && encoding.Coding != "" && !sip.ContentCodingSupported(encoding.Coding) {
+		return &sip.UnsupportedContentCodingError{Coding: encoding.Coding}
+	}
+
+	enc.mu.Lock()
+	enc.encoding = encoding
+	enc.mu.Unlock()
+	return nil
+}
+
+func (enc *bodyEncoder) get() *BodyEncoding {
+	enc.mu.RLock()
+	defer enc.mu.RUnlock()
+	return enc.encoding
+}
+
+// Decodes the body of the received message and remembers codings accepted by the peer.
+func (enc *bodyEncoder) decode(msg sip.Message) error {
+	if enc.get() == nil {
+		return nil
+	}
+
+	if req, ok := msg.(sip.Request); ok {
+		if codings, ok := sip.AcceptedCodings(req); ok {
+			sip.MessageMetadata(req).SetValue(acceptedCodingsKey{}, codings)
+		}
+	}
+
+	err := sip.DecodeBody(msg)
+	var codingErr *sip.UnsupportedContentCodingError
+	if errors.As(err, &codingErr) {
+		return nil
+	}
+	return err
+}
+
+// Adds 'Accept-Encoding' to the outgoing request.
+func (enc *bodyEncoder) accept(msg sip.Message) {
+	encoding := enc.get()
+	if encoding == nil || !encoding.AcceptEncoding {
+		return
+	}
+	req, ok := msg.(sip.Request)
+	if !ok || req.IsAck() || req.IsCancel() || len(req.GetHeaders("Accept-Encoding")) > 0 {
+		return
+	}
+
+	codings := []string{"gzip", "deflate"}
+	// the coding in use goes first
+	if encoding.Coding != "" && !sip.TokenEqual(encoding.Coding, "gzip") {
+		codings[0], codings[1] = codings[1], codings[0]
+	}
+	req.AppendHeader(&sip.GenericHeader{
+		HeaderName: "Accept-Encoding",
+		Contents:   strings.Join(codings, ", "),
+	})
+}
+
+// Returns the message to render with the compressed body.
+// The body is compressed on the copy, so the message kept by upper layers for retransmissions is intact.
+func (enc *bodyEncoder) encode(msg sip.Message) (sip.Message, error) {
+	encoding := enc.get()
+	if encoding == nil || encoding.Coding == "" || sip.TokenEqual(encoding.Coding, "identity") ||
+		len(msg.Body()) == 0 || len(msg.Body()) < encoding.MinSize || len(sip.ContentCodings(msg)) > 0 {
+		return msg, nil
+	}
+	if _, ok := msg.(sip.Response); ok {
+		codings, _ := sip.MessageMetadata(msg).Value(acceptedCodingsKey{}).([]string)
+		if !sip.HasToken(codings, encoding.Coding) {
+			return msg, nil
+		}
+	}
+
+	out := msg.Clone()
+	if err := sip.EncodeBody(out, encoding.Coding); err != nil {
+		return nil, fmt.Errorf("encode body of %s: %w", msg.Short(), err)
+	}
+	return out, nil
+}
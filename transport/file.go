@@ -0,0 +1,165 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// ListenFile makes protocol listen on the already opened socket instead of binding a new one,
+// e.g. socket passed by systemd socket activation or by the parent process on graceful upgrade.
+// The listen address is taken from the socket. The file is duplicated, so the caller may close it.
+type ListenFile struct {
+	File *os.File
+}
+
+func (o ListenFile) ApplyListen(opts *ListenOptions) {
+	opts.File = o.File
+}
+
+// FileLayer is implemented by the transport layer created with NewLayer.
+type FileLayer interface {
+	// Files returns duplicates of the listening sockets,
+	// they can be passed to the new process to continue listening without dropping the ports.
+	Files() ([]*os.File, error)
+}
+
+// First file descriptor passed by systemd - sd_listen_fds(3).
+const systemdFirstFD = 3
+
+// SystemdFiles returns sockets passed by systemd socket activation.
+// Files are named by LISTEN_FDNAMES if present. Returns empty list if the process is not socket activated.
+// Activation environment variables are unset, so they aren't inherited by the child processes.
+func SystemdFiles() ([]*os.File, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	num, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("parse LISTEN_FDS: %w", err)
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	files := make([]*os.File, 0, num)
+	for i := 0; i < num; i++ {
+		fd := systemdFirstFD + i
+		name := fmt.Sprintf("LISTEN_FD_%d", fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files = append(files, os.NewFile(uintptr(fd), name))
+	}
+
+	return files, nil
+}
+
+// fileListenAddr returns local address of the socket.
+func fileListenAddr(network string, file *os.File) (string, error) {
+	if sip.TokenEqual(network, "udp") {
+		conn, err := net.FilePacketConn(file)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.LocalAddr().String(), nil
+	}
+
+	ls, err := net.FileListener(file)
+	if err != nil {
+		return "", err
+	}
+	defer ls.Close()
+	return ls.Addr().String(), nil
+}
+
+// listenerFile returns duplicate of the socket behind the listener wrappers.
+func listenerFile(ls net.Listener) (*os.File, error) {
+	for {
+		switch l := ls.(type) {
+		case interface{ File() (*os.File, error) }:
+			return l.File()
+		case *tcpListener:
+			ls = l.Listener
+		case *wsListener:
+			ls = l.Listener
+		case *tlsListener:
+			ls = l.Listener
+		case *asyncListener:
+			ls = l.Listener
+		default:
+			return nil, fmt.Errorf("listener %T doesn't support file export", ls)
+		}
+	}
+}
+
+func (tpl *layer) Files() ([]*os.File, error) {
+	files := make([]*os.File, 0)
+	for _, protocol := range tpl.protocols.all() {
+		p, ok := protocol.(interface{ files() ([]*os.File, error) })
+		if !ok {
+			continue
+		}
+
+		fs, err := p.files()
+		if err != nil {
+			for _, f := range append(files, fs...) {
+				f.Close()
+			}
+			return nil, fmt.Errorf("export %s sockets: %w", protocol.Network(), err)
+		}
+		files = append(files, fs...)
+	}
+	return files, nil
+}
+
+func (p *udpProtocol) files() ([]*os.File, error) {
+	files := make([]*os.File, 0)
+	for _, conn := range p.connections.All() {
+		c, ok := conn.(*connection)
+		if !ok {
+			continue
+		}
+		fc, ok := c.baseConn.(interface{ File() (*os.File, error) })
+		if !ok {
+			return files, fmt.Errorf("connection %T doesn't support file export", c.baseConn)
+		}
+		f, err := fc.File()
+		if err != nil {
+			return files, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func (p *tcpProtocol) files() ([]*os.File, error) {
+	return listenerFiles(p.listeners)
+}
+
+func (p *wsProtocol) files() ([]*os.File, error) {
+	return listenerFiles(p.listeners)
+}
+
+func listenerFiles(pool ListenerPool) ([]*os.File, error) {
+	files := make([]*os.File, 0)
+	for _, ls := range pool.All() {
+		f, err := listenerFile(ls)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
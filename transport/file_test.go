@@ -0,0 +1,108 @@
+package transport_test
+
+import (
+	"net"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("ListenFile", func() {
+	var tpl transport.Layer
+
+	logger := testutils.NewLogrusLogger()
+	msg := "OPTIONS sip:bob@far-far-away.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP pc33.far-far-away.com;branch=z9hG4bK776asdhds\r\n" +
+		"To: \"Bob\" <sip:bob@far-far-away.com>\r\n" +
+		"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774\r\n" +
+		"Call-ID: a84b4c76e66710\r\n" +
+		"CSeq: 1 OPTIONS\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+
+	BeforeEach(func() {
+		tpl = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger)
+	})
+	AfterEach(func(done Done) {
+		tpl.Cancel()
+		<-tpl.Done()
+		close(done)
+	}, 3)
+
+	It("should listen on inherited TCP socket", func() {
+		ls, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9075})
+		Expect(err).ToNot(HaveOccurred())
+		file, err := ls.File()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ls.Close()).To(Succeed())
+
+		Expect(tpl.Listen("tcp", "", transport.ListenFile{File: file})).To(Succeed())
+		Expect(file.Close()).To(Succeed())
+
+		conn, err := net.Dial("tcp", "127.0.0.1:9075")
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		testutils.WriteToConn(conn, []byte(msg))
+
+		var in sip.Message
+		Eventually(tpl.Messages(), 3*time.Second).Should(Receive(&in))
+		Expect(in.Destination()).To(Equal("127.0.0.1:9075"))
+	})
+
+	It("should listen on inherited UDP socket", func() {
+		pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9076})
+		Expect(err).ToNot(HaveOccurred())
+		file, err := pc.File()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pc.Close()).To(Succeed())
+
+		Expect(tpl.Listen("udp", "", transport.ListenFile{File: file})).To(Succeed())
+		Expect(file.Close()).To(Succeed())
+
+		conn, err := net.Dial("udp", "127.0.0.1:9076")
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		testutils.WriteToConn(conn, []byte(msg))
+
+		var in sip.Message
+		Eventually(tpl.Messages(), 3*time.Second).Should(Receive(&in))
+		Expect(in.Destination()).To(Equal("127.0.0.1:9076"))
+	})
+
+	It("should export listening sockets", func() {
+		Expect(tpl.Listen("udp", "127.0.0.1:9077")).To(Succeed())
+		Expect(tpl.Listen("tcp", "127.0.0.1:9077")).To(Succeed())
+
+		fl, ok := tpl.(transport.FileLayer)
+		Expect(ok).To(BeTrue())
+		files, err := fl.Files()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(2))
+
+		addrs := make([]string, 0)
+		for _, file := range files {
+			if ls, err := net.FileListener(file); err == nil {
+				addrs = append(addrs, "tcp:"+ls.Addr().String())
+				ls.Close()
+			} else if pc, err := net.FilePacketConn(file); err == nil {
+				addrs = append(addrs, "udp:"+pc.LocalAddr().String())
+				pc.Close()
+			}
+			file.Close()
+		}
+		Expect(addrs).To(ConsistOf("tcp:127.0.0.1:9077", "udp:127.0.0.1:9077"))
+	})
+
+	It("should return empty list of systemd sockets when not activated", func() {
+		Expect(os.Unsetenv("LISTEN_PID")).To(Succeed())
+		files, err := transport.SystemdFiles()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+})
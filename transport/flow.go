@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Flow is the connection between the UA and the edge proxy the SIP Outbound registration is bound to - RFC 5626 3.
+type Flow struct {
+	Network    string
+	LocalAddr  string
+	RemoteAddr string
+}
+
+// FlowOf returns the flow the message was received on.
+func FlowOf(msg sip.Message) Flow {
+	raddr, ok := GetRemoteAddr(msg)
+	if !ok {
+		raddr = msg.Source()
+	}
+	return Flow{
+		Network:    sip.TokenLower(msg.Transport()),
+		LocalAddr:  msg.Destination(),
+		RemoteAddr: raddr,
+	}
+}
+
+// Bind directs the outgoing message to the flow, so it reuses the connection
+// of the flow instead of opening a new one, e.g. in-dialog requests of the outbound UA
+// or requests forwarded by the edge proxy to the UA.
+func (flow Flow) Bind(msg sip.Message) {
+	msg.SetTransport(sip.TokenUpper(flow.Network))
+	msg.SetSource(flow.LocalAddr)
+	msg.SetDestination(flow.RemoteAddr)
+}
+
+// ErrInvalidFlowToken is returned on decoding of the malformed or forged flow token.
+var ErrInvalidFlowToken = errors.New("invalid flow token")
+
+const flowTokenMacLength = 10
+
+// FlowTokens encodes flows into tokens the edge proxy puts in the user part of the Path
+// and Record-Route URIs, tokens are signed to detect tampering - RFC 5626 5.2.
+type FlowTokens struct {
+	key []byte
+}
+
+// NewFlowTokens creates flow tokens signed with the key, random key is generated if it is empty.
+// Edge proxies of the cluster must share the key to decode tokens of each other.
+func NewFlowTokens(key []byte) *FlowTokens {
+	if len(key) == 0 {
+		key = make([]byte, 20)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+	}
+	return &FlowTokens{key: key}
+}
+
+// Encode returns the token of the flow.
+func (ft *FlowTokens) Encode(flow Flow) string {
+	data := []byte(strings.Join([]string{flow.Network, flow.LocalAddr, flow.RemoteAddr}, "\x00"))
+	return base64.RawURLEncoding.EncodeToString(append(ft.sign(data), data...))
+}
+
+// Decode returns the flow of the token.
+func (ft *FlowTokens) Decode(token string) (Flow, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) <= flowTokenMacLength {
+		return Flow{}, ErrInvalidFlowToken
+	}
+	mac, data := raw[:flowTokenMacLength], raw[flowTokenMacLength:]
+	if !hmac.Equal(mac, ft.sign(data)) {
+		return Flow{}, ErrInvalidFlowToken
+	}
+	parts := strings.Split(string(data), "\x00")
+	if len(parts) != 3 {
+		return Flow{}, ErrInvalidFlowToken
+	}
+	return Flow{Network: parts[0], LocalAddr: parts[1], RemoteAddr: parts[2]}, nil
+}
+
+func (ft *FlowTokens) sign(data []byte) []byte {
+	h := hmac.New(sha1.New, ft.key)
+	h.Write(data)
+	return h.Sum(nil)[:flowTokenMacLength]
+}
+
+// AddPath adds the 'Path' header with the flow token of the REGISTER received from the outbound UA,
+// so the registrar routes requests to the UA through the edge proxy and the flow - RFC 5626 5.1.
+func (ft *FlowTokens) AddPath(req sip.Request, edge *sip.SipUri) {
+	uri := ft.flowUri(req, edge)
+	req.PrependHeader(&sip.GenericHeader{
+		HeaderName: "Path",
+		Contents:   "<" + uri.String() + ">",
+	})
+}
+
+// RecordRoute adds the 'Record-Route' header with the flow token of the dialog-forming request
+// received from the outbound UA, so in-dialog requests to the UA go through the flow - RFC 5626 5.3.
+func (ft *FlowTokens) RecordRoute(req sip.Request, edge *sip.SipUri) {
+	uri := ft.flowUri(req, edge)
+	req.PrependHeader(&sip.RecordRouteHeader{Addresses: []sip.Uri{uri}})
+}
+
+func (ft *FlowTokens) flowUri(req sip.Request, edge *sip.SipUri) *sip.SipUri {
+	uri := edge.Clone().(*sip.SipUri)
+	uri.WithUser(ft.Encode(FlowOf(req))).WithLR().SetParam("ob", nil)
+	return uri
+}
+
+// RouteFlow returns the flow of the token in the top 'Route' URI of the request routed to the edge proxy.
+// The request comes from the UA if the flow is the flow of the request itself,
+// otherwise the edge proxy must forward it over the flow (see Flow.Bind),
+// responding '430 Flow Failed' if the flow is broken and '403 Forbidden' on the invalid token - RFC 5626 5.3.
+func (ft *FlowTokens) RouteFlow(req sip.Request) (Flow, error) {
+	routes := sip.Routes(req)
+	if len(routes) == 0 || routes[0].User() == nil {
+		return Flow{}, ErrInvalidFlowToken
+	}
+	return ft.Decode(routes[0].User().String())
+}
@@ -0,0 +1,126 @@
+package transport_test
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("Flow", func() {
+	logger := testutils.NewLogrusLogger()
+	edge := &sip.SipUri{FHost: "edge.example.com"}
+	register := "REGISTER sip:example.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/TCP 192.0.2.1;branch=z9hG4bK776asdhds;rport\r\n" +
+		"To: <sip:alice@example.com>\r\n" +
+		"From: <sip:alice@example.com>;tag=1928301774\r\n" +
+		"Call-ID: outbound-register\r\n" +
+		"CSeq: 1 REGISTER\r\n" +
+		"Supported: path, outbound\r\n" +
+		"Contact: <sip:alice@192.0.2.1;transport=tcp>;+sip.instance=\"<urn:uuid:1>\";reg-id=1\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+
+	Context("flow tokens", func() {
+		tokens := transport.NewFlowTokens([]byte("secret"))
+		flow := transport.Flow{Network: "tcp", LocalAddr: "127.0.0.1:5060", RemoteAddr: "192.0.2.1:49152"}
+
+		It("should decode encoded flow", func() {
+			Expect(tokens.Decode(tokens.Encode(flow))).To(Equal(flow))
+		})
+
+		It("should reject forged token", func() {
+			token := transport.NewFlowTokens([]byte("other")).Encode(flow)
+			_, err := tokens.Decode(token)
+			Expect(err).To(MatchError(transport.ErrInvalidFlowToken))
+			_, err = tokens.Decode("bm90LWEtdG9rZW4")
+			Expect(err).To(MatchError(transport.ErrInvalidFlowToken))
+		})
+
+		It("should add Path and Record-Route with the flow token", func() {
+			msg, err := parser.ParseMessage([]byte(register), logger)
+			Expect(err).ToNot(HaveOccurred())
+			req := msg.(sip.Request)
+			req.SetTransport("TCP")
+			req.SetSource(flow.RemoteAddr)
+			req.SetDestination(flow.LocalAddr)
+
+			tokens.AddPath(req, edge)
+			tokens.RecordRoute(req, edge)
+			path := req.GetHeaders("Path")
+			Expect(path).To(HaveLen(1))
+			Expect(path[0].Value()).To(HavePrefix("<sip:"))
+			Expect(path[0].Value()).To(ContainSubstring("@edge.example.com;lr;ob>"))
+
+			routes := sip.RecordRoutes(req)
+			Expect(routes).To(HaveLen(1))
+			Expect(sip.IsOutboundUri(routes[0])).To(BeTrue())
+
+			// in-dialog request routed back to the edge proxy
+			req.AppendHeader(&sip.RouteHeader{Addresses: routes})
+			Expect(tokens.RouteFlow(req)).To(Equal(flow))
+		})
+	})
+
+	Context("edge proxy", func() {
+		var (
+			tpl    transport.Layer
+			client net.Conn
+		)
+
+		BeforeEach(func() {
+			tpl = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger)
+			Expect(tpl.Listen("tcp", "127.0.0.1:5071")).To(Succeed())
+			time.Sleep(100 * time.Millisecond)
+			client = testutils.CreateClient("tcp", "127.0.0.1:5071", "")
+		})
+		AfterEach(func(done Done) {
+			client.Close()
+			tpl.Cancel()
+			<-tpl.Done()
+			close(done)
+		}, 3)
+
+		It("should send request to the UA over the flow of its registration", func(done Done) {
+			testutils.WriteToConn(client, []byte(register))
+
+			var msg sip.Message
+			Eventually(tpl.Messages(), 3).Should(Receive(&msg))
+			flow := transport.FlowOf(msg)
+			Expect(flow).To(Equal(transport.Flow{
+				Network:    "tcp",
+				LocalAddr:  "127.0.0.1:5071",
+				RemoteAddr: client.LocalAddr().String(),
+			}))
+
+			req := testutils.Request([]string{
+				"OPTIONS sip:alice@192.0.2.1;transport=tcp SIP/2.0",
+				"Via: SIP/2.0/TCP edge.example.com;branch=" + sip.GenerateBranch(),
+				"To: <sip:alice@example.com>",
+				"From: <sip:edge@example.com>;tag=1",
+				"Call-ID: outbound-options",
+				"CSeq: 1 OPTIONS",
+				"Content-Length: 0",
+				"",
+				"",
+			})
+			flow.Bind(req)
+			Expect(tpl.Send(req)).To(Succeed())
+
+			reader := bufio.NewReader(client)
+			Expect(client.SetReadDeadline(time.Now().Add(2 * time.Second))).To(Succeed())
+			line, err := reader.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(line)).To(Equal("OPTIONS sip:alice@192.0.2.1;transport=tcp SIP/2.0"))
+			close(done)
+		}, 5)
+	})
+})
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"sync"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// PreSendHook is called with the message prepared for sending, i.e. after the top Via sent-by
+// is rewritten and the target is resolved, right before the message is rendered.
+// The hook may mutate the message, returned error aborts sending.
+type PreSendHook func(msg sip.Message, network string, target *Target) error
+
+// PostSendHook is called after the message is sent with the exact bytes written to the network
+// and the destination, e.g. for byte-accurate logging or mirroring.
+// Data must not be modified by the hook.
+type PostSendHook func(data []byte, network string, target *Target)
+
+type sendHooks struct {
+	mu   sync.RWMutex
+	pre  []PreSendHook
+	post []PostSendHook
+}
+
+func (hooks *sendHooks) addPre(hook PreSendHook) {
+	hooks.mu.Lock()
+	hooks.pre = append(hooks.pre, hook)
+	hooks.mu.Unlock()
+}
+
+func (hooks *sendHooks) addPost(hook PostSendHook) {
+	hooks.mu.Lock()
+	hooks.post = append(hooks.post, hook)
+	hooks.mu.Unlock()
+}
+
+// Runs pre-send hooks in order of registration, the first error stops the chain.
+func (hooks *sendHooks) runPre(msg sip.Message, network string, target *Target) error {
+	hooks.mu.RLock()
+	pre := hooks.pre
+	hooks.mu.RUnlock()
+
+	for _, hook := range pre {
+		if err := hook(msg, network, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hooks *sendHooks) hasPost() bool {
+	hooks.mu.RLock()
+	defer hooks.mu.RUnlock()
+	return len(hooks.post) > 0
+}
+
+func (hooks *sendHooks) runPost(data []byte, network string, target *Target) {
+	hooks.mu.RLock()
+	post := hooks.post
+	hooks.mu.RUnlock()
+
+	for _, hook := range post {
+		hook(data, network, target)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ghettovoice/gosip/log"
@@ -28,6 +30,25 @@ type Layer interface {
 	Listen(network string, addr string, options ...ListenOption) error
 	// Send sends message on suitable protocol.
 	Send(msg sip.Message) error
+	// SendContext sends message on suitable protocol honoring the context cancellation and deadline,
+	// errors caused by the context are reported as ContextError.
+	SendContext(ctx context.Context, msg sip.Message) error
+	// OnPreSend registers hook called with the message prepared for sending, see PreSendHook.
+	OnPreSend(hook PreSendHook)
+	// OnPostSend registers hook called with the rendered message after sending, see PostSendHook.
+	OnPostSend(hook PostSendHook)
+	// SetBodyEncoding enables content coding of message bodies, nil disables it, see BodyEncoding.
+	SetBodyEncoding(encoding *BodyEncoding) error
+	// SetForceRport enables NAT handling of requests without 'rport': responses are sent
+	// to the source address of the request as if the client had asked for 'rport' - RFC 3581 4.
+	SetForceRport(enabled bool)
+	// SetPriorityScheduling enables passing up of inbound messages in the order of priority,
+	// so responses and ACK/BYE/CANCEL aren't starved behind a surge of new INVITE/REGISTER, see InboundPriority.
+	SetPriorityScheduling(enabled bool)
+	// SetResolver enables selection of the transport and the server of requests with NAPTR, SRV
+	// and A/AAAA records of the next hop URI - RFC 3263 4, nil disables it, see Resolver.
+	// Requests with explicitly set destination are sent as is.
+	SetResolver(resolver *Resolver)
 	String() string
 	IsReliable(network string) bool
 	IsStreamed(network string) bool
@@ -41,7 +62,7 @@ var protocolFactory ProtocolFactory = func(
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
 ) (Protocol, error) {
-	switch strings.ToLower(network) {
+	switch sip.TokenLower(network) {
 	case "udp":
 		return NewUdpProtocol(output, errs, cancel, msgMapper, logger), nil
 	case "tcp":
@@ -52,11 +73,51 @@ var protocolFactory ProtocolFactory = func(
 		return NewWsProtocol(output, errs, cancel, msgMapper, logger), nil
 	case "wss":
 		return NewWssProtocol(output, errs, cancel, msgMapper, logger), nil
+	case "unix":
+		return NewUnixProtocol(output, errs, cancel, msgMapper, logger), nil
 	default:
+		if factory, ok := customProtocols.get(network); ok {
+			return factory(network, output, errs, cancel, msgMapper, logger)
+		}
 		return nil, UnsupportedProtocolError(fmt.Sprintf("protocol %s is not supported", network))
 	}
 }
 
+// Factories of protocols registered with RegisterProtocol.
+var customProtocols = &protocolFactories{factories: make(map[string]ProtocolFactory)}
+
+type protocolFactories struct {
+	mu        sync.RWMutex
+	factories map[string]ProtocolFactory
+}
+
+func (pf *protocolFactories) get(network string) (ProtocolFactory, bool) {
+	pf.mu.RLock()
+	defer pf.mu.RUnlock()
+	factory, ok := pf.factories[network]
+	return factory, ok
+}
+
+// RegisterProtocol registers custom transport protocol, e.g. SIP over unix sockets.
+// Traits of the protocol are registered with sip.RegisterTransportProto,
+// so the transaction and routing layers treat the protocol generically,
+// the factory creates protocols of the network in the transport layers using the default protocol factory.
+// Network() of the created protocols must return the Via transport token of the protocol.
+func RegisterProtocol(proto sip.TransportProto, factory ProtocolFactory) error {
+	if factory == nil {
+		return fmt.Errorf("missing factory of protocol %s", proto.Network)
+	}
+	if err := sip.RegisterTransportProto(proto); err != nil {
+		return err
+	}
+
+	customProtocols.mu.Lock()
+	customProtocols.factories[sip.TokenLower(proto.Network)] = factory
+	customProtocols.mu.Unlock()
+
+	return nil
+}
+
 // SetProtocolFactory replaces default protocol factory
 func SetProtocolFactory(factory ProtocolFactory) {
 	protocolFactory = factory
@@ -74,6 +135,11 @@ type layer struct {
 	ip          net.IP
 	dnsResolver *net.Resolver
 	msgMapper   sip.MessageMapper
+	hooks       sendHooks
+	encoder     bodyEncoder
+	forceRport  int32
+	inbound     *inboundQueue
+	resolver    atomic.Value // *Resolver
 
 	msgs     chan sip.Message
 	errs     chan error
@@ -103,6 +169,7 @@ func NewLayer(
 		ip:          ip,
 		dnsResolver: dnsResolver,
 		msgMapper:   msgMapper,
+		inbound:     newInboundQueue(),
 
 		msgs:     make(chan sip.Message),
 		errs:     make(chan error),
@@ -118,6 +185,8 @@ func NewLayer(
 			"transport_layer_ptr": fmt.Sprintf("%p", tpl),
 		})
 
+	tpl.wg.Add(1)
+	go tpl.serveInbound()
 	go tpl.serveProtocols()
 
 	return tpl
@@ -161,18 +230,23 @@ func (tpl *layer) Errors() <-chan error {
 	return tpl.errs
 }
 
+// IsReliable checks the protocol of the network, traits of protocols not used by the layer yet
+// are taken from the transport protocols registry, see sip.LookupTransportProto.
 func (tpl *layer) IsReliable(network string) bool {
-	if protocol, ok := tpl.protocols.get(protocolKey(network)); ok && protocol.Reliable() {
-		return true
+	if protocol, ok := tpl.protocols.get(protocolKey(protocolNetwork(network))); ok {
+		return protocol.Reliable()
 	}
-	return false
+	proto, ok := sip.LookupTransportProto(network)
+	return ok && proto.Reliable
 }
 
+// IsStreamed checks the protocol of the network like IsReliable.
 func (tpl *layer) IsStreamed(network string) bool {
-	if protocol, ok := tpl.protocols.get(protocolKey(network)); ok && protocol.Streamed() {
-		return true
+	if protocol, ok := tpl.protocols.get(protocolKey(protocolNetwork(network))); ok {
+		return protocol.Streamed()
 	}
-	return false
+	proto, ok := sip.LookupTransportProto(network)
+	return ok && proto.Streamed
 }
 
 func (tpl *layer) Listen(network string, addr string, options ...ListenOption) error {
@@ -186,26 +260,55 @@ func (tpl *layer) Listen(network string, addr string, options ...ListenOption) e
 	if err != nil {
 		return err
 	}
+	// the listen address of the inherited socket is already bound
+	optsHash := applyListenOptions(options...)
+	if optsHash.File != nil {
+		if addr, err = fileListenAddr(network, optsHash.File); err != nil {
+			return fmt.Errorf("resolve %s listen address of the file %s: %w", network, optsHash.File.Name(), err)
+		}
+	}
 	target, err := NewTargetFromAddr(addr)
 	if err != nil {
 		return err
 	}
 	target = FillTargetHostAndPort(protocol.Network(), target)
 
+	// TLS connections detected on the TCP listener are served by the TLS protocol
+	var tlsProtocol Protocol
+	if optsHash.TLSSniffing != nil && protocol.Network() == "TCP" {
+		if tlsProtocol, err = tpl.getProtocol("tls"); err != nil {
+			return err
+		}
+		if p, ok := tlsProtocol.(interface{ serveConn(conn net.Conn) }); ok {
+			options = append(options, tlsHandoff(p.serveConn))
+		}
+	}
+
 	err = protocol.Listen(target, options...)
 	if err == nil {
-		if _, ok := tpl.listenPorts[protocol.Network()]; !ok {
-			if tpl.listenPorts[protocol.Network()] == nil {
-				tpl.listenPorts[protocol.Network()] = make([]sip.Port, 0)
-			}
-			tpl.listenPorts[protocol.Network()] = append(tpl.listenPorts[protocol.Network()], *target.Port)
+		tpl.addListenPort(protocol.Network(), *target.Port)
+		if tlsProtocol != nil {
+			tpl.addListenPort(tlsProtocol.Network(), *target.Port)
 		}
 	}
 
 	return err
 }
 
+func (tpl *layer) addListenPort(network string, port sip.Port) {
+	if _, ok := tpl.listenPorts[network]; !ok {
+		if tpl.listenPorts[network] == nil {
+			tpl.listenPorts[network] = make([]sip.Port, 0)
+		}
+		tpl.listenPorts[network] = append(tpl.listenPorts[network], port)
+	}
+}
+
 func (tpl *layer) Send(msg sip.Message) error {
+	return tpl.SendContext(context.Background(), msg)
+}
+
+func (tpl *layer) SendContext(ctx context.Context, msg sip.Message) error {
 	select {
 	case <-tpl.canceled:
 		return fmt.Errorf("transport layer is canceled")
@@ -223,78 +326,36 @@ func (tpl *layer) Send(msg sip.Message) error {
 	switch msg := msg.(type) {
 	// RFC 3261 - 18.1.1.
 	case sip.Request:
-		network := msg.Transport()
-		// rewrite sent-by transport
-		viaHop.Transport = strings.ToUpper(network)
-		viaHop.Host = tpl.ip.String()
-
-		protocol, err := tpl.getProtocol(network)
-		if err != nil {
+		if err := tpl.resolveRequest(ctx, msg); err != nil {
 			return err
 		}
 
-		// rewrite sent-by port
-		if viaHop.Port == nil {
-			if ports, ok := tpl.listenPorts[network]; ok && (len(ports) > 0) {
-				port := ports[rand.Intn(len(ports))]
-				viaHop.Port = &port
-			} else {
-				defPort := sip.DefaultPort(network)
-				viaHop.Port = &defPort
+		network := msg.Transport()
+		// Request larger than 1300 bytes is sent over TCP instead of UDP set in the top Via,
+		// UDP is used again if TCP fails, e.g. the remote side does not listen on TCP.
+		if network == "TCP" && sip.TokenEqual(viaHop.Transport, "UDP") &&
+			uint(len(msg.String())) > udpRequestSizeLimit {
+			port := viaHop.Port
+			err := tpl.sendRequest(ctx, msg, viaHop, network)
+			if err == nil {
+				return nil
 			}
-		}
 
-		target, err := NewTargetFromAddr(msg.Destination())
-		if err != nil {
-			return fmt.Errorf("build address target for %s: %w", msg.Destination(), err)
-		}
-
-		// dns srv lookup
-		if net.ParseIP(target.Host) == nil {
-			ctx := context.Background()
-			proto := strings.ToLower(network)
-			if _, addrs, err := tpl.dnsResolver.LookupSRV(ctx, "sip", proto, target.Host); err == nil && len(addrs) > 0 {
-				addr := addrs[0]
-				addrStr := fmt.Sprintf("%s:%d", addr.Target[:len(addr.Target)-1], addr.Port)
-				switch network {
-				case "UDP":
-					if addr, err := net.ResolveUDPAddr("udp", addrStr); err == nil {
-						port := sip.Port(addr.Port)
-						if addr.IP.To4() == nil {
-							target.Host = fmt.Sprintf("[%v]", addr.IP.String())
-						} else {
-							target.Host = addr.IP.String()
-						}
-						target.Port = &port
-					}
-				case "TLS":
-					fallthrough
-				case "WS":
-					fallthrough
-				case "WSS":
-					fallthrough
-				case "TCP":
-					if addr, err := net.ResolveTCPAddr("tcp", addrStr); err == nil {
-						port := sip.Port(addr.Port)
-						if addr.IP.To4() == nil {
-							target.Host = fmt.Sprintf("[%v]", addr.IP.String())
-						} else {
-							target.Host = addr.IP.String()
-						}
-						target.Port = &port
-					}
-				}
+			// no time left for the fallback
+			if ctx.Err() != nil {
+				return err
 			}
-		}
 
-		logger := log.AddFieldsFrom(tpl.Log(), protocol, msg)
-		logger.Debugf("sending SIP request:\n%s", msg)
+			tpl.Log().Warnf("send large SIP request over TCP failed, fallback to UDP: %s", err)
 
-		if err = protocol.Send(target, msg); err != nil {
-			return fmt.Errorf("send SIP message through %s protocol to %s: %w", protocol.Network(), target.Addr(), err)
+			network = "UDP"
+			viaHop.Port = port
+			// the transport is pinned to the request, so the transaction treats it as unreliable
+			// and its retransmissions go over UDP at once
+			msg.SetTransport(network)
 		}
 
-		return nil
+		return tpl.sendRequest(ctx, msg, viaHop, network)
 		// RFC 3261 - 18.2.2.
 	case sip.Response:
 		// resolve protocol from Via
@@ -303,19 +364,12 @@ func (tpl *layer) Send(msg sip.Message) error {
 			return err
 		}
 
-		target, err := NewTargetFromAddr(msg.Destination())
+		target, err := responseTarget(msg, protocol)
 		if err != nil {
-			return fmt.Errorf("build address target for %s: %w", msg.Destination(), err)
-		}
-
-		logger := log.AddFieldsFrom(tpl.Log(), protocol, msg)
-		logger.Debugf("sending SIP response:\n%s", msg)
-
-		if err = protocol.Send(target, msg); err != nil {
-			return fmt.Errorf("send SIP message through %s protocol to %s: %w", protocol.Network(), target.Addr(), err)
+			return err
 		}
 
-		return nil
+		return tpl.send(ctx, protocol, target, msg)
 	default:
 		return &sip.UnsupportedMessageError{
 			Err: fmt.Errorf("unsupported message %s", msg.Short()),
@@ -324,8 +378,216 @@ func (tpl *layer) Send(msg sip.Message) error {
 	}
 }
 
+// Selects the transport and the server of the request with the resolver - RFC 3263 4.
+// The selection is pinned to the request as its transport and destination,
+// so retransmissions go to the same server and the transaction knows the transport.
+func (tpl *layer) resolveRequest(ctx context.Context, msg sip.Request) error {
+	resolver, _ := tpl.resolver.Load().(*Resolver)
+	if resolver == nil {
+		return nil
+	}
+	uri, ok := NextHop(msg)
+	if !ok || net.ParseIP(strings.Trim(uri.Host(), "[]")) != nil {
+		return nil
+	}
+
+	targets, err := resolver.Resolve(ctx, uri)
+	if ctx.Err() != nil {
+		return fmt.Errorf("resolve %s: %w", uri, &ContextError{ctx.Err(), "resolve next hop"})
+	}
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", uri, err)
+	}
+	for _, target := range targets {
+		if _, err := tpl.getProtocol(target.Network); err != nil {
+			continue
+		}
+
+		tpl.Log().Debugf("next hop %s resolved to %s", uri, target)
+
+		msg.SetTransport(target.Network)
+		msg.SetDestination(target.Addr())
+		return nil
+	}
+
+	return fmt.Errorf("resolve %s: no servers reachable over supported transports", uri)
+}
+
+// Sends request through the protocol of the network rewriting the top Via sent-by - RFC 3261 18.1.1.
+func (tpl *layer) sendRequest(ctx context.Context, msg sip.Request, viaHop *sip.ViaHop, network string) error {
+	// rewrite sent-by transport
+	viaHop.Transport = sip.TokenUpper(network)
+	viaHop.Host = tpl.ip.String()
+
+	protocol, err := tpl.getProtocol(network)
+	if err != nil {
+		return err
+	}
+
+	// rewrite sent-by port
+	if viaHop.Port == nil {
+		if ports, ok := tpl.listenPorts[network]; ok && (len(ports) > 0) {
+			port := ports[rand.Intn(len(ports))]
+			viaHop.Port = &port
+		} else {
+			defPort := sip.DefaultPort(network)
+			viaHop.Port = &defPort
+		}
+	}
+
+	target, err := NewTargetFromAddr(msg.Destination())
+	if err != nil {
+		return fmt.Errorf("build address target for %s: %w", msg.Destination(), err)
+	}
+
+	// dns srv lookup, hosts of unix sockets are mapped to paths by the protocol
+	if net.ParseIP(target.Host) == nil && protocolNetwork(network) != unixProto.Network {
+		proto := sip.TokenLower(network)
+		_, addrs, err := tpl.dnsResolver.LookupSRV(ctx, "sip", proto, target.Host)
+		if ctx.Err() != nil {
+			return fmt.Errorf("resolve %s: %w", target.Host, &ContextError{ctx.Err(), "lookup SRV"})
+		}
+		if err == nil && len(addrs) > 0 {
+			addr := addrs[0]
+			addrStr := fmt.Sprintf("%s:%d", addr.Target[:len(addr.Target)-1], addr.Port)
+			switch network {
+			case "UDP":
+				if addr, err := resolveUDPAddr(ctx, "udp", addrStr); err == nil {
+					port := sip.Port(addr.Port)
+					if addr.IP.To4() == nil {
+						target.Host = fmt.Sprintf("[%v]", addr.IP.String())
+					} else {
+						target.Host = addr.IP.String()
+					}
+					target.Port = &port
+				}
+			case "TLS":
+				fallthrough
+			case "WS":
+				fallthrough
+			case "WSS":
+				fallthrough
+			case "TCP":
+				if addr, err := resolveTCPAddr(ctx, "tcp", addrStr); err == nil {
+					port := sip.Port(addr.Port)
+					if addr.IP.To4() == nil {
+						target.Host = fmt.Sprintf("[%v]", addr.IP.String())
+					} else {
+						target.Host = addr.IP.String()
+					}
+					target.Port = &port
+				}
+			}
+		}
+	}
+
+	// RFC 3261 - 18.1.1.
+	// Request sent to a multicast address must have 'maddr' and 'ttl' in the top Via.
+	if ip := net.ParseIP(target.Host); ip != nil && ip.IsMulticast() {
+		if viaHop.Params == nil {
+			viaHop.Params = sip.NewParams()
+		}
+		viaHop.Params.Add("maddr", sip.String{Str: ip.String()})
+		if !viaHop.Params.Has("ttl") {
+			viaHop.Params.Add("ttl", sip.String{Str: strconv.Itoa(defaultMulticastTTL)})
+		}
+	}
+
+	return tpl.send(ctx, protocol, target, msg)
+}
+
+// Sends prepared message through the protocol running send hooks around.
+func (tpl *layer) send(ctx context.Context, protocol Protocol, target *Target, msg sip.Message) error {
+	tpl.encoder.accept(msg)
+	if err := tpl.hooks.runPre(msg, protocol.Network(), target); err != nil {
+		return fmt.Errorf("send SIP message %s: pre-send hook: %w", msg.Short(), err)
+	}
+	msg, err := tpl.encoder.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	logger := log.AddFieldsFrom(tpl.Log(), protocol, msg)
+	if _, ok := msg.(sip.Request); ok {
+		logger.Debugf("sending SIP request:\n%s", msg)
+	} else {
+		logger.Debugf("sending SIP response:\n%s", msg)
+	}
+
+	if err := protocol.SendContext(ctx, target, msg); err != nil {
+		return fmt.Errorf("send SIP message through %s protocol to %s: %w", protocol.Network(), target.Addr(), err)
+	}
+
+	if tpl.hooks.hasPost() {
+		tpl.hooks.runPost([]byte(msg.String()), protocol.Network(), target)
+	}
+
+	return nil
+}
+
+func (tpl *layer) OnPreSend(hook PreSendHook) {
+	tpl.hooks.addPre(hook)
+}
+
+func (tpl *layer) OnPostSend(hook PostSendHook) {
+	tpl.hooks.addPost(hook)
+}
+
+func (tpl *layer) SetBodyEncoding(encoding *BodyEncoding) error {
+	return tpl.encoder.set(encoding)
+}
+
+func (tpl *layer) SetForceRport(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&tpl.forceRport, v)
+}
+
+func (tpl *layer) SetPriorityScheduling(enabled bool) {
+	tpl.inbound.setEnabled(enabled)
+}
+
+func (tpl *layer) SetResolver(resolver *Resolver) {
+	tpl.resolver.Store(resolver)
+}
+
+// Requests larger than this size are sent over TCP instead of UDP, see sip.Request.Transport.
+const udpRequestSizeLimit = MTU - 200
+
+// Resolves response target - RFC 3261 18.2.2.
+// For unreliable transports response is sent to the address in the top Via 'maddr' parameter
+// and to the port from sent-by, otherwise to the response destination.
+func responseTarget(res sip.Response, protocol Protocol) (*Target, error) {
+	if viaHop, ok := res.ViaHop(); ok && !protocol.Reliable() && viaHop.Params != nil {
+		if maddr, ok := viaHop.Params.Get("maddr"); ok && maddr != nil && maddr.String() != "" {
+			port := sip.DefaultPort(protocol.Network())
+			if viaHop.Port != nil {
+				port = *viaHop.Port
+			}
+
+			return &Target{Host: maddr.String(), Port: &port}, nil
+		}
+	}
+
+	target, err := NewTargetFromAddr(res.Destination())
+	if err != nil {
+		return nil, fmt.Errorf("build address target for %s: %w", res.Destination(), err)
+	}
+	return target, nil
+}
+
+// Returns the network of the protocol by the network or the Via transport token.
+func protocolNetwork(network string) string {
+	if proto, ok := sip.LookupTransportProto(network); ok {
+		return proto.Network
+	}
+	return sip.TokenLower(network)
+}
+
 func (tpl *layer) getProtocol(network string) (Protocol, error) {
-	network = strings.ToLower(network)
+	network = protocolNetwork(network)
 	return tpl.protocols.getOrPutNew(protocolKey(network), func() (Protocol, error) {
 		return protocolFactory(
 			network,
@@ -368,6 +630,8 @@ func (tpl *layer) dispose() {
 	}
 
 	tpl.listenPorts = make(map[string][]sip.Port)
+	// wait for the inbound queue
+	tpl.wg.Wait()
 
 	close(tpl.pmsgs)
 	close(tpl.perrs)
@@ -381,9 +645,29 @@ func (tpl *layer) handleMessage(msg sip.Message) {
 	logger := tpl.Log().WithFields(msg.Fields())
 
 	logger.Debugf("received SIP message:\n%s", msg)
+
+	if err := tpl.encoder.decode(msg); err != nil {
+		tpl.handlerError(&sip.MalformedMessageError{
+			Err: err,
+			Msg: msg.String(),
+		})
+		return
+	}
+	if req, ok := msg.(sip.Request); ok && atomic.LoadInt32(&tpl.forceRport) == 1 {
+		forceRport(req)
+	}
+	if tpl.inbound.isEnabled() {
+		logger.Trace("queue SIP message")
+
+		tpl.inbound.push(msg)
+		return
+	}
+	tpl.passUp(msg, logger)
+}
+
+func (tpl *layer) passUp(msg sip.Message, logger log.Logger) {
 	logger.Trace("passing up SIP message...")
 
-	// pass up message
 	select {
 	case <-tpl.canceled:
 	case tpl.msgs <- msg:
@@ -391,6 +675,32 @@ func (tpl *layer) handleMessage(msg sip.Message) {
 	}
 }
 
+// passes up queued inbound messages in the order of priority
+func (tpl *layer) serveInbound() {
+	defer tpl.wg.Done()
+
+	for {
+		select {
+		case <-tpl.canceled:
+			return
+		case <-tpl.inbound.ready:
+		}
+
+		for {
+			msg, ok := tpl.inbound.pop()
+			if !ok {
+				break
+			}
+			tpl.passUp(msg, tpl.Log().WithFields(msg.Fields()))
+			select {
+			case <-tpl.canceled:
+				return
+			default:
+			}
+		}
+	}
+}
+
 func (tpl *layer) handlerError(err error) {
 	// TODO: implement re-connection strategy for listeners
 	var terr Error
@@ -3,6 +3,7 @@ package transport_test
 import (
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
 	"github.com/ghettovoice/gosip/testutils"
 	"github.com/ghettovoice/gosip/transport"
 )
@@ -231,6 +233,349 @@ var _ = Describe("TransportLayer", func() {
 			})
 		})
 
+		Context("when sends request larger than 1300 bytes over UDP", func() {
+			largeReq := func(addr string) sip.Request {
+				return testutils.Request([]string{
+					"MESSAGE sip:bob@" + addr + " SIP/2.0",
+					"Via: SIP/2.0/UDP " + localAddr1 + ";branch=" + sip.GenerateBranch(),
+					"To: \"Bob\" <sip:bob@far-far-away.com>",
+					"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+					"Call-ID: large-request",
+					"CSeq: 1 MESSAGE",
+					"Content-Type: text/plain",
+					"Content-Length: 1400",
+					"",
+					strings.Repeat("a", 1400),
+				})
+			}
+
+			It("should send it over TCP", func(done Done) {
+				ln, err := net.Listen("tcp", clientAddr)
+				Expect(err).ToNot(HaveOccurred())
+				defer ln.Close()
+
+				Expect(tpl.Send(largeReq(clientAddr))).To(Succeed())
+
+				conn, err := ln.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				buf := make([]byte, 0, 2*transport.MTU)
+				for !strings.Contains(string(buf), strings.Repeat("a", 1400)) {
+					chunk := make([]byte, transport.MTU)
+					num, err := conn.Read(chunk)
+					Expect(err).ToNot(HaveOccurred())
+					buf = append(buf, chunk[:num]...)
+				}
+				Expect(string(buf)).To(ContainSubstring("Via: SIP/2.0/TCP " + ip + ":5060;"))
+				close(done)
+			}, 3)
+
+			It("should fallback to UDP if TCP fails", func(done Done) {
+				conn, err := net.ListenPacket("udp", clientAddr)
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				req := largeReq(clientAddr)
+				Expect(tpl.Send(req)).To(Succeed())
+
+				buf := make([]byte, 2*transport.MTU)
+				num, _, err := conn.ReadFrom(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(buf[:num])).To(ContainSubstring("Via: SIP/2.0/UDP " + ip + ":5060;"))
+				// the fallback is pinned to the request for the transaction and retransmissions
+				Expect(req.Transport()).To(Equal("UDP"))
+				close(done)
+			}, 3)
+		})
+
+		Context("with resolver", func() {
+			request := func() sip.Request {
+				return testutils.Request([]string{
+					"MESSAGE sip:bob@example.com SIP/2.0",
+					"Via: SIP/2.0/UDP " + localAddr1 + ";branch=" + sip.GenerateBranch(),
+					"To: \"Bob\" <sip:bob@far-far-away.com>",
+					"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+					"Call-ID: resolved-request",
+					"CSeq: 1 MESSAGE",
+					"Content-Length: 0",
+					"",
+					"",
+				})
+			}
+
+			BeforeEach(func() {
+				tpl.SetResolver(transport.NewResolver(&fakeDNSLookup{
+					naptr: map[string][]*transport.NAPTR{
+						"example.com": {
+							{Order: 20, Preference: 50, Flags: "s", Service: "SIP+D2U", Replacement: "_sip._udp.example.com."},
+							{Order: 10, Preference: 50, Flags: "s", Service: "SIP+D2T", Replacement: "_sip._tcp.example.com."},
+						},
+					},
+					srv: map[string][]*net.SRV{
+						"_sip._tcp.example.com.": {{Target: "sip.example.com.", Port: uint16(clientPort), Priority: 10}},
+					},
+					ip: map[string][]net.IPAddr{
+						"sip.example.com": {{IP: net.ParseIP(clientHost)}},
+					},
+				}))
+			})
+
+			It("should send request over transport selected with NAPTR records", func(done Done) {
+				ln, err := net.Listen("tcp", clientAddr)
+				Expect(err).ToNot(HaveOccurred())
+				defer ln.Close()
+
+				req := request()
+				Expect(tpl.Send(req)).To(Succeed())
+				Expect(req.Transport()).To(Equal("TCP"))
+				Expect(req.Destination()).To(Equal(clientAddr))
+
+				conn, err := ln.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				buf := make([]byte, transport.MTU)
+				num, err := conn.Read(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(buf[:num])).To(ContainSubstring("Via: SIP/2.0/TCP " + ip + ":5060;"))
+				close(done)
+			}, 3)
+
+			It("should send request with explicit destination as is", func(done Done) {
+				conn, err := net.ListenPacket("udp", clientAddr)
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				req := request()
+				req.SetDestination(clientAddr)
+				Expect(tpl.Send(req)).To(Succeed())
+
+				buf := make([]byte, transport.MTU)
+				num, _, err := conn.ReadFrom(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(buf[:num])).To(ContainSubstring("Via: SIP/2.0/UDP " + ip + ":5060;"))
+				close(done)
+			}, 3)
+		})
+
+		Context("with send hooks", func() {
+			request := func(addr string) sip.Request {
+				return testutils.Request([]string{
+					"MESSAGE sip:bob@" + addr + " SIP/2.0",
+					"Via: SIP/2.0/UDP " + localAddr1 + ";branch=" + sip.GenerateBranch(),
+					"To: \"Bob\" <sip:bob@far-far-away.com>",
+					"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+					"Call-ID: hooked-request",
+					"CSeq: 1 MESSAGE",
+					"Content-Length: 0",
+					"",
+					"",
+				})
+			}
+
+			It("should mutate prepared message and pass rendered bytes", func(done Done) {
+				conn, err := net.ListenPacket("udp", clientAddr)
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				tpl.OnPreSend(func(msg sip.Message, network string, target *transport.Target) error {
+					defer GinkgoRecover()
+					Expect(network).To(Equal("UDP"))
+					hop, _ := msg.ViaHop()
+					Expect(hop.Host).To(Equal(ip))
+					msg.AppendHeader(&sip.GenericHeader{HeaderName: "X-Intercept", Contents: "1"})
+					return nil
+				})
+				var sent []byte
+				var sentTo string
+				tpl.OnPostSend(func(data []byte, network string, target *transport.Target) {
+					sent, sentTo = data, target.Addr()
+				})
+
+				Expect(tpl.Send(request(clientAddr))).To(Succeed())
+
+				buf := make([]byte, transport.MTU)
+				num, _, err := conn.ReadFrom(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(buf[:num])).To(ContainSubstring("X-Intercept: 1"))
+				Expect(sent).To(Equal(buf[:num]))
+				Expect(sentTo).To(Equal(clientAddr))
+				close(done)
+			}, 3)
+
+			It("should abort sending on pre-send hook error", func() {
+				tpl.OnPreSend(func(msg sip.Message, network string, target *transport.Target) error {
+					return fmt.Errorf("blocked")
+				})
+				tpl.OnPostSend(func(data []byte, network string, target *transport.Target) {
+					Fail("post-send hook is called")
+				})
+
+				Expect(tpl.Send(request(clientAddr))).To(MatchError(ContainSubstring("blocked")))
+			})
+		})
+
+		Context("with body encoding", func() {
+			body := strings.Repeat("Hello world! ", 20)
+			request := func(addr, via string, hdrs ...string) sip.Request {
+				lines := []string{
+					"MESSAGE sip:bob@" + addr + " SIP/2.0",
+					"Via: SIP/2.0/UDP " + via + ";branch=" + sip.GenerateBranch(),
+					"To: \"Bob\" <sip:bob@far-far-away.com>",
+					"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+					"Call-ID: encoded-request",
+					"CSeq: 1 MESSAGE",
+				}
+				lines = append(lines, hdrs...)
+				lines = append(lines, fmt.Sprintf("Content-Length: %d", len(body)), "", body)
+				return testutils.Request(lines)
+			}
+			// sends compressed request to the layer and answers it
+			exchange := func(hdrs ...string) sip.Message {
+				client = testutils.CreateClient("udp", localAddr1, clientAddr)
+				defer client.Close()
+				server, err := net.ListenPacket("udp", clientAddr)
+				Expect(err).ToNot(HaveOccurred())
+				defer server.Close()
+
+				req := request(localAddr1, clientAddr, hdrs...)
+				Expect(sip.EncodeBody(req, "deflate")).To(Succeed())
+				testutils.WriteToConn(client, []byte(req.String()))
+
+				var in sip.Message
+				Eventually(tpl.Messages(), 3).Should(Receive(&in))
+				Expect(in.Body()).To(Equal(body))
+				Expect(in.GetHeaders("Content-Encoding")).To(BeEmpty())
+				length, _ := in.ContentLength()
+				Expect(int(*length)).To(Equal(len(body)))
+
+				Expect(tpl.Send(sip.NewResponseFromRequest("", in.(sip.Request), 200, "OK", body))).To(Succeed())
+				buf := make([]byte, transport.MTU)
+				num, _, err := server.ReadFrom(buf)
+				Expect(err).ToNot(HaveOccurred())
+				res, err := parser.ParseMessage(buf[:num], logger)
+				Expect(err).ToNot(HaveOccurred())
+				return res
+			}
+
+			BeforeEach(func() {
+				Expect(tpl.SetBodyEncoding(&transport.BodyEncoding{Coding: "gzip", AcceptEncoding: true})).To(Succeed())
+			})
+
+			It("should compress body of outgoing request on the copy", func(done Done) {
+				conn, err := net.ListenPacket("udp", clientAddr)
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				req := request(clientAddr, localAddr1)
+				Expect(tpl.Send(req)).To(Succeed())
+
+				buf := make([]byte, transport.MTU)
+				num, _, err := conn.ReadFrom(buf)
+				Expect(err).ToNot(HaveOccurred())
+				msg, err := parser.ParseMessage(buf[:num], logger)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sip.ContentCodings(msg)).To(Equal([]string{"gzip"}))
+				Expect(msg.GetHeaders("Accept-Encoding")[0].Value()).To(Equal("gzip, deflate"))
+				Expect(msg.Body()).ToNot(Equal(body))
+				Expect(sip.DecodeBody(msg)).To(Succeed())
+				Expect(msg.Body()).To(Equal(body))
+				// kept for retransmissions
+				Expect(req.Body()).To(Equal(body))
+				Expect(sip.ContentCodings(req)).To(BeEmpty())
+				close(done)
+			}, 3)
+
+			It("should decode received body and compress response if the coding is accepted", func(done Done) {
+				res := exchange("Accept-Encoding: gzip")
+				Expect(sip.ContentCodings(res)).To(Equal([]string{"gzip"}))
+				Expect(sip.DecodeBody(res)).To(Succeed())
+				Expect(res.Body()).To(Equal(body))
+				close(done)
+			}, 3)
+
+			It("should not compress response if the coding is not accepted", func(done Done) {
+				res := exchange()
+				Expect(res.GetHeaders("Content-Encoding")).To(BeEmpty())
+				Expect(res.Body()).To(Equal(body))
+				close(done)
+			}, 3)
+
+			It("should reject unsupported coding", func() {
+				Expect(tpl.SetBodyEncoding(&transport.BodyEncoding{Coding: "br"})).
+					To(BeAssignableToTypeOf(&sip.UnsupportedContentCodingError{}))
+			})
+		})
+
+		Context("with forced rport", func() {
+			natAddr := clientHost + ":9002"
+			request := "INVITE sip:bob@far-far-away.com SIP/2.0\r\n" +
+				"Via: SIP/2.0/UDP " + clientAddr + ";branch=z9hG4bK776asdhds\r\n" +
+				"To: \"Bob\" <sip:bob@far-far-away.com>\r\n" +
+				"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774\r\n" +
+				"Call-ID: nat-request\r\n" +
+				"CSeq: 1 INVITE\r\n" +
+				"Content-Length: 0\r\n" +
+				"\r\n"
+			var conn net.PacketConn
+
+			BeforeEach(func() {
+				var err error
+				conn, err = net.ListenPacket("udp", natAddr)
+				Expect(err).ToNot(HaveOccurred())
+				tpl.SetForceRport(true)
+			})
+			AfterEach(func() {
+				conn.Close()
+			})
+
+			It("should send response to the source address of the request", func(done Done) {
+				laddr, err := net.ResolveUDPAddr("udp", localAddr1)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = conn.WriteTo([]byte(request), laddr)
+				Expect(err).ToNot(HaveOccurred())
+
+				var in sip.Message
+				Eventually(tpl.Messages(), 3).Should(Receive(&in))
+				Expect(in.Source()).To(Equal(natAddr))
+				addr, ok := transport.GetRemoteAddr(in)
+				Expect(ok).To(BeTrue())
+				Expect(addr).To(Equal(natAddr))
+				hop, ok := in.ViaHop()
+				Expect(ok).To(BeTrue())
+				received, _ := hop.Params.Get("received")
+				Expect(received.String()).To(Equal(clientHost))
+				rport, _ := hop.Params.Get("rport")
+				Expect(rport.String()).To(Equal("9002"))
+
+				Expect(tpl.Send(sip.NewResponseFromRequest("", in.(sip.Request), 200, "OK", ""))).To(Succeed())
+				buf := make([]byte, transport.MTU)
+				num, _, err := conn.ReadFrom(buf)
+				Expect(err).ToNot(HaveOccurred())
+				res, err := parser.ParseMessage(buf[:num], logger)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(res.(sip.Response).StatusCode()).To(Equal(sip.StatusCode(200)))
+				hop, _ = res.ViaHop()
+				rport, _ = hop.Params.Get("rport")
+				Expect(rport.String()).To(Equal("9002"))
+				close(done)
+			}, 3)
+
+			It("should send response to the sent-by port if disabled", func(done Done) {
+				tpl.SetForceRport(false)
+				laddr, err := net.ResolveUDPAddr("udp", localAddr1)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = conn.WriteTo([]byte(request), laddr)
+				Expect(err).ToNot(HaveOccurred())
+
+				var in sip.Message
+				Eventually(tpl.Messages(), 3).Should(Receive(&in))
+				Expect(in.Source()).To(Equal(clientAddr))
+				hop, _ := in.ViaHop()
+				Expect(hop.Params.Has("rport")).To(BeFalse())
+				close(done)
+			}, 3)
+		})
+
 		Context("when cancels", func() {
 			BeforeEach(func() {
 				time.Sleep(time.Millisecond)
@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/ghettovoice/gosip/log"
+)
+
+// asyncListener accepts connections in the background and prepares each of them in a separate goroutine,
+// so slow clients don't block accepting of the others.
+type asyncListener struct {
+	net.Listener
+	// prepare returns connection ready to serve or nil if the connection was closed or handed off.
+	prepare func(conn net.Conn) net.Conn
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newAsyncListener(ls net.Listener, prepare func(conn net.Conn) net.Conn) *asyncListener {
+	l := &asyncListener{
+		Listener: ls,
+		prepare:  prepare,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go l.serve()
+	return l
+}
+
+func (l *asyncListener) serve() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case <-l.done:
+			case l.errs <- err:
+			}
+			return
+		}
+
+		go l.deliver(conn)
+	}
+}
+
+func (l *asyncListener) deliver(conn net.Conn) {
+	if conn = l.prepare(conn); conn == nil {
+		return
+	}
+
+	select {
+	case <-l.done:
+		conn.Close()
+	case l.conns <- conn:
+	}
+}
+
+func (l *asyncListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.done:
+		return nil, errors.New("use of closed listener")
+	case err := <-l.errs:
+		return nil, err
+	case conn := <-l.conns:
+		return conn, nil
+	}
+}
+
+func (l *asyncListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.Listener.Close()
+	})
+	return err
+}
+
+// listenTCP starts TCP listener or takes it from the file,
+// and wraps it with PROXY protocol reader if enabled.
+func listenTCP(addr *net.TCPAddr, opts ListenOptions, logger log.Logger) (net.Listener, error) {
+	var (
+		ls  net.Listener
+		err error
+	)
+	if opts.File != nil {
+		ls, err = net.FileListener(opts.File)
+	} else {
+		ls, err = net.ListenTCP("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.ProxyProtocol != nil {
+		return newProxyListener(ls, opts.ProxyProtocol, logger), nil
+	}
+	return ls, nil
+}
+
+// tlsListener is like the listener of crypto/tls package, but keeps the wrapped listener accessible.
+type tlsListener struct {
+	net.Listener
+	config *tls.Config
+}
+
+func (l *tlsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Server(conn, l.config), nil
+}
@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+type remoteAddrKey struct{}
+
+// GetRemoteAddr returns the address the message was actually received from,
+// unlike msg.Source() it isn't rewritten to the Via sent-by port of requests without 'rport'.
+func GetRemoteAddr(msg sip.Message) (string, bool) {
+	addr, ok := sip.MessageMetadata(msg).Value(remoteAddrKey{}).(string)
+	return addr, ok
+}
+
+func setRemoteAddr(msg sip.Message, addr string) {
+	sip.MessageMetadata(msg).SetValue(remoteAddrKey{}, addr)
+}
+
+// Handles the request as if the client had asked for 'rport' - RFC 3581 4.
+// If the request came from the address other than the top Via sent-by,
+// 'received' and 'rport' are populated with the source address
+// and responses are sent back to it instead of the sent-by port.
+func forceRport(req sip.Request) {
+	raddr, ok := GetRemoteAddr(req)
+	if !ok {
+		return
+	}
+	rhost, rport, err := net.SplitHostPort(raddr)
+	if err != nil {
+		return
+	}
+	viaHop, ok := req.ViaHop()
+	if !ok || viaHop.Params.Has("rport") {
+		return
+	}
+
+	port := sip.DefaultPort(req.Transport())
+	if viaHop.Port != nil {
+		port = *viaHop.Port
+	}
+	if rhost == viaHop.Host && rport == strconv.Itoa(int(port)) {
+		return
+	}
+
+	viaHop.Params.Add("received", sip.String{Str: rhost})
+	viaHop.Params.Add("rport", sip.String{Str: rport})
+	req.SetSource(raddr)
+}
@@ -1,7 +1,10 @@
 package transport
 
 import (
+	"crypto/tls"
 	"net"
+	"os"
+	"time"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
@@ -28,6 +31,31 @@ type ProtocolOption interface {
 
 type ProtocolOptions struct {
 	Options
+	// IdleTimeout is the time the connection without incoming messages lives in the pool, default is 1 hour.
+	IdleTimeout time.Duration
+	// KeepAliveInterval enables CRLF keep-alive pings on the outbound connections - RFC 5626 4.4.1.
+	KeepAliveInterval time.Duration
+	// KeepAliveTimeout is the time the pong is waited for, default is DefaultKeepAliveTimeout.
+	KeepAliveTimeout time.Duration
+	// DialTLSConfig is the configuration of the outbound TLS connections.
+	DialTLSConfig *tls.Config
+	// StrictContentLength enables strict framing of the stream connections, see WithStrictContentLength.
+	StrictContentLength bool
+	// MaxContentLength limits Content-Length of messages received on the stream connections in the strict mode.
+	MaxContentLength int
+}
+
+func applyProtocolOptions(options ...ProtocolOption) ProtocolOptions {
+	optsHash := ProtocolOptions{
+		IdleTimeout:      sockTTL,
+		KeepAliveTimeout: DefaultKeepAliveTimeout,
+	}
+	for _, opt := range options {
+		if opt != nil {
+			opt.ApplyProtocol(&optsHash)
+		}
+	}
+	return optsHash
 }
 
 func WithMessageMapper(mapper sip.MessageMapper) interface {
@@ -80,11 +108,91 @@ func (o withDnsResolver) ApplyLayer(opts *LayerOptions) {
 	opts.DNSResolver = o.resolver
 }
 
+// WithIdleTimeout sets the time the connection without incoming messages lives in the pool.
+func WithIdleTimeout(ttl time.Duration) ProtocolOption {
+	return withIdleTimeout{ttl}
+}
+
+type withIdleTimeout struct {
+	ttl time.Duration
+}
+
+func (o withIdleTimeout) ApplyProtocol(opts *ProtocolOptions) {
+	opts.IdleTimeout = o.ttl
+}
+
+// WithKeepAlive enables CRLF keep-alive of the outbound connections:
+// the ping is sent every interval, the connection is considered failed
+// if the pong doesn't come in timeout and it is reconnected - RFC 5626 4.4.1.
+// Zero timeout means DefaultKeepAliveTimeout.
+func WithKeepAlive(interval, timeout time.Duration) ProtocolOption {
+	return withKeepAlive{interval, timeout}
+}
+
+type withKeepAlive struct {
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func (o withKeepAlive) ApplyProtocol(opts *ProtocolOptions) {
+	opts.KeepAliveInterval = o.interval
+	if o.timeout > 0 {
+		opts.KeepAliveTimeout = o.timeout
+	}
+}
+
+// WithDialTLSConfig sets configuration of the outbound TLS connections:
+// root CAs to verify servers, client certificate for mutual TLS, server name for SNI.
+// By default server certificates are not verified.
+func WithDialTLSConfig(config *tls.Config) ProtocolOption {
+	return withDialTLSConfig{config}
+}
+
+type withDialTLSConfig struct {
+	config *tls.Config
+}
+
+func (o withDialTLSConfig) ApplyProtocol(opts *ProtocolOptions) {
+	opts.DialTLSConfig = o.config
+}
+
+// WithStrictContentLength enables strict validation of Content-Length on the stream connections - RFC 3261 18.3.
+// Message without Content-Length, with invalid or duplicated Content-Length, with Content-Length
+// greater than maxLength (if maxLength > 0) or with broken start line loses the stream framing,
+// so the connection is closed to resynchronize, see StreamResyncCount.
+func WithStrictContentLength(maxLength int) ProtocolOption {
+	return withStrictContentLength{maxLength}
+}
+
+type withStrictContentLength struct {
+	maxLength int
+}
+
+func (o withStrictContentLength) ApplyProtocol(opts *ProtocolOptions) {
+	opts.StrictContentLength = true
+	opts.MaxContentLength = o.maxLength
+}
+
 // Listen method options
 type ListenOption interface {
 	ApplyListen(opts *ListenOptions)
 }
 
 type ListenOptions struct {
-	TLSConfig TLSConfig
+	TLSConfig     TLSConfig
+	TLSSniffing   *TLSSniffing
+	ProxyProtocol *ProxyProtocol
+	File          *os.File
+
+	tlsHandoff tlsHandoff
+}
+
+func applyListenOptions(options ...ListenOption) ListenOptions {
+	optsHash := ListenOptions{}
+	for _, opt := range options {
+		if opt != nil {
+			opt.ApplyListen(&optsHash)
+		}
+	}
+	return optsHash
 }
@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"sync"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// MessagePriority is the processing class of inbound messages, see Layer.SetPriorityScheduling.
+type MessagePriority int
+
+const (
+	// PriorityLow is new work: INVITE creating a new dialog and REGISTER.
+	PriorityLow MessagePriority = iota
+	// PriorityNormal is any other request.
+	PriorityNormal
+	// PriorityHigh is maintenance of the established calls and transactions:
+	// responses, ACK, BYE and CANCEL.
+	PriorityHigh
+)
+
+func (p MessagePriority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// InboundPriority returns the processing class of the inbound message.
+func InboundPriority(msg sip.Message) MessagePriority {
+	req, ok := msg.(sip.Request)
+	if !ok {
+		return PriorityHigh
+	}
+
+	switch req.Method() {
+	case sip.ACK, sip.BYE, sip.CANCEL:
+		return PriorityHigh
+	case sip.REGISTER:
+		return PriorityLow
+	case sip.INVITE:
+		if to, ok := req.To(); ok && to.Params != nil && to.Params.Has("tag") {
+			return PriorityNormal
+		}
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+// inboundQueue holds inbound messages waiting to be passed up in the order of priority,
+// messages of the same priority are passed up in the order of arrival.
+type inboundQueue struct {
+	mu      sync.Mutex
+	enabled bool
+	classes [PriorityHigh + 1][]sip.Message
+	ready   chan struct{}
+}
+
+func newInboundQueue() *inboundQueue {
+	return &inboundQueue{ready: make(chan struct{}, 1)}
+}
+
+func (q *inboundQueue) setEnabled(enabled bool) {
+	q.mu.Lock()
+	q.enabled = enabled
+	q.mu.Unlock()
+}
+
+func (q *inboundQueue) isEnabled() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.enabled
+}
+
+func (q *inboundQueue) push(msg sip.Message) {
+	prio := InboundPriority(msg)
+
+	q.mu.Lock()
+	if req, ok := msg.(sip.Request); ok && req.IsCancel() {
+		// CANCEL must not overtake the INVITE it cancels, otherwise it is answered with 481
+		q.promote(req)
+	}
+	q.classes[prio] = append(q.classes[prio], msg)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Moves the queued INVITE of the CANCEL request to the high priority class.
+func (q *inboundQueue) promote(cancel sip.Request) {
+	branch, ok := topBranch(cancel)
+	if !ok {
+		return
+	}
+	for prio := PriorityLow; prio < PriorityHigh; prio++ {
+		for i, msg := range q.classes[prio] {
+			req, ok := msg.(sip.Request)
+			if !ok || !req.IsInvite() {
+				continue
+			}
+			if b, ok := topBranch(req); ok && b == branch {
+				q.classes[prio] = append(q.classes[prio][:i], q.classes[prio][i+1:]...)
+				q.classes[PriorityHigh] = append(q.classes[PriorityHigh], req)
+				return
+			}
+		}
+	}
+}
+
+func (q *inboundQueue) pop() (sip.Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for prio := PriorityHigh; prio >= PriorityLow; prio-- {
+		if msgs := q.classes[prio]; len(msgs) > 0 {
+			msg := msgs[0]
+			msgs[0] = nil
+			q.classes[prio] = msgs[1:]
+			return msg, true
+		}
+	}
+	return nil, false
+}
+
+func topBranch(req sip.Request) (string, bool) {
+	viaHop, ok := req.ViaHop()
+	if !ok || viaHop.Params == nil {
+		return "", false
+	}
+	branch, ok := viaHop.Params.Get("branch")
+	if !ok || branch == nil {
+		return "", false
+	}
+	return branch.String(), true
+}
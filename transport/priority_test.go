@@ -0,0 +1,94 @@
+package transport_test
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("InboundPriority", func() {
+	request := func(method sip.RequestMethod, branch, toParams string) string {
+		return fmt.Sprintf("%s sip:bob@127.0.0.1:5070 SIP/2.0\r\n"+
+			"Via: SIP/2.0/UDP 127.0.0.1:9003;branch=%s\r\n"+
+			"To: <sip:bob@far-far-away.com>%s\r\n"+
+			"From: <sip:alice@wonderland.com>;tag=1928301774\r\n"+
+			"Call-ID: %s\r\n"+
+			"CSeq: 1 %s\r\n"+
+			"Content-Length: 0\r\n"+
+			"\r\n", method, branch, toParams, branch, method)
+	}
+	logger := testutils.NewLogrusLogger()
+
+	It("should classify messages", func() {
+		for raw, prio := range map[string]transport.MessagePriority{
+			request(sip.INVITE, "z9hG4bK1", ""):         transport.PriorityLow,
+			request(sip.REGISTER, "z9hG4bK2", ""):       transport.PriorityLow,
+			request(sip.INVITE, "z9hG4bK3", ";tag=abc"): transport.PriorityNormal,
+			request(sip.OPTIONS, "z9hG4bK4", ""):        transport.PriorityNormal,
+			request(sip.BYE, "z9hG4bK5", ";tag=abc"):    transport.PriorityHigh,
+			request(sip.CANCEL, "z9hG4bK6", ""):         transport.PriorityHigh,
+			request(sip.ACK, "z9hG4bK7", ";tag=abc"):    transport.PriorityHigh,
+		} {
+			msg := testutils.Message([]string{raw})
+			Expect(transport.InboundPriority(msg)).To(Equal(prio), raw)
+		}
+		res := sip.NewResponseFromRequest("", testutils.Request([]string{request(sip.INVITE, "z9hG4bK8", "")}), 180, "Ringing", "")
+		Expect(transport.InboundPriority(res)).To(Equal(transport.PriorityHigh))
+	})
+
+	Context("with priority scheduling", func() {
+		var (
+			tpl  transport.Layer
+			conn net.PacketConn
+		)
+
+		BeforeEach(func() {
+			tpl = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger)
+			tpl.SetPriorityScheduling(true)
+			Expect(tpl.Listen("udp", "127.0.0.1:5070")).To(Succeed())
+			var err error
+			conn, err = net.ListenPacket("udp", "127.0.0.1:9003")
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func(done Done) {
+			conn.Close()
+			tpl.Cancel()
+			<-tpl.Done()
+			close(done)
+		}, 3)
+
+		It("should pass up maintenance traffic before new work", func(done Done) {
+			raddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:5070")
+			Expect(err).ToNot(HaveOccurred())
+			send := func(data string) {
+				_, err := conn.WriteTo([]byte(data), raddr)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			// the first message is taken by the dispatcher while nobody reads messages
+			send(request(sip.OPTIONS, "z9hG4bK0", ""))
+			time.Sleep(100 * time.Millisecond)
+			send(request(sip.INVITE, "z9hG4bKinvite", ""))
+			send(request(sip.REGISTER, "z9hG4bKregister", ""))
+			send(request(sip.BYE, "z9hG4bKbye", ";tag=abc"))
+			send(request(sip.CANCEL, "z9hG4bKinvite", ""))
+			time.Sleep(200 * time.Millisecond)
+
+			methods := make([]sip.RequestMethod, 0, 5)
+			for len(methods) < 5 {
+				var msg sip.Message
+				Eventually(tpl.Messages(), 2).Should(Receive(&msg))
+				methods = append(methods, msg.(sip.Request).Method())
+			}
+			Expect(methods).To(Equal([]sip.RequestMethod{sip.OPTIONS, sip.BYE, sip.INVITE, sip.CANCEL, sip.REGISTER}))
+			close(done)
+		}, 5)
+	})
+})
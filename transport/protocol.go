@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -12,6 +13,17 @@ import (
 const (
 	//netErrRetryTime = 5 * time.Second
 	sockTTL = time.Hour
+	// DefaultKeepAliveTimeout is the time the pong is waited for after the keep-alive ping - RFC 5626 4.4.1.
+	DefaultKeepAliveTimeout = 10 * time.Second
+	// time to wait before the flow recovery attempt after consecutive failures - RFC 5626 4.5
+	flowRecoveryBaseTime = 30 * time.Second
+	flowRecoveryMaxTime  = 1800 * time.Second
+)
+
+var (
+	// CRLF keep-alive of stream transports - RFC 5626 3.5.1
+	keepAlivePing = []byte("\r\n\r\n")
+	keepAlivePong = []byte("\r\n")
 )
 
 // Protocol implements network specific features.
@@ -22,6 +34,9 @@ type Protocol interface {
 	Streamed() bool
 	Listen(target *Target, options ...ListenOption) error
 	Send(target *Target, msg sip.Message) error
+	// SendContext is like Send but address resolution, connection dial and message write
+	// are interrupted when the context is done, ContextError is returned in this case.
+	SendContext(ctx context.Context, target *Target, msg sip.Message) error
 	String() string
 }
 
@@ -0,0 +1,396 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// ProxyProtocol enables HAProxy PROXY protocol (v1 and v2) on TCP, TLS and WS listeners,
+// so the real client address replaces the address of the load balancer in front of the listener.
+type ProxyProtocol struct {
+	// Required closes accepted connections that don't start with PROXY header.
+	Required bool
+	// TrustedProxies limits PROXY headers to connections from these networks.
+	// Headers are accepted from any source if empty.
+	TrustedProxies []*net.IPNet
+	// Timeout of reading PROXY header, defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+func (o ProxyProtocol) ApplyListen(opts *ListenOptions) {
+	opts.ProxyProtocol = &ProxyProtocol{
+		Required:       o.Required,
+		TrustedProxies: o.TrustedProxies,
+		Timeout:        o.Timeout,
+	}
+}
+
+// ProxyHeader is a PROXY protocol header received from the load balancer.
+type ProxyHeader struct {
+	Version int
+	// Source is an address of the real client, nil for LOCAL command and UNKNOWN protocol.
+	Source net.Addr
+	// Destination is an address the client connected to, nil for LOCAL command and UNKNOWN protocol.
+	Destination net.Addr
+	// Authority is a host name requested by the client (v2 only).
+	Authority string
+	// TLS describes TLS connection terminated on the load balancer (v2 only).
+	TLS *ProxyTLSInfo
+}
+
+func (hdr *ProxyHeader) String() string {
+	if hdr == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("transport.ProxyHeader<v%d %v -> %v>", hdr.Version, hdr.Source, hdr.Destination)
+}
+
+// ProxyTLSInfo holds TLS details of PROXY v2 header.
+type ProxyTLSInfo struct {
+	Version    string
+	CommonName string
+	Cipher     string
+	// ClientCert reports that the client presented a certificate.
+	ClientCert bool
+	// Verified reports that the client certificate was successfully verified.
+	Verified bool
+}
+
+type proxyHeaderKey struct{}
+
+// GetProxyHeader returns PROXY header of the connection the message was received on.
+func GetProxyHeader(msg sip.Message) (*ProxyHeader, bool) {
+	hdr, ok := sip.MessageMetadata(msg).Value(proxyHeaderKey{}).(*ProxyHeader)
+	return hdr, ok
+}
+
+func setProxyHeader(msg sip.Message, hdr *ProxyHeader) {
+	sip.MessageMetadata(msg).SetValue(proxyHeaderKey{}, hdr)
+}
+
+// Default timeout of reading PROXY header.
+var proxyHeaderTimeout = 5 * time.Second
+
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107
+
+	proxyV2HeaderLength = 16
+
+	proxyV2CmdLocal = 0x0
+	proxyV2CmdProxy = 0x1
+
+	proxyV2FamInet  = 0x1
+	proxyV2FamInet6 = 0x2
+
+	proxyV2TypeAuthority = 0x02
+	proxyV2TypeSSL       = 0x20
+	proxyV2SubtypeSSLVer = 0x21
+	proxyV2SubtypeSSLCN  = 0x22
+	proxyV2SubtypeCipher = 0x23
+
+	proxyV2ClientSSL      = 0x01
+	proxyV2ClientCertConn = 0x02
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyReader reads PROXY headers of the accepted connections.
+type proxyReader struct {
+	opts *ProxyProtocol
+	log  log.Logger
+}
+
+func newProxyListener(ls net.Listener, opts *ProxyProtocol, logger log.Logger) net.Listener {
+	r := &proxyReader{
+		opts: opts,
+		log:  logger,
+	}
+	return newAsyncListener(ls, r.read)
+}
+
+func (r *proxyReader) read(conn net.Conn) net.Conn {
+	if !r.trusted(conn.RemoteAddr()) {
+		if r.opts.Required {
+			r.log.Warnf("connection from untrusted proxy %s is forbidden, close it", conn.RemoteAddr())
+			conn.Close()
+			return nil
+		}
+		return conn
+	}
+
+	timeout := r.opts.Timeout
+	if timeout <= 0 {
+		timeout = proxyHeaderTimeout
+	}
+
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	hdr, err := readProxyHeader(reader)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		r.log.Warnf("read PROXY header from %s failed: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		return nil
+	}
+	if hdr == nil && r.opts.Required {
+		r.log.Warnf("connection from %s without PROXY header is forbidden, close it", conn.RemoteAddr())
+		conn.Close()
+		return nil
+	}
+
+	return &proxyConn{
+		peekedConn: peekedConn{Conn: conn, reader: reader},
+		header:     hdr,
+	}
+}
+
+func (r *proxyReader) trusted(addr net.Addr) bool {
+	if len(r.opts.TrustedProxies) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range r.opts.TrustedProxies {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConn reports the client address from PROXY header as the remote address.
+type proxyConn struct {
+	peekedConn
+	header *ProxyHeader
+}
+
+func (conn *proxyConn) RemoteAddr() net.Addr {
+	if conn.header != nil && conn.header.Source != nil {
+		return conn.header.Source
+	}
+	return conn.Conn.RemoteAddr()
+}
+
+// proxyHeaderOf looks for PROXY header through the connection wrappers.
+func proxyHeaderOf(conn net.Conn) *ProxyHeader {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *proxyConn:
+			return c.header
+		case *peekedConn:
+			conn = c.Conn
+		case *wsConn:
+			conn = c.Conn
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// readProxyHeader returns nil header if the stream doesn't start with PROXY header.
+func readProxyHeader(reader *bufio.Reader) (*ProxyHeader, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case proxyV1Prefix[0]:
+		prefix, err := reader.Peek(len(proxyV1Prefix))
+		if err != nil || string(prefix) != proxyV1Prefix {
+			return nil, nil
+		}
+		return readProxyHeaderV1(reader)
+	case proxyV2Signature[0]:
+		// stream may start with CRLF keep-alive shorter than the signature
+		sig, err := reader.Peek(len(proxyV2Signature))
+		if err != nil || !bytes.Equal(sig, proxyV2Signature) {
+			return nil, nil
+		}
+		return readProxyHeaderV2(reader)
+	default:
+		return nil, nil
+	}
+}
+
+func readProxyHeaderV1(reader *bufio.Reader) (*ProxyHeader, error) {
+	line := make([]byte, 0, proxyV1MaxLength)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) == proxyV1MaxLength {
+			return nil, fmt.Errorf("PROXY v1 header exceeds %d bytes", proxyV1MaxLength)
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("PROXY v1 header must end with CRLF")
+	}
+
+	hdr := &ProxyHeader{Version: 1}
+	fields := strings.Split(string(line[len(proxyV1Prefix):len(line)-2]), " ")
+	switch fields[0] {
+	case "UNKNOWN":
+		return hdr, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v1 protocol %q", fields[0])
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", line)
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[1]), net.ParseIP(fields[2])
+	if srcIP == nil || dstIP == nil {
+		return nil, fmt.Errorf("malformed PROXY v1 addresses %q", line)
+	}
+	srcPort, err := strconv.ParseUint(fields[3], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("malformed PROXY v1 source port: %w", err)
+	}
+	dstPort, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("malformed PROXY v1 destination port: %w", err)
+	}
+
+	hdr.Source = &net.TCPAddr{IP: srcIP, Port: int(srcPort)}
+	hdr.Destination = &net.TCPAddr{IP: dstIP, Port: int(dstPort)}
+	return hdr, nil
+}
+
+func readProxyHeaderV2(reader *bufio.Reader) (*ProxyHeader, error) {
+	head := make([]byte, proxyV2HeaderLength)
+	if _, err := io.ReadFull(reader, head); err != nil {
+		return nil, err
+	}
+	if version := head[12] >> 4; version != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", version)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(head[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	hdr := &ProxyHeader{Version: 2}
+	switch cmd := head[12] & 0x0F; cmd {
+	case proxyV2CmdLocal:
+		return hdr, nil
+	case proxyV2CmdProxy:
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v2 command %d", cmd)
+	}
+
+	var ipLen int
+	switch fam := head[13] >> 4; fam {
+	case proxyV2FamInet:
+		ipLen = net.IPv4len
+	case proxyV2FamInet6:
+		ipLen = net.IPv6len
+	default:
+		// UNSPEC and UNIX addresses are ignored, the connection address is kept
+		return hdr, nil
+	}
+	addrLen := 2*ipLen + 4
+	if len(payload) < addrLen {
+		return nil, fmt.Errorf("PROXY v2 address block is too short")
+	}
+
+	hdr.Source = &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	hdr.Destination = &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+
+	err := walkProxyTLVs(payload[addrLen:], func(typ byte, value []byte) error {
+		switch typ {
+		case proxyV2TypeAuthority:
+			hdr.Authority = string(value)
+		case proxyV2TypeSSL:
+			info, err := parseProxySSL(value)
+			if err != nil {
+				return err
+			}
+			hdr.TLS = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hdr, nil
+}
+
+func parseProxySSL(value []byte) (*ProxyTLSInfo, error) {
+	if len(value) < 5 {
+		return nil, fmt.Errorf("PROXY v2 SSL TLV is too short")
+	}
+
+	client := value[0]
+	if client&proxyV2ClientSSL == 0 {
+		return nil, nil
+	}
+
+	info := &ProxyTLSInfo{
+		ClientCert: client&proxyV2ClientCertConn != 0,
+	}
+	info.Verified = info.ClientCert && binary.BigEndian.Uint32(value[1:5]) == 0
+
+	err := walkProxyTLVs(value[5:], func(typ byte, value []byte) error {
+		switch typ {
+		case proxyV2SubtypeSSLVer:
+			info.Version = string(value)
+		case proxyV2SubtypeSSLCN:
+			info.CommonName = string(value)
+		case proxyV2SubtypeCipher:
+			info.Cipher = string(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func walkProxyTLVs(data []byte, fn func(typ byte, value []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return fmt.Errorf("PROXY v2 TLV is too short")
+		}
+		length := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+length {
+			return fmt.Errorf("PROXY v2 TLV 0x%02x exceeds header length", data[0])
+		}
+		if err := fn(data[0], data[3:3+length]); err != nil {
+			return err
+		}
+		data = data[3+length:]
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package transport_test
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("ProxyProtocol", func() {
+	var tpl transport.Layer
+
+	localAddr := "127.0.0.1:9072"
+	logger := testutils.NewLogrusLogger()
+	msg := "OPTIONS sip:bob@far-far-away.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/TCP pc33.far-far-away.com;branch=z9hG4bK776asdhds\r\n" +
+		"To: \"Bob\" <sip:bob@far-far-away.com>\r\n" +
+		"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774\r\n" +
+		"Call-ID: a84b4c76e66710\r\n" +
+		"CSeq: 1 OPTIONS\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+	proxyV2 := func(tlvs []byte) []byte {
+		addrs := []byte{
+			203, 0, 113, 7,
+			127, 0, 0, 1,
+			0x9c, 0x40, // 40000
+			0x23, 0x70, // 9072
+		}
+		buf := append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x21, 0x11, 0, 0)
+		binary.BigEndian.PutUint16(buf[14:], uint16(len(addrs)+len(tlvs)))
+		return append(append(buf, addrs...), tlvs...)
+	}
+	tlv := func(typ byte, value []byte) []byte {
+		return append([]byte{typ, byte(len(value) >> 8), byte(len(value))}, value...)
+	}
+
+	BeforeEach(func() {
+		tpl = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger)
+	})
+	AfterEach(func(done Done) {
+		tpl.Cancel()
+		<-tpl.Done()
+		close(done)
+	}, 3)
+
+	send := func(addr string, data []byte) net.Conn {
+		conn, err := net.Dial("tcp", addr)
+		Expect(err).ToNot(HaveOccurred())
+		testutils.WriteToConn(conn, data)
+		return conn
+	}
+
+	Context("when PROXY header is optional", func() {
+		BeforeEach(func() {
+			Expect(tpl.Listen("tcp", localAddr, transport.ProxyProtocol{})).To(Succeed())
+			time.Sleep(100 * time.Millisecond)
+		})
+
+		It("should use client address from PROXY v1 header", func() {
+			conn := send(localAddr, []byte("PROXY TCP4 203.0.113.7 127.0.0.1 40000 9072\r\n"+msg))
+			defer conn.Close()
+
+			var in sip.Message
+			Eventually(tpl.Messages(), 3*time.Second).Should(Receive(&in))
+			Expect(in.Source()).To(Equal("203.0.113.7:40000"))
+			viaHop, ok := in.ViaHop()
+			Expect(ok).To(BeTrue())
+			received, ok := viaHop.Params.Get("received")
+			Expect(ok).To(BeTrue())
+			Expect(received.String()).To(Equal("203.0.113.7"))
+
+			hdr, ok := transport.GetProxyHeader(in)
+			Expect(ok).To(BeTrue())
+			Expect(hdr.Version).To(Equal(1))
+			Expect(hdr.Destination.String()).To(Equal("127.0.0.1:9072"))
+		})
+
+		It("should use client address and TLS info from PROXY v2 header", func() {
+			ssl := append([]byte{0x01, 0, 0, 0, 0}, tlv(0x21, []byte("TLSv1.3"))...)
+			data := proxyV2(append(tlv(0x02, []byte("example.com")), tlv(0x20, ssl)...))
+			conn := send(localAddr, append(data, msg...))
+			defer conn.Close()
+
+			var in sip.Message
+			Eventually(tpl.Messages(), 3*time.Second).Should(Receive(&in))
+			Expect(in.Source()).To(Equal("203.0.113.7:40000"))
+
+			hdr, ok := transport.GetProxyHeader(in)
+			Expect(ok).To(BeTrue())
+			Expect(hdr.Version).To(Equal(2))
+			Expect(hdr.Authority).To(Equal("example.com"))
+			Expect(hdr.TLS).ToNot(BeNil())
+			Expect(hdr.TLS.Version).To(Equal("TLSv1.3"))
+			Expect(hdr.TLS.ClientCert).To(BeFalse())
+		})
+
+		It("should serve connections without PROXY header", func() {
+			conn := send(localAddr, []byte(msg))
+			defer conn.Close()
+
+			var in sip.Message
+			Eventually(tpl.Messages(), 3*time.Second).Should(Receive(&in))
+			Expect(in.Source()).To(Equal(conn.LocalAddr().String()))
+			_, ok := transport.GetProxyHeader(in)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("when PROXY header is required", func() {
+		requiredAddr := "127.0.0.1:9073"
+
+		BeforeEach(func() {
+			Expect(tpl.Listen("tcp", requiredAddr, transport.ProxyProtocol{Required: true})).To(Succeed())
+			time.Sleep(100 * time.Millisecond)
+		})
+
+		It("should close connections without PROXY header", func() {
+			conn := send(requiredAddr, []byte(msg))
+			defer conn.Close()
+
+			Expect(conn.SetReadDeadline(time.Now().Add(3 * time.Second))).To(Succeed())
+			_, err := conn.Read(make([]byte, 1))
+			Expect(err).To(HaveOccurred())
+			Consistently(tpl.Messages(), 200*time.Millisecond).ShouldNot(Receive())
+		})
+	})
+
+	Context("when proxy is not trusted", func() {
+		trustedAddr := "127.0.0.1:9074"
+
+		BeforeEach(func() {
+			_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+			opt := transport.ProxyProtocol{Required: true, TrustedProxies: []*net.IPNet{trusted}}
+			Expect(tpl.Listen("tcp", trustedAddr, opt)).To(Succeed())
+			time.Sleep(100 * time.Millisecond)
+		})
+
+		It("should close connections with PROXY header", func() {
+			conn := send(trustedAddr, []byte("PROXY TCP4 203.0.113.7 127.0.0.1 40000 9072\r\n"+msg))
+			defer conn.Close()
+
+			Expect(conn.SetReadDeadline(time.Now().Add(3 * time.Second))).To(Succeed())
+			_, err := conn.Read(make([]byte, 1))
+			Expect(err).To(HaveOccurred())
+			Consistently(tpl.Messages(), 200*time.Millisecond).ShouldNot(Receive())
+		})
+	})
+})
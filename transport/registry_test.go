@@ -0,0 +1,135 @@
+package transport_test
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+// pipeProtocol is a custom protocol recording sent messages.
+type pipeProtocol struct {
+	done    chan struct{}
+	mu      sync.Mutex
+	targets []*transport.Target
+	sent    []sip.Message
+}
+
+func (p *pipeProtocol) Done() <-chan struct{} { return p.done }
+func (p *pipeProtocol) Network() string       { return "X-PIPE" }
+func (p *pipeProtocol) Reliable() bool        { return true }
+func (p *pipeProtocol) Streamed() bool        { return true }
+func (p *pipeProtocol) String() string        { return "pipeProtocol" }
+
+func (p *pipeProtocol) Listen(target *transport.Target, options ...transport.ListenOption) error {
+	p.mu.Lock()
+	p.targets = append(p.targets, target)
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *pipeProtocol) Send(target *transport.Target, msg sip.Message) error {
+	return p.SendContext(context.Background(), target, msg)
+}
+
+func (p *pipeProtocol) SendContext(ctx context.Context, target *transport.Target, msg sip.Message) error {
+	p.mu.Lock()
+	p.sent = append(p.sent, msg)
+	p.mu.Unlock()
+	return nil
+}
+
+var _ = Describe("RegisterProtocol", func() {
+	var (
+		tpl  transport.Layer
+		pipe *pipeProtocol
+	)
+	logger := testutils.NewLogrusLogger()
+	request := "INVITE sip:bob@127.0.0.1;transport=x-pipe SIP/2.0\r\n" +
+		"Via: SIP/2.0/X-PIPE pc33.far-far-away.com;branch=z9hG4bK776asdhds\r\n" +
+		"To: \"Bob\" <sip:bob@far-far-away.com>\r\n" +
+		"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774\r\n" +
+		"Call-ID: cheesecake1729\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+
+	BeforeEach(func() {
+		pipe = &pipeProtocol{done: make(chan struct{})}
+		Expect(transport.RegisterProtocol(
+			sip.TransportProto{Network: "x-pipe", Reliable: true, Streamed: true, DefaultPort: 7000},
+			func(
+				network string,
+				output chan<- sip.Message,
+				errs chan<- error,
+				cancel <-chan struct{},
+				msgMapper sip.MessageMapper,
+				logger log.Logger,
+			) (transport.Protocol, error) {
+				go func() {
+					<-cancel
+					close(pipe.done)
+				}()
+				return pipe, nil
+			},
+		)).To(Succeed())
+		tpl = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger)
+	})
+	AfterEach(func(done Done) {
+		tpl.Cancel()
+		<-tpl.Done()
+		close(done)
+	}, 3)
+
+	It("should take traits of the protocol from the registry", func() {
+		Expect(tpl.IsReliable("X-PIPE")).To(BeTrue())
+		Expect(tpl.IsStreamed("x-pipe")).To(BeTrue())
+		Expect(sip.DefaultPort("X-PIPE")).To(Equal(sip.Port(7000)))
+	})
+
+	It("should send request through the protocol", func() {
+		msg, err := parser.ParseMessage([]byte(request), logger)
+		Expect(err).ToNot(HaveOccurred())
+		msg.SetDestination("127.0.0.1:7001")
+		Expect(tpl.Send(msg)).To(Succeed())
+
+		pipe.mu.Lock()
+		defer pipe.mu.Unlock()
+		Expect(pipe.sent).To(HaveLen(1))
+		hop, ok := pipe.sent[0].ViaHop()
+		Expect(ok).To(BeTrue())
+		Expect(hop.Transport).To(Equal("X-PIPE"))
+		Expect(hop.Port).ToNot(BeNil())
+		Expect(*hop.Port).To(Equal(sip.Port(7000)))
+	})
+
+	It("should listen with the protocol", func() {
+		Expect(tpl.Listen("x-pipe", "127.0.0.1:7002")).To(Succeed())
+
+		msg, err := parser.ParseMessage([]byte(request), logger)
+		Expect(err).ToNot(HaveOccurred())
+		msg.SetDestination("127.0.0.1:7001")
+		Expect(tpl.Send(msg)).To(Succeed())
+
+		pipe.mu.Lock()
+		defer pipe.mu.Unlock()
+		Expect(pipe.targets).To(HaveLen(1))
+		hop, _ := pipe.sent[0].ViaHop()
+		Expect(*hop.Port).To(Equal(sip.Port(7002)))
+	})
+
+	It("should not replace standard protocols", func() {
+		Expect(transport.RegisterProtocol(
+			sip.TransportProto{Network: "udp", DefaultPort: 5060},
+			transport.GetProtocolFactory(),
+		)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,365 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// ResolvedTarget is a transport address of the server resolved from SIP URI.
+type ResolvedTarget struct {
+	Network string
+	*Target
+}
+
+func (target *ResolvedTarget) String() string {
+	if target == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("%s %s", target.Network, target.Addr())
+}
+
+// NAPTR services of the transports - RFC 3263 4.1, RFC 7118 7.
+var naptrServices = map[string]string{
+	"SIP+D2U":  "UDP",
+	"SIP+D2T":  "TCP",
+	"SIPS+D2T": "TLS",
+	"SIP+D2W":  "WS",
+	"SIPS+D2W": "WSS",
+}
+
+// Resolver locates SIP servers of the URI with NAPTR, SRV and A/AAAA lookups - RFC 3263 4.
+// Lookup results are cached for the records TTL.
+type Resolver struct {
+	lookup     DNSLookup
+	transports []string
+
+	mu    sync.Mutex
+	cache map[string]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewResolver creates resolver of servers reachable over the transports listed in the order of preference,
+// default transports are UDP, TCP and TLS.
+func NewResolver(lookup DNSLookup, transports ...string) *Resolver {
+	if len(transports) == 0 {
+		transports = []string{"UDP", "TCP", "TLS"}
+	}
+	for i := range transports {
+		transports[i] = sip.TokenUpper(transports[i])
+	}
+
+	return &Resolver{
+		lookup:     lookup,
+		transports: transports,
+		cache:      make(map[string]dnsCacheEntry),
+	}
+}
+
+// Resolve returns servers of the URI in the order they should be tried - RFC 3263 4.
+// Transport is taken from the URI 'transport' parameter, otherwise it is selected with NAPTR records,
+// then with SRV records of the supported transports, UDP (TLS for SIPS URI) is used if there are no records.
+// Servers of SRV records are ordered by priority and weight - RFC 2782.
+func (r *Resolver) Resolve(ctx context.Context, uri sip.Uri) ([]*ResolvedTarget, error) {
+	host := uri.Host()
+	secure := uri.IsEncrypted()
+
+	var network string
+	if params := uri.UriParams(); params != nil {
+		if maddr, ok := params.Get("maddr"); ok && maddr != nil && maddr.String() != "" {
+			host = maddr.String()
+		}
+		if tp, ok := params.Get("transport"); ok && tp != nil && tp.String() != "" {
+			network = sip.TokenUpper(tp.String())
+		}
+	}
+	if secure {
+		switch network {
+		case "TCP":
+			network = "TLS"
+		case "WS":
+			network = "WSS"
+		}
+	}
+	defaultNetwork := "UDP"
+	if secure {
+		defaultNetwork = "TLS"
+	}
+
+	// numeric IP address or explicit port - RFC 3263 4.1, 4.2
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil || uri.Port() != nil {
+		if network == "" {
+			network = defaultNetwork
+		}
+		port := sip.DefaultPort(network)
+		if uri.Port() != nil {
+			port = *uri.Port()
+		}
+		if ip != nil {
+			return []*ResolvedTarget{newResolvedTarget(network, ip, port)}, nil
+		}
+		return r.resolveHost(ctx, network, host, port)
+	}
+
+	if network != "" {
+		if targets, err := r.resolveSRV(ctx, network, host); err == nil && len(targets) > 0 {
+			return targets, nil
+		}
+		return r.resolveHost(ctx, network, host, sip.DefaultPort(network))
+	}
+
+	if targets := r.resolveNAPTR(ctx, host, secure); len(targets) > 0 {
+		return targets, nil
+	}
+
+	// no NAPTR records - SRV records of the supported transports are used
+	targets := make([]*ResolvedTarget, 0)
+	for _, network := range r.transports {
+		if proto, ok := sip.LookupTransportProto(network); secure && (!ok || !proto.Secure) {
+			continue
+		}
+		if srvTargets, err := r.resolveSRV(ctx, network, host); err == nil {
+			targets = append(targets, srvTargets...)
+		}
+	}
+	if len(targets) > 0 {
+		return targets, nil
+	}
+
+	return r.resolveHost(ctx, defaultNetwork, host, sip.DefaultPort(defaultNetwork))
+}
+
+// NextHop returns URI of the next hop of the request: the URI of the top Route or the Request-URI - RFC 3261 8.1.2.
+// ok is false if the request destination is set explicitly and differs from the URI address.
+func NextHop(req sip.Request) (uri sip.Uri, ok bool) {
+	uri = req.Recipient()
+	if hdrs := req.GetHeaders("Route"); len(hdrs) > 0 {
+		if route, ok := hdrs[0].(*sip.RouteHeader); ok && len(route.Addresses) > 0 {
+			uri = route.Addresses[0]
+		}
+	}
+	if uri == nil {
+		return nil, false
+	}
+
+	host, portStr, err := net.SplitHostPort(req.Destination())
+	if err != nil {
+		return uri, false
+	}
+	port := sip.DefaultPort(req.Transport())
+	if uri.Port() != nil {
+		port = *uri.Port()
+	}
+	if portStr != strconv.Itoa(int(port)) {
+		return uri, false
+	}
+
+	uriHost := strings.Trim(uri.Host(), "[]")
+	if ip := net.ParseIP(host); ip != nil {
+		return uri, ip.Equal(net.ParseIP(uriHost))
+	}
+	return uri, sip.TokenEqual(host, uriHost)
+}
+
+func (r *Resolver) supports(network string) bool {
+	for _, tp := range r.transports {
+		if tp == network {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Resolver) resolveNAPTR(ctx context.Context, host string, secure bool) []*ResolvedTarget {
+	value, err := r.cached("NAPTR "+host, func() (interface{}, time.Duration, error) {
+		return r.lookup.LookupNAPTR(ctx, host)
+	})
+	if err != nil {
+		return nil
+	}
+
+	records := make([]*NAPTR, 0)
+	for _, rr := range value.([]*NAPTR) {
+		network, ok := naptrServices[sip.TokenUpper(rr.Service)]
+		if !ok || !sip.TokenEqual(rr.Flags, "s") || !r.supports(network) {
+			continue
+		}
+		if secure && !strings.HasPrefix(sip.TokenUpper(rr.Service), "SIPS+") {
+			continue
+		}
+		records = append(records, rr)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Order != records[j].Order {
+			return records[i].Order < records[j].Order
+		}
+		return records[i].Preference < records[j].Preference
+	})
+
+	targets := make([]*ResolvedTarget, 0)
+	for _, rr := range records {
+		network := naptrServices[sip.TokenUpper(rr.Service)]
+		srvs, err := r.lookupSRV(ctx, rr.Replacement)
+		if err != nil {
+			continue
+		}
+		targets = append(targets, r.resolveSRVTargets(ctx, network, srvs)...)
+	}
+	return targets
+}
+
+func (r *Resolver) resolveSRV(ctx context.Context, network, host string) ([]*ResolvedTarget, error) {
+	var name string
+	switch network {
+	case "UDP":
+		name = "_sip._udp." + host
+	case "TCP":
+		name = "_sip._tcp." + host
+	case "TLS":
+		name = "_sips._tcp." + host
+	case "WS":
+		name = "_sip._ws." + host
+	case "WSS":
+		name = "_sips._ws." + host
+	default:
+		// registered protocols are looked up by the transport token - RFC 3263 4.1
+		proto, ok := sip.LookupTransportProto(network)
+		if !ok {
+			return nil, UnsupportedProtocolError(fmt.Sprintf("protocol %s is not supported", network))
+		}
+		name = "_sip._" + sip.TokenLower(proto.ViaToken) + "." + host
+	}
+
+	srvs, err := r.lookupSRV(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return r.resolveSRVTargets(ctx, network, srvs), nil
+}
+
+func (r *Resolver) lookupSRV(ctx context.Context, name string) ([]*net.SRV, error) {
+	name = dnsFQDN(name)
+	value, err := r.cached("SRV "+name, func() (interface{}, time.Duration, error) {
+		// records of the name are looked up directly, like net.LookupSRV does with empty service and proto
+		return r.lookup.LookupSRV(ctx, "", "", name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]*net.SRV), nil
+}
+
+func (r *Resolver) resolveSRVTargets(ctx context.Context, network string, srvs []*net.SRV) []*ResolvedTarget {
+	targets := make([]*ResolvedTarget, 0)
+	for _, srv := range orderSRV(srvs) {
+		// target '.' means that the service is not available - RFC 2782
+		host := strings.TrimSuffix(srv.Target, ".")
+		if host == "" {
+			continue
+		}
+		if hostTargets, err := r.resolveHost(ctx, network, host, sip.Port(srv.Port)); err == nil {
+			targets = append(targets, hostTargets...)
+		}
+	}
+	return targets
+}
+
+func (r *Resolver) resolveHost(ctx context.Context, network, host string, port sip.Port) ([]*ResolvedTarget, error) {
+	value, err := r.cached("A "+host, func() (interface{}, time.Duration, error) {
+		return r.lookup.LookupIPAddr(ctx, host)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("resolve host %s: %w", host, err)
+	}
+
+	addrs := value.([]net.IPAddr)
+	targets := make([]*ResolvedTarget, 0, len(addrs))
+	for _, addr := range addrs {
+		targets = append(targets, newResolvedTarget(network, addr.IP, port))
+	}
+	return targets, nil
+}
+
+// Returns cached result of the lookup or performs the lookup and caches result for the returned TTL.
+// Failed lookups are not cached.
+func (r *Resolver) cached(key string, lookup func() (interface{}, time.Duration, error)) (interface{}, error) {
+	r.mu.Lock()
+	entry, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, ttl, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[key] = dnsCacheEntry{value, time.Now().Add(ttl)}
+	r.mu.Unlock()
+
+	return value, nil
+}
+
+func newResolvedTarget(network string, ip net.IP, port sip.Port) *ResolvedTarget {
+	host := ip.String()
+	if ip.To4() == nil {
+		host = fmt.Sprintf("[%s]", host)
+	}
+	return &ResolvedTarget{network, &Target{Host: host, Port: &port}}
+}
+
+// Orders SRV records by priority, records with the same priority are ordered
+// by weighted random selection - RFC 2782.
+func orderSRV(srvs []*net.SRV) []*net.SRV {
+	sorted := make([]*net.SRV, len(srvs))
+	copy(sorted, srvs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+
+		group := sorted[start:end]
+		for i := range group {
+			total := 0
+			for _, srv := range group[i:] {
+				total += int(srv.Weight)
+			}
+			if total == 0 {
+				break
+			}
+
+			n := rand.Intn(total + 1)
+			for j, srv := range group[i:] {
+				n -= int(srv.Weight)
+				if n <= 0 {
+					group[i], group[i+j] = group[i+j], group[i]
+					break
+				}
+			}
+		}
+
+		start = end
+	}
+
+	return sorted
+}
@@ -0,0 +1,130 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+type fakeDNSLookup struct {
+	naptr   map[string][]*transport.NAPTR
+	srv     map[string][]*net.SRV
+	ip      map[string][]net.IPAddr
+	queries []string
+}
+
+func (l *fakeDNSLookup) LookupNAPTR(ctx context.Context, name string) ([]*transport.NAPTR, time.Duration, error) {
+	l.queries = append(l.queries, "NAPTR "+name)
+	return l.naptr[name], time.Minute, nil
+}
+
+func (l *fakeDNSLookup) LookupSRV(ctx context.Context, service, proto, name string) ([]*net.SRV, time.Duration, error) {
+	l.queries = append(l.queries, "SRV "+name)
+	if srvs, ok := l.srv[name]; ok {
+		return srvs, time.Minute, nil
+	}
+	return nil, 0, errors.New("no such host")
+}
+
+func (l *fakeDNSLookup) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	l.queries = append(l.queries, "A "+host)
+	if addrs, ok := l.ip[host]; ok {
+		return addrs, time.Minute, nil
+	}
+	return nil, 0, errors.New("no such host")
+}
+
+var _ = Describe("Resolver", func() {
+	var (
+		lookup   *fakeDNSLookup
+		resolver *transport.Resolver
+	)
+
+	resolve := func(uri string) []string {
+		u, err := parser.ParseUri(uri)
+		Expect(err).ToNot(HaveOccurred())
+		targets, err := resolver.Resolve(context.Background(), u)
+		Expect(err).ToNot(HaveOccurred())
+		addrs := make([]string, 0, len(targets))
+		for _, target := range targets {
+			addrs = append(addrs, target.String())
+		}
+		return addrs
+	}
+
+	BeforeEach(func() {
+		lookup = &fakeDNSLookup{
+			naptr: map[string][]*transport.NAPTR{
+				"example.com": {
+					{Order: 50, Preference: 50, Flags: "s", Service: "SIP+D2U", Replacement: "_sip._udp.example.com."},
+					{Order: 20, Preference: 50, Flags: "s", Service: "SIP+D2T", Replacement: "_sip._tcp.example.com."},
+					{Order: 10, Preference: 50, Flags: "s", Service: "SIPS+D2T", Replacement: "_sips._tcp.example.com."},
+				},
+			},
+			srv: map[string][]*net.SRV{
+				"_sip._udp.example.com.": {
+					{Target: "sip2.example.com.", Port: 5060, Priority: 20},
+					{Target: "sip1.example.com.", Port: 5060, Priority: 10},
+				},
+				"_sip._tcp.example.com.": {
+					{Target: "sip1.example.com.", Port: 5060, Priority: 10},
+				},
+				"_sip._udp.example.org.": {
+					{Target: "sip.example.org.", Port: 5080, Priority: 10},
+				},
+			},
+			ip: map[string][]net.IPAddr{
+				"sip1.example.com": {{IP: net.ParseIP("10.0.0.1")}},
+				"sip2.example.com": {{IP: net.ParseIP("10.0.0.2")}, {IP: net.ParseIP("fd00::2")}},
+				"sip.example.org":  {{IP: net.ParseIP("10.0.1.1")}},
+				"example.net":      {{IP: net.ParseIP("10.0.2.1")}},
+			},
+		}
+		resolver = transport.NewResolver(lookup, "udp", "tcp")
+	})
+
+	It("should select transport with NAPTR records and order SRV records by priority", func() {
+		Expect(resolve("sip:bob@example.com")).To(Equal([]string{
+			"TCP 10.0.0.1:5060",
+			"UDP 10.0.0.1:5060",
+			"UDP 10.0.0.2:5060",
+			"UDP [fd00::2]:5060",
+		}))
+	})
+
+	It("should query SRV records of the supported transports without NAPTR records", func() {
+		Expect(resolve("sip:bob@example.org")).To(Equal([]string{"UDP 10.0.1.1:5080"}))
+	})
+
+	It("should resolve A/AAAA records without NAPTR and SRV records", func() {
+		Expect(resolve("sip:bob@example.net")).To(Equal([]string{"UDP 10.0.2.1:5060"}))
+	})
+
+	It("should use transport of the URI", func() {
+		Expect(resolve("sip:bob@example.com;transport=tcp")).To(Equal([]string{"TCP 10.0.0.1:5060"}))
+		Expect(resolve("sip:bob@sip2.example.com;transport=tcp")).To(Equal([]string{
+			"TCP 10.0.0.2:5060",
+			"TCP [fd00::2]:5060",
+		}))
+	})
+
+	It("should not query NAPTR and SRV records of URI with port or IP address", func() {
+		Expect(resolve("sip:bob@sip1.example.com:5070")).To(Equal([]string{"UDP 10.0.0.1:5070"}))
+		Expect(resolve("sips:bob@10.0.0.5")).To(Equal([]string{"TLS 10.0.0.5:5061"}))
+		Expect(lookup.queries).To(Equal([]string{"A sip1.example.com"}))
+	})
+
+	It("should cache lookup results", func() {
+		first := resolve("sip:bob@example.com")
+		queries := len(lookup.queries)
+		Expect(resolve("sip:bob@example.com")).To(ConsistOf(first))
+		Expect(lookup.queries).To(HaveLen(queries))
+	})
+})
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/ghettovoice/gosip/log"
+)
+
+// TLSSniffing enables detection of TLS ClientHello on connections accepted by TCP listener,
+// so plaintext SIP and TLS can be served on the same port. TLSConfig option is required.
+type TLSSniffing struct {
+	// ForbidPlaintext closes accepted connections that don't start with TLS handshake.
+	ForbidPlaintext bool
+}
+
+func (o TLSSniffing) ApplyListen(opts *ListenOptions) {
+	opts.TLSSniffing = &TLSSniffing{
+		ForbidPlaintext: o.ForbidPlaintext,
+	}
+}
+
+// passes TLS connections detected by the sniffing TCP listener to the TLS protocol
+type tlsHandoff func(conn net.Conn)
+
+func (o tlsHandoff) ApplyListen(opts *ListenOptions) {
+	opts.tlsHandoff = o
+}
+
+// Max time to wait the first byte of the accepted connection.
+var sniffTimeout = 5 * time.Second
+
+// First byte of TLS handshake record.
+const tlsHandshakeRecord = 0x16
+
+// tlsSniffer detects protocol of the accepted connections by the first byte.
+type tlsSniffer struct {
+	config          *tls.Config
+	forbidPlaintext bool
+	handoff         tlsHandoff
+	log             log.Logger
+}
+
+func newSniffListener(
+	ls net.Listener,
+	config *tls.Config,
+	opts *TLSSniffing,
+	handoff tlsHandoff,
+	logger log.Logger,
+) net.Listener {
+	s := &tlsSniffer{
+		config:          config,
+		forbidPlaintext: opts.ForbidPlaintext,
+		handoff:         handoff,
+		log:             logger,
+	}
+	return newAsyncListener(ls, s.sniff)
+}
+
+func (s *tlsSniffer) sniff(conn net.Conn) net.Conn {
+	reader := bufio.NewReader(conn)
+
+	_ = conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	first, err := reader.Peek(1)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		s.log.Debugf("sniff connection from %s failed: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		return nil
+	}
+
+	conn = &peekedConn{Conn: conn, reader: reader}
+	if first[0] == tlsHandshakeRecord {
+		tlsConn := tls.Server(conn, s.config)
+		if s.handoff != nil {
+			s.handoff(tlsConn)
+			return nil
+		}
+		return tlsConn
+	}
+	if s.forbidPlaintext {
+		s.log.Warnf("plaintext connection from %s is forbidden, close it", conn.RemoteAddr())
+		conn.Close()
+		return nil
+	}
+	return conn
+}
+
+// peekedConn reads data buffered while sniffing before the rest of connection data.
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (conn *peekedConn) Read(b []byte) (int, error) {
+	return conn.reader.Read(b)
+}
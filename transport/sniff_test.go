@@ -0,0 +1,97 @@
+package transport_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("TLSSniffing", func() {
+	var tpl transport.Layer
+
+	rootDir := testutils.GetProjectRootPath("gosip")
+	localAddr := "127.0.0.1:9071"
+	srvTlsConf := transport.TLSConfig{
+		Cert: filepath.Join(rootDir, "/examples/certs/server.pem"),
+		Key:  filepath.Join(rootDir, "/examples/certs/server-key.pem"),
+	}
+	// certificate verification is out of scope here, example certificates may be expired
+	clTlsConf := &tls.Config{
+		InsecureSkipVerify: true,
+	}
+	logger := testutils.NewLogrusLogger()
+	newMsg := func(network string) string {
+		return "OPTIONS sip:bob@far-far-away.com SIP/2.0\r\n" +
+			"Via: SIP/2.0/" + network + " pc33.far-far-away.com;branch=z9hG4bK776asdhds\r\n" +
+			"To: \"Bob\" <sip:bob@far-far-away.com>\r\n" +
+			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774\r\n" +
+			"Call-ID: a84b4c76e66710\r\n" +
+			"CSeq: 1 OPTIONS\r\n" +
+			"Content-Length: 0\r\n" +
+			"\r\n"
+	}
+
+	BeforeEach(func() {
+		tpl = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger)
+	})
+	AfterEach(func(done Done) {
+		tpl.Cancel()
+		<-tpl.Done()
+		close(done)
+	}, 3)
+
+	Context("when plaintext is allowed", func() {
+		BeforeEach(func() {
+			Expect(tpl.Listen("tcp", localAddr, srvTlsConf, transport.TLSSniffing{})).To(Succeed())
+			time.Sleep(100 * time.Millisecond)
+		})
+
+		It("should serve plaintext and TLS connections on the same port", func() {
+			plain, err := net.Dial("tcp", localAddr)
+			Expect(err).ToNot(HaveOccurred())
+			defer plain.Close()
+			testutils.WriteToConn(plain, []byte(newMsg("TCP")))
+
+			var msg sip.Message
+			Eventually(tpl.Messages(), 3*time.Second).Should(Receive(&msg))
+			Expect(msg.Transport()).To(Equal("TCP"))
+
+			secure, err := tls.Dial("tcp", localAddr, clTlsConf)
+			Expect(err).ToNot(HaveOccurred())
+			defer secure.Close()
+			testutils.WriteToConn(secure, []byte(newMsg("TLS")))
+
+			Eventually(tpl.Messages(), 3*time.Second).Should(Receive(&msg))
+			Expect(msg.Transport()).To(Equal("TLS"))
+		})
+	})
+
+	Context("when plaintext is forbidden", func() {
+		BeforeEach(func() {
+			Expect(tpl.Listen("tcp", localAddr, srvTlsConf, transport.TLSSniffing{ForbidPlaintext: true})).To(Succeed())
+			time.Sleep(100 * time.Millisecond)
+		})
+
+		It("should close plaintext connections", func() {
+			plain, err := net.Dial("tcp", localAddr)
+			Expect(err).ToNot(HaveOccurred())
+			defer plain.Close()
+			testutils.WriteToConn(plain, []byte(newMsg("TCP")))
+
+			Expect(plain.SetReadDeadline(time.Now().Add(3 * time.Second))).To(Succeed())
+			_, err = plain.Read(make([]byte, 1))
+			Expect(err).To(HaveOccurred())
+			Expect(fmt.Sprint(err)).ToNot(ContainSubstring("timeout"))
+			Consistently(tpl.Messages(), 200*time.Millisecond).ShouldNot(Receive())
+		})
+	})
+})
@@ -1,9 +1,13 @@
 package transport
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
 	"net"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
@@ -25,8 +29,16 @@ type tcpProtocol struct {
 	connections ConnectionPool
 	conns       chan Connection
 	listen      func(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error)
-	dial        func(addr *net.TCPAddr) (net.Conn, error)
-	resolveAddr func(addr string) (*net.TCPAddr, error)
+	dial        func(ctx context.Context, addr *net.TCPAddr) (net.Conn, error)
+	resolveAddr func(ctx context.Context, addr string) (*net.TCPAddr, error)
+	cancel      <-chan struct{}
+
+	idleTimeout       time.Duration
+	keepAliveInterval time.Duration
+	keepAliveTimeout  time.Duration
+	// keys of the connections dialed by the protocol
+	flows   map[ConnectionKey]bool
+	flowsMu sync.Mutex
 }
 
 func NewTcpProtocol(
@@ -35,12 +47,14 @@ func NewTcpProtocol(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) Protocol {
 	p := new(tcpProtocol)
 	p.network = "tcp"
 	p.reliable = true
 	p.streamed = true
 	p.conns = make(chan Connection)
+	p.init(cancel, options...)
 	p.log = logger.
 		WithPrefix("transport.Protocol").
 		WithFields(log.Fields{
@@ -48,7 +62,7 @@ func NewTcpProtocol(
 		})
 	// TODO: add separate errs chan to listen errors from pool for reconnection?
 	p.listeners = NewListenerPool(p.conns, errs, cancel, p.Log())
-	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log())
+	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log(), options...)
 	p.listen = p.defaultListen
 	p.dial = p.defaultDial
 	p.resolveAddr = p.defaultResolveAddr
@@ -58,16 +72,51 @@ func NewTcpProtocol(
 	return p
 }
 
+func (p *tcpProtocol) init(cancel <-chan struct{}, options ...ProtocolOption) ProtocolOptions {
+	optsHash := applyProtocolOptions(options...)
+	p.cancel = cancel
+	p.idleTimeout = optsHash.IdleTimeout
+	p.keepAliveInterval = optsHash.KeepAliveInterval
+	p.keepAliveTimeout = optsHash.KeepAliveTimeout
+	p.flows = make(map[ConnectionKey]bool)
+	return optsHash
+}
+
 func (p *tcpProtocol) defaultListen(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error) {
-	return net.ListenTCP(p.network, addr)
+	optsHash := applyListenOptions(options...)
+	if optsHash.TLSSniffing == nil {
+		return listenTCP(addr, optsHash, p.Log())
+	}
+
+	config, err := loadTLSConfig(optsHash.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := listenTCP(addr, optsHash, p.Log())
+	if err != nil {
+		return nil, err
+	}
+	return newSniffListener(listener, config, optsHash.TLSSniffing, optsHash.tlsHandoff, p.Log()), nil
 }
 
-func (p *tcpProtocol) defaultDial(addr *net.TCPAddr) (net.Conn, error) {
-	return net.DialTCP(p.network, nil, addr)
+// serveConn puts connection accepted outside of the protocol listeners to the connection pool.
+func (p *tcpProtocol) serveConn(baseConn net.Conn) {
+	key := ConnectionKey(p.network + ":" + baseConn.RemoteAddr().String())
+	conn := NewConnection(baseConn, key, p.network, p.Log())
+	if err := p.connections.Put(conn, p.idleTimeout); err != nil {
+		log.AddFieldsFrom(p.Log(), conn).Errorf("put %s connection to the pool failed: %s", conn.Key(), err)
+
+		conn.Close()
+	}
+}
+
+func (p *tcpProtocol) defaultDial(ctx context.Context, addr *net.TCPAddr) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, p.network, addr.String())
 }
 
-func (p *tcpProtocol) defaultResolveAddr(addr string) (*net.TCPAddr, error) {
-	return net.ResolveTCPAddr(p.network, addr)
+func (p *tcpProtocol) defaultResolveAddr(ctx context.Context, addr string) (*net.TCPAddr, error) {
+	return resolveTCPAddr(ctx, p.network, addr)
 }
 
 func (p *tcpProtocol) Done() <-chan struct{} {
@@ -88,7 +137,7 @@ func (p *tcpProtocol) pipePools() {
 		case conn := <-p.conns:
 			logger := log.AddFieldsFrom(p.Log(), conn)
 
-			if err := p.connections.Put(conn, sockTTL); err != nil {
+			if err := p.connections.Put(conn, p.idleTimeout); err != nil {
 				// TODO should it be passed up to UA?
 				logger.Errorf("put %s connection to the pool failed: %s", conn.Key(), err)
 
@@ -102,7 +151,7 @@ func (p *tcpProtocol) pipePools() {
 
 func (p *tcpProtocol) Listen(target *Target, options ...ListenOption) error {
 	target = FillTargetHostAndPort(p.Network(), target)
-	laddr, err := p.resolveAddr(target.Addr())
+	laddr, err := p.resolveAddr(context.Background(), target.Addr())
 	if err != nil {
 		return &ProtocolError{
 			err,
@@ -140,6 +189,10 @@ func (p *tcpProtocol) Listen(target *Target, options ...ListenOption) error {
 }
 
 func (p *tcpProtocol) Send(target *Target, msg sip.Message) error {
+	return p.SendContext(context.Background(), target, msg)
+}
+
+func (p *tcpProtocol) SendContext(ctx context.Context, target *Target, msg sip.Message) error {
 	target = FillTargetHostAndPort(p.Network(), target)
 
 	// validate remote address
@@ -152,17 +205,17 @@ func (p *tcpProtocol) Send(target *Target, msg sip.Message) error {
 	}
 
 	// resolve remote address
-	raddr, err := p.resolveAddr(target.Addr())
+	raddr, err := p.resolveAddr(ctx, target.Addr())
 	if err != nil {
 		return &ProtocolError{
-			err,
+			contextError(ctx, err, "resolve"),
 			fmt.Sprintf("resolve target address %s %s", p.Network(), target.Addr()),
 			fmt.Sprintf("%p", p),
 		}
 	}
 
 	// find or create connection
-	conn, err := p.getOrCreateConnection(raddr)
+	conn, err := p.getOrCreateConnection(ctx, raddr)
 	if err != nil {
 		return &ProtocolError{
 			Err:      err,
@@ -175,10 +228,34 @@ func (p *tcpProtocol) Send(target *Target, msg sip.Message) error {
 	logger.Tracef("writing SIP message to %s %s", p.Network(), raddr)
 
 	// send message
-	_, err = conn.Write([]byte(msg.String()))
+	data := []byte(msg.String())
+	num, err := writeContext(ctx, conn, data)
+	if err != nil && ctx.Err() == nil && p.isFlow(conn.Key()) {
+		// outbound connection is broken, reconnect and retry once
+		logger.Debugf("write to %s failed: %s; reconnect", conn.Key(), err)
+
+		if err := p.connections.Drop(conn.Key()); err != nil {
+			logger.Tracef("drop connection %s failed: %s", conn.Key(), err)
+		}
+		conn, err = p.getOrCreateConnection(ctx, raddr)
+		if err != nil {
+			return &ProtocolError{
+				Err:      err,
+				Op:       fmt.Sprintf("reconnect %s connection", p.Network()),
+				ProtoPtr: fmt.Sprintf("%p", p),
+			}
+		}
+		num, err = writeContext(ctx, conn, data)
+	}
 	if err != nil {
+		if num > 0 && num < len(data) {
+			// partially written message breaks the stream
+			if err := p.connections.Drop(conn.Key()); err != nil {
+				logger.Tracef("drop connection %s failed: %s", conn.Key(), err)
+			}
+		}
 		err = &ProtocolError{
-			Err:      err,
+			Err:      contextError(ctx, err, "write"),
 			Op:       fmt.Sprintf("write SIP message to the %s connection", conn.Key()),
 			ProtoPtr: fmt.Sprintf("%p", p),
 		}
@@ -187,23 +264,126 @@ func (p *tcpProtocol) Send(target *Target, msg sip.Message) error {
 	return err
 }
 
-func (p *tcpProtocol) getOrCreateConnection(raddr *net.TCPAddr) (Connection, error) {
+func (p *tcpProtocol) getOrCreateConnection(ctx context.Context, raddr *net.TCPAddr) (Connection, error) {
 	key := ConnectionKey(p.network + ":" + raddr.String())
 	conn, err := p.connections.Get(key)
 	if err != nil {
 		p.Log().Debugf("connection for remote address %s %s not found, create a new one", p.Network(), raddr)
 
-		tcpConn, err := p.dial(raddr)
+		tcpConn, err := p.dial(ctx, raddr)
 		if err != nil {
-			return nil, fmt.Errorf("dial to %s %s: %w", p.Network(), raddr, err)
+			return nil, fmt.Errorf("dial to %s %s: %w", p.Network(), raddr, contextError(ctx, err, "dial"))
 		}
 
 		conn = NewConnection(tcpConn, key, p.network, p.Log())
 
-		if err := p.connections.Put(conn, sockTTL); err != nil {
+		if err := p.connections.Put(conn, p.idleTimeout); err != nil {
 			return conn, fmt.Errorf("put %s connection to the pool: %w", conn.Key(), err)
 		}
+		p.addFlow(conn, raddr)
 	}
 
 	return conn, nil
 }
+
+// addFlow registers the connection dialed by the protocol and starts its keep-alive.
+func (p *tcpProtocol) addFlow(conn Connection, raddr *net.TCPAddr) {
+	p.flowsMu.Lock()
+	p.flows[conn.Key()] = true
+	p.flowsMu.Unlock()
+
+	if p.keepAliveInterval > 0 {
+		go p.keepAlive(conn, raddr)
+	}
+}
+
+func (p *tcpProtocol) isFlow(key ConnectionKey) bool {
+	p.flowsMu.Lock()
+	defer p.flowsMu.Unlock()
+	return p.flows[key]
+}
+
+// keepAlive sends CRLF pings on the outbound connection while it is in the pool.
+// Connection that doesn't respond with pong in time is considered failed and recovered - RFC 5626 4.4.1.
+func (p *tcpProtocol) keepAlive(conn Connection, raddr *net.TCPAddr) {
+	logger := log.AddFieldsFrom(p.Log(), conn)
+	logger.Debug("begin connection keep-alive")
+	defer logger.Debug("stop connection keep-alive")
+
+	timer := time.NewTimer(p.keepAliveInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-p.cancel:
+			return
+		case <-timer.C:
+		}
+
+		if pooled, err := p.connections.Get(conn.Key()); err != nil || pooled != conn {
+			// dropped out by expiry or replaced
+			return
+		}
+
+		sent := time.Now()
+		if _, err := conn.Write(keepAlivePing); err != nil {
+			logger.Debugf("send keep-alive ping failed: %s", err)
+			p.recoverFlow(conn, raddr)
+			return
+		}
+
+		select {
+		case <-p.cancel:
+			return
+		case <-time.After(p.keepAliveTimeout):
+		}
+		// any data read after the ping proves that the flow is alive
+		if c, ok := conn.(*connection); ok && c.lastRead().Before(sent) {
+			logger.Debugf("keep-alive pong not received in %s", p.keepAliveTimeout)
+			p.recoverFlow(conn, raddr)
+			return
+		}
+
+		timer.Reset(p.keepAliveInterval)
+	}
+}
+
+// recoverFlow drops failed outbound connection and dials the remote address again.
+// Attempts are repeated with exponential backoff until the connection is established - RFC 5626 4.5.
+func (p *tcpProtocol) recoverFlow(conn Connection, raddr *net.TCPAddr) {
+	if err := p.connections.Drop(conn.Key()); err != nil {
+		p.Log().Tracef("drop connection %s failed: %s", conn.Key(), err)
+	}
+
+	for failures := 0; ; failures++ {
+		if failures > 0 {
+			select {
+			case <-p.cancel:
+				return
+			case <-time.After(flowRecoveryWait(failures)):
+			}
+		}
+		select {
+		case <-p.cancel:
+			return
+		default:
+		}
+
+		if _, err := p.getOrCreateConnection(context.Background(), raddr); err != nil {
+			p.Log().Debugf("recover %s flow to %s failed: %s", p.Network(), raddr, err)
+			continue
+		}
+		p.Log().Debugf("%s flow to %s recovered", p.Network(), raddr)
+		return
+	}
+}
+
+// Returns random wait time between 50 and 100% of min(max-time, base-time * 2^(failures - 1)) - RFC 5626 4.5.
+func flowRecoveryWait(failures int) time.Duration {
+	wait := flowRecoveryMaxTime
+	if failures < 16 {
+		if w := flowRecoveryBaseTime << uint(failures-1); w < wait {
+			wait = w
+		}
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
@@ -10,6 +10,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
 	"github.com/ghettovoice/gosip/testutils"
 	"github.com/ghettovoice/gosip/timing"
 	"github.com/ghettovoice/gosip/transport"
@@ -246,3 +247,190 @@ var _ = Describe("TcpProtocol", func() {
 		})
 	})
 })
+
+var _ = Describe("TcpProtocol keep-alive", func() {
+	var (
+		output   chan sip.Message
+		errs     chan error
+		cancel   chan struct{}
+		protocol transport.Protocol
+	)
+
+	network := "tcp"
+	localTarget := transport.NewTarget(transport.DefaultHost, 9063)
+	remoteAddr := fmt.Sprintf("%s:%d", transport.DefaultHost, 9064)
+	msg := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/TCP pc33.far-far-away.com;branch=z9hG4bK776asdhds\r\n" +
+		"CSeq: 2 INVITE\r\n" +
+		"Call-ID: cheesecake1729\r\n" +
+		"Max-Forwards: 65\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		output = make(chan sip.Message)
+		errs = make(chan error)
+		cancel = make(chan struct{})
+		protocol = transport.NewTcpProtocol(output, errs, cancel, nil, logger,
+			transport.WithKeepAlive(100*time.Millisecond, 100*time.Millisecond))
+		go func(errs <-chan error) {
+			for range errs {
+			}
+		}(errs)
+	})
+	AfterEach(func(done Done) {
+		close(cancel)
+		<-protocol.Done()
+		close(output)
+		close(errs)
+		close(done)
+	}, 3)
+
+	Context("when client sends ping before the message", func() {
+		var client net.Conn
+
+		BeforeEach(func() {
+			Expect(protocol.Listen(localTarget)).To(Succeed())
+			time.Sleep(time.Millisecond)
+			client = testutils.CreateClient(network, localTarget.Addr(), "")
+		})
+		AfterEach(func() {
+			client.Close()
+		})
+
+		It("should respond with pong and parse the message", func(done Done) {
+			testutils.WriteToConn(client, []byte("\r\n\r\n"))
+			buf := make([]byte, 16)
+			num, err := client.Read(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf[:num])).To(Equal("\r\n"))
+
+			testutils.WriteToConn(client, []byte(msg))
+			testutils.AssertMessageArrived(output, msg, client.LocalAddr().String(), localTarget.Addr())
+			close(done)
+		}, 3)
+
+		It("should respond with pong on ping sent along with the message", func(done Done) {
+			testutils.WriteToConn(client, []byte(msg+"\r\n\r\n"))
+			testutils.AssertMessageArrived(output, msg, client.LocalAddr().String(), localTarget.Addr())
+			buf := make([]byte, 16)
+			num, err := client.Read(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf[:num])).To(Equal("\r\n"))
+			close(done)
+		}, 3)
+	})
+
+	Context("when remote server stops responding with pong", func() {
+		var server net.Listener
+
+		BeforeEach(func() {
+			var err error
+			server, err = net.Listen(network, remoteAddr)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should reconnect the outbound connection", func(done Done) {
+			target, err := transport.NewTargetFromAddr(remoteAddr)
+			Expect(err).ToNot(HaveOccurred())
+			res, err := parser.ParseMessage([]byte(msg), logger)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(protocol.Send(target, res)).To(Succeed())
+
+			conn1, err := server.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			defer conn1.Close()
+			buf := make([]byte, 65535)
+			num, err := conn1.Read(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf[:num])).To(Equal(msg))
+
+			By("ping arrives and is not answered")
+			num, err = conn1.Read(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf[:num])).To(Equal("\r\n\r\n"))
+
+			By("failed connection is closed and the new one is established")
+			_, err = conn1.Read(buf)
+			Expect(err).To(HaveOccurred())
+			conn2, err := server.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			defer conn2.Close()
+
+			By("answered ping keeps the connection")
+			for i := 0; i < 2; i++ {
+				num, err = conn2.Read(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(buf[:num])).To(Equal("\r\n\r\n"))
+				testutils.WriteToConn(conn2, []byte("\r\n"))
+			}
+			close(done)
+		}, 3)
+	})
+})
+
+var _ = Describe("TcpProtocol strict Content-Length", func() {
+	var (
+		output   chan sip.Message
+		errs     chan error
+		cancel   chan struct{}
+		protocol transport.Protocol
+		client   net.Conn
+	)
+
+	network := "tcp"
+	localTarget := transport.NewTarget(transport.DefaultHost, 9066)
+	msg := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/TCP pc33.far-far-away.com;branch=z9hG4bK776asdhds\r\n" +
+		"CSeq: 2 INVITE\r\n" +
+		"Call-ID: cheesecake1729\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+	broken := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/TCP pc33.far-far-away.com;branch=z9hG4bK776asdhds\r\n" +
+		"CSeq: 2 INVITE\r\n" +
+		"Call-ID: cheesecake1729\r\n" +
+		"Content-Length: -12\r\n" +
+		"\r\n"
+
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		output = make(chan sip.Message)
+		errs = make(chan error)
+		cancel = make(chan struct{})
+		go func(errs <-chan error) {
+			for range errs {
+			}
+		}(errs)
+		protocol = transport.NewTcpProtocol(output, errs, cancel, nil, logger, transport.WithStrictContentLength(0))
+		Expect(protocol.Listen(localTarget)).To(Succeed())
+		time.Sleep(time.Millisecond)
+		client = testutils.CreateClient(network, localTarget.Addr(), "")
+	})
+	AfterEach(func(done Done) {
+		client.Close()
+		close(cancel)
+		<-protocol.Done()
+		close(output)
+		close(errs)
+		close(done)
+	}, 3)
+
+	It("should close connection after the message with invalid Content-Length", func(done Done) {
+		resyncs := transport.StreamResyncCount()
+		testutils.WriteToConn(client, []byte(msg+broken+msg))
+		testutils.AssertMessageArrived(output, msg, client.LocalAddr().String(), localTarget.Addr())
+
+		_, err := client.Read(make([]byte, 16))
+		Expect(err).To(HaveOccurred())
+		Expect(transport.StreamResyncCount()).To(Equal(resyncs + 1))
+		Consistently(output, 100*time.Millisecond).ShouldNot(Receive())
+		close(done)
+	}, 3)
+})
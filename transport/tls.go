@@ -1,10 +1,13 @@
 package transport
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"strings"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
@@ -20,12 +23,14 @@ func NewTlsProtocol(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) Protocol {
 	p := new(tlsProtocol)
 	p.network = "tls"
 	p.reliable = true
 	p.streamed = true
 	p.conns = make(chan Connection)
+	optsHash := p.init(cancel, options...)
 	p.log = logger.
 		WithPrefix("transport.Protocol").
 		WithFields(log.Fields{
@@ -33,36 +38,148 @@ func NewTlsProtocol(
 		})
 	//TODO: add separate errs chan to listen errors from pool for reconnection?
 	p.listeners = NewListenerPool(p.conns, errs, cancel, p.Log())
-	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log())
+	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log(), options...)
 	p.listen = func(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error) {
 		if len(options) == 0 {
 			return net.ListenTCP("tcp", addr)
 		}
-		optsHash := ListenOptions{}
-		for _, opt := range options {
-			opt.ApplyListen(&optsHash)
+		optsHash := applyListenOptions(options...)
+		config, err := loadTLSConfig(optsHash.TLSConfig)
+		if err != nil {
+			return nil, err
 		}
-		cert, err := tls.LoadX509KeyPair(optsHash.TLSConfig.Cert, optsHash.TLSConfig.Key)
+		listener, err := listenTCP(addr, optsHash, p.Log())
 		if err != nil {
-			return nil, fmt.Errorf("load TLS certficate %s: %w", optsHash.TLSConfig.Cert, err)
+			return nil, err
 		}
-		return tls.Listen("tcp", addr.String(), &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		})
+		return &tlsListener{Listener: listener, config: config}, nil
 	}
-	p.dial = func(addr *net.TCPAddr) (net.Conn, error) {
-		return tls.Dial("tcp", addr.String(), &tls.Config{
+	p.dial = func(ctx context.Context, addr *net.TCPAddr) (net.Conn, error) {
+		if optsHash.DialTLSConfig != nil {
+			return dialTLS(ctx, "tcp", addr.String(), optsHash.DialTLSConfig)
+		}
+		return dialTLS(ctx, "tcp", addr.String(), &tls.Config{
 			InsecureSkipVerify: true,
 			VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
 				return nil
 			},
 		})
 	}
-	p.resolveAddr = func(addr string) (*net.TCPAddr, error) {
-		return net.ResolveTCPAddr("tcp", addr)
+	p.resolveAddr = func(ctx context.Context, addr string) (*net.TCPAddr, error) {
+		return resolveTCPAddr(ctx, "tcp", addr)
 	}
 	//pipe listener and connection pools
 	go p.pipePools()
 
 	return p
 }
+
+func loadTLSConfig(config TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if config.Config != nil {
+		tlsConfig = config.Config.Clone()
+	}
+	if config.Cert != "" || config.Config == nil {
+		cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, fmt.Errorf("load TLS certficate %s: %w", config.Cert, err)
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+
+	if config.ClientCAs != "" {
+		data, err := ioutil.ReadFile(config.ClientCAs)
+		if err != nil {
+			return nil, fmt.Errorf("load client CA certificates %s: %w", config.ClientCAs, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("load client CA certificates %s: no certificates found", config.ClientCAs)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if config.ClientAuth != tls.NoClientCert {
+		tlsConfig.ClientAuth = config.ClientAuth
+	}
+
+	if len(config.SNI) > 0 {
+		certs := make(map[string]*tls.Certificate, len(config.SNI))
+		for _, sni := range config.SNI {
+			cert, err := tls.LoadX509KeyPair(sni.Cert, sni.Key)
+			if err != nil {
+				return nil, fmt.Errorf("load TLS certficate %s for server name %s: %w", sni.Cert, sni.ServerName, err)
+			}
+			certs[sip.TokenLower(sni.ServerName)] = &cert
+		}
+
+		getCertificate := tlsConfig.GetCertificate
+		tlsConfig.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert := sniCertificate(certs, hello.ServerName); cert != nil {
+				return cert, nil
+			}
+			if getCertificate != nil {
+				return getCertificate(hello)
+			}
+			// fallback to the default certificate
+			return nil, nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Returns certificate for the server name, exact names take precedence over wildcards.
+func sniCertificate(certs map[string]*tls.Certificate, serverName string) *tls.Certificate {
+	name := sip.TokenLower(strings.TrimSuffix(serverName, "."))
+	if name == "" {
+		return nil
+	}
+	if cert, ok := certs[name]; ok {
+		return cert
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return certs["*"+name[i:]]
+	}
+	return nil
+}
+
+type tlsStateKey struct{}
+
+// GetTLSState returns state of the TLS connection the message was received on.
+func GetTLSState(msg sip.Message) (*tls.ConnectionState, bool) {
+	state, ok := sip.MessageMetadata(msg).Value(tlsStateKey{}).(*tls.ConnectionState)
+	return state, ok
+}
+
+// GetPeerCertificate returns the leaf certificate presented by the peer of the TLS connection
+// the message was received on, e.g. to check the identity of the client authenticated with mutual TLS.
+func GetPeerCertificate(msg sip.Message) (*x509.Certificate, bool) {
+	state, ok := GetTLSState(msg)
+	if !ok || len(state.PeerCertificates) == 0 {
+		return nil, false
+	}
+	return state.PeerCertificates[0], true
+}
+
+func setTLSState(msg sip.Message, state *tls.ConnectionState) {
+	sip.MessageMetadata(msg).SetValue(tlsStateKey{}, state)
+}
+
+func tlsConnOf(conn net.Conn) *tls.Conn {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *tls.Conn:
+			return c
+		case *proxyConn:
+			conn = c.Conn
+		case *peekedConn:
+			conn = c.Conn
+		case *wsConn:
+			conn = c.Conn
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -1,9 +1,18 @@
 package transport_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net"
+	"os"
 	"path/filepath"
 	"sync"
 	"time"
@@ -249,3 +258,140 @@ var _ = Describe("TlsProtocol", func() {
 		})
 	})
 })
+
+var _ = Describe("TlsProtocol mutual auth", func() {
+	var (
+		output   chan sip.Message
+		errs     chan error
+		cancel   chan struct{}
+		protocol transport.Protocol
+		certsDir string
+	)
+
+	localTarget := transport.NewTarget(transport.DefaultHost, 9065)
+	msg := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/TLS pc33.far-far-away.com;branch=z9hG4bK776asdhds\r\n" +
+		"CSeq: 2 INVITE\r\n" +
+		"Call-ID: cheesecake1729\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		var err error
+		certsDir, err = ioutil.TempDir("", "gosip-tls")
+		Expect(err).ToNot(HaveOccurred())
+
+		caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		caTmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "Test CA"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+		}
+		caDer, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+		Expect(err).ToNot(HaveOccurred())
+		writePEM := func(name, typ string, der []byte) {
+			Expect(ioutil.WriteFile(filepath.Join(certsDir, name), pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600)).To(Succeed())
+		}
+		writePEM("ca.pem", "CERTIFICATE", caDer)
+
+		issue := func(name string, serial int64, usage x509.ExtKeyUsage) {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).ToNot(HaveOccurred())
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(serial),
+				Subject:      pkix.Name{CommonName: name},
+				DNSNames:     []string{name},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			}
+			der, err := x509.CreateCertificate(rand.Reader, tmpl, caTmpl, &key.PublicKey, caKey)
+			Expect(err).ToNot(HaveOccurred())
+			keyDer, err := x509.MarshalECPrivateKey(key)
+			Expect(err).ToNot(HaveOccurred())
+			writePEM(name+".pem", "CERTIFICATE", der)
+			writePEM(name+"-key.pem", "EC PRIVATE KEY", keyDer)
+		}
+		issue("a.example.com", 2, x509.ExtKeyUsageServerAuth)
+		issue("b.example.com", 3, x509.ExtKeyUsageServerAuth)
+		issue("alice", 4, x509.ExtKeyUsageClientAuth)
+
+		output = make(chan sip.Message)
+		errs = make(chan error)
+		cancel = make(chan struct{})
+		go func(errs <-chan error) {
+			for range errs {
+			}
+		}(errs)
+		protocol = transport.NewTlsProtocol(output, errs, cancel, nil, logger)
+		Expect(protocol.Listen(localTarget, transport.TLSConfig{
+			Cert:      filepath.Join(certsDir, "a.example.com.pem"),
+			Key:       filepath.Join(certsDir, "a.example.com-key.pem"),
+			ClientCAs: filepath.Join(certsDir, "ca.pem"),
+			SNI: []transport.TLSCertificate{
+				{
+					ServerName: "*.b.example.com",
+					Cert:       filepath.Join(certsDir, "b.example.com.pem"),
+					Key:        filepath.Join(certsDir, "b.example.com-key.pem"),
+				},
+			},
+		})).To(Succeed())
+		time.Sleep(time.Millisecond)
+	})
+	AfterEach(func(done Done) {
+		close(cancel)
+		<-protocol.Done()
+		close(output)
+		close(errs)
+		os.RemoveAll(certsDir)
+		close(done)
+	}, 3)
+
+	It("should serve SNI certificate and expose client certificate", func(done Done) {
+		clientCert, err := tls.LoadX509KeyPair(filepath.Join(certsDir, "alice.pem"), filepath.Join(certsDir, "alice-key.pem"))
+		Expect(err).ToNot(HaveOccurred())
+		conn, err := tls.Dial("tcp", localTarget.Addr(), &tls.Config{
+			ServerName:         "sip.b.example.com",
+			InsecureSkipVerify: true,
+			Certificates:       []tls.Certificate{clientCert},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		Expect(conn.ConnectionState().PeerCertificates[0].Subject.CommonName).To(Equal("b.example.com"))
+
+		testutils.WriteToConn(conn, []byte(msg))
+		in := <-output
+		Expect(in).ToNot(BeNil())
+		cert, ok := transport.GetPeerCertificate(in)
+		Expect(ok).To(BeTrue())
+		Expect(cert.Subject.CommonName).To(Equal("alice"))
+		state, ok := transport.GetTLSState(in)
+		Expect(ok).To(BeTrue())
+		Expect(state.ServerName).To(Equal("sip.b.example.com"))
+		close(done)
+	}, 3)
+
+	It("should reject client without certificate", func(done Done) {
+		conn, err := tls.Dial("tcp", localTarget.Addr(), &tls.Config{
+			ServerName:         "other.example.com",
+			InsecureSkipVerify: true,
+		})
+		if err == nil {
+			defer conn.Close()
+			Expect(conn.ConnectionState().PeerCertificates[0].Subject.CommonName).To(Equal("a.example.com"))
+			// TLS 1.3 client learns about the rejection on read
+			_, _ = conn.Write([]byte(msg))
+			_, err = conn.Read(make([]byte, 16))
+		}
+		Expect(err).To(HaveOccurred())
+		close(done)
+	}, 3)
+})
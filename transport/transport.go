@@ -2,6 +2,8 @@
 package transport
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +11,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
@@ -95,6 +98,10 @@ func FillTargetHostAndPort(network string, target *Target) *Target {
 	return target
 }
 
+// ErrTransportUnreachable is matched by transport errors caused by unreachable destination:
+// failed dial, refused connection, unreachable host or network, or unresolvable host name.
+var ErrTransportUnreachable = errors.New("transport unreachable")
+
 // Transport error
 type Error interface {
 	net.Error
@@ -103,6 +110,10 @@ type Error interface {
 }
 
 func isNetwork(err error) bool {
+	var ctxErr *ContextError
+	if errors.As(err, &ctxErr) {
+		return false
+	}
 	var netErr net.Error
 	if errors.As(err, &netErr) {
 		return true
@@ -124,6 +135,26 @@ func isTemporary(err error) bool {
 	}
 	return false
 }
+func isUnreachable(err error) bool {
+	var ctxErr *ContextError
+	if errors.As(err, &ctxErr) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsNotFound
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial"
+	}
+	return false
+}
 func isCanceled(err error) bool {
 	var cancelErr sip.CancelError
 	if errors.As(err, &cancelErr) {
@@ -153,6 +184,9 @@ func (err *ConnectionError) Unwrap() error   { return err.Err }
 func (err *ConnectionError) Network() bool   { return isNetwork(err.Err) }
 func (err *ConnectionError) Timeout() bool   { return isTimeout(err.Err) }
 func (err *ConnectionError) Temporary() bool { return isTemporary(err.Err) }
+func (err *ConnectionError) Is(target error) bool {
+	return target == ErrTransportUnreachable && isUnreachable(err.Err)
+}
 func (err *ConnectionError) Error() string {
 	if err == nil {
 		return "<nil>"
@@ -201,6 +235,9 @@ func (err *ProtocolError) Unwrap() error   { return err.Err }
 func (err *ProtocolError) Network() bool   { return isNetwork(err.Err) }
 func (err *ProtocolError) Timeout() bool   { return isTimeout(err.Err) }
 func (err *ProtocolError) Temporary() bool { return isTemporary(err.Err) }
+func (err *ProtocolError) Is(target error) bool {
+	return target == ErrTransportUnreachable && isUnreachable(err.Err)
+}
 func (err *ProtocolError) Error() string {
 	if err == nil {
 		return "<nil>"
@@ -316,6 +353,9 @@ func (err *PoolError) Unwrap() error   { return err.Err }
 func (err *PoolError) Network() bool   { return isNetwork(err.Err) }
 func (err *PoolError) Timeout() bool   { return isTimeout(err.Err) }
 func (err *PoolError) Temporary() bool { return isTemporary(err.Err) }
+func (err *PoolError) Is(target error) bool {
+	return target == ErrTransportUnreachable && isUnreachable(err.Err)
+}
 func (err *PoolError) Error() string {
 	if err == nil {
 		return "<nil>"
@@ -332,6 +372,36 @@ func (err *PoolError) Error() string {
 	return fmt.Sprintf("transport.PoolError<%s> %s failed: %s", fields, err.Op, err.Err)
 }
 
+// ContextError is returned when the operation is interrupted by the context cancellation or deadline,
+// it is never reported as a network error.
+type ContextError struct {
+	Err error
+	Op  string
+}
+
+func (err *ContextError) Unwrap() error   { return err.Err }
+func (err *ContextError) Network() bool   { return false }
+func (err *ContextError) Timeout() bool   { return errors.Is(err.Err, context.DeadlineExceeded) }
+func (err *ContextError) Temporary() bool { return false }
+func (err *ContextError) Canceled() bool  { return errors.Is(err.Err, context.Canceled) }
+func (err *ContextError) Expired() bool   { return errors.Is(err.Err, context.DeadlineExceeded) }
+func (err *ContextError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("transport.ContextError: %s interrupted: %s", err.Op, err.Err)
+}
+
+// Replaces the error with ContextError if the context is done,
+// dialers and resolvers report context errors as the network ones.
+func contextError(ctx context.Context, err error, op string) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	return &ContextError{ctx.Err(), op}
+}
+
 type UnsupportedProtocolError string
 
 func (err UnsupportedProtocolError) Network() bool   { return false }
@@ -347,11 +417,25 @@ type TLSConfig struct {
 	Cert   string
 	Key    string
 	Pass   string
+	// ClientCAs is the PEM file with CA certificates to verify client certificates (mutual TLS),
+	// clients must present a valid certificate unless ClientAuth is set.
+	ClientCAs string
+	// ClientAuth is the policy of client certificate verification.
+	ClientAuth tls.ClientAuthType
+	// SNI are certificates served for the server names requested by clients,
+	// Cert is served when the requested name doesn't match any of them.
+	SNI []TLSCertificate
+	// Config is the base configuration, the options above are applied to its clone.
+	Config *tls.Config
+}
+
+// TLSCertificate is a certificate served for the server name, the name may be a wildcard like *.example.com.
+type TLSCertificate struct {
+	ServerName string
+	Cert       string
+	Key        string
 }
 
 func (c TLSConfig) ApplyListen(opts *ListenOptions) {
-	opts.TLSConfig.Domain = c.Domain
-	opts.TLSConfig.Cert = c.Cert
-	opts.TLSConfig.Key = c.Key
-	opts.TLSConfig.Pass = c.Pass
+	opts.TLSConfig = c
 }
@@ -1,15 +1,20 @@
 package transport
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"strings"
+	"os"
+	"strconv"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
 )
 
-// UDP protocol implementation
+// UDP protocol implementation.
+// Each Listen call binds a separate socket, so the protocol can listen on several addresses
+// including the same port on different IPs. Responses are sent from the socket the request
+// was received on to the request source, that is 'received' and 'rport' of the 'Via' header - RFC 3581.
 type udpProtocol struct {
 	protocol
 	connections ConnectionPool
@@ -53,8 +58,18 @@ func (p *udpProtocol) Listen(target *Target, options ...ListenOption) error {
 			fmt.Sprintf("%p", p),
 		}
 	}
-	// create UDP connection
-	udpConn, err := net.ListenUDP(p.network, laddr)
+	// create UDP connection, join the multicast group if target is a multicast address
+	var udpConn *net.UDPConn
+	if file := applyListenOptions(options...).File; file != nil {
+		udpConn, err = fileUDPConn(file)
+		if err == nil {
+			laddr = udpConn.LocalAddr().(*net.UDPAddr)
+		}
+	} else if laddr.IP.IsMulticast() {
+		udpConn, err = net.ListenMulticastUDP(p.network, nil, laddr)
+	} else {
+		udpConn, err = net.ListenUDP(p.network, laddr)
+	}
 	if err != nil {
 		return &ProtocolError{
 			err,
@@ -67,7 +82,7 @@ func (p *udpProtocol) Listen(target *Target, options ...ListenOption) error {
 
 	// register new connection
 	// index by local address, TTL=0 - unlimited expiry time
-	key := ConnectionKey(fmt.Sprintf("%s:0.0.0.0:%d", p.network, laddr.Port))
+	key := ConnectionKey(fmt.Sprintf("%s:%s", p.network, laddr))
 	conn := NewConnection(udpConn, key, p.network, p.Log())
 	err = p.connections.Put(conn, 0)
 	if err != nil {
@@ -82,6 +97,10 @@ func (p *udpProtocol) Listen(target *Target, options ...ListenOption) error {
 }
 
 func (p *udpProtocol) Send(target *Target, msg sip.Message) error {
+	return p.SendContext(context.Background(), target, msg)
+}
+
+func (p *udpProtocol) SendContext(ctx context.Context, target *Target, msg sip.Message) error {
 	target = FillTargetHostAndPort(p.Network(), target)
 
 	// validate remote address
@@ -94,16 +113,16 @@ func (p *udpProtocol) Send(target *Target, msg sip.Message) error {
 	}
 
 	// resolve remote address
-	raddr, err := net.ResolveUDPAddr(p.network, target.Addr())
+	raddr, err := resolveUDPAddr(ctx, p.network, target.Addr())
 	if err != nil {
 		return &ProtocolError{
-			err,
+			contextError(ctx, err, "resolve"),
 			fmt.Sprintf("resolve target address %s %s", p.Network(), target.Addr()),
 			fmt.Sprintf("%p", p),
 		}
 	}
 
-	_, port, err := net.SplitHostPort(msg.Source())
+	host, port, err := net.SplitHostPort(msg.Source())
 	if err != nil {
 		return &ProtocolError{
 			Err:      err,
@@ -112,27 +131,98 @@ func (p *udpProtocol) Send(target *Target, msg sip.Message) error {
 		}
 	}
 
-	for _, conn := range p.connections.All() {
-		parts := strings.Split(string(conn.Key()), ":")
-		if parts[2] == port {
-			logger := log.AddFieldsFrom(p.Log(), conn, msg)
-			logger.Tracef("writing SIP message to %s %s", p.Network(), raddr)
-
-			if _, err = conn.WriteTo([]byte(msg.String()), raddr); err != nil {
-				return &ProtocolError{
-					Err:      err,
-					Op:       fmt.Sprintf("write SIP message to the %s connection", conn.Key()),
-					ProtoPtr: fmt.Sprintf("%p", p),
-				}
+	conn, ok := p.sourceConnection(host, port)
+	if !ok {
+		return &ProtocolError{
+			fmt.Errorf("connection on port %s not found", port),
+			"search connection",
+			fmt.Sprintf("%p", p),
+		}
+	}
+
+	logger := log.AddFieldsFrom(p.Log(), conn, msg)
+
+	// RFC 3261 - 18.1.1, 18.2.2.
+	if raddr.IP.IsMulticast() {
+		ttl := multicastTTL(msg)
+		if setter, ok := conn.(interface{ SetMulticastTTL(ttl int) error }); ok {
+			if err := setter.SetMulticastTTL(ttl); err != nil {
+				logger.Warnf("set multicast TTL %d failed: %s", ttl, err)
 			}
+		}
+	}
+
+	logger.Tracef("writing SIP message to %s %s", p.Network(), raddr)
+
+	// datagram write doesn't block, the socket is shared with the listener so its deadline is left as is
+	if err := ctx.Err(); err != nil {
+		return &ProtocolError{
+			Err:      &ContextError{err, "write"},
+			Op:       fmt.Sprintf("write SIP message to the %s connection", conn.Key()),
+			ProtoPtr: fmt.Sprintf("%p", p),
+		}
+	}
+	if _, err = conn.WriteTo([]byte(msg.String()), raddr); err != nil {
+		return &ProtocolError{
+			Err:      err,
+			Op:       fmt.Sprintf("write SIP message to the %s connection", conn.Key()),
+			ProtoPtr: fmt.Sprintf("%p", p),
+		}
+	}
+
+	return nil
+}
+
+// Finds socket bound to the message source address: the socket bound to the source IP is preferred,
+// then the socket bound to all interfaces, then any socket on the source port.
+func (p *udpProtocol) sourceConnection(host, port string) (Connection, bool) {
+	var wildcard, any Connection
+	ip := net.ParseIP(host)
+	for _, conn := range p.connections.All() {
+		laddr, ok := conn.LocalAddr().(*net.UDPAddr)
+		if !ok || strconv.Itoa(laddr.Port) != port {
+			continue
+		}
+		switch {
+		case ip != nil && laddr.IP.Equal(ip):
+			return conn, true
+		case laddr.IP == nil || laddr.IP.IsUnspecified():
+			wildcard = conn
+		default:
+			any = conn
+		}
+	}
+
+	if wildcard != nil {
+		return wildcard, true
+	}
+	return any, any != nil
+}
 
-			return nil
+// Default TTL of multicast requests - RFC 3261 18.1.1.
+const defaultMulticastTTL = 1
+
+// Returns TTL of multicast message from the top 'Via' header.
+func multicastTTL(msg sip.Message) int {
+	if viaHop, ok := msg.ViaHop(); ok && viaHop.Params != nil {
+		if ttl, ok := viaHop.Params.Get("ttl"); ok && ttl != nil {
+			if v, err := strconv.Atoi(ttl.String()); err == nil && v >= 0 && v <= 255 {
+				return v
+			}
 		}
 	}
+	return defaultMulticastTTL
+}
 
-	return &ProtocolError{
-		fmt.Errorf("connection on port %s not found", port),
-		"search connection",
-		fmt.Sprintf("%p", p),
+func fileUDPConn(file *os.File) (*net.UDPConn, error) {
+	conn, err := net.FilePacketConn(file)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("file %s is not UDP socket", file.Name())
 	}
+	return udpConn, nil
 }
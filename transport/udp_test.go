@@ -247,4 +247,60 @@ var _ = Describe("UdpProtocol", func() {
 			})
 		})
 	})
+
+	Context("listens the same port on 2 IPs", func() {
+		var client net.PacketConn
+		target1 := transport.NewTarget("127.0.0.1", 9053)
+		target2 := transport.NewTarget("127.0.0.2", 9053)
+		clientAddr := "127.0.0.1:9004"
+
+		BeforeEach(func() {
+			Expect(protocol.Listen(target1)).To(Succeed())
+			Expect(protocol.Listen(target2)).To(Succeed())
+
+			var err error
+			client, err = net.ListenPacket(network, clientAddr)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			client.Close()
+		})
+
+		It("should fill rport and respond from the socket the request was received on", func(done Done) {
+			req := "OPTIONS sip:bob@far-far-away.com SIP/2.0\r\n" +
+				"Via: SIP/2.0/UDP 127.0.0.1:5060;branch=z9hG4bK776asdhds;rport\r\n" +
+				"To: <sip:bob@far-far-away.com>\r\n" +
+				"From: <sip:alice@wonderland.com>;tag=1928301774\r\n" +
+				"Call-ID: a84b4c76e66710\r\n" +
+				"CSeq: 1 OPTIONS\r\n" +
+				"Content-Length: 0\r\n" +
+				"\r\n"
+			raddr, err := net.ResolveUDPAddr(network, target2.Addr())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.WriteTo([]byte(req), raddr)
+			Expect(err).ToNot(HaveOccurred())
+
+			msg := (<-output).(sip.Request)
+			viaHop, _ := msg.ViaHop()
+			rport, _ := viaHop.Params.Get("rport")
+			Expect(rport.String()).To(Equal("9004"))
+			received, _ := viaHop.Params.Get("received")
+			Expect(received.String()).To(Equal("127.0.0.1"))
+			Expect(msg.Source()).To(Equal(clientAddr))
+			Expect(msg.Destination()).To(Equal(target2.Addr()))
+
+			res := sip.NewResponseFromRequest("", msg, 200, "OK", "")
+			resTarget, err := transport.NewTargetFromAddr(res.Destination())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(protocol.Send(resTarget, res)).To(Succeed())
+
+			buf := make([]byte, 65535)
+			Expect(client.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+			num, from, err := client.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(from.String()).To(Equal(target2.Addr()))
+			Expect(string(buf[:num])).To(Equal(res.String()))
+			close(done)
+		}, 3)
+	})
 })
@@ -0,0 +1,270 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Unix domain socket transport is intended for the co-located proxy and application (sidecars).
+// The transport is addressed with pseudo hosts mapped to the socket paths with MapUnixSocket,
+// e.g. Listen("unix", "app:5060") and sip:app;transport=unix with "app" mapped to /run/app/sip.sock,
+// messages carry 'SIP/2.0/UNIX' Via transport and the port only distinguishes connections.
+// Peers of the accepted connections get unique pseudo addresses UnixPeerHost:<n>
+// that are used as the source of received messages, so responses go back over the same connection.
+var unixProto = sip.TransportProto{
+	Network:     "unix",
+	ViaToken:    "UNIX",
+	Reliable:    true,
+	Streamed:    true,
+	DefaultPort: sip.DefaultTcpPort,
+}
+
+// UnixPeerHost is the pseudo host of the peers connected to the unix socket listeners.
+const UnixPeerHost = "unix.invalid"
+
+func init() {
+	if err := sip.RegisterTransportProto(unixProto); err != nil {
+		panic(err)
+	}
+}
+
+var unixSockets = struct {
+	mu    sync.RWMutex
+	paths map[string]string
+}{paths: make(map[string]string)}
+
+// MapUnixSocket maps the pseudo host of the unix socket transport to the socket path,
+// empty path removes the mapping.
+func MapUnixSocket(host, path string) {
+	host = sip.TokenLower(host)
+
+	unixSockets.mu.Lock()
+	defer unixSockets.mu.Unlock()
+
+	if path == "" {
+		delete(unixSockets.paths, host)
+		return
+	}
+	unixSockets.paths[host] = path
+}
+
+// UnixSocketPath returns the socket path mapped to the pseudo host.
+func UnixSocketPath(host string) (string, bool) {
+	unixSockets.mu.RLock()
+	defer unixSockets.mu.RUnlock()
+
+	path, ok := unixSockets.paths[sip.TokenLower(host)]
+	return path, ok
+}
+
+func unixSocketPath(host string) (string, error) {
+	if path, ok := UnixSocketPath(host); ok {
+		return path, nil
+	}
+	return "", fmt.Errorf("unix socket of host '%s' is not mapped", host)
+}
+
+// Pseudo address of the unix socket connection peer.
+type unixAddr struct {
+	host string
+	port sip.Port
+}
+
+func (addr unixAddr) Network() string { return "unix" }
+func (addr unixAddr) String() string  { return fmt.Sprintf("%s:%d", addr.host, addr.port) }
+
+// unixConn hides the socket paths behind pseudo addresses, it is never a net.PacketConn
+// so the connection is served as a stream.
+type unixConn struct {
+	net.Conn
+	raddr unixAddr
+}
+
+func (c *unixConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+type unixListener struct {
+	net.Listener
+	peers *uint32
+}
+
+func (l *unixListener) Network() string {
+	return unixProto.ViaToken
+}
+
+func (l *unixListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	// port 0 is skipped on the wrap around
+	peer := atomic.AddUint32(l.peers, 1)%0xffff + 1
+	return &unixConn{Conn: conn, raddr: unixAddr{UnixPeerHost, sip.Port(peer)}}, nil
+}
+
+// Unix domain socket protocol implementation
+type unixProtocol struct {
+	protocol
+	listeners   ListenerPool
+	connections ConnectionPool
+	conns       chan Connection
+	idleTimeout time.Duration
+	peers       uint32
+}
+
+func NewUnixProtocol(
+	output chan<- sip.Message,
+	errs chan<- error,
+	cancel <-chan struct{},
+	msgMapper sip.MessageMapper,
+	logger log.Logger,
+	options ...ProtocolOption,
+) Protocol {
+	p := new(unixProtocol)
+	p.network = unixProto.Network
+	p.reliable = unixProto.Reliable
+	p.streamed = unixProto.Streamed
+	p.conns = make(chan Connection)
+	p.idleTimeout = applyProtocolOptions(options...).IdleTimeout
+	p.log = logger.
+		WithPrefix("transport.Protocol").
+		WithFields(log.Fields{
+			"protocol_ptr": fmt.Sprintf("%p", p),
+		})
+	p.listeners = NewListenerPool(p.conns, errs, cancel, p.Log())
+	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log(), options...)
+	// pipe listener and connection pools
+	go p.pipePools()
+
+	return p
+}
+
+func (p *unixProtocol) Done() <-chan struct{} {
+	return p.connections.Done()
+}
+
+func (p *unixProtocol) pipePools() {
+	defer close(p.conns)
+
+	for {
+		select {
+		case <-p.listeners.Done():
+			return
+		case conn := <-p.conns:
+			if err := p.connections.Put(conn, p.idleTimeout); err != nil {
+				log.AddFieldsFrom(p.Log(), conn).Errorf("put %s connection to the pool failed: %s", conn.Key(), err)
+
+				conn.Close()
+			}
+		}
+	}
+}
+
+// Listen listens on the socket mapped to the target host.
+func (p *unixProtocol) Listen(target *Target, options ...ListenOption) error {
+	target = FillTargetHostAndPort(p.Network(), target)
+	path, err := unixSocketPath(target.Host)
+	if err != nil {
+		return &ProtocolError{
+			err,
+			fmt.Sprintf("resolve target address %s %s", p.Network(), target.Addr()),
+			fmt.Sprintf("%p", p),
+		}
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return &ProtocolError{
+			err,
+			fmt.Sprintf("listen on %s %s address", p.Network(), path),
+			fmt.Sprintf("%p", p),
+		}
+	}
+
+	p.Log().Debugf("begin listening on %s %s", p.Network(), path)
+
+	key := ListenerKey(fmt.Sprintf("%s:%s", p.network, path))
+	err = p.listeners.Put(key, &unixListener{Listener: listener, peers: &p.peers})
+	if err != nil {
+		err = &ProtocolError{
+			Err:      err,
+			Op:       fmt.Sprintf("put %s listener to the pool", key),
+			ProtoPtr: fmt.Sprintf("%p", p),
+		}
+	}
+	return err
+}
+
+func (p *unixProtocol) Send(target *Target, msg sip.Message) error {
+	return p.SendContext(context.Background(), target, msg)
+}
+
+// SendContext sends the message over the connection of the target pseudo address,
+// the connection is dialed to the socket mapped to the target host if it doesn't exist.
+func (p *unixProtocol) SendContext(ctx context.Context, target *Target, msg sip.Message) error {
+	target = FillTargetHostAndPort(p.Network(), target)
+
+	conn, err := p.getOrCreateConnection(ctx, target)
+	if err != nil {
+		return &ProtocolError{
+			Err:      err,
+			Op:       fmt.Sprintf("get or create %s connection", p.Network()),
+			ProtoPtr: fmt.Sprintf("%p", p),
+		}
+	}
+
+	log.AddFieldsFrom(p.Log(), conn, msg).Tracef("writing SIP message to %s %s", p.Network(), target.Addr())
+
+	data := []byte(msg.String())
+	num, err := writeContext(ctx, conn, data)
+	if err != nil {
+		if num > 0 && num < len(data) {
+			// partially written message breaks the stream
+			_ = p.connections.Drop(conn.Key())
+		}
+		return &ProtocolError{
+			Err:      contextError(ctx, err, "write"),
+			Op:       fmt.Sprintf("write SIP message to the %s connection", conn.Key()),
+			ProtoPtr: fmt.Sprintf("%p", p),
+		}
+	}
+	return nil
+}
+
+func (p *unixProtocol) getOrCreateConnection(ctx context.Context, target *Target) (Connection, error) {
+	raddr := unixAddr{sip.TokenLower(target.Host), *target.Port}
+	key := ConnectionKey(p.network + ":" + raddr.String())
+	if conn, err := p.connections.Get(key); err == nil {
+		return conn, nil
+	}
+
+	if sip.TokenEqual(raddr.host, UnixPeerHost) {
+		return nil, fmt.Errorf("connection of unix socket peer %s is closed", raddr)
+	}
+	path, err := unixSocketPath(raddr.host)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Log().Debugf("connection for remote address %s %s not found, create a new one", p.Network(), raddr)
+
+	var dialer net.Dialer
+	baseConn, err := dialer.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("dial to %s %s: %w", p.Network(), path, contextError(ctx, err, "dial"))
+	}
+
+	conn := NewConnection(&unixConn{Conn: baseConn, raddr: raddr}, key, p.network, p.Log())
+	if err := p.connections.Put(conn, p.idleTimeout); err != nil {
+		return conn, fmt.Errorf("put %s connection to the pool: %w", conn.Key(), err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,96 @@
+package transport_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("UnixProtocol", func() {
+	var (
+		server, client transport.Layer
+		dir            string
+	)
+	logger := testutils.NewLogrusLogger()
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "gosip-unix")
+		Expect(err).ToNot(HaveOccurred())
+		transport.MapUnixSocket("app", filepath.Join(dir, "app.sock"))
+
+		server = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger)
+		client = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger)
+		Expect(server.Listen("unix", "app:5060")).To(Succeed())
+	})
+	AfterEach(func(done Done) {
+		client.Cancel()
+		server.Cancel()
+		<-client.Done()
+		<-server.Done()
+		transport.MapUnixSocket("app", "")
+		os.RemoveAll(dir)
+		close(done)
+	}, 3)
+
+	It("should be registered as reliable stream transport", func() {
+		Expect(server.IsReliable("UNIX")).To(BeTrue())
+		Expect(server.IsStreamed("unix")).To(BeTrue())
+		path, ok := transport.UnixSocketPath("APP")
+		Expect(ok).To(BeTrue())
+		Expect(path).To(Equal(filepath.Join(dir, "app.sock")))
+	})
+
+	It("should exchange request and response over the socket", func(done Done) {
+		req := testutils.Request([]string{
+			"MESSAGE sip:bob@app;transport=unix SIP/2.0",
+			"Via: SIP/2.0/UNIX sidecar;branch=" + sip.GenerateBranch(),
+			"To: <sip:bob@app>",
+			"From: <sip:alice@sidecar>;tag=1928301774",
+			"Call-ID: unix-request",
+			"CSeq: 1 MESSAGE",
+			"Content-Length: 5",
+			"",
+			"hello",
+		})
+		Expect(client.Send(req)).To(Succeed())
+
+		var in sip.Message
+		Eventually(server.Messages(), 3).Should(Receive(&in))
+		Expect(in.Transport()).To(Equal("UNIX"))
+		Expect(in.Body()).To(Equal("hello"))
+		host, _, err := net.SplitHostPort(in.Source())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(host).To(Equal(transport.UnixPeerHost))
+
+		res := sip.NewResponseFromRequest("", in.(sip.Request), 200, "OK", "")
+		Expect(server.Send(res)).To(Succeed())
+
+		Eventually(client.Messages(), 3).Should(Receive(&in))
+		Expect(in.(sip.Response).StatusCode()).To(Equal(sip.StatusCode(200)))
+		close(done)
+	}, 5)
+
+	It("should fail to send to unmapped host", func() {
+		req := testutils.Request([]string{
+			"MESSAGE sip:bob@nowhere;transport=unix SIP/2.0",
+			"Via: SIP/2.0/UNIX sidecar;branch=" + sip.GenerateBranch(),
+			"To: <sip:bob@nowhere>",
+			"From: <sip:alice@sidecar>;tag=1928301774",
+			"Call-ID: unix-request",
+			"CSeq: 1 MESSAGE",
+			"Content-Length: 0",
+			"",
+			"",
+		})
+		Expect(client.Send(req)).To(MatchError(ContainSubstring("not mapped")))
+	})
+})
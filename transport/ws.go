@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"strings"
 	"time"
 
@@ -18,8 +19,24 @@ import (
 
 var (
 	wsSubProtocol = "sip"
+	// RFC 7118 4.1 - the handshake without "sip" subprotocol must be rejected
+	errWsNoSubProtocol = ws.RejectConnectionError(
+		ws.RejectionStatus(http.StatusBadRequest),
+		ws.RejectionReason(WsSubProtocolError("client does not offer it").Error()),
+	)
 )
 
+// WsSubProtocolError is returned when the WebSocket handshake does not negotiate
+// the "sip" subprotocol - RFC 7118 4.1.
+type WsSubProtocolError string
+
+func (err WsSubProtocolError) Network() bool   { return true }
+func (err WsSubProtocolError) Timeout() bool   { return false }
+func (err WsSubProtocolError) Temporary() bool { return false }
+func (err WsSubProtocolError) Error() string {
+	return fmt.Sprintf("WebSocket subprotocol '%s' is not negotiated: %s", wsSubProtocol, string(err))
+}
+
 type wsConn struct {
 	net.Conn
 	client bool
@@ -73,32 +90,49 @@ type wsListener struct {
 }
 
 func NewWsListener(listener net.Listener, network string, log log.Logger) *wsListener {
-	l := &wsListener{
+	return &wsListener{
 		Listener: listener,
 		network:  network,
 		log:      log,
 	}
-	l.u.Protocol = func(val []byte) bool {
-		return string(val) == wsSubProtocol
-	}
-	return l
 }
 
 func (l *wsListener) Accept() (net.Conn, error) {
-	conn, err := l.Listener.Accept()
-	if err != nil {
-		return nil, fmt.Errorf("accept new connection: %w", err)
-	}
-	if _, err = l.u.Upgrade(conn); err == nil {
-		conn = &wsConn{
-			Conn:   conn,
-			client: false,
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, fmt.Errorf("accept new connection: %w", err)
 		}
-	} else {
+
+		var negotiated bool
+		u := l.u
+		u.Protocol = func(val []byte) bool {
+			ok := string(val) == wsSubProtocol
+			negotiated = negotiated || ok
+			return ok
+		}
+		u.OnBeforeUpgrade = func() (ws.HandshakeHeader, error) {
+			if !negotiated {
+				return nil, errWsNoSubProtocol
+			}
+			return nil, nil
+		}
+
+		if _, err = u.Upgrade(conn); err == nil {
+			return &wsConn{
+				Conn:   conn,
+				client: false,
+			}, nil
+		}
+		if err == errWsNoSubProtocol {
+			l.log.Warnf("reject WS connection from %s: %s", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+
 		l.log.Warnf("fallback to simple TCP connection due to WS upgrade error: %s", err)
-		err = nil
+		return conn, nil
 	}
-	return conn, err
 }
 
 func (l *wsListener) Network() string {
@@ -111,7 +145,7 @@ type wsProtocol struct {
 	connections ConnectionPool
 	conns       chan Connection
 	listen      func(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error)
-	resolveAddr func(addr string) (*net.TCPAddr, error)
+	resolveAddr func(ctx context.Context, addr string) (*net.TCPAddr, error)
 	dialer      ws.Dialer
 }
 
@@ -121,6 +155,7 @@ func NewWsProtocol(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) Protocol {
 	p := new(wsProtocol)
 	p.network = "ws"
@@ -134,7 +169,7 @@ func NewWsProtocol(
 		})
 	//TODO: add separate errs chan to listen errors from pool for reconnection?
 	p.listeners = NewListenerPool(p.conns, errs, cancel, p.Log())
-	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log())
+	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log(), options...)
 	p.listen = p.defaultListen
 	p.resolveAddr = p.defaultResolveAddr
 	p.dialer.Protocols = []string{wsSubProtocol}
@@ -146,11 +181,11 @@ func NewWsProtocol(
 }
 
 func (p *wsProtocol) defaultListen(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error) {
-	return net.ListenTCP("tcp", addr)
+	return listenTCP(addr, applyListenOptions(options...), p.Log())
 }
 
-func (p *wsProtocol) defaultResolveAddr(addr string) (*net.TCPAddr, error) {
-	return net.ResolveTCPAddr("tcp", addr)
+func (p *wsProtocol) defaultResolveAddr(ctx context.Context, addr string) (*net.TCPAddr, error) {
+	return resolveTCPAddr(ctx, "tcp", addr)
 }
 
 func (p *wsProtocol) Done() <-chan struct{} {
@@ -185,7 +220,7 @@ func (p *wsProtocol) pipePools() {
 
 func (p *wsProtocol) Listen(target *Target, options ...ListenOption) error {
 	target = FillTargetHostAndPort(p.Network(), target)
-	laddr, err := p.resolveAddr(target.Addr())
+	laddr, err := p.resolveAddr(context.Background(), target.Addr())
 	if err != nil {
 		return &ProtocolError{
 			err,
@@ -221,6 +256,10 @@ func (p *wsProtocol) Listen(target *Target, options ...ListenOption) error {
 }
 
 func (p *wsProtocol) Send(target *Target, msg sip.Message) error {
+	return p.SendContext(context.Background(), target, msg)
+}
+
+func (p *wsProtocol) SendContext(ctx context.Context, target *Target, msg sip.Message) error {
 	target = FillTargetHostAndPort(p.Network(), target)
 
 	//validate remote address
@@ -232,17 +271,17 @@ func (p *wsProtocol) Send(target *Target, msg sip.Message) error {
 		}
 	}
 	//resolve remote address
-	raddr, err := p.resolveAddr(target.Addr())
+	raddr, err := p.resolveAddr(ctx, target.Addr())
 	if err != nil {
 		return &ProtocolError{
-			err,
+			contextError(ctx, err, "resolve"),
 			fmt.Sprintf("resolve target address %s %s", p.Network(), target.Addr()),
 			fmt.Sprintf("%p", p),
 		}
 	}
 
 	//find or create connection
-	conn, err := p.getOrCreateConnection(raddr)
+	conn, err := p.getOrCreateConnection(ctx, raddr)
 	if err != nil {
 		return &ProtocolError{
 			Err:      err,
@@ -255,10 +294,17 @@ func (p *wsProtocol) Send(target *Target, msg sip.Message) error {
 	logger.Tracef("writing SIP message to %s %s", p.Network(), raddr)
 
 	//send message
-	_, err = conn.Write([]byte(msg.String()))
+	data := []byte(msg.String())
+	num, err := writeContext(ctx, conn, data)
 	if err != nil {
+		if num > 0 && num < len(data) {
+			// partially written message breaks the stream
+			if err := p.connections.Drop(conn.Key()); err != nil {
+				logger.Tracef("drop connection %s failed: %s", conn.Key(), err)
+			}
+		}
 		err = &ProtocolError{
-			Err:      err,
+			Err:      contextError(ctx, err, "write"),
 			Op:       fmt.Sprintf("write SIP message to the %s connection", conn.Key()),
 			ProtoPtr: fmt.Sprintf("%p", p),
 		}
@@ -267,24 +313,30 @@ func (p *wsProtocol) Send(target *Target, msg sip.Message) error {
 	return err
 }
 
-func (p *wsProtocol) getOrCreateConnection(raddr *net.TCPAddr) (Connection, error) {
+func (p *wsProtocol) getOrCreateConnection(ctx context.Context, raddr *net.TCPAddr) (Connection, error) {
 	key := ConnectionKey(p.network + ":" + raddr.String())
 	conn, err := p.connections.Get(key)
 	if err != nil {
 		p.Log().Debugf("connection for address %s %s not found; create a new one", p.Network(), raddr)
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
 		defer cancel()
 		url := fmt.Sprintf("%s://%s", p.network, raddr)
-		baseConn, _, _, err := p.dialer.Dial(ctx, url)
+		baseConn, _, hs, err := p.dialer.Dial(ctx, url)
 		if err == nil {
+			if hs.Protocol != wsSubProtocol {
+				baseConn.Close()
+				return nil, fmt.Errorf("dial to %s %s: %w", p.Network(), raddr,
+					WsSubProtocolError("server does not accept it"))
+			}
+
 			baseConn = &wsConn{
 				Conn:   baseConn,
 				client: true,
 			}
 		} else {
 			if baseConn == nil {
-				return nil, fmt.Errorf("dial to %s %s: %w", p.Network(), raddr, err)
+				return nil, fmt.Errorf("dial to %s %s: %w", p.Network(), raddr, contextError(ctx, err, "dial"))
 			}
 
 			p.Log().Warnf("fallback to TCP connection due to WS upgrade error: %s", err)
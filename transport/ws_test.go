@@ -1,6 +1,7 @@
 package transport_test
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
@@ -240,6 +241,30 @@ var _ = Describe("WsProtocol", func() {
 			}, 3)
 		})
 
+		Context("when client does not offer sip subprotocol", func() {
+			It("should reject the handshake and keep listening", func(done Done) {
+				targetUrl, err := url.Parse(fmt.Sprintf("ws://%s", localTarget1.Addr()))
+				Expect(err).ToNot(HaveOccurred())
+
+				By("client1 upgrades without subprotocol")
+				client1 = testutils.CreateClient(network, localTarget1.Addr(), "")
+				_, _, err = (&ws.Dialer{}).Upgrade(client1, targetUrl)
+				Expect(err).To(HaveOccurred())
+				var statusErr ws.StatusError
+				Expect(errors.As(err, &statusErr)).To(BeTrue())
+				Expect(int(statusErr)).To(Equal(400))
+
+				By("client2 upgrades with sip subprotocol")
+				client2 = testutils.CreateClient(network, localTarget1.Addr(), "")
+				_, hs, err := wsDial.Upgrade(client2, targetUrl)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hs.Protocol).To(Equal("sip"))
+				Expect(wsutil.WriteClientText(client2, []byte(msg1))).To(Succeed())
+				testutils.AssertMessageArrived(output, fmt.Sprintf(expectedMsg1, client2.LocalAddr().(*net.TCPAddr).IP), client2.LocalAddr().String(), localTarget1.Addr())
+				close(done)
+			}, 3)
+		})
+
 		Context("after cancel signal received", func() {
 			BeforeEach(func() {
 				time.Sleep(time.Millisecond)
@@ -21,6 +21,7 @@ func NewWssProtocol(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) Protocol {
 	p := new(wssProtocol)
 	p.network = "wss"
@@ -34,22 +35,21 @@ func NewWssProtocol(
 		})
 	//TODO: add separate errs chan to listen errors from pool for reconnection?
 	p.listeners = NewListenerPool(p.conns, errs, cancel, p.Log())
-	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log())
+	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log(), options...)
 	p.listen = func(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error) {
 		if len(options) == 0 {
 			return net.ListenTCP("tcp", addr)
 		}
-		optsHash := ListenOptions{}
-		for _, opt := range options {
-			opt.ApplyListen(&optsHash)
+		optsHash := applyListenOptions(options...)
+		config, err := loadTLSConfig(optsHash.TLSConfig)
+		if err != nil {
+			return nil, err
 		}
-		cert, err := tls.LoadX509KeyPair(optsHash.TLSConfig.Cert, optsHash.TLSConfig.Key)
+		listener, err := listenTCP(addr, optsHash, p.Log())
 		if err != nil {
-			return nil, fmt.Errorf("load TLS certficate %s: %w", optsHash.TLSConfig.Cert, err)
+			return nil, err
 		}
-		return tls.Listen("tcp", addr.String(), &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		})
+		return &tlsListener{Listener: listener, config: config}, nil
 	}
 	p.resolveAddr = p.defaultResolveAddr
 	p.dialer.Protocols = []string{wsSubProtocol}
@@ -59,6 +59,9 @@ func NewWssProtocol(
 			return nil
 		},
 	}
+	if optsHash := applyProtocolOptions(options...); optsHash.DialTLSConfig != nil {
+		p.dialer.TLSConfig = optsHash.DialTLSConfig
+	}
 	//pipe listener and connection pools
 	go p.pipePools()
 
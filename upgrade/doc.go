@@ -0,0 +1,28 @@
+// Package upgrade implements zero-downtime binary upgrade of the SIP server.
+//
+// The running (old) process waits for its successor on a unix socket and hands over
+// duplicates of the listening sockets together with serialized snapshots.
+// The new process listens on the inherited sockets, restores the snapshots and acknowledges the takeover,
+// after that the old process shuts down. Until the acknowledgement the old process keeps serving,
+// so failed upgrade doesn't interrupt the service.
+//
+// Old process:
+//
+//	h, err := upgrade.Listen("/run/sip/upgrade.sock")
+//	// ... start the new binary ...
+//	files, err := srv.Files()
+//	if err := h.Handover(files, snapshots); err == nil {
+//		srv.Shutdown()
+//	}
+//
+// New process:
+//
+//	state, err := upgrade.Receive("/run/sip/upgrade.sock")
+//	for _, file := range state.Files {
+//		srv.Listen(network, "", transport.ListenFile{File: file})
+//	}
+//	state.Restore(store)
+//	state.Ack()
+//
+// Socket handover relies on SCM_RIGHTS, so the package is available on unix platforms only.
+package upgrade
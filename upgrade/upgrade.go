@@ -0,0 +1,215 @@
+//go:build !windows
+// +build !windows
+
+package upgrade
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/ghettovoice/gosip/snapshot"
+)
+
+// Max number of file descriptors passed in one message (SCM_MAX_FD).
+const maxFiles = 253
+
+// AckTimeout is the time Handover waits for the acknowledgement of the new process.
+var AckTimeout = time.Minute
+
+const (
+	ack   byte = 1
+	abort byte = 0
+)
+
+// ErrAborted is returned by Handover if the new process failed to take over.
+var ErrAborted = errors.New("upgrade aborted by the new process")
+
+type message struct {
+	Files     []string          `json:"files"`
+	Snapshots map[string][]byte `json:"snapshots"`
+}
+
+// Handover is the old process side of the upgrade.
+type Handover struct {
+	ln *net.UnixListener
+}
+
+// Listen starts waiting for the new process on the unix socket.
+func Listen(path string) (*Handover, error) {
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("listen upgrade socket %s: %w", path, err)
+	}
+	return &Handover{ln: ln}, nil
+}
+
+// Handover waits for the new process, sends the files and the snapshots to it
+// and waits its acknowledgement. Files are not closed.
+// nil error means the new process took over and the old one should shut down.
+func (h *Handover) Handover(files []*os.File, snapshots map[string][]byte) error {
+	if len(files) > maxFiles {
+		return fmt.Errorf("too many files to hand over: %d > %d", len(files), maxFiles)
+	}
+
+	conn, err := h.ln.AcceptUnix()
+	if err != nil {
+		return fmt.Errorf("accept new process: %w", err)
+	}
+	defer conn.Close()
+
+	msg := message{
+		Files:     make([]string, 0, len(files)),
+		Snapshots: snapshots,
+	}
+	fds := make([]int, 0, len(files))
+	for _, file := range files {
+		msg.Files = append(msg.Files, file.Name())
+		fds = append(fds, int(file.Fd()))
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode upgrade state: %w", err)
+	}
+
+	head := make([]byte, 4)
+	binary.BigEndian.PutUint32(head, uint32(len(payload)))
+	if _, _, err := conn.WriteMsgUnix(head, syscall.UnixRights(fds...), nil); err != nil {
+		return fmt.Errorf("send files: %w", err)
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return fmt.Errorf("send upgrade state: %w", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(AckTimeout))
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("wait acknowledgement: %w", err)
+	}
+	if reply[0] != ack {
+		return ErrAborted
+	}
+	return nil
+}
+
+// Close stops waiting for the new process and removes the unix socket.
+func (h *Handover) Close() error {
+	return h.ln.Close()
+}
+
+// State is the state received by the new process.
+type State struct {
+	// Files are the listening sockets of the old process named as they were named there.
+	Files     []*os.File
+	Snapshots map[string][]byte
+
+	conn *net.UnixConn
+}
+
+// Receive connects to the old process and receives its state.
+// Ack or Abort must be called after the takeover.
+func Receive(path string) (*State, error) {
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("dial upgrade socket %s: %w", path, err)
+	}
+
+	state, err := receive(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return state, nil
+}
+
+func receive(conn *net.UnixConn) (*State, error) {
+	head := make([]byte, 4)
+	oob := make([]byte, syscall.CmsgSpace(maxFiles*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(head, oob)
+	if err != nil {
+		return nil, fmt.Errorf("receive files: %w", err)
+	}
+	if _, err := io.ReadFull(conn, head[n:]); err != nil {
+		return nil, fmt.Errorf("receive upgrade state: %w", err)
+	}
+
+	fds := make([]int, 0)
+	cmsgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, fmt.Errorf("parse files: %w", err)
+	}
+	for _, cmsg := range cmsgs {
+		rights, err := syscall.ParseUnixRights(&cmsg)
+		if err != nil {
+			closeFds(fds)
+			return nil, fmt.Errorf("parse files: %w", err)
+		}
+		fds = append(fds, rights...)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(head))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		closeFds(fds)
+		return nil, fmt.Errorf("receive upgrade state: %w", err)
+	}
+	var msg message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		closeFds(fds)
+		return nil, fmt.Errorf("decode upgrade state: %w", err)
+	}
+	if len(msg.Files) != len(fds) {
+		closeFds(fds)
+		return nil, fmt.Errorf("received %d files, expected %d", len(fds), len(msg.Files))
+	}
+
+	state := &State{
+		Files:     make([]*os.File, 0, len(fds)),
+		Snapshots: msg.Snapshots,
+		conn:      conn,
+	}
+	for i, fd := range fds {
+		syscall.CloseOnExec(fd)
+		state.Files = append(state.Files, os.NewFile(uintptr(fd), msg.Files[i]))
+	}
+	return state, nil
+}
+
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		_ = syscall.Close(fd)
+	}
+}
+
+// Restore saves received snapshots to the store.
+func (state *State) Restore(store snapshot.Store) error {
+	for key, data := range state.Snapshots {
+		if err := store.Save(key, data); err != nil {
+			return fmt.Errorf("restore snapshot %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Ack tells the old process that the new one took over, so it can shut down.
+func (state *State) Ack() error {
+	return state.reply(ack)
+}
+
+// Abort tells the old process to keep serving. Received files should be closed by the caller.
+func (state *State) Abort() error {
+	return state.reply(abort)
+}
+
+func (state *State) reply(b byte) error {
+	defer state.conn.Close()
+	if _, err := state.conn.Write([]byte{b}); err != nil {
+		return fmt.Errorf("reply to the old process: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+//go:build !windows
+// +build !windows
+
+package upgrade_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghettovoice/gosip/snapshot"
+	"github.com/ghettovoice/gosip/upgrade"
+)
+
+func newHandover(t *testing.T) (*upgrade.Handover, string, func()) {
+	dir, err := ioutil.TempDir("", "gosip-upgrade")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	path := filepath.Join(dir, "upgrade.sock")
+	h, err := upgrade.Listen(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return h, path, func() {
+		h.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHandover(t *testing.T) {
+	h, path, cleanup := newHandover(t)
+	defer cleanup()
+
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer ls.Close()
+	file, err := ls.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer file.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.Handover([]*os.File{file}, map[string][]byte{"tx1": []byte("state")})
+	}()
+
+	state, err := upgrade.Receive(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(state.Files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(state.Files))
+	}
+	if state.Files[0].Name() != file.Name() {
+		t.Errorf("expected file name %q, got %q", file.Name(), state.Files[0].Name())
+	}
+
+	inherited, err := net.FileListener(state.Files[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer inherited.Close()
+	if inherited.Addr().String() != ls.Addr().String() {
+		t.Errorf("expected listener address %s, got %s", ls.Addr(), inherited.Addr())
+	}
+
+	store := snapshot.NewMemoryStore()
+	if err := state.Restore(store); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if data, err := store.Load("tx1"); err != nil || !bytes.Equal(data, []byte("state")) {
+		t.Errorf("expected restored snapshot 'state', got %q (%v)", data, err)
+	}
+
+	if err := state.Ack(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected successful handover, got %s", err)
+	}
+}
+
+func TestHandoverAborted(t *testing.T) {
+	h, path, cleanup := newHandover(t)
+	defer cleanup()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.Handover(nil, nil)
+	}()
+
+	state, err := upgrade.Receive(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := state.Abort(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := <-done; !errors.Is(err, upgrade.ErrAborted) {
+		t.Errorf("expected ErrAborted, got %v", err)
+	}
+}